@@ -23,33 +23,15 @@ package main
 import (
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"strconv"
 
-	gwr "github.com/uber-go/gwr"
 	"github.com/uber-go/gwr/source/tap"
 )
 
-func main() {
-	if err := gwr.Configure(nil); err != nil {
-		log.Fatal(err)
-	}
-
-	resLog := &resLogger{handler: http.DefaultServeMux}
-	reqLog := &reqLogger{handler: resLog}
-
-	gwr.AddGenericDataSource(reqLog)
-	gwr.AddGenericDataSource(resLog)
-
-	fb := fibber{
-		naive: tap.AddNewTracer("fib/naive"),
-	}
-	http.HandleFunc("/fib/naive", fb.handleNaive)
-
-	log.Fatal(http.ListenAndServe(":8080", reqLog))
-}
-
+// fibber serves naively computed fibonacci numbers, tracing every recursive
+// call, so that there's something to watch on the "/tap/trace/fib/naive"
+// source.
 type fibber struct {
 	naive *tap.Tracer
 }
@@ -0,0 +1,176 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Command gwr-demo is a small web server instrumented with most of gwr's
+// sources, for trying out gwr's protocols, formats, and clients against.
+//
+// Usage:
+//
+//	gwr-demo [flags]
+//
+// It serves gwr on -listen, and a demo site on -http: "/fib/naive?n=N"
+// computes a fibonacci number, tracing every call, "/emit?k=v" emits its
+// parameters, and anything else is a 404.  Each source may be turned off by
+// its flag; fake sources are off unless -fake is given.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/uber-go/gwr"
+	"github.com/uber-go/gwr/source"
+	"github.com/uber-go/gwr/source/fake"
+	"github.com/uber-go/gwr/source/httptap"
+	"github.com/uber-go/gwr/source/logtap"
+	"github.com/uber-go/gwr/source/runtimetap"
+	"github.com/uber-go/gwr/source/script"
+	"github.com/uber-go/gwr/source/tap"
+)
+
+type options struct {
+	listen   string
+	http     string
+	tracer   bool
+	emitter  bool
+	httptap  bool
+	logs     bool
+	runtime  bool
+	expvar   bool
+	rollups  time.Duration
+	scripts  bool
+	fake     bool
+	interval time.Duration
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stderr))
+}
+
+func run(args []string, stderr io.Writer) int {
+	var opts options
+	flags := flag.NewFlagSet("gwr-demo", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&opts.listen, "listen", ":4040", "address to serve gwr on, superceded by $GWR_LISTEN")
+	flags.StringVar(&opts.http, "http", ":8080", "address to serve the demo site on")
+	flags.BoolVar(&opts.tracer, "tracer", true, "trace /fib/naive calls on /tap/trace/fib/naive")
+	flags.BoolVar(&opts.emitter, "emitter", true, "emit /emit parameters on /tap/demo/events")
+	flags.BoolVar(&opts.httptap, "httptap", true, "tap demo site traffic on /http/demo/{requests,responses}")
+	flags.BoolVar(&opts.logs, "logs", true, "tap the demo's log on /logs/demo")
+	flags.BoolVar(&opts.runtime, "runtime", true, "sample runtime statistics on /runtime/stats")
+	flags.BoolVar(&opts.expvar, "expvar", true, "sample expvars on /runtime/expvar, and their rates on /runtime/expvar/rate")
+	flags.DurationVar(&opts.rollups, "rollups", 10*time.Second, "window to aggregate response durations over on /http/demo/responses/agg, 0 for none")
+	flags.BoolVar(&opts.scripts, "scripts", true, "allow scripts to be defined through /meta/scripts")
+	flags.BoolVar(&opts.fake, "fake", false, "add fake sources under /fake")
+	flags.DurationVar(&opts.interval, "interval", time.Second, "how often watched runtime and fake sources step")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	if flags.NArg() > 0 {
+		flags.Usage()
+		return 2
+	}
+
+	handler, err := addSources(opts)
+	if err != nil {
+		fmt.Fprintf(stderr, "gwr-demo: %v\n", err)
+		return 1
+	}
+	if err := gwr.Configure(&gwr.Config{ListenAddr: opts.listen}); err != nil {
+		fmt.Fprintf(stderr, "gwr-demo: %v\n", err)
+		return 1
+	}
+	log.Printf("serving gwr on %s, and the demo site on %s", opts.listen, opts.http)
+	if err := http.ListenAndServe(opts.http, handler); err != nil {
+		fmt.Fprintf(stderr, "gwr-demo: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+// addSources adds the sources chosen by opts to the default gwr sources, and
+// returns the demo site's handler.
+func addSources(opts options) (http.Handler, error) {
+	mux := http.NewServeMux()
+
+	if opts.logs {
+		log.SetOutput(io.MultiWriter(os.Stderr, logtap.Add("demo")))
+	}
+
+	fb := fibber{naive: tap.NewTracer("fib/naive")}
+	if opts.tracer {
+		fb.naive = tap.AddNewTracer("fib/naive")
+	}
+	mux.HandleFunc("/fib/naive", fb.handleNaive)
+
+	events := tap.NewEmitter("demo/events", nil)
+	if opts.emitter {
+		events = tap.AddEmitter("demo/events", nil)
+	}
+	mux.HandleFunc("/emit", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "400 Bad Request", http.StatusBadRequest)
+			return
+		}
+		events.Emit(r.Form)
+		io.WriteString(w, "OK\n")
+	})
+
+	var handler http.Handler = mux
+	if opts.httptap {
+		th := httptap.New("demo", mux)
+		gwr.AddGenericDataSource(th.Requests())
+		if opts.rollups > 0 {
+			agg := source.NewAggregated(th.Responses(), "duration_ms", opts.rollups)
+			gwr.AddGenericDataSource(agg.Raw())
+			gwr.AddGenericDataSource(agg)
+		} else {
+			gwr.AddGenericDataSource(th.Responses())
+		}
+		handler = th
+	}
+
+	if opts.runtime {
+		runtimetap.AddStats(opts.interval)
+	}
+	if opts.expvar {
+		expvars := runtimetap.AddExpvar(opts.interval)
+		gwr.AddGenericDataSource(source.NewRated(expvars, opts.interval))
+	}
+	if opts.scripts {
+		script.AddManager()
+	}
+	if opts.fake {
+		if _, err := fake.AddConfigured(
+			fake.Config{Name: "load", Interval: opts.interval, Sine: &fake.Sine{Period: 60, Amplitude: 10, Offset: 50}},
+			fake.Config{Name: "requests", Interval: opts.interval, AccessLog: &fake.AccessLog{Seed: 1, PerStep: 5, ErrorRate: 0.05}},
+			fake.Config{Name: "traces", Interval: opts.interval, Traces: &fake.Traces{Seed: 1}},
+		); err != nil {
+			return nil, err
+		}
+	}
+
+	return handler, nil
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// +build !gwr_noop
+
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber-go/gwr"
+)
+
+func TestAddSources(t *testing.T) {
+	handler, err := addSources(options{
+		tracer:   true,
+		emitter:  true,
+		httptap:  true,
+		runtime:  true,
+		expvar:   true,
+		rollups:  time.Second,
+		scripts:  true,
+		fake:     true,
+		interval: time.Second,
+	})
+	require.NoError(t, err)
+
+	for _, name := range []string{
+		"/tap/trace/fib/naive",
+		"/tap/demo/events",
+		"/http/demo/requests",
+		"/http/demo/responses",
+		"/http/demo/responses/agg",
+		"/runtime/stats",
+		"/runtime/expvar",
+		"/runtime/expvar/rate",
+		"/meta/scripts",
+		"/fake/load",
+		"/fake/requests",
+		"/fake/traces",
+	} {
+		assert.NotNil(t, gwr.DefaultDataSources.Get(name), "%s added", name)
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/fib/naive?n=10", nil))
+	assert.Equal(t, "fib(10) = 55\n", rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/emit?a=1", nil))
+	assert.Equal(t, "OK\n", rec.Body.String())
+}
+
+func TestRun_usage(t *testing.T) {
+	var stderr bytes.Buffer
+	assert.Equal(t, 2, run([]string{"extra"}, &stderr))
+	assert.Contains(t, stderr.String(), "-httptap")
+}
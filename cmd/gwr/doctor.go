@@ -0,0 +1,74 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// selftestName is the server's self test source.
+const selftestName = "/meta/selftest"
+
+var errUnhealthy = errors.New("unhealthy")
+
+// selftest is the json of a self test, as gotten from selftestName.
+type selftest struct {
+	OK     bool `json:"ok"`
+	Checks []struct {
+		Name   string `json:"name"`
+		Status string `json:"status"`
+		Detail string `json:"detail"`
+	} `json:"checks"`
+}
+
+// doctor gets the server's self test, printing each check, and then whether
+// the server is healthy; errUnhealthy is returned if any check failed.
+func doctor(cl client, out *printer) error {
+	var buf bytes.Buffer
+	if err := cl.get(selftestName, "json", &printer{w: &buf}); err != nil {
+		return err
+	}
+	var st selftest
+	if err := json.Unmarshal(buf.Bytes(), &st); err != nil {
+		return fmt.Errorf("invalid %s result: %v", selftestName, err)
+	}
+
+	warned := false
+	for _, check := range st.Checks {
+		if check.Status == "warn" {
+			warned = true
+		}
+		if err := out.line(fmt.Sprintf("%-4s %s: %s", check.Status, check.Name, check.Detail)); err != nil {
+			return err
+		}
+	}
+	switch {
+	case !st.OK:
+		return errUnhealthy
+	case warned:
+		return out.line("healthy, with warnings")
+	default:
+		return out.line("healthy")
+	}
+}
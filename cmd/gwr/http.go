@@ -0,0 +1,146 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// maxLineSize bounds the size of a single watched line or item.
+const maxLineSize = 1024 * 1024
+
+type httpClient struct {
+	opts   options
+	client *http.Client
+}
+
+func newHTTPClient(opts options) *httpClient {
+	return &httpClient{
+		opts:   opts,
+		client: &http.Client{},
+	}
+}
+
+func (hc *httpClient) ls(long bool, path string, out *printer) error {
+	query := url.Values{}
+	if long {
+		query.Set("long", "1")
+	}
+	// a trailing slash lists everything under a path
+	if path != "" && !strings.ContainsAny(path, "*?[") && !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+	return hc.getLines(path, query, out)
+}
+
+func (hc *httpClient) get(name, format string, out *printer) error {
+	query := url.Values{}
+	query.Set("format", format)
+	if format != "text" {
+		resp, err := hc.do(name, query)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		data, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		return out.raw(data)
+	}
+	return hc.getLines(name, query, out)
+}
+
+func (hc *httpClient) watch(names []string, out *printer) error {
+	query := url.Values{}
+	query.Set("format", hc.opts.format)
+	query.Set("watch", "1")
+	path := names[0]
+	if len(names) > 1 {
+		path = "/"
+		query.Set("sources", strings.Join(names, ","))
+	}
+	return hc.getLines(path, query, out)
+}
+
+// getLines writes each line of a response as it arrives.
+func (hc *httpClient) getLines(path string, query url.Values, out *printer) error {
+	resp, err := hc.do(path, query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(nil, maxLineSize)
+	for sc.Scan() {
+		if err := out.line(sc.Text()); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+func (hc *httpClient) do(path string, query url.Values) (*http.Response, error) {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	u := url.URL{
+		Scheme:   "http",
+		Host:     hc.opts.addr,
+		Path:     path,
+		RawQuery: query.Encode(),
+	}
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if hc.opts.token != "" {
+		req.Header.Set("Authorization", "Bearer "+hc.opts.token)
+	}
+	resp, err := hc.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return resp, nil
+	case http.StatusNoContent:
+		resp.Body.Close()
+		resp.Body = ioutil.NopCloser(strings.NewReader(""))
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	body, _ := ioutil.ReadAll(resp.Body)
+	msg := strings.TrimSpace(string(body))
+	if msg == "" {
+		msg = resp.Status
+	}
+	err = fmt.Errorf("%s: %s", path, msg)
+	if resp.StatusCode < 500 || resp.StatusCode == http.StatusNotImplemented {
+		err = refusedError{err.Error()}
+	}
+	return nil, err
+}
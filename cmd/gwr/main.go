@@ -0,0 +1,184 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Command gwr is a command-line client for gwr servers: it lists, gets, and
+// watches data sources over either HTTP or RESP.
+//
+// Usage:
+//
+//	gwr [flags] ls [-l] [PATH]
+//	gwr [flags] get SOURCE
+//	gwr [flags] watch SOURCE
+//	gwr [flags] monitor SOURCE...
+//	gwr [flags] doctor
+//
+// Watch streams a single source; monitor streams several at once, each item
+// prefixed by its source name.  Both reconnect if the stream fails, unless
+// -retry is 0.  Doctor runs the server's self test, failing if any of its
+// checks do.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+type options struct {
+	addr   string
+	proto  string
+	format string
+	token  string
+	color  string
+	retry  time.Duration
+}
+
+// client is implemented for each protocol that gwr speaks.
+type client interface {
+	ls(long bool, path string, out *printer) error
+	get(name, format string, out *printer) error
+	watch(names []string, out *printer) error
+}
+
+// refusedError is returned by clients when the server refuses a request, as
+// opposed to the connection failing; such requests aren't retried.
+type refusedError struct {
+	msg string
+}
+
+func (re refusedError) Error() string {
+	return re.msg
+}
+
+var errUsage = errors.New("usage")
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	var opts options
+	flags := flag.NewFlagSet("gwr", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&opts.addr, "addr", "localhost:4040", "gwr server host:port")
+	flags.StringVar(&opts.proto, "proto", "http", `protocol to use, "http" or "resp"`)
+	flags.StringVar(&opts.format, "format", "text", "format to get or watch data in")
+	flags.StringVar(&opts.token, "token", os.Getenv("GWR_AUTH_TOKEN"), "auth token, defaults to $GWR_AUTH_TOKEN")
+	flags.StringVar(&opts.color, "color", "auto", `colorize text output: "auto", "always", or "never"`)
+	flags.DurationVar(&opts.retry, "retry", time.Second, "delay before reconnecting a failed watch, 0 to not reconnect")
+	flags.Usage = func() {
+		fmt.Fprint(stderr, `usage: gwr [flags] ls [-l] [PATH]
+       gwr [flags] get SOURCE
+       gwr [flags] watch SOURCE
+       gwr [flags] monitor SOURCE...
+       gwr [flags] doctor
+
+flags:
+`)
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	var cl client
+	switch opts.proto {
+	case "http":
+		cl = newHTTPClient(opts)
+	case "resp":
+		cl = newRespClient(opts)
+	default:
+		fmt.Fprintf(stderr, "gwr: unsupported protocol %q\n", opts.proto)
+		return 2
+	}
+
+	out := newPrinter(stdout, opts.color)
+	err := runCommand(cl, opts, flags.Args(), out, stderr)
+	if err == errUsage {
+		flags.Usage()
+		return 2
+	} else if err != nil {
+		fmt.Fprintf(stderr, "gwr: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func runCommand(cl client, opts options, args []string, out *printer, stderr io.Writer) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "ls":
+		long := len(args) > 0 && args[0] == "-l"
+		if long {
+			args = args[1:]
+		}
+		if len(args) > 1 {
+			return errUsage
+		}
+		path := ""
+		if len(args) == 1 {
+			path = args[0]
+		}
+		out.names = true
+		return cl.ls(long, path, out)
+
+	case "get":
+		if len(args) != 1 {
+			return errUsage
+		}
+		return cl.get(args[0], opts.format, out)
+
+	case "doctor":
+		if len(args) != 0 {
+			return errUsage
+		}
+		return doctor(cl, out)
+
+	case "watch", "monitor":
+		if len(args) == 0 || (cmd == "watch" && len(args) != 1) {
+			return errUsage
+		}
+		out.prefixes = len(args) > 1
+		return watchLoop(cl, args, out, opts.retry, stderr)
+	}
+	return errUsage
+}
+
+// watchLoop watches the sources until the server refuses, reconnecting after
+// the retry delay whenever the stream ends or fails.
+func watchLoop(cl client, names []string, out *printer, retry time.Duration, stderr io.Writer) error {
+	for {
+		err := cl.watch(names, out)
+		if _, refused := err.(refusedError); refused || retry <= 0 {
+			return err
+		}
+		if err == nil {
+			err = io.EOF
+		}
+		fmt.Fprintf(stderr, "gwr: watch ended (%v), reconnecting in %v\n", err, retry)
+		time.Sleep(retry)
+	}
+}
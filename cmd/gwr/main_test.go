@@ -0,0 +1,91 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/uber-go/gwr"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRun(t *testing.T) {
+	srv := gwr.NewConfiguredServer(gwr.Config{ListenAddr: "127.0.0.1:0"})
+	require.NoError(t, srv.Start())
+	defer srv.Stop()
+	addr := srv.Addr().String()
+
+	for _, proto := range []string{"http", "resp"} {
+		gwrRun := func(args ...string) (int, string, string) {
+			var stdout, stderr bytes.Buffer
+			args = append([]string{"-addr", addr, "-proto", proto, "-color", "never"}, args...)
+			code := run(args, &stdout, &stderr)
+			return code, stdout.String(), stderr.String()
+		}
+
+		code, out, _ := gwrRun("ls")
+		assert.Equal(t, 0, code, "%s ls", proto)
+		assert.Contains(t, out, "/meta/nouns formats: [html json table text]", "%s ls", proto)
+
+		code, out, _ = gwrRun("ls", "-l", "/meta")
+		assert.Equal(t, 0, code, "%s ls -l", proto)
+		assert.Contains(t, out, "ACTIVE WATCHERS", "%s ls -l", proto)
+
+		code, out, _ = gwrRun("-format", "json", "get", "/meta/nouns")
+		assert.Equal(t, 0, code, "%s get", proto)
+		assert.Contains(t, out, `"/meta/nouns":{"formats":["html","json","table","text"]`, "%s get", proto)
+
+		code, _, errOut := gwrRun("get", "/no/such")
+		assert.Equal(t, 1, code, "%s get of a missing source", proto)
+		assert.Contains(t, errOut, "gwr: ", "%s get of a missing source", proto)
+
+		code, out, _ = gwrRun("doctor")
+		assert.Equal(t, 0, code, "%s doctor", proto)
+		assert.Contains(t, out, "ok   registry: ", "%s doctor", proto)
+		assert.Contains(t, out, "ok   listeners: 1 accepting", "%s doctor", proto)
+		assert.True(t, strings.HasSuffix(out, "healthy\n"), "%s doctor: %q", proto, out)
+
+		code, _, _ = gwrRun("watch", "/a", "/b")
+		assert.Equal(t, 2, code, "%s watch takes one source", proto)
+	}
+}
+
+func TestPrinter_colorize(t *testing.T) {
+	var buf bytes.Buffer
+	p := newPrinter(&buf, "always")
+	p.names = true
+	assert.NoError(t, p.line("no  0 /meta/nouns formats: [json text]"))
+	assert.Equal(t, "no  0 "+colorName("/meta/nouns")+" formats: [json text]\n", buf.String())
+
+	buf.Reset()
+	p = newPrinter(&buf, "always")
+	p.prefixes = true
+	assert.NoError(t, p.line("/request_log> GET /foo"))
+	assert.Equal(t, colorName("/request_log>")+" GET /foo\n", buf.String())
+
+	buf.Reset()
+	assert.NoError(t, newPrinter(&buf, "never").line("/request_log> GET /foo"))
+	assert.Equal(t, "/request_log> GET /foo\n", buf.String())
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"hash/fnv"
+	"io"
+	"os"
+	"strings"
+)
+
+// nameColors are the ANSI colors that source names are shown in; each name
+// always gets the same one.
+var nameColors = []string{
+	"\x1b[36m", // cyan
+	"\x1b[32m", // green
+	"\x1b[33m", // yellow
+	"\x1b[35m", // magenta
+	"\x1b[34m", // blue
+	"\x1b[31m", // red
+}
+
+const colorReset = "\x1b[0m"
+
+// printer writes output lines, colorizing source names in listings, and the
+// "name> " prefixes of monitored items, if enabled.
+type printer struct {
+	w        io.Writer
+	color    bool
+	names    bool
+	prefixes bool
+}
+
+func newPrinter(w io.Writer, color string) *printer {
+	p := &printer{w: w}
+	switch color {
+	case "always":
+		p.color = true
+	case "auto":
+		if f, ok := w.(*os.File); ok {
+			if fi, err := f.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+				p.color = os.Getenv("TERM") != "dumb"
+			}
+		}
+	}
+	return p
+}
+
+// line writes a line of output, adding a newline if it has none.
+func (p *printer) line(s string) error {
+	if p.color {
+		s = p.colorize(s)
+	}
+	if !strings.HasSuffix(s, "\n") {
+		s += "\n"
+	}
+	_, err := io.WriteString(p.w, s)
+	return err
+}
+
+// raw writes data, such as a non-text get, as is.
+func (p *printer) raw(data []byte) error {
+	_, err := p.w.Write(data)
+	return err
+}
+
+func (p *printer) colorize(s string) string {
+	switch {
+	case p.prefixes && strings.HasPrefix(s, "/"):
+		if i := strings.Index(s, "> "); i > 0 {
+			return colorName(s[:i+1]) + s[i+1:]
+		}
+	case p.names:
+		// listings have the source name as their first "/" field
+		for i := 0; i < len(s); i++ {
+			if s[i] == '/' && (i == 0 || s[i-1] == ' ') {
+				end := strings.IndexByte(s[i:], ' ')
+				if end < 0 {
+					end = len(s) - i
+				}
+				return s[:i] + colorName(s[i:i+end]) + s[i+end:]
+			}
+		}
+	}
+	return s
+}
+
+func colorName(name string) string {
+	h := fnv.New32a()
+	io.WriteString(h, strings.TrimSuffix(name, ">"))
+	return nameColors[h.Sum32()%uint32(len(nameColors))] + name + colorReset
+}
@@ -0,0 +1,210 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+)
+
+var errRespProtocol = errors.New("invalid resp reply")
+
+// respValue is a reply read from a RESP server.
+type respValue struct {
+	str   string
+	array []respValue
+	bulk  bool
+	null  bool
+}
+
+type respClient struct {
+	opts options
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func newRespClient(opts options) *respClient {
+	return &respClient{opts: opts}
+}
+
+func (rc *respClient) ls(long bool, path string, out *printer) error {
+	args := []string{"ls"}
+	if long {
+		args = append(args, "-l")
+	}
+	if path != "" {
+		args = append(args, path)
+	}
+	return rc.request(out, "text", args...)
+}
+
+func (rc *respClient) get(name, format string, out *printer) error {
+	return rc.request(out, format, "get", name, format)
+}
+
+func (rc *respClient) watch(names []string, out *printer) error {
+	args := []string{"monitor"}
+	for _, name := range names {
+		args = append(args, name, rc.opts.format)
+	}
+	if err := rc.connect(); err != nil {
+		return err
+	}
+	defer rc.close()
+	if err := rc.send(args...); err != nil {
+		return err
+	}
+	for {
+		val, err := rc.read()
+		if err != nil {
+			return err
+		}
+		if err := rc.print(val, rc.opts.format, out); err != nil {
+			return err
+		}
+	}
+}
+
+// request sends a single command, and prints its reply in the given format.
+func (rc *respClient) request(out *printer, format string, args ...string) error {
+	if err := rc.connect(); err != nil {
+		return err
+	}
+	defer rc.close()
+	if err := rc.send(args...); err != nil {
+		return err
+	}
+	val, err := rc.read()
+	if err != nil {
+		return err
+	}
+	return rc.print(val, format, out)
+}
+
+func (rc *respClient) print(val respValue, format string, out *printer) error {
+	switch {
+	case val.null:
+		return nil
+	case val.array != nil:
+		for _, elem := range val.array {
+			if err := rc.print(elem, format, out); err != nil {
+				return err
+			}
+		}
+		return nil
+	case val.bulk && format != "text":
+		return out.raw([]byte(val.str))
+	}
+	return out.line(val.str)
+}
+
+func (rc *respClient) connect() error {
+	conn, err := net.Dial("tcp", rc.opts.addr)
+	if err != nil {
+		return err
+	}
+	rc.conn, rc.r = conn, bufio.NewReader(conn)
+	if rc.opts.token == "" {
+		return nil
+	}
+	if err := rc.send("auth", rc.opts.token); err != nil {
+		rc.close()
+		return err
+	}
+	if _, err := rc.read(); err != nil {
+		rc.close()
+		return err
+	}
+	return nil
+}
+
+func (rc *respClient) close() {
+	if rc.conn != nil {
+		rc.conn.Close()
+		rc.conn, rc.r = nil, nil
+	}
+}
+
+// send writes a command as an array of bulk strings.
+func (rc *respClient) send(args ...string) error {
+	var buf []byte
+	buf = append(buf, fmt.Sprintf("*%d\r\n", len(args))...)
+	for _, arg := range args {
+		buf = append(buf, fmt.Sprintf("$%d\r\n%s\r\n", len(arg), arg)...)
+	}
+	_, err := rc.conn.Write(buf)
+	return err
+}
+
+// read reads a single reply; error replies are returned as refusedErrors.
+func (rc *respClient) read() (respValue, error) {
+	line, err := rc.r.ReadString('\n')
+	if err != nil {
+		return respValue{}, err
+	}
+	line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+	if len(line) == 0 {
+		return respValue{}, errRespProtocol
+	}
+	switch line[0] {
+	case '+', ':':
+		return respValue{str: line[1:]}, nil
+
+	case '-':
+		return respValue{}, refusedError{line[1:]}
+
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return respValue{}, errRespProtocol
+		}
+		if n < 0 {
+			return respValue{null: true}, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(rc.r, buf); err != nil {
+			return respValue{}, err
+		}
+		return respValue{str: string(buf[:n]), bulk: true}, nil
+
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return respValue{}, errRespProtocol
+		}
+		if n < 0 {
+			return respValue{null: true}, nil
+		}
+		val := respValue{array: make([]respValue, n)}
+		for i := range val.array {
+			if val.array[i], err = rc.read(); err != nil {
+				return respValue{}, err
+			}
+		}
+		return val, nil
+	}
+	return respValue{}, errRespProtocol
+}
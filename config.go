@@ -21,10 +21,23 @@
 package gwr
 
 import (
+	"context"
+	"crypto/tls"
 	"errors"
+	"fmt"
 	"net"
 	"os"
+	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
+
+	"github.com/uber-go/gwr/internal/marshaled"
+	"github.com/uber-go/gwr/internal/meta"
+	"github.com/uber-go/gwr/internal/protocol"
+	"github.com/uber-go/gwr/report"
+	"github.com/uber-go/gwr/source"
 
 	"github.com/uber-common/stacked"
 )
@@ -37,23 +50,163 @@ var (
 	// ErrAlreadyStarted is returned by ConfiguredServer.Start if the server is
 	// already listening.
 	ErrAlreadyStarted = errors.New("gwr server already started")
+
+	errDisabled         = errors.New("gwr disabled")
+	errTLSNotConfigured = errors.New("gwr tls listener without a tls config")
 )
 
-// Config defines configuration for GWR.  For now this only defines server
-// configuration; however once we have reporting support we'll add something
-// ReportingCofiguration here.
+// Config defines configuration for GWR: its server, data source limits, and
+// any reporters.
 type Config struct {
-	// Enabled controls whether GWR is enabled or not, it defaults true.
-	// Currently this only controls whether ConfiguredServer starting.
+	// Enabled controls whether GWR is enabled or not, it defaults true.  When
+	// disabled, ConfiguredServer doesn't start, nor do any reporters; data
+	// sources still handle items for any in-process watchers, unless
+	// DisableSources is also set.  It is superceded by the $GWR_ENABLED
+	// environment variable.
 	Enabled *bool `yaml:"enabled"`
 
+	// DisableSources, if set, makes Configure globally disable all source
+	// item handling, so that instrumentation costs a single atomic load on
+	// hot paths; see source.SetDisabled.
+	DisableSources bool `yaml:"disable_sources"`
+
 	// ListenAddr controls what address ConfiguredServer will listen on.  It is
 	// superceded by the $GWR_LISTEN environment variable.
 	//
+	// Besides a TCP host:port, it may be "unix:///path/to.sock" for a unix
+	// domain socket, "fd://N" for an inherited listening file descriptor, or
+	// "systemd:" (or "systemd:name") for a socket passed by systemd socket
+	// activation.
+	//
+	// It may also be a comma separated list of addresses, to listen on each;
+	// see also Listeners.
+	//
 	// If no listen address is set, then GWR does not start its own listening
 	// server; however GWR can still be accessed under "/gwr/..." from any
 	// default http servers.
 	ListenAddr string `yaml:"listen"`
+
+	// Listeners are more addresses that ConfiguredServer listens on, besides
+	// those of ListenAddr, each served over TLS or not independently, e.g.
+	// plain on a loopback address for local tools, and TLS on a public one.
+	Listeners []ListenerConfig `yaml:"listeners"`
+
+	// AuthToken, if set, must be presented by every request: as an
+	// "Authorization: Bearer <token>" header over HTTP, or with an "auth
+	// <token>" command over RESP.  It is superceded by the $GWR_AUTH_TOKEN
+	// environment variable.
+	AuthToken string `yaml:"auth_token"`
+
+	// Authorize, if set, is called to authorize every access to a data
+	// source, after any AuthToken is checked; any error it returns refuses
+	// the access.
+	Authorize source.AuthFunc `yaml:"-"`
+
+	// TLSCertFile and TLSKeyFile, if set, are a PEM encoded certificate and
+	// key for ConfiguredServer to serve both HTTP and RESP over TLS.  They're
+	// superceded by the $GWR_TLS_CERT and $GWR_TLS_KEY environment variables.
+	TLSCertFile string `yaml:"tls_cert"`
+	TLSKeyFile  string `yaml:"tls_key"`
+
+	// TLSClientCAFile, if set, is a PEM file of CA certificates that clients
+	// must present a certificate signed by; the verified chains are then
+	// available to Authorize as AuthRequest.TLS.VerifiedChains.  It is
+	// superceded by the $GWR_TLS_CLIENT_CA environment variable.
+	TLSClientCAFile string `yaml:"tls_client_ca"`
+
+	// TLSConfig, if set, is used to serve over TLS; any of the above files
+	// are added to a copy of it.
+	TLSConfig *tls.Config `yaml:"-"`
+
+	// MaxItems and MaxBatches set how many items, and batches of items, each
+	// data source queues for its watchers; MaxWait sets how long a source
+	// waits on a full queue before dropping its watchers.  They're
+	// superceded by the $GWR_MAX_ITEMS, $GWR_MAX_BATCHES, and $GWR_MAX_WAIT
+	// environment variables, and apply to all data sources, including those
+	// added before Configure.
+	MaxItems   int           `yaml:"max_items"`
+	MaxBatches int           `yaml:"max_batches"`
+	MaxWait    time.Duration `yaml:"max_wait"`
+
+	// SourceRate, if set, bounds how many items, and marshaled bytes, each
+	// data source emits per second in each watched format, so that a tap on a
+	// hot path can't saturate the network; items over it are dropped, and
+	// counted as such by "/meta/stats".  It applies to all data sources,
+	// including those added before Configure; see WithRateLimit for a
+	// source's own.
+	SourceRate source.RateLimit `yaml:"source_rate"`
+
+	// WatchRate, if set, likewise bounds each connection's watches, together,
+	// across every source that it watches.  HTTP clients may lower it for
+	// their watch with the "rate" (items per second) and "byte_rate"
+	// parameters.
+	WatchRate source.RateLimit `yaml:"watch_rate"`
+
+	// RESPIdleTimeout, if set, closes RESP connections that send no command
+	// for that long, except while they're streaming a monitor.  It is
+	// superceded by the $GWR_RESP_IDLE_TIMEOUT environment variable.  Open,
+	// idle, and closed connections are counted by the "/meta/stats" source.
+	RESPIdleTimeout time.Duration `yaml:"resp_idle_timeout"`
+
+	// H2C, if true, also serves cleartext HTTP/2 (h2c), to clients that
+	// start with the HTTP/2 preface, or that upgrade an HTTP/1.1 request;
+	// e.g. to multiplex many watch streams over one connection.  It is
+	// superceded by the $GWR_H2C environment variable.
+	H2C bool `yaml:"h2c"`
+
+	// Identity identifies this process among the instances of its service:
+	// it's listed by the "/meta/build" source, attached to json item
+	// envelopes, and added to what reporters send, so that where each item
+	// came from is unambiguous once many instances' items are aggregated.
+	// Its fields are superceded by the $GWR_SERVICE, $GWR_INSTANCE, and
+	// $GWR_ZONE environment variables; the instance defaults to the hostname.
+	Identity source.Identity `yaml:"identity"`
+
+	// AggregateOnly names data sources whose raw items may not be gotten or
+	// watched by clients, only sources derived from them, such as their
+	// "/agg" aggregates; see source.DataSources.SetAggregateOnly.
+	AggregateOnly []string `yaml:"aggregate_only"`
+
+	// Reporters are started by Configure, each reporting the sources that
+	// match its patterns, and are stopped by the server's Shutdown; see
+	// report.Manager.  They're listed, and may be stopped and started, by the
+	// "/meta/reporters" source.
+	Reporters []report.ReporterConfig `yaml:"reporters"`
+
+	// Sources tunes data sources by name, overriding both the limits above,
+	// and any options that each was added with; they apply whether or not
+	// the source has been added yet.
+	Sources map[string]SourceConfig `yaml:"sources"`
+}
+
+// SourceConfig tunes one data source from a Config; any zero field is left
+// to the source's options, or the Config's limits.
+type SourceConfig struct {
+	// MaxItems, MaxBatches, and MaxWait are as in Config, and as set by the
+	// WithBufferSizes and WithMaxWait options.
+	MaxItems   int           `yaml:"max_items"`
+	MaxBatches int           `yaml:"max_batches"`
+	MaxWait    time.Duration `yaml:"max_wait"`
+
+	// Rate is as set by the WithRateLimit option.
+	Rate source.RateLimit `yaml:"rate"`
+
+	// Sample, if between 0 and 1, is the fraction of the source's items that
+	// are emitted, chosen at random; the rest are dropped, and counted as
+	// such by "/meta/stats".
+	Sample float64 `yaml:"sample"`
+}
+
+// ListenerConfig configures one of ConfiguredServer's Listeners.
+type ListenerConfig struct {
+	// Addr is the listen address, in any of the forms of a
+	// Config.ListenAddr.
+	Addr string `yaml:"addr"`
+
+	// TLS, if true, serves the listener over TLS, as configured by the
+	// Config's TLS fields; listeners without it serve plain HTTP and RESP,
+	// unlike those of ListenAddr, which serve TLS whenever it's configured.
+	TLS bool `yaml:"tls"`
 }
 
 var theServer *ConfiguredServer
@@ -70,8 +223,98 @@ func Configure(config *Config) error {
 	if config == nil {
 		config = &Config{}
 	}
+	if err := configureLimits(*config); err != nil {
+		return err
+	}
+	for _, name := range config.AggregateOnly {
+		DefaultDataSources.SetAggregateOnly(name, true)
+	}
+	source.SetIdentity(configIdentity(config.Identity))
 	theServer = NewConfiguredServer(*config)
-	return theServer.Start()
+	defaultHTTPRest.SetAuth(theServer.config.auth)
+	defaultHTTPRest.SetWatchRate(theServer.config.watchRate)
+	serverStats.SetRESPStats(theServer.resp.Stats)
+	source.SetDisabled(config.DisableSources)
+	configSource.SetServer(configServer{theServer})
+	if err := theServer.Start(); err != nil {
+		return err
+	}
+	if !theServer.Enabled() {
+		return nil
+	}
+	theServer.reporters = reporters
+	return reporters.Configure(config.Reporters)
+}
+
+// configureLimits sets the default data source limits from the config, and
+// any environment variables superceding it, and then those of any configured
+// sources.
+func configureLimits(cfg Config) error {
+	for name, sc := range cfg.Sources {
+		if sc.MaxItems < 0 || sc.MaxBatches < 0 || sc.MaxWait < 0 || sc.Sample < 0 || sc.Sample > 1 {
+			return fmt.Errorf("invalid config for source %q", name)
+		}
+	}
+	lim := marshaled.Limits{
+		MaxItems:   cfg.MaxItems,
+		MaxBatches: cfg.MaxBatches,
+		MaxWait:    cfg.MaxWait,
+		Rate:       cfg.SourceRate,
+	}
+	for _, env := range []struct {
+		name string
+		n    *int
+	}{
+		{"GWR_MAX_ITEMS", &lim.MaxItems},
+		{"GWR_MAX_BATCHES", &lim.MaxBatches},
+	} {
+		if val := os.Getenv(env.name); val != "" {
+			n, err := strconv.Atoi(val)
+			if err != nil || n < 1 {
+				return fmt.Errorf("invalid $%s %q", env.name, val)
+			}
+			*env.n = n
+		}
+	}
+	if val := os.Getenv("GWR_MAX_WAIT"); val != "" {
+		d, err := time.ParseDuration(val)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid $GWR_MAX_WAIT %q", val)
+		}
+		lim.MaxWait = d
+	}
+	marshaled.SetDefaultLimits(lim)
+	for name, sc := range cfg.Sources {
+		marshaled.SetSourceLimits(name, marshaled.Limits{
+			MaxItems:   sc.MaxItems,
+			MaxBatches: sc.MaxBatches,
+			MaxWait:    sc.MaxWait,
+			Rate:       sc.Rate,
+			Sample:     sc.Sample,
+		})
+	}
+	return nil
+}
+
+// configIdentity returns the configured identity, superceded by any
+// environment variables, and with the hostname as the default instance.
+func configIdentity(id source.Identity) source.Identity {
+	for _, env := range []struct {
+		name string
+		val  *string
+	}{
+		{"GWR_SERVICE", &id.Service},
+		{"GWR_INSTANCE", &id.Instance},
+		{"GWR_ZONE", &id.Zone},
+	} {
+		if val := os.Getenv(env.name); val != "" {
+			*env.val = val
+		}
+	}
+	if id.Instance == "" {
+		id.Instance, _ = os.Hostname()
+	}
+	return id
 }
 
 // Enabled returns true if the gwr library is configured and enabled.
@@ -89,8 +332,19 @@ func DefaultServer() *ConfiguredServer {
 }
 
 type serverConfig struct {
-	enabled    bool
-	listenAddr string
+	enabled         bool
+	listenAddr      string
+	auth            source.AuthFunc
+	tls             *tls.Config
+	tlsCertFile     string
+	tlsKeyFile      string
+	tlsClientCAFile string
+	respIdleTimeout time.Duration
+	h2c             bool
+	watchRate       source.RateLimit
+
+	// err is any invalid environment setting, returned by Start
+	err error
 }
 
 var defaultServerConfig = serverConfig{
@@ -102,29 +356,99 @@ var defaultServerConfig = serverConfig{
 // created by gwr.NewServer.
 type ConfiguredServer struct {
 	config   serverConfig
+	dss      *source.DataSources
 	stacked  stacked.Server
-	ln       net.Listener
-	stopping uint32
-	done     chan error
+	resp     *protocol.RedisHandler
+	handlers []shutdowner
+
+	lock      sync.Mutex
+	listeners []*serverListener
+
+	// reporters are those started by Configure, if this is the default
+	// server.
+	reporters *report.Manager
 }
 
 // NewConfiguredServer creates a new ConfiguredServer for a given config.
 func NewConfiguredServer(cfg Config) *ConfiguredServer {
 	srv := &ConfiguredServer{
-		config:  defaultServerConfig,
-		stacked: NewServer(DefaultDataSources),
+		config: defaultServerConfig,
+		dss:    DefaultDataSources,
 	}
 
 	if cfg.Enabled != nil {
 		srv.config.enabled = *cfg.Enabled
 	}
+	if envEnabled := os.Getenv("GWR_ENABLED"); envEnabled != "" {
+		if enabled, err := strconv.ParseBool(envEnabled); err == nil {
+			srv.config.enabled = enabled
+		} else {
+			srv.config.err = fmt.Errorf("invalid $GWR_ENABLED %q", envEnabled)
+		}
+	}
 
+	for _, lc := range cfg.Listeners {
+		srv.listeners = append(srv.listeners, &serverListener{laddr: lc.Addr, tls: listenerTLS(lc)})
+	}
 	if envListen := os.Getenv("GWR_LISTEN"); envListen != "" {
-		srv.config.listenAddr = envListen
-	} else if cfg.ListenAddr != "" {
-		srv.config.listenAddr = cfg.ListenAddr
+		srv.setListenAddr(envListen)
+	} else {
+		srv.setListenAddr(cfg.ListenAddr)
+	}
+
+	token := cfg.AuthToken
+	if envToken := os.Getenv("GWR_AUTH_TOKEN"); envToken != "" {
+		token = envToken
+	}
+	var tokenAuth source.AuthFunc
+	if token != "" {
+		tokenAuth = source.TokenAuth(token)
+	}
+	srv.config.auth = source.AllAuth(tokenAuth, cfg.Authorize)
+
+	srv.config.tls = cfg.TLSConfig
+	srv.config.tlsCertFile = cfg.TLSCertFile
+	srv.config.tlsKeyFile = cfg.TLSKeyFile
+	srv.config.tlsClientCAFile = cfg.TLSClientCAFile
+	for _, env := range []struct {
+		name string
+		file *string
+	}{
+		{"GWR_TLS_CERT", &srv.config.tlsCertFile},
+		{"GWR_TLS_KEY", &srv.config.tlsKeyFile},
+		{"GWR_TLS_CLIENT_CA", &srv.config.tlsClientCAFile},
+	} {
+		if val := os.Getenv(env.name); val != "" {
+			*env.file = val
+		}
+	}
+
+	srv.config.respIdleTimeout = cfg.RESPIdleTimeout
+	if envIdle := os.Getenv("GWR_RESP_IDLE_TIMEOUT"); envIdle != "" {
+		if d, err := time.ParseDuration(envIdle); err == nil && d >= 0 {
+			srv.config.respIdleTimeout = d
+		} else {
+			srv.config.err = fmt.Errorf("invalid $GWR_RESP_IDLE_TIMEOUT %q", envIdle)
+		}
+	}
+
+	srv.config.h2c = cfg.H2C
+	if envH2C := os.Getenv("GWR_H2C"); envH2C != "" {
+		if h2c, err := strconv.ParseBool(envH2C); err == nil {
+			srv.config.h2c = h2c
+		} else {
+			srv.config.err = fmt.Errorf("invalid $GWR_H2C %q", envH2C)
+		}
 	}
 
+	srv.config.watchRate = cfg.WatchRate
+
+	var hh *protocol.HTTPRest
+	srv.stacked, hh, srv.resp = newServer(srv.dss, srv, srv.config.auth, srv.config.h2c)
+	srv.resp.SetIdleTimeout(srv.config.respIdleTimeout)
+	hh.SetWatchRate(srv.config.watchRate)
+	srv.resp.SetWatchRate(srv.config.watchRate)
+	srv.handlers = []shutdowner{hh, srv.resp}
 	return srv
 }
 
@@ -135,90 +459,388 @@ func (srv *ConfiguredServer) Enabled() bool {
 
 // ListenAddr returns the configured listen address string.
 func (srv *ConfiguredServer) ListenAddr() string {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
 	return srv.config.listenAddr
 }
 
-// Addr returns the current listening address, if any.
+// Addr returns the current listening address, if any; if there are several,
+// it returns the first configured, as listed by Addrs.
 func (srv *ConfiguredServer) Addr() net.Addr {
-	if srv.ln == nil {
-		return nil
+	if addrs := srv.Addrs(); len(addrs) > 0 {
+		return addrs[0]
+	}
+	return nil
+}
+
+// Addrs returns the addresses of all current listeners, those of ListenAddr
+// first, then those of Config.Listeners.
+func (srv *ConfiguredServer) Addrs() []net.Addr {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	var addrs []net.Addr
+	for _, sl := range srv.listeners {
+		if sl.ln != nil {
+			addrs = append(addrs, sl.ln.Addr())
+		}
 	}
-	return srv.ln.Addr()
+	return addrs
 }
 
-// Start starts the server by creating the listener and a server goroutine to
-// accept connections.
-// - if not enabled, or if no listen address is configured, noops and returns
-//   nil
-// - if already listening, returns ErrAlreadyStarted
-// - otherwise any net.Listen error is returned.
+// Start starts the server by creating its listeners, and a server goroutine
+// for each to accept connections.
+//   - if not enabled, or if no listen address is configured, noops and returns
+//     nil
+//   - if already listening, returns ErrAlreadyStarted; if only some listeners
+//     are, e.g. after StopListener, the rest are started
+//   - otherwise any invalid environment setting, or error loading the TLS
+//     configuration, or creating a listener, is returned, and none are
+//     started.
 func (srv *ConfiguredServer) Start() error {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	return srv.start()
+}
+
+func (srv *ConfiguredServer) start() error {
 	if !srv.config.enabled {
 		return nil
 	}
 
-	if srv.config.listenAddr == "" {
+	if srv.config.err != nil {
+		return srv.config.err
+	}
+
+	var started []*serverListener
+	for _, sl := range srv.listeners {
+		if sl.ln != nil {
+			continue
+		}
+		if err := srv.startListener(sl); err != nil {
+			for _, sl := range started {
+				sl.stop()
+			}
+			return err
+		}
+		started = append(started, sl)
+	}
+	if len(started) == 0 && len(srv.listeners) > 0 {
+		return ErrAlreadyStarted
+	}
+	return nil
+}
+
+// StartOn starts the server on a given listening address, in place of its
+// ListenAddr; any Config.Listeners are started too.  If the start succeeds, it
+// also updates the configured listening address for later reference.  It has
+// all the same error cases as ConfiguredServer.Start, except that it returns
+// ErrAlreadyStarted if any listener is already started.
+func (srv *ConfiguredServer) StartOn(laddr string) error {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	return srv.startOn(laddr)
+}
+
+func (srv *ConfiguredServer) startOn(laddr string) error {
+	if !srv.config.enabled {
 		return nil
 	}
 
-	if srv.ln != nil {
+	if srv.listening() {
 		return ErrAlreadyStarted
 	}
 
-	ln, err := net.Listen("tcp", srv.config.listenAddr)
+	oldLaddr := srv.config.listenAddr
+	srv.setListenAddr(laddr)
+	err := srv.start()
 	if err != nil {
+		srv.setListenAddr(oldLaddr)
+	}
+	return err
+}
+
+// StartListener starts a listener, adding it to the server's configured
+// listeners unless one with the same address already is; it returns
+// ErrAlreadyStarted if that one's already listening.  Other listeners are
+// unaffected.
+func (srv *ConfiguredServer) StartListener(lc ListenerConfig) error {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	if !srv.config.enabled {
+		return nil
+	}
+	if srv.config.err != nil {
+		return srv.config.err
+	}
+	sl := srv.listener(lc.Addr)
+	if sl == nil {
+		sl = &serverListener{laddr: lc.Addr, tls: listenerTLS(lc)}
+		srv.listeners = append(srv.listeners, sl)
+	} else if sl.ln != nil {
+		return ErrAlreadyStarted
+	}
+	return srv.startListener(sl)
+}
+
+// StopListener stops the listener configured with the given address, leaving
+// any others listening; Start starts it again.
+func (srv *ConfiguredServer) StopListener(laddr string) error {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	sl := srv.listener(laddr)
+	if sl == nil {
+		return fmt.Errorf("no gwr listener on %q", laddr)
+	}
+	return sl.stop()
+}
+
+// relisten moves the server to a new listening address, restoring the old one
+// if it can't listen on the new one.
+func (srv *ConfiguredServer) relisten(laddr string) error {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	if !srv.config.enabled {
+		return errDisabled
+	}
+	listening := srv.listening()
+	if err := srv.stop(); err != nil {
+		return err
+	}
+	if err := srv.startOn(laddr); err != nil {
+		if listening {
+			srv.start()
+		}
 		return err
 	}
+	return nil
+}
+
+// configServer shows a ConfiguredServer's settings on the "/meta/config"
+// source, and moves it to any listening address set there.
+type configServer struct {
+	srv *ConfiguredServer
+}
 
-	srv.ln = ln
-	srv.done = make(chan error, 1)
+func (cs configServer) ConfigInfo() meta.ConfigInfo {
+	cfg := cs.srv.config
+	info := meta.ConfigInfo{
+		Enabled:   cfg.enabled,
+		Listen:    cs.srv.ListenAddr(),
+		TLS:       cfg.tls != nil || cfg.tlsCertFile != "",
+		Auth:      cfg.auth != nil,
+		H2C:       cfg.h2c,
+		WatchRate: cfg.watchRate,
+	}
+	for _, addr := range cs.srv.Addrs() {
+		info.Addrs = append(info.Addrs, addr.String())
+	}
+	return info
+}
+
+func (cs configServer) Relisten(laddr string) error {
+	return cs.srv.relisten(laddr)
+}
+
+// Stop closes the current listeners and shuts down the server goroutines
+// started by Start (if any).
+func (srv *ConfiguredServer) Stop() error {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+	return srv.stop()
+}
+
+func (srv *ConfiguredServer) stop() error {
+	var err error
+	for _, sl := range srv.listeners {
+		if stopErr := sl.stop(); err == nil {
+			err = stopErr
+		}
+	}
+	return err
+}
+
+// listening returns true if any listener is started.
+func (srv *ConfiguredServer) listening() bool {
+	for _, sl := range srv.listeners {
+		if sl.ln != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// listener returns the listener configured with the address, if any.
+func (srv *ConfiguredServer) listener(laddr string) *serverListener {
+	for _, sl := range srv.listeners {
+		if sl.laddr == laddr {
+			return sl
+		}
+	}
+	return nil
+}
+
+// setListenAddr replaces the listeners of the configured listen address with
+// those of laddr, a comma separated list; none of them may be started.
+func (srv *ConfiguredServer) setListenAddr(laddr string) {
+	var listeners []*serverListener
+	for _, addr := range splitListenAddr(laddr) {
+		listeners = append(listeners, &serverListener{
+			laddr:          addr,
+			tls:            tlsIfConfigured,
+			fromListenAddr: true,
+		})
+	}
+	for _, sl := range srv.listeners {
+		if !sl.fromListenAddr {
+			listeners = append(listeners, sl)
+		}
+	}
+	srv.config.listenAddr = laddr
+	srv.listeners = listeners
+}
+
+// startListener starts the listener, and a goroutine serving it.
+func (srv *ConfiguredServer) startListener(sl *serverListener) error {
+	var tlsConfig *tls.Config
+	if sl.tls != tlsOff {
+		var err error
+		tlsConfig, err = srv.config.tlsConfig()
+		if err != nil {
+			return err
+		}
+		if tlsConfig == nil && sl.tls == tlsOn {
+			return errTLSNotConfigured
+		}
+	}
+
+	ln, err := listen(sl.laddr)
+	if err != nil {
+		return err
+	}
+	if tlsConfig != nil {
+		// the stacked server detects the protocol from the decrypted stream
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+
+	sl.ln = ln
+	unlistenSelftest := selftest.AddListener(ln.Addr())
+	unlistenSource := listeners.Add(meta.ListenerInfo{
+		Listen: sl.laddr,
+		Addr:   ln.Addr().String(),
+		TLS:    tlsConfig != nil,
+	})
+	sl.unlisten = func() {
+		unlistenSelftest()
+		unlistenSource()
+	}
+	sl.done = make(chan error, 1)
 	go func(ln net.Listener, done chan<- error) {
 		err := srv.stacked.Serve(ln)
-		if atomic.LoadUint32(&srv.stopping) == 0 {
+		if atomic.LoadUint32(&sl.stopping) == 0 {
 			done <- err
 		} else {
 			done <- nil
 		}
-	}(srv.ln, srv.done)
+	}(sl.ln, sl.done)
 	return nil
 }
 
-// StartOn starts the server on a given listening address.  If the start
-// succeeds, it also updates the configured listening address for later
-// reference.  It has all the same error cases as ConfiguredServer.Start.
-func (srv *ConfiguredServer) StartOn(laddr string) error {
-	if !srv.config.enabled {
-		return nil
-	}
+// serverListener is one of a ConfiguredServer's listeners, and its state once
+// started.
+type serverListener struct {
+	laddr string
+	tls   listenerTLSMode
 
-	if srv.ln != nil {
-		return ErrAlreadyStarted
-	}
+	// fromListenAddr is true for the listeners of the configured listen
+	// address, rather than Config.Listeners.
+	fromListenAddr bool
 
-	oldLaddr := srv.config.listenAddr
-	srv.config.listenAddr = laddr
-	err := srv.Start()
-	if err != nil {
-		srv.config.listenAddr = oldLaddr
+	ln       net.Listener
+	unlisten func()
+	stopping uint32
+	done     chan error
+}
+
+// listenerTLSMode is whether a listener serves TLS.
+type listenerTLSMode int
+
+const (
+	// tlsIfConfigured serves TLS if the server has a TLS config, as the
+	// listeners of the configured listen address do.
+	tlsIfConfigured listenerTLSMode = iota
+	tlsOff
+	tlsOn
+)
+
+func listenerTLS(lc ListenerConfig) listenerTLSMode {
+	if lc.TLS {
+		return tlsOn
 	}
-	return err
+	return tlsOff
 }
 
-// Stop closes the current listener and shuts down the server goroutine started
-// by Start (if any).
-func (srv *ConfiguredServer) Stop() error {
-	if srv.ln == nil {
+// stop closes the listener, if started, and shuts down its server goroutine.
+func (sl *serverListener) stop() error {
+	if sl.ln == nil {
 		return nil
 	}
-	if !atomic.CompareAndSwapUint32(&srv.stopping, 0, 1) {
+	if !atomic.CompareAndSwapUint32(&sl.stopping, 0, 1) {
 		return nil
 	}
-	ln, done := srv.ln, srv.done
-	srv.ln, srv.done = nil, nil
+	ln, done := sl.ln, sl.done
+	sl.ln, sl.done = nil, nil
+	sl.unlisten()
 	err := ln.Close()
 	if serveErr := <-done; err == nil && serveErr != nil {
 		err = serveErr
 	}
-	atomic.CompareAndSwapUint32(&srv.stopping, 1, 0)
+	atomic.CompareAndSwapUint32(&sl.stopping, 1, 0)
+	return err
+}
+
+// splitListenAddr splits a comma separated list of listen addresses.
+func splitListenAddr(laddr string) []string {
+	var addrs []string
+	for _, addr := range strings.Split(laddr, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	return addrs
+}
+
+// Shutdown gracefully stops the server: it stops listening, drains all
+// DrainableSources so that any pending items get sent, stops any reporters
+// started by Configure, and then ends any active HTTP or RESP watch streams.
+// If the context is done first, Shutdown stops waiting, but still stops the
+// reporters and signals the watch streams to end, and then returns the
+// context's error.
+func (srv *ConfiguredServer) Shutdown(ctx context.Context) error {
+	err := srv.Stop()
+
+	drained := make(chan struct{})
+	go func() {
+		// a drain stuck on a stalled watcher ends once the streams do, below
+		srv.dss.Drain()
+		close(drained)
+	}()
+	var ctxErr error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		ctxErr = ctx.Err()
+	}
+	if srv.reporters != nil {
+		srv.reporters.Shutdown()
+	}
+
+	for _, hndl := range srv.handlers {
+		if shutErr := hndl.Shutdown(ctx); err == nil {
+			err = shutErr
+		}
+	}
+	if ctxErr != nil {
+		return ctxErr
+	}
 	return err
 }
@@ -0,0 +1,72 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package gwr
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v3"
+)
+
+// LoadConfig reads a Config from a YAML file, whose keys are those of the
+// Config's yaml tags, e.g.:
+//
+//	listen: ":4040"
+//	auth_token: secret
+//	tls_cert: /etc/gwr/cert.pem
+//	tls_key: /etc/gwr/key.pem
+//	sources:
+//	  /tap/requests:
+//	    max_items: 1000
+//	    sample: 0.1
+//	reporters:
+//	  - type: syslog
+//	    addr: localhost:514
+//	    sources: ["/audit"]
+//
+// Since JSON is a subset of YAML, the file may be JSON too.  Any unknown key
+// is an error, so that a misspelled setting isn't silently ignored.
+func LoadConfig(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var cfg Config
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("invalid gwr config %s: %v", path, err)
+	}
+	return &cfg, nil
+}
+
+// ConfigureFromFile calls Configure with the Config loaded from a file by
+// LoadConfig; environment variables supercede it as they do any Config.
+func ConfigureFromFile(path string) error {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return err
+	}
+	return Configure(cfg)
+}
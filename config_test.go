@@ -21,12 +21,46 @@
 package gwr_test
 
 import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"testing"
+	"text/template"
+	"time"
 
 	"github.com/uber-go/gwr"
+	"github.com/uber-go/gwr/internal/marshaled"
+	"github.com/uber-go/gwr/internal/meta"
+	"github.com/uber-go/gwr/report"
+	"github.com/uber-go/gwr/source"
 
+	"github.com/golang/snappy"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-common/stacked"
+	"golang.org/x/net/http2"
 )
 
 func TestConfiguredServer(t *testing.T) {
@@ -49,3 +83,1268 @@ func TestConfiguredServer(t *testing.T) {
 	assert.Nil(t, srv.Addr(), "nil addr after stop")
 	assert.NoError(t, srv.Stop(), "stop is idempotent")
 }
+
+func TestConfiguredServer_Shutdown(t *testing.T) {
+	os.Unsetenv("GWR_LISTEN")
+	srv := gwr.NewConfiguredServer(gwr.Config{ListenAddr: "127.0.0.1:0"})
+	assert.NoError(t, srv.Start(), "no start error")
+
+	resp, err := http.Get(fmt.Sprintf("http://%v/meta/nouns?watch=1&format=json", srv.Addr()))
+	if !assert.NoError(t, err, "no watch error") {
+		return
+	}
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "watch started")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, srv.Shutdown(ctx), "no shutdown error")
+	assert.Nil(t, srv.Addr(), "nil addr after shutdown")
+
+	_, err = ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err, "watch stream ended cleanly")
+	assert.Equal(t, "shutdown", resp.Trailer.Get("Gwr-Stream-End"), "stream end trailer")
+}
+
+// stuckSource is a DrainableSource whose drain doesn't finish until it's
+// released.
+type stuckSource struct {
+	release chan struct{}
+}
+
+func (ss stuckSource) Name() string                         { return "/test/stuck" }
+func (ss stuckSource) Formats() []string                    { return []string{"json"} }
+func (ss stuckSource) Attrs() map[string]interface{}        { return nil }
+func (ss stuckSource) Get(format string, w io.Writer) error { return source.ErrNotGetable }
+func (ss stuckSource) Watch(format string, w io.Writer) error {
+	return source.ErrNotWatchable
+}
+func (ss stuckSource) Drain() { <-ss.release }
+
+func TestConfiguredServer_Shutdown_timeout(t *testing.T) {
+	os.Unsetenv("GWR_LISTEN")
+	stuck := stuckSource{make(chan struct{})}
+	require.NoError(t, gwr.DefaultDataSources.Add(stuck))
+	defer gwr.DefaultDataSources.Remove(stuck.Name())
+	defer close(stuck.release)
+
+	srv := gwr.NewConfiguredServer(gwr.Config{ListenAddr: "127.0.0.1:0"})
+	require.NoError(t, srv.Start(), "no start error")
+	resp, err := http.Get(fmt.Sprintf("http://%v/meta/nouns?watch=1&format=json", srv.Addr()))
+	require.NoError(t, err, "no watch error")
+	defer resp.Body.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, srv.Shutdown(ctx), "drain didn't finish")
+
+	_, err = ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err, "watch stream still ended")
+	assert.Equal(t, "shutdown", resp.Trailer.Get("Gwr-Stream-End"), "stream end trailer")
+}
+
+func TestConfiguredServer_h2c(t *testing.T) {
+	os.Unsetenv("GWR_LISTEN")
+	os.Unsetenv("GWR_H2C")
+	srv := gwr.NewConfiguredServer(gwr.Config{ListenAddr: "127.0.0.1:0", H2C: true})
+	require.NoError(t, srv.Start(), "no start error")
+	defer srv.Stop()
+
+	// plain HTTP/1.1 clients are still served
+	resp, err := http.Get(fmt.Sprintf("http://%v/meta/nouns?format=json", srv.Addr()))
+	require.NoError(t, err, "no HTTP/1.1 get error")
+	resp.Body.Close()
+	assert.Equal(t, 1, resp.ProtoMajor, "get over HTTP/1.1")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+
+	resp, err = client.Get(fmt.Sprintf("http://%v/meta/nouns?watch=1&format=json", srv.Addr()))
+	require.NoError(t, err, "no watch error")
+	defer resp.Body.Close()
+	assert.Equal(t, 2, resp.ProtoMajor, "watch over HTTP/2")
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "watch started")
+
+	// the watch is flushed as a stream of DATA frames, without chunking
+	rd := bufio.NewReader(resp.Body)
+	line, err := rd.ReadString('\n')
+	require.NoError(t, err, "no watch read error")
+	assert.Contains(t, line, `"/meta/nouns"`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, srv.Shutdown(ctx), "no shutdown error")
+
+	_, err = ioutil.ReadAll(rd)
+	assert.NoError(t, err, "watch stream ended cleanly")
+	assert.Equal(t, "shutdown", resp.Trailer.Get("Gwr-Stream-End"), "stream end trailer")
+}
+
+func TestConfiguredServer_ui(t *testing.T) {
+	os.Unsetenv("GWR_LISTEN")
+	srv := gwr.NewConfiguredServer(gwr.Config{ListenAddr: "127.0.0.1:0"})
+	require.NoError(t, srv.Start(), "no start error")
+	defer srv.Stop()
+
+	resp, err := http.Get(fmt.Sprintf("http://%v/ui/", srv.Addr()))
+	require.NoError(t, err, "no ui error")
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err, "no ui read error")
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "ui served")
+	assert.Equal(t, "text/html; charset=utf-8", resp.Header.Get("Content-Type"))
+	assert.Contains(t, string(body), "<title>gwr</title>")
+
+	resp, err = http.Get(fmt.Sprintf("http://%v/meta/nouns?format=html", srv.Addr()))
+	require.NoError(t, err, "no get error")
+	body, err = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err, "no get read error")
+	assert.Equal(t, "text/html", resp.Header.Get("Content-Type"))
+	assert.Contains(t, string(body), `<tr><th>/meta/nouns</th>`)
+
+	resp, err = http.Get(fmt.Sprintf("http://%v/meta/nouns?watch=1&sse=1&format=html", srv.Addr()))
+	require.NoError(t, err, "no watch error")
+	defer resp.Body.Close()
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	require.NoError(t, err, "no watch read error")
+	assert.True(t, strings.HasPrefix(line, "data: <table"), "watch item is an event: %q", line)
+}
+
+type snapshotSource struct {
+	sync.Mutex
+	lines []string
+}
+
+func (ss *snapshotSource) Name() string { return "/test/snapshot" }
+
+func (ss *snapshotSource) Get() interface{} {
+	ss.Lock()
+	defer ss.Unlock()
+	return strings.Join(ss.lines, "\n") + "\n"
+}
+
+func (ss *snapshotSource) set(lines ...string) {
+	ss.Lock()
+	ss.lines = lines
+	ss.Unlock()
+}
+
+func TestConfiguredServer_diffWatch(t *testing.T) {
+	os.Unsetenv("GWR_LISTEN")
+	ss := &snapshotSource{lines: []string{"a", "b", "c"}}
+	require.NoError(t, gwr.DefaultDataSources.Add(marshaled.NewDataSource(ss, nil)))
+	defer gwr.DefaultDataSources.Remove(ss.Name())
+	srv := gwr.NewConfiguredServer(gwr.Config{ListenAddr: "127.0.0.1:0"})
+	require.NoError(t, srv.Start(), "no start error")
+	defer srv.Stop()
+
+	resp, err := http.Get(fmt.Sprintf("http://%v/test/snapshot?format=text&watch=1&diff=prev&poll=1ms", srv.Addr()))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "poll interval too short")
+
+	resp, err = http.Get(fmt.Sprintf("http://%v/test/snapshot?format=text&watch=1&diff=prev&poll=100ms", srv.Addr()))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	rd := bufio.NewReader(resp.Body)
+	readLines := func(n int) []string {
+		lines := make([]string, n)
+		for i := range lines {
+			line, err := rd.ReadString('\n')
+			require.NoError(t, err, "no watch read error")
+			lines[i] = line
+		}
+		return lines
+	}
+
+	assert.Equal(t, []string{
+		"--- /test/snapshot\tprevious\n",
+		"+++ /test/snapshot\tcurrent\n",
+		"@@ -0,0 +1,3 @@\n",
+		"+a\n",
+		"+b\n",
+		"+c\n",
+	}, readLines(6), "stream starts with the whole document")
+
+	ss.set("a", "B", "c")
+	assert.Equal(t, []string{
+		"--- /test/snapshot\tprevious\n",
+		"+++ /test/snapshot\tcurrent\n",
+		"@@ -1,3 +1,3 @@\n",
+		" a\n",
+		"-b\n",
+		"+B\n",
+		" c\n",
+	}, readLines(7), "only changes are streamed")
+}
+
+func TestConfiguredServer_accept(t *testing.T) {
+	os.Unsetenv("GWR_LISTEN")
+	srv := gwr.NewConfiguredServer(gwr.Config{ListenAddr: "127.0.0.1:0"})
+	require.NoError(t, srv.Start(), "no start error")
+	defer srv.Stop()
+
+	get := func(accept string) (*http.Response, string) {
+		req, err := http.NewRequest("GET", fmt.Sprintf("http://%v/meta/nouns", srv.Addr()), nil)
+		require.NoError(t, err)
+		req.Header.Set("Accept", accept)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err, "no get error")
+		body, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		require.NoError(t, err, "no read error")
+		return resp, string(body)
+	}
+
+	resp, _ := get("text/plain;q=0.5, application/json")
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.Contains(t, resp.Header["Vary"], "Accept")
+
+	resp, body := get("image/png")
+	assert.Equal(t, http.StatusNotAcceptable, resp.StatusCode)
+	assert.Contains(t, body, "application/json (format=json)\n")
+}
+
+func TestConfiguredServer_gzip(t *testing.T) {
+	os.Unsetenv("GWR_LISTEN")
+	srv := gwr.NewConfiguredServer(gwr.Config{ListenAddr: "127.0.0.1:0"})
+	require.NoError(t, srv.Start(), "no start error")
+	defer srv.Stop()
+
+	get := func(query string) *http.Response {
+		req, err := http.NewRequest("GET", fmt.Sprintf("http://%v/meta/nouns%s", srv.Addr(), query), nil)
+		require.NoError(t, err)
+		req.Header.Set("Accept-Encoding", "gzip")
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err, "no get error")
+		assert.Equal(t, "gzip", resp.Header.Get("Content-Encoding"))
+		return resp
+	}
+
+	resp := get("?format=json")
+	zr, err := gzip.NewReader(resp.Body)
+	require.NoError(t, err, "gzipped get")
+	body, err := ioutil.ReadAll(zr)
+	resp.Body.Close()
+	require.NoError(t, err, "no read error")
+	assert.Contains(t, string(body), `"/meta/nouns":{"formats":["html","json","table","text"]`)
+
+	// each watch item is flushed through the compressor as it's written
+	resp = get("?format=json&watch=1")
+	defer resp.Body.Close()
+	zr, err = gzip.NewReader(resp.Body)
+	require.NoError(t, err, "gzipped watch")
+	line, err := bufio.NewReader(zr).ReadString('\n')
+	require.NoError(t, err, "no watch read error")
+	assert.Contains(t, line, `"/meta/nouns"`)
+}
+
+func TestConfiguredServer_auth(t *testing.T) {
+	os.Unsetenv("GWR_LISTEN")
+	os.Unsetenv("GWR_AUTH_TOKEN")
+	srv := gwr.NewConfiguredServer(gwr.Config{
+		ListenAddr: "127.0.0.1:0",
+		AuthToken:  "s3cret",
+		Authorize: func(req *source.AuthRequest) error {
+			if req.Verb == "watch" {
+				return errors.New("no watching")
+			}
+			return nil
+		},
+	})
+	assert.NoError(t, srv.Start(), "no start error")
+	defer srv.Stop()
+
+	get := func(query, token string) int {
+		req, err := http.NewRequest("GET", fmt.Sprintf("http://%v/meta/nouns%s", srv.Addr(), query), nil)
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusUnauthorized, get("", ""), "token required")
+	assert.Equal(t, http.StatusUnauthorized, get("", "wrong"), "right token required")
+	assert.Equal(t, http.StatusOK, get("", "s3cret"), "get allowed with token")
+	assert.Equal(t, http.StatusForbidden, get("?watch=1", "s3cret"), "watch refused by Authorize")
+
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	cmd := func(args ...string) string {
+		fmt.Fprintf(conn, "*%d\r\n", len(args))
+		for _, arg := range args {
+			fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(arg), arg)
+		}
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		return strings.TrimSpace(line)
+	}
+	assert.Contains(t, cmd("ls"), "authentication required", "resp token required")
+	assert.Equal(t, "+OK", cmd("auth", "s3cret"))
+	assert.True(t, strings.HasPrefix(cmd("ls"), "*"), "resp ls allowed with token")
+}
+
+func TestConfiguredServer_recordAuth(t *testing.T) {
+	os.Unsetenv("GWR_LISTEN")
+	os.Unsetenv("GWR_AUTH_TOKEN")
+	dir, err := ioutil.TempDir("", "gwr-recording")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	fr := report.NewFileRecorder(gwr.DefaultDataSources, report.FileRecorderConfig{Dir: dir})
+	defer fr.StopAll()
+	require.NoError(t, gwr.DefaultDataSources.Add(marshaled.NewDataSource(fr, nil)))
+	defer gwr.DefaultDataSources.Remove(report.RecordingsName)
+
+	srv := gwr.NewConfiguredServer(gwr.Config{
+		ListenAddr: "127.0.0.1:0",
+		Authorize: func(req *source.AuthRequest) error {
+			if req.Verb == "watch" && req.Source == "/meta/nouns" {
+				return errors.New("no watching nouns")
+			}
+			return nil
+		},
+	})
+	require.NoError(t, srv.Start(), "no start error")
+	defer srv.Stop()
+
+	start := func(name string) int {
+		resp, err := http.PostForm(
+			fmt.Sprintf("http://%v%s", srv.Addr(), report.RecordingsName),
+			url.Values{"action": {"start"}, "source": {name}})
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusForbidden, start("/meta/nouns"), "recording needs a watch authorized")
+	assert.Empty(t, fr.Recordings())
+
+	cmd, closeConn := respClient(t, srv.Addr().String())
+	defer closeConn()
+	reply := cmd("action", report.RecordingsName, "start", "source", "/meta/nouns")
+	assert.Contains(t, reply[0], "access to /meta/nouns denied", "resp recording needs a watch authorized")
+	assert.Empty(t, fr.Recordings())
+
+	assert.Equal(t, http.StatusOK, start("/meta/stats"), "other sources may be recorded")
+	assert.Equal(t, []string{"+OK"}, cmd("action", report.RecordingsName, "stop", "source", "/meta/stats"))
+	assert.Empty(t, fr.Recordings())
+}
+
+func TestConfiguredServer_watchLabel(t *testing.T) {
+	os.Unsetenv("GWR_LISTEN")
+	os.Unsetenv("GWR_AUTH_TOKEN")
+	var (
+		labelsLock sync.Mutex
+		labels     []string
+	)
+	srv := gwr.NewConfiguredServer(gwr.Config{
+		ListenAddr: "127.0.0.1:0",
+		Authorize: func(req *source.AuthRequest) error {
+			labelsLock.Lock()
+			labels = append(labels, req.Verb+" "+req.Label)
+			labelsLock.Unlock()
+			return nil
+		},
+	})
+	require.NoError(t, srv.Start(), "no start error")
+	defer srv.Stop()
+
+	resp, err := http.Get(fmt.Sprintf("http://%v/meta/nouns?format=json&watch=1&label=%s",
+		srv.Addr(), strings.Repeat("x", source.MaxWatchLabel+1)))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "label too long")
+
+	resp, err = http.Get(fmt.Sprintf("http://%v/meta/nouns?format=json&watch=1&label=oncall-incident-123", srv.Addr()))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	_, err = bufio.NewReader(resp.Body).ReadString('\n')
+	require.NoError(t, err, "no watch read error")
+
+	labelsLock.Lock()
+	assert.Equal(t, []string{"watch oncall-incident-123"}, labels, "label passed to Authorize")
+	labelsLock.Unlock()
+	nouns := gwr.DefaultDataSources.Get("/meta/nouns")
+	assert.Equal(t, map[string]int{"oncall-incident-123": 1}, source.GetStats(nouns).Labels)
+
+	resp.Body.Close()
+	for i := 0; i < 100 && source.GetStats(nouns).Labels != nil; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Nil(t, source.GetStats(nouns).Labels, "label forgotten once unwatched")
+}
+
+type rateSource struct {
+	watcher source.GenericDataWatcher
+}
+
+func (rs *rateSource) Name() string                                 { return "/test/rate" }
+func (rs *rateSource) TextTemplate() *template.Template             { return nil }
+func (rs *rateSource) SetWatcher(watcher source.GenericDataWatcher) { rs.watcher = watcher }
+
+func TestConfiguredServer_watchRate(t *testing.T) {
+	os.Unsetenv("GWR_LISTEN")
+	os.Unsetenv("GWR_AUTH_TOKEN")
+	rs := &rateSource{}
+	mds := marshaled.NewDataSource(rs, nil)
+	require.NoError(t, gwr.DefaultDataSources.Add(mds))
+	defer gwr.DefaultDataSources.Remove(rs.Name())
+	srv := gwr.NewConfiguredServer(gwr.Config{
+		ListenAddr: "127.0.0.1:0",
+		WatchRate:  source.RateLimit{Items: 10},
+	})
+	require.NoError(t, srv.Start(), "no start error")
+	defer srv.Stop()
+
+	for _, query := range []string{"rate=0", "rate=fast", "byte_rate=-1"} {
+		resp, err := http.Get(fmt.Sprintf("http://%v/test/rate?format=json&watch=1&%s", srv.Addr(), query))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "invalid %s", query)
+	}
+
+	resp, err := http.Get(fmt.Sprintf("http://%v/test/rate?format=json&watch=1&rate=2", srv.Addr()))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	for i := 0; i < 100 && !rs.watcher.Active(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	for i := 1; i <= 5; i++ {
+		rs.watcher.HandleItem(i)
+	}
+
+	rd := bufio.NewReader(resp.Body)
+	for _, want := range []string{"1\n", "2\n"} {
+		line, err := rd.ReadString('\n')
+		require.NoError(t, err, "no watch read error")
+		assert.Equal(t, want, line)
+	}
+	for i := 0; i < 100 && mds.Stats().Dropped < 3; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, uint64(3), mds.Stats().Dropped, "items over the lowered rate dropped")
+}
+
+func TestConfiguredServer_watchBacklog(t *testing.T) {
+	os.Unsetenv("GWR_LISTEN")
+	os.Unsetenv("GWR_AUTH_TOKEN")
+	rs := &rateSource{}
+	buf := source.NewBuffered(rs, 10)
+	mds := marshaled.NewDataSource(buf, nil)
+	require.NoError(t, gwr.DefaultDataSources.Add(mds))
+	defer gwr.DefaultDataSources.Remove(rs.Name())
+	srv := gwr.NewConfiguredServer(gwr.Config{ListenAddr: "127.0.0.1:0"})
+	require.NoError(t, srv.Start(), "no start error")
+	defer srv.Stop()
+
+	for _, query := range []string{"backlog=0", "backlog=all", "backlog=2&diff=1"} {
+		resp, err := http.Get(fmt.Sprintf("http://%v/test/rate?format=json&watch=1&%s", srv.Addr(), query))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "invalid %s", query)
+	}
+
+	rs.watcher.HandleItems([]interface{}{1, 2, 3})
+	resp, err := http.Get(fmt.Sprintf("http://%v/test/rate?format=json&watch=1&backlog=2", srv.Addr()))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	rs.watcher.HandleItem(4)
+
+	rd := bufio.NewReader(resp.Body)
+	for _, want := range []string{"2\n", "3\n", `{"gwr":"backlog_end","items":2}` + "\n", "4\n"} {
+		line, err := rd.ReadString('\n')
+		require.NoError(t, err, "no watch read error")
+		assert.Equal(t, want, line)
+	}
+}
+
+func TestConfiguredServer_formatArgs(t *testing.T) {
+	os.Unsetenv("GWR_LISTEN")
+	os.Unsetenv("GWR_AUTH_TOKEN")
+	srv := gwr.NewConfiguredServer(gwr.Config{ListenAddr: "127.0.0.1:0"})
+	require.NoError(t, srv.Start(), "no start error")
+	defer srv.Stop()
+
+	resp, err := http.Get(fmt.Sprintf("http://%v/meta/build?format=%s", srv.Addr(), url.QueryEscape("JSON;pretty=1")))
+	require.NoError(t, err)
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	assert.True(t, strings.HasPrefix(string(body), "{\n  "), "pretty printed: %q", body)
+
+	for _, format := range []string{"json;pretty", "json;pretty=maybe", "text;pretty=1"} {
+		resp, err := http.Get(fmt.Sprintf("http://%v/meta/build?format=%s", srv.Addr(), url.QueryEscape(format)))
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "format %q", format)
+	}
+}
+
+func TestConfiguredServer_watchTable(t *testing.T) {
+	os.Unsetenv("GWR_LISTEN")
+	os.Unsetenv("GWR_AUTH_TOKEN")
+	rs := &rateSource{}
+	mds := marshaled.NewDataSource(rs, nil)
+	require.NoError(t, gwr.DefaultDataSources.Add(mds))
+	defer gwr.DefaultDataSources.Remove(rs.Name())
+	srv := gwr.NewConfiguredServer(gwr.Config{ListenAddr: "127.0.0.1:0"})
+	require.NoError(t, srv.Start(), "no start error")
+	defer srv.Stop()
+
+	resp, err := http.Get(fmt.Sprintf("http://%v/test/rate?format=table&watch=1&cols=value:x", srv.Addr()))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode, "invalid cols")
+
+	resp, err = http.Get(fmt.Sprintf("http://%v/test/rate?format=table&watch=1&cols=value:5", srv.Addr()))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	rd := bufio.NewReader(resp.Body)
+	line, err := rd.ReadString('\n')
+	require.NoError(t, err, "no watch read error")
+	assert.Equal(t, "VALUE\n", line, "header first")
+	rs.watcher.HandleItem(123456)
+	line, err = rd.ReadString('\n')
+	require.NoError(t, err, "no watch read error")
+	assert.Equal(t, "1234…\n", line, "value truncated to its column")
+}
+
+func TestConfiguredServer_watchers(t *testing.T) {
+	os.Unsetenv("GWR_LISTEN")
+	os.Unsetenv("GWR_AUTH_TOKEN")
+	srv := gwr.NewConfiguredServer(gwr.Config{ListenAddr: "127.0.0.1:0"})
+	require.NoError(t, srv.Start(), "no start error")
+	defer srv.Stop()
+
+	// watches are listed process wide, and those of other tests may not have
+	// ended yet, so only the labeled ones are considered
+	getWatches := func() []map[string]interface{} {
+		resp, err := http.Get(fmt.Sprintf("http://%v/meta/watchers?format=json", srv.Addr()))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var all, watches []map[string]interface{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&all))
+		for _, watch := range all {
+			if watch["label"] == "oncall" {
+				watches = append(watches, watch)
+			}
+		}
+		return watches
+	}
+	assert.Empty(t, getWatches(), "no watches yet")
+
+	resp, err := http.Get(fmt.Sprintf("http://%v/meta/nouns?format=json&watch=1&label=oncall", srv.Addr()))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	_, err = bufio.NewReader(resp.Body).ReadString('\n')
+	require.NoError(t, err, "no watch read error")
+
+	watches := getWatches()
+	require.Len(t, watches, 1)
+	assert.Equal(t, "/meta/nouns", watches[0]["source"])
+	assert.Equal(t, "json", watches[0]["format"])
+	assert.Equal(t, "http", watches[0]["protocol"])
+	assert.Equal(t, "oncall", watches[0]["label"])
+	assert.Equal(t, float64(1), watches[0]["items"], "initial listing delivered")
+	assert.NotEmpty(t, watches[0]["remote_addr"])
+
+	kill := func(id string) int {
+		req, err := http.NewRequest("DELETE", fmt.Sprintf("http://%v/meta/watchers/%s", srv.Addr(), id), nil)
+		require.NoError(t, err)
+		kresp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		kresp.Body.Close()
+		return kresp.StatusCode
+	}
+	assert.Equal(t, http.StatusBadRequest, kill("999999"), "no such watch")
+	assert.Equal(t, http.StatusOK, kill(fmt.Sprint(watches[0]["id"])))
+	_, err = ioutil.ReadAll(resp.Body)
+	require.NoError(t, err, "stream ended cleanly")
+	resp.Body.Close()
+	assert.Equal(t, "killed", resp.Trailer.Get("Gwr-Stream-End"))
+
+	for i := 0; i < 100 && len(watches) > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+		watches = getWatches()
+	}
+	assert.Empty(t, watches, "ended watch no longer listed")
+}
+
+func TestConfiguredServer_respIdleTimeout(t *testing.T) {
+	os.Unsetenv("GWR_LISTEN")
+	os.Unsetenv("GWR_AUTH_TOKEN")
+	os.Setenv("GWR_RESP_IDLE_TIMEOUT", "forever")
+	srv := gwr.NewConfiguredServer(gwr.Config{ListenAddr: "127.0.0.1:0"})
+	assert.Error(t, srv.Start(), "invalid idle timeout")
+	os.Unsetenv("GWR_RESP_IDLE_TIMEOUT")
+
+	srv = gwr.NewConfiguredServer(gwr.Config{
+		ListenAddr:      "127.0.0.1:0",
+		RESPIdleTimeout: 50 * time.Millisecond,
+	})
+	require.NoError(t, srv.Start(), "no start error")
+	defer srv.Stop()
+
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	fmt.Fprintf(conn, "*1\r\n$2\r\nls\r\n")
+	r := bufio.NewReader(conn)
+	line, err := r.ReadString('\n')
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(line, "*"), "ls before timing out")
+
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			break
+		}
+		lines = append(lines, strings.TrimSpace(line))
+	}
+	if assert.NotEmpty(t, lines) {
+		assert.Equal(t, "-ERR idle timeout", lines[len(lines)-1], "idle connection reaped")
+	}
+}
+
+// respClient returns a function that sends a RESP command to addr and
+// returns its reply, with any arrays flattened into a list of their elements;
+// called with no arguments, it just reads the next reply, such as a pub/sub
+// message.
+func respClient(t *testing.T, addr string) (func(args ...string) []string, func()) {
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	r := bufio.NewReader(conn)
+	readLine := func() string {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		return strings.TrimSpace(line)
+	}
+	var read func() []string
+	read = func() []string {
+		line := readLine()
+		switch line[0] {
+		case '*':
+			n, err := strconv.Atoi(line[1:])
+			require.NoError(t, err)
+			vals := []string{}
+			for i := 0; i < n; i++ {
+				vals = append(vals, read()...)
+			}
+			return vals
+		case '$':
+			n, err := strconv.Atoi(line[1:])
+			require.NoError(t, err)
+			if n < 0 {
+				return []string{""}
+			}
+			buf := make([]byte, n+2)
+			_, err = io.ReadFull(r, buf)
+			require.NoError(t, err)
+			return []string{string(buf[:n])}
+		}
+		return []string{line}
+	}
+	cmd := func(args ...string) []string {
+		if len(args) > 0 {
+			fmt.Fprintf(conn, "*%d\r\n", len(args))
+			for _, arg := range args {
+				fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(arg), arg)
+			}
+		}
+		return read()
+	}
+	return cmd, func() { conn.Close() }
+}
+
+func TestConfiguredServer_respLs(t *testing.T) {
+	os.Unsetenv("GWR_LISTEN")
+	os.Unsetenv("GWR_AUTH_TOKEN")
+	srv := gwr.NewConfiguredServer(gwr.Config{ListenAddr: "127.0.0.1:0"})
+	require.NoError(t, srv.Start(), "no start error")
+	defer srv.Stop()
+	cmd, closeConn := respClient(t, srv.Addr().String())
+	defer closeConn()
+
+	assert.Equal(t, []string{"/meta/build", "/meta/config", "/meta/graph", "/meta/listen", "/meta/loglevel", "/meta/nouns", "/meta/reporters", "/meta/selftest", "/meta/stats", "/meta/watchers"}, cmd("ls", "/meta"), "path")
+	assert.Equal(t, []string{"/meta/build", "/meta/config", "/meta/graph", "/meta/listen", "/meta/loglevel", "/meta/nouns", "/meta/reporters", "/meta/selftest", "/meta/stats", "/meta/watchers"}, cmd("ls", "/meta/"), "path with trailing slash")
+	assert.Equal(t, []string{"/meta/stats"}, cmd("ls", "/*/stats"), "pattern")
+	assert.Equal(t, []string{":10"}, cmd("ls", "-c", "/meta"), "count")
+	assert.Equal(t, []string{":0"}, cmd("ls", "-c", "/no/such"), "count of nothing")
+	assert.Empty(t, cmd("ls", "/no/such"), "nothing matched")
+}
+
+func TestConfiguredServer_respWatches(t *testing.T) {
+	os.Unsetenv("GWR_LISTEN")
+	os.Unsetenv("GWR_AUTH_TOKEN")
+	srv := gwr.NewConfiguredServer(gwr.Config{ListenAddr: "127.0.0.1:0"})
+	require.NoError(t, srv.Start(), "no start error")
+	defer srv.Stop()
+	cmd, closeConn := respClient(t, srv.Addr().String())
+	defer closeConn()
+
+	assert.Equal(t, []string{"+OK"}, cmd("watch", "/meta/*", "json"))
+	assert.Equal(t, []string{
+		"/meta/build", "json",
+		"/meta/config", "json",
+		"/meta/graph", "json",
+		"/meta/listen", "json",
+		"/meta/loglevel", "json",
+		"/meta/nouns", "json",
+		"/meta/reporters", "json",
+		"/meta/selftest", "json",
+		"/meta/stats", "json",
+		"/meta/watchers", "json",
+	}, cmd("watches"))
+
+	assert.Equal(t, []string{"+OK"}, cmd("setformat", "/meta/stats", "text"))
+	assert.Contains(t, cmd("setformat", "/meta/stats", "nope")[0], "does not support format")
+	assert.Equal(t, []string{":1"}, cmd("unwatch", "/meta/nouns"))
+	assert.Contains(t, cmd("setformat", "/meta/nouns", "text")[0], "not watching /meta/nouns")
+	assert.Equal(t, []string{
+		"/meta/build", "json",
+		"/meta/config", "json",
+		"/meta/graph", "json",
+		"/meta/listen", "json",
+		"/meta/loglevel", "json",
+		"/meta/reporters", "json",
+		"/meta/selftest", "json",
+		"/meta/stats", "text",
+		"/meta/watchers", "json",
+	}, cmd("watches"))
+
+	assert.Equal(t, []string{":9"}, cmd("unwatch", "/meta/*"))
+	assert.Equal(t, []string{":0"}, cmd("unwatch", "/meta/*"))
+	assert.Empty(t, cmd("watches"))
+}
+
+func TestConfiguredServer_respCompat(t *testing.T) {
+	os.Unsetenv("GWR_LISTEN")
+	os.Unsetenv("GWR_AUTH_TOKEN")
+	srv := gwr.NewConfiguredServer(gwr.Config{ListenAddr: "127.0.0.1:0"})
+	require.NoError(t, srv.Start(), "no start error")
+	defer srv.Stop()
+	cmd, closeConn := respClient(t, srv.Addr().String())
+	defer closeConn()
+
+	assert.Equal(t, []string{"+PONG"}, cmd("PING"))
+	assert.Equal(t, []string{"+OK"}, cmd("SELECT", "0"))
+	assert.Contains(t, cmd("SELECT", "x")[0], "invalid DB index")
+	info := cmd("INFO", "clients")
+	require.Len(t, info, 1)
+	assert.True(t, strings.HasPrefix(info[0], "# Clients\r\nconnected_clients:1\r\n"), "info section")
+	count := cmd("COMMAND", "COUNT")
+	require.Len(t, count, 1)
+	n, err := strconv.Atoi(strings.TrimPrefix(count[0], ":"))
+	require.NoError(t, err)
+	assert.Len(t, cmd("COMMAND"), 5*n, "an entry, flattened without its empty flags, for each command")
+}
+
+func TestConfiguredServer_respCompress(t *testing.T) {
+	os.Unsetenv("GWR_LISTEN")
+	os.Unsetenv("GWR_AUTH_TOKEN")
+	rs := &rateSource{}
+	require.NoError(t, gwr.DefaultDataSources.Add(marshaled.NewDataSource(rs, nil)))
+	defer gwr.DefaultDataSources.Remove(rs.Name())
+	srv := gwr.NewConfiguredServer(gwr.Config{ListenAddr: "127.0.0.1:0"})
+	require.NoError(t, srv.Start(), "no start error")
+	defer srv.Stop()
+	cmd, closeConn := respClient(t, srv.Addr().String())
+	defer closeConn()
+
+	badCmd, closeBad := respClient(t, srv.Addr().String())
+	assert.Contains(t, badCmd("compress", "maybe")[0], "expected on or off")
+	closeBad()
+
+	assert.Equal(t, []string{"+off"}, cmd("compress"), "off by default")
+	assert.Equal(t, []string{"+OK"}, cmd("compress", "on"))
+	assert.Equal(t, []string{"+on"}, cmd("compress"))
+
+	item := map[string]string{"msg": strings.Repeat("compressible ", 20)}
+	go func() {
+		for i := 0; i < 100 && !rs.watcher.Active(); i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		rs.watcher.HandleItem(item)
+		rs.watcher.HandleItem(item)
+	}()
+
+	// monitor has no reply of its own, just the frames of its stream
+	want, err := json.Marshal(item)
+	require.NoError(t, err)
+	frames := [][]string{cmd("monitor", rs.Name(), "json"), cmd()}
+	for _, frame := range frames {
+		require.Len(t, frame, 1)
+		assert.True(t, len(frame[0]) < len(want), "frame compressed")
+		data, err := snappy.Decode(nil, []byte(frame[0]))
+		require.NoError(t, err, "frame is a snappy block")
+		assert.Equal(t, string(want), string(data))
+	}
+}
+
+func TestConfiguredServer_respPipeline(t *testing.T) {
+	os.Unsetenv("GWR_LISTEN")
+	os.Unsetenv("GWR_AUTH_TOKEN")
+	srv := gwr.NewConfiguredServer(gwr.Config{ListenAddr: "127.0.0.1:0"})
+	require.NoError(t, srv.Start(), "no start error")
+	defer srv.Stop()
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// a batch of commands sent together is answered in order
+	_, err = conn.Write([]byte("*1\r\n$4\r\nPING\r\n*2\r\n$6\r\nSELECT\r\n$1\r\n0\r\n*2\r\n$2\r\nls\r\n$2\r\n-c\r\n"))
+	require.NoError(t, err)
+	r := bufio.NewReader(conn)
+	for _, want := range []string{"+PONG", "+OK", ":"} {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(line, want), "expected %q, got %q", want, line)
+	}
+}
+
+func TestConfiguredServer_aggregateOnly(t *testing.T) {
+	os.Unsetenv("GWR_LISTEN")
+	os.Unsetenv("GWR_AUTH_TOKEN")
+	gwr.DefaultDataSources.SetAggregateOnly(meta.StatsName, true)
+	defer gwr.DefaultDataSources.SetAggregateOnly(meta.StatsName, false)
+	srv := gwr.NewConfiguredServer(gwr.Config{ListenAddr: "127.0.0.1:0"})
+	require.NoError(t, srv.Start(), "no start error")
+	defer srv.Stop()
+
+	get := func(name string) int {
+		resp, err := http.Get(fmt.Sprintf("http://%v%s", srv.Addr(), name))
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusForbidden, get(meta.StatsName), "http get refused")
+	assert.Equal(t, http.StatusOK, get(meta.NounsName), "other sources allowed")
+
+	cmd, closeConn := respClient(t, srv.Addr().String())
+	defer closeConn()
+	assert.Contains(t, cmd("get", meta.StatsName)[0], "only aggregates", "resp get refused")
+	assert.Contains(t, cmd("watch", "/meta/*")[0], "only aggregates", "patterns matching it refused")
+	assert.Contains(t, cmd("ls", "/meta"), meta.StatsName, "still listed")
+}
+
+func TestRegisterProtocol(t *testing.T) {
+	os.Unsetenv("GWR_LISTEN")
+	os.Unsetenv("GWR_AUTH_TOKEN")
+	assert.Equal(t, gwr.ErrInvalidDetector, gwr.RegisterProtocol(stacked.Detector{}), "detectors must test")
+	require.NoError(t, gwr.RegisterProtocol(stacked.Detector{
+		Needed: 1,
+		Test:   func(b []byte) bool { return b[0] == '!' },
+		Handler: stacked.HandlerFunc(func(conn net.Conn, bufr *bufio.Reader) {
+			fmt.Fprintf(conn, "bang\n")
+			conn.Close()
+		}),
+	}))
+	srv := gwr.NewConfiguredServer(gwr.Config{ListenAddr: "127.0.0.1:0"})
+	require.NoError(t, srv.Start(), "no start error")
+	defer srv.Stop()
+
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	fmt.Fprintf(conn, "!\n")
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "bang\n", line, "registered protocol served")
+
+	resp, err := http.Get(fmt.Sprintf("http://%v/meta/nouns", srv.Addr()))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "http still served")
+}
+
+// writeTestCert writes a self-signed certificate for 127.0.0.1, usable by both
+// servers and clients, and its key, returning the file names and a pool that
+// trusts it.
+func writeTestCert(t *testing.T, dir string) (string, string, *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "gwr test"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	require.NoError(t, ioutil.WriteFile(certFile,
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, ioutil.WriteFile(keyFile,
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return certFile, keyFile, pool
+}
+
+func TestConfiguredServer_tls(t *testing.T) {
+	os.Unsetenv("GWR_LISTEN")
+	os.Unsetenv("GWR_AUTH_TOKEN")
+	dir, err := ioutil.TempDir("", "gwr_tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile, pool := writeTestCert(t, dir)
+
+	srv := gwr.NewConfiguredServer(gwr.Config{
+		ListenAddr:  "127.0.0.1:0",
+		TLSCertFile: certFile,
+	})
+	assert.Error(t, srv.Start(), "cert without key")
+
+	var subjects []string
+	srv = gwr.NewConfiguredServer(gwr.Config{
+		ListenAddr:      "127.0.0.1:0",
+		TLSCertFile:     certFile,
+		TLSKeyFile:      keyFile,
+		TLSClientCAFile: certFile,
+		Authorize: func(req *source.AuthRequest) error {
+			if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 {
+				return errors.New("no client certificate")
+			}
+			subjects = append(subjects, req.Protocol+" "+req.TLS.VerifiedChains[0][0].Subject.CommonName)
+			return nil
+		},
+	})
+	require.NoError(t, srv.Start(), "no start error")
+	defer srv.Stop()
+
+	clientCert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	require.NoError(t, err)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs:      pool,
+		Certificates: []tls.Certificate{clientCert},
+	}}}
+	resp, err := client.Get(fmt.Sprintf("https://%v/meta/nouns", srv.Addr()))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "https get")
+
+	conn, err := tls.Dial("tcp", srv.Addr().String(), &tls.Config{
+		RootCAs:      pool,
+		Certificates: []tls.Certificate{clientCert},
+	})
+	require.NoError(t, err)
+	defer conn.Close()
+	fmt.Fprintf(conn, "*1\r\n$2\r\nls\r\n")
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(line, "*"), "resp ls over tls")
+
+	assert.Equal(t, []string{"http gwr test", "resp gwr test"}, subjects)
+
+	// without a client certificate, the handshake fails
+	_, err = (&http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{
+		RootCAs: pool,
+	}}}).Get(fmt.Sprintf("https://%v/meta/nouns", srv.Addr()))
+	assert.Error(t, err, "client certificate required")
+}
+
+func TestConfiguredServer_listeners(t *testing.T) {
+	os.Unsetenv("GWR_LISTEN")
+	os.Unsetenv("GWR_AUTH_TOKEN")
+	dir, err := ioutil.TempDir("", "gwr_tls")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	certFile, keyFile, pool := writeTestCert(t, dir)
+
+	srv := gwr.NewConfiguredServer(gwr.Config{
+		Listeners: []gwr.ListenerConfig{{Addr: "127.0.0.1:0", TLS: true}},
+	})
+	assert.Error(t, srv.Start(), "tls listener without a tls config")
+
+	srv = gwr.NewConfiguredServer(gwr.Config{
+		TLSCertFile: certFile,
+		TLSKeyFile:  keyFile,
+		Listeners: []gwr.ListenerConfig{
+			{Addr: "localhost:0"},
+			{Addr: "127.0.0.1:0", TLS: true},
+		},
+	})
+	require.NoError(t, srv.Start(), "no start error")
+	defer srv.Stop()
+	assert.Equal(t, gwr.ErrAlreadyStarted, srv.Start())
+	addrs := srv.Addrs()
+	require.Len(t, addrs, 2)
+	plain, secure := addrs[0].String(), addrs[1].String()
+
+	resp, err := http.Get(fmt.Sprintf("http://%v/meta/listen?format=json", plain))
+	require.NoError(t, err)
+	var infos []map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&infos))
+	resp.Body.Close()
+	assert.Contains(t, infos, map[string]interface{}{"listen": "localhost:0", "addr": plain, "tls": false})
+	assert.Contains(t, infos, map[string]interface{}{"listen": "127.0.0.1:0", "addr": secure, "tls": true})
+
+	resp, err = http.Get(fmt.Sprintf("http://%v/listen", plain))
+	require.NoError(t, err)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	var listening []string
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&listening))
+	resp.Body.Close()
+	assert.Equal(t, []string{plain, secure}, listening, "/listen lists every bound address")
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	require.NoError(t, srv.StopListener("localhost:0"))
+	assert.Error(t, srv.StopListener("nowhere:0"), "no such listener")
+	assert.Equal(t, []net.Addr{addrs[1]}, srv.Addrs(), "only the plain listener stopped")
+	resp, err = client.Get(fmt.Sprintf("https://%v/meta/nouns", secure))
+	require.NoError(t, err, "https still served")
+	resp.Body.Close()
+
+	require.NoError(t, srv.Start(), "restarts the stopped listener")
+	assert.Len(t, srv.Addrs(), 2)
+	assert.Equal(t, gwr.ErrAlreadyStarted, srv.StartListener(gwr.ListenerConfig{Addr: "127.0.0.1:0"}))
+	require.NoError(t, srv.StartListener(gwr.ListenerConfig{Addr: "unix://" + filepath.Join(dir, "gwr.sock")}), "another listener")
+	assert.Len(t, srv.Addrs(), 3)
+
+	srv = gwr.NewConfiguredServer(gwr.Config{ListenAddr: "127.0.0.1:0, localhost:0"})
+	require.NoError(t, srv.Start())
+	defer srv.Stop()
+	assert.Len(t, srv.Addrs(), 2, "a list of listen addresses")
+	assert.Equal(t, "127.0.0.1:0, localhost:0", srv.ListenAddr())
+}
+
+func TestConfiguredServer_unix(t *testing.T) {
+	os.Unsetenv("GWR_LISTEN")
+	os.Unsetenv("GWR_AUTH_TOKEN")
+	dir, err := ioutil.TempDir("", "gwr_unix")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "gwr.sock")
+
+	srv := gwr.NewConfiguredServer(gwr.Config{ListenAddr: "unix://" + path})
+	require.NoError(t, srv.Start(), "no start error")
+	assert.Equal(t, "unix", srv.Addr().Network())
+
+	client := &http.Client{Transport: &http.Transport{
+		Dial: func(_, _ string) (net.Conn, error) {
+			return net.Dial("unix", path)
+		},
+	}}
+	resp, err := client.Get("http://gwr/meta/nouns")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "http over unix socket")
+	assert.NoError(t, srv.Stop(), "no stop error")
+}
+
+func TestConfiguredServer_fd(t *testing.T) {
+	os.Unsetenv("GWR_LISTEN")
+	os.Unsetenv("GWR_AUTH_TOKEN")
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	f, err := ln.(*net.TCPListener).File()
+	require.NoError(t, err)
+	ln.Close()
+	// the server takes ownership of the descriptor, as if it were inherited
+	fd, err := syscall.Dup(int(f.Fd()))
+	require.NoError(t, err)
+	f.Close()
+
+	srv := gwr.NewConfiguredServer(gwr.Config{ListenAddr: fmt.Sprintf("fd://%d", fd)})
+	require.NoError(t, srv.Start(), "no start error")
+	defer srv.Stop()
+
+	resp, err := http.Get(fmt.Sprintf("http://%v/meta/nouns", srv.Addr()))
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode, "http over inherited fd")
+
+	os.Unsetenv("LISTEN_FDS")
+	srv = gwr.NewConfiguredServer(gwr.Config{ListenAddr: "systemd:"})
+	assert.Error(t, srv.Start(), "no systemd sockets passed")
+}
+
+func TestConfigureLimits(t *testing.T) {
+	orig := marshaled.DefaultLimits()
+	defer marshaled.SetDefaultLimits(orig)
+
+	os.Setenv("GWR_MAX_ITEMS", "500")
+	defer os.Unsetenv("GWR_MAX_ITEMS")
+	assert.NoError(t, gwr.ConfigureLimits(gwr.Config{
+		MaxItems:   200,
+		MaxBatches: 20,
+	}))
+	assert.Equal(t, marshaled.Limits{
+		MaxItems:   500,
+		MaxBatches: 20,
+		MaxWait:    orig.MaxWait,
+	}, marshaled.DefaultLimits(), "env supercedes config, unset limits unchanged")
+
+	os.Setenv("GWR_MAX_WAIT", "soon")
+	defer os.Unsetenv("GWR_MAX_WAIT")
+	assert.Error(t, gwr.ConfigureLimits(gwr.Config{}), "invalid duration")
+	os.Setenv("GWR_MAX_WAIT", "5ms")
+	assert.NoError(t, gwr.ConfigureLimits(gwr.Config{}))
+	assert.Equal(t, 5*time.Millisecond, marshaled.DefaultLimits().MaxWait)
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gwr-config")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	yamlPath := filepath.Join(dir, "gwr.yaml")
+	require.NoError(t, ioutil.WriteFile(yamlPath, []byte(`
+listen: ":4040"
+auth_token: secret
+max_wait: 5ms
+sources:
+  /tap/requests:
+    max_items: 1000
+    rate: {items: 50}
+    sample: 0.1
+reporters:
+  - type: syslog
+    addr: localhost:514
+    sources: ["/audit"]
+`), 0644))
+	cfg, err := gwr.LoadConfig(yamlPath)
+	require.NoError(t, err)
+	assert.Equal(t, &gwr.Config{
+		ListenAddr: ":4040",
+		AuthToken:  "secret",
+		MaxWait:    5 * time.Millisecond,
+		Sources: map[string]gwr.SourceConfig{
+			"/tap/requests": {MaxItems: 1000, Rate: source.RateLimit{Items: 50}, Sample: 0.1},
+		},
+		Reporters: []report.ReporterConfig{
+			{Type: "syslog", Addr: "localhost:514", Sources: []string{"/audit"}},
+		},
+	}, cfg)
+
+	jsonPath := filepath.Join(dir, "gwr.json")
+	require.NoError(t, ioutil.WriteFile(jsonPath, []byte(`{"listen": ":4040", "enabled": false, "disable_sources": true}`), 0644))
+	cfg, err = gwr.LoadConfig(jsonPath)
+	require.NoError(t, err)
+	require.NotNil(t, cfg.Enabled)
+	assert.False(t, *cfg.Enabled)
+	assert.True(t, cfg.DisableSources)
+	assert.Equal(t, ":4040", cfg.ListenAddr)
+
+	require.NoError(t, ioutil.WriteFile(yamlPath, []byte("listen_addr: \":4040\"\n"), 0644))
+	_, err = gwr.LoadConfig(yamlPath)
+	assert.Error(t, err, "unknown key")
+
+	_, err = gwr.LoadConfig(filepath.Join(dir, "missing.yaml"))
+	assert.Error(t, err, "missing file")
+
+	assert.Error(t, gwr.ConfigureLimits(gwr.Config{
+		Sources: map[string]gwr.SourceConfig{"/tap/requests": {Sample: 2}},
+	}), "invalid sample")
+}
+
+func TestConfiguredServer_envOverrides(t *testing.T) {
+	os.Setenv("GWR_ENABLED", "false")
+	defer os.Unsetenv("GWR_ENABLED")
+	srv := gwr.NewConfiguredServer(gwr.Config{ListenAddr: "127.0.0.1:0"})
+	assert.False(t, srv.Enabled(), "env supercedes config")
+
+	os.Setenv("GWR_ENABLED", "maybe")
+	srv = gwr.NewConfiguredServer(gwr.Config{ListenAddr: "127.0.0.1:0"})
+	assert.Error(t, srv.Start(), "invalid $GWR_ENABLED")
+
+	os.Unsetenv("GWR_ENABLED")
+	os.Setenv("GWR_TLS_CERT", "/nonexistent/cert.pem")
+	defer os.Unsetenv("GWR_TLS_CERT")
+	os.Setenv("GWR_TLS_KEY", "/nonexistent/key.pem")
+	defer os.Unsetenv("GWR_TLS_KEY")
+	srv = gwr.NewConfiguredServer(gwr.Config{ListenAddr: "127.0.0.1:0"})
+	assert.Error(t, srv.Start(), "env TLS files loaded")
+}
+
+func TestConfigIdentity(t *testing.T) {
+	hostname, _ := os.Hostname()
+	assert.Equal(t, source.Identity{
+		Service:  "api",
+		Instance: hostname,
+	}, gwr.ConfigIdentity(source.Identity{Service: "api"}), "instance defaults to the hostname")
+
+	os.Setenv("GWR_INSTANCE", "api-7")
+	defer os.Unsetenv("GWR_INSTANCE")
+	os.Setenv("GWR_ZONE", "us-east-1a")
+	defer os.Unsetenv("GWR_ZONE")
+	assert.Equal(t, source.Identity{
+		Service:  "api",
+		Instance: "api-7",
+		Zone:     "us-east-1a",
+	}, gwr.ConfigIdentity(source.Identity{Service: "api", Instance: "api-1"}), "env supercedes config")
+}
+
+func TestConfiguredServer_relisten(t *testing.T) {
+	os.Unsetenv("GWR_LISTEN")
+	srv := gwr.NewConfiguredServer(gwr.Config{ListenAddr: "127.0.0.1:0"})
+	require.NoError(t, srv.Start())
+	defer srv.Stop()
+	cs := gwr.NewConfigServer(srv)
+	old := srv.Addr().String()
+	assert.Equal(t, old, cs.ConfigInfo().Addrs[0])
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	assert.Error(t, cs.Relisten(ln.Addr().String()), "address in use")
+	require.NotNil(t, srv.Addr(), "old listener restored")
+	assert.Equal(t, "127.0.0.1:0", cs.ConfigInfo().Listen)
+
+	require.NoError(t, cs.Relisten("127.0.0.1:0"))
+	require.NotNil(t, srv.Addr())
+	assert.NotEqual(t, old, srv.Addr().String(), "moved to a new port")
+	_, err = net.Dial("tcp", old)
+	assert.Error(t, err, "old address closed")
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	conn.Close()
+}
+
+func TestAddProfileSources(t *testing.T) {
+	names := []string{"/debug/goroutines", "/debug/heap", "/debug/profile"}
+	for _, name := range names {
+		assert.Nil(t, gwr.DefaultDataSources.Get(name), "%s is opt-in", name)
+	}
+
+	gwr.AddProfileSources()
+	gwr.AddProfileSources()
+	for _, name := range names {
+		defer gwr.DefaultDataSources.Remove(name)
+		assert.NotNil(t, gwr.DefaultDataSources.Get(name), "%s added", name)
+	}
+}
@@ -21,8 +21,12 @@
 package gwr
 
 import (
+	"time"
+
+	"github.com/uber-go/gwr/internal"
 	"github.com/uber-go/gwr/internal/marshaled"
 	"github.com/uber-go/gwr/internal/meta"
+	"github.com/uber-go/gwr/report"
 	"github.com/uber-go/gwr/source"
 )
 
@@ -31,13 +35,118 @@ import (
 // protocol servers if no data sources are provided.
 var DefaultDataSources *source.DataSources
 
+var (
+	stalls       *meta.StallsDataSource
+	serverStats  *meta.StatsDataSource
+	selftest     *meta.SelftestDataSource
+	logLevels    *meta.LogLevelDataSource
+	reporters    *report.Manager
+	configSource *meta.ConfigDataSource
+	listeners    *meta.ListenDataSource
+)
+
 func init() {
 	DefaultDataSources = source.NewDataSources()
 	metaNouns := meta.NewNounDataSource(DefaultDataSources)
 	DefaultDataSources.Add(marshaled.NewDataSource(metaNouns, nil))
 	DefaultDataSources.SetObserver(metaNouns)
+	DefaultDataSources.Add(marshaled.NewDataSource(meta.NewGraphDataSource(DefaultDataSources), nil))
+	serverStats = meta.NewStatsDataSource(DefaultDataSources)
+	DefaultDataSources.Add(marshaled.NewDataSource(serverStats, nil))
+	DefaultDataSources.Add(marshaled.NewDataSource(meta.NewWatchersDataSource(), nil))
+	DefaultDataSources.Add(marshaled.NewDataSource(meta.NewBuildDataSource(), nil))
+	selftest = meta.NewSelftestDataSource(DefaultDataSources)
+	DefaultDataSources.Add(marshaled.NewDataSource(selftest, nil))
+	logLevels = meta.NewLogLevelDataSource()
+	DefaultDataSources.Add(marshaled.NewDataSource(logLevels, nil))
+	reporters = report.NewManager(DefaultDataSources)
+	DefaultDataSources.Add(marshaled.NewDataSource(reporters, nil))
+	configSource = meta.NewConfigDataSource()
+	DefaultDataSources.Add(marshaled.NewDataSource(configSource, nil))
+	listeners = meta.NewListenDataSource()
+	DefaultDataSources.Add(marshaled.NewDataSource(listeners, nil))
+
+	panics := meta.NewPanicDataSource()
+	DefaultDataSources.Add(marshaled.NewDataSource(panics, nil))
+	marshaled.SetPanicObserver(panics.ObservePanic)
+
+	DefaultDataSources.Add(marshaled.NewDataSource(meta.NewChildrenDataSource(), nil))
+	DefaultDataSources.Add(marshaled.NewDataSource(meta.NewCgroupDataSource(), nil))
+	DefaultDataSources.Add(marshaled.NewDataSource(meta.NewConnsDataSource(), nil))
+	stalls = meta.NewStallsDataSource()
+	DefaultDataSources.Add(marshaled.NewDataSource(stalls, nil))
+}
+
+// AddProfileSources adds the "/debug/goroutines", "/debug/heap", and
+// "/debug/profile" sources to the default data sources; adding them again has
+// no effect.  They aren't added by default, since stack dumps and profiles
+// expose much of a program's internals to any client, and a cpu profile takes
+// the process-wide profiler while it runs.  Where untrusted clients may
+// connect, restrict them, e.g. with a Config.Authorize refusing "/debug/*".
+func AddProfileSources() {
+	DefaultDataSources.Add(meta.NewGoroutinesDataSource())
+	DefaultDataSources.Add(meta.NewHeapDataSource())
+	DefaultDataSources.Add(meta.NewCPUProfileDataSource())
+}
+
+// ArmStallDetector keeps the "/runtime/stalls" source sampling goroutines even
+// while it's unwatched, so that it can report goroutines blocked in the same
+// place for longer than threshold at any time; a zero threshold disarms it.
+// While disarmed, stalls are only detected while watched, with a 30 second
+// threshold.
+func ArmStallDetector(threshold time.Duration) {
+	stalls.Arm(threshold)
 }
 
+// Reporters returns the manager of the reporters configured by Configure,
+// e.g. to add a reporter type, like report.KafkaFactory, before configuring.
+func Reporters() *report.Manager {
+	return reporters
+}
+
+// LogLevel is a logger's adjustable level, as a string in the logger's own
+// terms, e.g. "debug"; see AddLogLevel.
+type LogLevel interface {
+	Level() string
+	SetLevel(level string) error
+}
+
+// AddLogLevel makes a logger's level adjustable through the "/meta/loglevel"
+// source, under the given name.  Its "set" action, with "name", "level", and
+// optional "ttl" parameters, changes the level until the ttl elapses, ten
+// minutes by default, when it reverts; its "reset" action, with a "name",
+// reverts it early.  Adding a level under a name already added replaces it.
+//
+// See zaptap.AtomicLevel for zap loggers; others may be adapted with
+// LevelFuncs.
+func AddLogLevel(name string, level LogLevel) {
+	logLevels.Add(name, level)
+}
+
+// LevelFuncs adapts a pair of functions, getting and setting a logger's
+// level, to a LogLevel.  For example, for a logrus logger:
+//
+//	gwr.AddLogLevel("logrus", gwr.LevelFuncs(
+//		func() string { return logger.GetLevel().String() },
+//		func(s string) error {
+//			level, err := logrus.ParseLevel(s)
+//			if err == nil {
+//				logger.SetLevel(level)
+//			}
+//			return err
+//		}))
+func LevelFuncs(get func() string, set func(string) error) LogLevel {
+	return levelFuncs{get, set}
+}
+
+type levelFuncs struct {
+	get func() string
+	set func(string) error
+}
+
+func (lf levelFuncs) Level() string               { return lf.get() }
+func (lf levelFuncs) SetLevel(level string) error { return lf.set(level) }
+
 // AddDataSource adds a data source to the default data sources registry.  It
 // returns an error if there's already a data source defined with the same
 // name.
@@ -46,9 +155,54 @@ func AddDataSource(ds source.DataSource) error {
 }
 
 // AddGenericDataSource adds a generic data source to the default data sources
-// registry.  It returns an error if there's already a data source defined with
-// the same name.
-func AddGenericDataSource(gds source.GenericDataSource) error {
-	mds := marshaled.NewDataSource(gds, nil)
-	return DefaultDataSources.Add(mds)
+// registry, tuned by any options.  It returns an error if there's already a
+// data source defined with the same name.
+//
+// When built with the gwr_noop tag, AddGenericDataSource does nothing, so
+// the source never gets a watcher.
+func AddGenericDataSource(gds source.GenericDataSource, opts ...SourceOption) error {
+	if internal.Noop {
+		return nil
+	}
+	return DefaultDataSources.Add(NewGenericDataSource(gds, opts...))
+}
+
+// NewGenericDataSource wraps a generic data source, tuned by any options, as a
+// DataSource, e.g. to add to a DataSources registry other than the default.
+func NewGenericDataSource(gds source.GenericDataSource, opts ...SourceOption) source.DataSource {
+	mopts := make([]marshaled.Option, len(opts))
+	for i, opt := range opts {
+		mopts[i] = opt.opt
+	}
+	return marshaled.NewDataSource(gds, nil, mopts...)
+}
+
+// SourceOption tunes how a generic data source queues items for its
+// watchers, overriding the limits set by Configure; see AddGenericDataSource.
+type SourceOption struct {
+	opt marshaled.Option
+}
+
+// WithBufferSizes sets how many items, and batches of items, a source queues
+// for its watchers; either may be zero to keep the default.  A source with
+// bursty producers may want more room than the default, while one with large
+// items may want less.
+func WithBufferSizes(maxItems, maxBatches int) SourceOption {
+	return SourceOption{marshaled.WithBufferSizes(maxItems, maxBatches)}
+}
+
+// WithMaxWait sets how long a source's producers wait on a full queue before
+// its watchers are ended; zero keeps the default.  QoSCritical sources, being
+// lossless, wait a thousand times as long; it doesn't apply to QoSDebug
+// sources, nor to LosslessDataSources.
+func WithMaxWait(maxWait time.Duration) SourceOption {
+	return SourceOption{marshaled.WithMaxWait(maxWait)}
+}
+
+// WithRateLimit sets how many items, and marshaled bytes, a source emits per
+// second in each watched format, dropping any items over it; either bound may
+// be zero to keep the default.  A source tapping a hot path may want a lower
+// limit than the rest.
+func WithRateLimit(rate source.RateLimit) SourceOption {
+	return SourceOption{marshaled.WithRateLimit(rate)}
 }
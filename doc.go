@@ -32,7 +32,12 @@ falling back to polling Get-able sources.
 
 For example a request log source would be naturally Watch-able for future
 requests as they come in.  An implementation could go further and add a
-"last-10" buffer to also become Get-able.
+"last-10" buffer to also become Get-able; source.NewBuffered provides such a
+buffer for any Watch-able source.
+
+Items are marshaled by each format, e.g. through encoding/json; programs whose
+items contain types that don't marshal well, or shouldn't be shown at all, can
+register a replacement with source.RegisterTypeMarshaler.
 
 Integrating
 
@@ -40,6 +45,10 @@ To bootstrap gwr and start its server listening on port 4040:
 
 	gwr.Configure(&gwr.Config{ListenAddr: ":4040"})
 
+Or to configure it from a YAML file, whose keys are those of Config, and which
+environment variables such as $GWR_LISTEN supercede:
+
+	gwr.ConfigureFromFile("/etc/app/gwr.yaml")
 
 GWR also adds a handler to the default http server; so if you already have a
 default http server like:
@@ -51,5 +60,13 @@ still call gwr.Configure:
 
 	gwr.Configure(nil)
 
+API Stability
+
+The public API consists of this package, and the source, source/filetail,
+source/logtap, source/tap, source/zaptap, and report packages; everything under
+internal may change at any time.  The exported surface of the public packages is recorded
+in api.txt, which "make check-api" verifies is up to date, so any change to it
+is deliberate and visible in review.
+
 */
 package gwr
@@ -0,0 +1,214 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Command apisurface prints the exported API surface of one or more package
+// directories, one sorted line per exported identifier, in the style of the
+// Go distribution's api/*.txt files.  It is used to maintain api.txt: any
+// change to the public surface shows up as a diff against it.
+//
+// Usage:
+//
+//	go run ./internal/apisurface IMPORT_PREFIX DIR...
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+func main() {
+	if len(os.Args) < 3 {
+		fmt.Fprintln(os.Stderr, "usage: apisurface IMPORT_PREFIX DIR...")
+		os.Exit(2)
+	}
+	prefix := os.Args[1]
+
+	var lines []string
+	for _, dir := range os.Args[2:] {
+		pkgLines, err := surface(path.Join(prefix, filepath.ToSlash(dir)), dir)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "apisurface: %v\n", err)
+			os.Exit(1)
+		}
+		lines = append(lines, pkgLines...)
+	}
+	sort.Strings(lines)
+	for _, line := range lines {
+		fmt.Println(line)
+	}
+}
+
+func notTest(fi os.FileInfo) bool {
+	return !strings.HasSuffix(fi.Name(), "_test.go")
+}
+
+func surface(importPath, dir string) ([]string, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, notTest, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	var lines []string
+	emit := func(format string, args ...interface{}) {
+		lines = append(lines, fmt.Sprintf("pkg %s, %s", importPath, fmt.Sprintf(format, args...)))
+	}
+	str := func(node ast.Node) string {
+		var buf bytes.Buffer
+		printer.Fprint(&buf, fset, node)
+		return strings.Join(strings.Fields(buf.String()), " ")
+	}
+
+	for _, pkg := range pkgs {
+		if pkg.Name == "main" {
+			continue
+		}
+		for _, file := range pkg.Files {
+			for _, decl := range file.Decls {
+				switch decl := decl.(type) {
+				case *ast.FuncDecl:
+					if !decl.Name.IsExported() {
+						continue
+					}
+					sig := signature(str, decl.Type)
+					if decl.Recv == nil {
+						emit("func %s%s", decl.Name.Name, sig)
+						continue
+					}
+					recv := str(decl.Recv.List[0].Type)
+					if !ast.IsExported(strings.TrimPrefix(recv, "*")) {
+						continue
+					}
+					emit("method (%s) %s%s", recv, decl.Name.Name, sig)
+
+				case *ast.GenDecl:
+					var lastType ast.Expr // carried through implicitly repeated consts
+					for _, spec := range decl.Specs {
+						switch spec := spec.(type) {
+						case *ast.TypeSpec:
+							if spec.Name.IsExported() {
+								typeSurface(emit, str, spec)
+							}
+						case *ast.ValueSpec:
+							kind := decl.Tok.String()
+							typ := spec.Type
+							if decl.Tok == token.CONST {
+								if typ == nil && len(spec.Values) == 0 {
+									typ = lastType
+								}
+								lastType = typ
+							}
+							for _, name := range spec.Names {
+								if !name.IsExported() {
+									continue
+								}
+								if typ != nil {
+									emit("%s %s %s", kind, name.Name, str(typ))
+								} else {
+									emit("%s %s", kind, name.Name)
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return lines, nil
+}
+
+func typeSurface(
+	emit func(string, ...interface{}),
+	str func(ast.Node) string,
+	spec *ast.TypeSpec,
+) {
+	name := spec.Name.Name
+	switch typ := spec.Type.(type) {
+	case *ast.StructType:
+		emit("type %s struct", name)
+		for _, field := range typ.Fields.List {
+			if len(field.Names) == 0 {
+				emit("type %s struct, embedded %s", name, str(field.Type))
+				continue
+			}
+			for _, fname := range field.Names {
+				if fname.IsExported() {
+					emit("type %s struct, %s %s", name, fname.Name, str(field.Type))
+				}
+			}
+		}
+
+	case *ast.InterfaceType:
+		emit("type %s interface", name)
+		for _, method := range typ.Methods.List {
+			if len(method.Names) == 0 {
+				emit("type %s interface, embedded %s", name, str(method.Type))
+				continue
+			}
+			sig := signature(str, method.Type.(*ast.FuncType))
+			for _, mname := range method.Names {
+				emit("type %s interface, %s%s", name, mname.Name, sig)
+			}
+		}
+
+	default:
+		emit("type %s %s", name, str(spec.Type))
+	}
+}
+
+// signature returns a function's parameter and result types, without any
+// names since those aren't part of its API.
+func signature(str func(ast.Node) string, ft *ast.FuncType) string {
+	types := func(fields *ast.FieldList) []string {
+		var parts []string
+		if fields == nil {
+			return parts
+		}
+		for _, field := range fields.List {
+			n := len(field.Names)
+			if n == 0 {
+				n = 1
+			}
+			for i := 0; i < n; i++ {
+				parts = append(parts, str(field.Type))
+			}
+		}
+		return parts
+	}
+
+	sig := "(" + strings.Join(types(ft.Params), ", ") + ")"
+	switch results := types(ft.Results); len(results) {
+	case 0:
+	case 1:
+		sig += " " + results[0]
+	default:
+		sig += " (" + strings.Join(results, ", ") + ")"
+	}
+	return sig
+}
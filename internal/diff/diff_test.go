@@ -0,0 +1,66 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package diff_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/uber-go/gwr/internal/diff"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUnified(t *testing.T) {
+	assert.Nil(t, diff.Unified("a", "b", []byte("x\ny\n"), []byte("x\ny\n")))
+
+	assert.Equal(t, "--- a\n+++ b\n@@ -0,0 +1,2 @@\n+x\n+y\n",
+		string(diff.Unified("a", "b", nil, []byte("x\ny\n"))))
+
+	prev := []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n")
+	cur := []byte("1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n")
+	assert.Equal(t, "--- a\n+++ b\n"+
+		"@@ -1,6 +1,6 @@\n 1\n 2\n-3\n+three\n 4\n 5\n 6\n"+
+		"@@ -9,4 +9,3 @@\n 9\n 10\n 11\n-12\n",
+		string(diff.Unified("a", "b", prev, cur)))
+}
+
+func TestJSONPatch(t *testing.T) {
+	patch := func(prev, cur string) string {
+		ops, err := diff.JSONPatch([]byte(prev), []byte(cur))
+		if !assert.NoError(t, err) {
+			return ""
+		}
+		buf, err := json.Marshal(ops)
+		assert.NoError(t, err)
+		return string(buf)
+	}
+
+	assert.Equal(t, `[{"op":"add","path":"","value":{"a":1}}]`, patch("", `{"a":1}`))
+	assert.Equal(t, `[]`, patch(`{"a":1}`, `{"a":1}`))
+	assert.Equal(t,
+		`[{"op":"remove","path":"/a"},{"op":"replace","path":"/b~1c/0","value":null},{"op":"add","path":"/b~1c/-","value":3},{"op":"add","path":"/d","value":false}]`,
+		patch(`{"a":1,"b/c":[1]}`, `{"b/c":[null,3],"d":false}`))
+	assert.Equal(t, `[{"op":"remove","path":"/2"},{"op":"remove","path":"/1"}]`, patch(`[1,2,3]`, `[1]`))
+
+	_, err := diff.JSONPatch(nil, []byte("nope"))
+	assert.Error(t, err)
+}
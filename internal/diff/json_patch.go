@@ -0,0 +1,158 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package diff
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// PatchOp is a single RFC 6902 JSON Patch operation.
+type PatchOp struct {
+	Op    string           `json:"op"`
+	Path  string           `json:"path"`
+	Value *json.RawMessage `json:"value,omitempty"`
+}
+
+// JSONPatch returns the JSON Patch operations that turn the prev document into
+// the cur one.  An empty prev is treated as no document, in which case the
+// patch adds cur as a whole.
+func JSONPatch(prev, cur []byte) ([]PatchOp, error) {
+	var curVal interface{}
+	if err := json.Unmarshal(cur, &curVal); err != nil {
+		return nil, fmt.Errorf("invalid current document: %v", err)
+	}
+	if len(strings.TrimSpace(string(prev))) == 0 {
+		op, err := valueOp("add", "", curVal)
+		if err != nil {
+			return nil, err
+		}
+		return []PatchOp{op}, nil
+	}
+	var prevVal interface{}
+	if err := json.Unmarshal(prev, &prevVal); err != nil {
+		return nil, fmt.Errorf("invalid previous document: %v", err)
+	}
+
+	ops := []PatchOp{}
+	if err := diffValues(&ops, "", prevVal, curVal); err != nil {
+		return nil, err
+	}
+	return ops, nil
+}
+
+func diffValues(ops *[]PatchOp, path string, a, b interface{}) error {
+	switch av := a.(type) {
+	case map[string]interface{}:
+		if bv, ok := b.(map[string]interface{}); ok {
+			return diffObjects(ops, path, av, bv)
+		}
+	case []interface{}:
+		if bv, ok := b.([]interface{}); ok {
+			return diffArrays(ops, path, av, bv)
+		}
+	}
+	if reflect.DeepEqual(a, b) {
+		return nil
+	}
+	op, err := valueOp("replace", path, b)
+	if err != nil {
+		return err
+	}
+	*ops = append(*ops, op)
+	return nil
+}
+
+func diffObjects(ops *[]PatchOp, path string, a, b map[string]interface{}) error {
+	keys := make([]string, 0, len(a)+len(b))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		keyPath := path + "/" + escapePointer(key)
+		av, inA := a[key]
+		bv, inB := b[key]
+		switch {
+		case !inB:
+			*ops = append(*ops, PatchOp{Op: "remove", Path: keyPath})
+		case !inA:
+			op, err := valueOp("add", keyPath, bv)
+			if err != nil {
+				return err
+			}
+			*ops = append(*ops, op)
+		default:
+			if err := diffValues(ops, keyPath, av, bv); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func diffArrays(ops *[]PatchOp, path string, a, b []interface{}) error {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	for i := 0; i < n; i++ {
+		if err := diffValues(ops, fmt.Sprintf("%s/%d", path, i), a[i], b[i]); err != nil {
+			return err
+		}
+	}
+	for i := n; i < len(b); i++ {
+		op, err := valueOp("add", path+"/-", b[i])
+		if err != nil {
+			return err
+		}
+		*ops = append(*ops, op)
+	}
+	// remove from the end so that earlier indices stay valid
+	for i := len(a) - 1; i >= n; i-- {
+		*ops = append(*ops, PatchOp{Op: "remove", Path: fmt.Sprintf("%s/%d", path, i)})
+	}
+	return nil
+}
+
+func valueOp(op, path string, val interface{}) (PatchOp, error) {
+	buf, err := json.Marshal(val)
+	if err != nil {
+		return PatchOp{}, err
+	}
+	raw := json.RawMessage(buf)
+	return PatchOp{Op: op, Path: path, Value: &raw}, nil
+}
+
+var pointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
+func escapePointer(key string) string {
+	return pointerEscaper.Replace(key)
+}
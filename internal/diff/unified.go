@@ -0,0 +1,231 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package diff
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// contextLines is how many unchanged lines surround each hunk.
+const contextLines = 3
+
+// maxLCSCells bounds the size of the table used to find the longest common
+// subsequence of changed lines; past it, the whole changed region is simply
+// replaced.
+const maxLCSCells = 1 << 22
+
+type editKind int
+
+const (
+	editEqual editKind = iota
+	editDelete
+	editInsert
+)
+
+type edit struct {
+	kind editKind
+	line string
+}
+
+// Unified returns a unified diff between two texts, or nil if they're equal.
+func Unified(prevName, curName string, prev, cur []byte) []byte {
+	if bytes.Equal(prev, cur) {
+		return nil
+	}
+	edits := lineEdits(splitLines(prev), splitLines(cur))
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", prevName, curName)
+
+	// walk the edits, emitting a hunk for every run of changes, merging runs
+	// separated by no more than twice the context
+	prevLine, curLine := 1, 1
+	for i := 0; i < len(edits); {
+		if edits[i].kind == editEqual {
+			i++
+			prevLine++
+			curLine++
+			continue
+		}
+
+		start := i - contextLines
+		if start < 0 {
+			start = 0
+		}
+		end := i
+		for end < len(edits) {
+			if edits[end].kind != editEqual {
+				end++
+				continue
+			}
+			run := end
+			for run < len(edits) && edits[run].kind == editEqual {
+				run++
+			}
+			if run == len(edits) || run-end > 2*contextLines {
+				end += minInt(run-end, contextLines)
+				break
+			}
+			end = run
+		}
+
+		hunkPrev, hunkCur := prevLine-(i-start), curLine-(i-start)
+		var nPrev, nCur int
+		var body bytes.Buffer
+		for _, e := range edits[start:end] {
+			switch e.kind {
+			case editEqual:
+				body.WriteString(" ")
+				nPrev++
+				nCur++
+			case editDelete:
+				body.WriteString("-")
+				nPrev++
+			case editInsert:
+				body.WriteString("+")
+				nCur++
+			}
+			body.WriteString(e.line)
+			body.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "@@ -%s +%s @@\n", hunkRange(hunkPrev, nPrev), hunkRange(hunkCur, nCur))
+		body.WriteTo(&buf)
+
+		for _, e := range edits[i:end] {
+			if e.kind != editInsert {
+				prevLine++
+			}
+			if e.kind != editDelete {
+				curLine++
+			}
+		}
+		i = end
+	}
+	return buf.Bytes()
+}
+
+func hunkRange(start, n int) string {
+	if n == 0 {
+		return fmt.Sprintf("%d,0", start-1)
+	}
+	if n == 1 {
+		return fmt.Sprintf("%d", start)
+	}
+	return fmt.Sprintf("%d,%d", start, n)
+}
+
+func splitLines(buf []byte) []string {
+	if len(buf) == 0 {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(string(buf), "\n"), "\n")
+}
+
+// lineEdits returns a minimal edit script turning a into b; common prefix and
+// suffix lines are trimmed before solving for the rest.
+func lineEdits(a, b []string) []edit {
+	var pre, suf int
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+
+	edits := make([]edit, 0, len(a)+len(b))
+	for _, line := range a[:pre] {
+		edits = append(edits, edit{editEqual, line})
+	}
+	edits = append(edits, lcsEdits(a[pre:len(a)-suf], b[pre:len(b)-suf])...)
+	for _, line := range a[len(a)-suf:] {
+		edits = append(edits, edit{editEqual, line})
+	}
+	return edits
+}
+
+func lcsEdits(a, b []string) []edit {
+	n, m := len(a), len(b)
+	var edits []edit
+	if (n+1)*(m+1) > maxLCSCells {
+		for _, line := range a {
+			edits = append(edits, edit{editDelete, line})
+		}
+		for _, line := range b {
+			edits = append(edits, edit{editInsert, line})
+		}
+		return edits
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of a[i:] and
+	// b[j:]
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = maxInt(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			edits = append(edits, edit{editEqual, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			edits = append(edits, edit{editDelete, a[i]})
+			i++
+		default:
+			edits = append(edits, edit{editInsert, b[j]})
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		edits = append(edits, edit{editDelete, a[i]})
+	}
+	for ; j < m; j++ {
+		edits = append(edits, edit{editInsert, b[j]})
+	}
+	return edits
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,130 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package marshaled
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/uber-go/gwr/source"
+)
+
+// maxMarshalFailures is how many consecutive items a format may fail to
+// marshal before it's disabled for the source.
+var maxMarshalFailures = 10
+
+// trippedCooldown is how long a format stays disabled; watches for it are
+// refused until then.
+var trippedCooldown = time.Minute
+
+// marshalFailed records a failure to marshal an item, which the caller
+// replaces with a fallbackFrame; once maxMarshalFailures pile up in a row,
+// the format is tripped: every watcher is sent a final error frame and
+// closed.  It returns false once tripped.  It
+// assumes that the marshaledWatcher lock is being held by the caller.
+func (mw *marshaledWatcher) marshalFailed(err error) bool {
+	mw.source.stats.marshalError()
+	mw.failures++
+	if mw.failures == 1 {
+		log.Printf("item marshaling error %v", err)
+	}
+	if mw.failures < maxMarshalFailures {
+		return true
+	}
+
+	now := time.Now()
+	te := &source.TrippedError{
+		Source:   mw.dfw.name,
+		Format:   mw.name,
+		Failures: mw.failures,
+		Err:      err.Error(),
+		Time:     now,
+		Until:    now.Add(trippedCooldown),
+	}
+	log.Printf("%v", te)
+	mw.trippedLock.Lock()
+	mw.tripped = te
+	mw.trippedLock.Unlock()
+	mw.failures = 0
+
+	frame := mw.errorFrame(te)
+	for _, iw := range mw.watchers {
+		iw.HandleItem(frame)
+	}
+	mw.closeLocked()
+	return false
+}
+
+// errorFrame marshals a TrippedError for the format's watchers: as an
+// {"error": ...} object for json, or a plain line otherwise, since the
+// format itself can't be trusted.
+func (mw *marshaledWatcher) errorFrame(te *source.TrippedError) []byte {
+	if mw.name == "json" {
+		if buf, err := json.Marshal(map[string]*source.TrippedError{"error": te}); err == nil {
+			return buf
+		}
+	}
+	return []byte("error: " + te.Error())
+}
+
+// fallbackFrame stands in for an item that the format failed to marshal, so
+// that one bad item doesn't end a watch, but isn't silently lost either: as
+// a {"gwr_error": ...} object for json, or a plain line otherwise.
+func (mw *marshaledWatcher) fallbackFrame(item interface{}) []byte {
+	typ := fmt.Sprintf("%T", item)
+	if mw.name == "json" {
+		if buf, err := json.Marshal(map[string]string{
+			"gwr_error": "marshal failed",
+			"type":      typ,
+		}); err == nil {
+			return buf
+		}
+	}
+	return []byte("error: marshal failed for " + typ)
+}
+
+// checkTripped returns source.ErrFormatTripped if the format is still
+// disabled, otherwise it re-enables it.
+func (mw *marshaledWatcher) checkTripped() error {
+	mw.trippedLock.Lock()
+	defer mw.trippedLock.Unlock()
+	if mw.tripped == nil {
+		return nil
+	}
+	if time.Now().Before(mw.tripped.Until) {
+		return source.ErrFormatTripped
+	}
+	mw.tripped = nil
+	return nil
+}
+
+// trippedError returns the TrippedError for the format if it's still
+// disabled, or nil.
+func (mw *marshaledWatcher) trippedError() *source.TrippedError {
+	mw.trippedLock.Lock()
+	defer mw.trippedLock.Unlock()
+	if mw.tripped != nil && time.Now().Before(mw.tripped.Until) {
+		return mw.tripped
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package marshaled
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// HTMLMarshal renders data as an html fragment: objects become tables, arrays
+// become ordered lists, and everything else is escaped text.  Data is first
+// passed through the standard json module, so json struct tags determine what
+// is shown.  Each fragment is written on a single line, so that watch streams
+// are line-delimited like json.
+var HTMLMarshal = htmlMarshal(0)
+
+type htmlMarshal int
+
+// MarshalGet renders data as an html fragment.
+func (x htmlMarshal) MarshalGet(data interface{}) ([]byte, error) {
+	return marshalHTML(data)
+}
+
+// MarshalInit renders data as an html fragment.
+func (x htmlMarshal) MarshalInit(data interface{}) ([]byte, error) {
+	return marshalHTML(data)
+}
+
+// MarshalItem renders data as an html fragment.
+func (x htmlMarshal) MarshalItem(data interface{}) ([]byte, error) {
+	return marshalHTML(data)
+}
+
+// FrameItem appends the newline record delimiter
+func (x htmlMarshal) FrameItem(buf []byte) ([]byte, error) {
+	return LDJSONMarshal.FrameItem(buf)
+}
+
+// AppendFrame appends the item and the newline record delimiter to dst.
+func (x htmlMarshal) AppendFrame(dst, item []byte) ([]byte, error) {
+	return LDJSONMarshal.AppendFrame(dst, item)
+}
+
+func marshalHTML(data interface{}) ([]byte, error) {
+	buf, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	var val interface{}
+	if err := dec.Decode(&val); err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	writeHTML(&out, val)
+	return out.Bytes(), nil
+}
+
+// htmlText escapes a string, keeping it on one line.
+var htmlText = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	`"`, "&#34;",
+	"'", "&#39;",
+	"\r", "&#13;",
+	"\n", "&#10;",
+)
+
+func writeHTML(out *bytes.Buffer, val interface{}) {
+	switch v := val.(type) {
+	case nil:
+		out.WriteString(`<span class="null">null</span>`)
+
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		out.WriteString(`<table class="object">`)
+		for _, key := range keys {
+			out.WriteString("<tr><th>")
+			htmlText.WriteString(out, key)
+			out.WriteString("</th><td>")
+			writeHTML(out, v[key])
+			out.WriteString("</td></tr>")
+		}
+		out.WriteString("</table>")
+
+	case []interface{}:
+		out.WriteString(`<ol class="array">`)
+		for _, elem := range v {
+			out.WriteString("<li>")
+			writeHTML(out, elem)
+			out.WriteString("</li>")
+		}
+		out.WriteString("</ol>")
+
+	case string:
+		htmlText.WriteString(out, v)
+
+	case json.Number:
+		out.WriteString(`<span class="number">`)
+		out.WriteString(v.String())
+		out.WriteString("</span>")
+
+	case bool:
+		if v {
+			out.WriteString(`<span class="bool">true</span>`)
+		} else {
+			out.WriteString(`<span class="bool">false</span>`)
+		}
+	}
+}
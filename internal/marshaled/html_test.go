@@ -0,0 +1,64 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package marshaled_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/uber-go/gwr/internal/marshaled"
+)
+
+func TestHTMLMarshal(t *testing.T) {
+	for _, tc := range []struct {
+		data interface{}
+		html string
+	}{
+		{nil, `<span class="null">null</span>`},
+		{"<b>\nhi</b>", `&lt;b&gt;&#10;hi&lt;/b&gt;`},
+		{42, `<span class="number">42</span>`},
+		{true, `<span class="bool">true</span>`},
+		{[]string{"a", "b"}, `<ol class="array"><li>a</li><li>b</li></ol>`},
+		{
+			map[string]interface{}{"z": 1, "a": []int{}},
+			`<table class="object">` +
+				`<tr><th>a</th><td><ol class="array"></ol></td></tr>` +
+				`<tr><th>z</th><td><span class="number">1</span></td></tr>` +
+				`</table>`,
+		},
+		{
+			struct {
+				Name string `json:"name"`
+			}{"x"},
+			`<table class="object"><tr><th>name</th><td>x</td></tr></table>`,
+		},
+	} {
+		buf, err := marshaled.HTMLMarshal.MarshalItem(tc.data)
+		if assert.NoError(t, err, "no marshal error for %#v", tc.data) {
+			assert.Equal(t, tc.html, string(buf), "html for %#v", tc.data)
+		}
+	}
+
+	buf, err := marshaled.HTMLMarshal.FrameItem([]byte("<p>"))
+	assert.NoError(t, err)
+	assert.Equal(t, "<p>\n", string(buf), "items are line-delimited")
+}
@@ -20,15 +20,49 @@
 
 package marshaled
 
-import "encoding/json"
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strconv"
 
-// LDJSONMarshal is the usual Line-Delimited JSON
+	"github.com/uber-go/gwr/source"
+)
+
+// LDJSONMarshal is the usual Line-Delimited JSON; with a "pretty" parameter,
+// as in "json;pretty=1", gets are indented, while watched items stay one per
+// line.
 var LDJSONMarshal = ldJSONMarshal(0)
 
+// ldJSONMarshal is non-zero if it's pretty.
 type ldJSONMarshal int
 
+// Params returns the "pretty" parameter.
+func (x ldJSONMarshal) Params() []string {
+	return []string{"pretty"}
+}
+
+// WithParams returns the format, pretty if the "pretty" parameter is true.
+func (x ldJSONMarshal) WithParams(params map[string]string) (source.GenericDataFormat, error) {
+	pretty, err := strconv.ParseBool(params["pretty"])
+	if err != nil {
+		return nil, source.ErrInvalidParam
+	}
+	if pretty {
+		return ldJSONMarshal(1), nil
+	}
+	return ldJSONMarshal(0), nil
+}
+
 // MarshalGet marhshals data through the standard json module.
 func (x ldJSONMarshal) MarshalGet(data interface{}) ([]byte, error) {
+	if x != 0 {
+		buf, err := json.MarshalIndent(data, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(buf, '\n'), nil
+	}
 	return json.Marshal(data)
 }
 
@@ -39,14 +73,39 @@ func (x ldJSONMarshal) MarshalInit(data interface{}) ([]byte, error) {
 
 // MarshalItem marhshals data through the standard json module.
 func (x ldJSONMarshal) MarshalItem(data interface{}) ([]byte, error) {
-	return json.Marshal(data)
+	var buf bytes.Buffer
+	if err := x.MarshalItemTo(&buf, data); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// MarshalItemTo encodes data straight into the writer, without the copy that
+// json.Marshal makes, trimming the newline that the encoder adds when the
+// writer is a buffer; items stay one per line even if pretty.
+func (x ldJSONMarshal) MarshalItemTo(w io.Writer, data interface{}) error {
+	buf, ok := w.(*bytes.Buffer)
+	if !ok {
+		item, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(item)
+		return err
+	}
+	if err := json.NewEncoder(buf).Encode(data); err != nil {
+		return err
+	}
+	buf.Truncate(buf.Len() - 1)
+	return nil
 }
 
 // FrameItem appends the newline record delimiter
 func (x ldJSONMarshal) FrameItem(json []byte) ([]byte, error) {
-	n := len(json)
-	frame := make([]byte, n+1)
-	copy(frame, json)
-	frame[n] = '\n'
-	return frame, nil
+	return x.AppendFrame(make([]byte, 0, len(json)+1), json)
+}
+
+// AppendFrame appends the item and the newline record delimiter to dst.
+func (x ldJSONMarshal) AppendFrame(dst, json []byte) ([]byte, error) {
+	return append(append(dst, json...), '\n'), nil
 }
@@ -0,0 +1,94 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+package marshaled_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber-go/gwr/internal/marshaled"
+	"github.com/uber-go/gwr/source"
+)
+
+type jsonItem struct {
+	Name  string   `json:"name"`
+	Count int      `json:"count"`
+	Tags  []string `json:"tags"`
+}
+
+func TestLDJSONMarshal_MarshalItemTo(t *testing.T) {
+	item := jsonItem{Name: "<a&b>", Count: 3, Tags: []string{"x", "y"}}
+	expected, err := json.Marshal(item)
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	buf.WriteString("prior;")
+	require.NoError(t, marshaled.LDJSONMarshal.MarshalItemTo(&buf, item))
+	assert.Equal(t, "prior;"+string(expected), buf.String(), "appended unframed, like json.Marshal")
+
+	data, err := marshaled.LDJSONMarshal.MarshalItem(item)
+	require.NoError(t, err)
+	assert.Equal(t, expected, data)
+
+	var sb bytes.Buffer
+	require.NoError(t, marshaled.LDJSONMarshal.MarshalItemTo(struct{ *bytes.Buffer }{&sb}, item))
+	assert.Equal(t, string(expected), sb.String(), "any writer")
+
+	buf.Reset()
+	assert.Error(t, marshaled.LDJSONMarshal.MarshalItemTo(&buf, func() {}))
+	assert.Equal(t, 0, buf.Len(), "nothing written on error")
+}
+
+func TestLDJSONMarshal_allocs(t *testing.T) {
+	// boxed once, as items are by the time a format sees them
+	var item interface{} = jsonItem{Name: "item", Count: 3, Tags: []string{"x", "y"}}
+	var (
+		buf   bytes.Buffer
+		frame []byte
+	)
+	framing := func(sf source.GenericDataStreamFormat) func() {
+		af := sf.(source.GenericDataAppendFormat)
+		return func() {
+			buf.Reset()
+			if err := sf.MarshalItemTo(&buf, item); err != nil {
+				panic(err)
+			}
+			frame, _ = af.AppendFrame(frame[:0], buf.Bytes())
+		}
+	}
+	copying := func() {
+		data, _ := marshaled.LDJSONMarshal.MarshalItem(item)
+		frame, _ = marshaled.LDJSONMarshal.FrameItem(data)
+	}
+
+	framing(marshaled.LDJSONMarshal)()
+	assert.Equal(t, "{\"name\":\"item\",\"count\":3,\"tags\":[\"x\",\"y\"]}\n", string(frame))
+	reused := testing.AllocsPerRun(100, framing(marshaled.LDJSONMarshal))
+	copied := testing.AllocsPerRun(100, copying)
+	t.Logf("allocs per item: %v reusing buffers, %v copying", reused, copied)
+	if !raceEnabled {
+		assert.True(t, reused <= 1, "expected at most the encoder allocated per item, got %v", reused)
+	}
+	assert.True(t, reused < copied, "expected fewer allocations than MarshalItem and FrameItem")
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package marshaled
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uber-go/gwr/source"
+)
+
+// Limits bound how many items, and batches of items, a DataSource queues for
+// its watchers, and how long a QoSStandard source waits on a full queue before
+// deactivating rather than blocking its caller; QoSCritical sources wait a
+// thousand times as long.  Rate bounds the items, and
+// marshaled bytes, that it emits per second in each format; items over it are
+// dropped.  Sample, if between 0 and 1, is the fraction of items kept, chosen
+// at random; the rest are dropped too.
+type Limits struct {
+	MaxItems   int
+	MaxBatches int
+	MaxWait    time.Duration
+	Rate       source.RateLimit
+	Sample     float64
+}
+
+var (
+	defaultLimits atomic.Value
+	sourceLimits  atomic.Value
+
+	// sourceLimitsLock serializes SetSourceLimits' copy on write.
+	sourceLimitsLock sync.Mutex
+
+	// limitsGen counts changes to the limits, so that active sources can
+	// tell when to pick them up.
+	limitsGen uint64
+)
+
+func init() {
+	defaultLimits.Store(Limits{
+		MaxItems:   100,
+		MaxBatches: 100,
+		MaxWait:    100 * time.Microsecond,
+	})
+	sourceLimits.Store(map[string]Limits(nil))
+}
+
+// DefaultLimits returns the limits used by DataSources that don't set their
+// own.
+func DefaultLimits() Limits {
+	return defaultLimits.Load().(Limits)
+}
+
+// SetDefaultLimits changes the limits used by DataSources that don't set their
+// own, including those already created; any zero field is left unchanged.
+// Queue sizes take effect on each source's next activation, and the rest
+// immediately.
+func SetDefaultLimits(lim Limits) {
+	defaultLimits.Store(DefaultLimits().merge(lim))
+	atomic.AddUint64(&limitsGen, 1)
+}
+
+// SetSourceLimits sets the limits of the DataSource with the given name,
+// whether or not it's been created yet, overriding both the defaults and any
+// options that it was created with; any zero field is left to those, and zero
+// Limits remove them.  They take effect as SetDefaultLimits' do.
+func SetSourceLimits(name string, lim Limits) {
+	sourceLimitsLock.Lock()
+	defer sourceLimitsLock.Unlock()
+	cur := sourceLimits.Load().(map[string]Limits)
+	next := make(map[string]Limits, len(cur)+1)
+	for n, l := range cur {
+		next[n] = l
+	}
+	if lim == (Limits{}) {
+		delete(next, name)
+	} else {
+		next[name] = lim
+	}
+	sourceLimits.Store(next)
+	atomic.AddUint64(&limitsGen, 1)
+}
+
+// SourceLimits returns the limits set by SetSourceLimits, by source name.
+func SourceLimits() map[string]Limits {
+	cur := sourceLimits.Load().(map[string]Limits)
+	limits := make(map[string]Limits, len(cur))
+	for name, lim := range cur {
+		limits[name] = lim
+	}
+	return limits
+}
+
+// merge returns the limits with any non-zero fields of over replacing
+// theirs.
+func (lim Limits) merge(over Limits) Limits {
+	if over.MaxItems > 0 {
+		lim.MaxItems = over.MaxItems
+	}
+	if over.MaxBatches > 0 {
+		lim.MaxBatches = over.MaxBatches
+	}
+	if over.MaxWait > 0 {
+		lim.MaxWait = over.MaxWait
+	}
+	if over.Rate.Items > 0 {
+		lim.Rate.Items = over.Rate.Items
+	}
+	if over.Rate.Bytes > 0 {
+		lim.Rate.Bytes = over.Rate.Bytes
+	}
+	if over.Sample > 0 {
+		lim.Sample = over.Sample
+	}
+	return lim
+}
+
+// limits returns the source's limits: any set for its name by
+// SetSourceLimits, then any that it was created with, and then the defaults.
+func (mds *DataSource) limits() Limits {
+	lim := DefaultLimits().merge(Limits{
+		MaxItems:   mds.maxItems,
+		MaxBatches: mds.maxBatches,
+		MaxWait:    mds.maxWait,
+		Rate:       mds.rate,
+	})
+	if over, ok := sourceLimits.Load().(map[string]Limits)[mds.source.Name()]; ok {
+		lim = lim.merge(over)
+	}
+	return lim
+}
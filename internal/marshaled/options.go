@@ -18,59 +18,40 @@
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
 // THE SOFTWARE.
 
-package main
+package marshaled
 
 import (
-	"net/http"
-	"net/http/httptest"
-	"text/template"
+	"time"
 
 	"github.com/uber-go/gwr/source"
 )
 
-type resLogger struct {
-	handler http.Handler
-	watcher source.GenericDataWatcher
-}
-
-type resInfo struct {
-	Code        int    `json:"code"`
-	Bytes       int    `json:"bytes"`
-	ContentType string `json:"content_type"`
-}
-
-var resLogTextTemplate = template.Must(template.New("res_logger_text").Parse(`
-{{ define "item" }}{{ .Code }} {{ .Bytes }} {{ .ContentType }}{{ end }}
-`))
-
-func (rl *resLogger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	rl.watcher.Active()
-
-	rec := httptest.NewRecorder()
-	rl.handler.ServeHTTP(rec, r)
+// Option configures a DataSource created by NewDataSource.
+type Option func(*DataSource)
 
-	rl.watcher.HandleItem(resInfo{
-		Code:        rec.Code,
-		Bytes:       rec.Body.Len(),
-		ContentType: rec.HeaderMap.Get("Content-Type"),
-	})
-
-	hdr := w.Header()
-	for key, vals := range rec.HeaderMap {
-		hdr[key] = vals
+// WithBufferSizes sets how many items, and batches of items, the DataSource
+// queues for its watchers, overriding the DefaultLimits; either may be zero to
+// keep the default.
+func WithBufferSizes(maxItems, maxBatches int) Option {
+	return func(mds *DataSource) {
+		mds.maxItems = maxItems
+		mds.maxBatches = maxBatches
 	}
-	w.WriteHeader(rec.Code)
-	rec.Body.WriteTo(w)
-}
-
-func (rl *resLogger) Name() string {
-	return "/response_log"
 }
 
-func (rl *resLogger) TextTemplate() *template.Template {
-	return resLogTextTemplate
+// WithMaxWait sets how long a QoSStandard DataSource waits on a full queue
+// before deactivating, overriding the DefaultLimits; zero keeps the default.
+func WithMaxWait(maxWait time.Duration) Option {
+	return func(mds *DataSource) {
+		mds.maxWait = maxWait
+	}
 }
 
-func (rl *resLogger) SetWatcher(watcher source.GenericDataWatcher) {
-	rl.watcher = watcher
+// WithRateLimit sets how many items, and marshaled bytes, the DataSource emits
+// per second in each format, overriding the DefaultLimits; either may be zero
+// to keep the default.
+func WithRateLimit(rate source.RateLimit) Option {
+	return func(mds *DataSource) {
+		mds.rate = rate
+	}
 }
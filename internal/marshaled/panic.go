@@ -18,55 +18,47 @@
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
 // THE SOFTWARE.
 
-package main
+package marshaled
 
 import (
-	"net/http"
-	"text/template"
+	"log"
+	"runtime/debug"
+	"sync"
 
 	"github.com/uber-go/gwr/source"
 )
 
-type reqLogger struct {
-	handler http.Handler
-	watcher source.GenericDataWatcher
-}
-
-func logged(handler http.Handler) *reqLogger {
-	return &reqLogger{
-		handler: handler,
-	}
-}
-
-var reqLogTextTemplate = template.Must(template.New("req_logger_text").Parse(`
-{{ define "item" }}{{ .Method }} {{ .Path }} {{ .Query }}{{ end }}
-`))
+var (
+	panicObsLock sync.RWMutex
+	panicObs     func(*source.PanicError)
+)
 
-type reqInfo struct {
-	Method string `json:"method"`
-	Path   string `json:"path"`
-	Query  string `json:"query"`
+// SetPanicObserver sets the (single!) function that gets notified of every
+// panic recovered from user-provided source code; if nil is passed,
+// observation is disabled.
+func SetPanicObserver(obs func(*source.PanicError)) {
+	panicObsLock.Lock()
+	panicObs = obs
+	panicObsLock.Unlock()
 }
 
-func (rl *reqLogger) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	if watcher := rl.watcher; watcher.Active() {
-		watcher.HandleItem(reqInfo{
-			Method: r.Method,
-			Path:   r.URL.Path,
-			Query:  r.URL.RawQuery,
-		})
+// recoverPanic must be deferred directly around any call into user-provided
+// source code.  Any recovered panic is converted into a *source.PanicError,
+// stored into errp (if non-nil), and passed to any panic observer.
+func recoverPanic(name, op string, errp *error) {
+	val := recover()
+	if val == nil {
+		return
+	}
+	pe := source.NewPanicError(name, op, val, debug.Stack())
+	log.Printf("recovered %v", pe)
+	if errp != nil {
+		*errp = pe
+	}
+	panicObsLock.RLock()
+	obs := panicObs
+	panicObsLock.RUnlock()
+	if obs != nil {
+		obs(pe)
 	}
-	rl.handler.ServeHTTP(w, r)
-}
-
-func (rl *reqLogger) Name() string {
-	return "/request_log"
-}
-
-func (rl *reqLogger) TextTemplate() *template.Template {
-	return reqLogTextTemplate
-}
-
-func (rl *reqLogger) SetWatcher(watcher source.GenericDataWatcher) {
-	rl.watcher = watcher
 }
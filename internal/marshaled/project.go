@@ -0,0 +1,123 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package marshaled
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/uber-go/gwr/source"
+)
+
+// fieldsParam is the parameter, taken with any format, that projects items
+// down to some of their fields; see parseProjection.
+const fieldsParam = "fields"
+
+// projection selects fields of items before they're marshaled, by their json
+// paths.  Paths run through arrays, applying to each of their elements, so
+// that "spans.name" selects the name of every span.
+type projection struct {
+	paths [][]string
+}
+
+// parseProjection parses a comma separated list of field paths, each a
+// JSONPath like "$.args.user", or just "args.user"; a "*" segment matches
+// every field of an object, and "[*]" may follow a segment for clarity, but
+// other subscripts aren't supported.
+func parseProjection(fields string) (*projection, error) {
+	var pr projection
+	for _, field := range strings.Split(fields, ",") {
+		field = strings.TrimSpace(field)
+		field = strings.TrimPrefix(strings.TrimPrefix(field, "$"), ".")
+		if field == "" {
+			return nil, source.ErrInvalidParam
+		}
+		path := strings.Split(strings.Replace(field, "[*]", "", -1), ".")
+		for _, seg := range path {
+			if seg == "" || strings.ContainsAny(seg, "[]") {
+				return nil, source.ErrInvalidParam
+			}
+		}
+		pr.paths = append(pr.paths, path)
+	}
+	return &pr, nil
+}
+
+// apply returns the fields of the item selected by the projection, as they
+// would be marshaled to json; items that can't be marshaled are returned as
+// is, for the format to fail on.
+func (pr *projection) apply(item interface{}) interface{} {
+	buf, err := json.Marshal(item)
+	if err != nil {
+		return item
+	}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	var val interface{}
+	if err := dec.Decode(&val); err != nil {
+		return item
+	}
+	if projected, ok := project(val, pr.paths); ok {
+		return projected
+	}
+	return map[string]interface{}{}
+}
+
+// project returns the parts of val selected by paths, if any are.
+func project(val interface{}, paths [][]string) (interface{}, bool) {
+	for _, path := range paths {
+		if len(path) == 0 {
+			return val, true
+		}
+	}
+
+	switch v := val.(type) {
+	case []interface{}:
+		out := make([]interface{}, 0, len(v))
+		for _, elem := range v {
+			if projected, ok := project(elem, paths); ok {
+				out = append(out, projected)
+			}
+		}
+		return out, len(out) > 0
+
+	case map[string]interface{}:
+		rests := make(map[string][][]string)
+		for _, path := range paths {
+			if path[0] == "*" {
+				for key := range v {
+					rests[key] = append(rests[key], path[1:])
+				}
+			} else if _, ok := v[path[0]]; ok {
+				rests[path[0]] = append(rests[path[0]], path[1:])
+			}
+		}
+		out := make(map[string]interface{}, len(rests))
+		for key, rest := range rests {
+			if projected, ok := project(v[key], rest); ok {
+				out[key] = projected
+			}
+		}
+		return out, len(out) > 0
+	}
+	return nil, false
+}
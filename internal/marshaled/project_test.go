@@ -0,0 +1,104 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package marshaled_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber-go/gwr/internal/marshaled"
+	"github.com/uber-go/gwr/source"
+)
+
+type spanItem struct {
+	Name  string            `json:"name"`
+	Args  map[string]string `json:"args"`
+	Spans []tableItem       `json:"spans"`
+}
+
+func TestDataSource_Get_fields(t *testing.T) {
+	mds := marshaled.NewDataSource(&emptySource{
+		data: spanItem{
+			Name: "req",
+			Args: map[string]string{"user": "bob", "id": "7"},
+			Spans: []tableItem{
+				{"GET", "/a", 200},
+				{"POST", "/b", 201},
+			},
+		},
+	}, nil)
+	for _, tc := range []struct {
+		format string
+		fields string
+		err    error
+		out    string
+	}{
+		{"json", "name", nil, `{"name":"req"}`},
+		{"json", "$.args.user, name", nil, `{"args":{"user":"bob"},"name":"req"}`},
+		{"json", "spans[*].code", nil, `{"spans":[{"code":200},{"code":201}]}`},
+		{"json", "args.*", nil, `{"args":{"id":"7","user":"bob"}}`},
+		{"json", "nope", nil, `{}`},
+		{"json;fields=spans.method", "", nil, `{"spans":[{"method":"GET"},{"method":"POST"}]}`},
+		{"json;fields=name", "args", nil, `{"name":"req"}`},
+		{"json", "spans[0]", source.ErrInvalidParam, ""},
+		{"json", "name,", source.ErrInvalidParam, ""},
+		{"json", "a..b", source.ErrInvalidParam, ""},
+	} {
+		var params map[string]string
+		if tc.fields != "" {
+			params = map[string]string{"fields": tc.fields}
+		}
+		var buf bytes.Buffer
+		assert.Equal(t, tc.err, mds.GetParams(tc.format, params, &buf), "fields %q", tc.fields)
+		assert.Equal(t, tc.out, buf.String(), "format %q fields %q", tc.format, tc.fields)
+	}
+}
+
+func TestDataSource_Watch_fields(t *testing.T) {
+	tds := &testDataSource{activated: make(chan struct{}, 1)}
+	mds := marshaled.NewDataSource(tds, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.Equal(t, source.ErrInvalidParam, mds.WatchContext(
+		source.WithFormatParams(ctx, map[string]string{"fields": "$."}),
+		"json", &bytes.Buffer{}), "invalid fields")
+
+	var codes, paths, table bytes.Buffer
+	require.NoError(t, mds.WatchContext(
+		source.WithFormatParams(ctx, map[string]string{"fields": "code"}),
+		"json", &codes))
+	require.NoError(t, mds.WatchContext(
+		source.WithFormatParams(ctx, map[string]string{"fields": "path,method"}),
+		"json", &paths))
+	require.NoError(t, mds.Watch("table;fields=code,path", &table))
+	assert.Equal(t, 2, mds.Stats().FormatWatchers["json"], "variants counted under their format")
+
+	tds.emit(tableItem{"GET", "/a", 200})
+	mds.Drain()
+	assert.Equal(t, "{\"code\":200}\n", codes.String())
+	assert.Equal(t, "{\"method\":\"GET\",\"path\":\"/a\"}\n", paths.String())
+	assert.Equal(t, "200        /a\n", table.String(), "table of the projected fields")
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package marshaled
+
+import (
+	"bytes"
+
+	"github.com/uber-go/gwr/source"
+)
+
+// SampleFormats implements SamplingDataSource by marshaling and framing the
+// wrapped source's sample item in every format; only sources implementing
+// SampleItemDataSource, such as source.Buffered, have a sample.
+func (mds *DataSource) SampleFormats() (map[string][]byte, error) {
+	sampler, ok := mds.source.(source.SampleItemDataSource)
+	if !ok {
+		return nil, source.ErrNoSample
+	}
+	item, ok := sampler.SampleItem()
+	if !ok {
+		return nil, source.ErrNoSample
+	}
+
+	samples := make(map[string][]byte, len(mds.watchers))
+	var buf bytes.Buffer
+	for name, mw := range mds.watchers {
+		data, _, err := mw.marshalItem(&buf, item)
+		if err != nil {
+			return nil, err
+		}
+		framed, err := mw.dfw.frameItem(data)
+		if err != nil {
+			return nil, err
+		}
+		// the framed item may still alias buf, which is reused for the next
+		// format
+		samples[name] = append([]byte(nil), framed...)
+	}
+	return samples, nil
+}
@@ -21,22 +21,25 @@
 package marshaled
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
+	"math/rand"
+	"reflect"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/uber-go/gwr/source"
 )
 
 // NOTE: This approach is perhaps overfit to the json module's marshalling
-// mindset.  A better interface (for performance) would work by passing a
-// writer to the specific encoder, rather than a []byte-returning Marshal
-// function.  This would be possible perhaps using something like
-// io.MultiWriter.
+// mindset.  Formats may implement source.GenericDataStreamFormat to marshal
+// items into a pooled buffer rather than returning a new []byte for each one;
+// all other formats fall back to the []byte-returning Marshal functions.
 
 // DataSource wraps a format-agnostic data source and provides one or
 // more formats for it.
@@ -46,26 +49,121 @@ import (
 // - ItemDataSource so that higher level protocols may add their own framing
 // - GenericDataWatcher inwardly to the wrapped GenericDataSource
 type DataSource struct {
+	// stats is first so that its counters are 64-bit aligned
+	stats dataSourceStats
+
 	// TODO: better to have alternate implementations for each combination
 	// rather than one with these nil checks
-	source      source.GenericDataSource
-	getSource   source.GetableDataSource
-	watchSource source.WatchableDataSource
-	watiSource  source.WatchInitableDataSource
-	actiSource  source.ActivateWatchableDataSource
+	source       source.GenericDataSource
+	getSource    source.GetableDataSource
+	watchSource  source.WatchableDataSource
+	watiSource   source.WatchInitableDataSource
+	backSource   source.BacklogDataSource
+	actiSource   source.ActivateWatchableDataSource
+	deacSource   source.DeactivateWatchableDataSource
+	emptyGet     source.EmptyGetPolicy
+	qos          source.QoSClass
+	lossless     bool
+	losslessWait time.Duration
+	criticalWait bool // lossless as QoSCritical; see criticalWaitScale
 
 	formats     map[string]source.GenericDataFormat
 	formatNames []string
-	maxItems    int
-	maxBatches  int
-	maxWait     time.Duration
 
-	procs     sync.WaitGroup
+	// maxItems, maxBatches, maxWait, and rate override the DefaultLimits when
+	// set
+	maxItems   int
+	maxBatches int
+	maxWait    time.Duration
+	rate       source.RateLimit
+
 	watchLock sync.RWMutex
 	watchers  map[string]*marshaledWatcher
-	active    bool
-	itemChan  chan interface{}
-	itemsChan chan []interface{}
+	lastGen   uint64
+	act       *activation
+
+	// stopped is that of the last activation started, if any; see
+	// activation.stopped
+	stopped chan struct{}
+}
+
+// activation holds the item channels for one active period of a DataSource.
+// Producers capture the activation (under the watchLock) before sending, so
+// a concurrent Drain or deactivation can never pull a channel out from under
+// them.  Item channels are never closed; instead done is closed to signal the
+// processor, and any producer still blocked on a send, that this generation
+// is over.
+//
+// Items are only stamped with their emission time once a
+// source.TimedItemWatcher has been added, since nothing else needs it.
+type activation struct {
+	gen       uint64
+	stamped   int32 // atomic
+	busySince int64 // atomic, UnixNano of the emit in progress, if any
+	itemChan  chan queuedItem
+	itemsChan chan queuedBatch
+	done      chan struct{}
+	rates     atomic.Value // *activationRates
+
+	// stopped is closed once the activation's processor, and those of all
+	// earlier activations, have finished; prevStopped is that of the
+	// activation before, if any.  Unlike a WaitGroup, Drain may wait on it
+	// while a new activation starts.
+	stopped     chan struct{}
+	prevStopped chan struct{}
+}
+
+// activationRates are an activation's sample rate and rate limiter; unlike
+// its queue sizes, they're rebuilt whenever the limits change, so that
+// changes take effect right away.
+type activationRates struct {
+	limitsGen uint64
+	sample    float64 // fraction of items kept, if non-zero
+	limiter   *source.RateLimiter
+}
+
+// busy marks the start, or end, of emitting queued items.
+func (act *activation) busy(busy bool) {
+	var since int64
+	if busy {
+		since = time.Now().UnixNano()
+	}
+	atomic.StoreInt64(&act.busySince, since)
+}
+
+// sampled returns true if an item should be kept, chosen at random at the
+// sample rate.
+func (ar *activationRates) sampled() bool {
+	return ar.sample == 0 || rand.Float64() < ar.sample
+}
+
+// stalled returns true if an emit has been in progress for longer than
+// source.StallTimeout.
+func (act *activation) stalled() bool {
+	since := atomic.LoadInt64(&act.busySince)
+	return since != 0 && time.Since(time.Unix(0, since)) > source.StallTimeout
+}
+
+// queuedItem is an item waiting to be emitted, with the time that it was
+// handled if the activation is stamped.
+type queuedItem struct {
+	at   time.Time
+	item interface{}
+}
+
+// queuedBatch is the batch analog of queuedItem.
+type queuedBatch struct {
+	at    time.Time
+	items []interface{}
+}
+
+// now returns the current time if the activation is stamped, or the zero
+// time otherwise.
+func (act *activation) now() time.Time {
+	if atomic.LoadInt32(&act.stamped) == 0 {
+		return time.Time{}
+	}
+	return time.Now()
 }
 
 func stringIt(item interface{}) ([]byte, error) {
@@ -79,10 +177,11 @@ func stringIt(item interface{}) ([]byte, error) {
 }
 
 // NewDataSource creates a DataSource for a given format-agnostic data source
-// and a map of marshalers
+// and a map of marshalers, applying any options.
 func NewDataSource(
 	src source.GenericDataSource,
 	formats map[string]source.GenericDataFormat,
+	opts ...Option,
 ) *DataSource {
 	if formats == nil {
 		formats = make(map[string]source.GenericDataFormat)
@@ -101,6 +200,16 @@ func NewDataSource(
 		formats["json"] = LDJSONMarshal
 	}
 
+	// html fragments, e.g. for a dashboard
+	if formats["html"] == nil {
+		formats["html"] = HTMLMarshal
+	}
+
+	// aligned text columns, picked by the client
+	if formats["table"] == nil {
+		formats["table"] = TableMarshal
+	}
+
 	// convenience templated text protocol
 	if formats["text"] == nil {
 		if txtsrc, ok := src.(source.TextTemplatedSource); ok {
@@ -119,21 +228,36 @@ func NewDataSource(
 		source:   src,
 		formats:  formats,
 		watchers: make(map[string]*marshaledWatcher, len(formats)),
-		// TODO: tunable
-		maxItems:   100,
-		maxBatches: 100,
-		maxWait:    100 * time.Microsecond,
 	}
 	ds.getSource, _ = src.(source.GetableDataSource)
 	ds.watchSource, _ = src.(source.WatchableDataSource)
 	ds.watiSource, _ = src.(source.WatchInitableDataSource)
+	ds.backSource, _ = src.(source.BacklogDataSource)
 	ds.actiSource, _ = src.(source.ActivateWatchableDataSource)
+	ds.deacSource, _ = src.(source.DeactivateWatchableDataSource)
+	if egsrc, ok := src.(source.EmptyGetDataSource); ok {
+		ds.emptyGet = egsrc.EmptyGet()
+	}
+	if qossrc, ok := src.(source.QoSDataSource); ok {
+		ds.qos = qossrc.QoS()
+	}
+	if llsrc, ok := src.(source.LosslessDataSource); ok {
+		ds.lossless = true
+		ds.losslessWait = llsrc.LosslessTimeout()
+	} else if ds.qos == source.QoSCritical {
+		ds.lossless = true
+		ds.criticalWait = true
+	}
 	for name, format := range formats {
 		ds.formatNames = append(ds.formatNames, name)
-		ds.watchers[name] = newMarshaledWatcher(ds, format)
+		ds.watchers[name] = newMarshaledWatcher(ds, name, format)
 	}
 	sort.Strings(ds.formatNames)
 
+	for _, opt := range opts {
+		opt(ds)
+	}
+
 	if ds.watchSource != nil {
 		ds.watchSource.SetWatcher(ds)
 	}
@@ -143,11 +267,17 @@ func NewDataSource(
 
 // Active returns true if there are any active watchers, false otherwise.  If
 // Active returns false, so will any calls to HandleItem and HandleItems.
+// Active is always false while gwr is globally disabled.
 func (mds *DataSource) Active() bool {
+	return !source.Disabled() && mds.activation() != nil
+}
+
+// activation returns the current activation, or nil if inactive.
+func (mds *DataSource) activation() *activation {
 	mds.watchLock.RLock()
-	r := mds.active && mds.itemChan != nil && mds.itemsChan != nil
+	act := mds.act
 	mds.watchLock.RUnlock()
-	return r
+	return act
 }
 
 // Name passes through the GenericDataSource.Name()
@@ -163,22 +293,80 @@ func (mds *DataSource) Formats() []string {
 // Attrs returns arbitrary description information about the data source.
 func (mds *DataSource) Attrs() map[string]interface{} {
 	// TODO: support per-format Attrs?
-	// TODO: any support for per-source Attrs?
+	var attrs map[string]interface{}
+	if asrc, ok := mds.source.(source.AttributedDataSource); ok {
+		if srcAttrs := asrc.Attrs(); len(srcAttrs) > 0 {
+			attrs = make(map[string]interface{}, len(srcAttrs)+1)
+			for name, val := range srcAttrs {
+				attrs[name] = val
+			}
+		}
+	}
+	if mds.qos != source.QoSStandard {
+		if attrs == nil {
+			attrs = make(map[string]interface{}, 1)
+		}
+		attrs["qos"] = mds.qos.String()
+	}
+	if mds.lossless {
+		if attrs == nil {
+			attrs = make(map[string]interface{}, 1)
+		}
+		attrs["lossless"] = true
+	}
+	var tripped map[string]*source.TrippedError
+	for name, watcher := range mds.watchers {
+		if te := watcher.trippedError(); te != nil {
+			if tripped == nil {
+				tripped = make(map[string]*source.TrippedError)
+			}
+			tripped[name] = te
+		}
+	}
+	if tripped != nil {
+		if attrs == nil {
+			attrs = make(map[string]interface{}, 1)
+		}
+		attrs["tripped"] = tripped
+	}
+	return attrs
+}
+
+// Inputs implements source.DerivedSource by passing through the wrapped
+// source's inputs, if it has any.
+func (mds *DataSource) Inputs() []string {
+	if dsrc, ok := mds.source.(source.DerivedSource); ok {
+		return dsrc.Inputs()
+	}
 	return nil
 }
 
 // Get marshals data source's Get data to the writer
 func (mds *DataSource) Get(formatName string, w io.Writer) error {
+	return mds.GetParams(formatName, nil, w)
+}
+
+// GetParams implements ParamGetableDataSource, passing the parameters to the
+// wrapped source if it implements ParamGetableGenericDataSource; any others
+// ignore them, as a plain Get.
+func (mds *DataSource) GetParams(formatName string, params map[string]string, w io.Writer) error {
 	if mds.getSource == nil {
 		return source.ErrNotGetable
 	}
-	format, ok := mds.formats[strings.ToLower(formatName)]
-	if !ok {
-		return source.ErrUnsupportedFormat
-	}
-	data := mds.getSource.Get()
-	buf, err := format.MarshalGet(data)
+	mw, formatParams, err := mds.parseFormat(formatName, params)
 	if err != nil {
+		return err
+	}
+	format, pr := mw.format, (*projection)(nil)
+	if vals := mw.variantParams(formatParams); len(vals) > 0 {
+		if format, pr, err = mw.configure(vals); err != nil {
+			return err
+		}
+	}
+	buf, err := mds.marshalGet(format, pr, params)
+	if err == source.ErrGetNoContent || err == source.ErrGetNotFound || err == source.ErrInvalidParam {
+		return err
+	} else if err != nil {
 		log.Printf("get marshaling error %v", err)
 		return err
 	}
@@ -186,227 +374,623 @@ func (mds *DataSource) Get(formatName string, w io.Writer) error {
 	return err
 }
 
+// marshalGet calls the wrapped source's Get, or GetParams if there are any
+// params and it's a ParamGetableGenericDataSource, and marshals the result,
+// as projected by any pr, subject to the source's EmptyGetPolicy; any panic
+// is returned as a *source.PanicError.
+func (mds *DataSource) marshalGet(format source.GenericDataFormat, pr *projection, params map[string]string) (buf []byte, err error) {
+	defer recoverPanic(mds.source.Name(), "get", &err)
+	var data interface{}
+	if psrc, ok := mds.getSource.(source.ParamGetableGenericDataSource); ok && len(params) > 0 {
+		if data, err = psrc.GetParams(params); err != nil {
+			return nil, err
+		}
+	} else {
+		data = mds.getSource.Get()
+	}
+	if mds.emptyGet != source.EmptyGetMarshal && isEmpty(data) {
+		switch mds.emptyGet {
+		case source.EmptyGetNoContent:
+			return nil, source.ErrGetNoContent
+		case source.EmptyGetNotFound:
+			return nil, source.ErrGetNotFound
+		}
+	}
+	data = source.ApplyTypeMarshalers(data)
+	if pr != nil {
+		data = pr.apply(data)
+	}
+	return format.MarshalGet(data)
+}
+
+// isEmpty returns true if data is nil, a typed nil, or a zero-length
+// collection.
+func isEmpty(data interface{}) bool {
+	if data == nil {
+		return true
+	}
+	val := reflect.ValueOf(data)
+	switch val.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		return val.IsNil()
+	case reflect.Map, reflect.Slice:
+		return val.IsNil() || val.Len() == 0
+	case reflect.Array:
+		return val.Len() == 0
+	default:
+		return false
+	}
+}
+
 // Watch marshals any data source GetInit data to the writer, and then
 // retains a reference to the writer so that any future agnostic data source
 // Watch(emit)'ed data gets marshaled to it as well
 func (mds *DataSource) Watch(formatName string, w io.Writer) error {
+	_, err := mds.watch(formatName, nil, w, 0)
+	return err
+}
+
+// watch implements Watch, with the format configured by any params that it
+// takes, and starting with a backlog of up to n items, rather than any init
+// data, if n > 0; see source.WithBacklog.  It returns the watcher that the
+// writer was added to.
+func (mds *DataSource) watch(
+	formatName string,
+	params map[string]string,
+	w io.Writer,
+	backlog int,
+) (*marshaledWatcher, error) {
 	if mds.watchSource == nil {
-		return source.ErrNotWatchable
+		return nil, source.ErrNotWatchable
 	}
 
 	mds.watchLock.Lock()
-	acted := !mds.active
-	err := func() error {
+	acted := mds.act == nil
+	watcher, err := func() (*marshaledWatcher, error) {
 		defer mds.watchLock.Unlock()
-		watcher, ok := mds.watchers[strings.ToLower(formatName)]
-		if !ok {
-			return source.ErrUnsupportedFormat
+		watcher, err := mds.watcher(formatName, params)
+		if err != nil {
+			return nil, err
 		}
-		if err := watcher.init(w); err != nil {
-			return err
+		if err := watcher.checkTripped(); err != nil {
+			return nil, err
+		}
+		if err := watcher.init(w, backlog); err != nil {
+			return nil, err
 		}
 		if err := mds.startWatching(); err != nil {
-			return err
+			return nil, err
 		}
-		return nil
+		return watcher, nil
 	}()
 
 	if err == nil && acted && mds.actiSource != nil {
-		mds.actiSource.Activate()
+		err = mds.activate()
 	}
-	return err
+	return watcher, err
 }
 
 // WatchItems marshals any data source GetInit data as a single item to the
 // ItemWatcher's HandleItem method.  The watcher is then retained and future
 // items are marshaled to its HandleItem method.
 func (mds *DataSource) WatchItems(formatName string, iw source.ItemWatcher) error {
+	_, err := mds.watchItems(formatName, nil, iw)
+	return err
+}
+
+// watchItems implements WatchItems, with the format configured by any params
+// that it takes, returning the watcher that the item watcher was added to.
+func (mds *DataSource) watchItems(
+	formatName string,
+	params map[string]string,
+	iw source.ItemWatcher,
+) (*marshaledWatcher, error) {
 	if mds.watchSource == nil {
-		return source.ErrNotWatchable
+		return nil, source.ErrNotWatchable
 	}
 
 	mds.watchLock.Lock()
-	acted := !mds.active
-	err := func() error {
+	acted := mds.act == nil
+	watcher, err := func() (*marshaledWatcher, error) {
 		defer mds.watchLock.Unlock()
-		watcher, ok := mds.watchers[strings.ToLower(formatName)]
-		if !ok {
-			return source.ErrUnsupportedFormat
+		watcher, err := mds.watcher(formatName, params)
+		if err != nil {
+			return nil, err
+		}
+		if err := watcher.checkTripped(); err != nil {
+			return nil, err
 		}
 		if err := watcher.initItems(iw); err != nil {
-			return err
+			return nil, err
 		}
 		if err := mds.startWatching(); err != nil {
-			return err
+			return nil, err
 		}
-		return nil
+		if isTimed(iw) {
+			atomic.StoreInt32(&mds.act.stamped, 1)
+		}
+		return watcher, nil
 	}()
 
 	if err == nil && acted && mds.actiSource != nil {
-		mds.actiSource.Activate()
+		err = mds.activate()
 	}
-	return err
+	return watcher, err
+}
+
+// watcher returns the watcher of the named format, or of its variant
+// configured by params; it must be called with the watchLock held.
+func (mds *DataSource) watcher(formatName string, params map[string]string) (*marshaledWatcher, error) {
+	watcher, params, err := mds.parseFormat(formatName, params)
+	if err != nil {
+		return nil, err
+	}
+	if len(params) == 0 {
+		return watcher, nil
+	}
+	return watcher.variant(params)
+}
+
+// parseFormat splits a format spec, like "json;pretty=1", into the watcher
+// of the named format and the params to configure it with: the spec's
+// arguments, which must all be taken by the format or be a fields projection,
+// over the passed params; see source.ParseFormat.
+func (mds *DataSource) parseFormat(spec string, params map[string]string) (*marshaledWatcher, map[string]string, error) {
+	name, args, err := source.ParseFormat(spec)
+	if err != nil {
+		return nil, nil, err
+	}
+	watcher, ok := mds.watchers[strings.ToLower(name)]
+	if !ok {
+		return nil, nil, source.ErrUnsupportedFormat
+	}
+	if len(args) == 0 {
+		return watcher, params, nil
+	}
+	if len(watcher.variantParams(args)) != len(args) {
+		return nil, nil, source.ErrInvalidParam
+	}
+	merged := make(map[string]string, len(params)+len(args))
+	for name, val := range params {
+		merged[name] = val
+	}
+	for name, val := range args {
+		merged[name] = val
+	}
+	return watcher, merged, nil
+}
+
+// WatchContext is like Watch, except that the writer is dropped as soon as
+// the context is done, and that it may start with a backlog, and configure
+// its format; see source.WithBacklog and source.WithFormatParams.
+func (mds *DataSource) WatchContext(ctx context.Context, formatName string, w io.Writer) error {
+	cw := &ctxWriter{
+		Writer:  w,
+		ctx:     ctx,
+		limiter: source.ContextRateLimiter(ctx),
+		stats:   &mds.stats,
+	}
+	mw, err := mds.watch(formatName, source.FormatParams(ctx), cw, source.ContextBacklog(ctx))
+	if err != nil {
+		return err
+	}
+	mds.unwatchWhenDone(ctx, mw, func() {
+		mw.removeWriter(cw)
+	})
+	return nil
 }
 
-// startWatching flips the active bit, creates new item channels, and starts a
-// processing go routine; it assumes that the watchLock is being held by the
-// caller.
+// WatchItemsContext is like WatchItems, except that the watcher is dropped as
+// soon as the context is done, and that it may configure its format; see
+// source.WithFormatParams.
+func (mds *DataSource) WatchItemsContext(ctx context.Context, formatName string, iw source.ItemWatcher) error {
+	ciw := &ctxItemWatcher{
+		ItemWatcher: iw,
+		ctx:         ctx,
+		limiter:     source.ContextRateLimiter(ctx),
+		stats:       &mds.stats,
+	}
+	mw, err := mds.watchItems(formatName, source.FormatParams(ctx), ciw)
+	if err != nil {
+		return err
+	}
+	mds.unwatchWhenDone(ctx, mw, func() {
+		mw.removeItemWatcher(ciw)
+	})
+	return nil
+}
+
+// unwatchWhenDone waits for the context to be done, and then calls remove, to
+// remove the watch from mw; if that leaves no watchers of any format, the
+// current activation is ended.  Any watch label is counted until then.
+func (mds *DataSource) unwatchWhenDone(ctx context.Context, mw *marshaledWatcher, remove func()) {
+	done := ctx.Done()
+	if done == nil {
+		return // never canceled
+	}
+	label := source.WatchLabel(ctx)
+	if label != "" {
+		mds.stats.label(label, 1)
+	}
+	go func() {
+		<-done
+		if label != "" {
+			mds.stats.label(label, -1)
+		}
+		mds.watchLock.Lock()
+		remove()
+		for _, mw := range mds.watchers {
+			if !mw.idle() {
+				mds.watchLock.Unlock()
+				return
+			}
+		}
+		act := mds.act
+		if act != nil {
+			mds.act = nil
+			close(act.done)
+		}
+		mds.watchLock.Unlock()
+		if act != nil {
+			mds.deactivated()
+		}
+	}()
+}
+
+// activate calls the wrapped source's Activate; any panic is returned as a
+// *source.PanicError.
+func (mds *DataSource) activate() (err error) {
+	defer recoverPanic(mds.source.Name(), "activate", &err)
+	mds.actiSource.Activate()
+	return nil
+}
+
+// startWatching creates a new activation, with a fresh generation number and
+// item channels, and starts a processing go routine; it assumes that the
+// watchLock is being held by the caller.
 func (mds *DataSource) startWatching() error {
 	// TODO: we could optimize the only-one-format-being-watched case
-	if mds.active {
+	if mds.act != nil {
 		return nil
 	}
-	mds.active = true
-	mds.itemChan = make(chan interface{}, mds.maxItems)
-	mds.itemsChan = make(chan []interface{}, mds.maxBatches)
-	mds.procs.Add(1)
-	go mds.processItemChan(mds.itemChan, mds.itemsChan)
+	mds.lastGen++
+	lim := mds.limits()
+	act := &activation{
+		gen:       mds.lastGen,
+		itemChan:  make(chan queuedItem, lim.MaxItems),
+		itemsChan: make(chan queuedBatch, lim.MaxBatches),
+		done:      make(chan struct{}),
+
+		stopped:     make(chan struct{}),
+		prevStopped: mds.stopped,
+	}
+	act.rates.Store(newActivationRates(atomic.LoadUint64(&limitsGen), lim, nil))
+	mds.act = act
+	mds.stopped = act.stopped
+	go mds.processItemChan(act)
 	return nil
 }
 
-// Drain closes the item channels, and waits for the item processor to finish.
-// After drain, any remaining watchers are closed, and the source goes
-// inactive.
+// newActivationRates returns the rates for the limits, as of the limitsGen,
+// keeping any previous limiter whose limit is unchanged.
+func newActivationRates(gen uint64, lim Limits, prev *source.RateLimiter) *activationRates {
+	ar := &activationRates{limitsGen: gen, limiter: prev}
+	if lim.Sample < 1 {
+		ar.sample = lim.Sample
+	}
+	if prev == nil || lim.Rate != prev.Limit() {
+		ar.limiter = source.NewRateLimiter(lim.Rate)
+	}
+	return ar
+}
+
+// rates returns the activation's current rates, rebuilding them if the limits
+// have changed since.
+func (mds *DataSource) rates(act *activation) *activationRates {
+	ar := act.rates.Load().(*activationRates)
+	if gen := atomic.LoadUint64(&limitsGen); gen != ar.limitsGen {
+		ar = newActivationRates(gen, mds.limits(), ar.limiter)
+		act.rates.Store(ar)
+	}
+	return ar
+}
+
+// Drain ends the current activation, and waits for the item processor to
+// finish sending any items still buffered.  After drain, any remaining
+// watchers are closed, and the source goes inactive.
 func (mds *DataSource) Drain() {
-	mds.watchLock.Lock()
-	any := false
-	if mds.itemChan != nil {
-		close(mds.itemChan)
-		any = true
-		mds.itemChan = nil
+	mds.watchLock.RLock()
+	act, stopped := mds.act, mds.stopped
+	mds.watchLock.RUnlock()
+	mds.deactivate(act)
+	if stopped != nil {
+		<-stopped
 	}
-	if mds.itemsChan != nil {
-		close(mds.itemsChan)
-		any = true
-		mds.itemsChan = nil
+}
+
+// deactivate ends the passed activation if it is still the current one,
+// returning true if so.  Callers holding a stale activation (e.g. one that a
+// concurrent Drain already ended) get false, and must not touch the watchers.
+func (mds *DataSource) deactivate(act *activation) bool {
+	if act == nil {
+		return false
 	}
-	if any {
+	mds.watchLock.Lock()
+	if mds.act != act {
 		mds.watchLock.Unlock()
-		mds.procs.Wait()
-		mds.watchLock.Lock()
-	}
-	stop := mds.active
-	if stop {
-		mds.active = false
+		return false
 	}
+	mds.act = nil
+	close(act.done)
 	mds.watchLock.Unlock()
+	mds.deactivated()
+	return true
+}
 
-	if stop {
-		for _, watcher := range mds.watchers {
-			watcher.Close()
-		}
+// deactivated calls the wrapped source's Deactivate, if it has one; any
+// panic is recovered.
+func (mds *DataSource) deactivated() {
+	if mds.deacSource == nil {
+		return
 	}
+	defer recoverPanic(mds.source.Name(), "deactivate", nil)
+	mds.deacSource.Deactivate()
 }
 
-func (mds *DataSource) processItemChan(itemChan chan interface{}, itemsChan chan []interface{}) {
-	defer mds.procs.Done()
+func (mds *DataSource) processItemChan(act *activation) {
+	defer func() {
+		if act.prevStopped != nil {
+			<-act.prevStopped
+		}
+		close(act.stopped)
+	}()
 
 	stop := false
+	for !stop {
+		select {
+		case qi := <-act.itemChan:
+			act.busy(true)
+			stop = !mds.emit(act, qi)
+			act.busy(false)
+		case qb := <-act.itemsChan:
+			act.busy(true)
+			stop = !mds.emitBatch(act, qb)
+			act.busy(false)
+		case <-act.done:
+			mds.flush(act)
+			stop = true
+		}
+	}
+
+	mds.deactivate(act)
 
-	for !stop && (itemChan != nil || itemsChan != nil) {
-		mds.watchLock.RLock()
-		active := mds.active
-		watchers := mds.watchers
-		mds.watchLock.RUnlock()
-		if !active {
-			break
+	// Only close watchers if no newer generation has started in the meantime;
+	// otherwise any watchers that were added since belong to it.
+	mds.watchLock.Lock()
+	if mds.act == nil || mds.act.gen < act.gen {
+		for _, watcher := range mds.watchers {
+			watcher.Close()
 		}
+	}
+	mds.watchLock.Unlock()
+}
+
+// flush emits any items left buffered in an ended activation's channels.
+func (mds *DataSource) flush(act *activation) {
+	for {
 		select {
-		case item, ok := <-itemChan:
-			if !ok {
-				itemChan = nil
-				continue
+		case qi := <-act.itemChan:
+			if !mds.emit(act, qi) {
+				return
 			}
-			any := false
-			for _, watcher := range watchers {
-				if watcher.emit(item) {
-					any = true
-				}
-			}
-			if !any {
-				stop = true
+		case qb := <-act.itemsChan:
+			if !mds.emitBatch(act, qb) {
+				return
 			}
+		default:
+			return
+		}
+	}
+}
 
-		case items, ok := <-itemsChan:
-			if !ok {
-				itemsChan = nil
-				continue
-			}
-			any := false
-			for _, watcher := range watchers {
-				if watcher.emitBatch(items) {
-					any = true
-				}
-			}
-			if !any {
-				stop = true
+func (mds *DataSource) emit(act *activation, qi queuedItem) bool {
+	any := false
+	limiter := mds.rates(act).limiter
+	for _, watcher := range mds.watchers {
+		if watcher.emit(limiter, qi.at, qi.item) {
+			any = true
+		}
+		for _, variant := range watcher.loadVariants() {
+			if variant.emit(limiter, qi.at, qi.item) {
+				any = true
 			}
 		}
 	}
+	return any
+}
 
-	mds.watchLock.Lock()
-	if mds.itemChan == itemChan {
-		mds.itemChan = nil
+func (mds *DataSource) emitBatch(act *activation, qb queuedBatch) bool {
+	any := false
+	limiter := mds.rates(act).limiter
+	for _, watcher := range mds.watchers {
+		if watcher.emitBatch(limiter, qb.at, qb.items) {
+			any = true
+		}
+		for _, variant := range watcher.loadVariants() {
+			if variant.emitBatch(limiter, qb.at, qb.items) {
+				any = true
+			}
+		}
 	}
-	if mds.itemsChan == itemsChan {
-		mds.itemsChan = nil
+	return any
+}
+
+// losslessTimer is the timeout on a lossless source's producer blocking on a
+// full queue; its channel is nil, never firing, if there's no timeout.
+type losslessTimer struct {
+	t *time.Timer
+	c <-chan time.Time
+}
+
+func (mds *DataSource) losslessTimer() losslessTimer {
+	wait := mds.losslessWait
+	if mds.criticalWait {
+		wait = mds.limits().MaxWait * criticalWaitScale
 	}
-	if stop {
-		mds.active = false
+	if wait <= 0 {
+		return losslessTimer{}
 	}
-	mds.watchLock.Unlock()
+	t := time.NewTimer(wait)
+	return losslessTimer{t, t.C}
+}
 
-	if stop {
-		for _, watcher := range mds.watchers {
-			watcher.Close()
-		}
+func (lt losslessTimer) stop() {
+	if lt.t != nil {
+		lt.t.Stop()
 	}
 }
 
+// criticalWaitScale is how many times longer than MaxWait the producer of a
+// QoSCritical source that isn't a LosslessDataSource waits on a full queue.
+const criticalWaitScale = 1000
+
 // HandleItem implements GenericDataWatcher.HandleItem by passing the item to
-// all current marshaledWatchers.
+// all current marshaledWatchers; how a full queue is handled depends on
+// whether the source is lossless, and otherwise on its QoSClass.
 func (mds *DataSource) HandleItem(item interface{}) bool {
-	if !mds.Active() {
+	if source.Disabled() {
 		return false
 	}
-	select {
-	case mds.itemChan <- item:
+	act := mds.activation()
+	if act == nil {
+		return false
+	}
+	if !mds.rates(act).sampled() {
+		mds.stats.drop(1)
 		return true
-	case <-time.After(mds.maxWait):
-		mds.watchLock.Lock()
-		if !mds.active {
-			mds.watchLock.Unlock()
+	}
+	qi := queuedItem{act.now(), item}
+	if mds.lossless {
+		select {
+		case act.itemChan <- qi:
+			mds.stats.queued(1)
+			return true
+		default:
+		}
+		timer := mds.losslessTimer()
+		defer timer.stop()
+		select {
+		case act.itemChan <- qi:
+			mds.stats.queued(1)
+			return true
+		case <-act.done:
+			return false
+		case <-timer.c:
+			mds.stats.drop(1)
+			mds.deactivate(act)
 			return false
 		}
-		mds.active = false
-		mds.watchLock.Unlock()
-		for _, watcher := range mds.watchers {
-			watcher.Close()
+	}
+	switch mds.qos {
+	case source.QoSDebug:
+		if n := len(act.itemChan); n > 0 && 2*n >= cap(act.itemChan) {
+			mds.stats.drop(1)
+			return true
 		}
+		select {
+		case act.itemChan <- qi:
+			mds.stats.queued(1)
+		case <-act.done:
+			return false
+		default:
+			mds.stats.drop(1)
+		}
+		return true
+	}
+	select {
+	case act.itemChan <- qi:
+		mds.stats.queued(1)
+		return true
+	case <-act.done:
+		return false
+	case <-time.After(mds.limits().MaxWait):
+		mds.stats.drop(1)
+		mds.deactivate(act)
 		return false
 	}
 }
 
 // HandleItems implements GenericDataWatcher.HandleItems by passing the batch
-// to all current marshaledWatchers.
+// to all current marshaledWatchers; how a full queue is handled depends on
+// whether the source is lossless, and otherwise on its QoSClass.
 func (mds *DataSource) HandleItems(items []interface{}) bool {
-	if !mds.Active() {
+	if source.Disabled() {
 		return false
 	}
-	select {
-	case mds.itemsChan <- items:
-		return true
-	case <-time.After(mds.maxWait):
-		mds.watchLock.Lock()
-		if !mds.active {
-			mds.watchLock.Unlock()
+	act := mds.activation()
+	if act == nil {
+		return false
+	}
+	if rates := mds.rates(act); rates.sample > 0 {
+		kept := make([]interface{}, 0, len(items))
+		for _, item := range items {
+			if rates.sampled() {
+				kept = append(kept, item)
+			}
+		}
+		mds.stats.drop(len(items) - len(kept))
+		if len(kept) == 0 {
+			return true
+		}
+		items = kept
+	}
+	qb := queuedBatch{act.now(), items}
+	if mds.lossless {
+		select {
+		case act.itemsChan <- qb:
+			mds.stats.queued(len(items))
+			return true
+		default:
+		}
+		timer := mds.losslessTimer()
+		defer timer.stop()
+		select {
+		case act.itemsChan <- qb:
+			mds.stats.queued(len(items))
+			return true
+		case <-act.done:
+			return false
+		case <-timer.c:
+			mds.stats.drop(len(items))
+			mds.deactivate(act)
 			return false
 		}
-		mds.active = false
-		mds.watchLock.Unlock()
-		for _, watcher := range mds.watchers {
-			watcher.Close()
+	}
+	switch mds.qos {
+	case source.QoSDebug:
+		if n := len(act.itemsChan); n > 0 && 2*n >= cap(act.itemsChan) {
+			mds.stats.drop(len(items))
+			return true
+		}
+		select {
+		case act.itemsChan <- qb:
+			mds.stats.queued(len(items))
+		case <-act.done:
+			return false
+		default:
+			mds.stats.drop(len(items))
 		}
+		return true
+	}
+	select {
+	case act.itemsChan <- qb:
+		mds.stats.queued(len(items))
+		return true
+	case <-act.done:
+		return false
+	case <-time.After(mds.limits().MaxWait):
+		mds.stats.drop(len(items))
+		mds.deactivate(act)
 		return false
 	}
 }
@@ -22,11 +22,18 @@ package marshaled_test
 
 import (
 	"bufio"
+	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"io/ioutil"
 	"os"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"text/template"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -103,6 +110,132 @@ func TestDataSource_Watch_activation(t *testing.T) {
 	// for mds to "drain" when it's watcher-less before moving on to next phase
 }
 
+func TestDataSource_Drain_emitRace(t *testing.T) {
+	tds := &testDataSource{}
+	tds.activated = make(chan struct{}, 1)
+	mds := marshaled.NewDataSource(tds, nil)
+
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for n := 0; ; n++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if n%2 == 0 {
+					tds.watcher.HandleItem(i)
+				} else {
+					tds.watcher.HandleItems([]interface{}{i, n})
+				}
+			}
+		}(i)
+	}
+
+	// repeatedly activate and drain while producers are emitting; a stale
+	// channel send would panic here
+	for i := 0; i < 50; i++ {
+		require.NoError(t, mds.Watch("json", ioutil.Discard))
+		tds.hasActivated()
+		require.NoError(t, mds.Watch("text", ioutil.Discard))
+		tds.hasActivated()
+		mds.Drain()
+		assert.False(t, mds.Active(), "inactive after drain")
+	}
+
+	close(stop)
+	wg.Wait()
+}
+
+type countingStreamFormat struct {
+	source.GenericDataFormat
+	n int
+}
+
+func (csf *countingStreamFormat) MarshalItemTo(w io.Writer, item interface{}) error {
+	csf.n++
+	_, err := fmt.Fprintf(w, "item=%v", item)
+	return err
+}
+
+func TestDataSource_WatchItems_streamFormat(t *testing.T) {
+	tds := &testDataSource{}
+	tds.activated = make(chan struct{}, 1)
+	csf := &countingStreamFormat{GenericDataFormat: marshaled.LDJSONMarshal}
+	mds := marshaled.NewDataSource(tds, map[string]source.GenericDataFormat{
+		"count": csf,
+	})
+
+	var got [][]byte
+	require.NoError(t, mds.WatchItems("count", source.ItemWatcherFunc(func(item []byte) error {
+		got = append(got, item)
+		return nil
+	})))
+	assert.True(t, tds.hasActivated(), "first watcher causes activation")
+
+	tds.emit(1)
+	tds.watcher.HandleItems([]interface{}{2, 3})
+	mds.Drain()
+
+	assert.Equal(t, 3, csf.n, "expected MarshalItemTo to be used")
+	// single items and batches travel over separate channels, so only the
+	// contents, not the order, are stable here
+	strs := make([]string, len(got))
+	for i, item := range got {
+		strs[i] = string(item)
+	}
+	sort.Strings(strs)
+	assert.Equal(t, []string{"item=1", "item=2", "item=3"}, strs, "expected retained items to not alias the pooled buffer")
+}
+
+type panickySource struct {
+	testDataSource
+}
+
+func (ps *panickySource) Get() interface{} {
+	panic("get went wrong")
+}
+
+func TestDataSource_panicContainment(t *testing.T) {
+	var panics []*source.PanicError
+	marshaled.SetPanicObserver(func(pe *source.PanicError) {
+		panics = append(panics, pe)
+	})
+	defer marshaled.SetPanicObserver(nil)
+
+	ps := &panickySource{}
+	ps.activated = make(chan struct{}, 1)
+	mds := marshaled.NewDataSource(ps, map[string]source.GenericDataFormat{
+		"bad": source.GenericDataFormatFunc(func(interface{}) ([]byte, error) {
+			panic("marshal went wrong")
+		}),
+	})
+
+	var buf bytes.Buffer
+	err := mds.Get("json", &buf)
+	if assert.IsType(t, &source.PanicError{}, err) {
+		pe := err.(*source.PanicError)
+		assert.Equal(t, "/test", pe.Source)
+		assert.Equal(t, "get", pe.Op)
+		assert.Equal(t, "get went wrong", pe.Value)
+	}
+
+	require.NoError(t, mds.Watch("bad", ioutil.Discard))
+	assert.True(t, ps.hasActivated(), "first watcher causes activation")
+	ps.emit(42)
+	mds.Drain()
+
+	if assert.Equal(t, 2, len(panics), "expected both panics to be observed") {
+		assert.Equal(t, "get", panics[0].Op)
+		assert.Equal(t, "marshal item", panics[1].Op)
+		assert.Equal(t, "marshal went wrong", panics[1].Value)
+	}
+}
+
 type pipeSet struct {
 	rs  []*os.File
 	scs []*bufio.Scanner
@@ -151,3 +284,627 @@ func assertJSONScanLine(t *testing.T, sc *bufio.Scanner, expected string, msgAnd
 	}
 	assert.NoError(t, sc.Err())
 }
+
+type emptySource struct {
+	testDataSource
+	policy source.EmptyGetPolicy
+	data   interface{}
+}
+
+func (es *emptySource) Get() interface{} {
+	return es.data
+}
+
+func (es *emptySource) EmptyGet() source.EmptyGetPolicy {
+	return es.policy
+}
+
+func TestDataSource_Get_empty(t *testing.T) {
+	var nilMap map[string]int
+	for _, tc := range []struct {
+		policy source.EmptyGetPolicy
+		data   interface{}
+		err    error
+		out    string
+	}{
+		{source.EmptyGetMarshal, nil, nil, "null"},
+		{source.EmptyGetMarshal, []int{}, nil, "[]"},
+		{source.EmptyGetNoContent, nil, source.ErrGetNoContent, ""},
+		{source.EmptyGetNoContent, nilMap, source.ErrGetNoContent, ""},
+		{source.EmptyGetNoContent, []int{1}, nil, "[1]"},
+		{source.EmptyGetNotFound, []int{}, source.ErrGetNotFound, ""},
+		{source.EmptyGetNotFound, 0, nil, "0"},
+	} {
+		mds := marshaled.NewDataSource(&emptySource{
+			policy: tc.policy,
+			data:   tc.data,
+		}, nil)
+		var buf bytes.Buffer
+		assert.Equal(t, tc.err, mds.Get("json", &buf), "policy %v data %#v", tc.policy, tc.data)
+		assert.Equal(t, tc.out, buf.String(), "policy %v data %#v", tc.policy, tc.data)
+	}
+}
+
+func TestDataSource_Get_formatArgs(t *testing.T) {
+	mds := marshaled.NewDataSource(&emptySource{
+		data: map[string]int{"a": 1},
+	}, nil)
+	for _, tc := range []struct {
+		format string
+		params map[string]string
+		err    error
+		out    string
+	}{
+		{"json", nil, nil, `{"a":1}`},
+		{"JSON; pretty=1", nil, nil, "{\n  \"a\": 1\n}\n"},
+		{"json", map[string]string{"pretty": "true"}, nil, "{\n  \"a\": 1\n}\n"},
+		{"json;pretty=0", map[string]string{"pretty": "1"}, nil, `{"a":1}`},
+		{"json;pretty=maybe", nil, source.ErrInvalidParam, ""},
+		{"json;pretty", nil, source.ErrInvalidParam, ""},
+		{"json;cols=a", nil, source.ErrInvalidParam, ""},
+		{"text;pretty=1", nil, source.ErrInvalidParam, ""},
+		{"yaml;pretty=1", nil, source.ErrUnsupportedFormat, ""},
+	} {
+		var buf bytes.Buffer
+		assert.Equal(t, tc.err, mds.GetParams(tc.format, tc.params, &buf), "format %q", tc.format)
+		assert.Equal(t, tc.out, buf.String(), "format %q", tc.format)
+	}
+
+	tds := &testDataSource{activated: make(chan struct{}, 1)}
+	wmds := marshaled.NewDataSource(tds, nil)
+	assert.Equal(t, source.ErrInvalidParam, wmds.Watch("json;bogus=1", &bytes.Buffer{}), "unknown watch argument")
+	var buf bytes.Buffer
+	require.NoError(t, wmds.Watch("table;cols=a:3", &buf))
+	tds.emit(map[string]int{"a": 1})
+	wmds.Drain()
+	assert.Equal(t, "A\n1\n", buf.String(), "watch format configured by its arguments")
+}
+
+type qosSource struct {
+	testDataSource
+	qos source.QoSClass
+}
+
+func (qs *qosSource) QoS() source.QoSClass {
+	return qs.qos
+}
+
+// gateWriter blocks all writes until its gate is closed, counting the lines
+// written after that.
+type gateWriter struct {
+	sync.Mutex
+	gate  chan struct{}
+	lines int
+}
+
+func (gw *gateWriter) Write(p []byte) (int, error) {
+	<-gw.gate
+	gw.Lock()
+	gw.lines += bytes.Count(p, []byte("\n"))
+	gw.Unlock()
+	return len(p), nil
+}
+
+func (gw *gateWriter) count() int {
+	gw.Lock()
+	defer gw.Unlock()
+	return gw.lines
+}
+
+func TestDataSource_HandleItem_qos(t *testing.T) {
+	newQoS := func(qos source.QoSClass) (*qosSource, *marshaled.DataSource, *gateWriter) {
+		qs := &qosSource{qos: qos}
+		qs.activated = make(chan struct{}, 1)
+		mds := marshaled.NewDataSource(qs, nil)
+		gw := &gateWriter{gate: make(chan struct{})}
+		require.NoError(t, mds.Watch("json", gw))
+		require.True(t, qs.hasActivated())
+		return qs, mds, gw
+	}
+
+	t.Run("standard", func(t *testing.T) {
+		qs, mds, gw := newQoS(source.QoSStandard)
+		defer close(gw.gate)
+		var dropped bool
+		for i := 0; i < 300 && !dropped; i++ {
+			dropped = !qs.watcher.HandleItem(i)
+		}
+		assert.True(t, dropped, "stuck standard watch should end")
+		assert.False(t, mds.Active(), "inactive after ending")
+		assert.Nil(t, mds.Attrs(), "no qos attr for standard")
+	})
+
+	t.Run("debug", func(t *testing.T) {
+		qs, mds, gw := newQoS(source.QoSDebug)
+		for i := 0; i < 300; i++ {
+			assert.True(t, qs.watcher.HandleItem(i), "debug items are shed, not refused")
+		}
+		assert.True(t, mds.Active(), "stuck debug watch should not end")
+		assert.Equal(t, map[string]interface{}{"qos": "debug"}, mds.Attrs())
+		close(gw.gate)
+		mds.Drain()
+		assert.True(t, gw.count() < 300, "some debug items shed")
+	})
+
+	t.Run("debug unit queue", func(t *testing.T) {
+		qs := &qosSource{qos: source.QoSDebug}
+		qs.activated = make(chan struct{}, 1)
+		mds := marshaled.NewDataSource(qs, nil, marshaled.WithBufferSizes(1, 1))
+		var (
+			lock sync.Mutex
+			got  []string
+		)
+		require.NoError(t, mds.WatchItems("json", source.ItemWatcherFunc(func(item []byte) error {
+			lock.Lock()
+			got = append(got, string(item))
+			lock.Unlock()
+			return nil
+		})))
+		require.True(t, qs.hasActivated())
+		for i := 0; i < 3; i++ {
+			assert.True(t, qs.watcher.HandleItem(i))
+			// wait for the queue to empty before the next item
+			for n := 0; n < 100; n++ {
+				lock.Lock()
+				done := len(got) > i
+				lock.Unlock()
+				if done {
+					break
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}
+		assert.Equal(t, uint64(0), mds.Stats().Dropped, "an empty queue of one isn't half full")
+		lock.Lock()
+		assert.Equal(t, []string{"0", "1", "2"}, got)
+		lock.Unlock()
+	})
+
+	t.Run("critical", func(t *testing.T) {
+		qs, mds, gw := newQoS(source.QoSCritical)
+		done := make(chan bool)
+		go func() {
+			ok := true
+			for i := 0; i < 300; i++ {
+				ok = qs.watcher.HandleItem(i) && ok
+			}
+			done <- ok
+		}()
+		select {
+		case <-done:
+			assert.Fail(t, "critical items should block while the watcher is stuck")
+		case <-time.After(10 * time.Millisecond):
+		}
+		assert.True(t, mds.Active(), "stuck critical watch should not end")
+		assert.Equal(t, map[string]interface{}{"qos": "critical", "lossless": true}, mds.Attrs())
+		close(gw.gate)
+		assert.True(t, <-done, "no critical item refused")
+		mds.Drain()
+		assert.Equal(t, 300, gw.count(), "no critical items dropped")
+	})
+
+	t.Run("critical stalled", func(t *testing.T) {
+		qs := &qosSource{qos: source.QoSCritical}
+		qs.activated = make(chan struct{}, 1)
+		mds := marshaled.NewDataSource(qs, nil, marshaled.WithMaxWait(20*time.Microsecond))
+		gw := &gateWriter{gate: make(chan struct{})}
+		defer close(gw.gate)
+		require.NoError(t, mds.Watch("json", gw))
+		require.True(t, qs.hasActivated())
+
+		done := make(chan time.Duration)
+		go func() {
+			for i := 0; i < 300; i++ {
+				start := time.Now()
+				if !qs.watcher.HandleItem(i) {
+					done <- time.Since(start)
+					return
+				}
+			}
+			done <- 0
+		}()
+		select {
+		case took := <-done:
+			assert.True(t, took >= 20*time.Millisecond, "waited a thousand times MaxWait, not %v", took)
+		case <-time.After(time.Second):
+			require.Fail(t, "critical producer blocked for good by a stalled watcher")
+		}
+		assert.False(t, mds.Active(), "stalled critical watch should end")
+		assert.Equal(t, uint64(1), mds.Stats().Dropped)
+	})
+}
+
+func TestDataSource_options(t *testing.T) {
+	qs := &qosSource{}
+	qs.activated = make(chan struct{}, 1)
+	mds := marshaled.NewDataSource(qs, nil,
+		marshaled.WithBufferSizes(2, 0),
+		marshaled.WithMaxWait(20*time.Millisecond))
+	gw := &gateWriter{gate: make(chan struct{})}
+	defer close(gw.gate)
+	require.NoError(t, mds.Watch("json", gw))
+	require.True(t, qs.hasActivated())
+
+	// the processor may hold one item, blocked on the writer, besides the
+	// two queued ones
+	var (
+		n    int
+		took time.Duration
+	)
+	for ; n < 10; n++ {
+		start := time.Now()
+		if !qs.watcher.HandleItem(n) {
+			took = time.Since(start)
+			break
+		}
+	}
+	assert.True(t, n <= 3, "watch ended once the small queue filled, after %d items", n)
+	assert.True(t, took >= 20*time.Millisecond, "waited MaxWait on the full queue, not %v", took)
+	assert.False(t, mds.Active(), "inactive after ending")
+	assert.Equal(t, uint64(1), mds.Stats().Dropped)
+}
+
+type losslessSource struct {
+	qosSource
+	timeout time.Duration
+}
+
+func (ls *losslessSource) LosslessTimeout() time.Duration {
+	return ls.timeout
+}
+
+func TestDataSource_HandleItem_lossless(t *testing.T) {
+	newLossless := func(qos source.QoSClass, timeout time.Duration) (*losslessSource, *marshaled.DataSource, *gateWriter) {
+		ls := &losslessSource{qosSource: qosSource{qos: qos}, timeout: timeout}
+		ls.activated = make(chan struct{}, 1)
+		mds := marshaled.NewDataSource(ls, nil)
+		gw := &gateWriter{gate: make(chan struct{})}
+		require.NoError(t, mds.Watch("json", gw))
+		require.True(t, ls.hasActivated())
+		return ls, mds, gw
+	}
+
+	t.Run("blocks", func(t *testing.T) {
+		ls, mds, gw := newLossless(source.QoSDebug, 0)
+		assert.Equal(t, map[string]interface{}{"qos": "debug", "lossless": true}, mds.Attrs())
+		done := make(chan bool)
+		go func() {
+			ok := true
+			for i := 0; i < 150; i++ {
+				ok = ls.watcher.HandleItem(i) && ok
+			}
+			ok = ls.watcher.HandleItems([]interface{}{150, 151}) && ok
+			done <- ok
+		}()
+		select {
+		case <-done:
+			assert.Fail(t, "lossless items should block while the watcher is stuck, whatever the qos")
+		case <-time.After(10 * time.Millisecond):
+		}
+		assert.True(t, mds.Active(), "stuck lossless watch should not end")
+		close(gw.gate)
+		assert.True(t, <-done, "no lossless item refused")
+		mds.Drain()
+		assert.Equal(t, 152, gw.count(), "no lossless items dropped")
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		ls, mds, gw := newLossless(source.QoSStandard, 5*time.Millisecond)
+		defer close(gw.gate)
+		assert.Equal(t, map[string]interface{}{"lossless": true}, mds.Attrs())
+		var ended bool
+		for i := 0; i < 300 && !ended; i++ {
+			ended = !ls.watcher.HandleItem(i)
+		}
+		assert.True(t, ended, "stuck lossless watch should end after the timeout")
+		assert.False(t, mds.Active(), "inactive after ending")
+	})
+}
+
+func TestDataSource_disabled(t *testing.T) {
+	tds := &testDataSource{}
+	tds.activated = make(chan struct{}, 1)
+	mds := marshaled.NewDataSource(tds, nil)
+
+	var buf bytes.Buffer
+	require.NoError(t, mds.Watch("json", &buf))
+	require.True(t, tds.hasActivated())
+	assert.True(t, mds.Active(), "active while watched")
+
+	source.SetDisabled(true)
+	assert.False(t, mds.Active(), "inactive when disabled")
+	assert.False(t, tds.watcher.HandleItem(1), "items refused when disabled")
+	assert.False(t, tds.watcher.HandleItems([]interface{}{2, 3}), "items refused when disabled")
+
+	source.SetDisabled(false)
+	assert.True(t, mds.Active(), "active again when re-enabled")
+	assert.True(t, tds.watcher.HandleItem(4), "items accepted when re-enabled")
+
+	mds.Drain()
+	assert.Equal(t, "4\n", buf.String(), "only got the item emitted while enabled")
+}
+
+func TestDataSource_WatchContext(t *testing.T) {
+	tds := &testDataSource{}
+	tds.activated = make(chan struct{}, 1)
+	mds := marshaled.NewDataSource(tds, nil)
+
+	var buf bytes.Buffer
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	require.NoError(t, mds.WatchContext(ctx1, "json", &buf))
+	require.True(t, tds.hasActivated())
+	items := make(chan string, 1)
+	require.NoError(t, mds.WatchItemsContext(ctx2, "text", source.ItemWatcherFunc(func(item []byte) error {
+		items <- string(item)
+		return nil
+	})))
+
+	waitFor := func(cond func() bool) bool {
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+			if cond() {
+				return true
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return false
+	}
+
+	cancel1()
+	tds.emit(1)
+	assert.Equal(t, "1", <-items, "item still watched after first cancel")
+	assert.True(t, mds.Active(), "still active while one watch remains")
+
+	cancel2()
+	assert.True(t, waitFor(func() bool { return !mds.Active() }), "inactive once all contexts are done")
+	mds.Drain()
+	assert.Equal(t, "", buf.String(), "no item written after first cancel")
+}
+
+type timedWatcher struct {
+	source.ItemWatcherFunc
+	times []time.Time
+}
+
+func (tw *timedWatcher) HandleTimedItem(t time.Time, item []byte) error {
+	tw.times = append(tw.times, t)
+	return tw.HandleItem(item)
+}
+
+func (tw *timedWatcher) HandleTimedItems(t time.Time, items [][]byte) error {
+	for range items {
+		tw.times = append(tw.times, t)
+	}
+	return tw.HandleItems(items)
+}
+
+func TestDataSource_WatchItemsContext_timed(t *testing.T) {
+	tds := &testDataSource{}
+	tds.activated = make(chan struct{}, 1)
+	mds := marshaled.NewDataSource(tds, nil)
+
+	var got []string
+	tw := &timedWatcher{ItemWatcherFunc: func(item []byte) error {
+		got = append(got, string(item))
+		return nil
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, mds.WatchItemsContext(ctx, "text", tw))
+	require.True(t, tds.hasActivated())
+
+	before := time.Now()
+	tds.emit(1)
+	tds.watcher.HandleItems([]interface{}{2, 3})
+	after := time.Now()
+	mds.Drain()
+
+	sort.Strings(got)
+	assert.Equal(t, []string{"1", "2", "3"}, got)
+	require.Len(t, tw.times, 3, "expected a time for every item")
+	for _, at := range tw.times {
+		assert.False(t, at.Before(before) || at.After(after), "expected emission time, got %v", at)
+	}
+}
+
+func TestDataSource_formatBreaker(t *testing.T) {
+	tds := &testDataSource{}
+	tds.activated = make(chan struct{}, 1)
+	mds := marshaled.NewDataSource(tds, nil)
+
+	var got []string
+	require.NoError(t, mds.WatchItems("json", source.ItemWatcherFunc(func(item []byte) error {
+		got = append(got, string(item))
+		return nil
+	})))
+	require.True(t, tds.hasActivated())
+
+	// unencodable items are replaced by a fallback frame, and only
+	// consecutive failures count
+	const fallback = `{"gwr_error":"marshal failed","type":"chan int"}`
+	for i := 0; i < 9; i++ {
+		tds.emit(make(chan int))
+	}
+	tds.emit(1)
+	for i := 0; i < 9; i++ {
+		tds.emit(make(chan int))
+	}
+	tds.emit(2)
+	for i := 0; i < 10; i++ {
+		tds.emit(make(chan int))
+	}
+	mds.Drain()
+
+	require.Len(t, got, 9+1+9+1+9+1, "expected items, fallbacks, and an error frame")
+	assert.Equal(t, fallback, got[0])
+	assert.Equal(t, "1", got[9])
+	assert.Equal(t, "2", got[19])
+	assert.Equal(t, fallback, got[28])
+	assert.Contains(t, got[29], `{"error":{"source":"/test","format":"json","failures":10,`)
+
+	assert.Equal(t, source.ErrFormatTripped, mds.WatchItems("json", source.ItemWatcherFunc(func([]byte) error {
+		return nil
+	})), "tripped format refuses watches")
+	require.NotNil(t, mds.Attrs()["tripped"], "tripped format in attrs")
+	assert.NotNil(t, mds.Attrs()["tripped"].(map[string]*source.TrippedError)["json"])
+
+	var buf bytes.Buffer
+	assert.NoError(t, mds.Watch("text", &buf), "other formats still watchable")
+}
+
+func TestDataSource_fallbackBatch(t *testing.T) {
+	tds := &testDataSource{}
+	tds.activated = make(chan struct{}, 1)
+	mds := marshaled.NewDataSource(tds, nil)
+
+	var got []string
+	require.NoError(t, mds.WatchItems("json", source.ItemWatcherFunc(func(item []byte) error {
+		got = append(got, string(item))
+		return nil
+	})))
+	require.True(t, tds.hasActivated())
+
+	tds.watcher.HandleItems([]interface{}{make(chan int), 1, make(chan int)})
+	mds.Drain()
+
+	const fallback = `{"gwr_error":"marshal failed","type":"chan int"}`
+	assert.Equal(t, []string{fallback, "1", fallback}, got, "bad batch items replaced individually")
+}
+
+func TestDataSource_Stats(t *testing.T) {
+	tds := &testDataSource{}
+	tds.activated = make(chan struct{}, 1)
+	mds := marshaled.NewDataSource(tds, nil)
+
+	var (
+		got []byte
+		buf bytes.Buffer
+	)
+	require.NoError(t, mds.WatchItems("json", source.ItemWatcherFunc(func(item []byte) error {
+		got = append(got, item...)
+		return nil
+	})))
+	require.NoError(t, mds.Watch("text", &buf))
+	require.True(t, tds.hasActivated())
+	assert.Equal(t, map[string]int{"json": 1, "text": 1}, mds.Stats().FormatWatchers)
+
+	tds.emit(1)
+	tds.emit(make(chan int))
+	tds.emit(2)
+	mds.Drain()
+
+	stats := mds.Stats()
+	assert.Equal(t, uint64(3), stats.Items)
+	assert.Equal(t, uint64(1), stats.MarshalErrors, "only json can't marshal a chan")
+	assert.Equal(t, `1{"gwr_error":"marshal failed","type":"chan int"}2`, string(got))
+	assert.Equal(t, uint64(len(got)+buf.Len()), stats.Bytes)
+}
+
+func TestDataSource_rateLimit(t *testing.T) {
+	tds := &testDataSource{}
+	tds.activated = make(chan struct{}, 1)
+	mds := marshaled.NewDataSource(tds, nil, marshaled.WithRateLimit(source.RateLimit{Items: 2}))
+
+	var buf bytes.Buffer
+	require.NoError(t, mds.Watch("json", &buf))
+	require.True(t, tds.hasActivated())
+	for i := 1; i <= 5; i++ {
+		tds.emit(i)
+	}
+	mds.Drain()
+	assert.Equal(t, "1\n2\n", buf.String(), "a second's burst of the source's limit")
+	assert.Equal(t, uint64(3), mds.Stats().Dropped)
+
+	// a context's limiter is shared by all of its watches
+	tds = &testDataSource{}
+	tds.activated = make(chan struct{}, 1)
+	mds = marshaled.NewDataSource(tds, nil)
+	ctx, cancel := context.WithCancel(source.WithRateLimiter(context.Background(),
+		source.NewRateLimiter(source.RateLimit{Items: 1})))
+	defer cancel()
+
+	var items [][]byte
+	buf.Reset()
+	require.NoError(t, mds.WatchItemsContext(ctx, "json", source.ItemWatcherFunc(func(item []byte) error {
+		items = append(items, item)
+		return nil
+	})))
+	var writes int
+	require.NoError(t, mds.WatchContext(ctx, "text", writerFunc(func(p []byte) (int, error) {
+		writes++
+		return buf.Write(p)
+	})))
+	require.True(t, tds.hasActivated())
+	for i := 1; i <= 3; i++ {
+		tds.emit(i)
+	}
+	mds.Drain()
+	assert.Equal(t, buf.Len(), writes*2, "limited items aren't written at all")
+	if buf.Len() > 0 {
+		assert.Equal(t, "1\n", buf.String())
+		assert.Empty(t, items)
+	} else {
+		assert.Equal(t, [][]byte{[]byte("1")}, items)
+	}
+	assert.Equal(t, uint64(5), mds.Stats().Dropped, "the rest dropped for both watches")
+}
+
+// writerFunc adapts a function to an io.Writer.
+type writerFunc func(p []byte) (int, error)
+
+func (wf writerFunc) Write(p []byte) (int, error) { return wf(p) }
+
+func TestSetSourceLimits(t *testing.T) {
+	marshaled.SetSourceLimits("/test", marshaled.Limits{Rate: source.RateLimit{Items: 1}})
+	defer marshaled.SetSourceLimits("/test", marshaled.Limits{})
+
+	tds := &testDataSource{activated: make(chan struct{}, 1)}
+	mds := marshaled.NewDataSource(tds, nil, marshaled.WithRateLimit(source.RateLimit{Items: 2}))
+	var buf bytes.Buffer
+	require.NoError(t, mds.Watch("json", &buf))
+	require.True(t, tds.hasActivated())
+	for i := 1; i <= 3; i++ {
+		tds.emit(i)
+	}
+	mds.Drain()
+	assert.Equal(t, "1\n", buf.String(), "the source's limits override its options")
+
+	marshaled.SetSourceLimits("/test", marshaled.Limits{})
+	buf.Reset()
+	require.NoError(t, mds.Watch("json", &buf))
+	require.True(t, tds.hasActivated())
+	tds.emit(1)
+	marshaled.SetSourceLimits("/test", marshaled.Limits{Sample: 1e-9})
+	for i := 2; i <= 4; i++ {
+		tds.emit(i)
+	}
+	tds.watcher.HandleItems([]interface{}{5, 6})
+	mds.Drain()
+	assert.Equal(t, "1\n", buf.String(), "unsampled items dropped, once the limits change")
+	assert.Equal(t, uint64(7), mds.Stats().Dropped)
+	assert.Equal(t, map[string]marshaled.Limits{"/test": {Sample: 1e-9}}, marshaled.SourceLimits())
+}
+
+// backlogBuffer marks where a watch's backlog ends.
+type backlogBuffer struct {
+	bytes.Buffer
+}
+
+func (bb *backlogBuffer) EndBacklog(n int) error {
+	fmt.Fprintf(bb, "-- %d --\n", n)
+	return nil
+}
+
+func TestDataSource_WatchContext_backlog(t *testing.T) {
+	tds := &testDataSource{activated: make(chan struct{}, 1)}
+	mds := marshaled.NewDataSource(tds, nil)
+
+	var buf backlogBuffer
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, mds.WatchContext(source.WithBacklog(ctx, 10), "json", &buf))
+	tds.emit(1)
+	mds.Drain()
+	assert.Equal(t, "-- 0 --\n1\n", buf.String(), "backlog ended, though nothing is retained")
+}
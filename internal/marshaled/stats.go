@@ -0,0 +1,144 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package marshaled
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uber-go/gwr/source"
+)
+
+// minRateInterval is the least time over which Stats measures its rate;
+// calls closer together than this report the previous rate.
+const minRateInterval = time.Second
+
+// dataSourceStats holds the counters behind DataSource.Stats.  The counts are
+// kept atomically, since they're bumped by every HandleItem(s) call.
+type dataSourceStats struct {
+	// the counters are first so that they're 64-bit aligned
+	items         uint64
+	dropped       uint64
+	marshalErrors uint64
+	bytes         uint64
+
+	rateLock  sync.Mutex
+	rateTime  time.Time
+	rateItems uint64
+	rate      float64
+
+	labelLock sync.Mutex
+	labels    map[string]int
+}
+
+func (dss *dataSourceStats) queued(n int) {
+	atomic.AddUint64(&dss.items, uint64(n))
+}
+
+func (dss *dataSourceStats) drop(n int) {
+	atomic.AddUint64(&dss.dropped, uint64(n))
+}
+
+func (dss *dataSourceStats) marshalError() {
+	atomic.AddUint64(&dss.marshalErrors, 1)
+}
+
+func (dss *dataSourceStats) wrote(n int) {
+	atomic.AddUint64(&dss.bytes, uint64(n))
+}
+
+// label adds n to the count of watchers with the label, forgetting it once
+// there are none.
+func (dss *dataSourceStats) label(label string, n int) {
+	dss.labelLock.Lock()
+	defer dss.labelLock.Unlock()
+	if dss.labels == nil {
+		dss.labels = make(map[string]int)
+	}
+	if n += dss.labels[label]; n > 0 {
+		dss.labels[label] = n
+	} else {
+		delete(dss.labels, label)
+	}
+}
+
+// labelCounts returns a copy of the label counts, or nil if there are none.
+func (dss *dataSourceStats) labelCounts() map[string]int {
+	dss.labelLock.Lock()
+	defer dss.labelLock.Unlock()
+	if len(dss.labels) == 0 {
+		return nil
+	}
+	labels := make(map[string]int, len(dss.labels))
+	for label, n := range dss.labels {
+		labels[label] = n
+	}
+	return labels
+}
+
+// sample returns the item count and the items per second since the last
+// sample taken at least minRateInterval ago.
+func (dss *dataSourceStats) sample() (uint64, float64) {
+	items := atomic.LoadUint64(&dss.items)
+	now := time.Now()
+	dss.rateLock.Lock()
+	defer dss.rateLock.Unlock()
+	if dss.rateTime.IsZero() {
+		dss.rateTime, dss.rateItems = now, items
+	} else if elapsed := now.Sub(dss.rateTime); elapsed >= minRateInterval {
+		dss.rate = float64(items-dss.rateItems) / elapsed.Seconds()
+		dss.rateTime, dss.rateItems = now, items
+	}
+	return items, dss.rate
+}
+
+// Stats implements StatsDataSource; Watchers counts every writer and item
+// watcher across all formats.  Items that are shed by a QoSDebug source, that
+// time out a QoSStandard source, or that aren't sampled, count as dropped.
+// Bytes counts the framed bytes written to each writer, and the marshaled bytes
+// passed to each item watcher.  Labels counts the watches made with a labeled
+// context, until the context is done.  While active, Queued and QueueSize
+// count items and batches together.
+func (mds *DataSource) Stats() source.Stats {
+	var stats source.Stats
+	stats.Active = mds.Active()
+	for name, watcher := range mds.watchers {
+		if n := watcher.numWatchers(); n > 0 {
+			if stats.FormatWatchers == nil {
+				stats.FormatWatchers = make(map[string]int, len(mds.watchers))
+			}
+			stats.FormatWatchers[name] = n
+			stats.Watchers += n
+		}
+	}
+	stats.Items, stats.Rate = mds.stats.sample()
+	stats.Dropped = atomic.LoadUint64(&mds.stats.dropped)
+	stats.MarshalErrors = atomic.LoadUint64(&mds.stats.marshalErrors)
+	stats.Bytes = atomic.LoadUint64(&mds.stats.bytes)
+	stats.Labels = mds.stats.labelCounts()
+	if act := mds.activation(); act != nil {
+		stats.Queued = len(act.itemChan) + len(act.itemsChan)
+		stats.QueueSize = cap(act.itemChan) + cap(act.itemsChan)
+		stats.Stalled = act.stalled()
+	}
+	return stats
+}
@@ -0,0 +1,323 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package marshaled
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/uber-go/gwr/source"
+)
+
+// TableMarshal renders flat items, such as structs or maps of scalars, as rows
+// of aligned, fixed-width text, with a column per json field; any item that
+// isn't a json object is shown in a single "value" column.
+//
+// It's a source.ParamFormat, configured by a "cols" parameter that picks the
+// columns, and optionally their widths, e.g. "method:6,path:30,code".  Such a
+// watch stream starts with a header row of the column names, and any value
+// longer than its column's given width is truncated.  Without cols, every
+// field is shown.  Gets are laid out to fit their data, with a header, and a
+// row per element of any slice.
+var TableMarshal source.ParamFormat = tableFormat{}
+
+// tableDefaultWidth is the least width of a watched column without a given
+// width.
+const tableDefaultWidth = 10
+
+type tableColumn struct {
+	name  string
+	width int
+	fixed bool // width was given, and values are truncated to it
+}
+
+type tableField struct {
+	name, text string
+}
+
+type tableFormat struct {
+	cols []tableColumn
+}
+
+// Params returns the "cols" parameter.
+func (tf tableFormat) Params() []string {
+	return []string{"cols"}
+}
+
+// WithParams returns the format showing the columns given by the "cols"
+// parameter.
+func (tf tableFormat) WithParams(params map[string]string) (source.GenericDataFormat, error) {
+	var cols []tableColumn
+	for _, spec := range strings.Split(params["cols"], ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		col := tableColumn{name: spec}
+		if i := strings.LastIndexByte(spec, ':'); i >= 0 {
+			width, err := strconv.Atoi(spec[i+1:])
+			if err != nil || width < 1 {
+				return nil, source.ErrInvalidParam
+			}
+			col.name, col.width, col.fixed = spec[:i], width, true
+		}
+		if !col.fixed {
+			col.width = tableDefaultWidth
+			if n := utf8.RuneCountInString(col.name); n > col.width {
+				col.width = n
+			}
+		}
+		cols = append(cols, col)
+	}
+	return tableFormat{cols}, nil
+}
+
+// Header returns the header row of the configured columns, if any.
+func (tf tableFormat) Header() ([]byte, error) {
+	if len(tf.cols) == 0 {
+		return nil, nil
+	}
+	var out bytes.Buffer
+	writeTableHeader(&out, tf.cols)
+	return bytes.TrimSuffix(out.Bytes(), []byte{'\n'}), nil
+}
+
+// MarshalGet renders the data as a table laid out to fit it.
+func (tf tableFormat) MarshalGet(data interface{}) ([]byte, error) {
+	rows, err := tableRows(data)
+	if err != nil {
+		return nil, err
+	}
+	cols := tf.fitColumns(rows)
+	var out bytes.Buffer
+	writeTableHeader(&out, cols)
+	for _, fields := range rows {
+		writeTableRow(&out, cols, fields)
+	}
+	return out.Bytes(), nil
+}
+
+// MarshalInit renders the header, and a row for each element of the data,
+// laid out as the watched items are.
+func (tf tableFormat) MarshalInit(data interface{}) ([]byte, error) {
+	rows, err := tableRows(data)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	if len(tf.cols) > 0 {
+		writeTableHeader(&out, tf.cols)
+	}
+	for _, fields := range rows {
+		tf.writeRow(&out, fields)
+	}
+	return bytes.TrimSuffix(out.Bytes(), []byte{'\n'}), nil
+}
+
+// MarshalItem renders the item as a row.
+func (tf tableFormat) MarshalItem(item interface{}) ([]byte, error) {
+	fields, err := tableFields(item)
+	if err != nil {
+		return nil, err
+	}
+	var out bytes.Buffer
+	tf.writeRow(&out, fields)
+	return bytes.TrimSuffix(out.Bytes(), []byte{'\n'}), nil
+}
+
+// FrameItem appends a newline to any rows.
+func (tf tableFormat) FrameItem(buf []byte) ([]byte, error) {
+	if len(buf) == 0 {
+		return buf, nil
+	}
+	return LDJSONMarshal.FrameItem(buf)
+}
+
+// writeRow writes the fields of a watched item in the configured columns, or
+// else all of them, in columns of the default width.
+func (tf tableFormat) writeRow(out *bytes.Buffer, fields []tableField) {
+	cols := tf.cols
+	if len(cols) == 0 {
+		cols = make([]tableColumn, len(fields))
+		for i, field := range fields {
+			cols[i] = tableColumn{name: field.name, width: tableDefaultWidth}
+		}
+	}
+	writeTableRow(out, cols, fields)
+}
+
+// fitColumns returns the configured columns, or else those of every field of
+// the rows, in order of appearance, widened to fit their names and values.
+func (tf tableFormat) fitColumns(rows [][]tableField) []tableColumn {
+	cols := append([]tableColumn(nil), tf.cols...)
+	if len(cols) == 0 {
+		seen := make(map[string]bool)
+		for _, fields := range rows {
+			for _, field := range fields {
+				if !seen[field.name] {
+					seen[field.name] = true
+					cols = append(cols, tableColumn{name: field.name})
+				}
+			}
+		}
+	}
+	for i := range cols {
+		col := &cols[i]
+		if col.fixed {
+			continue
+		}
+		col.width = utf8.RuneCountInString(col.name)
+		for _, fields := range rows {
+			if n := utf8.RuneCountInString(tableValue(fields, col.name)); n > col.width {
+				col.width = n
+			}
+		}
+	}
+	return cols
+}
+
+// tableRows returns the fields of each element of the data, if it's a slice,
+// or else of the data itself.
+func tableRows(data interface{}) ([][]tableField, error) {
+	items := []interface{}{data}
+	if _, ok := data.(json.Marshaler); !ok {
+		val := reflect.ValueOf(data)
+		switch val.Kind() {
+		case reflect.Slice, reflect.Array:
+			items = make([]interface{}, val.Len())
+			for i := range items {
+				items[i] = val.Index(i).Interface()
+			}
+		case reflect.Invalid:
+			items = nil
+		}
+	}
+	rows := make([][]tableField, len(items))
+	for i, item := range items {
+		fields, err := tableFields(item)
+		if err != nil {
+			return nil, err
+		}
+		rows[i] = fields
+	}
+	return rows, nil
+}
+
+// tableFields returns the fields of the item's json object, in order, or a
+// single "value" field if it isn't one.
+func tableFields(item interface{}) ([]tableField, error) {
+	buf, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return []tableField{{"value", tableText(buf)}}, nil
+	}
+	var fields []tableField
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		name, _ := tok.(string)
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, err
+		}
+		fields = append(fields, tableField{name, tableText(raw)})
+	}
+	return fields, nil
+}
+
+// tableText returns a json value as text on one line: strings unquoted, null
+// as nothing, and anything else as-is.
+func tableText(raw []byte) string {
+	text := string(raw)
+	switch {
+	case text == "null":
+		return ""
+	case strings.HasPrefix(text, `"`):
+		if err := json.Unmarshal(raw, &text); err != nil {
+			text = string(raw)
+		}
+	}
+	return tableSpaces.Replace(text)
+}
+
+var tableSpaces = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ", "\t", " ")
+
+// tableValue returns the text of the named field, or nothing.
+func tableValue(fields []tableField, name string) string {
+	for _, field := range fields {
+		if field.name == name {
+			return field.text
+		}
+	}
+	return ""
+}
+
+func writeTableHeader(out *bytes.Buffer, cols []tableColumn) {
+	names := make([]tableField, len(cols))
+	for i, col := range cols {
+		names[i] = tableField{col.name, strings.ToUpper(col.name)}
+	}
+	writeTableRow(out, cols, names)
+}
+
+// writeTableRow writes a line of the fields' values in the columns, each
+// padded to its width, or truncated to it if fixed, without any trailing
+// spaces.
+func writeTableRow(out *bytes.Buffer, cols []tableColumn, fields []tableField) {
+	start := out.Len()
+	for i, col := range cols {
+		if i > 0 {
+			out.WriteByte(' ')
+		}
+		text := tableValue(fields, col.name)
+		n := utf8.RuneCountInString(text)
+		if col.fixed && n > col.width {
+			text = truncateTableText(text, col.width)
+			n = col.width
+		}
+		out.WriteString(text)
+		if n < col.width {
+			out.WriteString(strings.Repeat(" ", col.width-n))
+		}
+	}
+	line := bytes.TrimRight(out.Bytes()[start:], " ")
+	out.Truncate(start + len(line))
+	out.WriteByte('\n')
+}
+
+// truncateTableText shortens text to width runes, marking it with an
+// ellipsis.
+func truncateTableText(text string, width int) string {
+	runes := []rune(text)
+	if width == 1 {
+		return string(runes[:1])
+	}
+	return string(runes[:width-1]) + "…"
+}
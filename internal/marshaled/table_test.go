@@ -0,0 +1,102 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package marshaled_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber-go/gwr/internal/marshaled"
+	"github.com/uber-go/gwr/source"
+)
+
+type tableItem struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Code   int    `json:"code"`
+}
+
+func TestTableMarshal(t *testing.T) {
+	buf, err := marshaled.TableMarshal.MarshalGet([]tableItem{
+		{"GET", "/", 200},
+		{"POST", "/things/new", 201},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, ""+
+		"METHOD PATH        CODE\n"+
+		"GET    /           200\n"+
+		"POST   /things/new 201\n",
+		string(buf), "get laid out to fit")
+
+	buf, err = marshaled.TableMarshal.MarshalItem(tableItem{"GET", "/", 200})
+	require.NoError(t, err)
+	assert.Equal(t, "GET        /          200", string(buf), "all fields without cols")
+
+	buf, err = marshaled.TableMarshal.MarshalItem("a\tb")
+	require.NoError(t, err)
+	assert.Equal(t, "a b", string(buf), "non-objects shown as a value")
+
+	for _, cols := range []string{"path:0", "path:x", "path:-1"} {
+		_, err := marshaled.TableMarshal.WithParams(map[string]string{"cols": cols})
+		assert.Equal(t, source.ErrInvalidParam, err, "invalid cols %q", cols)
+	}
+
+	format, err := marshaled.TableMarshal.WithParams(map[string]string{"cols": "code:4, path:6,nope"})
+	require.NoError(t, err)
+	header, err := format.(source.HeaderFormat).Header()
+	require.NoError(t, err)
+	assert.Equal(t, "CODE PATH   NOPE", string(header))
+	buf, err = format.MarshalItem(tableItem{"POST", "/things/new", 201})
+	require.NoError(t, err)
+	assert.Equal(t, "201  /thin…", string(buf), "picked columns, truncated to their widths")
+	buf, err = format.MarshalGet(tableItem{"GET", "/", 200})
+	require.NoError(t, err)
+	assert.Equal(t, "CODE PATH   NOPE\n200  /\n", string(buf), "gets keep given widths")
+}
+
+func TestDataSource_paramFormat(t *testing.T) {
+	tds := &testDataSource{activated: make(chan struct{}, 1)}
+	mds := marshaled.NewDataSource(tds, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	assert.Equal(t, source.ErrInvalidParam, mds.WatchContext(
+		source.WithFormatParams(ctx, map[string]string{"cols": "code:none"}),
+		"table", &bytes.Buffer{}), "invalid param")
+
+	var codes, paths bytes.Buffer
+	require.NoError(t, mds.WatchContext(
+		source.WithFormatParams(ctx, map[string]string{"cols": "code:4"}),
+		"table", &codes))
+	require.NoError(t, mds.WatchContext(
+		source.WithFormatParams(ctx, map[string]string{"cols": "path", "other": "ignored"}),
+		"table", &paths))
+	assert.Equal(t, 2, mds.Stats().FormatWatchers["table"], "variants counted under their format")
+
+	tds.emit(tableItem{"GET", "/a", 200})
+	mds.Drain()
+	assert.Equal(t, "CODE\n200\n", codes.String())
+	assert.Equal(t, "PATH\n/a\n", paths.String())
+}
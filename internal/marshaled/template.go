@@ -23,6 +23,7 @@ package marshaled
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"text/template"
 )
 
@@ -85,21 +86,28 @@ func (tm *TemplatedMarshal) MarshalInit(data interface{}) ([]byte, error) {
 // MarshalItem returns the rendered bytes from the item template.  If no item
 // template is defined, an error is returned.
 func (tm *TemplatedMarshal) MarshalItem(data interface{}) ([]byte, error) {
-	if len(tm.itemName) == 0 {
-		return nil, fmt.Errorf("streaming is unsupported by the data format; no item template defined")
-	}
 	var buf bytes.Buffer
-	if err := tm.tmpl.ExecuteTemplate(&buf, tm.itemName, data); err != nil {
+	if err := tm.MarshalItemTo(&buf, data); err != nil {
 		return nil, err
 	}
 	return buf.Bytes(), nil
 }
 
+// MarshalItemTo renders the item template directly to the writer, allowing
+// TemplatedMarshal to be used as a source.GenericDataStreamFormat.
+func (tm *TemplatedMarshal) MarshalItemTo(w io.Writer, data interface{}) error {
+	if len(tm.itemName) == 0 {
+		return fmt.Errorf("streaming is unsupported by the data format; no item template defined")
+	}
+	return tm.tmpl.ExecuteTemplate(w, tm.itemName, data)
+}
+
 // FrameItem appends a newline
 func (tm *TemplatedMarshal) FrameItem(json []byte) ([]byte, error) {
-	n := len(json)
-	frame := make([]byte, n+1)
-	copy(frame, json)
-	frame[n] = '\n'
-	return frame, nil
+	return LDJSONMarshal.FrameItem(json)
+}
+
+// AppendFrame appends the item and a newline to dst.
+func (tm *TemplatedMarshal) AppendFrame(dst, item []byte) ([]byte, error) {
+	return LDJSONMarshal.AppendFrame(dst, item)
 }
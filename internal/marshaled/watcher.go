@@ -21,10 +21,15 @@
 package marshaled
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"io"
 	"log"
+	"net/url"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/uber-go/gwr/internal"
 	"github.com/uber-go/gwr/source"
@@ -32,26 +37,161 @@ import (
 
 var errDefaultFrameWatcherDone = errors.New("all defaultFrameWatcher writers done")
 
+// bufPool holds buffers that GenericDataStreamFormats marshal items into.
+var bufPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
 // marshaledWatcher manages all of the low level io.Writers for a given format.
 // Instances are created once for each DataSource.
 //
 // DataSource then manages calling marshaledWatcher.emit for each data item as
 // long as there is one valid io.Writer for a given format.  Once the last
 // marshaledWatcher goes idle, the underlying GenericDataSource watch is ended.
+//
+// The embedded mutex guards the watchers list, since new watchers may be
+// added by DataSource.Watch while the item processor is emitting.
 type marshaledWatcher struct {
+	sync.Mutex
 	source   *DataSource
+	name     string
 	format   source.GenericDataFormat
 	dfw      defaultFrameWatcher
 	watchers []source.ItemWatcher
+
+	// numItemWatchers counts the watchers other than dfw; it's updated under
+	// the lock, but read atomically by numWatchers, since the lock is held
+	// while items are written.
+	numItemWatchers int32
+
+	// failures counts consecutive marshaling failures, and tripped is set
+	// once too many have happened; see marshalFailed.  Tripped has its own
+	// lock, so that it may be checked while items are being written.
+	failures    int
+	trippedLock sync.Mutex
+	tripped     *source.TrippedError
+
+	// project, if set, selects fields of items before they're marshaled.
+	project *projection
+
+	// variants holds a watcher for each configuration of the format, and
+	// projection of items, by its encoded parameters; the map is only ever
+	// replaced, under the DataSource's watchLock, so that it may be read
+	// without it.
+	variants atomic.Value
 }
 
-func newMarshaledWatcher(src *DataSource, format source.GenericDataFormat) *marshaledWatcher {
-	mw := &marshaledWatcher{source: src, format: format}
+func newMarshaledWatcher(src *DataSource, name string, format source.GenericDataFormat) *marshaledWatcher {
+	mw := &marshaledWatcher{source: src, name: name, format: format}
+	mw.dfw.name = src.source.Name()
 	mw.dfw.format = format
+	mw.dfw.stats = &src.stats
 	return mw
 }
 
 func (mw *marshaledWatcher) Close() error {
+	mw.Lock()
+	err := mw.closeLocked()
+	mw.Unlock()
+	for _, variant := range mw.loadVariants() {
+		if verr := variant.Close(); err == nil {
+			err = verr
+		}
+	}
+	return err
+}
+
+// loadVariants returns the watchers of each configuration of the format.
+func (mw *marshaledWatcher) loadVariants() map[string]*marshaledWatcher {
+	variants, _ := mw.variants.Load().(map[string]*marshaledWatcher)
+	return variants
+}
+
+// variant returns the watcher of the format as configured by any of the
+// params that it takes, and projecting items to any fields param, creating
+// it if need be, or mw itself if none apply; it must be called with the
+// DataSource's watchLock held.  Any idle variants are dropped when a new one
+// is created.
+func (mw *marshaledWatcher) variant(params map[string]string) (*marshaledWatcher, error) {
+	vals := mw.variantParams(params)
+	if len(vals) == 0 {
+		return mw, nil
+	}
+	key := vals.Encode()
+	variants := mw.loadVariants()
+	if variant, ok := variants[key]; ok {
+		return variant, nil
+	}
+	format, pr, err := mw.configure(vals)
+	if err != nil {
+		return nil, err
+	}
+	variant := newMarshaledWatcher(mw.source, mw.name, format)
+	variant.project = pr
+	next := make(map[string]*marshaledWatcher, len(variants)+1)
+	for other, ow := range variants {
+		if !ow.idle() {
+			next[other] = ow
+		}
+	}
+	next[key] = variant
+	mw.variants.Store(next)
+	return variant, nil
+}
+
+// configure returns the format as configured by the values that it takes,
+// by calling its WithParams, and the projection of any fields value; any
+// panic is returned as a *source.PanicError.
+func (mw *marshaledWatcher) configure(vals url.Values) (format source.GenericDataFormat, pr *projection, err error) {
+	defer recoverPanic(mw.dfw.name, "configure format", &err)
+	format = mw.format
+	params := make(map[string]string, len(vals))
+	for name := range vals {
+		if name == fieldsParam {
+			if pr, err = parseProjection(vals.Get(name)); err != nil {
+				return nil, nil, err
+			}
+		} else {
+			params[name] = vals.Get(name)
+		}
+	}
+	if pf, ok := format.(source.ParamFormat); ok && len(params) > 0 {
+		format, err = pf.WithParams(params)
+	}
+	return format, pr, err
+}
+
+// variantParams returns those of the params that configure the format, and
+// any fields param.
+func (mw *marshaledWatcher) variantParams(params map[string]string) url.Values {
+	var vals url.Values
+	if pf, ok := mw.format.(source.ParamFormat); ok {
+		vals = paramsFor(pf, params)
+	}
+	if fields, ok := params[fieldsParam]; ok {
+		if vals == nil {
+			vals = make(url.Values)
+		}
+		vals.Set(fieldsParam, fields)
+	}
+	return vals
+}
+
+// paramsFor returns those of the params that configure the format.
+func paramsFor(pf source.ParamFormat, params map[string]string) url.Values {
+	var vals url.Values
+	for _, name := range pf.Params() {
+		if val, ok := params[name]; ok {
+			if vals == nil {
+				vals = make(url.Values)
+			}
+			vals.Set(name, val)
+		}
+	}
+	return vals
+}
+
+func (mw *marshaledWatcher) closeLocked() error {
 	var errs []error
 	for _, watcher := range mw.watchers {
 		if closer, ok := watcher.(io.Closer); ok {
@@ -64,50 +204,281 @@ func (mw *marshaledWatcher) Close() error {
 		}
 	}
 	mw.watchers = mw.watchers[:0]
+	mw.countLocked()
 	return internal.MultiErr(errs).AsError()
 }
 
-func (mw *marshaledWatcher) init(w io.Writer) error {
-	if mw.source.watiSource != nil {
-		initData := mw.source.watiSource.WatchInit()
-		if err := mw.dfw.writeInitData(initData, w); err != nil {
+// init writes any init data, or a backlog of up to n items if n > 0, to the
+// writer, and then adds it to the writers that items are framed to; since the
+// lock is held throughout, no item is written to it out of order.
+func (mw *marshaledWatcher) init(w io.Writer, backlog int) error {
+	mw.Lock()
+	defer mw.Unlock()
+	if backlog > 0 {
+		if err := mw.writeBacklog(backlog, w); err != nil {
 			return err
 		}
+	} else if err := mw.writeInit(unlimitedWriter(w)); err != nil {
+		return err
 	}
+	mw.dfw.Lock()
 	mw.dfw.writers = append(mw.dfw.writers, w)
-	if len(mw.dfw.writers) == 1 {
+	mw.dfw.countLocked()
+	first := len(mw.dfw.writers) == 1
+	mw.dfw.Unlock()
+	if first {
 		mw.watchers = append(mw.watchers, &mw.dfw)
 	}
 	return nil
 }
 
 func (mw *marshaledWatcher) initItems(iw source.ItemWatcher) error {
+	mw.Lock()
+	defer mw.Unlock()
+	buf, err := mw.initData()
+	if err != nil {
+		log.Printf("initial marshaling error %v", err)
+		return err
+	}
+	if buf != nil {
+		if err := unlimitedItemWatcher(iw).HandleItem(buf); err != nil {
+			return err
+		}
+		mw.source.stats.wrote(len(buf))
+	}
+	mw.watchers = append(mw.watchers, iw)
+	mw.countLocked()
+	return nil
+}
+
+// removeWriter removes a writer added by init, if it's still present.
+func (mw *marshaledWatcher) removeWriter(w io.Writer) {
+	mw.Lock()
+	defer mw.Unlock()
+	mw.dfw.Lock()
+	for i, other := range mw.dfw.writers {
+		if other == w {
+			mw.dfw.writers = append(mw.dfw.writers[:i], mw.dfw.writers[i+1:]...)
+			break
+		}
+	}
+	mw.dfw.countLocked()
+	empty := len(mw.dfw.writers) == 0
+	mw.dfw.Unlock()
+	if empty {
+		mw.removeLocked(&mw.dfw)
+	}
+}
+
+// removeItemWatcher removes an item watcher added by initItems, if it's still
+// present.
+func (mw *marshaledWatcher) removeItemWatcher(iw source.ItemWatcher) {
+	mw.Lock()
+	defer mw.Unlock()
+	mw.removeLocked(iw)
+}
+
+func (mw *marshaledWatcher) removeLocked(iw source.ItemWatcher) {
+	for i, other := range mw.watchers {
+		if other == iw {
+			mw.watchers = append(mw.watchers[:i], mw.watchers[i+1:]...)
+			mw.countLocked()
+			return
+		}
+	}
+}
+
+// countLocked updates numItemWatchers; it must be called after every change
+// to the watchers list.
+func (mw *marshaledWatcher) countLocked() {
+	n := 0
+	for _, iw := range mw.watchers {
+		if iw != &mw.dfw {
+			n++
+		}
+	}
+	atomic.StoreInt32(&mw.numItemWatchers, int32(n))
+}
+
+// numWatchers returns the number of writers and item watchers, including
+// those of any variants, without taking the lock.
+func (mw *marshaledWatcher) numWatchers() int {
+	n := int(atomic.LoadInt32(&mw.numItemWatchers)) +
+		int(atomic.LoadInt32(&mw.dfw.numWriters))
+	for _, variant := range mw.loadVariants() {
+		n += variant.numWatchers()
+	}
+	return n
+}
+
+// idle returns true if there are no watchers left, of it or any variant.
+func (mw *marshaledWatcher) idle() bool {
+	mw.Lock()
+	n := len(mw.watchers)
+	mw.Unlock()
+	if n > 0 {
+		return false
+	}
+	for _, variant := range mw.loadVariants() {
+		if !variant.idle() {
+			return false
+		}
+	}
+	return true
+}
+
+// writeInit writes any init data to the writer.
+func (mw *marshaledWatcher) writeInit(w io.Writer) error {
+	buf, err := mw.initData()
+	if err != nil {
+		log.Printf("initial marshaling error %v", err)
+		return err
+	}
+	if buf == nil {
+		return nil
+	}
+	return mw.dfw.writeInitData(buf, w)
+}
+
+// writeHeader writes any header of the format to the writer.
+func (mw *marshaledWatcher) writeHeader(w io.Writer) error {
+	buf, err := mw.header()
+	if err != nil {
+		log.Printf("header marshaling error %v", err)
+		return err
+	}
+	if buf == nil {
+		return nil
+	}
+	return mw.dfw.writeInitData(buf, w)
+}
+
+// initData returns the marshaled init data, if the source has any, or else
+// any header of the format, or nil if there's neither.
+func (mw *marshaledWatcher) initData() ([]byte, error) {
 	if mw.source.watiSource != nil {
-		initData := mw.source.watiSource.WatchInit()
-		if buf, err := mw.format.MarshalInit(initData); err != nil {
-			log.Printf("initial marshaling error %v", err)
+		return mw.marshalInit()
+	}
+	return mw.header()
+}
+
+// header returns the format's header, if it's a source.HeaderFormat; any
+// panic is returned as a *source.PanicError.
+func (mw *marshaledWatcher) header() (buf []byte, err error) {
+	hf, ok := mw.format.(source.HeaderFormat)
+	if !ok {
+		return nil, nil
+	}
+	defer recoverPanic(mw.dfw.name, "header", &err)
+	return hf.Header()
+}
+
+// marshalInit calls the wrapped source's WatchInit, and marshals the result,
+// projected like items are; any panic is returned as a *source.PanicError.
+func (mw *marshaledWatcher) marshalInit() (buf []byte, err error) {
+	defer recoverPanic(mw.dfw.name, "watch init", &err)
+	initData := source.ApplyTypeMarshalers(mw.source.watiSource.WatchInit())
+	if mw.project != nil {
+		initData = mw.project.apply(initData)
+	}
+	return mw.format.MarshalInit(initData)
+}
+
+// writeBacklog writes any header, and up to n of the source's most recent
+// items, each framed as an item, to the writer, or its init data if it
+// retains none, and then ends the backlog, if the writer is a
+// source.BacklogWriter.
+func (mw *marshaledWatcher) writeBacklog(n int, w io.Writer) error {
+	w = unlimitedWriter(w)
+	var items []interface{}
+	if mw.source.backSource == nil {
+		if err := mw.writeInit(w); err != nil {
+			return err
+		}
+	} else {
+		var err error
+		if items, err = mw.backlog(n); err != nil {
+			log.Printf("backlog error %v", err)
 			return err
-		} else if err := iw.HandleItem(buf); err != nil {
+		}
+		if err := mw.writeHeader(w); err != nil {
 			return err
 		}
 	}
-	mw.watchers = append(mw.watchers, iw)
+	var buf bytes.Buffer
+	for _, item := range items {
+		data, _, err := mw.marshalItem(&buf, item)
+		if err != nil {
+			mw.source.stats.marshalError()
+			log.Printf("backlog marshaling error %v", err)
+			data = mw.fallbackFrame(item)
+		}
+		if err := mw.dfw.writeInitData(data, w); err != nil {
+			return err
+		}
+	}
+	if cw, ok := w.(*ctxWriter); ok {
+		w = cw.Writer
+	}
+	if bw, ok := w.(source.BacklogWriter); ok {
+		return bw.EndBacklog(len(items))
+	}
 	return nil
 }
 
-func (mw *marshaledWatcher) emit(item interface{}) bool {
+// backlog calls the wrapped source's Backlog; any panic is returned as a
+// *source.PanicError.
+func (mw *marshaledWatcher) backlog(n int) (items []interface{}, err error) {
+	defer recoverPanic(mw.dfw.name, "backlog", &err)
+	return mw.source.backSource.Backlog(n), nil
+}
+
+// emit marshals and passes an item to every watcher, unless the source's
+// rate limiter drops it; at is the time that the item was handled, if known,
+// and is passed along to any TimedItemWatchers.
+func (mw *marshaledWatcher) emit(rl *source.RateLimiter, at time.Time, item interface{}) bool {
+	mw.Lock()
+	defer mw.Unlock()
 	if len(mw.watchers) == 0 {
 		return false
 	}
-	data, err := mw.format.MarshalItem(item)
+	buf := bufPool.Get().(*bytes.Buffer)
+	defer bufPool.Put(buf)
+	data, pooled, err := mw.marshalItem(buf, item)
 	if err != nil {
-		log.Printf("item marshaling error %v", err)
-		return false
+		if !mw.marshalFailed(err) {
+			return false
+		}
+		data, pooled = mw.fallbackFrame(item), false
+	} else {
+		mw.failures = 0
+	}
+	if !rl.Allow(len(data)) {
+		mw.source.stats.drop(1)
+		return true
+	}
+
+	// pooled data is only safe to hand to the defaultFrameWatcher, which
+	// doesn't retain it; any other watcher gets a single shared copy.
+	var owned []byte
+	if !pooled {
+		owned = data
 	}
 
 	var failed []int // TODO: could carry this rather than allocate on failure
 	for i, iw := range mw.watchers {
-		if err := iw.HandleItem(data); err != nil {
+		var err error
+		if iw == source.ItemWatcher(&mw.dfw) {
+			err = iw.HandleItem(data)
+		} else {
+			if owned == nil {
+				owned = append([]byte(nil), data...)
+			}
+			if err = handleItem(iw, at, owned); err == nil {
+				mw.source.stats.wrote(len(owned))
+			}
+		}
+		if err != nil {
 			if failed == nil {
 				failed = make([]int, 0, len(mw.watchers))
 			}
@@ -140,28 +511,52 @@ func (mw *marshaledWatcher) emit(item interface{}) bool {
 		}
 	}
 	mw.watchers = okay
+	mw.countLocked()
 
 	return len(mw.watchers) != 0
 }
 
-func (mw *marshaledWatcher) emitBatch(items []interface{}) bool {
+func (mw *marshaledWatcher) emitBatch(rl *source.RateLimiter, at time.Time, items []interface{}) bool {
+	mw.Lock()
+	defer mw.Unlock()
 	if len(mw.watchers) == 0 {
 		return false
 	}
 
-	data := make([][]byte, len(items))
-	for i, item := range items {
-		buf, err := mw.format.MarshalItem(item)
-		if err != nil {
-			log.Printf("item marshaling error %v", err)
-			return false
-		}
-		data[i] = buf
+	buf := bufPool.Get().(*bytes.Buffer)
+	defer bufPool.Put(buf)
+	data, pooled, ok := mw.marshalItems(buf, items)
+	if !ok {
+		return false
+	}
+	if data = allowItems(rl, &mw.source.stats, data); len(data) == 0 {
+		return true
+	}
+
+	var owned [][]byte
+	if !pooled {
+		owned = data
 	}
 
 	var failed []int // TODO: could carry this rather than allocate on failure
 	for i, iw := range mw.watchers {
-		if err := iw.HandleItems(data); err != nil {
+		var err error
+		if iw == source.ItemWatcher(&mw.dfw) {
+			err = iw.HandleItems(data)
+		} else {
+			if owned == nil {
+				owned = make([][]byte, len(data))
+				for j, item := range data {
+					owned[j] = append([]byte(nil), item...)
+				}
+			}
+			if err = handleItems(iw, at, owned); err == nil {
+				for _, item := range owned {
+					mw.source.stats.wrote(len(item))
+				}
+			}
+		}
+		if err != nil {
 			if failed == nil {
 				failed = make([]int, 0, len(mw.watchers))
 			}
@@ -194,38 +589,205 @@ func (mw *marshaledWatcher) emitBatch(items []interface{}) bool {
 		}
 	}
 	mw.watchers = okay
+	mw.countLocked()
 
 	return len(mw.watchers) != 0
 }
 
+// allowItems returns those of the items that the rate limiter allows,
+// counting the rest as dropped.
+func allowItems(rl *source.RateLimiter, stats *dataSourceStats, items [][]byte) [][]byte {
+	if rl == nil {
+		return items
+	}
+	var allowed [][]byte
+	for i, item := range items {
+		if rl.Allow(len(item)) {
+			if allowed != nil {
+				allowed = append(allowed, item)
+			}
+			continue
+		}
+		stats.drop(1)
+		if allowed == nil {
+			allowed = make([][]byte, i, len(items))
+			copy(allowed, items[:i])
+		}
+	}
+	if allowed == nil {
+		return items
+	}
+	return allowed
+}
+
+// handleItem passes an item to a watcher, using HandleTimedItem if the time
+// is known and the watcher wants it.
+func handleItem(iw source.ItemWatcher, at time.Time, item []byte) error {
+	if tiw, ok := iw.(source.TimedItemWatcher); ok && !at.IsZero() {
+		return tiw.HandleTimedItem(at, item)
+	}
+	return iw.HandleItem(item)
+}
+
+// handleItems is the batch form of handleItem.
+func handleItems(iw source.ItemWatcher, at time.Time, items [][]byte) error {
+	if tiw, ok := iw.(source.TimedItemWatcher); ok && !at.IsZero() {
+		return tiw.HandleTimedItems(at, items)
+	}
+	return iw.HandleItems(items)
+}
+
+// isTimed returns true if the watcher, or the one wrapped by a
+// ctxItemWatcher, is a TimedItemWatcher.
+func isTimed(iw source.ItemWatcher) bool {
+	if ciw, ok := iw.(*ctxItemWatcher); ok {
+		iw = ciw.ItemWatcher
+	}
+	_, ok := iw.(source.TimedItemWatcher)
+	return ok
+}
+
+// marshalItem marshals a single item; if the format is a
+// GenericDataStreamFormat, the item is marshaled into the passed buffer, and
+// pooled is true to indicate that the returned data aliases it.
+func (mw *marshaledWatcher) marshalItem(buf *bytes.Buffer, item interface{}) (data []byte, pooled bool, err error) {
+	_, pooled = mw.format.(source.GenericDataStreamFormat)
+	buf.Reset()
+	if data, err = mw.marshalInto(buf, item); err != nil {
+		return nil, false, err
+	}
+	if pooled {
+		data = buf.Bytes()
+	}
+	return data, pooled, nil
+}
+
+// marshalItems is the batch form of marshalItem; stream formatted items are
+// all marshaled back-to-back into the passed buffer.  Any item that fails to
+// marshal is replaced by a fallback frame, as long as the failure doesn't
+// trip the format, in which case ok is false.  It assumes that the
+// marshaledWatcher lock is being held by the caller.
+func (mw *marshaledWatcher) marshalItems(buf *bytes.Buffer, items []interface{}) (data [][]byte, pooled, ok bool) {
+	_, pooled = mw.format.(source.GenericDataStreamFormat)
+	data = make([][]byte, len(items))
+	var ends []int
+	if pooled {
+		ends = make([]int, len(items))
+	}
+
+	buf.Reset()
+	for i, item := range items {
+		start := buf.Len()
+		itemData, err := mw.marshalInto(buf, item)
+		if err != nil {
+			if !mw.marshalFailed(err) {
+				return nil, false, false
+			}
+			itemData = mw.fallbackFrame(item)
+			if pooled {
+				buf.Truncate(start)
+				buf.Write(itemData)
+			}
+		} else {
+			mw.failures = 0
+		}
+		if pooled {
+			ends[i] = buf.Len()
+		} else {
+			data[i] = itemData
+		}
+	}
+	if !pooled {
+		return data, false, true
+	}
+
+	b, start := buf.Bytes(), 0
+	for i, end := range ends {
+		data[i] = b[start:end:end]
+		start = end
+	}
+	return data, true, true
+}
+
+// marshalInto marshals an item, appending it to the buffer if the format is
+// a GenericDataStreamFormat, otherwise returning it; any panic is returned as
+// a *source.PanicError.
+func (mw *marshaledWatcher) marshalInto(buf *bytes.Buffer, item interface{}) (data []byte, err error) {
+	defer recoverPanic(mw.dfw.name, "marshal item", &err)
+	item = source.ApplyTypeMarshalers(item)
+	if mw.project != nil {
+		item = mw.project.apply(item)
+	}
+	if sf, ok := mw.format.(source.GenericDataStreamFormat); ok {
+		return nil, sf.MarshalItemTo(buf, item)
+	}
+	return mw.format.MarshalItem(item)
+}
+
 type defaultFrameWatcher struct {
 	sync.Mutex
+	name    string
 	format  source.GenericDataFormat
 	writers []io.Writer
+	stats   *dataSourceStats
+
+	// numWriters mirrors len(writers) for numWatchers
+	numWriters int32
+
+	// frame is reused to frame items if the format is a
+	// source.GenericDataAppendFormat; like HandleItem(s), it's guarded by the
+	// marshaledWatcher lock.
+	frame []byte
 }
 
-func (dfw *defaultFrameWatcher) writeInitData(data interface{}, w io.Writer) error {
-	buf, err := dfw.format.MarshalInit(data)
-	if err != nil {
-		log.Printf("initial marshaling error %v", err)
-		return err
+// maxFrameReuse bounds the size of a frame buffer kept for reuse, so that one
+// large item doesn't pin its memory for the life of the watch.
+const maxFrameReuse = 64 * 1024
+
+// countLocked updates numWriters; it must be called after every change to the
+// writers list.
+func (dfw *defaultFrameWatcher) countLocked() {
+	atomic.StoreInt32(&dfw.numWriters, int32(len(dfw.writers)))
+}
+
+func (dfw *defaultFrameWatcher) frameItem(item []byte) (buf []byte, err error) {
+	defer recoverPanic(dfw.name, "frame item", &err)
+	return dfw.format.FrameItem(item)
+}
+
+// appendFrame frames an item into the reused frame buffer, if the format is a
+// source.GenericDataAppendFormat, or else calls frameItem; the returned frame
+// is only valid until the next call.
+func (dfw *defaultFrameWatcher) appendFrame(item []byte) (buf []byte, err error) {
+	af, ok := dfw.format.(source.GenericDataAppendFormat)
+	if !ok {
+		return dfw.frameItem(item)
 	}
-	buf, err = dfw.format.FrameItem(buf)
+	defer recoverPanic(dfw.name, "frame item", &err)
+	if cap(dfw.frame) > maxFrameReuse {
+		dfw.frame = nil
+	}
+	buf, err = af.AppendFrame(dfw.frame[:0], item)
+	dfw.frame = buf
+	return buf, err
+}
+
+func (dfw *defaultFrameWatcher) writeInitData(buf []byte, w io.Writer) error {
+	buf, err := dfw.frameItem(buf)
 	if err != nil {
 		log.Printf("initial framing error %v", err)
 		return err
 	}
-	if _, err := w.Write(buf); err != nil {
-		return err
-	}
-	return nil
+	n, err := w.Write(buf)
+	dfw.stats.wrote(n)
+	return err
 }
 
 func (dfw *defaultFrameWatcher) HandleItem(item []byte) error {
 	if len(dfw.writers) == 0 {
 		return errDefaultFrameWatcherDone
 	}
-	buf, err := dfw.format.FrameItem(item)
+	buf, err := dfw.appendFrame(item)
 	if err != nil {
 		log.Printf("item framing error %v", err)
 		return err
@@ -241,7 +803,7 @@ func (dfw *defaultFrameWatcher) HandleItems(items [][]byte) error {
 		return errDefaultFrameWatcherDone
 	}
 	for _, item := range items {
-		buf, err := dfw.format.FrameItem(item)
+		buf, err := dfw.appendFrame(item)
 		if err != nil {
 			log.Printf("item framing error %v", err)
 			return err
@@ -257,6 +819,7 @@ func (dfw *defaultFrameWatcher) Close() error {
 	dfw.Lock()
 	writers := dfw.writers
 	dfw.writers = nil
+	dfw.countLocked()
 	dfw.Unlock()
 
 	var errs []error
@@ -283,7 +846,12 @@ func (dfw *defaultFrameWatcher) writeToAll(buf []byte) error {
 
 	var failed []int // TODO: could carry this rather than allocate on failure
 	for i, w := range dfw.writers {
-		if _, err := w.Write(buf); err != nil {
+		if !allow(w, buf) {
+			continue
+		}
+		n, err := w.Write(buf)
+		dfw.stats.wrote(n)
+		if err != nil {
 			if failed == nil {
 				failed = make([]int, 0, len(dfw.writers))
 			}
@@ -316,9 +884,121 @@ func (dfw *defaultFrameWatcher) writeToAll(buf []byte) error {
 		}
 	}
 	dfw.writers = okay
+	dfw.countLocked()
 
 	if len(dfw.writers) == 0 {
 		return errDefaultFrameWatcherDone
 	}
 	return nil
 }
+
+// ctxWriter wraps a writer passed to DataSource.WatchContext; it fails any
+// write that races with the context being done.  Items that the context's
+// rate limiter doesn't allow are dropped before they're written, by allow,
+// so that they're neither counted as bytes nor end the watch.
+type ctxWriter struct {
+	io.Writer
+	ctx     context.Context
+	limiter *source.RateLimiter
+	stats   *dataSourceStats
+}
+
+func (cw *ctxWriter) Write(p []byte) (int, error) {
+	if err := cw.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return cw.Writer.Write(p)
+}
+
+// allow returns true if a framed item may be written to w, i.e. unless w is a
+// rate limited ctxWriter whose limit it's over, in which case the item is
+// counted as dropped.
+func allow(w io.Writer, frame []byte) bool {
+	cw, ok := w.(*ctxWriter)
+	if !ok || cw.limiter.Allow(len(frame)) {
+		return true
+	}
+	cw.stats.drop(1)
+	return false
+}
+
+func (cw *ctxWriter) Close() error {
+	if closer, ok := cw.Writer.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// unlimitedWriter returns w without any rate limit, for writing init data,
+// which a watch never goes without.
+func unlimitedWriter(w io.Writer) io.Writer {
+	if cw, ok := w.(*ctxWriter); ok && cw.limiter != nil {
+		return &ctxWriter{Writer: cw.Writer, ctx: cw.ctx}
+	}
+	return w
+}
+
+// ctxItemWatcher is the ItemWatcher analog of ctxWriter.
+type ctxItemWatcher struct {
+	source.ItemWatcher
+	ctx     context.Context
+	limiter *source.RateLimiter
+	stats   *dataSourceStats
+}
+
+func (ciw *ctxItemWatcher) HandleItem(item []byte) error {
+	if err := ciw.ctx.Err(); err != nil {
+		return err
+	}
+	if !ciw.limiter.Allow(len(item)) {
+		ciw.stats.drop(1)
+		return nil
+	}
+	return ciw.ItemWatcher.HandleItem(item)
+}
+
+func (ciw *ctxItemWatcher) HandleItems(items [][]byte) error {
+	if err := ciw.ctx.Err(); err != nil {
+		return err
+	}
+	if items = allowItems(ciw.limiter, ciw.stats, items); len(items) == 0 {
+		return nil
+	}
+	return ciw.ItemWatcher.HandleItems(items)
+}
+
+func (ciw *ctxItemWatcher) HandleTimedItem(t time.Time, item []byte) error {
+	if err := ciw.ctx.Err(); err != nil {
+		return err
+	}
+	if !ciw.limiter.Allow(len(item)) {
+		ciw.stats.drop(1)
+		return nil
+	}
+	return handleItem(ciw.ItemWatcher, t, item)
+}
+
+func (ciw *ctxItemWatcher) HandleTimedItems(t time.Time, items [][]byte) error {
+	if err := ciw.ctx.Err(); err != nil {
+		return err
+	}
+	if items = allowItems(ciw.limiter, ciw.stats, items); len(items) == 0 {
+		return nil
+	}
+	return handleItems(ciw.ItemWatcher, t, items)
+}
+
+// unlimitedItemWatcher is the ItemWatcher analog of unlimitedWriter.
+func unlimitedItemWatcher(iw source.ItemWatcher) source.ItemWatcher {
+	if ciw, ok := iw.(*ctxItemWatcher); ok && ciw.limiter != nil {
+		return &ctxItemWatcher{ItemWatcher: ciw.ItemWatcher, ctx: ciw.ctx}
+	}
+	return iw
+}
+
+func (ciw *ctxItemWatcher) Close() error {
+	if closer, ok := ciw.ItemWatcher.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package meta
+
+import (
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/uber-go/gwr/source"
+)
+
+// BuildName is the name of the build info data source.
+const BuildName = "/meta/build"
+
+var buildTextTemplate = template.Must(template.New("meta_build_text").Parse(strings.TrimSpace(`
+{{ define "get" -}}
+{{ with .Service }}service: {{ . }}
+{{ end }}{{ with .Instance }}instance: {{ . }}
+{{ end }}{{ with .Zone }}zone: {{ . }}
+{{ end }}{{ with .Path }}main: {{ . }} {{ $.Version }}
+{{ end }}{{ with .Revision }}revision: {{ . }}
+{{ end }}go: {{ .GoVersion }}
+host: {{ .Hostname }} pid {{ .Pid }}
+started: {{ .Started.Format "2006-01-02T15:04:05Z07:00" }}
+{{ end }}
+`)))
+
+// Build describes this process: its identity, what it was built from, and
+// when it started.
+type Build struct {
+	source.Identity
+	Path      string    `json:"path,omitempty"`
+	Version   string    `json:"version,omitempty"`
+	Revision  string    `json:"revision,omitempty"`
+	GoVersion string    `json:"go_version"`
+	Hostname  string    `json:"hostname"`
+	Pid       int       `json:"pid"`
+	Started   time.Time `json:"started"`
+}
+
+// BuildDataSource provides the "/meta/build" source, describing the process,
+// with the identity set by source.SetIdentity.
+type BuildDataSource struct {
+	build Build
+}
+
+// NewBuildDataSource creates a new BuildDataSource; the process is taken to
+// have started when it's called.
+func NewBuildDataSource() *BuildDataSource {
+	build := Build{
+		GoVersion: runtime.Version(),
+		Pid:       os.Getpid(),
+		Started:   time.Now(),
+	}
+	build.Hostname, _ = os.Hostname()
+	if info, ok := debug.ReadBuildInfo(); ok {
+		build.Path = info.Main.Path
+		build.Version = info.Main.Version
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				build.Revision = setting.Value
+			}
+		}
+	}
+	return &BuildDataSource{build: build}
+}
+
+// Name returns the static "/meta/build" string.
+func (bds *BuildDataSource) Name() string {
+	return BuildName
+}
+
+// TextTemplate returns a text/template listing the build info.
+func (bds *BuildDataSource) TextTemplate() *template.Template {
+	return buildTextTemplate
+}
+
+// Get returns the Build, with the current identity.
+func (bds *BuildDataSource) Get() interface{} {
+	build := bds.build
+	build.Identity = source.ProcessIdentity()
+	return build
+}
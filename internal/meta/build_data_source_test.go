@@ -0,0 +1,55 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package meta_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber-go/gwr/internal/marshaled"
+	"github.com/uber-go/gwr/internal/meta"
+	"github.com/uber-go/gwr/source"
+)
+
+func TestBuildDataSource(t *testing.T) {
+	defer source.SetIdentity(source.ProcessIdentity())
+	source.SetIdentity(source.Identity{Service: "api", Instance: "api-1", Zone: "us-east-1a"})
+
+	mds := marshaled.NewDataSource(meta.NewBuildDataSource(), nil)
+	var buf bytes.Buffer
+	require.NoError(t, mds.Get("json", &buf))
+	var build map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &build))
+	assert.Equal(t, "api", build["service"])
+	assert.Equal(t, "api-1", build["instance"])
+	assert.Equal(t, "us-east-1a", build["zone"])
+	assert.Equal(t, float64(os.Getpid()), build["pid"])
+	assert.NotEmpty(t, build["go_version"])
+
+	buf.Reset()
+	require.NoError(t, mds.Get("text", &buf))
+	assert.Contains(t, buf.String(), "service: api\ninstance: api-1\nzone: us-east-1a\n")
+}
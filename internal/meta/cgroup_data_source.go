@@ -0,0 +1,262 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package meta
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/uber-go/gwr/source"
+)
+
+// CgroupName is the name of the runtime cgroup data source.
+const CgroupName = "/runtime/cgroup"
+
+// cgroupPollInterval is how often the cgroup is re-read while the cgroup
+// source is watched.
+const cgroupPollInterval = 5 * time.Second
+
+var cgroupTextTemplate = template.Must(template.New("runtime_cgroup_text").Parse(strings.TrimSpace(`
+{{ define "get" }}{{ template "item" . }}{{ end }}
+{{ define "item" -}}
+cgroup v{{ .Version }} {{ .Path }}
+cpu: limit={{ if .CPULimit }}{{ printf "%.2f" .CPULimit }} cores{{ else }}none{{ end }} usage={{ printf "%.2f" .CPUUsageSeconds }}s throttled={{ .CPUThrottledPeriods }}/{{ .CPUPeriods }} periods ({{ printf "%.2f" .CPUThrottledSeconds }}s)
+memory: limit={{ if .MemoryLimitBytes }}{{ .MemoryLimitBytes }}{{ else }}none{{ end }} usage={{ .MemoryUsageBytes }}
+{{- end }}
+`)))
+
+// CgroupStats describes the resource limits, and usage, of the cgroup that
+// this process runs in.  Zero limits mean unlimited.
+type CgroupStats struct {
+	Version             int     `json:"version"`
+	Path                string  `json:"path"`
+	CPULimit            float64 `json:"cpu_limit"`
+	CPUUsageSeconds     float64 `json:"cpu_usage_seconds"`
+	CPUPeriods          int64   `json:"cpu_periods"`
+	CPUThrottledPeriods int64   `json:"cpu_throttled_periods"`
+	CPUThrottledSeconds float64 `json:"cpu_throttled_seconds"`
+	MemoryLimitBytes    int64   `json:"memory_limit_bytes"`
+	MemoryUsageBytes    int64   `json:"memory_usage_bytes"`
+}
+
+// CgroupDataSource provides a data source that reports the cpu quota and
+// throttling, and memory limit and usage, of this process's cgroup, read from
+// either cgroup v1 or v2 files.  It is used to implement the
+// "/runtime/cgroup" data source.  While watched, new stats are emitted every
+// few seconds.
+type CgroupDataSource struct {
+	poller
+	procCgroup string
+	sysRoot    string
+}
+
+// NewCgroupDataSource creates a new data source that reports this process's
+// cgroup.
+func NewCgroupDataSource() *CgroupDataSource {
+	return newCgroupDataSource("/proc/self/cgroup", "/sys/fs/cgroup")
+}
+
+func newCgroupDataSource(procCgroup, sysRoot string) *CgroupDataSource {
+	cgds := &CgroupDataSource{
+		procCgroup: procCgroup,
+		sysRoot:    sysRoot,
+	}
+	cgds.poller = poller{
+		interval: cgroupPollInterval,
+		get:      cgds.Get,
+	}
+	return cgds
+}
+
+// Name returns the static "/runtime/cgroup" string.
+func (cgds *CgroupDataSource) Name() string {
+	return CgroupName
+}
+
+// TextTemplate returns a text/template to implement the GenericDataSource with
+// a "text" format option.
+func (cgds *CgroupDataSource) TextTemplate() *template.Template {
+	return cgroupTextTemplate
+}
+
+// EmptyGet returns EmptyGetNotFound, since there are no stats when this
+// process isn't in a cgroup, e.g. when not on Linux.
+func (cgds *CgroupDataSource) EmptyGet() source.EmptyGetPolicy {
+	return source.EmptyGetNotFound
+}
+
+// Get returns the current *CgroupStats, or nil if there's no cgroup.
+func (cgds *CgroupDataSource) Get() interface{} {
+	paths := cgds.paths()
+	if paths == nil {
+		return (*CgroupStats)(nil)
+	}
+	if path, ok := paths[""]; ok {
+		if _, err := os.Stat(filepath.Join(cgds.sysRoot, "cgroup.controllers")); err == nil {
+			return cgds.readV2(path)
+		}
+	}
+	return cgds.readV1(paths)
+}
+
+// paths parses /proc/self/cgroup, returning each controller's cgroup path;
+// the v2 unified hierarchy is keyed by "".
+func (cgds *CgroupDataSource) paths() map[string]string {
+	f, err := os.Open(cgds.procCgroup)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+
+	paths := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// hierarchy-ID:controller-list:cgroup-path
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[1] == "" {
+			paths[""] = parts[2]
+			continue
+		}
+		for _, controller := range strings.Split(parts[1], ",") {
+			paths[controller] = parts[2]
+		}
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+	return paths
+}
+
+// dir returns the directory of a cgroup under a hierarchy's mount point.  In
+// a container the cgroup path is often that of the host, while the cgroup
+// itself is mounted as the root, so the root is used if the path isn't found.
+func (cgds *CgroupDataSource) dir(mount, path string) string {
+	dir := filepath.Join(cgds.sysRoot, mount, path)
+	if _, err := os.Stat(dir); err == nil {
+		return dir
+	}
+	return filepath.Join(cgds.sysRoot, mount)
+}
+
+func (cgds *CgroupDataSource) readV2(path string) *CgroupStats {
+	dir := cgds.dir("", path)
+	stats := &CgroupStats{Version: 2, Path: path}
+
+	// cpu.max is "$MAX $PERIOD", where MAX may be "max"
+	if fields := strings.Fields(readString(filepath.Join(dir, "cpu.max"))); len(fields) == 2 {
+		quota, qerr := strconv.ParseFloat(fields[0], 64)
+		period, perr := strconv.ParseFloat(fields[1], 64)
+		if qerr == nil && perr == nil && period > 0 {
+			stats.CPULimit = quota / period
+		}
+	}
+	cpuStat := readKeyed(filepath.Join(dir, "cpu.stat"))
+	stats.CPUUsageSeconds = float64(cpuStat["usage_usec"]) / 1e6
+	stats.CPUPeriods = cpuStat["nr_periods"]
+	stats.CPUThrottledPeriods = cpuStat["nr_throttled"]
+	stats.CPUThrottledSeconds = float64(cpuStat["throttled_usec"]) / 1e6
+
+	stats.MemoryLimitBytes = readInt(filepath.Join(dir, "memory.max"))
+	stats.MemoryUsageBytes = readInt(filepath.Join(dir, "memory.current"))
+	return stats
+}
+
+func (cgds *CgroupDataSource) readV1(paths map[string]string) *CgroupStats {
+	stats := &CgroupStats{Version: 1, Path: paths["cpu"]}
+
+	if path, ok := paths["cpu"]; ok {
+		dir := cgds.cpuDir(path)
+		quota := readInt(filepath.Join(dir, "cpu.cfs_quota_us"))
+		period := readInt(filepath.Join(dir, "cpu.cfs_period_us"))
+		if quota > 0 && period > 0 {
+			stats.CPULimit = float64(quota) / float64(period)
+		}
+		cpuStat := readKeyed(filepath.Join(dir, "cpu.stat"))
+		stats.CPUPeriods = cpuStat["nr_periods"]
+		stats.CPUThrottledPeriods = cpuStat["nr_throttled"]
+		stats.CPUThrottledSeconds = float64(cpuStat["throttled_time"]) / 1e9
+	}
+	if path, ok := paths["cpuacct"]; ok {
+		dir := cgds.dir("cpuacct", path)
+		if _, err := os.Stat(dir); err != nil {
+			dir = cgds.cpuDir(path)
+		}
+		stats.CPUUsageSeconds = float64(readInt(filepath.Join(dir, "cpuacct.usage"))) / 1e9
+	}
+	if path, ok := paths["memory"]; ok {
+		dir := cgds.dir("memory", path)
+		// an unlimited v1 memory cgroup reports a huge page-aligned limit
+		if limit := readInt(filepath.Join(dir, "memory.limit_in_bytes")); limit < 1<<62 {
+			stats.MemoryLimitBytes = limit
+		}
+		stats.MemoryUsageBytes = readInt(filepath.Join(dir, "memory.usage_in_bytes"))
+	}
+	return stats
+}
+
+// cpuDir finds the v1 cpu controller, which is often co-mounted with cpuacct.
+func (cgds *CgroupDataSource) cpuDir(path string) string {
+	for _, mount := range []string{"cpu", "cpu,cpuacct", "cpuacct,cpu"} {
+		if _, err := os.Stat(filepath.Join(cgds.sysRoot, mount)); err == nil {
+			return cgds.dir(mount, path)
+		}
+	}
+	return cgds.dir("cpu", path)
+}
+
+func readString(path string) string {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(buf))
+}
+
+// readInt reads a file holding a single integer; "max", or any error, reads
+// as 0.
+func readInt(path string) int64 {
+	n, _ := strconv.ParseInt(readString(path), 10, 64)
+	return n
+}
+
+// readKeyed reads a file of "key value" lines, like cpu.stat.
+func readKeyed(path string) map[string]int64 {
+	vals := make(map[string]int64)
+	for _, line := range strings.Split(readString(path), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if n, err := strconv.ParseInt(fields[1], 10, 64); err == nil {
+			vals[fields[0]] = n
+		}
+	}
+	return vals
+}
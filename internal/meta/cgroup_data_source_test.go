@@ -0,0 +1,89 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package meta_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/uber-go/gwr/internal/meta"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFiles(t *testing.T, root string, files map[string]string) {
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+func TestCgroupDataSource_Get(t *testing.T) {
+	root, err := ioutil.TempDir("", "cgroup")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	cgds := meta.NewCgroupDataSourceAt(filepath.Join(root, "none"), root)
+	assert.Equal(t, meta.CgroupName, cgds.Name())
+	assert.Nil(t, cgds.Get(), "no stats without a cgroup")
+
+	writeFiles(t, root, map[string]string{
+		"v2/proc":                              "0::/svc\n",
+		"v2/sys/cgroup.controllers":            "cpu memory\n",
+		"v2/sys/svc/cpu.max":                   "150000 100000\n",
+		"v2/sys/svc/cpu.stat":                  "usage_usec 2500000\nnr_periods 10\nnr_throttled 4\nthrottled_usec 500000\n",
+		"v2/sys/svc/memory.max":                "1048576\n",
+		"v2/sys/svc/memory.current":            "4096\n",
+		"v1/proc":                              "4:memory:/host/svc\n2:cpu,cpuacct:/host/svc\n",
+		"v1/sys/cpu,cpuacct/cpu.cfs_quota_us":  "-1\n",
+		"v1/sys/cpu,cpuacct/cpu.cfs_period_us": "100000\n",
+		"v1/sys/cpu,cpuacct/cpu.stat":          "nr_periods 3\nnr_throttled 0\nthrottled_time 0\n",
+		"v1/sys/cpu,cpuacct/cpuacct.usage":     "3000000000\n",
+		"v1/sys/memory/memory.limit_in_bytes":  "9223372036854771712\n",
+		"v1/sys/memory/memory.usage_in_bytes":  "8192\n",
+	})
+
+	cgds = meta.NewCgroupDataSourceAt(filepath.Join(root, "v2/proc"), filepath.Join(root, "v2/sys"))
+	assert.Equal(t, &meta.CgroupStats{
+		Version:             2,
+		Path:                "/svc",
+		CPULimit:            1.5,
+		CPUUsageSeconds:     2.5,
+		CPUPeriods:          10,
+		CPUThrottledPeriods: 4,
+		CPUThrottledSeconds: 0.5,
+		MemoryLimitBytes:    1048576,
+		MemoryUsageBytes:    4096,
+	}, cgds.Get())
+
+	cgds = meta.NewCgroupDataSourceAt(filepath.Join(root, "v1/proc"), filepath.Join(root, "v1/sys"))
+	assert.Equal(t, &meta.CgroupStats{
+		Version:          1,
+		Path:             "/host/svc",
+		CPUUsageSeconds:  3,
+		CPUPeriods:       3,
+		MemoryUsageBytes: 8192,
+	}, cgds.Get(), "container roots used, unlimited v1 limits are zero")
+}
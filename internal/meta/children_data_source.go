@@ -0,0 +1,192 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package meta
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// ChildrenName is the name of the runtime child processes data source.
+const ChildrenName = "/runtime/children"
+
+// childrenPollInterval is how often the process table is re-read while the
+// children source is watched.
+const childrenPollInterval = 5 * time.Second
+
+// clockTicks is the kernel's USER_HZ, in which /proc cpu times are measured;
+// it's 100 on all common Linux platforms.
+const clockTicks = 100
+
+var childrenTextTemplate = template.Must(template.New("runtime_children_text").Parse(strings.TrimSpace(`
+{{ define "get" }}{{ range . }}{{ template "child" . }}
+{{ end }}{{ end }}
+{{ define "item" }}{{ range . }}{{ template "child" . }}
+{{ end }}{{ end }}
+{{ define "child" }}{{ .PID }} ppid={{ .PPID }} state={{ .State }} cpu={{ printf "%.2f" .CPUSeconds }}s rss={{ .RSSBytes }} {{ .Cmdline }}{{ end }}
+`)))
+
+// ChildProcess describes a process descended from this one.
+type ChildProcess struct {
+	PID        int     `json:"pid"`
+	PPID       int     `json:"ppid"`
+	State      string  `json:"state"`
+	Cmdline    string  `json:"cmdline"`
+	CPUSeconds float64 `json:"cpu_seconds"`
+	RSSBytes   int64   `json:"rss_bytes"`
+	VSizeBytes int64   `json:"vsize_bytes"`
+}
+
+// ChildrenDataSource provides a data source that lists the processes
+// descended from this one, as read from /proc; where there's no /proc, it
+// lists none.  It is used to implement the "/runtime/children" data source.
+// While watched, a new listing is emitted every few seconds.
+type ChildrenDataSource struct {
+	poller
+	procDir string
+	pid     int
+}
+
+// NewChildrenDataSource creates a new data source that lists the processes
+// descended from this one.
+func NewChildrenDataSource() *ChildrenDataSource {
+	cds := &ChildrenDataSource{
+		procDir: "/proc",
+		pid:     os.Getpid(),
+	}
+	cds.poller = poller{
+		interval: childrenPollInterval,
+		get:      cds.Get,
+	}
+	return cds
+}
+
+// Name returns the static "/runtime/children" string.
+func (cds *ChildrenDataSource) Name() string {
+	return ChildrenName
+}
+
+// TextTemplate returns a text/template to implement the GenericDataSource with
+// a "text" format option.
+func (cds *ChildrenDataSource) TextTemplate() *template.Template {
+	return childrenTextTemplate
+}
+
+// Get returns the current descendant processes, ordered by pid.
+func (cds *ChildrenDataSource) Get() interface{} {
+	return cds.children()
+}
+
+// children returns all processes descended from this one.
+func (cds *ChildrenDataSource) children() []ChildProcess {
+	entries, err := ioutil.ReadDir(cds.procDir)
+	if err != nil {
+		return nil
+	}
+
+	procs := make(map[int]ChildProcess, len(entries))
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		if proc, ok := cds.readProc(pid); ok {
+			procs[pid] = proc
+		}
+	}
+
+	// a process is a descendant if walking its parents leads here; ppid
+	// chains always end at pid 0
+	descends := map[int]bool{cds.pid: true}
+	var isDescendant func(pid int, depth int) bool
+	isDescendant = func(pid int, depth int) bool {
+		if d, ok := descends[pid]; ok {
+			return d
+		}
+		proc, ok := procs[pid]
+		d := ok && depth < len(procs) && isDescendant(proc.PPID, depth+1)
+		descends[pid] = d
+		return d
+	}
+
+	children := []ChildProcess{}
+	for pid, proc := range procs {
+		if pid != cds.pid && isDescendant(pid, 0) {
+			children = append(children, proc)
+		}
+	}
+	sort.Sort(childrenByPID(children))
+	return children
+}
+
+// readProc parses /proc/<pid>/stat and /proc/<pid>/cmdline; see proc(5).
+func (cds *ChildrenDataSource) readProc(pid int) (ChildProcess, bool) {
+	dir := filepath.Join(cds.procDir, strconv.Itoa(pid))
+	stat, err := ioutil.ReadFile(filepath.Join(dir, "stat"))
+	if err != nil {
+		return ChildProcess{}, false
+	}
+
+	// the command name may contain spaces and parens, so fields are counted
+	// from the last paren
+	lparen, rparen := bytes.IndexByte(stat, '('), bytes.LastIndexByte(stat, ')')
+	if lparen < 0 || rparen < lparen {
+		return ChildProcess{}, false
+	}
+	comm := string(stat[lparen+1 : rparen])
+	fields := strings.Fields(string(stat[rparen+1:]))
+	if len(fields) < 22 {
+		return ChildProcess{}, false
+	}
+	ppid, _ := strconv.Atoi(fields[1])
+	utime, _ := strconv.ParseInt(fields[11], 10, 64)
+	stime, _ := strconv.ParseInt(fields[12], 10, 64)
+	vsize, _ := strconv.ParseInt(fields[20], 10, 64)
+	rss, _ := strconv.ParseInt(fields[21], 10, 64)
+
+	proc := ChildProcess{
+		PID:        pid,
+		PPID:       ppid,
+		State:      fields[0],
+		CPUSeconds: float64(utime+stime) / clockTicks,
+		RSSBytes:   rss * int64(os.Getpagesize()),
+		VSizeBytes: vsize,
+	}
+	if cmdline, err := ioutil.ReadFile(filepath.Join(dir, "cmdline")); err == nil && len(cmdline) > 0 {
+		proc.Cmdline = strings.Join(strings.Split(strings.TrimRight(string(cmdline), "\x00"), "\x00"), " ")
+	} else {
+		proc.Cmdline = "[" + comm + "]"
+	}
+	return proc, true
+}
+
+type childrenByPID []ChildProcess
+
+func (cs childrenByPID) Len() int           { return len(cs) }
+func (cs childrenByPID) Less(i, j int) bool { return cs[i].PID < cs[j].PID }
+func (cs childrenByPID) Swap(i, j int)      { cs[i], cs[j] = cs[j], cs[i] }
@@ -0,0 +1,308 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package meta
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/uber-go/gwr/internal/marshaled"
+	"github.com/uber-go/gwr/source"
+)
+
+// ConfigName is the name of the runtime configuration data source.
+const ConfigName = "/meta/config"
+
+var errNoConfigServer = errors.New("no configured server")
+
+var configTextTemplate = template.Must(template.New("meta_config_text").Parse(strings.TrimSpace(`
+{{ define "limits" }}max_items={{ .MaxItems }} max_batches={{ .MaxBatches }} max_wait={{ .MaxWait }}{{ with .Rate.Items }} rate={{ . }}{{ end }}{{ with .Rate.Bytes }} byte_rate={{ . }}{{ end }}{{ with .Sample }} sample={{ . }}{{ end }}{{ end }}
+{{ define "get" }}{{ template "item" . }}{{ end }}
+{{ define "item" }}enabled: {{ .Enabled }}
+listen: {{ .Listen }}{{ with .Addrs }} ({{ range $i, $addr := . }}{{ if $i }}, {{ end }}{{ $addr }}{{ end }}){{ end }}
+tls: {{ .TLS }}, auth: {{ .Auth }}, h2c: {{ .H2C }}
+limits: {{ template "limits" .Limits }}
+{{ range $name, $lim := .Sources }}{{ $name }}: {{ template "limits" $lim }}
+{{ end }}{{ end }}
+`)))
+
+// ConfigInfo is the effective configuration of gwr's server and data source
+// limits.
+type ConfigInfo struct {
+	Enabled   bool                    `json:"enabled"`
+	Listen    string                  `json:"listen,omitempty"`
+	Addrs     []string                `json:"addrs,omitempty"`
+	TLS       bool                    `json:"tls"`
+	Auth      bool                    `json:"auth"`
+	H2C       bool                    `json:"h2c"`
+	WatchRate source.RateLimit        `json:"watch_rate"`
+	Limits    ConfigLimits            `json:"limits"`
+	Sources   map[string]ConfigLimits `json:"sources,omitempty"`
+}
+
+// ConfigLimits are the limits of data sources; see marshaled.Limits.
+type ConfigLimits struct {
+	MaxItems   int              `json:"max_items,omitempty"`
+	MaxBatches int              `json:"max_batches,omitempty"`
+	MaxWait    string           `json:"max_wait,omitempty"`
+	Rate       source.RateLimit `json:"rate"`
+	Sample     float64          `json:"sample,omitempty"`
+}
+
+// ConfigServer is the server whose configuration a ConfigDataSource shows.
+type ConfigServer interface {
+	// ConfigInfo returns the server's settings, leaving the limits to the
+	// ConfigDataSource.
+	ConfigInfo() ConfigInfo
+
+	// Relisten moves the server to a new listening address.
+	Relisten(laddr string) error
+}
+
+// ConfigDataSource provides a data source showing gwr's effective
+// configuration, and changing some of it at runtime.  It is used to implement
+// the "/meta/config" data source.  Getting it returns a ConfigInfo, and each
+// change is emitted to its watchers.
+//
+// Its "set" action changes any settings given as parameters: "listen" moves
+// the server to a new address; "max_items", "max_batches", "max_wait",
+// "rate", "byte_rate", and "sample" change the default data source limits,
+// or, with a "source" parameter, that source's own, where a zero reverts
+// it to the default.
+type ConfigDataSource struct {
+	lock    sync.Mutex
+	server  ConfigServer
+	watcher source.GenericDataWatcher
+}
+
+// NewConfigDataSource creates a new data source with no server, until one is
+// set.
+func NewConfigDataSource() *ConfigDataSource {
+	return &ConfigDataSource{}
+}
+
+// SetServer sets the server whose settings are shown, and whose listening
+// address may be changed.
+func (cds *ConfigDataSource) SetServer(server ConfigServer) {
+	cds.lock.Lock()
+	cds.server = server
+	cds.lock.Unlock()
+}
+
+// Name returns the static "/meta/config" string.
+func (cds *ConfigDataSource) Name() string {
+	return ConfigName
+}
+
+// TextTemplate returns a text/template to implement the GenericDataSource with
+// a "text" format option.
+func (cds *ConfigDataSource) TextTemplate() *template.Template {
+	return configTextTemplate
+}
+
+// Get returns the current ConfigInfo.
+func (cds *ConfigDataSource) Get() interface{} {
+	cds.lock.Lock()
+	defer cds.lock.Unlock()
+	return cds.info(cds.server)
+}
+
+// SetWatcher implements GenericDataSource by retaining a reference to the
+// passed watcher.
+func (cds *ConfigDataSource) SetWatcher(watcher source.GenericDataWatcher) {
+	cds.lock.Lock()
+	cds.watcher = source.AddWatcher(cds.watcher, watcher)
+	cds.lock.Unlock()
+}
+
+// Action implements the "set" action.
+func (cds *ConfigDataSource) Action(name string, params map[string]string) error {
+	if name != "set" {
+		return source.ErrUnknownAction
+	}
+	lim, set, err := parseConfigLimits(params)
+	if err != nil {
+		return err
+	}
+	srcName, forSource := params["source"]
+	laddr, relisten := params["listen"]
+	switch {
+	case set == nil && !relisten:
+		return source.ErrInvalidParam
+	case forSource && (srcName == "" || lim.MaxItems < 0 || lim.MaxBatches < 0 || lim.MaxWait < 0):
+		return source.ErrInvalidParam
+	case !forSource && set != nil && !positiveConfigLimits(lim, set):
+		// the defaults can't be reverted
+		return source.ErrInvalidParam
+	}
+
+	cds.lock.Lock()
+	if relisten {
+		if cds.server == nil {
+			cds.lock.Unlock()
+			return errNoConfigServer
+		}
+		if err := cds.server.Relisten(laddr); err != nil {
+			cds.lock.Unlock()
+			return err
+		}
+	}
+	if set != nil {
+		if forSource {
+			marshaled.SetSourceLimits(srcName, mergeConfigLimits(marshaled.SourceLimits()[srcName], lim, set))
+		} else {
+			marshaled.SetDefaultLimits(lim)
+		}
+	}
+	info := cds.info(cds.server)
+	watcher := cds.watcher
+	cds.lock.Unlock()
+
+	if watcher != nil && watcher.Active() {
+		watcher.HandleItem(info)
+	}
+	return nil
+}
+
+func (cds *ConfigDataSource) info(server ConfigServer) ConfigInfo {
+	var info ConfigInfo
+	if server != nil {
+		info = server.ConfigInfo()
+	}
+	info.Limits = configLimits(marshaled.DefaultLimits())
+	if limits := marshaled.SourceLimits(); len(limits) > 0 {
+		info.Sources = make(map[string]ConfigLimits, len(limits))
+		for name, lim := range limits {
+			info.Sources[name] = configLimits(lim)
+		}
+	}
+	return info
+}
+
+func configLimits(lim marshaled.Limits) ConfigLimits {
+	cl := ConfigLimits{
+		MaxItems:   lim.MaxItems,
+		MaxBatches: lim.MaxBatches,
+		Rate:       lim.Rate,
+		Sample:     lim.Sample,
+	}
+	if lim.MaxWait > 0 {
+		cl.MaxWait = lim.MaxWait.String()
+	}
+	return cl
+}
+
+// parseConfigLimits parses any limits among the parameters, returning which
+// were set.
+func parseConfigLimits(params map[string]string) (marshaled.Limits, map[string]bool, error) {
+	var (
+		lim marshaled.Limits
+		set map[string]bool
+	)
+	mark := func(name string) {
+		if set == nil {
+			set = make(map[string]bool)
+		}
+		set[name] = true
+	}
+	for _, p := range []struct {
+		name string
+		n    *int
+	}{
+		{"max_items", &lim.MaxItems},
+		{"max_batches", &lim.MaxBatches},
+	} {
+		if s, ok := params[p.name]; ok {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return lim, nil, source.ErrInvalidParam
+			}
+			*p.n = n
+			mark(p.name)
+		}
+	}
+	for _, p := range []struct {
+		name string
+		f    *float64
+	}{
+		{"rate", &lim.Rate.Items},
+		{"byte_rate", &lim.Rate.Bytes},
+		{"sample", &lim.Sample},
+	} {
+		if s, ok := params[p.name]; ok {
+			f, err := strconv.ParseFloat(s, 64)
+			if err != nil || f < 0 {
+				return lim, nil, source.ErrInvalidParam
+			}
+			*p.f = f
+			mark(p.name)
+		}
+	}
+	if lim.Sample > 1 {
+		return lim, nil, source.ErrInvalidParam
+	}
+	if s, ok := params["max_wait"]; ok {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return lim, nil, source.ErrInvalidParam
+		}
+		lim.MaxWait = d
+		mark("max_wait")
+	}
+	return lim, set, nil
+}
+
+// positiveConfigLimits returns true if all of the set limits are positive.
+func positiveConfigLimits(lim marshaled.Limits, set map[string]bool) bool {
+	return !(set["max_items"] && lim.MaxItems <= 0 ||
+		set["max_batches"] && lim.MaxBatches <= 0 ||
+		set["max_wait"] && lim.MaxWait <= 0 ||
+		set["rate"] && lim.Rate.Items <= 0 ||
+		set["byte_rate"] && lim.Rate.Bytes <= 0 ||
+		set["sample"] && lim.Sample <= 0)
+}
+
+// mergeConfigLimits returns cur with the set fields of lim replacing its own.
+func mergeConfigLimits(cur, lim marshaled.Limits, set map[string]bool) marshaled.Limits {
+	if set["max_items"] {
+		cur.MaxItems = lim.MaxItems
+	}
+	if set["max_batches"] {
+		cur.MaxBatches = lim.MaxBatches
+	}
+	if set["max_wait"] {
+		cur.MaxWait = lim.MaxWait
+	}
+	if set["rate"] {
+		cur.Rate.Items = lim.Rate.Items
+	}
+	if set["byte_rate"] {
+		cur.Rate.Bytes = lim.Rate.Bytes
+	}
+	if set["sample"] {
+		cur.Sample = lim.Sample
+	}
+	return cur
+}
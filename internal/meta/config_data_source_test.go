@@ -0,0 +1,99 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package meta_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/uber-go/gwr/internal/marshaled"
+	"github.com/uber-go/gwr/internal/meta"
+	"github.com/uber-go/gwr/internal/test"
+	"github.com/uber-go/gwr/source"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testConfigServer struct {
+	listen string
+}
+
+func (tcs *testConfigServer) ConfigInfo() meta.ConfigInfo {
+	return meta.ConfigInfo{Enabled: true, Listen: tcs.listen}
+}
+
+func (tcs *testConfigServer) Relisten(laddr string) error {
+	if laddr == "bogus" {
+		return errors.New("bogus address")
+	}
+	tcs.listen = laddr
+	return nil
+}
+
+func TestConfigDataSource(t *testing.T) {
+	orig := marshaled.DefaultLimits()
+	defer marshaled.SetDefaultLimits(orig)
+	defer marshaled.SetSourceLimits("/test/config", marshaled.Limits{})
+
+	cds := meta.NewConfigDataSource()
+	assert.Equal(t, meta.ConfigName, cds.Name())
+	watcher := test.NewWatcher()
+	cds.SetWatcher(watcher)
+
+	assert.Equal(t, source.ErrUnknownAction, cds.Action("nope", nil))
+	assert.Equal(t, source.ErrInvalidParam, cds.Action("set", nil), "nothing to set")
+	assert.Equal(t, source.ErrInvalidParam, cds.Action("set", map[string]string{"sample": "2"}))
+	assert.Equal(t, source.ErrInvalidParam, cds.Action("set", map[string]string{"rate": "fast"}))
+	assert.Equal(t, source.ErrInvalidParam, cds.Action("set", map[string]string{"rate": "0"}),
+		"default limits can't be reverted")
+	assert.Error(t, cds.Action("set", map[string]string{"listen": ":4041"}), "no server yet")
+
+	tcs := &testConfigServer{listen: ":4040"}
+	cds.SetServer(tcs)
+	require.NoError(t, cds.Action("set", map[string]string{"listen": ":4041", "max_wait": "1ms"}))
+	assert.Equal(t, ":4041", tcs.listen)
+	assert.Error(t, cds.Action("set", map[string]string{"listen": "bogus"}))
+
+	require.NoError(t, cds.Action("set", map[string]string{
+		"source": "/test/config", "sample": "0.5", "rate": "100",
+	}))
+	require.NoError(t, cds.Action("set", map[string]string{
+		"source": "/test/config", "rate": "0", "byte_rate": "1000",
+	}), "zero reverts a source's limit")
+
+	info := cds.Get().(meta.ConfigInfo)
+	assert.Equal(t, ":4041", info.Listen)
+	assert.Equal(t, "1ms", info.Limits.MaxWait)
+	assert.Equal(t, meta.ConfigLimits{
+		Rate:   source.RateLimit{Bytes: 1000},
+		Sample: 0.5,
+	}, info.Sources["/test/config"])
+	var buf bytes.Buffer
+	require.NoError(t, marshaled.NewDataSource(cds, nil).Get("text", &buf))
+	assert.Contains(t, buf.String(), "listen: :4041\n")
+	assert.Contains(t, buf.String(), "/test/config: max_items=0 max_batches=0 max_wait= byte_rate=1000 sample=0.5\n")
+
+	items := watcher.AllItems()
+	require.Len(t, items, 3, "each change emitted")
+	assert.Equal(t, info, items[2])
+}
@@ -0,0 +1,297 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package meta
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+// ConnsName is the name of the network connections data source.
+const ConnsName = "/net/conns"
+
+// connsPollInterval is how often the connection table is re-read while the
+// conns source is watched.
+const connsPollInterval = time.Second
+
+var connsTextTemplate = template.Must(template.New("net_conns_text").Parse(strings.TrimSpace(`
+{{ define "get" }}{{ range . }}{{ template "conn" . }}
+{{ end }}{{ end }}
+{{ define "init" }}{{ template "get" . }}{{ end }}
+{{ define "item" }}{{ .Event }} {{ template "conn" .Conn }}{{ end }}
+{{ define "conn" }}{{ .Proto }} {{ .Local }} {{ .Remote }} {{ .State }} tx={{ .TxQueue }} rx={{ .RxQueue }}{{ end }}
+`)))
+
+// tcpStates names the socket states of /proc/net/{tcp,udp}; see
+// include/net/tcp_states.h.
+var tcpStates = map[string]string{
+	"01": "ESTABLISHED",
+	"02": "SYN_SENT",
+	"03": "SYN_RECV",
+	"04": "FIN_WAIT1",
+	"05": "FIN_WAIT2",
+	"06": "TIME_WAIT",
+	"07": "CLOSE",
+	"08": "CLOSE_WAIT",
+	"09": "LAST_ACK",
+	"0A": "LISTEN",
+	"0B": "CLOSING",
+}
+
+// Conn describes one of this process's sockets.
+type Conn struct {
+	Proto   string `json:"proto"`
+	Local   string `json:"local"`
+	Remote  string `json:"remote"`
+	State   string `json:"state"`
+	TxQueue uint64 `json:"tx_queue"`
+	RxQueue uint64 `json:"rx_queue"`
+	Inode   uint64 `json:"inode"`
+}
+
+// ConnEvent is emitted to watchers of the conns source when a socket is
+// opened or closed, or changes state.
+type ConnEvent struct {
+	Event string `json:"event"`
+	Conn  Conn   `json:"conn"`
+}
+
+// ConnsDataSource provides a data source that lists this process's TCP and
+// UDP sockets, by matching the socket inodes of its open file descriptors
+// against /proc/net; where there's no /proc, it lists none.  It is used to
+// implement the "/net/conns" data source.
+//
+// Watchers first get the current table, and then an "open", "close", or
+// "state" ConnEvent for every change seen by re-reading the table every
+// second; connections which open and close between reads go unseen.
+type ConnsDataSource struct {
+	poller
+	procDir string
+
+	prevLock sync.Mutex
+	prev     map[uint64]Conn
+}
+
+// NewConnsDataSource creates a new data source that lists this process's
+// sockets.
+func NewConnsDataSource() *ConnsDataSource {
+	cds := &ConnsDataSource{
+		procDir: "/proc",
+	}
+	cds.poller = poller{
+		interval: connsPollInterval,
+		get:      cds.events,
+		reset:    cds.reset,
+	}
+	return cds
+}
+
+// Name returns the static "/net/conns" string.
+func (cds *ConnsDataSource) Name() string {
+	return ConnsName
+}
+
+// TextTemplate returns a text/template to implement the GenericDataSource with
+// a "text" format option.
+func (cds *ConnsDataSource) TextTemplate() *template.Template {
+	return connsTextTemplate
+}
+
+// Get returns the current sockets, ordered by protocol and local address.
+func (cds *ConnsDataSource) Get() interface{} {
+	return cds.conns()
+}
+
+// WatchInit returns the current sockets, like Get.
+func (cds *ConnsDataSource) WatchInit() interface{} {
+	return cds.conns()
+}
+
+func (cds *ConnsDataSource) reset() {
+	cds.prevLock.Lock()
+	cds.prev = nil
+	cds.prevLock.Unlock()
+}
+
+// events returns ConnEvents for all changes since the last call, or since
+// polling started.
+func (cds *ConnsDataSource) events() interface{} {
+	conns := cds.conns()
+	cur := make(map[uint64]Conn, len(conns))
+	for _, conn := range conns {
+		cur[conn.Inode] = conn
+	}
+
+	cds.prevLock.Lock()
+	prev := cds.prev
+	cds.prev = cur
+	cds.prevLock.Unlock()
+	if prev == nil {
+		return nil
+	}
+
+	var events []interface{}
+	for _, conn := range conns {
+		if old, ok := prev[conn.Inode]; !ok {
+			events = append(events, ConnEvent{"open", conn})
+		} else if old.State != conn.State {
+			events = append(events, ConnEvent{"state", conn})
+		}
+	}
+	var closed []Conn
+	for inode, conn := range prev {
+		if _, ok := cur[inode]; !ok {
+			closed = append(closed, conn)
+		}
+	}
+	sort.Sort(connsByAddr(closed))
+	for _, conn := range closed {
+		events = append(events, ConnEvent{"close", conn})
+	}
+	return events
+}
+
+// conns returns this process's sockets.
+func (cds *ConnsDataSource) conns() []Conn {
+	inodes := cds.socketInodes()
+	conns := []Conn{}
+	if len(inodes) == 0 {
+		return conns
+	}
+	for _, proto := range []string{"tcp", "tcp6", "udp", "udp6"} {
+		conns = cds.readNet(proto, inodes, conns)
+	}
+	sort.Sort(connsByAddr(conns))
+	return conns
+}
+
+// socketInodes returns the inodes of the sockets among this process's open
+// file descriptors.
+func (cds *ConnsDataSource) socketInodes() map[uint64]struct{} {
+	fdDir := filepath.Join(cds.procDir, "self", "fd")
+	fds, err := ioutil.ReadDir(fdDir)
+	if err != nil {
+		return nil
+	}
+	inodes := make(map[uint64]struct{}, len(fds))
+	for _, fd := range fds {
+		link, err := os.Readlink(filepath.Join(fdDir, fd.Name()))
+		if err != nil || !strings.HasPrefix(link, "socket:[") {
+			continue
+		}
+		inode, err := strconv.ParseUint(strings.TrimSuffix(link[len("socket:["):], "]"), 10, 64)
+		if err == nil {
+			inodes[inode] = struct{}{}
+		}
+	}
+	return inodes
+}
+
+// readNet appends the sockets listed in /proc/self/net/<proto> that are among
+// the given inodes; see proc(5).
+func (cds *ConnsDataSource) readNet(proto string, inodes map[uint64]struct{}, conns []Conn) []Conn {
+	f, err := os.Open(filepath.Join(cds.procDir, "self", "net", proto))
+	if err != nil {
+		return conns
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Scan() // header
+	for scanner.Scan() {
+		// sl local_address rem_address st tx_queue:rx_queue tr:tm->when
+		// retrnsmt uid timeout inode ...
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+		inode, err := strconv.ParseUint(fields[9], 10, 64)
+		if err != nil {
+			continue
+		}
+		if _, ok := inodes[inode]; !ok {
+			continue
+		}
+		conn := Conn{
+			Proto:  proto,
+			Local:  parseProcAddr(fields[1]),
+			Remote: parseProcAddr(fields[2]),
+			State:  tcpStates[fields[3]],
+			Inode:  inode,
+		}
+		if conn.State == "" {
+			conn.State = fields[3]
+		}
+		if queues := strings.SplitN(fields[4], ":", 2); len(queues) == 2 {
+			conn.TxQueue, _ = strconv.ParseUint(queues[0], 16, 64)
+			conn.RxQueue, _ = strconv.ParseUint(queues[1], 16, 64)
+		}
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+// parseProcAddr parses a /proc/net address, a hex ip, in host byte order
+// 32-bit words, and port.
+func parseProcAddr(s string) string {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return s
+	}
+	raw, err := hex.DecodeString(parts[0])
+	if err != nil || len(raw)%4 != 0 {
+		return s
+	}
+	port, err := strconv.ParseUint(parts[1], 16, 16)
+	if err != nil {
+		return s
+	}
+	ip := make(net.IP, len(raw))
+	for i := 0; i < len(raw); i += 4 {
+		ip[i], ip[i+1], ip[i+2], ip[i+3] = raw[i+3], raw[i+2], raw[i+1], raw[i]
+	}
+	return net.JoinHostPort(ip.String(), fmt.Sprint(port))
+}
+
+type connsByAddr []Conn
+
+func (cs connsByAddr) Len() int { return len(cs) }
+func (cs connsByAddr) Less(i, j int) bool {
+	if cs[i].Proto != cs[j].Proto {
+		return cs[i].Proto < cs[j].Proto
+	}
+	if cs[i].Local != cs[j].Local {
+		return cs[i].Local < cs[j].Local
+	}
+	return cs[i].Remote < cs[j].Remote
+}
+func (cs connsByAddr) Swap(i, j int) { cs[i], cs[j] = cs[j], cs[i] }
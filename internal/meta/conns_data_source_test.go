@@ -0,0 +1,62 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package meta_test
+
+import (
+	"net"
+	"os"
+	"testing"
+
+	"github.com/uber-go/gwr/internal/meta"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConnsDataSource_Get(t *testing.T) {
+	if _, err := os.Stat("/proc/self/net/tcp"); err != nil {
+		t.Skip("no /proc")
+	}
+	cds := meta.NewConnsDataSource()
+	assert.Equal(t, meta.ConnsName, cds.Name())
+
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	conn, err := net.Dial("tcp4", ln.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	var listening, dialed bool
+	for _, c := range cds.Get().([]meta.Conn) {
+		switch {
+		case c.Local == ln.Addr().String() && c.State == "LISTEN":
+			listening = true
+		case c.Local == conn.LocalAddr().String():
+			dialed = true
+			assert.Equal(t, "tcp", c.Proto)
+			assert.Equal(t, ln.Addr().String(), c.Remote)
+			assert.Equal(t, "ESTABLISHED", c.State)
+		}
+	}
+	assert.True(t, listening, "listener found")
+	assert.True(t, dialed, "dialed connection found")
+}
@@ -0,0 +1,171 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package meta
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/uber-go/gwr/source"
+)
+
+// GraphName is the name of the source dependency graph data source.
+const GraphName = "/meta/graph"
+
+var graphTextTemplate = template.Must(template.New("meta_graph_text").Parse(strings.TrimSpace(`
+{{ define "get" }}{{ range .Edges }}{{ .From }} -> {{ .To }}{{ if .Rate }} ({{ printf "%.1f" .Rate }} items/sec){{ end }}
+{{ end }}{{ end }}
+`)))
+
+// GraphNode is a source, or consumer, in the graph.  Kind is "source" for
+// sources that aren't derived from others, "derived" for those that are, and
+// the consumer's kind for consumers, e.g. "reporter".
+type GraphNode struct {
+	Name  string        `json:"name"`
+	Kind  string        `json:"kind"`
+	Stats *source.Stats `json:"stats,omitempty"`
+}
+
+// GraphEdge is a consumption of the From source's items by To; Rate is how
+// many items per second the From source is emitting, if it keeps stats.
+type GraphEdge struct {
+	From string  `json:"from"`
+	To   string  `json:"to"`
+	Rate float64 `json:"items_per_sec"`
+}
+
+// Graph describes what consumes what.
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// GraphDataSource provides a data source that describes the relationships
+// between sources, those derived from them, and any other consumers, such as
+// reporters; see source.DerivedSource and source.AddConsumer.  It is used to
+// implement the "/meta/graph" data source, which may be gotten as json, text,
+// or graphviz "dot".
+type GraphDataSource struct {
+	sources *source.DataSources
+}
+
+// NewGraphDataSource creates a new data source that describes the
+// relationships between the given sources, and any registered consumers.
+func NewGraphDataSource(dss *source.DataSources) *GraphDataSource {
+	return &GraphDataSource{sources: dss}
+}
+
+// Name returns the static "/meta/graph" string.
+func (gds *GraphDataSource) Name() string {
+	return GraphName
+}
+
+// TextTemplate returns a template listing each edge on a line.
+func (gds *GraphDataSource) TextTemplate() *template.Template {
+	return graphTextTemplate
+}
+
+// Formats returns a "dot" format, for graphviz, in addition to the defaults.
+func (gds *GraphDataSource) Formats() map[string]source.GenericDataFormat {
+	return map[string]source.GenericDataFormat{
+		"dot": source.GenericDataFormatFunc(marshalDot),
+	}
+}
+
+// Get returns the current Graph.
+func (gds *GraphDataSource) Get() interface{} {
+	var (
+		graph = Graph{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+		rates = make(map[string]float64)
+		edges = func(to string, inputs []string) {
+			for _, from := range inputs {
+				graph.Edges = append(graph.Edges, GraphEdge{from, to, 0})
+			}
+		}
+	)
+
+	for _, ds := range gds.sources.Match("/*") {
+		node := GraphNode{Name: ds.Name(), Kind: "source", Stats: source.GetStats(ds)}
+		if node.Stats != nil {
+			rates[node.Name] = node.Stats.Rate
+		}
+		if dsrc, ok := ds.(source.DerivedSource); ok {
+			if inputs := dsrc.Inputs(); len(inputs) > 0 {
+				node.Kind = "derived"
+				edges(node.Name, inputs)
+			}
+		}
+		graph.Nodes = append(graph.Nodes, node)
+	}
+
+	// consumers' names aren't unique, so any repeats are numbered
+	seen := make(map[string]int)
+	for _, c := range source.Consumers() {
+		name := c.Kind + ":" + c.Name
+		seen[name]++
+		if n := seen[name]; n > 1 {
+			name += "#" + strconv.Itoa(n)
+		}
+		graph.Nodes = append(graph.Nodes, GraphNode{Name: name, Kind: c.Kind})
+		edges(name, c.Inputs)
+	}
+
+	for i := range graph.Edges {
+		graph.Edges[i].Rate = rates[graph.Edges[i].From]
+	}
+	return graph
+}
+
+// nodeShapes are the dot shapes of each kind of node; any other kind, i.e.
+// consumers, are ellipses.
+var nodeShapes = map[string]string{
+	"source":  "box",
+	"derived": "box, style=rounded",
+}
+
+// marshalDot renders a Graph as a graphviz digraph.
+func marshalDot(data interface{}) ([]byte, error) {
+	graph, ok := data.(Graph)
+	if !ok {
+		return nil, fmt.Errorf("invalid graph data %T", data)
+	}
+	var buf bytes.Buffer
+	buf.WriteString("digraph gwr {\n")
+	for _, node := range graph.Nodes {
+		shape, ok := nodeShapes[node.Kind]
+		if !ok {
+			shape = "ellipse"
+		}
+		fmt.Fprintf(&buf, "\t%s [shape=%s];\n", strconv.Quote(node.Name), shape)
+	}
+	for _, edge := range graph.Edges {
+		fmt.Fprintf(&buf, "\t%s -> %s", strconv.Quote(edge.From), strconv.Quote(edge.To))
+		if edge.Rate > 0 {
+			fmt.Fprintf(&buf, " [label=\"%.1f/s\"]", edge.Rate)
+		}
+		buf.WriteString(";\n")
+	}
+	buf.WriteString("}")
+	return buf.Bytes(), nil
+}
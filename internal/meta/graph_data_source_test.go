@@ -0,0 +1,88 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package meta_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/uber-go/gwr/internal/marshaled"
+	"github.com/uber-go/gwr/internal/meta"
+	"github.com/uber-go/gwr/source"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type derivedDataSource struct {
+	dummyDataSource
+	inputs []string
+}
+
+func (dds *derivedDataSource) Inputs() []string {
+	return dds.inputs
+}
+
+func TestGraphDataSource(t *testing.T) {
+	dss := source.NewDataSources()
+	dss.Add(marshaled.NewDataSource(&dummyDataSource{name: "/raw"}, nil))
+	dss.Add(marshaled.NewDataSource(&derivedDataSource{
+		dummyDataSource: dummyDataSource{name: "/raw/agg"},
+		inputs:          []string{"/raw"},
+	}, nil))
+	gds := meta.NewGraphDataSource(dss)
+
+	remove := source.AddConsumer(source.Consumer{Kind: "reporter", Name: "loki", Inputs: []string{"/raw"}})
+	defer remove()
+	remove2 := source.AddConsumer(source.Consumer{Kind: "reporter", Name: "loki", Inputs: []string{"/raw/agg"}})
+
+	graph := gds.Get().(meta.Graph)
+	var names, kinds []string
+	for _, node := range graph.Nodes {
+		names = append(names, node.Name)
+		kinds = append(kinds, node.Kind)
+	}
+	assert.Equal(t, []string{"/raw", "/raw/agg", "reporter:loki", "reporter:loki#2"}, names)
+	assert.Equal(t, []string{"source", "derived", "reporter", "reporter"}, kinds)
+	assert.NotNil(t, graph.Nodes[0].Stats, "marshaled sources have stats")
+	assert.Equal(t, []meta.GraphEdge{
+		{From: "/raw", To: "/raw/agg"},
+		{From: "/raw", To: "reporter:loki"},
+		{From: "/raw/agg", To: "reporter:loki#2"},
+	}, graph.Edges)
+
+	remove2()
+	remove2()
+	mds := marshaled.NewDataSource(gds, nil)
+	var buf bytes.Buffer
+	require.NoError(t, mds.Get("dot", &buf))
+	assert.Equal(t, `digraph gwr {
+	"/raw" [shape=box];
+	"/raw/agg" [shape=box, style=rounded];
+	"reporter:loki" [shape=ellipse];
+	"/raw" -> "/raw/agg";
+	"/raw" -> "reporter:loki";
+}`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, mds.Get("text", &buf))
+	assert.Equal(t, "/raw -> /raw/agg\n/raw -> reporter:loki\n", buf.String())
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package meta
+
+import (
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// ListenName is the name of the listeners data source.
+const ListenName = "/meta/listen"
+
+var listenTextTemplate = template.Must(template.New("meta_listen_text").Parse(strings.TrimSpace(`
+{{ define "get" }}{{ range . }}{{ .Addr }}{{ if .TLS }} (tls){{ end }}{{ if ne .Addr .Listen }}, listening on {{ .Listen }}{{ end }}
+{{ end }}{{ end }}
+`)))
+
+// ListenerInfo describes one of the server's listeners: the address that it
+// was configured with, the address that it's bound to, and whether it serves
+// TLS.
+type ListenerInfo struct {
+	Listen string `json:"listen"`
+	Addr   string `json:"addr"`
+	TLS    bool   `json:"tls"`
+}
+
+// ListenDataSource provides a data source listing the server's active
+// listeners, in the order that they started.  It is used to implement the
+// "/meta/listen" data source.
+type ListenDataSource struct {
+	lock      sync.Mutex
+	listeners []*ListenerInfo
+}
+
+// NewListenDataSource creates a new data source with no listeners.
+func NewListenDataSource() *ListenDataSource {
+	return &ListenDataSource{}
+}
+
+// Add adds a listener, returning a function that removes it, once the server
+// stops listening.
+func (lds *ListenDataSource) Add(info ListenerInfo) func() {
+	ent := &info
+	lds.lock.Lock()
+	lds.listeners = append(lds.listeners, ent)
+	lds.lock.Unlock()
+	return func() {
+		lds.lock.Lock()
+		defer lds.lock.Unlock()
+		for i, other := range lds.listeners {
+			if other == ent {
+				lds.listeners = append(lds.listeners[:i:i], lds.listeners[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Name returns the static "/meta/listen" string.
+func (lds *ListenDataSource) Name() string {
+	return ListenName
+}
+
+// TextTemplate returns a text/template listing each listener's address.
+func (lds *ListenDataSource) TextTemplate() *template.Template {
+	return listenTextTemplate
+}
+
+// Get returns a ListenerInfo for every active listener.
+func (lds *ListenDataSource) Get() interface{} {
+	lds.lock.Lock()
+	defer lds.lock.Unlock()
+	infos := make([]ListenerInfo, len(lds.listeners))
+	for i, ent := range lds.listeners {
+		infos[i] = *ent
+	}
+	return infos
+}
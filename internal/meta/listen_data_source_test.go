@@ -0,0 +1,55 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package meta_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/uber-go/gwr/internal/marshaled"
+	"github.com/uber-go/gwr/internal/meta"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenDataSource(t *testing.T) {
+	lds := meta.NewListenDataSource()
+	assert.Equal(t, meta.ListenName, lds.Name())
+	assert.Equal(t, []meta.ListenerInfo{}, lds.Get())
+
+	remove := lds.Add(meta.ListenerInfo{Listen: "127.0.0.1:0", Addr: "127.0.0.1:4040"})
+	lds.Add(meta.ListenerInfo{Listen: ":4443", Addr: "[::]:4443", TLS: true})
+	assert.Equal(t, []meta.ListenerInfo{
+		{Listen: "127.0.0.1:0", Addr: "127.0.0.1:4040"},
+		{Listen: ":4443", Addr: "[::]:4443", TLS: true},
+	}, lds.Get())
+
+	var buf bytes.Buffer
+	require.NoError(t, marshaled.NewDataSource(lds, nil).Get("text", &buf))
+	assert.Equal(t, "127.0.0.1:4040, listening on 127.0.0.1:0\n[::]:4443 (tls), listening on :4443\n", buf.String())
+
+	remove()
+	remove()
+	assert.Equal(t, []meta.ListenerInfo{
+		{Listen: ":4443", Addr: "[::]:4443", TLS: true},
+	}, lds.Get())
+}
@@ -0,0 +1,232 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package meta
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/uber-go/gwr/source"
+)
+
+// LogLevelName is the name of the log level control data source.
+const LogLevelName = "/meta/loglevel"
+
+// DefaultLogLevelTTL is how long a level set by the "set" action lasts, when
+// no ttl is given, before it reverts.
+const DefaultLogLevelTTL = 10 * time.Minute
+
+var logLevelTextTemplate = template.Must(template.New("meta_loglevel_text").Parse(strings.TrimSpace(`
+{{ define "get" }}{{ range . }}{{ template "item" . }}
+{{ end }}{{ end }}
+{{ define "item" }}{{ .Name }}: {{ .Level }}{{ if .Revert }} (reverts to {{ .Revert }} at {{ .Expires.Format "15:04:05" }}){{ end }}{{ end }}
+`)))
+
+// LogLevel is a logger's adjustable level, as a string in the logger's own
+// terms, e.g. "debug".
+type LogLevel interface {
+	Level() string
+	SetLevel(level string) error
+}
+
+// LogLevelInfo describes a logger's current level; if it's been set by the
+// "set" action, Revert is the level that it returns to once Expires.
+type LogLevelInfo struct {
+	Name    string     `json:"name"`
+	Level   string     `json:"level"`
+	Revert  string     `json:"revert,omitempty"`
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// LogLevelDataSource provides a data source that lets clients temporarily
+// change the levels of a program's loggers.  It is used to implement the
+// "/meta/loglevel" data source.  Getting it lists the loggers' levels, and
+// each change is emitted to its watchers.
+//
+// It implements two actions: "set", with "name", "level", and an optional
+// "ttl" duration parameter, changes a logger's level until the ttl elapses;
+// "reset", with a "name", reverts it early.
+type LogLevelDataSource struct {
+	sync.Mutex
+	levels  map[string]*logLevelEntry
+	watcher source.GenericDataWatcher
+}
+
+type logLevelEntry struct {
+	level   LogLevel
+	revert  string
+	expires time.Time
+	timer   *time.Timer
+	gen     uint64
+}
+
+// NewLogLevelDataSource creates a new data source with no loggers.
+func NewLogLevelDataSource() *LogLevelDataSource {
+	return &LogLevelDataSource{
+		levels: make(map[string]*logLevelEntry),
+	}
+}
+
+// Add adds a logger's level under the given name, replacing any already
+// added with that name.
+func (lds *LogLevelDataSource) Add(name string, level LogLevel) {
+	lds.Lock()
+	if ent, ok := lds.levels[name]; ok && ent.timer != nil {
+		ent.timer.Stop()
+	}
+	lds.levels[name] = &logLevelEntry{level: level}
+	lds.Unlock()
+}
+
+// Name returns the static "/meta/loglevel" string.
+func (lds *LogLevelDataSource) Name() string {
+	return LogLevelName
+}
+
+// TextTemplate returns a text/template to implement the GenericDataSource with
+// a "text" format option.
+func (lds *LogLevelDataSource) TextTemplate() *template.Template {
+	return logLevelTextTemplate
+}
+
+// Get returns a LogLevelInfo for every logger, sorted by name.
+func (lds *LogLevelDataSource) Get() interface{} {
+	lds.Lock()
+	infos := make([]LogLevelInfo, 0, len(lds.levels))
+	for name, ent := range lds.levels {
+		infos = append(infos, ent.info(name))
+	}
+	lds.Unlock()
+	sort.Sort(logLevelsByName(infos))
+	return infos
+}
+
+// SetWatcher implements GenericDataSource by retaining a reference to the
+// passed watcher.
+func (lds *LogLevelDataSource) SetWatcher(watcher source.GenericDataWatcher) {
+	lds.Lock()
+	lds.watcher = source.AddWatcher(lds.watcher, watcher)
+	lds.Unlock()
+}
+
+// Action implements the "set" and "reset" actions.
+func (lds *LogLevelDataSource) Action(name string, params map[string]string) error {
+	switch name {
+	case "set":
+		ttl := DefaultLogLevelTTL
+		if s, ok := params["ttl"]; ok {
+			d, err := time.ParseDuration(s)
+			if err != nil || d <= 0 {
+				return source.ErrInvalidParam
+			}
+			ttl = d
+		}
+		return lds.set(params["name"], params["level"], ttl)
+	case "reset":
+		return lds.reset(params["name"], 0)
+	default:
+		return source.ErrUnknownAction
+	}
+}
+
+func (lds *LogLevelDataSource) set(name, level string, ttl time.Duration) error {
+	lds.Lock()
+	ent, ok := lds.levels[name]
+	if !ok || level == "" {
+		lds.Unlock()
+		return source.ErrInvalidParam
+	}
+	orig := ent.level.Level()
+	if err := ent.level.SetLevel(level); err != nil {
+		lds.Unlock()
+		return source.ErrInvalidParam
+	}
+	if ent.timer != nil {
+		ent.timer.Stop()
+	} else {
+		// the first set remembers the level to revert to
+		ent.revert = orig
+	}
+	ent.expires = time.Now().Add(ttl)
+	ent.gen++
+	gen := ent.gen
+	ent.timer = time.AfterFunc(ttl, func() {
+		lds.reset(name, gen)
+	})
+	info := ent.info(name)
+	watcher := lds.watcher
+	lds.Unlock()
+	lds.emit(watcher, info)
+	return nil
+}
+
+// reset reverts the named logger's level, if it's been set; if gen is
+// non-zero, it's only reverted if it hasn't been set again since, as it may
+// have been while its timer fired.
+func (lds *LogLevelDataSource) reset(name string, gen uint64) error {
+	lds.Lock()
+	ent, ok := lds.levels[name]
+	if !ok {
+		lds.Unlock()
+		return source.ErrInvalidParam
+	}
+	if ent.timer == nil || (gen != 0 && ent.gen != gen) {
+		lds.Unlock()
+		return nil
+	}
+	ent.timer.Stop()
+	ent.timer = nil
+	err := ent.level.SetLevel(ent.revert)
+	ent.revert = ""
+	info := ent.info(name)
+	watcher := lds.watcher
+	lds.Unlock()
+	lds.emit(watcher, info)
+	return err
+}
+
+func (lds *LogLevelDataSource) emit(watcher source.GenericDataWatcher, info LogLevelInfo) {
+	if watcher != nil && watcher.Active() {
+		watcher.HandleItem(info)
+	}
+}
+
+type logLevelsByName []LogLevelInfo
+
+func (lls logLevelsByName) Len() int           { return len(lls) }
+func (lls logLevelsByName) Less(i, j int) bool { return lls[i].Name < lls[j].Name }
+func (lls logLevelsByName) Swap(i, j int)      { lls[i], lls[j] = lls[j], lls[i] }
+
+func (ent *logLevelEntry) info(name string) LogLevelInfo {
+	info := LogLevelInfo{
+		Name:  name,
+		Level: ent.level.Level(),
+	}
+	if ent.timer != nil {
+		expires := ent.expires
+		info.Revert = ent.revert
+		info.Expires = &expires
+	}
+	return info
+}
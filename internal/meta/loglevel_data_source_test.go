@@ -0,0 +1,92 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package meta_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/uber-go/gwr/internal/meta"
+	"github.com/uber-go/gwr/source"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testLevel struct {
+	level string
+}
+
+func (tl *testLevel) Level() string { return tl.level }
+
+func (tl *testLevel) SetLevel(level string) error {
+	if level == "bogus" {
+		return errors.New("bogus level")
+	}
+	tl.level = level
+	return nil
+}
+
+func TestLogLevelDataSource(t *testing.T) {
+	lds := meta.NewLogLevelDataSource()
+	assert.Equal(t, meta.LogLevelName, lds.Name())
+	level := &testLevel{level: "info"}
+	lds.Add("app", level)
+	assert.Equal(t, []meta.LogLevelInfo{{Name: "app", Level: "info"}}, lds.Get())
+
+	assert.Equal(t, source.ErrUnknownAction, lds.Action("nope", nil))
+	assert.Equal(t, source.ErrInvalidParam, lds.Action("set", map[string]string{
+		"name": "other", "level": "debug",
+	}), "unknown logger")
+	assert.Equal(t, source.ErrInvalidParam, lds.Action("set", map[string]string{
+		"name": "app", "level": "bogus",
+	}), "invalid level")
+	assert.Equal(t, source.ErrInvalidParam, lds.Action("set", map[string]string{
+		"name": "app", "level": "debug", "ttl": "soon",
+	}), "invalid ttl")
+
+	require.NoError(t, lds.Action("set", map[string]string{
+		"name": "app", "level": "debug", "ttl": "1h",
+	}))
+	infos := lds.Get().([]meta.LogLevelInfo)
+	require.Len(t, infos, 1)
+	assert.Equal(t, "debug", infos[0].Level)
+	assert.Equal(t, "info", infos[0].Revert)
+	require.NotNil(t, infos[0].Expires)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), *infos[0].Expires, time.Minute)
+
+	require.NoError(t, lds.Action("set", map[string]string{
+		"name": "app", "level": "warn", "ttl": "1h",
+	}))
+	assert.Equal(t, "info", lds.Get().([]meta.LogLevelInfo)[0].Revert, "reverts to the original level")
+
+	require.NoError(t, lds.Action("reset", map[string]string{"name": "app"}))
+	assert.Equal(t, []meta.LogLevelInfo{{Name: "app", Level: "info"}}, lds.Get())
+
+	require.NoError(t, lds.Action("set", map[string]string{
+		"name": "app", "level": "debug", "ttl": "10ms",
+	}))
+	for i := 0; i < 100 && lds.Get().([]meta.LogLevelInfo)[0].Level != "info"; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, []meta.LogLevelInfo{{Name: "app", Level: "info"}}, lds.Get(), "reverted after ttl")
+}
@@ -24,6 +24,7 @@ import (
 	"strings"
 	"text/template"
 
+	"github.com/uber-go/gwr/internal/marshaled"
 	"github.com/uber-go/gwr/source"
 )
 
@@ -36,6 +37,15 @@ var nounsTextTemplate = template.Must(template.New("meta_nouns_text").Parse(stri
 {{ end }}{{ end }}
 `)))
 
+// nounsLongTextTemplate is like "ls -l" for data sources, with a column for
+// each of the source's Stats; sources without stats show dashes.
+var nounsLongTextTemplate = template.Must(template.New("meta_nouns_long_text").Parse(strings.TrimSpace(`
+{{ define "get" }}Data Sources:
+{{ printf "%-6s %8s %10s %8s" "ACTIVE" "WATCHERS" "ITEMS/SEC" "DROPS" }} NAME
+{{ range $name, $info := . }}{{ with $info.Stats }}{{ if .Active }}yes   {{ else }}no    {{ end }} {{ printf "%8d %10.1f %8d" .Watchers .Rate .Dropped }}{{ else }}{{ printf "%-6s %8s %10s %8s" "-" "-" "-" "-" }}{{ end }} {{ $name }} formats: {{ $info.Formats }}
+{{ end }}{{ end }}
+`)))
+
 // NounDataSource provides a data source that describes other data sources.  It
 // is used to implement the "/meta/nouns" data source.
 type NounDataSource struct {
@@ -78,7 +88,7 @@ func (nds *NounDataSource) WatchInit() interface{} {
 // passed watcher.  Updates are later sent to the watcher when new data sources
 // are added and removed.
 func (nds *NounDataSource) SetWatcher(watcher source.GenericDataWatcher) {
-	nds.watcher = watcher
+	nds.watcher = source.AddWatcher(nds.watcher, watcher)
 }
 
 // SourceAdded is called whenever a source is added to the DataSources.
@@ -103,3 +113,49 @@ func (nds *NounDataSource) SourceRemoved(ds source.DataSource) {
 		Name string `json:"name"`
 	}{"remove", ds.Name()})
 }
+
+// nounMatchDataSource is a get-only variant of NounDataSource that only
+// describes data sources matching a pattern.
+type nounMatchDataSource struct {
+	sources *source.DataSources
+	pattern string
+	long    bool
+}
+
+// NewNounMatchDataSource creates a get-only data source, like "/meta/nouns",
+// that only describes the data sources matching the given pattern; see
+// source.DataSources.Match.
+func NewNounMatchDataSource(dss *source.DataSources, pattern string) source.DataSource {
+	return marshaled.NewDataSource(&nounMatchDataSource{
+		sources: dss,
+		pattern: pattern,
+	}, nil)
+}
+
+// NewLongNounMatchDataSource is like NewNounMatchDataSource, except that each
+// source's Stats are included, and shown as extra columns in the text format.
+func NewLongNounMatchDataSource(dss *source.DataSources, pattern string) source.DataSource {
+	return marshaled.NewDataSource(&nounMatchDataSource{
+		sources: dss,
+		pattern: pattern,
+		long:    true,
+	}, nil)
+}
+
+func (nmds *nounMatchDataSource) Name() string {
+	return NounsName
+}
+
+func (nmds *nounMatchDataSource) TextTemplate() *template.Template {
+	if nmds.long {
+		return nounsLongTextTemplate
+	}
+	return nounsTextTemplate
+}
+
+func (nmds *nounMatchDataSource) Get() interface{} {
+	if nmds.long {
+		return nmds.sources.LongInfoMatching(nmds.pattern)
+	}
+	return nmds.sources.InfoMatching(nmds.pattern)
+}
@@ -23,6 +23,8 @@ package meta_test
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
+	"io/ioutil"
 	"os"
 	"strings"
 	"testing"
@@ -79,10 +81,10 @@ func TestNounDataSource_Watch(t *testing.T) {
 
 	// verify init data
 	assertJSONScanLine(t, sc,
-		`{"/meta/nouns":{"formats":["json","text"],"attrs":null}}`,
+		`{"/meta/nouns":{"formats":["html","json","table","text"],"attrs":null}}`,
 		"should get /meta/nouns initially")
 	assert.Equal(t, getText(), "Data Sources:\n"+
-		"/meta/nouns formats: [json text]\n")
+		"/meta/nouns formats: [html json table text]\n")
 
 	// add a data source, observe it
 	assert.NoError(t, dss.Add(marshaled.NewDataSource(&dummyDataSource{
@@ -90,11 +92,11 @@ func TestNounDataSource_Watch(t *testing.T) {
 		tmpl: nil,
 	}, nil)), "no add error expected")
 	assertJSONScanLine(t, sc,
-		`{"name":"/foo","type":"add","info":{"formats":["json","text"],"attrs":null}}`,
+		`{"name":"/foo","type":"add","info":{"formats":["html","json","table","text"],"attrs":null}}`,
 		"should get an add event for /foo")
 	assert.Equal(t, getText(), "Data Sources:\n"+
-		"/foo formats: [json text]\n"+
-		"/meta/nouns formats: [json text]\n")
+		"/foo formats: [html json table text]\n"+
+		"/meta/nouns formats: [html json table text]\n")
 
 	// add another data source, observe it
 	assert.NoError(t, dss.Add(marshaled.NewDataSource(&dummyDataSource{
@@ -102,12 +104,12 @@ func TestNounDataSource_Watch(t *testing.T) {
 		tmpl: template.Must(template.New("bar_tmpl").Parse("")),
 	}, nil)), "no add error expected")
 	assertJSONScanLine(t, sc,
-		`{"name":"/bar","type":"add","info":{"formats":["json","text"],"attrs":null}}`,
+		`{"name":"/bar","type":"add","info":{"formats":["html","json","table","text"],"attrs":null}}`,
 		"should get an add event for /bar")
 	assert.Equal(t, getText(), "Data Sources:\n"+
-		"/bar formats: [json text]\n"+
-		"/foo formats: [json text]\n"+
-		"/meta/nouns formats: [json text]\n")
+		"/bar formats: [html json table text]\n"+
+		"/foo formats: [html json table text]\n"+
+		"/meta/nouns formats: [html json table text]\n")
 
 	// remove the /foo data source, observe it
 	assert.NotNil(t, dss.Remove("/foo"), "expected a removed data source")
@@ -115,8 +117,8 @@ func TestNounDataSource_Watch(t *testing.T) {
 		`{"name":"/foo","type":"remove"}`,
 		"should get a remove event for /foo")
 	assert.Equal(t, getText(), "Data Sources:\n"+
-		"/bar formats: [json text]\n"+
-		"/meta/nouns formats: [json text]\n")
+		"/bar formats: [html json table text]\n"+
+		"/meta/nouns formats: [html json table text]\n")
 
 	// remove the /bar data source, observe it
 	assert.NotNil(t, dss.Remove("/bar"), "expected a removed data source")
@@ -124,13 +126,65 @@ func TestNounDataSource_Watch(t *testing.T) {
 		`{"name":"/bar","type":"remove"}`,
 		"should get a remove event for /bar")
 	assert.Equal(t, getText(), "Data Sources:\n"+
-		"/meta/nouns formats: [json text]\n")
+		"/meta/nouns formats: [html json table text]\n")
 
 	// shutdown the watch stream
 	assert.NoError(t, r.Close())
 	assert.False(t, sc.Scan(), "no more scan")
 }
 
+type watchedDataSource struct {
+	dummyDataSource
+	watcher source.GenericDataWatcher
+}
+
+func (wds *watchedDataSource) SetWatcher(watcher source.GenericDataWatcher) {
+	wds.watcher = watcher
+}
+
+func TestLongNounMatchDataSource(t *testing.T) {
+	dss := setup()
+	wds := &watchedDataSource{dummyDataSource: dummyDataSource{name: "/foo"}}
+	foo := marshaled.NewDataSource(wds, nil)
+	assert.NoError(t, dss.Add(foo), "no add error expected")
+	assert.NoError(t, foo.Watch("json", ioutil.Discard))
+	for i := 0; i < 3; i++ {
+		assert.True(t, wds.watcher.HandleItem(i), "should accept item")
+	}
+
+	src := meta.NewLongNounMatchDataSource(dss, "/*")
+
+	var buf bytes.Buffer
+	assert.NoError(t, src.Get("text", &buf))
+	assert.Equal(t, "Data Sources:\n"+
+		"ACTIVE WATCHERS  ITEMS/SEC    DROPS NAME\n"+
+		"yes           1        0.0        0 /foo formats: [html json table text]\n"+
+		"no            0        0.0        0 /meta/nouns formats: [html json table text]\n",
+		buf.String())
+
+	buf.Reset()
+	assert.NoError(t, src.Get("json", &buf))
+	var info map[string]source.Info
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &info))
+	if assert.NotNil(t, info["/foo"].Stats, "expected /foo stats") {
+		// the items may not have been written yet
+		info["/foo"].Stats.Bytes = 0
+		info["/foo"].Stats.Queued = 0
+		assert.Equal(t, source.Stats{
+			Active:         true,
+			Watchers:       1,
+			Items:          3,
+			FormatWatchers: map[string]int{"json": 1},
+			QueueSize:      200,
+		}, *info["/foo"].Stats)
+	}
+
+	// the plain listing is unchanged
+	buf.Reset()
+	assert.NoError(t, meta.NewNounMatchDataSource(dss, "/foo").Get("text", &buf))
+	assert.Equal(t, "Data Sources:\n/foo formats: [html json table text]\n", buf.String())
+}
+
 func assertJSONScanLine(t *testing.T, sc *bufio.Scanner, expected string, msgAndArgs ...interface{}) {
 	if !sc.Scan() {
 		assert.Fail(t, "expected to scan a JSON line", msgAndArgs...)
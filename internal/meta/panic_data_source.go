@@ -0,0 +1,99 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package meta
+
+import (
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/uber-go/gwr/source"
+)
+
+// PanicsName is the name of the runtime panics data source.
+const PanicsName = "/runtime/panics"
+
+// maxRecentPanics is how many recovered panics are retained for Get.
+const maxRecentPanics = 10
+
+var panicsTextTemplate = template.Must(template.New("runtime_panics_text").Parse(strings.TrimSpace(`
+{{ define "get" }}{{ range . }}{{ template "item" . }}
+{{ end }}{{ end }}
+{{ define "item" }}{{ .Source }}: panic during {{ .Op }}: {{ .Value }}
+{{ .Stack }}{{ end }}
+`)))
+
+// PanicDataSource provides a data source that reports panics recovered from
+// user-provided source code.  It is used to implement the "/runtime/panics"
+// data source.
+type PanicDataSource struct {
+	sync.Mutex
+	recent  []*source.PanicError
+	watcher source.GenericDataWatcher
+}
+
+// NewPanicDataSource creates a new data source that retains the last few
+// recovered panics, and streams any new ones.
+func NewPanicDataSource() *PanicDataSource {
+	return &PanicDataSource{}
+}
+
+// Name returns the static "/runtime/panics" string.
+func (pds *PanicDataSource) Name() string {
+	return PanicsName
+}
+
+// TextTemplate returns a text/template to implement the GenericDataSource with
+// a "text" format option.
+func (pds *PanicDataSource) TextTemplate() *template.Template {
+	return panicsTextTemplate
+}
+
+// Get returns the most recently recovered panics, oldest first.
+func (pds *PanicDataSource) Get() interface{} {
+	pds.Lock()
+	recent := append([]*source.PanicError(nil), pds.recent...)
+	pds.Unlock()
+	return recent
+}
+
+// SetWatcher implements GenericDataSource by retaining a reference to the
+// passed watcher.
+func (pds *PanicDataSource) SetWatcher(watcher source.GenericDataWatcher) {
+	pds.Lock()
+	pds.watcher = source.AddWatcher(pds.watcher, watcher)
+	pds.Unlock()
+}
+
+// ObservePanic records a recovered panic, and passes it to any active
+// watcher.
+func (pds *PanicDataSource) ObservePanic(pe *source.PanicError) {
+	pds.Lock()
+	if len(pds.recent) >= maxRecentPanics {
+		pds.recent = append(pds.recent[:0], pds.recent[1:]...)
+	}
+	pds.recent = append(pds.recent, pe)
+	watcher := pds.watcher
+	pds.Unlock()
+	if watcher != nil && watcher.Active() {
+		watcher.HandleItem(pe)
+	}
+}
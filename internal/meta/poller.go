@@ -0,0 +1,105 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package meta
+
+import (
+	"sync"
+	"time"
+
+	"github.com/uber-go/gwr/source"
+)
+
+// poller implements watching for sources that have no events of their own, by
+// emitting a fresh Get result every interval while there are any watchers.
+//
+// A nil result emits nothing, and a []interface{} result emits a batch.  If
+// set, reset is called whenever polling (re)starts.
+type poller struct {
+	interval time.Duration
+	get      func() interface{}
+	reset    func()
+
+	sync.Mutex
+	watcher source.GenericDataWatcher
+	stop    chan struct{}
+}
+
+// SetWatcher retains a reference to the passed watcher.
+func (pl *poller) SetWatcher(watcher source.GenericDataWatcher) {
+	pl.Lock()
+	pl.watcher = source.AddWatcher(pl.watcher, watcher)
+	pl.Unlock()
+}
+
+// Activate starts polling, until there are no watchers.
+func (pl *poller) Activate() {
+	pl.Lock()
+	defer pl.Unlock()
+	if pl.stop == nil {
+		pl.stop = make(chan struct{})
+		if pl.reset != nil {
+			pl.reset()
+		}
+		go pl.poll(pl.stop)
+	}
+}
+
+// Deactivate stops polling right away, rather than at the next tick, once
+// there are no watchers.
+func (pl *poller) Deactivate() {
+	pl.Lock()
+	defer pl.Unlock()
+	if pl.stop != nil && (pl.watcher == nil || !pl.watcher.Active()) {
+		close(pl.stop)
+		pl.stop = nil
+	}
+}
+
+func (pl *poller) poll(stop chan struct{}) {
+	ticker := time.NewTicker(pl.interval)
+	defer ticker.Stop()
+	for {
+		pl.Lock()
+		watcher := pl.watcher
+		if watcher == nil || !watcher.Active() {
+			if pl.stop == stop {
+				pl.stop = nil
+			}
+			pl.Unlock()
+			return
+		}
+		pl.Unlock()
+		switch item := pl.get().(type) {
+		case nil:
+		case []interface{}:
+			if len(item) > 0 {
+				watcher.HandleItems(item)
+			}
+		default:
+			watcher.HandleItem(item)
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
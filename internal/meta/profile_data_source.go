@@ -0,0 +1,195 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package meta
+
+import (
+	"context"
+	"errors"
+	"io"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/uber-go/gwr/source"
+)
+
+const (
+	// GoroutinesName is the name of the goroutine dump data source.
+	GoroutinesName = "/debug/goroutines"
+
+	// HeapName is the name of the heap profile data source.
+	HeapName = "/debug/heap"
+
+	// CPUProfileName is the name of the cpu profile data source.
+	CPUProfileName = "/debug/profile"
+)
+
+const (
+	defaultProfileSeconds = 30
+	maxProfileSeconds     = 300
+)
+
+var errNoSuchProfile = errors.New("no such runtime profile")
+
+// ProfileDataSource is a Get-able data source backed by a named
+// runtime/pprof profile, e.g. "goroutine" or "heap".  The "pprof" format
+// provides the binary protocol buffer profile, as consumed by "go tool pprof",
+// while the "text" format provides its human readable form.
+type ProfileDataSource struct {
+	name      string
+	profile   string
+	textDebug int
+}
+
+// NewProfileDataSource creates a data source for the named runtime/pprof
+// profile; textDebug is the pprof debug level used for the "text" format.
+func NewProfileDataSource(name, profile string, textDebug int) *ProfileDataSource {
+	return &ProfileDataSource{
+		name:      name,
+		profile:   profile,
+		textDebug: textDebug,
+	}
+}
+
+// NewGoroutinesDataSource creates the "/debug/goroutines" data source, whose
+// text format is a full dump of all goroutine stacks.
+func NewGoroutinesDataSource() *ProfileDataSource {
+	return NewProfileDataSource(GoroutinesName, "goroutine", 2)
+}
+
+// NewHeapDataSource creates the "/debug/heap" data source.
+func NewHeapDataSource() *ProfileDataSource {
+	return NewProfileDataSource(HeapName, "heap", 1)
+}
+
+// Name returns the data source name.
+func (pds *ProfileDataSource) Name() string {
+	return pds.name
+}
+
+// Formats returns "text" and "pprof".
+func (pds *ProfileDataSource) Formats() []string {
+	return []string{"text", "pprof"}
+}
+
+// Attrs returns the name of the backing profile.
+func (pds *ProfileDataSource) Attrs() map[string]interface{} {
+	return map[string]interface{}{"profile": pds.profile}
+}
+
+// Get writes the current profile in the given format.
+func (pds *ProfileDataSource) Get(format string, w io.Writer) error {
+	prof := pprof.Lookup(pds.profile)
+	if prof == nil {
+		return errNoSuchProfile
+	}
+	switch strings.ToLower(format) {
+	case "text":
+		return prof.WriteTo(w, pds.textDebug)
+	case "pprof":
+		return prof.WriteTo(w, 0)
+	default:
+		return source.ErrUnsupportedFormat
+	}
+}
+
+// Watch returns source.ErrNotWatchable, profiles are only snapshots.
+func (pds *ProfileDataSource) Watch(format string, w io.Writer) error {
+	return source.ErrNotWatchable
+}
+
+// CPUProfileDataSource is a Get-able data source that runs a cpu profile,
+// for 30 seconds by default, and then returns it in "pprof" format.  The
+// duration may be chosen with a "seconds" Get parameter.
+type CPUProfileDataSource struct{}
+
+// NewCPUProfileDataSource creates the "/debug/profile" data source.
+func NewCPUProfileDataSource() *CPUProfileDataSource {
+	return &CPUProfileDataSource{}
+}
+
+// Name returns the static "/debug/profile" string.
+func (cds *CPUProfileDataSource) Name() string {
+	return CPUProfileName
+}
+
+// Formats returns "pprof".
+func (cds *CPUProfileDataSource) Formats() []string {
+	return []string{"pprof"}
+}
+
+// Attrs returns nil.
+func (cds *CPUProfileDataSource) Attrs() map[string]interface{} {
+	return nil
+}
+
+// Get profiles for the default duration.
+func (cds *CPUProfileDataSource) Get(format string, w io.Writer) error {
+	return cds.GetParamsContext(context.Background(), format, nil, w)
+}
+
+// GetParams profiles for the number of seconds given by the "seconds"
+// parameter, up to five minutes.  Only one cpu profile may run at a time.
+func (cds *CPUProfileDataSource) GetParams(format string, params map[string]string, w io.Writer) error {
+	return cds.GetParamsContext(context.Background(), format, params, w)
+}
+
+// GetParamsContext is like GetParams, except that the profile is stopped,
+// and the context's error returned, as soon as the context is done, e.g.
+// when the client goes away, so that the profiler is freed for others.
+func (cds *CPUProfileDataSource) GetParamsContext(
+	ctx context.Context,
+	format string,
+	params map[string]string,
+	w io.Writer,
+) error {
+	if strings.ToLower(format) != "pprof" {
+		return source.ErrUnsupportedFormat
+	}
+
+	seconds := defaultProfileSeconds
+	if str, ok := params["seconds"]; ok {
+		n, err := strconv.Atoi(str)
+		if err != nil || n <= 0 || n > maxProfileSeconds {
+			return source.ErrInvalidParam
+		}
+		seconds = n
+	}
+
+	if err := pprof.StartCPUProfile(w); err != nil {
+		return err
+	}
+	defer pprof.StopCPUProfile()
+	timer := time.NewTimer(time.Duration(seconds) * time.Second)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Watch returns source.ErrNotWatchable, profiles are only snapshots.
+func (cds *CPUProfileDataSource) Watch(format string, w io.Writer) error {
+	return source.ErrNotWatchable
+}
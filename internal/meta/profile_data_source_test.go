@@ -0,0 +1,81 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package meta_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/uber-go/gwr/internal/meta"
+	"github.com/uber-go/gwr/source"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfileDataSource_Get(t *testing.T) {
+	gds := meta.NewGoroutinesDataSource()
+	assert.Equal(t, meta.GoroutinesName, gds.Name())
+
+	var buf bytes.Buffer
+	assert.NoError(t, gds.Get("text", &buf))
+	assert.Contains(t, buf.String(), "TestProfileDataSource_Get", "text dump has this test's stack")
+
+	buf.Reset()
+	assert.NoError(t, gds.Get("pprof", &buf))
+	assert.True(t, buf.Len() > 0, "got a binary profile")
+
+	assert.Equal(t, source.ErrUnsupportedFormat, gds.Get("json", &buf))
+	assert.Equal(t, source.ErrNotWatchable, gds.Watch("text", &buf))
+}
+
+func TestCPUProfileDataSource_GetParams(t *testing.T) {
+	cds := meta.NewCPUProfileDataSource()
+
+	var buf bytes.Buffer
+	for _, seconds := range []string{"0", "-1", "nope", "301"} {
+		assert.Equal(t, source.ErrInvalidParam,
+			cds.GetParams("pprof", map[string]string{"seconds": seconds}, &buf),
+			"invalid seconds %q", seconds)
+	}
+	assert.Equal(t, source.ErrUnsupportedFormat, cds.Get("text", &buf))
+
+	assert.NoError(t, cds.GetParams("pprof", map[string]string{"seconds": "1"}, &buf))
+	assert.True(t, buf.Len() > 0, "got a binary profile")
+}
+
+func TestCPUProfileDataSource_GetParamsContext(t *testing.T) {
+	cds := meta.NewCPUProfileDataSource()
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(20*time.Millisecond, cancel)
+
+	var buf bytes.Buffer
+	start := time.Now()
+	assert.Equal(t, context.Canceled,
+		cds.GetParamsContext(ctx, "pprof", map[string]string{"seconds": "300"}, &buf))
+	assert.True(t, time.Since(start) < 5*time.Second, "profile stopped when canceled")
+
+	// the profiler is free again
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, cds.GetParamsContext(ctx, "pprof", nil, &buf))
+}
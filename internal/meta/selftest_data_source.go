@@ -0,0 +1,253 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package meta
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/uber-go/gwr/source"
+)
+
+// SelftestName is the name of the self test data source.
+const SelftestName = "/meta/selftest"
+
+// selftestDialTimeout bounds how long the listener check waits to connect.
+const selftestDialTimeout = time.Second
+
+// saturatedFraction is how full a source's queue must be for the buffers
+// check to warn about it.
+const saturatedFraction = 0.75
+
+// The statuses of a Check, from best to worst.
+const (
+	CheckOK   = "ok"
+	CheckWarn = "warn"
+	CheckFail = "fail"
+)
+
+var selftestTextTemplate = template.Must(template.New("meta_selftest_text").Parse(strings.TrimSpace(`
+{{ define "get" }}{{ range .Checks }}{{ printf "%-4s" .Status }} {{ .Name }}: {{ .Detail }}
+{{ end }}{{ if .OK }}ok{{ else }}FAILED{{ end }}
+{{ end }}
+`)))
+
+// Check is the result of one of the self test's checks.
+type Check struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+}
+
+// Selftest is the result of running the self test; it's OK unless a check
+// failed.
+type Selftest struct {
+	OK     bool    `json:"ok"`
+	Checks []Check `json:"checks"`
+}
+
+// SelftestDataSource provides a data source that, when gotten, checks that
+// gwr is working: that the registry of sources is consistent, that no
+// source's processor is stuck, or its queue saturated, and that the server's
+// listeners accept connections.  It is used to implement the
+// "/meta/selftest" data source.
+type SelftestDataSource struct {
+	sources *source.DataSources
+
+	lock      sync.Mutex
+	listeners []net.Addr
+}
+
+// NewSelftestDataSource creates a new self test of the given sources; until
+// a listener is added, the listener check only warns.
+func NewSelftestDataSource(dss *source.DataSources) *SelftestDataSource {
+	return &SelftestDataSource{sources: dss}
+}
+
+// AddListener adds a server's listening address to the listener check,
+// returning a function that removes it, once the server stops listening.
+func (sds *SelftestDataSource) AddListener(addr net.Addr) func() {
+	sds.lock.Lock()
+	sds.listeners = append(sds.listeners, addr)
+	sds.lock.Unlock()
+	return func() {
+		sds.lock.Lock()
+		defer sds.lock.Unlock()
+		for i, other := range sds.listeners {
+			if other == addr {
+				sds.listeners = append(sds.listeners[:i:i], sds.listeners[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Name returns the static "/meta/selftest" string.
+func (sds *SelftestDataSource) Name() string {
+	return SelftestName
+}
+
+// TextTemplate returns a text/template listing each check's status.
+func (sds *SelftestDataSource) TextTemplate() *template.Template {
+	return selftestTextTemplate
+}
+
+// Get runs the checks, returning a Selftest.
+func (sds *SelftestDataSource) Get() interface{} {
+	var srcs []source.DataSource
+	if sds.sources != nil {
+		srcs = sds.sources.Match("/*")
+	}
+	st := Selftest{
+		OK: true,
+		Checks: []Check{
+			sds.checkRegistry(srcs),
+			checkProcessors(srcs),
+			checkBuffers(srcs),
+			sds.checkListeners(),
+		},
+	}
+	for _, check := range st.Checks {
+		if check.Status == CheckFail {
+			st.OK = false
+		}
+	}
+	return st
+}
+
+// checkRegistry checks that every source is found under its own name, and
+// that the inputs of any derived sources are there too.
+func (sds *SelftestDataSource) checkRegistry(srcs []source.DataSource) Check {
+	check := Check{Name: "registry", Status: CheckOK}
+	var problems []string
+	for _, ds := range srcs {
+		if sds.sources.Get(ds.Name()) != ds {
+			check.Status = CheckFail
+			problems = append(problems, fmt.Sprintf("%s not found under its name", ds.Name()))
+		}
+		dsrc, ok := ds.(source.DerivedSource)
+		if !ok {
+			continue
+		}
+		for _, input := range dsrc.Inputs() {
+			if sds.sources.Get(input) == nil {
+				if check.Status == CheckOK {
+					check.Status = CheckWarn
+				}
+				problems = append(problems, fmt.Sprintf("%s input %s missing", ds.Name(), input))
+			}
+		}
+	}
+	if len(problems) == 0 {
+		check.Detail = fmt.Sprintf("%d sources", len(srcs))
+	} else {
+		check.Detail = strings.Join(problems, "; ")
+	}
+	return check
+}
+
+// checkProcessors checks that no source has taken longer than
+// source.StallTimeout to emit an item.
+func checkProcessors(srcs []source.DataSource) Check {
+	check := Check{Name: "processors", Status: CheckOK}
+	var active int
+	var stalled []string
+	for _, ds := range srcs {
+		if st := source.GetStats(ds); st != nil && st.Active {
+			active++
+			if st.Stalled {
+				stalled = append(stalled, ds.Name())
+			}
+		}
+	}
+	if len(stalled) > 0 {
+		check.Status = CheckFail
+		check.Detail = fmt.Sprintf("stalled for over %v: %s", source.StallTimeout, strings.Join(stalled, ", "))
+	} else {
+		check.Detail = fmt.Sprintf("%d active", active)
+	}
+	return check
+}
+
+// checkBuffers checks that no source's queue is full, warning if any is
+// nearly so.
+func checkBuffers(srcs []source.DataSource) Check {
+	check := Check{Name: "buffers", Status: CheckOK}
+	var problems []string
+	for _, ds := range srcs {
+		st := source.GetStats(ds)
+		if st == nil || st.QueueSize == 0 {
+			continue
+		}
+		switch {
+		case st.Queued >= st.QueueSize:
+			check.Status = CheckFail
+		case float64(st.Queued) >= saturatedFraction*float64(st.QueueSize):
+			if check.Status == CheckOK {
+				check.Status = CheckWarn
+			}
+		default:
+			continue
+		}
+		problems = append(problems, fmt.Sprintf("%s queued %d/%d", ds.Name(), st.Queued, st.QueueSize))
+	}
+	if len(problems) == 0 {
+		check.Detail = "no queue saturated"
+	} else {
+		check.Detail = strings.Join(problems, "; ")
+	}
+	return check
+}
+
+// checkListeners checks that each of the server's listeners accepts a
+// connection.
+func (sds *SelftestDataSource) checkListeners() Check {
+	check := Check{Name: "listeners", Status: CheckOK}
+	sds.lock.Lock()
+	addrs := sds.listeners
+	sds.lock.Unlock()
+	if len(addrs) == 0 {
+		check.Status = CheckWarn
+		check.Detail = "not listening"
+		return check
+	}
+
+	var problems []string
+	for _, addr := range addrs {
+		conn, err := net.DialTimeout(addr.Network(), addr.String(), selftestDialTimeout)
+		if err != nil {
+			check.Status = CheckFail
+			problems = append(problems, err.Error())
+			continue
+		}
+		conn.Close()
+	}
+	if len(problems) == 0 {
+		check.Detail = fmt.Sprintf("%d accepting", len(addrs))
+	} else {
+		check.Detail = strings.Join(problems, "; ")
+	}
+	return check
+}
@@ -0,0 +1,103 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package meta_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber-go/gwr/internal/marshaled"
+	"github.com/uber-go/gwr/internal/meta"
+	"github.com/uber-go/gwr/source"
+)
+
+type statsDataSource struct {
+	*marshaled.DataSource
+	stats source.Stats
+}
+
+func (sds *statsDataSource) Stats() source.Stats {
+	return sds.stats
+}
+
+func TestSelftestDataSource(t *testing.T) {
+	dss := source.NewDataSources()
+	sds := meta.NewSelftestDataSource(dss)
+	require.NoError(t, dss.Add(marshaled.NewDataSource(sds, nil)))
+	assert.Equal(t, meta.SelftestName, sds.Name())
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	remove := sds.AddListener(ln.Addr())
+
+	assert.Equal(t, meta.Selftest{
+		OK: true,
+		Checks: []meta.Check{
+			{Name: "registry", Status: meta.CheckOK, Detail: "1 sources"},
+			{Name: "processors", Status: meta.CheckOK, Detail: "0 active"},
+			{Name: "buffers", Status: meta.CheckOK, Detail: "no queue saturated"},
+			{Name: "listeners", Status: meta.CheckOK, Detail: "1 accepting"},
+		},
+	}, sds.Get())
+
+	require.NoError(t, dss.Add(marshaled.NewDataSource(&derivedDataSource{
+		dummyDataSource: dummyDataSource{name: "/foo/agg"},
+		inputs:          []string{"/foo"},
+	}, nil)))
+	require.NoError(t, dss.Add(&statsDataSource{
+		DataSource: marshaled.NewDataSource(&dummyDataSource{name: "/busy"}, nil),
+		stats:      source.Stats{Active: true, Queued: 80, QueueSize: 100},
+	}))
+	require.NoError(t, dss.Add(&statsDataSource{
+		DataSource: marshaled.NewDataSource(&dummyDataSource{name: "/stuck"}, nil),
+		stats:      source.Stats{Active: true, Queued: 100, QueueSize: 100, Stalled: true},
+	}))
+	remove()
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	closed.Close()
+	sds.AddListener(closed.Addr())
+
+	st := sds.Get().(meta.Selftest)
+	assert.False(t, st.OK)
+	require.Len(t, st.Checks, 4)
+	assert.Equal(t, meta.Check{
+		Name:   "registry",
+		Status: meta.CheckWarn,
+		Detail: "/foo/agg input /foo missing",
+	}, st.Checks[0])
+	assert.Equal(t, meta.Check{
+		Name:   "processors",
+		Status: meta.CheckFail,
+		Detail: "stalled for over 10s: /stuck",
+	}, st.Checks[1])
+	assert.Equal(t, meta.Check{
+		Name:   "buffers",
+		Status: meta.CheckFail,
+		Detail: "/busy queued 80/100; /stuck queued 100/100",
+	}, st.Checks[2])
+	assert.Equal(t, "listeners", st.Checks[3].Name)
+	assert.Equal(t, meta.CheckFail, st.Checks[3].Status, "closed listener")
+}
@@ -0,0 +1,315 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package meta
+
+import (
+	"bytes"
+	"regexp"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/uber-go/gwr/source"
+)
+
+// StallsName is the name of the runtime stalls data source.
+const StallsName = "/runtime/stalls"
+
+// DefaultStallThreshold is how long goroutines must stay blocked to be
+// reported as stalled, unless an armed threshold is set.
+const DefaultStallThreshold = 30 * time.Second
+
+// maxStallSampleInterval bounds how often goroutines are sampled; shorter
+// thresholds are sampled more often.
+const maxStallSampleInterval = 5 * time.Second
+
+// maxStallGoroutineIDs is how many goroutine ids are listed per stall.
+const maxStallGoroutineIDs = 10
+
+var stallsTextTemplate = template.Must(template.New("runtime_stalls_text").Parse(strings.TrimSpace(`
+{{ define "get" }}{{ range . }}{{ template "item" . }}
+{{ end }}{{ end }}
+{{ define "item" }}{{ .Count }} goroutine(s) blocked in {{ .State }} for {{ .Longest }}, e.g. {{ .GoroutineIDs }}
+{{ .Stack }}{{ end }}
+`)))
+
+// blockingStates are the goroutine wait reasons, as shown in stack dumps, that
+// may be stalls: waits on channels and locks.
+var blockingStates = []string{
+	"chan receive",
+	"chan send",
+	"select",
+	"semacquire",
+	"sync.Mutex.Lock",
+	"sync.RWMutex.Lock",
+	"sync.RWMutex.RLock",
+	"sync.Cond.Wait",
+}
+
+var (
+	stackArgsPattern   = regexp.MustCompile(`\([^()]*\)$`)
+	stackOffsetPattern = regexp.MustCompile(` \+0x[0-9a-f]+$`)
+	stackCreatorSuffix = regexp.MustCompile(` in goroutine \d+$`)
+)
+
+// Stall describes a group of goroutines that have been blocked in the same
+// place for longer than the stall threshold.
+type Stall struct {
+	State        string        `json:"state"`
+	Count        int           `json:"count"`
+	Longest      time.Duration `json:"longest"`
+	GoroutineIDs []int         `json:"goroutine_ids"`
+	Stack        string        `json:"stack"`
+}
+
+type blockedGoroutine struct {
+	sig   string
+	since time.Time
+}
+
+// StallsDataSource provides a data source that detects goroutines blocked on
+// the same channel operation or lock, with the same stack, for longer than a
+// threshold.  It is used to implement the "/runtime/stalls" data source.
+//
+// Goroutines are only sampled while the source is watched, or while an alert
+// threshold is armed; watchers get a Stall item for each newly stalled group
+// of goroutines, while Get returns all groups stalled as of the last sample.
+type StallsDataSource struct {
+	sync.Mutex
+	watcher  source.GenericDataWatcher
+	armed    time.Duration
+	sampling bool
+
+	blocked map[int]blockedGoroutine
+	stalled map[string]bool
+	stalls  []Stall
+}
+
+// NewStallsDataSource creates a new, unarmed, stall detecting data source.
+func NewStallsDataSource() *StallsDataSource {
+	return &StallsDataSource{}
+}
+
+// Name returns the static "/runtime/stalls" string.
+func (sds *StallsDataSource) Name() string {
+	return StallsName
+}
+
+// TextTemplate returns a text/template to implement the GenericDataSource with
+// a "text" format option.
+func (sds *StallsDataSource) TextTemplate() *template.Template {
+	return stallsTextTemplate
+}
+
+// Get returns the stalls seen in the last sample.
+func (sds *StallsDataSource) Get() interface{} {
+	sds.Lock()
+	defer sds.Unlock()
+	return append([]Stall{}, sds.stalls...)
+}
+
+// SetWatcher implements GenericDataSource by retaining a reference to the
+// passed watcher.
+func (sds *StallsDataSource) SetWatcher(watcher source.GenericDataWatcher) {
+	sds.Lock()
+	sds.watcher = source.AddWatcher(sds.watcher, watcher)
+	sds.Unlock()
+}
+
+// Activate starts sampling goroutines.
+func (sds *StallsDataSource) Activate() {
+	sds.Lock()
+	sds.startSampling()
+	sds.Unlock()
+}
+
+// Arm keeps goroutines sampled with the given threshold even while unwatched,
+// so that Get can report stalls at any time; a zero threshold disarms.
+func (sds *StallsDataSource) Arm(threshold time.Duration) {
+	sds.Lock()
+	sds.armed = threshold
+	if threshold > 0 {
+		sds.startSampling()
+	}
+	sds.Unlock()
+}
+
+// threshold returns the armed threshold, or the default; the lock must be
+// held.
+func (sds *StallsDataSource) threshold() time.Duration {
+	if sds.armed > 0 {
+		return sds.armed
+	}
+	return DefaultStallThreshold
+}
+
+// startSampling starts the sampling goroutine if not running; the lock must
+// be held.
+func (sds *StallsDataSource) startSampling() {
+	if !sds.sampling {
+		sds.sampling = true
+		sds.blocked = nil
+		go sds.sample()
+	}
+}
+
+func (sds *StallsDataSource) sample() {
+	for {
+		sds.Lock()
+		watcher := sds.watcher
+		watched := watcher != nil && watcher.Active()
+		if !watched && sds.armed <= 0 {
+			sds.sampling = false
+			sds.blocked = nil
+			sds.stalled = nil
+			sds.stalls = nil
+			sds.Unlock()
+			return
+		}
+		interval := sds.threshold() / 4
+		if interval > maxStallSampleInterval {
+			interval = maxStallSampleInterval
+		}
+		sds.Unlock()
+
+		if fresh := sds.detect(time.Now(), goroutineDump()); watched {
+			for _, stall := range fresh {
+				watcher.HandleItem(stall)
+			}
+		}
+		time.Sleep(interval)
+	}
+}
+
+func goroutineDump() []byte {
+	buf := make([]byte, 64*1024)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
+
+// detect updates the tracked blocked goroutines from a stack dump, returning
+// any newly stalled groups.
+func (sds *StallsDataSource) detect(now time.Time, dump []byte) []Stall {
+	sds.Lock()
+	defer sds.Unlock()
+	threshold := sds.threshold()
+
+	blocked := make(map[int]blockedGoroutine)
+	groups := make(map[string]*Stall)
+	var sigs []string
+	for _, chunk := range bytes.Split(dump, []byte("\n\n")) {
+		id, state, stack, ok := parseGoroutine(string(chunk))
+		if !ok {
+			continue
+		}
+		sig := state + "\n" + normalizeStack(stack)
+		bg, seen := sds.blocked[id]
+		if !seen || bg.sig != sig {
+			bg = blockedGoroutine{sig: sig, since: now}
+		}
+		blocked[id] = bg
+
+		waited := now.Sub(bg.since)
+		if waited < threshold {
+			continue
+		}
+		stall, ok := groups[sig]
+		if !ok {
+			stall = &Stall{State: state, Stack: stack}
+			groups[sig] = stall
+			sigs = append(sigs, sig)
+		}
+		stall.Count++
+		if waited > stall.Longest {
+			stall.Longest = waited
+		}
+		if len(stall.GoroutineIDs) < maxStallGoroutineIDs {
+			stall.GoroutineIDs = append(stall.GoroutineIDs, id)
+		}
+	}
+	sds.blocked = blocked
+
+	sort.Strings(sigs)
+	prevStalled := sds.stalled
+	sds.stalled = make(map[string]bool, len(sigs))
+	sds.stalls = make([]Stall, 0, len(sigs))
+	var fresh []Stall
+	for _, sig := range sigs {
+		stall := *groups[sig]
+		sort.Ints(stall.GoroutineIDs)
+		sds.stalled[sig] = true
+		sds.stalls = append(sds.stalls, stall)
+		if !prevStalled[sig] {
+			fresh = append(fresh, stall)
+		}
+	}
+	return fresh
+}
+
+// parseGoroutine parses one goroutine from a stack dump, returning ok only
+// if it's in a blocking state.  The header looks like:
+//
+//	goroutine 7 [chan receive, 2 minutes]:
+func parseGoroutine(chunk string) (id int, state, stack string, ok bool) {
+	chunk = strings.TrimSpace(chunk)
+	nl := strings.IndexByte(chunk, '\n')
+	if nl < 0 || !strings.HasPrefix(chunk, "goroutine ") {
+		return 0, "", "", false
+	}
+	header := chunk[:nl]
+	open, end := strings.IndexByte(header, '['), strings.LastIndexByte(header, ']')
+	if open < 0 || end < open {
+		return 0, "", "", false
+	}
+	id, err := strconv.Atoi(strings.TrimSpace(header[len("goroutine "):open]))
+	if err != nil {
+		return 0, "", "", false
+	}
+	state = strings.SplitN(header[open+1:end], ",", 2)[0]
+	for _, bs := range blockingStates {
+		if strings.HasPrefix(state, bs) {
+			return id, state, chunk[nl+1:], true
+		}
+	}
+	return 0, "", "", false
+}
+
+// normalizeStack strips argument values, pc offsets, and creator goroutine
+// ids from a stack, so that goroutines blocked in the same place compare
+// equal.
+func normalizeStack(stack string) string {
+	lines := strings.Split(stack, "\n")
+	for i, line := range lines {
+		line = stackArgsPattern.ReplaceAllString(line, "")
+		line = stackOffsetPattern.ReplaceAllString(line, "")
+		lines[i] = stackCreatorSuffix.ReplaceAllString(line, "")
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package meta_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/uber-go/gwr/internal/meta"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func blockOn(ch chan struct{}) {
+	<-ch
+}
+
+func TestStallsDataSource_Arm(t *testing.T) {
+	sds := meta.NewStallsDataSource()
+	assert.Equal(t, meta.StallsName, sds.Name())
+
+	ch := make(chan struct{})
+	defer close(ch)
+	for i := 0; i < 3; i++ {
+		go blockOn(ch)
+	}
+
+	sds.Arm(40 * time.Millisecond)
+	defer sds.Arm(0)
+
+	var found *meta.Stall
+	for deadline := time.Now().Add(5 * time.Second); found == nil && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+		for _, stall := range sds.Get().([]meta.Stall) {
+			if strings.Contains(stall.Stack, "meta_test.blockOn") {
+				found = &stall
+				break
+			}
+		}
+	}
+	if assert.NotNil(t, found, "blocked goroutines reported") {
+		assert.Equal(t, "chan receive", found.State)
+		assert.Equal(t, 3, found.Count, "goroutines grouped")
+		assert.Len(t, found.GoroutineIDs, 3)
+		assert.True(t, found.Longest >= 40*time.Millisecond, "blocked past the threshold")
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package meta
+
+import (
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/uber-go/gwr/source"
+)
+
+// StatsName is the name of the server stats data source.
+const StatsName = "/meta/stats"
+
+// statsPollInterval is how often the stats are emitted while the stats source
+// is watched.
+const statsPollInterval = 5 * time.Second
+
+var statsTextTemplate = template.Must(template.New("meta_stats_text").Parse(strings.TrimSpace(`
+{{ define "get" }}{{ template "stats" . }}
+{{ end }}
+{{ define "item" }}{{ template "stats" . }}{{ end }}
+{{ define "stats" }}resp: conns={{ .RESP.Conns }} monitors={{ .RESP.Monitors }} idle={{ .RESP.Idle }} max_idle={{ printf "%.1f" .RESP.MaxIdle }}s reaped={{ .RESP.Reaped }}
+{{- range $name, $stats := .Sources }}
+{{ $name }}: items={{ .Items }} dropped={{ .Dropped }} marshal_errors={{ .MarshalErrors }} bytes={{ .Bytes }} watchers={{ .Watchers }}{{ range $format, $n := .FormatWatchers }} {{ $format }}={{ $n }}{{ end }}{{ range $label, $n := .Labels }} label:{{ $label }}={{ $n }}{{ end }}
+{{- end }}{{ end }}
+`)))
+
+// RESPStats describes a RESP handler's connections.
+type RESPStats struct {
+	// Conns and Monitors count the open connections, and those of them
+	// streaming a monitor.
+	Conns    int `json:"conns"`
+	Monitors int `json:"monitors"`
+
+	// Idle counts the connections, not monitoring, that haven't sent a
+	// command for at least a minute; MaxIdle is the longest that any of them
+	// has gone, in seconds.
+	Idle    int     `json:"idle"`
+	MaxIdle float64 `json:"max_idle_seconds"`
+
+	// Reaped counts the connections closed for exceeding the idle timeout.
+	Reaped uint64 `json:"reaped"`
+}
+
+// ServerStats describes the configured server, and each of its sources that
+// keeps stats.
+type ServerStats struct {
+	RESP    RESPStats               `json:"resp"`
+	Sources map[string]source.Stats `json:"sources,omitempty"`
+}
+
+// StatsDataSource provides a data source that reports counts of the
+// configured server's connections, and of each source's items, drops,
+// marshal errors, bytes written, and watchers.  It is used to implement the
+// "/meta/stats" data source.  While watched, the stats are emitted every few
+// seconds.
+type StatsDataSource struct {
+	poller
+	sources *source.DataSources
+
+	lock sync.Mutex
+	resp func() RESPStats
+}
+
+// NewStatsDataSource creates a new data source that reports server stats, and
+// the stats of any of the given sources that keep them; until SetRESPStats is
+// called, its RESP stats are zeros.
+func NewStatsDataSource(dss *source.DataSources) *StatsDataSource {
+	sds := &StatsDataSource{sources: dss}
+	sds.poller = poller{
+		interval: statsPollInterval,
+		get:      sds.Get,
+	}
+	return sds
+}
+
+// SetRESPStats sets the function that counts the RESP connections.
+func (sds *StatsDataSource) SetRESPStats(fn func() RESPStats) {
+	sds.lock.Lock()
+	sds.resp = fn
+	sds.lock.Unlock()
+}
+
+// Name returns the static "/meta/stats" string.
+func (sds *StatsDataSource) Name() string {
+	return StatsName
+}
+
+// TextTemplate returns a text/template to implement the GenericDataSource with
+// a "text" format option.
+func (sds *StatsDataSource) TextTemplate() *template.Template {
+	return statsTextTemplate
+}
+
+// Get returns the current ServerStats.
+func (sds *StatsDataSource) Get() interface{} {
+	var stats ServerStats
+	sds.lock.Lock()
+	resp := sds.resp
+	sds.lock.Unlock()
+	if resp != nil {
+		stats.RESP = resp()
+	}
+	if sds.sources != nil {
+		for _, ds := range sds.sources.Match("/*") {
+			if st := source.GetStats(ds); st != nil {
+				if stats.Sources == nil {
+					stats.Sources = make(map[string]source.Stats)
+				}
+				stats.Sources[ds.Name()] = *st
+			}
+		}
+	}
+	return stats
+}
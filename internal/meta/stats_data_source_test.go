@@ -0,0 +1,65 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package meta_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/uber-go/gwr/internal/marshaled"
+	"github.com/uber-go/gwr/internal/meta"
+	"github.com/uber-go/gwr/source"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatsDataSource_Get(t *testing.T) {
+	sds := meta.NewStatsDataSource(nil)
+	assert.Equal(t, meta.StatsName, sds.Name())
+	assert.Equal(t, meta.ServerStats{}, sds.Get(), "zeros until set")
+
+	sds.SetRESPStats(func() meta.RESPStats {
+		return meta.RESPStats{Conns: 2, Idle: 1, MaxIdle: 90, Reaped: 3}
+	})
+	assert.Equal(t, meta.ServerStats{
+		RESP: meta.RESPStats{Conns: 2, Idle: 1, MaxIdle: 90, Reaped: 3},
+	}, sds.Get())
+}
+
+func TestStatsDataSource_Get_sources(t *testing.T) {
+	dss := source.NewDataSources()
+	sds := meta.NewStatsDataSource(dss)
+	assert.NoError(t, dss.Add(marshaled.NewDataSource(sds, nil)))
+	assert.NoError(t, dss.Add(marshaled.NewDataSource(&watchedDataSource{
+		dummyDataSource: dummyDataSource{name: "/foo"},
+	}, nil)))
+
+	var buf bytes.Buffer
+	require.NoError(t, dss.Get("/foo").Watch("json", &buf))
+	defer dss.Drain()
+
+	stats := sds.Get().(meta.ServerStats)
+	require.Len(t, stats.Sources, 2, "expected both sources' stats")
+	assert.Equal(t, 1, stats.Sources["/foo"].Watchers)
+	assert.Equal(t, map[string]int{"json": 1}, stats.Sources["/foo"].FormatWatchers)
+	assert.Equal(t, 0, stats.Sources[meta.StatsName].Watchers)
+}
@@ -0,0 +1,186 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package meta
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/uber-go/gwr/source"
+)
+
+// WatchersName is the name of the active watches data source.
+const WatchersName = "/meta/watchers"
+
+var watchersTextTemplate = template.Must(template.New("meta_watchers_text").Parse(strings.TrimSpace(`
+{{ define "get" }}{{ range . }}{{ .ID }} {{ .Source }} {{ .Format }} {{ .Protocol }} {{ .RemoteAddr }} since={{ .Start.Format "2006-01-02T15:04:05Z07:00" }} items={{ .Items }}{{ if .Label }} label={{ .Label }}{{ end }}
+{{ end }}{{ end }}
+`)))
+
+// Watch describes a client's watch of a data source.
+type Watch struct {
+	// ID identifies the watch, e.g. to kill it; see KillWatch.
+	ID uint64 `json:"id"`
+
+	Source     string    `json:"source"`
+	Format     string    `json:"format"`
+	Protocol   string    `json:"protocol"`
+	RemoteAddr string    `json:"remote_addr"`
+	Label      string    `json:"label,omitempty"`
+	Start      time.Time `json:"start"`
+
+	// Items counts the items, or diffs, delivered to the watch so far.
+	Items uint64 `json:"items"`
+}
+
+// ActiveWatch is a Watch listed by the "/meta/watchers" source, until it's
+// removed; see AddWatch.
+type ActiveWatch struct {
+	// items is first so that it's 64-bit aligned
+	items uint64
+
+	watch Watch
+	kill  func()
+	once  sync.Once
+}
+
+var activeWatches struct {
+	sync.Mutex
+	next    uint64
+	entries []*ActiveWatch
+}
+
+// AddWatch lists a watch, starting now, with a new ID, until the returned
+// ActiveWatch is removed; a nil *ActiveWatch may be used, and does nothing.
+// The kill function, if not nil, must end the watch's stream, and is called
+// by KillWatch.
+func AddWatch(w Watch, kill func()) *ActiveWatch {
+	w.Start = time.Now()
+	activeWatches.Lock()
+	defer activeWatches.Unlock()
+	activeWatches.next++
+	w.ID = activeWatches.next
+	aw := &ActiveWatch{watch: w, kill: kill}
+	activeWatches.entries = append(activeWatches.entries, aw)
+	return aw
+}
+
+// KillWatch ends the stream of the active watch with the given ID, returning
+// false if there's no such watch, or if it can't be killed.  Streams of
+// several watches, such as RESP monitors, are ended as a whole.
+func KillWatch(id uint64) bool {
+	var kill func()
+	activeWatches.Lock()
+	for _, aw := range activeWatches.entries {
+		if aw.watch.ID == id {
+			kill = aw.kill
+			break
+		}
+	}
+	activeWatches.Unlock()
+	if kill == nil {
+		return false
+	}
+	kill()
+	return true
+}
+
+// Delivered counts n more items delivered to the watch.
+func (aw *ActiveWatch) Delivered(n int) {
+	if aw != nil {
+		atomic.AddUint64(&aw.items, uint64(n))
+	}
+}
+
+// Remove stops listing the watch, once it has ended; it may be called more
+// than once.
+func (aw *ActiveWatch) Remove() {
+	if aw == nil {
+		return
+	}
+	aw.once.Do(func() {
+		activeWatches.Lock()
+		defer activeWatches.Unlock()
+		for i, other := range activeWatches.entries {
+			if other == aw {
+				activeWatches.entries = append(activeWatches.entries[:i], activeWatches.entries[i+1:]...)
+				return
+			}
+		}
+	})
+}
+
+// Watches returns the active watches, in the order that they started.
+func Watches() []Watch {
+	activeWatches.Lock()
+	defer activeWatches.Unlock()
+	watches := make([]Watch, len(activeWatches.entries))
+	for i, aw := range activeWatches.entries {
+		watches[i] = aw.watch
+		watches[i].Items = atomic.LoadUint64(&aw.items)
+	}
+	return watches
+}
+
+// WatchersDataSource provides a data source that lists the active watches of
+// the protocol servers, e.g. to see who is tailing an expensive source.  It
+// is used to implement the "/meta/watchers" data source.
+//
+// Its "kill" action, with an "id" parameter, ends a watch's stream, e.g. one
+// forgotten on a busy source, which would otherwise keep it active.
+type WatchersDataSource struct{}
+
+// NewWatchersDataSource creates a new data source that lists active watches.
+func NewWatchersDataSource() *WatchersDataSource {
+	return &WatchersDataSource{}
+}
+
+// Name returns the static "/meta/watchers" string.
+func (wds *WatchersDataSource) Name() string {
+	return WatchersName
+}
+
+// TextTemplate returns a text/template to implement the GenericDataSource with
+// a "text" format option.
+func (wds *WatchersDataSource) TextTemplate() *template.Template {
+	return watchersTextTemplate
+}
+
+// Get returns the active watches.
+func (wds *WatchersDataSource) Get() interface{} {
+	return Watches()
+}
+
+// Action implements the "kill" action.
+func (wds *WatchersDataSource) Action(name string, params map[string]string) error {
+	if name != "kill" {
+		return source.ErrUnknownAction
+	}
+	id, err := strconv.ParseUint(params["id"], 10, 64)
+	if err != nil || !KillWatch(id) {
+		return source.ErrInvalidParam
+	}
+	return nil
+}
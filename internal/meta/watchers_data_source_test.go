@@ -0,0 +1,86 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package meta_test
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/uber-go/gwr/internal/meta"
+	"github.com/uber-go/gwr/source"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatchersDataSource_Get(t *testing.T) {
+	wds := meta.NewWatchersDataSource()
+	assert.Equal(t, meta.WatchersName, wds.Name())
+	assert.Empty(t, wds.Get(), "no watches yet")
+
+	foo := meta.AddWatch(meta.Watch{Source: "/foo", Format: "json", Protocol: "http", Label: "oncall"}, nil)
+	bar := meta.AddWatch(meta.Watch{Source: "/bar", Format: "text", Protocol: "resp"}, nil)
+	foo.Delivered(2)
+	foo.Delivered(1)
+
+	watches := wds.Get().([]meta.Watch)
+	require.Len(t, watches, 2)
+	assert.Equal(t, "/foo", watches[0].Source, "listed in start order")
+	assert.Equal(t, "oncall", watches[0].Label)
+	assert.Equal(t, uint64(3), watches[0].Items)
+	assert.False(t, watches[0].Start.IsZero(), "start time set")
+	assert.Equal(t, "/bar", watches[1].Source)
+	assert.NotEqual(t, watches[0].ID, watches[1].ID, "unique ids")
+	assert.Equal(t, uint64(0), watches[1].Items)
+
+	foo.Remove()
+	foo.Remove()
+	watches = wds.Get().([]meta.Watch)
+	require.Len(t, watches, 1, "removed watch no longer listed")
+	assert.Equal(t, "/bar", watches[0].Source)
+	bar.Remove()
+	assert.Empty(t, wds.Get())
+
+	var nilWatch *meta.ActiveWatch
+	nilWatch.Delivered(1)
+	nilWatch.Remove()
+}
+
+func TestWatchersDataSource_Action(t *testing.T) {
+	wds := meta.NewWatchersDataSource()
+	killed := 0
+	aw := meta.AddWatch(meta.Watch{Source: "/foo"}, func() { killed++ })
+	defer aw.Remove()
+	stuck := meta.AddWatch(meta.Watch{Source: "/bar"}, nil)
+	defer stuck.Remove()
+
+	watches := wds.Get().([]meta.Watch)
+	require.Len(t, watches, 2)
+	id := strconv.FormatUint(watches[0].ID, 10)
+
+	assert.Equal(t, source.ErrUnknownAction, wds.Action("nope", nil))
+	assert.Equal(t, source.ErrInvalidParam, wds.Action("kill", map[string]string{"id": "x"}))
+	assert.Equal(t, source.ErrInvalidParam, wds.Action("kill", map[string]string{
+		"id": strconv.FormatUint(watches[1].ID, 10),
+	}), "watch without a kill function")
+	assert.NoError(t, wds.Action("kill", map[string]string{"id": id}))
+	assert.Equal(t, 1, killed)
+}
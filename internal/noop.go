@@ -18,31 +18,10 @@
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
 // THE SOFTWARE.
 
-package internal
-
-// FormatFunc is a convenience type to define simple GenericDataFormats.
-type FormatFunc func(interface{}) ([]byte, error)
-
-// MarshalGet calls the wrapped function.
-func (ff FormatFunc) MarshalGet(item interface{}) ([]byte, error) {
-	return ff(item)
-}
+// +build gwr_noop
 
-// MarshalInit calls the wrapped function.
-func (ff FormatFunc) MarshalInit(item interface{}) ([]byte, error) {
-	return ff(item)
-}
-
-// MarshalItem calls the wrapped function.
-func (ff FormatFunc) MarshalItem(item interface{}) ([]byte, error) {
-	return ff(item)
-}
+package internal
 
-// FrameItem simply adds a newline.
-func (ff FormatFunc) FrameItem(buf []byte) ([]byte, error) {
-	n := len(buf)
-	frame := make([]byte, n+1)
-	copy(frame, buf)
-	frame[n] = '\n'
-	return frame, nil
-}
+// Noop is true when built with the gwr_noop tag; instrumentation entry points
+// check it first so that the compiler eliminates their bodies entirely.
+const Noop = true
@@ -0,0 +1,108 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package parquet
+
+import "bytes"
+
+// compact protocol field types
+const (
+	ctBoolTrue  = 1
+	ctBoolFalse = 2
+	ctI32       = 5
+	ctI64       = 6
+	ctBinary    = 8
+	ctList      = 9
+	ctStruct    = 12
+)
+
+// thriftWriter encodes just enough of the thrift compact protocol to write
+// parquet page headers and file metadata.
+type thriftWriter struct {
+	buf  bytes.Buffer
+	last []int16
+}
+
+func (tw *thriftWriter) structBegin() {
+	tw.last = append(tw.last, 0)
+}
+
+func (tw *thriftWriter) structEnd() {
+	tw.buf.WriteByte(0)
+	tw.last = tw.last[:len(tw.last)-1]
+}
+
+func (tw *thriftWriter) field(id int16, typ byte) {
+	last := &tw.last[len(tw.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		tw.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		tw.buf.WriteByte(typ)
+		tw.varint(zigzag(int64(id)))
+	}
+	*last = id
+}
+
+func (tw *thriftWriter) varint(v uint64) {
+	for v >= 0x80 {
+		tw.buf.WriteByte(byte(v) | 0x80)
+		v >>= 7
+	}
+	tw.buf.WriteByte(byte(v))
+}
+
+func zigzag(v int64) uint64 {
+	return uint64((v << 1) ^ (v >> 63))
+}
+
+func (tw *thriftWriter) i32(id int16, v int32) {
+	tw.field(id, ctI32)
+	tw.varint(zigzag(int64(v)))
+}
+
+func (tw *thriftWriter) i64(id int16, v int64) {
+	tw.field(id, ctI64)
+	tw.varint(zigzag(v))
+}
+
+func (tw *thriftWriter) str(id int16, s string) {
+	tw.field(id, ctBinary)
+	tw.rawStr(s)
+}
+
+func (tw *thriftWriter) rawStr(s string) {
+	tw.varint(uint64(len(s)))
+	tw.buf.WriteString(s)
+}
+
+func (tw *thriftWriter) listBegin(id int16, elemType byte, n int) {
+	tw.field(id, ctList)
+	if n < 15 {
+		tw.buf.WriteByte(byte(n)<<4 | elemType)
+	} else {
+		tw.buf.WriteByte(0xf0 | elemType)
+		tw.varint(uint64(n))
+	}
+}
+
+func (tw *thriftWriter) structField(id int16) {
+	tw.field(id, ctStruct)
+	tw.structBegin()
+}
@@ -0,0 +1,348 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package parquet implements a minimal writer of parquet files: a flat schema
+// of optional columns, plain encoded and uncompressed, one data page per
+// column chunk.  That's enough for captures to be read by any parquet reader,
+// e.g. DuckDB or Athena, without taking on a dependency.
+package parquet
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"time"
+)
+
+// Type is the type of a column's values.
+type Type int
+
+const (
+	// String columns hold utf8 strings, given as Go strings.
+	String Type = iota
+	// Double columns hold float64s.
+	Double
+	// Int64 columns hold int64s.
+	Int64
+	// Bool columns hold bools.
+	Bool
+	// Timestamp columns hold time.Times, stored as microseconds since the
+	// epoch.
+	Timestamp
+)
+
+// parquet physical and converted types, and other enums
+const (
+	typeBoolean   = 0
+	typeInt64     = 2
+	typeDouble    = 5
+	typeByteArray = 6
+
+	convertedUTF8            = 0
+	convertedTimestampMicros = 10
+
+	repetitionOptional = 1
+	encodingPlain      = 0
+	encodingRLE        = 3
+	codecUncompressed  = 0
+	pageTypeData       = 0
+)
+
+var magic = []byte("PAR1")
+
+// ErrClosed is returned when writing to a closed Writer.
+var ErrClosed = errors.New("parquet writer closed")
+
+// Column describes a column of the file.
+type Column struct {
+	Name string
+	Type Type
+}
+
+type chunkMeta struct {
+	offset    int64
+	size      int64
+	numValues int64
+}
+
+type rowGroupMeta struct {
+	chunks  []chunkMeta
+	numRows int64
+	size    int64
+}
+
+// Writer writes a parquet file, one row group at a time; the file is only
+// readable once Close has written its footer.
+type Writer struct {
+	w         io.Writer
+	cols      []Column
+	offset    int64
+	numRows   int64
+	rowGroups []rowGroupMeta
+	closed    bool
+}
+
+// NewWriter starts a parquet file of the given columns.
+func NewWriter(w io.Writer, cols []Column) (*Writer, error) {
+	pw := &Writer{w: w, cols: cols}
+	if err := pw.write(magic); err != nil {
+		return nil, err
+	}
+	return pw, nil
+}
+
+// Size returns how many bytes have been written so far.
+func (pw *Writer) Size() int64 {
+	return pw.offset
+}
+
+// NumRows returns how many rows have been written so far.
+func (pw *Writer) NumRows() int64 {
+	return pw.numRows
+}
+
+func (pw *Writer) write(p []byte) error {
+	n, err := pw.w.Write(p)
+	pw.offset += int64(n)
+	return err
+}
+
+// WriteRowGroup writes a group of rows, each holding a value for every column
+// in order; a nil value is null.  A value of the wrong type for its column is
+// also written as null.
+func (pw *Writer) WriteRowGroup(rows [][]interface{}) error {
+	if pw.closed {
+		return ErrClosed
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	rg := rowGroupMeta{
+		chunks:  make([]chunkMeta, len(pw.cols)),
+		numRows: int64(len(rows)),
+	}
+	for i, col := range pw.cols {
+		page := encodePage(col.Type, rows, i)
+		var hdr thriftWriter
+		hdr.structBegin()
+		hdr.i32(1, pageTypeData)
+		hdr.i32(2, int32(len(page)))
+		hdr.i32(3, int32(len(page)))
+		hdr.structField(5)
+		hdr.i32(1, int32(len(rows)))
+		hdr.i32(2, encodingPlain)
+		hdr.i32(3, encodingRLE)
+		hdr.i32(4, encodingRLE)
+		hdr.structEnd()
+		hdr.structEnd()
+
+		start := pw.offset
+		if err := pw.write(hdr.buf.Bytes()); err != nil {
+			return err
+		}
+		if err := pw.write(page); err != nil {
+			return err
+		}
+		rg.chunks[i] = chunkMeta{
+			offset:    start,
+			size:      pw.offset - start,
+			numValues: int64(len(rows)),
+		}
+		rg.size += pw.offset - start
+	}
+	pw.rowGroups = append(pw.rowGroups, rg)
+	pw.numRows += rg.numRows
+	return nil
+}
+
+// encodePage encodes a v1 data page of column i of the rows: its definition
+// levels, then its non-null values.
+func encodePage(typ Type, rows [][]interface{}, i int) []byte {
+	levels := make([]bool, len(rows))
+	var values []byte
+	var bits []bool
+	for j, row := range rows {
+		var ok bool
+		switch typ {
+		case String:
+			var s string
+			if s, ok = row[i].(string); ok {
+				var n [4]byte
+				binary.LittleEndian.PutUint32(n[:], uint32(len(s)))
+				values = append(values, n[:]...)
+				values = append(values, s...)
+			}
+		case Double:
+			var f float64
+			if f, ok = row[i].(float64); ok {
+				values = appendUint64(values, math.Float64bits(f))
+			}
+		case Int64:
+			var n int64
+			if n, ok = row[i].(int64); ok {
+				values = appendUint64(values, uint64(n))
+			}
+		case Timestamp:
+			var t time.Time
+			if t, ok = row[i].(time.Time); ok {
+				values = appendUint64(values, uint64(t.UnixNano()/int64(time.Microsecond)))
+			}
+		case Bool:
+			var b bool
+			if b, ok = row[i].(bool); ok {
+				bits = append(bits, b)
+			}
+		}
+		levels[j] = ok
+	}
+	if typ == Bool {
+		values = make([]byte, (len(bits)+7)/8)
+		for j, b := range bits {
+			if b {
+				values[j/8] |= 1 << uint(j%8)
+			}
+		}
+	}
+
+	rle := encodeLevels(levels)
+	page := make([]byte, 4, 4+len(rle)+len(values))
+	binary.LittleEndian.PutUint32(page, uint32(len(rle)))
+	page = append(page, rle...)
+	return append(page, values...)
+}
+
+func appendUint64(buf []byte, v uint64) []byte {
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], v)
+	return append(buf, b[:]...)
+}
+
+// encodeLevels encodes definition levels of bit width 1 as runs of the
+// RLE/bit-packed hybrid encoding.
+func encodeLevels(levels []bool) []byte {
+	var buf []byte
+	for i := 0; i < len(levels); {
+		j := i + 1
+		for j < len(levels) && levels[j] == levels[i] {
+			j++
+		}
+		buf = appendUvarint(buf, uint64(j-i)<<1)
+		if levels[i] {
+			buf = append(buf, 1)
+		} else {
+			buf = append(buf, 0)
+		}
+		i = j
+	}
+	return buf
+}
+
+func appendUvarint(buf []byte, v uint64) []byte {
+	var b [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(b[:], v)
+	return append(buf, b[:n]...)
+}
+
+// Close writes the file footer; the underlying writer is not closed.
+func (pw *Writer) Close() error {
+	if pw.closed {
+		return nil
+	}
+	pw.closed = true
+
+	var tw thriftWriter
+	tw.structBegin()
+	tw.i32(1, 1)
+
+	tw.listBegin(2, ctStruct, len(pw.cols)+1)
+	tw.structBegin()
+	tw.str(4, "schema")
+	tw.i32(5, int32(len(pw.cols)))
+	tw.structEnd()
+	for _, col := range pw.cols {
+		tw.structBegin()
+		tw.i32(1, physicalType(col.Type))
+		tw.i32(3, repetitionOptional)
+		tw.str(4, col.Name)
+		switch col.Type {
+		case String:
+			tw.i32(6, convertedUTF8)
+		case Timestamp:
+			tw.i32(6, convertedTimestampMicros)
+		}
+		tw.structEnd()
+	}
+
+	tw.i64(3, pw.numRows)
+
+	tw.listBegin(4, ctStruct, len(pw.rowGroups))
+	for _, rg := range pw.rowGroups {
+		tw.structBegin()
+		tw.listBegin(1, ctStruct, len(rg.chunks))
+		for i, chunk := range rg.chunks {
+			col := pw.cols[i]
+			tw.structBegin()
+			tw.i64(2, chunk.offset)
+			tw.structField(3)
+			tw.i32(1, physicalType(col.Type))
+			tw.listBegin(2, ctI32, 2)
+			tw.varint(zigzag(encodingPlain))
+			tw.varint(zigzag(encodingRLE))
+			tw.listBegin(3, ctBinary, 1)
+			tw.rawStr(col.Name)
+			tw.i32(4, codecUncompressed)
+			tw.i64(5, chunk.numValues)
+			tw.i64(6, chunk.size)
+			tw.i64(7, chunk.size)
+			tw.i64(9, chunk.offset)
+			tw.structEnd()
+			tw.structEnd()
+		}
+		tw.i64(2, rg.size)
+		tw.i64(3, rg.numRows)
+		tw.structEnd()
+	}
+	tw.str(6, "gwr")
+	tw.structEnd()
+
+	footer := tw.buf.Bytes()
+	var n [4]byte
+	binary.LittleEndian.PutUint32(n[:], uint32(len(footer)))
+	for _, p := range [][]byte{footer, n[:], magic} {
+		if err := pw.write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func physicalType(typ Type) int32 {
+	switch typ {
+	case Double:
+		return typeDouble
+	case Int64, Timestamp:
+		return typeInt64
+	case Bool:
+		return typeBoolean
+	default:
+		return typeByteArray
+	}
+}
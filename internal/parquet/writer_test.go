@@ -0,0 +1,173 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// thriftReader decodes the compact protocol into maps of field id to value,
+// to check what the writer wrote.
+type thriftReader struct {
+	buf *bytes.Reader
+}
+
+func (tr *thriftReader) varint() uint64 {
+	v, err := binary.ReadUvarint(tr.buf)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+func (tr *thriftReader) zigzag() int64 {
+	v := tr.varint()
+	return int64(v>>1) ^ -int64(v&1)
+}
+
+func (tr *thriftReader) value(typ byte) interface{} {
+	switch typ {
+	case ctBoolTrue:
+		return true
+	case ctBoolFalse:
+		return false
+	case ctI32, ctI64:
+		return tr.zigzag()
+	case ctBinary:
+		b := make([]byte, tr.varint())
+		tr.buf.Read(b)
+		return string(b)
+	case ctList:
+		hdr, _ := tr.buf.ReadByte()
+		n := int(hdr >> 4)
+		if n == 15 {
+			n = int(tr.varint())
+		}
+		list := make([]interface{}, n)
+		for i := range list {
+			list[i] = tr.value(hdr & 0x0f)
+		}
+		return list
+	case ctStruct:
+		return tr.structure()
+	}
+	panic("unsupported type")
+}
+
+func (tr *thriftReader) structure() map[int16]interface{} {
+	fields := make(map[int16]interface{})
+	var last int16
+	for {
+		hdr, _ := tr.buf.ReadByte()
+		if hdr == 0 {
+			return fields
+		}
+		id := last + int16(hdr>>4)
+		if hdr>>4 == 0 {
+			id = int16(tr.zigzag())
+		}
+		fields[id] = tr.value(hdr & 0x0f)
+		last = id
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	t0 := time.Unix(1500000000, 123456000)
+	pw, err := NewWriter(&buf, []Column{
+		{"name", String},
+		{"n", Double},
+		{"i", Int64},
+		{"ok", Bool},
+		{"t", Timestamp},
+	})
+	require.NoError(t, err)
+	require.NoError(t, pw.WriteRowGroup([][]interface{}{
+		{"a", 1.5, int64(7), true, t0},
+		{nil, nil, nil, false, nil},
+		{"ccc", "bogus", int64(-1), true, t0},
+	}))
+	require.NoError(t, pw.WriteRowGroup([][]interface{}{
+		{"d", 2.0, nil, nil, nil},
+	}))
+	assert.Equal(t, int64(4), pw.NumRows())
+	require.NoError(t, pw.Close())
+
+	data := buf.Bytes()
+	require.True(t, bytes.HasPrefix(data, magic), "leading magic")
+	require.True(t, bytes.HasSuffix(data, magic), "trailing magic")
+	n := binary.LittleEndian.Uint32(data[len(data)-8:])
+	footer := data[len(data)-8-int(n) : len(data)-8]
+	meta := (&thriftReader{bytes.NewReader(footer)}).structure()
+
+	assert.Equal(t, int64(1), meta[1], "version")
+	assert.Equal(t, int64(4), meta[3], "num rows")
+	schema := meta[2].([]interface{})
+	require.Equal(t, 6, len(schema))
+	assert.Equal(t, map[int16]interface{}{4: "schema", 5: int64(5)}, schema[0])
+	assert.Equal(t, map[int16]interface{}{1: int64(typeByteArray), 3: int64(1), 4: "name", 6: int64(0)}, schema[1])
+	assert.Equal(t, map[int16]interface{}{1: int64(typeInt64), 3: int64(1), 4: "t", 6: int64(10)}, schema[5])
+
+	rowGroups := meta[4].([]interface{})
+	require.Equal(t, 2, len(rowGroups))
+	rg := rowGroups[0].(map[int16]interface{})
+	assert.Equal(t, int64(3), rg[3], "row group rows")
+	chunks := rg[1].([]interface{})
+	require.Equal(t, 5, len(chunks))
+
+	// read back each column chunk's page of the first row group
+	page := func(i int) ([]byte, []byte) {
+		cm := chunks[i].(map[int16]interface{})[3].(map[int16]interface{})
+		assert.Equal(t, int64(3), cm[5], "num values")
+		off := cm[9].(int64)
+		rd := bytes.NewReader(data[off : off+cm[7].(int64)])
+		hdr := (&thriftReader{rd}).structure()
+		size := hdr[3].(int64)
+		body := make([]byte, size)
+		rd.Read(body)
+		assert.Equal(t, 0, rd.Len(), "chunk is a single page")
+		nl := binary.LittleEndian.Uint32(body)
+		return body[4 : 4+nl], body[4+nl:]
+	}
+
+	levels, values := page(0)
+	assert.Equal(t, []byte{2, 1, 2, 0, 2, 1}, levels, "present, null, present")
+	assert.Equal(t, "\x01\x00\x00\x00a\x03\x00\x00\x00ccc", string(values))
+
+	levels, values = page(1)
+	assert.Equal(t, []byte{2, 1, 4, 0}, levels, "wrong typed value is null")
+	assert.Equal(t, 1.5, math.Float64frombits(binary.LittleEndian.Uint64(values)))
+
+	_, values = page(3)
+	assert.Equal(t, []byte{5}, values, "bit-packed true, false, true")
+
+	_, values = page(4)
+	assert.Equal(t, uint64(1500000000123456), binary.LittleEndian.Uint64(values))
+
+	assert.Equal(t, ErrClosed, pw.WriteRowGroup([][]interface{}{{"x"}}))
+}
@@ -0,0 +1,108 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package protocol
+
+import (
+	"strconv"
+	"strings"
+)
+
+// mediaRange is one media range of an Accept header, e.g. "text/*;q=0.5".
+type mediaRange struct {
+	typ, sub string
+	q        float64
+}
+
+// specificity ranks how specifically a range matches: "*/*" least, then
+// "type/*", then "type/sub".
+func (mr mediaRange) specificity() int {
+	switch {
+	case mr.typ == "*":
+		return 0
+	case mr.sub == "*":
+		return 1
+	default:
+		return 2
+	}
+}
+
+// matches returns true if the range covers the content type.
+func (mr mediaRange) matches(typ, sub string) bool {
+	return (mr.typ == "*" || mr.typ == typ) && (mr.sub == "*" || mr.sub == sub)
+}
+
+// parseAccept parses the media ranges of an Accept header, ignoring any that
+// are malformed.  A text/event-stream range is also ignored, since it asks for
+// server-sent event framing, rather than any format; see wantsSSE.
+func parseAccept(header string) []mediaRange {
+	var ranges []mediaRange
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		typ := strings.ToLower(strings.TrimSpace(params[0]))
+		i := strings.IndexByte(typ, '/')
+		if i <= 0 || i == len(typ)-1 || typ == "text/event-stream" {
+			continue
+		}
+		mr := mediaRange{typ: typ[:i], sub: typ[i+1:], q: 1}
+		if mr.typ == "*" && mr.sub != "*" {
+			continue
+		}
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if len(param) > 2 && strings.EqualFold(param[:2], "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil && q >= 0 && q <= 1 {
+					mr.q = q
+				}
+			}
+		}
+		ranges = append(ranges, mr)
+	}
+	return ranges
+}
+
+// acceptQuality returns the quality that the ranges give a content type, from
+// the most specific range matching it; it's zero if no range matches.
+func acceptQuality(ranges []mediaRange, contentType string) float64 {
+	typ, sub := contentType, ""
+	if i := strings.IndexByte(contentType, '/'); i >= 0 {
+		typ, sub = contentType[:i], contentType[i+1:]
+	}
+	best, q := -1, 0.0
+	for _, mr := range ranges {
+		if s := mr.specificity(); s > best && mr.matches(typ, sub) {
+			best, q = s, mr.q
+		}
+	}
+	return q
+}
+
+// negotiateFormat returns the format, of those listed in order of preference,
+// whose content type the ranges accept with the highest quality, or "" if
+// none are acceptable.
+func negotiateFormat(ranges []mediaRange, formats []string) string {
+	best, bestQ := "", 0.0
+	for _, name := range formats {
+		if q := acceptQuality(ranges, contentTypeFor(name)); q > bestQ {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
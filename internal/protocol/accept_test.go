@@ -0,0 +1,59 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package protocol
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNegotiateFormat(t *testing.T) {
+	formats := []string{"text", "json", "html", "pprof"}
+	for _, tc := range []struct {
+		accept string
+		format string
+	}{
+		{"*/*", "text"},
+		{"application/json", "json"},
+		{"text/*", "text"},
+		{"text/*, text/html", "text"},
+		{"text/*;q=0.5, text/html", "html"},
+		{"text/plain;q=0.5, application/json", "json"},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "html"},
+		{"application/*;q=0.2, application/octet", "pprof"},
+		{"text/plain;q=0, */*", "json"},
+		{"image/png", ""},
+		{"application/json;q=0", ""},
+	} {
+		assert.Equal(t, tc.format, negotiateFormat(parseAccept(tc.accept), formats),
+			"format for Accept: %s", tc.accept)
+	}
+}
+
+func TestParseAccept(t *testing.T) {
+	assert.Equal(t, []mediaRange{
+		{"text", "html", 1},
+		{"application", "json", 0.5},
+		{"*", "*", 0.1},
+	}, parseAccept("text/html, application/json; Q=0.5, bogus, */*;q=0.1, text/event-stream"))
+	assert.Empty(t, parseAccept("text/event-stream"), "sse alone accepts any format")
+}
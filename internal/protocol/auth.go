@@ -0,0 +1,141 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package protocol
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+
+	"github.com/uber-go/gwr/internal/resp"
+	"github.com/uber-go/gwr/source"
+)
+
+// authHolder holds an optional source.AuthFunc; it may be set while requests
+// are being served.
+type authHolder struct {
+	val atomic.Value
+}
+
+func (ah *authHolder) set(fn source.AuthFunc) {
+	ah.val.Store(fn)
+}
+
+func (ah *authHolder) get() source.AuthFunc {
+	fn, _ := ah.val.Load().(source.AuthFunc)
+	return fn
+}
+
+// checkAggregateOnly refuses to get or watch any aggregate-only source; see
+// source.DataSources.SetAggregateOnly.
+func checkAggregateOnly(dss *source.DataSources, verb string, names []string) error {
+	if verb != "get" && verb != "watch" {
+		return nil
+	}
+	for _, name := range names {
+		if dss.AggregateOnly(name) {
+			return fmt.Errorf("%s: %v", name, source.ErrAggregateOnly)
+		}
+	}
+	return nil
+}
+
+// SetAuth sets a function that must authorize every access to a data
+// source, or to the "/listen" endpoint; nil disables authorization.
+func (hndl *HTTPRest) SetAuth(fn source.AuthFunc) {
+	hndl.auth.set(fn)
+}
+
+// authorize checks that each named source may be accessed with the verb,
+// writing an error response and returning false if not.
+func (hndl *HTTPRest) authorize(w http.ResponseWriter, r *http.Request, verb string, names ...string) bool {
+	if err := checkAggregateOnly(hndl.dss, verb, names); err != nil {
+		http.Error(w, "403 Forbidden\n"+err.Error(), http.StatusForbidden)
+		return false
+	}
+	auth := hndl.auth.get()
+	if auth == nil {
+		return true
+	}
+	req := &source.AuthRequest{
+		Verb:       verb,
+		Protocol:   "http",
+		RemoteAddr: r.RemoteAddr,
+		Label:      r.URL.Query().Get("label"),
+		TLS:        r.TLS,
+	}
+	if authz := r.Header.Get("Authorization"); len(authz) > 7 && strings.EqualFold(authz[:7], "bearer ") {
+		req.Token = strings.TrimSpace(authz[7:])
+	}
+	for _, name := range names {
+		req.Source = name
+		if err := auth(req); err == source.ErrUnauthenticated {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gwr"`)
+			http.Error(w, "401 Unauthorized", http.StatusUnauthorized)
+			return false
+		} else if err != nil {
+			http.Error(w, "403 Forbidden\n"+err.Error(), http.StatusForbidden)
+			return false
+		}
+	}
+	return true
+}
+
+// SetAuth sets a function that must authorize every access to a data
+// source; nil disables authorization.  Clients present a token with the
+// "auth" command.
+func (rh *RedisHandler) SetAuth(fn source.AuthFunc) {
+	rh.model.auth.set(fn)
+}
+
+// authorize checks that each named source may be accessed with the verb; if
+// not, an error reply is written, leaving the connection open to try "auth",
+// and false is returned along with any write error.
+func (rm *respModel) authorize(rconn *resp.RedisConnection, verb string, names ...string) (bool, error) {
+	if err := checkAggregateOnly(rm.sources, verb, names); err != nil {
+		return false, rconn.WriteError(err)
+	}
+	auth := rm.auth.get()
+	if auth == nil {
+		return true, nil
+	}
+	req := &source.AuthRequest{
+		Verb:       verb,
+		Protocol:   "resp",
+		Token:      rm.session(rconn).token,
+		RemoteAddr: rconn.Conn.RemoteAddr().String(),
+	}
+	if tc, ok := rconn.Conn.(*tls.Conn); ok {
+		state := tc.ConnectionState()
+		req.TLS = &state
+	}
+	for _, name := range names {
+		req.Source = name
+		if err := auth(req); err == source.ErrUnauthenticated {
+			return false, rconn.WriteErrorString("NOAUTH", err.Error())
+		} else if err != nil {
+			return false, rconn.WriteError(fmt.Errorf("access to %s denied: %v", name, err))
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,59 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package protocol
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// watchBacklog returns the number of retained items that the request's watch
+// should start with, from its "backlog" parameter, or 0 if there's none.  If
+// it's invalid, a 400 response is written, and false returned.
+func watchBacklog(w http.ResponseWriter, r *http.Request) (int, bool) {
+	str := r.Form.Get("backlog")
+	if str == "" {
+		return 0, true
+	}
+	n, err := strconv.Atoi(str)
+	if err != nil || n <= 0 {
+		http.Error(w,
+			fmt.Sprintf("400 Bad Request\nInvalid backlog %q, expected a positive number of items.", str),
+			http.StatusBadRequest)
+		return 0, false
+	}
+	return n, true
+}
+
+// backlogEndFrame returns the control frame that ends a watch's backlog of n
+// items, ahead of its live items: a json object whose "gwr" field names it,
+// in the json format, or otherwise a marker line.
+func backlogEndFrame(format string) func(n int) []byte {
+	if format == "json" {
+		return func(n int) []byte {
+			return []byte(fmt.Sprintf(`{"gwr":"backlog_end","items":%d}`+"\n", n))
+		}
+	}
+	return func(n int) []byte {
+		return []byte(fmt.Sprintf("-- gwr backlog end: %d items --\n", n))
+	}
+}
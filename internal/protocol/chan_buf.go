@@ -25,6 +25,8 @@ import (
 	"errors"
 	"io"
 	"sync"
+
+	"github.com/uber-go/gwr/internal/meta"
 )
 
 var errBufClosed = errors.New("buffer closed")
@@ -37,6 +39,12 @@ type chanBuf struct {
 	pending bool
 	p       []byte
 	// TODO: limit
+
+	// watch, if set, counts each write, of a framed item, as delivered
+	watch *meta.ActiveWatch
+
+	// backlogEnd, if set, returns the control frame written by EndBacklog
+	backlogEnd func(n int) []byte
 }
 
 func (cb *chanBuf) Reset() {
@@ -45,6 +53,27 @@ func (cb *chanBuf) Reset() {
 }
 
 func (cb *chanBuf) Write(p []byte) (int, error) {
+	return cb.write(p, 1)
+}
+
+// WriteString is like Write; it's needed so that io.WriteString doesn't use
+// the embedded Buffer's, which would skip signaling ready.
+func (cb *chanBuf) WriteString(s string) (int, error) {
+	return cb.write([]byte(s), 1)
+}
+
+// EndBacklog writes the control frame that ends a watch's backlog of n items,
+// if backlogEnd is set; it's not counted as delivered.
+func (cb *chanBuf) EndBacklog(n int) error {
+	if cb.backlogEnd == nil {
+		return nil
+	}
+	_, err := cb.write(cb.backlogEnd(n), 0)
+	return err
+}
+
+// write buffers p, counting it as the given number of delivered items.
+func (cb *chanBuf) write(p []byte, items int) (int, error) {
 	var send bool
 	cb.Lock()
 
@@ -54,6 +83,7 @@ func (cb *chanBuf) Write(p []byte) (int, error) {
 	}
 
 	n, err := cb.Buffer.Write(p)
+	cb.watch.Delivered(items)
 	if n > 0 && !cb.pending {
 		cb.pending = true
 		send = true
@@ -0,0 +1,144 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package protocol
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/uber-go/gwr/source"
+)
+
+// defaultDiffPoll is how often a diff watch gets its source, unless the
+// request gives a "poll" interval.
+const defaultDiffPoll = time.Second
+
+// minDiffPoll bounds how often a diff watch may get its source.
+const minDiffPoll = 100 * time.Millisecond
+
+// doDiffWatch streams the changes to a Get-able source, polling it, and
+// writing a diff whenever its data differs from the previous poll: a unified
+// diff for text, or a json-patch line for json, like a "diff=prev" get.  The
+// first poll is diffed against nothing, so the stream starts with the whole
+// document.  Polls that find no data are skipped.
+//
+// This is meant for large, mostly static, documents, like config dumps or
+// routing tables, where re-sending the whole of each snapshot would swamp
+// the few lines that changed.
+func (hndl *HTTPRest) doDiffWatch(
+	src source.DataSource,
+	w http.ResponseWriter,
+	r *http.Request,
+) error {
+	if r.Form.Get("diff") != "prev" {
+		http.Error(w, "400 Bad Request\nUnsupported diff, only diff=prev is", http.StatusBadRequest)
+		return nil
+	}
+	poll := defaultDiffPoll
+	if val := r.Form.Get("poll"); val != "" {
+		d, err := time.ParseDuration(val)
+		if err != nil || d < minDiffPoll {
+			http.Error(w, "400 Bad Request\nInvalid poll interval", http.StatusBadRequest)
+			return nil
+		}
+		poll = d
+	}
+
+	formatName, err := hndl.determineFormat(src.Formats(), w, r)
+	if len(formatName) == 0 || err != nil {
+		return err
+	}
+
+	var cur bytes.Buffer
+	params := requestParams(r)
+	getCtx, cancelGet := hndl.streams.context(r.Context())
+	defer cancelGet()
+	get := func() error {
+		cur.Reset()
+		err := getParams(getCtx, src, formatName, params, &cur)
+		if err == source.ErrGetNoContent || err == source.ErrGetNotFound {
+			cur.Reset()
+			return nil
+		}
+		return err
+	}
+
+	// the first get is made before the stream starts, so that any error may
+	// still be reported with a status
+	if err := get(); err == source.ErrNotGetable {
+		http.Error(w, "501 source does not support Get", http.StatusNotImplemented)
+		return nil
+	} else if err == source.ErrInvalidParam {
+		http.Error(w, "400 Bad Request\nInvalid Parameter", http.StatusBadRequest)
+		return nil
+	} else if pe, ok := err.(*source.PanicError); ok {
+		writePanicError(w, pe)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	done, ok := hndl.streams.start()
+	if !ok {
+		writeShuttingDown(w)
+		return nil
+	}
+	defer hndl.streams.stop()
+
+	ctx, kill := context.WithCancel(r.Context())
+	defer kill()
+	fw := hndl.startStream(w, r, formatName)
+	aw := addHTTPWatch(r, src.Name(), formatName, kill)
+	defer aw.Remove()
+	tick := time.NewTicker(poll)
+	defer tick.Stop()
+
+	var prev []byte
+	for {
+		if cur.Len() > 0 && !bytes.Equal(prev, cur.Bytes()) {
+			buf, _, err := renderDiff(src.Name(), formatName, prev, cur.Bytes())
+			if err != nil {
+				return err
+			}
+			if _, err := fw.Write(buf); err != nil {
+				return err
+			}
+			aw.Delivered(1)
+			prev = append(prev[:0], cur.Bytes()...)
+		}
+
+		select {
+		case <-tick.C:
+		case <-done:
+			w.Header().Set(streamEndTrailer, "shutdown")
+			return nil
+		case <-ctx.Done():
+			setKilled(w, r)
+			return nil
+		}
+
+		if err := get(); err != nil {
+			return err
+		}
+	}
+}
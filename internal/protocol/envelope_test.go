@@ -0,0 +1,47 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package protocol
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber-go/gwr/source"
+)
+
+func TestWriteEnvelope(t *testing.T) {
+	defer source.SetIdentity(source.ProcessIdentity())
+
+	var buf bytes.Buffer
+	source.SetIdentity(source.Identity{})
+	require.NoError(t, writeEnvelope(&buf, "json", "/foo", []byte(`{"n":1}`)))
+	assert.Equal(t, `{"name":"/foo","data":{"n":1}}`+"\n", buf.String(), "no origin without an identity")
+
+	buf.Reset()
+	source.SetIdentity(source.Identity{Service: "api", Instance: "host-1"})
+	require.NoError(t, writeEnvelope(&buf, "json", "/foo", []byte(`{"n":1}`)))
+	assert.Equal(t,
+		`{"name":"/foo","origin":{"service":"api","instance":"host-1"},"data":{"n":1}}`+"\n",
+		buf.String(), "origin from the process identity")
+}
@@ -22,12 +22,15 @@ package protocol
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/uber-go/gwr/internal/meta"
 	"github.com/uber-go/gwr/source"
@@ -40,14 +43,24 @@ type Servable interface {
 	Stop() error
 }
 
+// MultiServable may be implemented by a Servable that listens on several
+// addresses, for "/listen" to list all of them.
+type MultiServable interface {
+	Servable
+	Addrs() []net.Addr
+}
+
 var formatContetTypes = map[string]string{
 	"json": "application/json",
 	"text": "text/plain",
 	"html": "text/html",
+	"dot":  "text/vnd.graphviz",
+	"csv":  "text/csv",
+	"tsv":  "text/tab-separated-values",
 }
 
 func contentTypeFor(formatName string) string {
-	if contetType, ok := formatContetTypes[formatName]; ok {
+	if contetType, ok := formatContetTypes[source.FormatName(formatName)]; ok {
 		return contetType
 	}
 	return "application/octet"
@@ -60,23 +73,43 @@ type HTTPRest struct {
 	prefix         string
 	dss            *source.DataSources
 	srv            Servable
+	streams        *Streams
+	snapshots      snapshots
+	auth           authHolder
+	watchRate      rateHolder
 }
 
 // NewHTTPRest returns an http.Handler to host the data sources REST-fully at a
 // given prefix.
 //
 // If a non-nil servable is passed, then a /listen convenience endpoint will be
-// provided to afford server discovery and lifecycle management.
+// provided to afford server discovery and lifecycle management; a GET of it
+// returns a json list of the addresses that the server is bound to.
 func NewHTTPRest(dss *source.DataSources, prefix string, srv Servable) *HTTPRest {
 	return &HTTPRest{
 		defaultFormats: []string{"text", "json"},
 		prefix:         prefix,
 		dss:            dss,
 		srv:            srv,
+		streams:        NewStreams(),
 	}
 }
 
+// Shutdown ends any active watch streams, after writing any data already
+// received from their sources, waiting for them until the context is done.
+func (hndl *HTTPRest) Shutdown(ctx context.Context) error {
+	return hndl.streams.Shutdown(ctx)
+}
+
+// ServeHTTP serves a source request, compressing the response with gzip if the
+// client accepts it.
 func (hndl *HTTPRest) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Add("Vary", "Accept-Encoding")
+	if acceptsGzip(r.Header.Get("Accept-Encoding")) {
+		gw := &gzipResponseWriter{ResponseWriter: w}
+		defer gw.Close()
+		w = gw
+	}
 	if err := hndl.routeSource(w, r); err != nil {
 		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
 		log.Printf("data source serve failed: %v\n", err)
@@ -90,14 +123,24 @@ func (hndl *HTTPRest) doListen(w http.ResponseWriter, r *http.Request) error {
 	// define custom actions, e.g. to tell it to go listen
 	switch strings.ToLower(r.Method) {
 	case "get":
-		addr := hndl.srv.Addr()
-		if addr == nil {
+		var addrs []net.Addr
+		if ms, ok := hndl.srv.(MultiServable); ok {
+			addrs = ms.Addrs()
+		} else if addr := hndl.srv.Addr(); addr != nil {
+			addrs = []net.Addr{addr}
+		}
+		if len(addrs) == 0 {
 			http.Error(w,
 				"503 Not Listening\nServer not started, POST an address to start it.",
 				http.StatusServiceUnavailable)
 			return nil
 		}
-		io.WriteString(w, fmt.Sprintf("%v\n", addr))
+		strs := make([]string, len(addrs))
+		for i, addr := range addrs {
+			strs[i] = addr.String()
+		}
+		w.Header().Set("Content-Type", formatContetTypes["json"])
+		return json.NewEncoder(w).Encode(strs)
 
 	case "post":
 		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
@@ -144,24 +187,99 @@ func (hndl *HTTPRest) doListen(w http.ResponseWriter, r *http.Request) error {
 func (hndl *HTTPRest) routeSource(w http.ResponseWriter, r *http.Request) error {
 	path := r.URL.Path[len(hndl.prefix):]
 	if hndl.srv != nil && path == "/listen" {
+		if !hndl.authorize(w, r, "listen", "") {
+			return nil
+		}
 		return hndl.doListen(w, r)
 	}
+	if path == "/ui" || path == uiPath {
+		hndl.serveUI(w, r, path)
+		return nil
+	}
+
+	if err := r.ParseForm(); err != nil {
+		return err
+	}
+	names := r.Form.Get("sources")
+	if len(names) == 0 && strings.HasPrefix(r.Form.Get("watch"), "/") {
+		// "watch=/a,/b" is shorthand for "watch=1&sources=/a,/b"
+		names = r.Form.Get("watch")
+	}
+	if len(names) != 0 {
+		srcs := hndl.resolveSources(strings.Split(names, ","))
+		if len(srcs) == 0 {
+			http.NotFound(w, r)
+			return nil
+		}
+		return hndl.routeVerb(nil, srcs, w, r)
+	}
 
-	var src source.DataSource
 	if len(path) == 0 || path == "/" {
-		src = hndl.dss.Get(meta.NounsName)
-	} else {
-		src = hndl.dss.Get(path)
+		path = meta.NounsName
 	}
-	if src == nil {
+	long := r.Form.Get("long") != ""
+	if path == meta.NounsName && long {
+		// "long=1" adds each source's stats, like "ls -l"
+		if src := hndl.dss.Get(path); src != nil {
+			getSrc := meta.NewLongNounMatchDataSource(hndl.dss, "/*")
+			return hndl.routeVerb(getSrc, []source.DataSource{src}, w, r)
+		}
+	}
+	if src := hndl.dss.Get(path); src != nil {
+		return hndl.routeVerb(src, []source.DataSource{src}, w, r)
+	}
+	if strings.EqualFold(r.Method, "delete") && strings.HasPrefix(path, meta.WatchersName+"/") {
+		return hndl.doKill(path[len(meta.WatchersName)+1:], w, r)
+	}
+
+	// a trailing slash lists, or watches, everything under that prefix
+	if strings.HasSuffix(path, "/") {
+		path += "*"
+	} else if !source.IsPattern(path) {
 		http.NotFound(w, r)
 		return nil
 	}
-	return hndl.routeVerb(src, w, r)
+	srcs := hndl.dss.Match(path)
+	if len(srcs) == 0 {
+		http.NotFound(w, r)
+		return nil
+	}
+	if long {
+		return hndl.routeVerb(meta.NewLongNounMatchDataSource(hndl.dss, path), srcs, w, r)
+	}
+	return hndl.routeVerb(meta.NewNounMatchDataSource(hndl.dss, path), srcs, w, r)
 }
 
+// resolveSources returns the sources named by a list of names and patterns,
+// each included once in order of first mention.
+func (hndl *HTTPRest) resolveSources(names []string) []source.DataSource {
+	var srcs []source.DataSource
+	seen := make(map[string]struct{}, len(names))
+	add := func(src source.DataSource) {
+		if _, ok := seen[src.Name()]; !ok {
+			seen[src.Name()] = struct{}{}
+			srcs = append(srcs, src)
+		}
+	}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if src := hndl.dss.Get(name); src != nil {
+			add(src)
+		} else if source.IsPattern(name) {
+			for _, src := range hndl.dss.Match(name) {
+				add(src)
+			}
+		}
+	}
+	return srcs
+}
+
+// routeVerb routes a request to get from the getSrc, or to watch all of
+// watchSrcs; when a single source is addressed, both refer to it.  A nil
+// getSrc means that the request may only watch.
 func (hndl *HTTPRest) routeVerb(
-	src source.DataSource,
+	getSrc source.DataSource,
+	watchSrcs []source.DataSource,
 	w http.ResponseWriter,
 	r *http.Request,
 ) error {
@@ -169,20 +287,98 @@ func (hndl *HTTPRest) routeVerb(
 		return err
 	}
 
+	watch := func() error {
+		label := r.Form.Get("label")
+		if len(label) > source.MaxWatchLabel {
+			http.Error(w,
+				fmt.Sprintf("400 Bad Request\nLabel longer than %d bytes.", source.MaxWatchLabel),
+				http.StatusBadRequest)
+			return nil
+		}
+		rl, ok := hndl.watchLimiter(w, r)
+		if !ok {
+			return nil
+		}
+		backlog, ok := watchBacklog(w, r)
+		if !ok {
+			return nil
+		}
+		if backlog > 0 && (len(watchSrcs) != 1 || r.Form.Get("diff") != "") {
+			http.Error(w,
+				"400 Bad Request\nOnly a watch of a single source, not by diff, may have a backlog.",
+				http.StatusBadRequest)
+			return nil
+		}
+		r = r.WithContext(source.WithFormatParams(source.WithBacklog(
+			source.WithRateLimiter(source.WithWatchLabel(r.Context(), label), rl),
+			backlog), requestParams(r)))
+		if r.Form.Get("diff") != "" {
+			// a diff watch polls the source's get data for changes
+			if getSrc == nil {
+				http.Error(w,
+					"400 Bad Request\nMultiple sources may not be watched by diff.",
+					http.StatusBadRequest)
+				return nil
+			}
+			if !hndl.authorize(w, r, "get", getSrc.Name()) ||
+				!hndl.authorize(w, r, "watch", getSrc.Name()) {
+				return nil
+			}
+			return hndl.doDiffWatch(getSrc, w, r)
+		}
+		names := make([]string, len(watchSrcs))
+		for i, src := range watchSrcs {
+			names[i] = src.Name()
+		}
+		if !hndl.authorize(w, r, "watch", names...) {
+			return nil
+		}
+		return hndl.doWatch(watchSrcs, w, r)
+	}
+
 	switch strings.ToLower(r.Method) {
 	case "get":
 		if r.Form.Get("watch") != "" {
 			// convenience for http clients that don't easily support custom
 			// method strings
-			return hndl.doWatch(src, w, r)
+			return watch()
+		}
+		if getSrc == nil {
+			http.Error(w,
+				"400 Bad Request\nMultiple sources may only be watched.",
+				http.StatusBadRequest)
+			return nil
 		}
-		return hndl.doGet(src, w, r)
+		if !hndl.authorize(w, r, "get", getSrc.Name()) {
+			return nil
+		}
+		if r.Form.Get("sample-format") != "" {
+			return hndl.doSample(getSrc, w, r)
+		}
+		return hndl.doGet(getSrc, w, r)
 
 	case "watch":
-		return hndl.doWatch(src, w, r)
+		return watch()
+
+	case "post":
+		if getSrc == nil {
+			http.Error(w,
+				"400 Bad Request\nActions may only be sent to a single source.",
+				http.StatusBadRequest)
+			return nil
+		}
+		if !hndl.authorize(w, r, "action", getSrc.Name()) {
+			return nil
+		}
+		// an action on another source, such as starting its recording, may
+		// export its items, so it must be watchable too
+		if target := r.Form.Get("source"); target != "" && !hndl.authorize(w, r, "watch", target) {
+			return nil
+		}
+		return hndl.doAction(getSrc, w, r)
 
 	default:
-		w.Header().Set("Allow", "GET, WATCH")
+		w.Header().Set("Allow", "GET, WATCH, POST")
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		io.WriteString(w, "405 Invalid Method\n")
 	}
@@ -194,30 +390,222 @@ func (hndl *HTTPRest) doGet(
 	w http.ResponseWriter,
 	r *http.Request,
 ) error {
-	formatName, err := hndl.determineFormat(src, w, r)
+	formatName, err := hndl.determineFormat(src.Formats(), w, r)
 	if len(formatName) == 0 || err != nil {
 		return err
 	}
 
+	ctx, cancel := hndl.streams.context(r.Context())
+	defer cancel()
 	var buf bytes.Buffer
-	if err := src.Get(formatName, &buf); err == source.ErrNotGetable {
+	if err := getParams(ctx, src, formatName, requestParams(r), &buf); err == source.ErrNotGetable {
 		http.Error(w, "501 source does not support Get", http.StatusNotImplemented)
 		return nil
+	} else if err == source.ErrGetNoContent {
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	} else if err == source.ErrGetNotFound {
+		http.Error(w, "404 source has no data", http.StatusNotFound)
+		return nil
+	} else if err == source.ErrInvalidParam {
+		http.Error(w, "400 Bad Request\nInvalid Parameter", http.StatusBadRequest)
+		return nil
+	} else if pe, ok := err.(*source.PanicError); ok {
+		writePanicError(w, pe)
+		return nil
 	} else if err != nil {
 		return err
 	}
 
-	if contetType, ok := formatContetTypes[formatName]; ok {
-		w.Header().Set("Content-Type", contetType)
-	} else {
-		w.Header().Set("Content-Type", "application/octet")
+	if r.Form.Get("diff") != "" {
+		return hndl.writeDiff(src, formatName, buf.Bytes(), w, r)
+	}
+
+	w.Header().Set("Content-Type", contentTypeFor(formatName))
+	w.WriteHeader(http.StatusOK)
+	_, err = buf.WriteTo(w)
+	return err
+}
+
+// doAction performs the action named by the "action" form value, passing any
+// other request parameters; see source.ActionDataSource.
+func (hndl *HTTPRest) doAction(
+	src source.DataSource,
+	w http.ResponseWriter,
+	r *http.Request,
+) error {
+	name := r.Form.Get("action")
+	if name == "" {
+		http.Error(w, "400 Missing \"action\" form value.", http.StatusBadRequest)
+		return nil
+	}
+
+	err := source.ErrUnknownAction
+	if asrc, ok := src.(source.ActionDataSource); ok {
+		err = asrc.Action(name, requestParams(r))
+	}
+	if err == source.ErrUnknownAction {
+		http.Error(w, "400 Bad Request\nUnknown Action", http.StatusBadRequest)
+		return nil
+	} else if err == source.ErrInvalidParam {
+		http.Error(w, "400 Bad Request\nInvalid Parameter", http.StatusBadRequest)
+		return nil
+	} else if pe, ok := err.(*source.PanicError); ok {
+		writePanicError(w, pe)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, "OK\n")
+	return err
+}
+
+// doKill answers a DELETE of "/meta/watchers/<id>" by performing the watchers
+// source's "kill" action, ending the watch's stream.
+func (hndl *HTTPRest) doKill(id string, w http.ResponseWriter, r *http.Request) error {
+	src := hndl.dss.Get(meta.WatchersName)
+	if src == nil {
+		http.NotFound(w, r)
+		return nil
+	}
+	r.Form.Set("action", "kill")
+	r.Form.Set("id", id)
+	if !hndl.authorize(w, r, "action", src.Name()) {
+		return nil
+	}
+	return hndl.doAction(src, w, r)
+}
+
+// doSample answers a "sample-format=1" Get with a sample item rendered in
+// each of the source's formats, as a json object of format name to sample
+// with "format=json", or as text sections otherwise.
+func (hndl *HTTPRest) doSample(
+	src source.DataSource,
+	w http.ResponseWriter,
+	r *http.Request,
+) error {
+	var samples map[string][]byte
+	err := source.ErrNoSample
+	if sds, ok := src.(source.SamplingDataSource); ok {
+		samples, err = sds.SampleFormats()
+	}
+	if err == source.ErrNoSample {
+		http.Error(w, "404 source has no sample item", http.StatusNotFound)
+		return nil
+	} else if pe, ok := err.(*source.PanicError); ok {
+		writePanicError(w, pe)
+		return nil
+	} else if err != nil {
+		return err
 	}
 
+	var buf bytes.Buffer
+	if strings.ToLower(r.Form.Get("format")) == "json" {
+		strs := make(map[string]string, len(samples))
+		for name, sample := range samples {
+			strs[name] = string(sample)
+		}
+		if err := json.NewEncoder(&buf).Encode(strs); err != nil {
+			return err
+		}
+		w.Header().Set("Content-Type", formatContetTypes["json"])
+	} else {
+		for _, name := range src.Formats() {
+			sample, ok := samples[name]
+			if !ok {
+				continue
+			}
+			fmt.Fprintf(&buf, "== %s ==\n", name)
+			buf.Write(sample)
+			if !bytes.HasSuffix(sample, []byte("\n")) {
+				buf.WriteByte('\n')
+			}
+			buf.WriteByte('\n')
+		}
+		w.Header().Set("Content-Type", formatContetTypes["text"])
+	}
 	w.WriteHeader(http.StatusOK)
 	_, err = buf.WriteTo(w)
 	return err
 }
 
+// writeDiff answers a "diff=prev" Get with the difference between its result
+// and that of the client's last such Get of the source, named by the
+// "snapshot" token returned with that diff; without one, the whole result is
+// the diff.  The token for the next diff is returned in the snapshotHeader.
+func (hndl *HTTPRest) writeDiff(
+	src source.DataSource,
+	formatName string,
+	cur []byte,
+	w http.ResponseWriter,
+	r *http.Request,
+) error {
+	if r.Form.Get("diff") != "prev" {
+		http.Error(w, "400 Bad Request\nUnsupported diff, only diff=prev is", http.StatusBadRequest)
+		return nil
+	}
+	prev, token := hndl.snapshots.swap(r.Form.Get("snapshot"), src.Name(), formatName, cur)
+	buf, contentType, err := renderDiff(src.Name(), formatName, prev, cur)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set(snapshotHeader, token)
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write(buf)
+	return err
+}
+
+// requestParams returns any request form values not interpreted by HTTPRest
+// itself, to be passed to a ParamGetableDataSource or ActionDataSource.
+func requestParams(r *http.Request) map[string]string {
+	var params map[string]string
+	for key := range r.Form {
+		switch key {
+		case "format", "watch", "sources", "diff", "snapshot", "poll", "merge", "long", "sample-format", "action", "label", "rate", "byte_rate", "backlog":
+			continue
+		}
+		if params == nil {
+			params = make(map[string]string, len(r.Form))
+		}
+		params[key] = r.Form.Get(key)
+	}
+	return params
+}
+
+// getParams gets from src, passing any parameters if the source accepts them,
+// and the context if it takes one.
+func getParams(
+	ctx context.Context,
+	src source.DataSource,
+	format string,
+	params map[string]string,
+	w io.Writer,
+) error {
+	if csrc, ok := src.(source.ContextGetableDataSource); ok {
+		return csrc.GetParamsContext(ctx, format, params, w)
+	}
+	if psrc, ok := src.(source.ParamGetableDataSource); ok && len(params) > 0 {
+		return psrc.GetParams(format, params, w)
+	}
+	return src.Get(format, w)
+}
+
+// writePanicError reports a panic recovered from the source's code to the
+// client; the stack is only available from the /runtime/panics source.
+func writePanicError(w http.ResponseWriter, pe *source.PanicError) {
+	http.Error(w,
+		fmt.Sprintf("500 Source Panicked\n%s", pe.Error()),
+		http.StatusInternalServerError)
+}
+
+// writeShuttingDown refuses to start a watch stream while the server is
+// shutting down.
+func writeShuttingDown(w http.ResponseWriter) {
+	http.Error(w, "503 Shutting Down", http.StatusServiceUnavailable)
+}
+
 type flushWriter struct {
 	w io.Writer
 	f http.Flusher
@@ -229,70 +617,419 @@ func (fw *flushWriter) Write(p []byte) (int, error) {
 	return n, err
 }
 
+// streamEndTrailer is the trailer set on a watch stream that the server ended,
+// rather than the client; its value says why: "shutdown", or "killed" through
+// "/meta/watchers".  Clients may
+// use it to tell a clean end from a dropped connection, since neither
+// chunked framing (HTTP/1.1) nor stream resets (HTTP/2) are visible to them.
+const streamEndTrailer = "Gwr-Stream-End"
+
+// snapshotHeader names the header carrying the token that a client passes as
+// the "snapshot" parameter of its next "diff=prev" get.
+const snapshotHeader = "Gwr-Snapshot"
+
+// startStream writes the headers for a streaming watch response, returning a
+// writer that flushes after every write.  When the client asked for
+// server-sent events, the returned writer also reframes each line as an event.
+//
+// The framing is left to the server: an HTTP/1.1 response without a length is
+// chunked, while an HTTP/2 one is a stream of DATA frames; in either case each
+// flush pushes the written data out to the client.
+func (hndl *HTTPRest) startStream(w http.ResponseWriter, r *http.Request, formatName string) io.Writer {
+	sse := wantsSSE(r)
+	if sse {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+	} else {
+		w.Header().Set("Content-Type", contentTypeFor(formatName))
+	}
+	w.Header().Set("Trailer", streamEndTrailer)
+
+	w.WriteHeader(http.StatusOK)
+
+	var fw io.Writer = w
+
+	if f, _ := w.(http.Flusher); f != nil {
+		f.Flush()
+		fw = &flushWriter{w, f}
+	}
+
+	if sse {
+		fw = &sseWriter{w: fw}
+	}
+
+	return fw
+}
+
+// doWatch streams a watch of one source into the response, or hands off to
+// doMultiWatch when more than one source is being watched.
 func (hndl *HTTPRest) doWatch(
-	src source.DataSource,
+	srcs []source.DataSource,
 	w http.ResponseWriter,
 	r *http.Request,
 ) error {
-	formatName, err := hndl.determineFormat(src, w, r)
+	if len(srcs) > 1 {
+		return hndl.doMultiWatch(srcs, w, r)
+	}
+	src := srcs[0]
+
+	formatName, err := hndl.determineFormat(src.Formats(), w, r)
 	if len(formatName) == 0 || err != nil {
 		return err
 	}
 
+	done, ok := hndl.streams.start()
+	if !ok {
+		writeShuttingDown(w)
+		return nil
+	}
+	defer hndl.streams.stop()
+
 	ready := make(chan *chanBuf, 1)
 	var buf = chanBuf{ready: ready}
 	defer buf.Close()
+	if source.ContextBacklog(r.Context()) > 0 {
+		buf.backlogEnd = backlogEndFrame(strings.ToLower(source.FormatName(formatName)))
+	}
 
-	if err := src.Watch(formatName, &buf); err == source.ErrNotWatchable {
+	ctx, kill := context.WithCancel(r.Context())
+	defer kill()
+	buf.watch = addHTTPWatch(r, src.Name(), formatName, kill)
+	defer buf.watch.Remove()
+
+	if err := watchContext(ctx, src, formatName, &buf); err == source.ErrNotWatchable {
 		http.Error(w, "501 source does not support Watch", http.StatusNotImplemented)
 		return nil
+	} else if err == source.ErrInvalidParam {
+		http.Error(w, "400 Bad Request\nInvalid Parameter", http.StatusBadRequest)
+		return nil
+	} else if err == source.ErrFormatTripped {
+		http.Error(w, "503 Service Unavailable\n"+err.Error(), http.StatusServiceUnavailable)
+		return nil
+	} else if pe, ok := err.(*source.PanicError); ok {
+		writePanicError(w, pe)
+		return nil
 	} else if err != nil {
 		return err
 	}
 
-	w.Header().Set("Content-Type", contentTypeFor(formatName))
-	w.Header().Set("Transfer-Encoding", "chunked")
+	fw := hndl.startStream(w, r, formatName)
 
-	w.WriteHeader(http.StatusOK)
+	for {
+		select {
+		case <-ready:
+			if _, err := buf.writeTo(fw); err != nil {
+				return err
+			}
+		case <-done:
+			_, err := buf.writeTo(fw)
+			w.Header().Set(streamEndTrailer, "shutdown")
+			return err
+		case <-ctx.Done():
+			setKilled(w, r)
+			return nil
+		}
+	}
+}
 
-	var fw io.Writer = w
+// doMultiWatch fans in a watch of several sources into the response, wrapping
+// each item in an envelope naming its source: a "name> " prefix for text, or
+// a {"name": ..., "data": ...} object per line for json.  Any sources that
+// aren't watchable are skipped.
+//
+// With "merge=time", items are held back for a short window, and written in
+// order of the time that they were emitted by their sources, rather than in
+// the order that each source's items are drained.
+func (hndl *HTTPRest) doMultiWatch(
+	srcs []source.DataSource,
+	w http.ResponseWriter,
+	r *http.Request,
+) error {
+	formats := commonFormats(srcs)
+	if r.Form.Get("format") == "" {
+		// only offer the enveloped formats to Accept negotiation
+		formats = envelopeFormats(formats)
+	}
+	formatName, err := hndl.determineFormat(formats, w, r)
+	if len(formatName) == 0 || err != nil {
+		return err
+	}
+	format := strings.ToLower(source.FormatName(formatName))
+	if format != "text" && format != "json" {
+		http.Error(w,
+			"400 Bad Request\nOnly text and json may be watched from multiple sources.",
+			http.StatusBadRequest)
+		return nil
+	}
+	var merge *mergeQueue
+	switch r.Form.Get("merge") {
+	case "":
+	case "time":
+		merge = &mergeQueue{}
+	default:
+		http.Error(w, "400 Bad Request\nUnsupported merge, only merge=time is", http.StatusBadRequest)
+		return nil
+	}
 
-	if f, _ := w.(http.Flusher); f != nil {
-		f.Flush()
-		fw = &flushWriter{w, f}
+	done, ok := hndl.streams.start()
+	if !ok {
+		writeShuttingDown(w)
+		return nil
+	}
+	defer hndl.streams.stop()
+
+	ctx, kill := context.WithCancel(r.Context())
+	defer kill()
+	bufs := make(map[*chanBuf]string, len(srcs))
+	itemBufs := make(map[*itemBuf]string, len(srcs))
+	bufReady := make(chan *chanBuf, len(srcs))
+	itemBufReady := make(chan *itemBuf, len(srcs))
+	defer func() {
+		for buf := range bufs {
+			buf.Close()
+			buf.watch.Remove()
+		}
+		for itemBuf := range itemBufs {
+			itemBuf.Close()
+			itemBuf.watch.Remove()
+		}
+	}()
+
+	for _, src := range srcs {
+		if itemSource, ok := src.(source.ItemDataSource); ok {
+			var (
+				itemBuf *itemBuf
+				iw      source.ItemWatcher
+			)
+			if merge != nil {
+				tib := newTimedItemBuf(itemBufReady)
+				itemBuf, iw = tib.itemBuf, tib
+			} else {
+				itemBuf = newItemBuf(itemBufReady)
+				iw = itemBuf
+			}
+			itemBuf.watch = addHTTPWatch(r, src.Name(), formatName, kill)
+			err = watchItemsContext(ctx, itemSource, formatName, iw)
+			if err == nil {
+				itemBufs[itemBuf] = src.Name()
+			} else {
+				itemBuf.watch.Remove()
+			}
+		} else {
+			buf := &chanBuf{ready: bufReady}
+			buf.watch = addHTTPWatch(r, src.Name(), formatName, kill)
+			err = watchContext(ctx, src, formatName, buf)
+			if err == nil {
+				bufs[buf] = src.Name()
+			} else {
+				buf.watch.Remove()
+			}
+		}
+		if pe, ok := err.(*source.PanicError); ok {
+			writePanicError(w, pe)
+			return nil
+		} else if err == source.ErrInvalidParam {
+			http.Error(w, "400 Bad Request\nInvalid Parameter", http.StatusBadRequest)
+			return nil
+		} else if err != nil && err != source.ErrNotWatchable {
+			return err
+		}
+	}
+	if len(bufs) == 0 && len(itemBufs) == 0 {
+		http.Error(w, "501 no source supports Watch", http.StatusNotImplemented)
+		return nil
 	}
 
-	var cn <-chan bool
-	if cnr, ok := w.(http.CloseNotifier); ok {
-		cn = cnr.CloseNotify()
+	fw := hndl.startStream(w, r, formatName)
+
+	var out, env bytes.Buffer
+	write := func(name string, t time.Time, data []byte) error {
+		if merge == nil {
+			return writeEnvelope(&out, format, name, data)
+		}
+		env.Reset()
+		if err := writeEnvelope(&env, format, name, data); err != nil {
+			return err
+		}
+		merge.push(t, env.Bytes())
+		return nil
+	}
+	// writeBuf envelopes each complete line in buf; a partial line is kept
+	// until the rest of it is written, unless the stream is ending.
+	writeBuf := func(buf *chanBuf, final bool) error {
+		buf.Lock()
+		defer buf.Unlock()
+		now := time.Now()
+		for {
+			line, doneErr := buf.ReadBytes('\n')
+			if doneErr != nil {
+				buf.Reset()
+				if len(line) > 0 && !final {
+					buf.Buffer.Write(line)
+					return nil
+				}
+			} else {
+				line = line[:len(line)-1]
+			}
+			if len(line) > 0 {
+				if err := write(bufs[buf], now, line); err != nil {
+					return err
+				}
+			}
+			if doneErr != nil {
+				return nil
+			}
+		}
+	}
+	writeItemBuf := func(itemBuf *itemBuf) error {
+		items, times := itemBuf.drainTimes()
+		now := time.Now()
+		for i, item := range items {
+			// an item without a time is merged as if emitted now, rather
+			// than ahead of everything
+			t := now
+			if i < len(times) {
+				t = times[i]
+			}
+			if err := write(itemBufs[itemBuf], t, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	// a merging watch releases held back items on every tick
+	var tick <-chan time.Time
+	if merge != nil {
+		ticker := time.NewTicker(defaultMergeWindow / 2)
+		defer ticker.Stop()
+		tick = ticker.C
 	}
 
 	for {
 		select {
-		case <-ready:
-			if _, err := buf.writeTo(fw); err != nil {
-				return err
+		case buf := <-bufReady:
+			err = writeBuf(buf, false)
+		case itemBuf := <-itemBufReady:
+			err = writeItemBuf(itemBuf)
+		case now := <-tick:
+			err = merge.flush(&out, now.Add(-defaultMergeWindow))
+		case <-done:
+			for buf := range bufs {
+				if err := writeBuf(buf, true); err != nil {
+					return err
+				}
+			}
+			for itemBuf := range itemBufs {
+				if err := writeItemBuf(itemBuf); err != nil {
+					return err
+				}
 			}
-		case <-cn:
-			// TODO: don't get this, why
+			if merge != nil {
+				if err := merge.flush(&out, time.Time{}); err != nil {
+					return err
+				}
+			}
+			_, err := out.WriteTo(fw)
+			w.Header().Set(streamEndTrailer, "shutdown")
+			return err
+		case <-ctx.Done():
+			setKilled(w, r)
 			return nil
 		}
+		if err != nil {
+			return err
+		}
+		if out.Len() == 0 {
+			continue
+		}
+		if _, err := out.WriteTo(fw); err != nil {
+			return err
+		}
+	}
+}
+
+// addHTTPWatch lists a watch of the named source, by the request's client, on
+// the "/meta/watchers" source; kill must end the watch's stream.
+func addHTTPWatch(r *http.Request, name, format string, kill func()) *meta.ActiveWatch {
+	return meta.AddWatch(meta.Watch{
+		Source:     name,
+		Format:     format,
+		Protocol:   "http",
+		RemoteAddr: r.RemoteAddr,
+		Label:      source.WatchLabel(r.Context()),
+	}, kill)
+}
+
+// setKilled sets the stream end trailer if a watch stream's context is done
+// because it was killed, rather than because the client went away.
+func setKilled(w http.ResponseWriter, r *http.Request) {
+	if r.Context().Err() == nil {
+		w.Header().Set(streamEndTrailer, "killed")
+	}
+}
+
+// watchContext watches src for the lifetime of ctx, if the source supports it;
+// otherwise the watch lasts until a write to w fails.
+func watchContext(ctx context.Context, src source.DataSource, format string, w io.Writer) error {
+	if csrc, ok := src.(source.ContextDataSource); ok {
+		return csrc.WatchContext(ctx, format, w)
+	}
+	return src.Watch(format, w)
+}
+
+// watchItemsContext is the ItemDataSource analog of watchContext.
+func watchItemsContext(
+	ctx context.Context,
+	src source.ItemDataSource,
+	format string,
+	iw source.ItemWatcher,
+) error {
+	if csrc, ok := src.(source.ContextItemDataSource); ok {
+		return csrc.WatchItemsContext(ctx, format, iw)
+	}
+	return src.WatchItems(format, iw)
+}
+
+// writeEnvelope writes a single line wrapping data with its source name, and
+// in json, the process's identity.
+func writeEnvelope(w *bytes.Buffer, format, name string, data []byte) error {
+	switch format {
+	case "json":
+		buf, err := json.Marshal(newMultiJSONMessage(name, &data))
+		if err != nil {
+			return err
+		}
+		w.Write(buf)
+	default:
+		w.WriteString(name)
+		w.WriteString("> ")
+		w.Write(data)
 	}
+	return w.WriteByte('\n')
 }
 
+// determineFormat picks the format of a response from those available: the
+// one named by the "format" parameter, with any arguments that it gives,
+// else the best one acceptable by the Accept header, else the first of the
+// default formats available.
 func (hndl *HTTPRest) determineFormat(
-	src source.DataSource,
+	formats []string,
 	w http.ResponseWriter,
 	r *http.Request,
 ) (string, error) {
-	// TODO: some people like Accepts negotiation
-
-	formats := src.Formats()
-
-	formatName := r.Form.Get("format")
-	if len(formatName) != 0 {
+	formatSpec := r.Form.Get("format")
+	if len(formatSpec) != 0 {
+		formatName, _, err := source.ParseFormat(formatSpec)
+		if err != nil {
+			http.Error(w, "400 Bad Request\nInvalid Parameter", http.StatusBadRequest)
+			return "", nil
+		}
 		for _, availFormat := range formats {
 			if strings.EqualFold(formatName, availFormat) {
+				if i := strings.IndexByte(formatSpec, ';'); i >= 0 {
+					return availFormat + formatSpec[i:], nil
+				}
 				return availFormat, nil
 			}
 		}
@@ -301,13 +1038,87 @@ func (hndl *HTTPRest) determineFormat(
 		return "", nil
 	}
 
+	if len(formats) == 0 {
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, "400 Bad Request\nNo Common Format\n")
+		return "", nil
+	}
+
+	preferred := hndl.preferredFormats(formats)
+	w.Header().Add("Vary", "Accept")
+	if ranges := parseAccept(strings.Join(r.Header["Accept"], ",")); len(ranges) > 0 {
+		if name := negotiateFormat(ranges, preferred); name != "" {
+			return name, nil
+		}
+		writeNotAcceptable(w, formats)
+		return "", nil
+	}
+
+	return preferred[0], nil
+}
+
+// preferredFormats orders the available formats with the default ones first.
+func (hndl *HTTPRest) preferredFormats(formats []string) []string {
+	preferred := make([]string, 0, len(formats))
+	seen := make(map[string]bool, len(formats))
 	for _, defaultFormat := range hndl.defaultFormats {
 		for _, availFormat := range formats {
-			if strings.EqualFold(availFormat, defaultFormat) {
-				return availFormat, nil
+			if !seen[availFormat] && strings.EqualFold(availFormat, defaultFormat) {
+				seen[availFormat] = true
+				preferred = append(preferred, availFormat)
 			}
 		}
 	}
+	for _, availFormat := range formats {
+		if !seen[availFormat] {
+			preferred = append(preferred, availFormat)
+		}
+	}
+	return preferred
+}
+
+// writeNotAcceptable refuses a request whose Accept header allows none of the
+// available formats, listing their content types, and the format parameter
+// that would select each one.
+func writeNotAcceptable(w http.ResponseWriter, formats []string) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusNotAcceptable)
+	io.WriteString(w, "406 Not Acceptable\nSupported types:\n")
+	for _, name := range formats {
+		fmt.Fprintf(w, "%s (format=%s)\n", contentTypeFor(name), name)
+	}
+}
 
-	return formats[0], nil
+// envelopeFormats returns those of the formats that writeEnvelope supports.
+func envelopeFormats(formats []string) []string {
+	var env []string
+	for _, name := range formats {
+		switch strings.ToLower(name) {
+		case "text", "json":
+			env = append(env, name)
+		}
+	}
+	return env
+}
+
+// commonFormats returns the formats supported by all of the passed sources,
+// in the order listed by the first one.
+func commonFormats(srcs []source.DataSource) []string {
+	if len(srcs) == 0 {
+		return nil
+	}
+	formats := srcs[0].Formats()
+	for _, src := range srcs[1:] {
+		var common []string
+		for _, format := range formats {
+			for _, other := range src.Formats() {
+				if strings.EqualFold(format, other) {
+					common = append(common, format)
+					break
+				}
+			}
+		}
+		formats = common
+	}
+	return formats
 }
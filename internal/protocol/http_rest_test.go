@@ -0,0 +1,451 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package protocol
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber-go/gwr/internal/marshaled"
+	"github.com/uber-go/gwr/source"
+)
+
+// rawSource is a watchable DataSource whose watch stream is written by the
+// test, framing included.
+type rawSource struct {
+	name     string
+	watching chan io.Writer
+}
+
+func newRawSource(name string) *rawSource {
+	return &rawSource{name: name, watching: make(chan io.Writer, 1)}
+}
+
+func (rs *rawSource) Name() string                         { return rs.name }
+func (rs *rawSource) Formats() []string                    { return []string{"text", "json"} }
+func (rs *rawSource) Attrs() map[string]interface{}        { return nil }
+func (rs *rawSource) Get(format string, w io.Writer) error { return source.ErrNotGetable }
+
+func (rs *rawSource) Watch(format string, w io.Writer) error {
+	rs.watching <- w
+	return nil
+}
+
+// getOnlySource is a DataSource that may not be watched.
+type getOnlySource struct {
+	name string
+}
+
+func (gs getOnlySource) Name() string                  { return gs.name }
+func (gs getOnlySource) Formats() []string             { return []string{"text", "json"} }
+func (gs getOnlySource) Attrs() map[string]interface{} { return nil }
+
+func (gs getOnlySource) Get(format string, w io.Writer) error {
+	_, err := io.WriteString(w, "{}\n")
+	return err
+}
+
+func (gs getOnlySource) Watch(format string, w io.Writer) error {
+	return source.ErrNotWatchable
+}
+
+// itemSource is a watchable generic source whose items are emitted by the
+// test.
+type itemSource struct {
+	name    string
+	lock    sync.Mutex
+	watcher source.GenericDataWatcher
+}
+
+func (is *itemSource) Name() string                     { return is.name }
+func (is *itemSource) TextTemplate() *template.Template { return nil }
+
+func (is *itemSource) SetWatcher(watcher source.GenericDataWatcher) {
+	is.lock.Lock()
+	is.watcher = watcher
+	is.lock.Unlock()
+}
+
+// emit passes an item to the source's watcher, once it has one that's active.
+func (is *itemSource) emit(t *testing.T, item interface{}) {
+	for i := 0; i < 100; i++ {
+		is.lock.Lock()
+		watcher := is.watcher
+		is.lock.Unlock()
+		if watcher != nil && watcher.Active() {
+			watcher.HandleItem(item)
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	require.Fail(t, "source not watched", is.name)
+}
+
+// newMultiWatchServer serves an HTTPRest of a raw source, an item source, and
+// two get-only sources.
+func newMultiWatchServer(t *testing.T) (*httptest.Server, *rawSource, *itemSource) {
+	dss := source.NewDataSources()
+	raw := newRawSource("/test/raw")
+	items := &itemSource{name: "/test/items"}
+	require.NoError(t, dss.Add(raw))
+	require.NoError(t, dss.Add(marshaled.NewDataSource(items, nil)))
+	require.NoError(t, dss.Add(getOnlySource{"/test/get1"}))
+	require.NoError(t, dss.Add(getOnlySource{"/test/get2"}))
+	return httptest.NewServer(NewHTTPRest(dss, "", nil)), raw, items
+}
+
+func TestHTTPRest_multiWatch(t *testing.T) {
+	defer source.SetIdentity(source.ProcessIdentity())
+	source.SetIdentity(source.Identity{})
+	srv, raw, items := newMultiWatchServer(t)
+	defer srv.Close()
+
+	// no gzip, so that each line is read as soon as it's flushed
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	status := func(query string) int {
+		resp, err := http.Get(srv.URL + "/?" + query)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	assert.Equal(t, http.StatusNotFound, status("sources=/no/such,/nor/this&watch=1"), "unknown names")
+	assert.Equal(t, http.StatusNotImplemented, status("sources=/test/get1,/test/get2&watch=1"), "nothing watchable")
+	assert.Equal(t, http.StatusBadRequest, status("sources=/test/raw,/test/items&watch=1&format=html"), "only text and json")
+
+	for _, tc := range []struct {
+		format string
+		want   []string
+	}{
+		{"json", []string{
+			`{"name":"/test/raw","data":{"a":1}}`,
+			`{"name":"/test/items","data":{"b":2}}`,
+		}},
+		{"text", []string{
+			`/test/raw> a=1`,
+			`/test/items> map[b:2]`,
+		}},
+	} {
+		resp, err := client.Get(fmt.Sprintf("%s/?sources=/test/raw,/test/get1,/test/items&watch=1&format=%s", srv.URL, tc.format))
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, resp.StatusCode, "get-only source skipped")
+		rd := bufio.NewReader(resp.Body)
+		readLine := func() string {
+			line, err := rd.ReadString('\n')
+			require.NoError(t, err)
+			return strings.TrimSuffix(line, "\n")
+		}
+
+		// a line written in parts is enveloped once it's complete
+		w := <-raw.watching
+		parts := map[string][]string{
+			"json": {`{"a":`, "1}\n"},
+			"text": {"a=", "1\n"},
+		}[tc.format]
+		_, err = io.WriteString(w, parts[0])
+		require.NoError(t, err)
+		time.Sleep(10 * time.Millisecond)
+		_, err = io.WriteString(w, parts[1])
+		require.NoError(t, err)
+		assert.Equal(t, tc.want[0], readLine(), "%s raw line", tc.format)
+
+		items.emit(t, map[string]int{"b": 2})
+		assert.Equal(t, tc.want[1], readLine(), "%s item", tc.format)
+		resp.Body.Close()
+	}
+}
+
+// timedSource is an ItemDataSource whose items are emitted by the test, each
+// with a given time.
+type timedSource struct {
+	name     string
+	watching chan source.TimedItemWatcher
+}
+
+func newTimedSource(name string) *timedSource {
+	return &timedSource{name: name, watching: make(chan source.TimedItemWatcher, 1)}
+}
+
+func (ts *timedSource) Name() string                           { return ts.name }
+func (ts *timedSource) Formats() []string                      { return []string{"text", "json"} }
+func (ts *timedSource) Attrs() map[string]interface{}          { return nil }
+func (ts *timedSource) Get(format string, w io.Writer) error   { return source.ErrNotGetable }
+func (ts *timedSource) Watch(format string, w io.Writer) error { return source.ErrNotWatchable }
+
+func (ts *timedSource) WatchItems(format string, iw source.ItemWatcher) error {
+	tiw, ok := iw.(source.TimedItemWatcher)
+	if !ok {
+		return source.ErrNotWatchable
+	}
+	ts.watching <- tiw
+	return nil
+}
+
+func TestHTTPRest_multiWatch_mergeTime(t *testing.T) {
+	defer source.SetIdentity(source.ProcessIdentity())
+	source.SetIdentity(source.Identity{})
+	dss := source.NewDataSources()
+	src1, src2 := newTimedSource("/test/t1"), newTimedSource("/test/t2")
+	require.NoError(t, dss.Add(src1))
+	require.NoError(t, dss.Add(src2))
+	srv := httptest.NewServer(NewHTTPRest(dss, "", nil))
+	defer srv.Close()
+
+	client := &http.Client{Transport: &http.Transport{DisableCompression: true}}
+	resp, err := client.Get(srv.URL + "/?sources=/test/t1,/test/t2&watch=1&format=json&merge=time")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	w1, w2 := <-src1.watching, <-src2.watching
+
+	// each source's items arrive together, but are written interleaved, in
+	// the order they were emitted
+	base := time.Now()
+	at := func(ms int) time.Time { return base.Add(time.Duration(ms) * time.Millisecond) }
+	require.NoError(t, w1.HandleTimedItem(at(2), []byte(`{"n":2}`)))
+	require.NoError(t, w1.HandleTimedItem(at(4), []byte(`{"n":4}`)))
+	require.NoError(t, w2.HandleTimedItems(at(1), [][]byte{[]byte(`{"n":1}`)}))
+	require.NoError(t, w2.HandleTimedItem(at(3), []byte(`{"n":3}`)))
+
+	rd := bufio.NewReader(resp.Body)
+	for _, want := range []string{
+		`{"name":"/test/t2","data":{"n":1}}`,
+		`{"name":"/test/t1","data":{"n":2}}`,
+		`{"name":"/test/t2","data":{"n":3}}`,
+		`{"name":"/test/t1","data":{"n":4}}`,
+	} {
+		line, err := rd.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, want, strings.TrimSuffix(line, "\n"))
+	}
+}
+
+// docSource is a get-only source of a document set by the test.
+type docSource struct {
+	lock sync.Mutex
+	v    int
+}
+
+func (ds *docSource) Name() string                           { return "/test/doc" }
+func (ds *docSource) Formats() []string                      { return []string{"text", "json"} }
+func (ds *docSource) Attrs() map[string]interface{}          { return nil }
+func (ds *docSource) Watch(format string, w io.Writer) error { return source.ErrNotWatchable }
+
+func (ds *docSource) Get(format string, w io.Writer) error {
+	ds.lock.Lock()
+	v := ds.v
+	ds.lock.Unlock()
+	if format == "json" {
+		_, err := fmt.Fprintf(w, `{"name":"doc","v":%d}`+"\n", v)
+		return err
+	}
+	_, err := fmt.Fprintf(w, "name=doc\nv=%d\n", v)
+	return err
+}
+
+func (ds *docSource) set(v int) {
+	ds.lock.Lock()
+	ds.v = v
+	ds.lock.Unlock()
+}
+
+func TestHTTPRest_diffPrev(t *testing.T) {
+	dss := source.NewDataSources()
+	doc := &docSource{}
+	require.NoError(t, dss.Add(doc))
+	hndl := NewHTTPRest(dss, "", nil)
+	srv := httptest.NewServer(hndl)
+	defer srv.Close()
+
+	get := func(query string) (string, string) {
+		resp, err := http.Get(srv.URL + "/test/doc?" + query)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return string(body), resp.Header.Get(snapshotHeader)
+	}
+
+	body, _ := get("format=text&diff=next")
+	assert.Contains(t, body, "only diff=prev", "unsupported diff")
+
+	// the first diff is of the whole document
+	body, a := get("format=text&diff=prev")
+	assert.Equal(t, "--- /test/doc\tprevious\n+++ /test/doc\tcurrent\n@@ -0,0 +1,2 @@\n+name=doc\n+v=0\n", body)
+	require.NotEmpty(t, a, "snapshot token returned")
+
+	// another client's get doesn't move the first's baseline
+	doc.set(1)
+	body, b := get("format=text&diff=prev")
+	assert.Contains(t, body, "+v=1", "whole document, without a token")
+	assert.NotEqual(t, a, b, "each client gets its own baseline")
+	body, a2 := get("format=text&diff=prev&snapshot=" + a)
+	assert.Contains(t, body, "-v=0\n+v=1\n", "changed since the client's last get")
+	assert.Equal(t, a, a2, "baseline token kept")
+	body, _ = get("format=text&diff=prev&snapshot=" + a)
+	assert.Empty(t, body, "no change since")
+
+	// a token of another format starts over
+	body, j := get("format=json&diff=prev&snapshot=" + a)
+	assert.NotEqual(t, a, j)
+	assert.Contains(t, body, `"op":"add"`, "whole document")
+	doc.set(2)
+	body, _ = get("format=json&diff=prev&snapshot=" + j)
+	assert.Equal(t, `[{"op":"replace","path":"/v","value":2}]`+"\n", body)
+
+	// baselines are bounded, forgetting the least recently used
+	for i := 0; i < maxSnapshots; i++ {
+		get("format=text&diff=prev")
+	}
+	assert.Equal(t, maxSnapshots, hndl.snapshots.len())
+	body, _ = get("format=json&diff=prev&snapshot=" + j)
+	assert.Contains(t, body, `"op":"add"`, "forgotten baseline starts over")
+}
+
+// slowGetSource is a get-only source whose gets run until their context is
+// done, like a cpu profile.
+type slowGetSource struct {
+	getOnlySource
+	started chan struct{}
+}
+
+func (ss slowGetSource) GetParamsContext(
+	ctx context.Context,
+	format string,
+	params map[string]string,
+	w io.Writer,
+) error {
+	close(ss.started)
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func TestHTTPRest_getShutdown(t *testing.T) {
+	dss := source.NewDataSources()
+	slow := slowGetSource{getOnlySource{"/test/slow"}, make(chan struct{})}
+	require.NoError(t, dss.Add(slow))
+	hndl := NewHTTPRest(dss, "", nil)
+	srv := httptest.NewServer(hndl)
+	defer srv.Close()
+
+	done := make(chan int, 1)
+	go func() {
+		resp, err := http.Get(srv.URL + "/test/slow")
+		if err != nil {
+			done <- 0
+			return
+		}
+		resp.Body.Close()
+		done <- resp.StatusCode
+	}()
+
+	select {
+	case <-slow.started:
+	case <-time.After(5 * time.Second):
+		require.Fail(t, "get not started")
+	}
+	require.NoError(t, hndl.Shutdown(context.Background()))
+	select {
+	case code := <-done:
+		assert.Equal(t, http.StatusInternalServerError, code, "get canceled by shutdown")
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "get still running after shutdown")
+	}
+}
+
+// sampleSource is an item source with a sample item, if it's set.
+type sampleSource struct {
+	itemSource
+	sample interface{}
+}
+
+func (ss *sampleSource) SampleItem() (interface{}, bool) {
+	return ss.sample, ss.sample != nil
+}
+
+// panickyItem fails to marshal, as any item might.
+type panickyItem struct{}
+
+func (pi panickyItem) MarshalJSON() ([]byte, error) { panic("no json for you") }
+
+func TestHTTPRest_sampleFormat(t *testing.T) {
+	dss := source.NewDataSources()
+	sampled := &sampleSource{itemSource: itemSource{name: "/test/sampled"}, sample: map[string]int{"b": 2}}
+	unsampled := &sampleSource{itemSource: itemSource{name: "/test/unsampled"}}
+	panicky := &sampleSource{itemSource: itemSource{name: "/test/panicky"}, sample: panickyItem{}}
+	for _, src := range []*sampleSource{sampled, unsampled, panicky} {
+		require.NoError(t, dss.Add(marshaled.NewDataSource(src, nil)))
+	}
+	require.NoError(t, dss.Add(getOnlySource{"/test/get"}))
+	srv := httptest.NewServer(NewHTTPRest(dss, "", nil))
+	defer srv.Close()
+
+	get := func(path string) (int, string, string) {
+		resp, err := http.Get(srv.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, resp.Header.Get("Content-Type"), string(body)
+	}
+
+	code, ctype, body := get("/test/sampled?sample-format=1&format=json")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, ctype, "json")
+	var samples map[string]string
+	require.NoError(t, json.Unmarshal([]byte(body), &samples))
+	assert.Equal(t, "{\"b\":2}\n", samples["json"], "framed as in a watch")
+	assert.Contains(t, samples, "html")
+
+	code, ctype, body = get("/test/sampled?sample-format=1")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, ctype, "text/plain")
+	assert.Contains(t, body, "== json ==\n{\"b\":2}\n\n", "text sections")
+	assert.Contains(t, body, "== html ==\n")
+
+	code, _, body = get("/test/unsampled?sample-format=1")
+	assert.Equal(t, http.StatusNotFound, code, "no item yet")
+	assert.Contains(t, body, "no sample item")
+
+	code, _, body = get("/test/get?sample-format=1")
+	assert.Equal(t, http.StatusNotFound, code, "not a sampling source")
+	assert.Contains(t, body, "no sample item")
+
+	code, _, body = get("/test/panicky?sample-format=1")
+	assert.Equal(t, http.StatusInternalServerError, code, "format panicked")
+	assert.Contains(t, body, "500 Source Panicked")
+
+	code, _, _ = get("/test/sampled")
+	assert.Equal(t, http.StatusNotImplemented, code, "a plain get is unchanged")
+}
@@ -23,6 +23,9 @@ package protocol
 import (
 	"errors"
 	"sync"
+	"time"
+
+	"github.com/uber-go/gwr/internal/meta"
 )
 
 var errItemBufClosed = errors.New("item buffer closed")
@@ -35,6 +38,15 @@ type itemBuf struct {
 	buffer  [][]byte
 	takeBuf [][]byte
 	// TODO: limit
+
+	// when stamped, the time each item was emitted is kept in times,
+	// parallel to buffer; see timedItemBuf
+	stamped   bool
+	times     []time.Time
+	takeTimes []time.Time
+
+	// watch, if set, counts the items put as delivered
+	watch *meta.ActiveWatch
 }
 
 func newItemBuf(ready chan<- *itemBuf) *itemBuf {
@@ -43,27 +55,34 @@ func newItemBuf(ready chan<- *itemBuf) *itemBuf {
 	}
 }
 
-func (ib *itemBuf) put(items ...[]byte) (int, error) {
+func (ib *itemBuf) put(t time.Time, items ...[]byte) (int, error) {
 	if ib.closed {
 		return 0, errItemBufClosed
 	}
 	ib.buffer = append(ib.buffer, items...)
+	ib.watch.Delivered(len(items))
+	if ib.stamped {
+		if t.IsZero() {
+			t = time.Now()
+		}
+		for range items {
+			ib.times = append(ib.times, t)
+		}
+	}
 	return len(items), nil
 }
 
 func (ib *itemBuf) HandleItem(item []byte) error {
-	ib.Lock()
-	n, err := ib.put(item)
-	ib.Unlock()
-	if n > 0 {
-		ib.ready <- ib
-	}
-	return err
+	return ib.handle(time.Time{}, item)
 }
 
 func (ib *itemBuf) HandleItems(items [][]byte) error {
+	return ib.handle(time.Time{}, items...)
+}
+
+func (ib *itemBuf) handle(t time.Time, items ...[]byte) error {
 	ib.Lock()
-	n, err := ib.put(items...)
+	n, err := ib.put(t, items...)
 	ib.Unlock()
 	if n > 0 {
 		ib.ready <- ib
@@ -80,10 +99,40 @@ func (ib *itemBuf) Close() error {
 	return nil
 }
 
+// timedItemBuf is a stamped itemBuf that's also a source.TimedItemWatcher,
+// so that data sources which know when each item was emitted pass it on;
+// items from any other source are stamped with the time they're handled.
+type timedItemBuf struct {
+	*itemBuf
+}
+
+func newTimedItemBuf(ready chan<- *itemBuf) timedItemBuf {
+	ib := newItemBuf(ready)
+	ib.stamped = true
+	return timedItemBuf{ib}
+}
+
+func (tib timedItemBuf) HandleTimedItem(t time.Time, item []byte) error {
+	return tib.handle(t, item)
+}
+
+func (tib timedItemBuf) HandleTimedItems(t time.Time, items [][]byte) error {
+	return tib.handle(t, items...)
+}
+
 func (ib *itemBuf) drain() [][]byte {
+	items, _ := ib.drainTimes()
+	return items
+}
+
+// drainTimes drains the buffer like drain, also returning the time that each
+// item was handled if the buffer is stamped.
+func (ib *itemBuf) drainTimes() ([][]byte, []time.Time) {
 	ib.Lock()
 	ib.takeBuf = append(ib.takeBuf[:0], ib.buffer...)
 	ib.buffer = ib.buffer[:0]
+	ib.takeTimes = append(ib.takeTimes[:0], ib.times...)
+	ib.times = ib.times[:0]
 	ib.Unlock()
-	return ib.takeBuf
+	return ib.takeBuf, ib.takeTimes
 }
@@ -0,0 +1,85 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package protocol
+
+import (
+	"container/heap"
+	"io"
+	"time"
+)
+
+// defaultMergeWindow is how long items are held back, when merging watches by
+// time, for any earlier items from other sources to arrive.
+const defaultMergeWindow = 100 * time.Millisecond
+
+type mergeItem struct {
+	t    time.Time
+	seq  uint64
+	data []byte
+}
+
+// mergeQueue orders framed items from several sources by time, keeping items
+// with the same time in the order they were pushed.
+type mergeQueue struct {
+	seq   uint64
+	items []mergeItem
+}
+
+func (mq *mergeQueue) Len() int { return len(mq.items) }
+
+func (mq *mergeQueue) Less(i, j int) bool {
+	if !mq.items[i].t.Equal(mq.items[j].t) {
+		return mq.items[i].t.Before(mq.items[j].t)
+	}
+	return mq.items[i].seq < mq.items[j].seq
+}
+
+func (mq *mergeQueue) Swap(i, j int) { mq.items[i], mq.items[j] = mq.items[j], mq.items[i] }
+
+func (mq *mergeQueue) Push(x interface{}) { mq.items = append(mq.items, x.(mergeItem)) }
+
+func (mq *mergeQueue) Pop() interface{} {
+	n := len(mq.items)
+	item := mq.items[n-1]
+	mq.items = mq.items[:n-1]
+	return item
+}
+
+// push queues a copy of data to be written in order of t.
+func (mq *mergeQueue) push(t time.Time, data []byte) {
+	mq.seq++
+	heap.Push(mq, mergeItem{t, mq.seq, append([]byte(nil), data...)})
+}
+
+// flush writes, in order, all queued items whose time isn't after before; a
+// zero before flushes everything.
+func (mq *mergeQueue) flush(w io.Writer, before time.Time) error {
+	for len(mq.items) > 0 {
+		if !before.IsZero() && mq.items[0].t.After(before) {
+			break
+		}
+		item := heap.Pop(mq).(mergeItem)
+		if _, err := w.Write(item.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package protocol
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeQueue(t *testing.T) {
+	t0 := time.Now()
+	var mq mergeQueue
+	mq.push(t0.Add(2), []byte("b1\n"))
+	mq.push(t0.Add(1), []byte("a1\n"))
+	mq.push(t0.Add(2), []byte("b2\n"))
+	mq.push(t0.Add(3), []byte("c1\n"))
+
+	var buf bytes.Buffer
+	assert.NoError(t, mq.flush(&buf, t0.Add(2)))
+	assert.Equal(t, "a1\nb1\nb2\n", buf.String(), "ordered by time, then push order")
+
+	buf.Reset()
+	assert.NoError(t, mq.flush(&buf, time.Time{}))
+	assert.Equal(t, "c1\n", buf.String(), "zero time flushes everything")
+	assert.Equal(t, 0, mq.Len())
+}
@@ -0,0 +1,487 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package protocol
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uber-go/gwr/internal/resp"
+	"github.com/uber-go/gwr/source"
+)
+
+// pubSubFormat is the format in which subscribed sources are watched; each
+// item is one message.
+const pubSubFormat = "json"
+
+// pubSubAllowed are the commands that a session may send while it's
+// subscribed; any others are refused, as by redis.
+var pubSubAllowed = map[string]bool{
+	"subscribe":    true,
+	"psubscribe":   true,
+	"unsubscribe":  true,
+	"punsubscribe": true,
+	"ping":         true,
+}
+
+// pubSub is a session's redis compatible pub/sub state: its subscribed
+// channels, which are source names, and patterns, and the watches of the
+// sources that they name.  Once subscribed, all writes to the connection
+// hold the lock, since items are written from the pump goroutine.
+type pubSub struct {
+	sync.Mutex
+	rconn    *resp.RedisConnection
+	ctx      context.Context // carries the connection's rate limiter
+	channels map[string][]*pubSubWatch
+	patterns map[string][]*pubSubWatch
+	watches  map[*itemBuf]*pubSubWatch
+	ready    chan *itemBuf
+	stop     chan struct{}
+	stopped  chan struct{}
+}
+
+// pubSubWatch is the watch of one source, for a channel or pattern
+// subscription.
+type pubSubWatch struct {
+	pattern string
+	name    string
+	src     source.ItemDataSource
+	buf     *itemBuf
+}
+
+// pubSubCommands wraps every command that's not allowed while subscribed with
+// unlessSubscribed.
+func (rm *respModel) pubSubCommands(cmds map[string]resp.CmdFunc) map[string]resp.CmdFunc {
+	for name, fn := range cmds {
+		if !pubSubAllowed[name] && !strings.HasPrefix(name, "_") {
+			cmds[name] = rm.unlessSubscribed(name, fn)
+		}
+	}
+	return cmds
+}
+
+// unlessSubscribed wraps a command to refuse it while the session is
+// subscribed.
+func (rm *respModel) unlessSubscribed(name string, fn resp.CmdFunc) resp.CmdFunc {
+	return func(rconn *resp.RedisConnection, vc *resp.ValueConsumer) error {
+		ps := rm.session(rconn).pubsub
+		if ps == nil {
+			return fn(rconn, vc)
+		}
+		for vc.NumRemaining() > 0 {
+			if _, err := vc.Consume("argument"); err != nil {
+				return err
+			}
+		}
+		ps.Lock()
+		defer ps.Unlock()
+		return rconn.WriteError(fmt.Errorf(
+			"%s not allowed, only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING are allowed while subscribed", name))
+	}
+}
+
+// handlePing implements "ping [message]", replying like redis does: with
+// "PONG", or the message, unless subscribed, when it's a "pong" array.
+func (rm *respModel) handlePing(rconn *resp.RedisConnection, vc *resp.ValueConsumer) error {
+	msg := ""
+	if vc.NumRemaining() > 0 {
+		rv, err := vc.Consume("message")
+		if err != nil {
+			return err
+		}
+		msg, _ = rv.GetString()
+	}
+	if vc.NumRemaining() > 0 {
+		return fmt.Errorf("too many arguments to ping")
+	}
+
+	ps := rm.session(rconn).pubsub
+	if ps == nil {
+		if msg == "" {
+			return rconn.WriteSimpleString("PONG")
+		}
+		return rconn.WriteBulkString(msg)
+	}
+	ps.Lock()
+	defer ps.Unlock()
+	if err := rconn.WriteArrayHeader(2); err != nil {
+		return err
+	}
+	if err := rconn.WriteBulkString("pong"); err != nil {
+		return err
+	}
+	return rconn.WriteBulkString(msg)
+}
+
+// handleSubscribe implements "subscribe <name> [name ...]", which watches
+// each named source, writing each of its items as a redis "message" push.
+// Subscribing to a name with no source succeeds, but gets no messages.
+func (rm *respModel) handleSubscribe(rconn *resp.RedisConnection, vc *resp.ValueConsumer) error {
+	return rm.subscribe(rconn, vc, "subscribe", false)
+}
+
+// handlePSubscribe implements "psubscribe <pattern> [pattern ...]", which
+// watches each source matching a pattern, see source.DataSources.Match,
+// writing each of its items as a redis "pmessage" push.  Patterns are matched
+// when subscribed; sources added later aren't watched.
+func (rm *respModel) handlePSubscribe(rconn *resp.RedisConnection, vc *resp.ValueConsumer) error {
+	return rm.subscribe(rconn, vc, "psubscribe", true)
+}
+
+func (rm *respModel) subscribe(rconn *resp.RedisConnection, vc *resp.ValueConsumer, kind string, pattern bool) error {
+	if vc.NumRemaining() == 0 {
+		return fmt.Errorf("wrong number of arguments for %s", kind)
+	}
+	names := make([]string, 0, vc.NumRemaining())
+	for vc.NumRemaining() > 0 {
+		rv, err := vc.Consume("channel")
+		if err != nil {
+			return err
+		}
+		name, ok := rv.GetString()
+		if !ok {
+			return fmt.Errorf("channel argument not a string")
+		}
+		names = append(names, name)
+	}
+
+	// authorize every source first, so that a refusal subscribes to none
+	srcs := make([][]source.DataSource, len(names))
+	for i, name := range names {
+		if pattern {
+			srcs[i] = rm.sources.Match(name)
+		} else if src := rm.sources.Get(name); src != nil {
+			srcs[i] = []source.DataSource{src}
+		}
+		if ok, err := rm.authorizeWatch(rconn, srcs[i]); !ok {
+			return err
+		}
+	}
+
+	session := rm.session(rconn)
+	ps := session.pubsub
+	if ps == nil {
+		var err error
+		if ps, err = rm.startPubSub(rconn, session); err != nil {
+			return err
+		}
+	}
+
+	// the watches start once the replies are written, so that any items
+	// they emit straight away follow them
+	var started []*pubSubWatch
+	ps.Lock()
+	for i, name := range names {
+		subs := ps.channels
+		if pattern {
+			subs = ps.patterns
+		}
+		if _, ok := subs[name]; !ok {
+			watches := make([]*pubSubWatch, 0, len(srcs[i]))
+			for _, src := range srcs[i] {
+				if psw := ps.newWatch(src, name, pattern); psw != nil {
+					watches = append(watches, psw)
+				}
+			}
+			subs[name] = watches
+			started = append(started, watches...)
+		}
+		if err := ps.writeReply(kind, name, true); err != nil {
+			ps.Unlock()
+			return err
+		}
+	}
+	ps.Unlock()
+
+	for _, psw := range started {
+		watchItemsContext(ps.ctx, psw.src, pubSubFormat, psw.buf)
+	}
+	return nil
+}
+
+// newWatch creates a watch of a source for a subscription; sources that
+// can't be watched for items are skipped.  The lock must be held.
+func (ps *pubSub) newWatch(src source.DataSource, name string, pattern bool) *pubSubWatch {
+	isrc, ok := src.(source.ItemDataSource)
+	if !ok {
+		return nil
+	}
+	psw := &pubSubWatch{
+		name: src.Name(),
+		src:  isrc,
+		buf:  newItemBuf(ps.ready),
+	}
+	if pattern {
+		psw.pattern = name
+	}
+	ps.watches[psw.buf] = psw
+	return psw
+}
+
+// handleUnsubscribe implements "unsubscribe [name ...]", which ends the
+// subscriptions to the named sources, or all of them if none are named.
+func (rm *respModel) handleUnsubscribe(rconn *resp.RedisConnection, vc *resp.ValueConsumer) error {
+	return rm.unsubscribe(rconn, vc, "unsubscribe", false)
+}
+
+// handlePUnsubscribe implements "punsubscribe [pattern ...]", which ends the
+// subscriptions to the patterns, or all of them if none are given.
+func (rm *respModel) handlePUnsubscribe(rconn *resp.RedisConnection, vc *resp.ValueConsumer) error {
+	return rm.unsubscribe(rconn, vc, "punsubscribe", true)
+}
+
+func (rm *respModel) unsubscribe(rconn *resp.RedisConnection, vc *resp.ValueConsumer, kind string, pattern bool) error {
+	var names []string
+	for vc.NumRemaining() > 0 {
+		rv, err := vc.Consume("channel")
+		if err != nil {
+			return err
+		}
+		name, ok := rv.GetString()
+		if !ok {
+			return fmt.Errorf("channel argument not a string")
+		}
+		names = append(names, name)
+	}
+
+	session := rm.session(rconn)
+	ps := session.pubsub
+	if ps == nil {
+		// like redis, reply that nothing remains subscribed
+		for _, name := range names {
+			if err := writePubSubReply(rconn, kind, name, true, 0); err != nil {
+				return err
+			}
+		}
+		if len(names) == 0 {
+			return writePubSubReply(rconn, kind, "", false, 0)
+		}
+		return nil
+	}
+
+	ps.Lock()
+	subs := ps.channels
+	if pattern {
+		subs = ps.patterns
+	}
+	if len(names) == 0 {
+		for name := range subs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			if err := ps.writeReply(kind, "", false); err != nil {
+				ps.Unlock()
+				return err
+			}
+		}
+	}
+	for _, name := range names {
+		for _, psw := range subs[name] {
+			psw.buf.Close()
+			delete(ps.watches, psw.buf)
+		}
+		delete(subs, name)
+		if err := ps.writeReply(kind, name, true); err != nil {
+			ps.Unlock()
+			return err
+		}
+	}
+	done := len(ps.channels)+len(ps.patterns) == 0
+	ps.Unlock()
+
+	if done {
+		rm.stopPubSub(rconn, session)
+	}
+	return nil
+}
+
+// startPubSub puts the session into subscribed mode, starting its pump.
+// Like a monitor, a subscribed connection is exempt from the idle timeout.
+func (rm *respModel) startPubSub(rconn *resp.RedisConnection, session *respSession) (*pubSub, error) {
+	if err := rm.checkNotMonitoring(session); err != nil {
+		return nil, err
+	}
+	done, ok := rm.streams.start()
+	if !ok {
+		return nil, fmt.Errorf("server shutting down")
+	}
+
+	ps := &pubSub{
+		rconn:    rconn,
+		ctx:      source.WithRateLimiter(context.Background(), source.NewRateLimiter(rm.watchRate.get())),
+		channels: make(map[string][]*pubSubWatch),
+		patterns: make(map[string][]*pubSubWatch),
+		watches:  make(map[*itemBuf]*pubSubWatch),
+		ready:    make(chan *itemBuf, 16),
+		stop:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	session.pubsub = ps
+
+	rconn.SetIdleTimeout(0)
+	rm.sessionsLock.Lock()
+	session.monitoring = true
+	rm.sessionsLock.Unlock()
+
+	go func() {
+		defer rm.streams.stop()
+		defer close(ps.stopped)
+		ps.pump(done)
+	}()
+	return ps, nil
+}
+
+// stopPubSub ends subscribed mode, once nothing remains subscribed, or the
+// connection ends.
+func (rm *respModel) stopPubSub(rconn *resp.RedisConnection, session *respSession) {
+	ps := session.pubsub
+	if ps == nil {
+		return
+	}
+	session.pubsub = nil
+	close(ps.stop)
+	<-ps.stopped
+
+	rm.sessionsLock.Lock()
+	session.monitoring = false
+	rm.sessionsLock.Unlock()
+	rconn.SetIdleTimeout(time.Duration(atomic.LoadInt64(&rm.idleTimeout)))
+}
+
+// pump writes the items of every watched source as they become ready, until
+// stopped, or the server shuts down.
+func (ps *pubSub) pump(done <-chan struct{}) {
+	defer func() {
+		ps.Lock()
+		for buf := range ps.watches {
+			buf.Close()
+		}
+		ps.Unlock()
+	}()
+	for {
+		select {
+		case <-ps.stop:
+			return
+		case buf := <-ps.ready:
+			if err := ps.writeMessages(buf); err != nil {
+				return
+			}
+			if len(ps.ready) > 0 {
+				// more to write, flush once it's all written
+				continue
+			}
+			if err := ps.rconn.Flush(); err != nil {
+				return
+			}
+		case <-done:
+			// the server is shutting down, write out what's left then hang up
+			ps.Lock()
+			bufs := make([]*itemBuf, 0, len(ps.watches))
+			for buf := range ps.watches {
+				bufs = append(bufs, buf)
+			}
+			ps.Unlock()
+			for _, buf := range bufs {
+				if err := ps.writeMessages(buf); err != nil {
+					return
+				}
+			}
+			ps.rconn.Flush()
+			ps.rconn.Close()
+			return
+		}
+	}
+}
+
+// writeMessages writes any items drained from the buffer as "message", or
+// "pmessage", pushes.
+func (ps *pubSub) writeMessages(buf *itemBuf) error {
+	ps.Lock()
+	defer ps.Unlock()
+	psw, ok := ps.watches[buf]
+	if !ok {
+		return nil
+	}
+	for _, item := range buf.drain() {
+		if err := ps.writeMessage(psw, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ps *pubSub) writeMessage(psw *pubSubWatch, item []byte) error {
+	// json items are newline framed, which messages don't need
+	item = []byte(strings.TrimSuffix(string(item), "\n"))
+	if psw.pattern == "" {
+		if err := ps.rconn.WriteArrayHeader(3); err != nil {
+			return err
+		}
+		if err := ps.rconn.WriteBulkString("message"); err != nil {
+			return err
+		}
+	} else {
+		if err := ps.rconn.WriteArrayHeader(4); err != nil {
+			return err
+		}
+		if err := ps.rconn.WriteBulkString("pmessage"); err != nil {
+			return err
+		}
+		if err := ps.rconn.WriteBulkString(psw.pattern); err != nil {
+			return err
+		}
+	}
+	if err := ps.rconn.WriteBulkString(psw.name); err != nil {
+		return err
+	}
+	return ps.rconn.WriteBulkBytes(item)
+}
+
+// writeReply writes a subscription change reply, with the number of
+// subscriptions remaining; the lock must be held.
+func (ps *pubSub) writeReply(kind, name string, named bool) error {
+	return writePubSubReply(ps.rconn, kind, name, named, len(ps.channels)+len(ps.patterns))
+}
+
+// writePubSubReply writes a redis [kind, name, count] subscription reply; if
+// not named, the name is null.
+func writePubSubReply(rconn *resp.RedisConnection, kind, name string, named bool, count int) error {
+	if err := rconn.WriteArrayHeader(3); err != nil {
+		return err
+	}
+	if err := rconn.WriteBulkString(kind); err != nil {
+		return err
+	}
+	if named {
+		if err := rconn.WriteBulkString(name); err != nil {
+			return err
+		}
+	} else if err := rconn.WriteNull(); err != nil {
+		return err
+	}
+	return rconn.WriteInteger(count)
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package protocol
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/uber-go/gwr/source"
+)
+
+// rateHolder holds the limit on each connection's watches; it may be set
+// while requests are being served.
+type rateHolder struct {
+	val atomic.Value
+}
+
+func (rh *rateHolder) set(rl source.RateLimit) {
+	rh.val.Store(rl)
+}
+
+func (rh *rateHolder) get() source.RateLimit {
+	rl, _ := rh.val.Load().(source.RateLimit)
+	return rl
+}
+
+// SetWatchRate sets the limit on each request's watches, together; requests
+// may lower it with their "rate" and "byte_rate" parameters.  An unlimited
+// rate, the default, lets requests set their own.
+func (hndl *HTTPRest) SetWatchRate(rl source.RateLimit) {
+	hndl.watchRate.set(rl)
+}
+
+// SetWatchRate sets the limit on each connection's monitored watches,
+// together.  It applies to monitors started after it's called.
+func (rh *RedisHandler) SetWatchRate(rl source.RateLimit) {
+	rh.model.watchRate.set(rl)
+}
+
+// watchLimiter returns a limiter for the request's watches, from the handler's
+// limit lowered by any "rate" and "byte_rate" parameters.  If either is
+// invalid, a 400 response is written, and false returned.
+func (hndl *HTTPRest) watchLimiter(w http.ResponseWriter, r *http.Request) (*source.RateLimiter, bool) {
+	var lim source.RateLimit
+	for _, param := range []struct {
+		name string
+		val  *float64
+	}{
+		{"rate", &lim.Items},
+		{"byte_rate", &lim.Bytes},
+	} {
+		str := r.Form.Get(param.name)
+		if str == "" {
+			continue
+		}
+		val, err := strconv.ParseFloat(str, 64)
+		if err != nil || val <= 0 {
+			http.Error(w,
+				fmt.Sprintf("400 Bad Request\nInvalid %s %q, expected a positive number per second.", param.name, str),
+				http.StatusBadRequest)
+			return nil, false
+		}
+		*param.val = val
+	}
+	return source.NewRateLimiter(hndl.watchRate.get().Min(lim)), true
+}
@@ -22,12 +22,21 @@ package protocol
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/uber-go/gwr/internal/meta"
 	"github.com/uber-go/gwr/internal/resp"
 	"github.com/uber-go/gwr/source"
+
+	"github.com/golang/snappy"
 )
 
 // NewRedisServer creates a new redis server to provide access to a collection
@@ -37,33 +46,125 @@ func NewRedisServer(sources *source.DataSources) *resp.RedisServer {
 	return resp.NewRedisServer(handler)
 }
 
+// RedisHandler is a resp.RedisHandler providing access to a collection of gwr
+// data sources.
+type RedisHandler struct {
+	resp.CmdHandler
+	model *respModel
+}
+
 // NewRedisHandler creates a new redis handler for a given collection of gwr
 // data sources for use with the resp package.
-func NewRedisHandler(sources *source.DataSources) resp.RedisHandler {
-	model := respModel{
+func NewRedisHandler(sources *source.DataSources) *RedisHandler {
+	model := &respModel{
 		sources:  sources,
 		sessions: make(map[*resp.RedisConnection]*respSession, 1),
+		streams:  NewStreams(),
+	}
+	cmds := map[string]resp.CmdFunc{
+		"ls":           model.handleLs,
+		"get":          model.handleGet,
+		"watch":        model.handleWatch,
+		"unwatch":      model.handleUnwatch,
+		"watches":      model.handleWatches,
+		"setformat":    model.handleSetFormat,
+		"monitor":      model.handleMonitor,
+		"compress":     model.handleCompress,
+		"auth":         model.handleAuth,
+		"complete":     model.handleComplete,
+		"action":       model.handleAction,
+		"kill":         model.handleKill,
+		"ping":         model.handlePing,
+		"subscribe":    model.handleSubscribe,
+		"psubscribe":   model.handlePSubscribe,
+		"unsubscribe":  model.handleUnsubscribe,
+		"punsubscribe": model.handlePUnsubscribe,
+		"info":         model.handleInfo,
+		"command":      model.handleCommand,
+		"select":       model.handleSelect,
+		"__start__":    model.handleStart,
+		"__end__":      model.handleEnd,
+	}
+	model.setCommands(cmds)
+	return &RedisHandler{
+		CmdHandler: resp.CmdMapHandler(model.pubSubCommands(cmds)),
+		model:      model,
 	}
-	return resp.CmdMapHandler(map[string]resp.CmdFunc{
-		"ls":      model.handleLs,
-		"get":     model.handleGet,
-		"watch":   model.handleWatch,
-		"monitor": model.handleMonitor,
-		"__end__": model.handleEnd,
-	})
+}
+
+// Shutdown ends any active monitor streams, after writing any data already
+// received from their sources, and closes their connections; it waits for
+// them until the context is done.
+func (rh *RedisHandler) Shutdown(ctx context.Context) error {
+	return rh.model.streams.Shutdown(ctx)
+}
+
+// SetIdleTimeout sets how long a connection may go without sending a command
+// before it's closed; connections streaming a monitor are exempt.  Zero, the
+// default, disables the timeout.  It applies to connections opened after it's
+// called.
+func (rh *RedisHandler) SetIdleTimeout(timeout time.Duration) {
+	atomic.StoreInt64(&rh.model.idleTimeout, int64(timeout))
+}
+
+// respIdleThreshold is how long a connection must go without sending a
+// command to count as idle in RESPStats.
+const respIdleThreshold = time.Minute
+
+// Stats counts the handler's open, monitoring, idle, and reaped connections.
+func (rh *RedisHandler) Stats() meta.RESPStats {
+	return rh.model.stats()
+}
+
+func (rm *respModel) stats() meta.RESPStats {
+	now := time.Now()
+	stats := meta.RESPStats{
+		Reaped: atomic.LoadUint64(&rm.reaped),
+	}
+	rm.sessionsLock.Lock()
+	defer rm.sessionsLock.Unlock()
+	for rconn, session := range rm.sessions {
+		stats.Conns++
+		if session.monitoring {
+			stats.Monitors++
+			continue
+		}
+		idle := now.Sub(rconn.LastActive())
+		if idle >= respIdleThreshold {
+			stats.Idle++
+		}
+		if secs := idle.Seconds(); secs > stats.MaxIdle {
+			stats.MaxIdle = secs
+		}
+	}
+	return stats
 }
 
 type respModel struct {
-	sources  *source.DataSources
-	sessions map[*resp.RedisConnection]*respSession
+	sources     *source.DataSources
+	streams     *Streams
+	auth        authHolder
+	watchRate   rateHolder
+	idleTimeout int64
+	reaped      uint64
+	commands    []string
+
+	sessionsLock sync.Mutex
+	sessions     map[*resp.RedisConnection]*respSession
 }
 
 type respSession struct {
 	watches     map[string]string
+	compress    bool
+	token       string
+	monitoring  bool
 	stopMonitor chan struct{}
+	pubsub      *pubSub
 }
 
 func (rm *respModel) session(rconn *resp.RedisConnection) *respSession {
+	rm.sessionsLock.Lock()
+	defer rm.sessionsLock.Unlock()
 	if session, ok := rm.sessions[rconn]; ok {
 		return session
 	}
@@ -75,15 +176,84 @@ func (rm *respModel) session(rconn *resp.RedisConnection) *respSession {
 	return session
 }
 
+// handleStart registers every new connection's session, so that it's counted
+// by Stats, and sets its idle timeout.
+func (rm *respModel) handleStart(rconn *resp.RedisConnection, vc *resp.ValueConsumer) error {
+	rm.session(rconn)
+	rconn.SetIdleTimeout(time.Duration(atomic.LoadInt64(&rm.idleTimeout)))
+	return nil
+}
+
+// handleLs implements "ls [-l|-c] [path]".  With no arguments, it's an
+// alias for "get /meta/nouns".  Given a path, or pattern, it replies with an
+// array of the matching source names; "-c" replies with just their count, and
+// "-l" with the "ls -l" style text listing of /meta/nouns.  A plain path lists
+// everything under it.
 func (rm *respModel) handleLs(rconn *resp.RedisConnection, vc *resp.ValueConsumer) error {
-	// TODO: implement optional path argument
 	// TODO: maybe custom format
 
+	if vc.NumRemaining() == 0 {
+		if ok, err := rm.authorize(rconn, "get", meta.NounsName); !ok {
+			return err
+		}
+		return rm.doGet(rconn, rm.sources.Get(meta.NounsName), "text", nil)
+	}
+
+	path, err := rm.consumeLsPath(vc)
+	if err != nil {
+		return err
+	}
+
+	flag := ""
+	if path == "-l" || path == "-c" {
+		flag, path = path, "/"
+		if vc.NumRemaining() > 0 {
+			if path, err = rm.consumeLsPath(vc); err != nil {
+				return err
+			}
+		}
+	}
+
 	if vc.NumRemaining() > 0 {
 		return fmt.Errorf("too many arguments to ls")
 	}
 
-	return rm.doGet(rconn, rm.sources.Get("/meta/nouns"), "text")
+	if !source.IsPattern(path) {
+		path = strings.TrimSuffix(path, "/") + "/*"
+	}
+	if ok, err := rm.authorize(rconn, "get", meta.NounsName); !ok {
+		return err
+	}
+
+	switch flag {
+	case "-l":
+		return rm.doGet(rconn, meta.NewLongNounMatchDataSource(rm.sources, path), "text", nil)
+	case "-c":
+		return rconn.WriteInteger(len(rm.sources.Match(path)))
+	}
+
+	srcs := rm.sources.Match(path)
+	if err := rconn.WriteArrayHeader(len(srcs)); err != nil {
+		return err
+	}
+	for _, src := range srcs {
+		if err := rconn.WriteBulkString(src.Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rm *respModel) consumeLsPath(vc *resp.ValueConsumer) (string, error) {
+	pathRV, err := vc.Consume("path")
+	if err != nil {
+		return "", err
+	}
+	path, ok := pathRV.GetString()
+	if !ok {
+		return "", fmt.Errorf("path argument not a string")
+	}
+	return path, nil
 }
 
 func (rm *respModel) handleGet(rconn *resp.RedisConnection, vc *resp.ValueConsumer) error {
@@ -97,20 +267,66 @@ func (rm *respModel) handleGet(rconn *resp.RedisConnection, vc *resp.ValueConsum
 		return err
 	}
 
-	if vc.NumRemaining() > 0 {
-		return fmt.Errorf("too many arguments to get")
+	// any further arguments are "key value" parameter pairs
+	params, err := rm.consumeParams(vc)
+	if err != nil {
+		return err
 	}
 
-	return rm.doGet(rconn, source, format)
+	if ok, err := rm.authorize(rconn, "get", source.Name()); !ok {
+		return err
+	}
+	return rm.doGet(rconn, source, format, params)
+}
+
+// consumeParams consumes any remaining arguments as "key value" parameter
+// pairs.
+func (rm *respModel) consumeParams(vc *resp.ValueConsumer) (map[string]string, error) {
+	var params map[string]string
+	for vc.NumRemaining() > 0 {
+		if vc.NumRemaining() < 2 {
+			return nil, fmt.Errorf("parameters must be key value pairs")
+		}
+		keyRV, err := vc.Consume("key")
+		if err != nil {
+			return nil, err
+		}
+		valRV, err := vc.Consume("value")
+		if err != nil {
+			return nil, err
+		}
+		key, ok := keyRV.GetString()
+		if !ok {
+			return nil, fmt.Errorf("parameter key not a string")
+		}
+		val, ok := valRV.GetString()
+		if !ok {
+			return nil, fmt.Errorf("parameter value not a string")
+		}
+		if params == nil {
+			params = make(map[string]string, vc.NumRemaining()/2+1)
+		}
+		params[key] = val
+	}
+	return params, nil
 }
 
-func (rm *respModel) doGet(rconn *resp.RedisConnection, source source.DataSource, format string) error {
+func (rm *respModel) doGet(
+	rconn *resp.RedisConnection,
+	src source.DataSource,
+	format string,
+	params map[string]string,
+) error {
+	ctx, cancel := rm.streams.context(context.Background())
+	defer cancel()
 	var buf bytes.Buffer
-	if err := source.Get(format, &buf); err != nil {
+	if err := getParams(ctx, src, format, params, &buf); err == source.ErrGetNoContent || err == source.ErrGetNotFound {
+		return rconn.WriteNull()
+	} else if err != nil {
 		return err
 	}
 
-	switch format {
+	switch source.FormatName(format) {
 	case "text":
 		lines := strings.Split(buf.String(), "\n")
 		if i := len(lines) - 1; len(lines[i]) == 0 {
@@ -134,7 +350,7 @@ func (rm *respModel) doGet(rconn *resp.RedisConnection, source source.DataSource
 func (rm *respModel) handleWatch(rconn *resp.RedisConnection, vc *resp.ValueConsumer) error {
 	session := rm.session(rconn)
 
-	source, err := rm.consumeSource(rconn, vc)
+	srcs, err := rm.consumeSources(rconn, vc)
 	if err != nil {
 		return err
 	}
@@ -147,18 +363,316 @@ func (rm *respModel) handleWatch(rconn *resp.RedisConnection, vc *resp.ValueCons
 	if vc.NumRemaining() > 0 {
 		return fmt.Errorf("too many arguments to watch")
 	}
+	if err := rm.checkNotMonitoring(session); err != nil {
+		return rconn.WriteError(err)
+	}
 
-	name := source.Name()
-	session.watches[name] = format
+	if ok, err := rm.authorizeWatch(rconn, srcs); !ok {
+		return err
+	}
+	for _, src := range srcs {
+		session.watches[src.Name()] = format
+	}
 
 	return rconn.WriteSimpleString("OK")
 }
 
+// errMonitoring is replied to the watch management commands if the session
+// is already monitoring; its watches are fixed once the monitor starts.
+var errMonitoring = errors.New("watches may not be changed while monitoring")
+
+// checkNotMonitoring returns errMonitoring if the session has started a
+// monitor.
+func (rm *respModel) checkNotMonitoring(session *respSession) error {
+	rm.sessionsLock.Lock()
+	defer rm.sessionsLock.Unlock()
+	if session.monitoring {
+		return errMonitoring
+	}
+	return nil
+}
+
+// handleUnwatch implements "unwatch <name>", which removes the watches on the
+// named source, or on all sources matching a pattern, replying with how many
+// were removed.
+func (rm *respModel) handleUnwatch(rconn *resp.RedisConnection, vc *resp.ValueConsumer) error {
+	session := rm.session(rconn)
+
+	rv, err := vc.Consume("name")
+	if err != nil {
+		return err
+	}
+	name, ok := rv.GetString()
+	if !ok {
+		return fmt.Errorf("name argument not a string")
+	}
+	if vc.NumRemaining() > 0 {
+		return fmt.Errorf("too many arguments to unwatch")
+	}
+	if err := rm.checkNotMonitoring(session); err != nil {
+		return rconn.WriteError(err)
+	}
+
+	n := 0
+	if _, ok := session.watches[name]; ok {
+		delete(session.watches, name)
+		n++
+	} else if source.IsPattern(name) {
+		for _, src := range rm.sources.Match(name) {
+			if _, ok := session.watches[src.Name()]; ok {
+				delete(session.watches, src.Name())
+				n++
+			}
+		}
+	}
+	return rconn.WriteInteger(n)
+}
+
+// handleWatches implements "watches", which replies with the session's
+// watches, as an array of [name, format] pairs ordered by name.
+func (rm *respModel) handleWatches(rconn *resp.RedisConnection, vc *resp.ValueConsumer) error {
+	session := rm.session(rconn)
+	if vc.NumRemaining() > 0 {
+		return fmt.Errorf("too many arguments to watches")
+	}
+
+	names := make([]string, 0, len(session.watches))
+	for name := range session.watches {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if err := rconn.WriteArrayHeader(len(names)); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := rconn.WriteArrayHeader(2); err != nil {
+			return err
+		}
+		if err := rconn.WriteBulkString(name); err != nil {
+			return err
+		}
+		if err := rconn.WriteBulkString(session.watches[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleSetFormat implements "setformat <name> <format>", which changes the
+// format of an existing watch.
+func (rm *respModel) handleSetFormat(rconn *resp.RedisConnection, vc *resp.ValueConsumer) error {
+	session := rm.session(rconn)
+
+	src, err := rm.consumeSource(rconn, vc)
+	if err != nil {
+		return err
+	}
+	rv, err := vc.Consume("format")
+	if err != nil {
+		return err
+	}
+	format, ok := rv.GetString()
+	if !ok {
+		return fmt.Errorf("format argument not a string")
+	}
+	if vc.NumRemaining() > 0 {
+		return fmt.Errorf("too many arguments to setformat")
+	}
+	if err := rm.checkNotMonitoring(session); err != nil {
+		return rconn.WriteError(err)
+	}
+
+	if _, ok := session.watches[src.Name()]; !ok {
+		return rconn.WriteError(fmt.Errorf("not watching %s", src.Name()))
+	}
+	if !hasFormat(src, format) {
+		return rconn.WriteError(fmt.Errorf("%s does not support format %#v", src.Name(), format))
+	}
+	session.watches[src.Name()] = format
+	return rconn.WriteSimpleString("OK")
+}
+
+// hasFormat returns true if the source supports the named format.
+func hasFormat(src source.DataSource, format string) bool {
+	for _, name := range src.Formats() {
+		if strings.EqualFold(name, source.FormatName(format)) {
+			return true
+		}
+	}
+	return false
+}
+
+// handleCompress implements "compress [on|off]", which controls whether bulk
+// payloads in any subsequently started monitor stream are snappy compressed
+// (block format, one block per frame).  With no argument, the current setting
+// is returned.
+func (rm *respModel) handleCompress(rconn *resp.RedisConnection, vc *resp.ValueConsumer) error {
+	session := rm.session(rconn)
+
+	if vc.NumRemaining() == 0 {
+		if session.compress {
+			return rconn.WriteSimpleString("on")
+		}
+		return rconn.WriteSimpleString("off")
+	}
+
+	rv, err := vc.Consume("setting")
+	if err != nil {
+		return err
+	}
+	setting, ok := rv.GetString()
+	if !ok {
+		return fmt.Errorf("setting argument not a string")
+	}
+
+	if vc.NumRemaining() > 0 {
+		return fmt.Errorf("too many arguments to compress")
+	}
+
+	switch strings.ToLower(setting) {
+	case "on":
+		session.compress = true
+	case "off":
+		session.compress = false
+	default:
+		return fmt.Errorf("invalid compress setting %#v, expected on or off", setting)
+	}
+
+	return rconn.WriteSimpleString("OK")
+}
+
+// handleAuth implements "auth <token>", which sets the token presented for
+// the rest of the connection.
+func (rm *respModel) handleAuth(rconn *resp.RedisConnection, vc *resp.ValueConsumer) error {
+	rv, err := vc.Consume("token")
+	if err != nil {
+		return err
+	}
+	token, ok := rv.GetString()
+	if !ok {
+		return fmt.Errorf("token argument not a string")
+	}
+	if vc.NumRemaining() > 0 {
+		return fmt.Errorf("too many arguments to auth")
+	}
+	rm.session(rconn).token = token
+	return rconn.WriteSimpleString("OK")
+}
+
+// handleComplete replies with the source names completing a prefix, for tab
+// completion in clients; see source.DataSources.Complete.
+func (rm *respModel) handleComplete(rconn *resp.RedisConnection, vc *resp.ValueConsumer) error {
+	prefix := ""
+	if vc.NumRemaining() > 0 {
+		rv, err := vc.Consume("prefix")
+		if err != nil {
+			return err
+		}
+		str, ok := rv.GetString()
+		if !ok {
+			return fmt.Errorf("prefix argument not a string")
+		}
+		prefix = str
+	}
+	if vc.NumRemaining() > 0 {
+		return fmt.Errorf("too many arguments to complete")
+	}
+	if ok, err := rm.authorize(rconn, "get", meta.NounsName); !ok {
+		return err
+	}
+	names := rm.sources.Complete(prefix)
+	if err := rconn.WriteArrayHeader(len(names)); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := rconn.WriteBulkString(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// handleAction implements "action <name> <action> [key value ...]"; see
+// source.ActionDataSource.
+func (rm *respModel) handleAction(rconn *resp.RedisConnection, vc *resp.ValueConsumer) error {
+	src, err := rm.consumeSource(rconn, vc)
+	if err != nil {
+		return err
+	}
+	rv, err := vc.Consume("action")
+	if err != nil {
+		return err
+	}
+	name, ok := rv.GetString()
+	if !ok {
+		return fmt.Errorf("action argument not a string")
+	}
+	params, err := rm.consumeParams(vc)
+	if err != nil {
+		return err
+	}
+
+	if ok, err := rm.authorize(rconn, "action", src.Name()); !ok {
+		return err
+	}
+	// an action on another source, such as starting its recording, may
+	// export its items, so it must be watchable too
+	if target := params["source"]; target != "" {
+		if ok, err := rm.authorize(rconn, "watch", target); !ok {
+			return err
+		}
+	}
+	err = source.ErrUnknownAction
+	if asrc, ok := src.(source.ActionDataSource); ok {
+		err = asrc.Action(name, params)
+	}
+	if err != nil {
+		return rconn.WriteError(err)
+	}
+	return rconn.WriteSimpleString("OK")
+}
+
+// handleKill implements "kill <id>", an alias for "action /meta/watchers kill
+// id <id>", which ends the stream of an active watch.
+func (rm *respModel) handleKill(rconn *resp.RedisConnection, vc *resp.ValueConsumer) error {
+	rv, err := vc.Consume("id")
+	if err != nil {
+		return err
+	}
+	id, ok := rv.GetString()
+	if !ok {
+		return fmt.Errorf("id argument not a string")
+	}
+	if vc.NumRemaining() > 0 {
+		return fmt.Errorf("too many arguments to kill")
+	}
+	src := rm.sources.Get(meta.WatchersName)
+	asrc, ok := src.(source.ActionDataSource)
+	if !ok {
+		return fmt.Errorf("no %s source", meta.WatchersName)
+	}
+	if ok, err := rm.authorize(rconn, "action", src.Name()); !ok {
+		return err
+	}
+	if err := asrc.Action("kill", map[string]string{"id": id}); err != nil {
+		return rconn.WriteError(err)
+	}
+	return rconn.WriteSimpleString("OK")
+}
+
+func (rm *respModel) authorizeWatch(rconn *resp.RedisConnection, srcs []source.DataSource) (bool, error) {
+	names := make([]string, len(srcs))
+	for i, src := range srcs {
+		names[i] = src.Name()
+	}
+	return rm.authorize(rconn, "watch", names...)
+}
+
 func (rm *respModel) handleMonitor(rconn *resp.RedisConnection, vc *resp.ValueConsumer) error {
 	session := rm.session(rconn)
 
 	for vc.NumRemaining() > 0 {
-		source, err := rm.consumeSource(rconn, vc)
+		srcs, err := rm.consumeSources(rconn, vc)
 		if err != nil {
 			return err
 		}
@@ -168,25 +682,42 @@ func (rm *respModel) handleMonitor(rconn *resp.RedisConnection, vc *resp.ValueCo
 			return err
 		}
 
-		name := source.Name()
-		session.watches[name] = format
+		if ok, err := rm.authorizeWatch(rconn, srcs); !ok {
+			return err
+		}
+		for _, src := range srcs {
+			session.watches[src.Name()] = format
+		}
 	}
 
 	if len(session.watches) == 0 {
 		return fmt.Errorf("no watches set, monitor likely to be uninteresting")
 	}
 
-	go rm.doWatch(rconn)
+	done, ok := rm.streams.start()
+	if !ok {
+		return fmt.Errorf("server shutting down")
+	}
+
+	// a monitoring client sends no further commands, so isn't idle
+	rconn.SetIdleTimeout(0)
+	rm.sessionsLock.Lock()
+	session.monitoring = true
+	rm.sessionsLock.Unlock()
+
+	go func() {
+		defer rm.streams.stop()
+		rm.doWatch(rconn, session, done)
+	}()
 
 	return nil
 }
 
-func (rm *respModel) doWatch(rconn *resp.RedisConnection) error {
+func (rm *respModel) doWatch(rconn *resp.RedisConnection, session *respSession, done <-chan struct{}) error {
 	type bufInfoEntry struct {
 		name, format string
 	}
 
-	session := rm.session(rconn)
 	bufs := make([]*chanBuf, 0, len(session.watches))
 	itemBufs := make([]*itemBuf, 0, len(session.watches))
 	bufInfo := make(map[*chanBuf]bufInfoEntry, len(session.watches))
@@ -196,12 +727,30 @@ func (rm *respModel) doWatch(rconn *resp.RedisConnection) error {
 	defer func() {
 		for _, buf := range bufs {
 			buf.Close()
+			buf.watch.Remove()
 		}
 		for _, itemBuf := range itemBufs {
 			itemBuf.Close()
+			itemBuf.watch.Remove()
 		}
 	}()
 
+	// the watches share the connection's rate limit; the context is never
+	// done, since they're ended by closing their buffers
+	ctx := source.WithRateLimiter(context.Background(), source.NewRateLimiter(rm.watchRate.get()))
+
+	// killing any of the watches hangs up, ending the whole monitor
+	remoteAddr := rconn.Conn.RemoteAddr().String()
+	kill := func() { rconn.Close() }
+	addWatch := func(name, format string) *meta.ActiveWatch {
+		return meta.AddWatch(meta.Watch{
+			Source:     name,
+			Format:     format,
+			Protocol:   "resp",
+			RemoteAddr: remoteAddr,
+		}, kill)
+	}
+
 	for name, format := range session.watches {
 		src := rm.sources.Get(name)
 		if src == nil {
@@ -209,25 +758,28 @@ func (rm *respModel) doWatch(rconn *resp.RedisConnection) error {
 		}
 		if itemSource, ok := src.(source.ItemDataSource); ok {
 			itemBuf := newItemBuf(itemBufReady)
+			itemBuf.watch = addWatch(name, format)
 			itemBufs = append(itemBufs, itemBuf)
 			itemBufInfo[itemBuf] = bufInfoEntry{
 				name:   name,
-				format: strings.ToLower(format),
+				format: strings.ToLower(source.FormatName(format)),
 			}
-			itemSource.WatchItems(format, itemBuf)
+			watchItemsContext(ctx, itemSource, format, itemBuf)
 		} else {
 			buf := &chanBuf{ready: bufReady}
+			buf.watch = addWatch(name, format)
 			bufs = append(bufs, buf)
 			bufInfo[buf] = bufInfoEntry{
 				name:   name,
-				format: strings.ToLower(format),
+				format: strings.ToLower(source.FormatName(format)),
 			}
-			src.Watch(format, buf)
+			watchContext(ctx, src, format, buf)
 		}
 	}
 
-	var write func(*resp.RedisConnection, *chanBuf, string, string) error
-	var writeItems func(*resp.RedisConnection, *itemBuf, string, string) error
+	var write func(watchConn, *chanBuf, string, string) error
+	var writeItems func(watchConn, *itemBuf, string, string) error
+	wconn := watchConn{rconn, session.compress}
 
 	if len(session.watches) == 1 {
 		write = rm.writeSingleWatchData
@@ -243,24 +795,96 @@ func (rm *respModel) doWatch(rconn *resp.RedisConnection) error {
 			return nil
 		case buf := <-bufReady:
 			info := bufInfo[buf]
-			if err := write(rconn, buf, info.name, info.format); err != nil {
+			if err := write(wconn, buf, info.name, info.format); err != nil {
+				return err
+			}
+			if err := flushIdle(rconn, bufReady, itemBufReady); err != nil {
 				return err
 			}
 		case itemBuf := <-itemBufReady:
 			info := itemBufInfo[itemBuf]
-			if err := writeItems(rconn, itemBuf, info.name, info.format); err != nil {
+			if err := writeItems(wconn, itemBuf, info.name, info.format); err != nil {
 				return err
 			}
+			if err := flushIdle(rconn, bufReady, itemBufReady); err != nil {
+				return err
+			}
+		case <-done:
+			// the server is shutting down, write out what's left then hang up
+			for buf, info := range bufInfo {
+				buf.Lock()
+				n := buf.Len()
+				buf.Unlock()
+				if n == 0 {
+					continue
+				}
+				if err := write(wconn, buf, info.name, info.format); err != nil {
+					return err
+				}
+			}
+			for itemBuf, info := range itemBufInfo {
+				if err := writeItems(wconn, itemBuf, info.name, info.format); err != nil {
+					return err
+				}
+			}
+			rconn.Flush()
+			return rconn.Close()
 		}
 	}
 }
 
+// flushIdle flushes a watch stream's writes unless more of its buffers are
+// ready to be written, so that a burst of items is sent with one write.
+func flushIdle(rconn *resp.RedisConnection, bufReady chan *chanBuf, itemBufReady chan *itemBuf) error {
+	if len(bufReady) > 0 || len(itemBufReady) > 0 {
+		return nil
+	}
+	return rconn.Flush()
+}
+
+// watchConn wraps a RedisConnection for writing watch stream data, snappy
+// compressing any bulk payloads if the session has enabled compression.
+type watchConn struct {
+	*resp.RedisConnection
+	compress bool
+}
+
+// WriteBulkBytes writes a, possibly compressed, bulk string.
+func (wconn watchConn) WriteBulkBytes(buf []byte) error {
+	if wconn.compress {
+		buf = snappy.Encode(nil, buf)
+	}
+	return wconn.RedisConnection.WriteBulkBytes(buf)
+}
+
+// WriteBulkString writes a, possibly compressed, bulk string.
+func (wconn watchConn) WriteBulkString(str string) error {
+	if wconn.compress {
+		return wconn.WriteBulkBytes([]byte(str))
+	}
+	return wconn.RedisConnection.WriteBulkString(str)
+}
+
 type multiJSONMessage struct {
-	Name string           `json:"name"`
-	Data *json.RawMessage `json:"data"`
+	Name   string           `json:"name"`
+	Origin *source.Identity `json:"origin,omitempty"`
+	Data   *json.RawMessage `json:"data"`
+}
+
+// newMultiJSONMessage wraps a json item of the named source, with the
+// process's identity as its origin, if any.
+func newMultiJSONMessage(name string, data *[]byte) multiJSONMessage {
+	msg := multiJSONMessage{
+		Name: name,
+		Data: (*json.RawMessage)(data),
+	}
+	if id := source.ProcessIdentity(); !id.IsZero() {
+		msg.Origin = &id
+	}
+	return msg
 }
 
-func (rm *respModel) writeSingleWatchItem(rconn *resp.RedisConnection, itemBuf *itemBuf, name, format string) error {
+func (rm *respModel) writeSingleWatchItem(rconn watchConn, itemBuf *itemBuf, name, format string) error {
 	switch format {
 	case "text":
 		for _, line := range itemBuf.drain() {
@@ -280,7 +904,7 @@ func (rm *respModel) writeSingleWatchItem(rconn *resp.RedisConnection, itemBuf *
 	return nil
 }
 
-func (rm *respModel) writeMultiWatchItem(rconn *resp.RedisConnection, itemBuf *itemBuf, name, format string) error {
+func (rm *respModel) writeMultiWatchItem(rconn watchConn, itemBuf *itemBuf, name, format string) error {
 	switch format {
 	case "text":
 		for _, buf := range itemBuf.drain() {
@@ -293,10 +917,7 @@ func (rm *respModel) writeMultiWatchItem(rconn *resp.RedisConnection, itemBuf *i
 
 	case "json":
 		for _, buf := range itemBuf.drain() {
-			if buf, err := json.Marshal(multiJSONMessage{
-				Name: name,
-				Data: (*json.RawMessage)(&buf),
-			}); err != nil {
+			if buf, err := json.Marshal(newMultiJSONMessage(name, &buf)); err != nil {
 				return err
 			} else if err := rconn.WriteBulkBytes(buf); err != nil {
 				return err
@@ -321,7 +942,7 @@ func (rm *respModel) writeMultiWatchItem(rconn *resp.RedisConnection, itemBuf *i
 
 // TODO: can we re-use code b/w *WatchData and *WatchItems?
 
-func (rm *respModel) writeSingleWatchData(rconn *resp.RedisConnection, buf *chanBuf, name, format string) error {
+func (rm *respModel) writeSingleWatchData(rconn watchConn, buf *chanBuf, name, format string) error {
 	switch format {
 	case "text":
 		buf.Lock()
@@ -371,7 +992,7 @@ func (rm *respModel) writeSingleWatchData(rconn *resp.RedisConnection, buf *chan
 	return nil
 }
 
-func (rm *respModel) writeMultiWatchData(rconn *resp.RedisConnection, buf *chanBuf, name, format string) error {
+func (rm *respModel) writeMultiWatchData(rconn watchConn, buf *chanBuf, name, format string) error {
 	switch format {
 	case "text":
 		buf.Lock()
@@ -402,10 +1023,7 @@ func (rm *respModel) writeMultiWatchData(rconn *resp.RedisConnection, buf *chanB
 			}
 			if len(line) > 0 {
 				data := []byte(line)
-				if buf, err := json.Marshal(multiJSONMessage{
-					Name: name,
-					Data: (*json.RawMessage)(&data),
-				}); err != nil {
+				if buf, err := json.Marshal(newMultiJSONMessage(name, &data)); err != nil {
 					return err
 				} else if err := rconn.WriteBulkBytes(buf); err != nil {
 					return err
@@ -435,14 +1053,20 @@ func (rm *respModel) writeMultiWatchData(rconn *resp.RedisConnection, buf *chanB
 }
 
 func (rm *respModel) handleEnd(rconn *resp.RedisConnection, vc *resp.ValueConsumer) error {
+	if rconn.TimedOut() {
+		atomic.AddUint64(&rm.reaped, 1)
+	}
+
+	rm.sessionsLock.Lock()
 	session, ok := rm.sessions[rconn]
+	delete(rm.sessions, rconn)
+	rm.sessionsLock.Unlock()
 	if !ok {
 		return nil
 	}
 
 	session.stopMonitor <- struct{}{}
-
-	delete(rm.sessions, rconn)
+	rm.stopPubSub(rconn, session)
 	return nil
 }
 
@@ -462,6 +1086,29 @@ func (rm *respModel) consumeSource(rconn *resp.RedisConnection, vc *resp.ValueCo
 	return source, nil
 }
 
+// consumeSources consumes a name argument like consumeSource, but also
+// accepts a pattern matching one or more sources; see
+// source.DataSources.Match.
+func (rm *respModel) consumeSources(rconn *resp.RedisConnection, vc *resp.ValueConsumer) ([]source.DataSource, error) {
+	nameRV, err := vc.Consume("name")
+	if err != nil {
+		return nil, err
+	}
+	name, ok := nameRV.GetString()
+	if !ok {
+		return nil, fmt.Errorf("name argument not a string")
+	}
+	if src := rm.sources.Get(name); src != nil {
+		return []source.DataSource{src}, nil
+	}
+	if source.IsPattern(name) {
+		if srcs := rm.sources.Match(name); len(srcs) > 0 {
+			return srcs, nil
+		}
+	}
+	return nil, fmt.Errorf("no such data source")
+}
+
 func (rm *respModel) consumeFormat(rconn *resp.RedisConnection, vc *resp.ValueConsumer) (string, error) {
 	if vc.NumRemaining() == 0 {
 		return "text", nil // XXX default
@@ -0,0 +1,159 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package protocol
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/uber-go/gwr/internal/resp"
+)
+
+// The commands in this file let off-the-shelf redis clients, which commonly
+// probe a server with them when they connect, work with gwr.
+
+// setCommands records the names of the handler's commands for "command".
+func (rm *respModel) setCommands(cmds map[string]resp.CmdFunc) {
+	rm.commands = make([]string, 0, len(cmds))
+	for name := range cmds {
+		if !strings.HasPrefix(name, "_") {
+			rm.commands = append(rm.commands, name)
+		}
+	}
+	sort.Strings(rm.commands)
+}
+
+// handleInfo implements "info [section]", replying with the server's stats in
+// redis' "key:value" INFO format; the "server", "clients", and "keyspace"
+// sections are available, all of them by default.
+func (rm *respModel) handleInfo(rconn *resp.RedisConnection, vc *resp.ValueConsumer) error {
+	section := ""
+	if vc.NumRemaining() > 0 {
+		rv, err := vc.Consume("section")
+		if err != nil {
+			return err
+		}
+		section, _ = rv.GetString()
+		section = strings.ToLower(section)
+	}
+	if vc.NumRemaining() > 0 {
+		return fmt.Errorf("too many arguments to info")
+	}
+	all := section == "" || section == "all" || section == "default" || section == "everything"
+
+	var buf bytes.Buffer
+	if all || section == "server" {
+		buf.WriteString("# Server\r\n")
+		buf.WriteString("redis_mode:standalone\r\n")
+		fmt.Fprintf(&buf, "process_id:%d\r\n", os.Getpid())
+		buf.WriteString("\r\n")
+	}
+	if all || section == "clients" {
+		stats := rm.stats()
+		fmt.Fprintf(&buf, "# Clients\r\n")
+		fmt.Fprintf(&buf, "connected_clients:%d\r\n", stats.Conns)
+		fmt.Fprintf(&buf, "monitoring_clients:%d\r\n", stats.Monitors)
+		fmt.Fprintf(&buf, "idle_clients:%d\r\n", stats.Idle)
+		fmt.Fprintf(&buf, "max_idle_seconds:%.1f\r\n", stats.MaxIdle)
+		fmt.Fprintf(&buf, "reaped_clients:%d\r\n", stats.Reaped)
+		buf.WriteString("\r\n")
+	}
+	if all || section == "keyspace" {
+		fmt.Fprintf(&buf, "# Keyspace\r\n")
+		fmt.Fprintf(&buf, "sources:%d\r\n", len(rm.sources.Match("/*")))
+		buf.WriteString("\r\n")
+	}
+	return rconn.WriteBulkBytes(buf.Bytes())
+}
+
+// handleCommand implements "command", replying with a redis style entry for
+// each command: its name, an arity of -1 (variadic), and no flags or keys;
+// "command count" replies with how many there are.  Other subcommands, such as
+// "command docs", reply with an empty array.
+func (rm *respModel) handleCommand(rconn *resp.RedisConnection, vc *resp.ValueConsumer) error {
+	sub := ""
+	if vc.NumRemaining() > 0 {
+		rv, err := vc.Consume("subcommand")
+		if err != nil {
+			return err
+		}
+		sub, _ = rv.GetString()
+		sub = strings.ToLower(sub)
+	}
+	for vc.NumRemaining() > 0 {
+		if _, err := vc.Consume("argument"); err != nil {
+			return err
+		}
+	}
+
+	switch sub {
+	case "":
+	case "count":
+		return rconn.WriteInteger(len(rm.commands))
+	default:
+		return rconn.WriteArrayHeader(0)
+	}
+
+	if err := rconn.WriteArrayHeader(len(rm.commands)); err != nil {
+		return err
+	}
+	for _, name := range rm.commands {
+		if err := rconn.WriteArrayHeader(6); err != nil {
+			return err
+		}
+		if err := rconn.WriteBulkString(name); err != nil {
+			return err
+		}
+		if err := rconn.WriteInteger(-1); err != nil {
+			return err
+		}
+		if err := rconn.WriteArrayHeader(0); err != nil {
+			return err
+		}
+		for i := 0; i < 3; i++ {
+			if err := rconn.WriteInteger(0); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// handleSelect implements "select <index>" as a no-op, since gwr has but one
+// database; any non-negative index is accepted.
+func (rm *respModel) handleSelect(rconn *resp.RedisConnection, vc *resp.ValueConsumer) error {
+	if vc.NumRemaining() != 1 {
+		return fmt.Errorf("wrong number of arguments for select")
+	}
+	rv, err := vc.Consume("index")
+	if err != nil {
+		return err
+	}
+	str, _ := rv.GetString()
+	if n, err := strconv.Atoi(str); err != nil || n < 0 {
+		return rconn.WriteError(fmt.Errorf("invalid DB index"))
+	}
+	return rconn.WriteSimpleString("OK")
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package protocol
+
+import (
+	"container/list"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+
+	"github.com/uber-go/gwr/internal/diff"
+	"github.com/uber-go/gwr/source"
+)
+
+// maxSnapshots bounds how many diff baselines are remembered; the least
+// recently used are forgotten first.
+const maxSnapshots = 256
+
+// snapshots remembers the Get results that "diff=prev" gets are answered
+// against.  Each baseline belongs to one client, which names it by echoing
+// back the token returned with its last diff, so that clients don't see each
+// other's changes.
+type snapshots struct {
+	sync.Mutex
+	byToken map[string]*list.Element
+	lru     list.List
+}
+
+type snapshot struct {
+	token  string
+	name   string
+	format string
+	data   []byte
+}
+
+// swap records cur as the baseline named by token, returning the previous
+// one, if any, and the token naming the baseline from then on.  An unknown
+// token, or one naming a baseline of another source or format, starts a new
+// baseline.
+func (snaps *snapshots) swap(token, name, format string, cur []byte) ([]byte, string) {
+	snaps.Lock()
+	defer snaps.Unlock()
+	if snaps.byToken == nil {
+		snaps.byToken = make(map[string]*list.Element)
+	}
+	if el, ok := snaps.byToken[token]; ok {
+		if snap := el.Value.(*snapshot); snap.name == name && snap.format == format {
+			prev := snap.data
+			snap.data = cur
+			snaps.lru.MoveToFront(el)
+			return prev, token
+		}
+	}
+	snap := &snapshot{newSnapshotToken(), name, format, cur}
+	snaps.byToken[snap.token] = snaps.lru.PushFront(snap)
+	for snaps.lru.Len() > maxSnapshots {
+		el := snaps.lru.Back()
+		snaps.lru.Remove(el)
+		delete(snaps.byToken, el.Value.(*snapshot).token)
+	}
+	return nil, snap.token
+}
+
+// len returns how many baselines are remembered.
+func (snaps *snapshots) len() int {
+	snaps.Lock()
+	defer snaps.Unlock()
+	return snaps.lru.Len()
+}
+
+func newSnapshotToken() string {
+	var buf [8]byte
+	rand.Read(buf[:])
+	return hex.EncodeToString(buf[:])
+}
+
+// renderDiff returns a json-patch for the json format, and a unified text diff
+// for any other, along with the content type of the result.
+func renderDiff(name, format string, prev, cur []byte) ([]byte, string, error) {
+	if source.FormatName(format) == "json" {
+		ops, err := diff.JSONPatch(prev, cur)
+		if err != nil {
+			return nil, "", err
+		}
+		buf, err := json.Marshal(ops)
+		if err != nil {
+			return nil, "", err
+		}
+		return append(buf, '\n'), "application/json-patch+json", nil
+	}
+	return diff.Unified(name+"\tprevious", name+"\tcurrent", prev, cur), "text/x-diff", nil
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package protocol
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// wantsSSE returns true if a watch should be streamed as server-sent events,
+// either because "sse=1" was passed, or because the client (e.g. a browser's
+// EventSource) accepts only "text/event-stream".
+func wantsSSE(r *http.Request) bool {
+	if r.Form.Get("sse") != "" {
+		return true
+	}
+	return strings.HasPrefix(r.Header.Get("Accept"), "text/event-stream")
+}
+
+// sseWriter reframes a line-delimited watch stream as server-sent events, one
+// event per line; any partial line is held until its newline is written.
+type sseWriter struct {
+	w       io.Writer
+	partial []byte
+	out     bytes.Buffer
+}
+
+func (sw *sseWriter) Write(p []byte) (int, error) {
+	sw.out.Reset()
+	buf := p
+	for {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			break
+		}
+		sw.out.WriteString("data: ")
+		if len(sw.partial) > 0 {
+			sw.out.Write(sw.partial)
+			sw.partial = sw.partial[:0]
+		}
+		sw.out.Write(bytes.TrimSuffix(buf[:i], []byte{'\r'}))
+		sw.out.WriteString("\n\n")
+		buf = buf[i+1:]
+	}
+	sw.partial = append(sw.partial, buf...)
+	if sw.out.Len() == 0 {
+		return len(p), nil
+	}
+	if _, err := sw.w.Write(sw.out.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
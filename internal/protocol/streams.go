@@ -0,0 +1,120 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package protocol
+
+import (
+	"context"
+	"sync"
+)
+
+// Streams tracks a protocol handler's active watch streams, so that they may
+// all be ended when the server shuts down.
+type Streams struct {
+	sync.Mutex
+	closing bool
+	done    chan struct{}
+	active  sync.WaitGroup
+
+	// finished is closed once the streams active when Shutdown started
+	// have all ended
+	finished chan struct{}
+}
+
+// NewStreams creates a new, empty, Streams.
+func NewStreams() *Streams {
+	return &Streams{
+		done: make(chan struct{}),
+	}
+}
+
+// start registers a new stream; the returned channel is closed when the
+// stream should end.  If the streams are being shut down, ok is false, and
+// the caller shouldn't start streaming.  Every successful start must be
+// paired with a call to stop.
+func (ss *Streams) start() (done <-chan struct{}, ok bool) {
+	ss.Lock()
+	defer ss.Unlock()
+	if ss.closing {
+		return nil, false
+	}
+	ss.active.Add(1)
+	return ss.done, true
+}
+
+// context returns a context of parent that's also done once the streams are
+// shut down, for long running requests that aren't streams, like a get that
+// runs a cpu profile.
+func (ss *Streams) context(parent context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	ss.Lock()
+	done, closing := ss.done, ss.closing
+	ss.Unlock()
+	if closing {
+		cancel()
+		return ctx, cancel
+	}
+	go func() {
+		select {
+		case <-done:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// stop marks a stream started by start as finished.
+func (ss *Streams) stop() {
+	ss.active.Done()
+}
+
+// Shutdown signals all active streams to end, and then waits for them to do
+// so, or for the context to be done, whichever comes first.  No new streams
+// may start until all of the active ones have ended, even if Shutdown stops
+// waiting for them first; new streams are allowed again after that.
+func (ss *Streams) Shutdown(ctx context.Context) error {
+	ss.Lock()
+	if !ss.closing {
+		ss.closing = true
+		close(ss.done)
+		finished := make(chan struct{})
+		ss.finished = finished
+		go func() {
+			ss.active.Wait()
+			// reopened under the lock only once Wait has returned, so that
+			// start's Add never races with it
+			ss.Lock()
+			ss.closing = false
+			ss.done = make(chan struct{})
+			ss.Unlock()
+			close(finished)
+		}()
+	}
+	finished := ss.finished
+	ss.Unlock()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,200 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package protocol
+
+import (
+	"io"
+	"net/http"
+	"strings"
+)
+
+// uiPath is where the web UI is served, relative to the HTTPRest prefix.
+const uiPath = "/ui/"
+
+// serveUI serves the embedded web UI page, redirecting "/ui" to "/ui/" so that
+// relative urls resolve against the prefix.  The page itself carries no data;
+// it requests everything through the usual source endpoints, relative to its
+// own location, so each of those requests is authorized as usual.
+func (hndl *HTTPRest) serveUI(w http.ResponseWriter, r *http.Request, path string) {
+	if path != uiPath {
+		http.Redirect(w, r, hndl.prefix+uiPath, http.StatusMovedPermanently)
+		return
+	}
+	switch strings.ToLower(r.Method) {
+	case "get", "head":
+	default:
+		w.Header().Set("Allow", "GET, HEAD")
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		io.WriteString(w, "405 Invalid Method\n")
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	io.WriteString(w, uiPage)
+}
+
+const uiPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>gwr</title>
+<style>
+body { font-family: sans-serif; margin: 0; display: flex; height: 100vh; }
+#nouns { width: 20em; overflow: auto; border-right: 1px solid #ccc; padding: 0.5em; }
+#nouns a { display: block; font-family: monospace; padding: 0.1em 0; cursor: pointer; }
+#nouns a.current { font-weight: bold; }
+#main { flex: 1; overflow: auto; padding: 0.5em; }
+#data table.object { border-collapse: collapse; }
+#data th, #data td { border: 1px solid #ddd; padding: 0.1em 0.4em; text-align: left; vertical-align: top; }
+#data th { font-weight: normal; color: #555; }
+#data ol.array { margin: 0; padding-left: 2em; }
+#data .number, #data .bool, #data .null { font-family: monospace; }
+#data pre, #data .item { margin: 0 0 0.3em 0; }
+#status { color: #888; }
+</style>
+</head>
+<body>
+<div id="nouns"><button id="refresh">refresh</button></div>
+<div id="main">
+<h3 id="name"></h3>
+<button id="get" disabled>get</button>
+<button id="watch" disabled>watch</button>
+<span id="status"></span>
+<div id="data"></div>
+</div>
+<script>
+(function() {
+  "use strict";
+  var base = "..";
+  var current = null;
+  var stream = null;
+  var $ = function(id) { return document.getElementById(id); };
+
+  function status(msg) { $("status").textContent = msg; }
+
+  function stop() {
+    if (stream) {
+      stream.close();
+      stream = null;
+    }
+    $("watch").textContent = "watch";
+  }
+
+  function url(name, params) {
+    return base + name.split("/").map(encodeURIComponent).join("/") + "?" + params;
+  }
+
+  function format(noun) {
+    return noun.formats.indexOf("html") >= 0 ? "html" : "text";
+  }
+
+  // show adds a chunk of data; html fragments are escaped by the server,
+  // anything else is shown as plain text.
+  function show(fmt, data, append) {
+    var el = document.createElement(fmt === "html" ? "div" : "pre");
+    if (fmt === "html") {
+      el.className = "item";
+      el.innerHTML = data;
+    } else {
+      el.textContent = data;
+    }
+    if (!append) {
+      $("data").innerHTML = "";
+    }
+    $("data").appendChild(el);
+  }
+
+  function get() {
+    stop();
+    var fmt = format(current);
+    status("getting...");
+    fetch(url(current.name, "format=" + fmt)).then(function(resp) {
+      return resp.text().then(function(body) {
+        status(resp.ok ? "" : resp.status + " " + resp.statusText);
+        show(fmt, body, false);
+      });
+    }, function(err) { status(String(err)); });
+  }
+
+  function watch() {
+    if (stream) {
+      stop();
+      status("stopped");
+      return;
+    }
+    var fmt = format(current);
+    $("data").innerHTML = "";
+    stream = new EventSource(url(current.name, "watch=1&sse=1&format=" + fmt));
+    stream.onopen = function() { status("watching"); };
+    stream.onmessage = function(ev) { show(fmt, ev.data, true); };
+    stream.onerror = function() {
+      status("watch failed");
+      stop();
+    };
+    $("watch").textContent = "stop";
+  }
+
+  function select(noun, link) {
+    stop();
+    current = noun;
+    var links = $("nouns").getElementsByTagName("a");
+    for (var i = 0; i < links.length; i++) {
+      links[i].className = "";
+    }
+    link.className = "current";
+    $("name").textContent = noun.name;
+    $("get").disabled = false;
+    $("watch").disabled = false;
+    $("data").innerHTML = "";
+    status("");
+    get();
+  }
+
+  function load() {
+    fetch(base + "/meta/nouns?format=json").then(function(resp) {
+      return resp.json();
+    }).then(function(nouns) {
+      var list = $("nouns");
+      var links = list.getElementsByTagName("a");
+      while (links.length) {
+        list.removeChild(links[0]);
+      }
+      Object.keys(nouns).sort().forEach(function(name) {
+        var noun = nouns[name];
+        noun.name = name;
+        var link = document.createElement("a");
+        link.textContent = name;
+        link.onclick = function() { select(noun, link); };
+        list.appendChild(link);
+      });
+    }, function(err) { status(String(err)); });
+  }
+
+  $("refresh").onclick = load;
+  $("get").onclick = get;
+  $("watch").onclick = watch;
+  load();
+})();
+</script>
+</body>
+</html>
+`
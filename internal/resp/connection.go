@@ -22,16 +22,40 @@ package resp
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"net"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
-// RedisConnection is the protocol reading and writing layer
+// ErrIdleTimeout is returned to a connection's client, before it's closed,
+// when no command was read within its idle timeout; see
+// RedisConnection.SetIdleTimeout.
+var ErrIdleTimeout = errors.New("idle timeout")
+
+// RedisConnection is the protocol reading and writing layer.
+//
+// Writes are buffered: replies to commands are flushed once every command
+// already received has been handled, so that a pipelined batch of commands
+// is answered with one write; anything written outside of a command, such as
+// a watch stream, must be followed by a call to Flush.
 type RedisConnection struct {
 	Conn   net.Conn
 	reader *bufio.Reader
-	// TODO: use a bufio.Writer too
+
+	// wlock serializes use of writer, since watch streams write from their
+	// own goroutines
+	wlock  sync.Mutex
+	writer *bufio.Writer
+
+	// lastActive and idleTimeout are nanoseconds, kept atomically since
+	// they're read and set outside of the handling goroutine
+	lastActive  int64
+	idleTimeout int64
+	timedOut    uint32
 }
 
 // NewRedisConnection creates a redis connection around an existing net.Conn
@@ -42,11 +66,38 @@ func NewRedisConnection(conn net.Conn, r io.Reader) *RedisConnection {
 		r = conn
 	}
 	return &RedisConnection{
-		Conn:   conn,
-		reader: bufio.NewReader(r),
+		Conn:       conn,
+		reader:     bufio.NewReader(r),
+		writer:     bufio.NewWriter(conn),
+		lastActive: time.Now().UnixNano(),
 	}
 }
 
+// SetIdleTimeout sets how long the connection may go without sending a
+// command before it's closed; zero, the default, disables the timeout.  It
+// takes effect from the next command read.
+func (rconn *RedisConnection) SetIdleTimeout(timeout time.Duration) {
+	atomic.StoreInt64(&rconn.idleTimeout, int64(timeout))
+}
+
+// LastActive returns when the connection last sent any data.
+func (rconn *RedisConnection) LastActive() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&rconn.lastActive))
+}
+
+// TimedOut returns true if the connection was closed because it exceeded its
+// idle timeout.
+func (rconn *RedisConnection) TimedOut() bool {
+	return atomic.LoadUint32(&rconn.timedOut) != 0
+}
+
+// Flush writes any buffered data to the underlying connection.
+func (rconn *RedisConnection) Flush() error {
+	rconn.wlock.Lock()
+	defer rconn.wlock.Unlock()
+	return rconn.writer.Flush()
+}
+
 // Close closes the underlying connection.
 func (rconn *RedisConnection) Close() error {
 	return rconn.Conn.Close()
@@ -68,24 +119,49 @@ func (rconn *RedisConnection) handle(handler RedisHandler) error {
 	}
 
 	for {
+		if err := rconn.setReadDeadline(); err != nil {
+			return err
+		}
 		err := rconn.Consume(handler)
 		if err != nil {
-			if err != io.EOF {
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+				atomic.StoreUint32(&rconn.timedOut, 1)
+				rconn.Conn.SetWriteDeadline(time.Now().Add(time.Second))
+				rconn.WriteError(ErrIdleTimeout)
+			} else if err != io.EOF {
 				rconn.WriteError(err)
 			}
+			rconn.Flush()
 			break
 		}
+
+		// only flush once caught up with any pipelined commands
+		if rconn.reader.Buffered() == 0 {
+			if err := rconn.Flush(); err != nil {
+				return err
+			}
+		}
 	}
 
 	return handler.HandleEnd(rconn)
 }
 
+// setReadDeadline bounds the wait for the next command by the idle timeout.
+func (rconn *RedisConnection) setReadDeadline() error {
+	var deadline time.Time
+	if timeout := atomic.LoadInt64(&rconn.idleTimeout); timeout > 0 {
+		deadline = time.Now().Add(time.Duration(timeout))
+	}
+	return rconn.Conn.SetReadDeadline(deadline)
+}
+
 // Consume reads one element from the connection and passes it to the given handler.
 func (rconn *RedisConnection) Consume(handler RedisHandler) error {
 	c, err := rconn.reader.ReadByte()
 	if err != nil {
 		return err
 	}
+	atomic.StoreInt64(&rconn.lastActive, time.Now().UnixNano())
 
 	switch c {
 	case '-':
@@ -295,15 +371,12 @@ func (rconn *RedisConnection) WriteBulkBytes(buf []byte) error {
 		return rconn.write([]byte("$0\r\n\r\n"))
 	}
 
-	if err := rconn.writef("$%v\r\n", n); err != nil {
-		return err
-	}
-
-	if _, err := rconn.Conn.Write(buf); err != nil {
-		return err
-	}
-
-	return rconn.write([]byte("\r\n"))
+	rconn.wlock.Lock()
+	defer rconn.wlock.Unlock()
+	fmt.Fprintf(rconn.writer, "$%v\r\n", n)
+	rconn.writer.Write(buf)
+	_, err := rconn.writer.WriteString("\r\n")
+	return err
 }
 
 // WriteBulkStringHeader writes a "$N\r\n" bulk string header.
@@ -342,16 +415,7 @@ func (rconn *RedisConnection) WriteError(err error) error {
 
 // WriteErrorBytes writes a "-...\r\n" error from a byte slice.
 func (rconn *RedisConnection) WriteErrorBytes(b []byte) error {
-	if _, err := rconn.Conn.Write([]byte("-")); err != nil {
-		return err
-	}
-	if _, err := rconn.Conn.Write(b); err != nil {
-		return err
-	}
-	if _, err := rconn.Conn.Write([]byte("\r\n")); err != nil {
-		return err
-	}
-	return nil
+	return rconn.writef("-%s\r\n", b)
 }
 
 // WriteErrorString writes a "-TYPE ...\r\n" error from a string type and body.
@@ -359,14 +423,18 @@ func (rconn *RedisConnection) WriteErrorString(errType, str string) error {
 	return rconn.writef("-%v %v\r\n", errType, str)
 }
 
+// writef and write buffer their output; a bufio.Writer keeps the first
+// error, returning it from every later write and Flush.
 func (rconn *RedisConnection) writef(format string, a ...interface{}) error {
-	_, err := fmt.Fprintf(rconn.Conn, format, a...)
+	rconn.wlock.Lock()
+	defer rconn.wlock.Unlock()
+	_, err := fmt.Fprintf(rconn.writer, format, a...)
 	return err
 }
 
 func (rconn *RedisConnection) write(buf []byte) error {
-	if _, err := rconn.Conn.Write(buf); err != nil {
-		return err
-	}
-	return nil
+	rconn.wlock.Lock()
+	defer rconn.wlock.Unlock()
+	_, err := rconn.writer.Write(buf)
+	return err
 }
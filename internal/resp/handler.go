@@ -182,6 +182,10 @@ type cmdMap map[string]CmdFunc
 func (cmds cmdMap) handleCommand(rconn *RedisConnection, cmdBuf []byte, vc *ValueConsumer) error {
 	cmd := string(cmdBuf)
 	cmdFunc, ok := cmds[cmd]
+	if !ok {
+		// redis clients commonly send commands in upper case
+		cmdFunc, ok = cmds[strings.ToLower(cmd)]
+	}
 	if !ok && !strings.HasPrefix(cmd, "_") {
 		return rconn.WriteError(fmt.Errorf("unimplemented command %#v", cmd))
 	}
@@ -0,0 +1,111 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package gwr
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// listenFDsStart is the first file descriptor passed by systemd socket
+// activation.
+const listenFDsStart = 3
+
+var errNoListenFDs = errors.New("no file descriptors passed by systemd")
+
+// listen creates a listener for a configured listen address, which may be:
+// - "unix:///path/to.sock" (or "unix:path") for a unix domain socket
+// - "fd://N" for an inherited listening file descriptor
+// - "systemd:" for the first socket passed by systemd socket activation, or
+//   "systemd:name" for the one named by the FileDescriptorName= option
+// - otherwise a TCP host:port
+func listen(laddr string) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(laddr, "unix:"):
+		path := strings.TrimPrefix(strings.TrimPrefix(laddr, "unix:"), "//")
+		removeStaleSocket(path)
+		return net.Listen("unix", path)
+
+	case strings.HasPrefix(laddr, "fd://"):
+		fd, err := strconv.Atoi(strings.TrimPrefix(laddr, "fd://"))
+		if err != nil || fd < 0 {
+			return nil, fmt.Errorf("invalid gwr listen file descriptor %q", laddr)
+		}
+		return fileListener(fd, laddr)
+
+	case strings.HasPrefix(laddr, "systemd:"):
+		fd, err := systemdFD(strings.TrimPrefix(laddr, "systemd:"))
+		if err != nil {
+			return nil, err
+		}
+		return fileListener(fd, laddr)
+	}
+	return net.Listen("tcp", laddr)
+}
+
+func fileListener(fd int, name string) (net.Listener, error) {
+	f := os.NewFile(uintptr(fd), name)
+	if f == nil {
+		return nil, fmt.Errorf("invalid gwr listen file descriptor %q", name)
+	}
+	// FileListener dups the descriptor, so the original is closed either way
+	defer f.Close()
+	return net.FileListener(f)
+}
+
+// systemdFD returns the socket activation file descriptor with the given
+// name, or the first one if name is empty; see sd_listen_fds(3).
+func systemdFD(name string) (int, error) {
+	if pid := os.Getenv("LISTEN_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, errNoListenFDs
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n < 1 {
+		return 0, errNoListenFDs
+	}
+	if name == "" {
+		return listenFDsStart, nil
+	}
+	for i, fdName := range strings.Split(os.Getenv("LISTEN_FDNAMES"), ":") {
+		if fdName == name && i < n {
+			return listenFDsStart + i, nil
+		}
+	}
+	return 0, fmt.Errorf("no systemd file descriptor named %q", name)
+}
+
+// removeStaleSocket removes a unix socket left behind by a previous process,
+// so that listening on it again doesn't fail; live sockets are left alone.
+func removeStaleSocket(path string) {
+	fi, err := os.Stat(path)
+	if err != nil || fi.Mode()&os.ModeSocket == 0 {
+		return
+	}
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return
+	}
+	os.Remove(path)
+}
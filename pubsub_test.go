@@ -0,0 +1,71 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// +build !gwr_noop
+
+package gwr_test
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/uber-go/gwr"
+	"github.com/uber-go/gwr/source/tap"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfiguredServer_respPubSub(t *testing.T) {
+	os.Unsetenv("GWR_LISTEN")
+	os.Unsetenv("GWR_AUTH_TOKEN")
+	srv := gwr.NewConfiguredServer(gwr.Config{ListenAddr: "127.0.0.1:0"})
+	require.NoError(t, srv.Start(), "no start error")
+	defer srv.Stop()
+	em := tap.AddEmitter("pubsub_test", nil)
+	defer gwr.DefaultDataSources.Remove(em.Name())
+	cmd, closeConn := respClient(t, srv.Addr().String())
+	defer closeConn()
+
+	waitActive := func() {
+		for i := 0; i < 100 && !em.Active(); i++ {
+			time.Sleep(time.Millisecond)
+		}
+		require.True(t, em.Active(), "emitter watched")
+	}
+
+	assert.Equal(t, []string{"+PONG"}, cmd("PING"))
+	assert.Equal(t, []string{"subscribe", "/tap/pubsub_test", ":1"}, cmd("SUBSCRIBE", "/tap/pubsub_test"))
+	waitActive()
+	em.Emit(map[string]int{"n": 1})
+	assert.Equal(t, []string{"message", "/tap/pubsub_test", `{"n":1}`}, cmd())
+
+	assert.Equal(t, []string{"psubscribe", "/tap/pubsub_*", ":2"}, cmd("PSUBSCRIBE", "/tap/pubsub_*"))
+	assert.Contains(t, cmd("ls")[0], "not allowed", "only pub/sub commands while subscribed")
+	assert.Equal(t, []string{"pong", ""}, cmd("PING"))
+	assert.Equal(t, []string{"unsubscribe", "/tap/pubsub_test", ":1"}, cmd("UNSUBSCRIBE"))
+	waitActive()
+	em.Emit(map[string]int{"n": 2})
+	assert.Equal(t, []string{"pmessage", "/tap/pubsub_*", "/tap/pubsub_test", `{"n":2}`}, cmd())
+
+	assert.Equal(t, []string{"punsubscribe", "/tap/pubsub_*", ":0"}, cmd("PUNSUBSCRIBE", "/tap/pubsub_*"))
+	assert.Equal(t, []string{"/tap/pubsub_test"}, cmd("ls", "/tap/pubsub_*"), "commands allowed once unsubscribed")
+}
@@ -21,7 +21,10 @@
 package report
 
 import (
+	"context"
 	"errors"
+	"sync"
+	"sync/atomic"
 
 	"github.com/uber-go/gwr/source"
 )
@@ -32,6 +35,9 @@ var errRawSource = errors.New("raw sources unsupported, only item data sources")
 // FormattedReporter reports observed items from a data source to a formatting
 // function.  Only works with sources that support the "text" format.
 //
+// Start and Stop are safe to call concurrently with each other, and with items
+// being reported; a stopped reporter may be started again.
+//
 // For example to send a source to stdandard output:
 //     rep := NewPrintfReporter(someSource, fmt.Printf)
 //     if err := rep.Start(); err != nil {
@@ -45,11 +51,37 @@ type FormattedReporter interface {
 	Stop()
 }
 
-// logfReporter is a FormattedReporter that targets a log formatting function.
-type logfReporter struct {
-	src     source.DataSource
-	logf    func(format string, args ...interface{})
-	stopped bool
+// addConsumer registers a started reporter of the given kind as a consumer of
+// its source, for the "/meta/graph" source.
+func addConsumer(kind string, src source.DataSource) func() {
+	return source.AddConsumer(source.Consumer{
+		Kind:   "reporter",
+		Name:   kind,
+		Inputs: []string{src.Name()},
+	})
+}
+
+// funcReporter is a FormattedReporter that outputs items to a function, such
+// as a logging or printing function.
+type funcReporter struct {
+	kind   string
+	src    source.DataSource
+	output func(name string, items [][]byte) error
+
+	lock     sync.Mutex
+	run      *reporterRun
+	consumer func()
+}
+
+// reporterRun is one run of a funcReporter, from a Start until its Stop; it's
+// what watches the source, so that once stopped it's never called again, even
+// by a watch that the source hasn't yet dropped, and so that a later Start
+// can't be reported to twice.
+type reporterRun struct {
+	name    string
+	output  func(name string, items [][]byte) error
+	stopped int32
+	cancel  context.CancelFunc
 }
 
 // NewLogfReporter creates a FormattedReporter around a log formatting
@@ -60,134 +92,141 @@ func NewLogfReporter(
 	src source.DataSource,
 	logf func(format string, args ...interface{}),
 ) FormattedReporter {
-	return &logfReporter{
+	return &funcReporter{
+		kind: "logf",
+		src:  src,
+		output: func(name string, items [][]byte) error {
+			for _, item := range items {
+				logf("%s: %s", name, item)
+			}
+			return nil
+		},
+	}
+}
+
+// NewPrintfReporter creates a new FormattedReporter around a raw
+// fmt.Printf-family formatting function.  The formatting function is expected
+// to return a number and error in package fmt style.  NewPrintfReporter will
+// append a newline to passed format strings, since the print formatting
+// function is expected to not do so.  Any error returned by the formatting
+// function stops the reporter, until it's started again.
+func NewPrintfReporter(
+	src source.DataSource,
+	printf func(format string, args ...interface{}) (int, error),
+) FormattedReporter {
+	return &funcReporter{
+		kind: "printf",
 		src:  src,
-		logf: logf,
+		output: func(name string, items [][]byte) error {
+			for _, item := range items {
+				if _, err := printf("%s: %s\n", name, item); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
 	}
 }
 
 // Source returns the target source.
-func (rep *logfReporter) Source() source.DataSource {
+func (rep *funcReporter) Source() source.DataSource {
 	return rep.src
 }
 
-// Start clears any stop flag, and starts watching the data source.
-func (rep *logfReporter) Start() error {
+// Start starts watching the data source, unless already started; it may be
+// called again after Stop, or after an output error, to resume reporting.
+func (rep *funcReporter) Start() error {
+	isrc, ok := rep.src.(source.ItemDataSource)
+	if !ok {
+		return errRawSource
+	}
+
+	rep.lock.Lock()
+	defer rep.lock.Unlock()
+	if rep.run != nil && !rep.run.isStopped() {
+		return nil
+	}
+	run := &reporterRun{
+		name:   rep.src.Name(),
+		output: rep.output,
+	}
 	var err error
-	rep.stopped = false
-	if isrc, ok := rep.src.(source.ItemDataSource); ok {
-		err = isrc.WatchItems("text", rep)
+	if csrc, ok := isrc.(source.ContextItemDataSource); ok {
+		var ctx context.Context
+		ctx, run.cancel = context.WithCancel(context.Background())
+		err = csrc.WatchItemsContext(ctx, "text", run)
 	} else {
-		err = errRawSource
+		err = isrc.WatchItems("text", run)
 	}
 	if err != nil {
-		rep.stopped = true
+		run.stop()
+		return err
 	}
-	return err
-}
-
-// Stop sets a flag internally so that the next HandleItem(s) will return an
-// error, removing the watcher resource.
-func (rep *logfReporter) Stop() {
-	rep.stopped = true
-}
-
-// HandleItem outputs the item to the logging function with a source-name
-// prefix.
-func (rep *logfReporter) HandleItem(item []byte) error {
-	if rep.stopped {
-		return errReporterClosed
+	rep.run = run
+	if rep.consumer == nil {
+		rep.consumer = addConsumer(rep.kind, rep.src)
 	}
-	rep.logf("%s: %s", rep.src.Name(), item)
 	return nil
 }
 
-// HandleItems outputs all items to the logging function with a source-name
-// prefix on each item.
-func (rep *logfReporter) HandleItems(items [][]byte) error {
-	if rep.stopped {
-		return errReporterClosed
+// Stop stops reporting: the source's watch is dropped right away if the source
+// supports context-scoped watches, and otherwise by the error returned when
+// it next calls the reporter.  Stop may be called concurrently with items
+// being reported, and with Start.
+func (rep *funcReporter) Stop() {
+	rep.lock.Lock()
+	defer rep.lock.Unlock()
+	if rep.run != nil {
+		rep.run.stop()
+		rep.run = nil
 	}
-	name := rep.src.Name()
-	for _, item := range items {
-		rep.logf("%s: %s", name, item)
+	if rep.consumer != nil {
+		rep.consumer()
+		rep.consumer = nil
 	}
-	return nil
 }
 
-// printfReporter is a FormattedReporter that targets a log formatting function.
-type printfReporter struct {
-	src     source.DataSource
-	printf  func(format string, args ...interface{}) (int, error)
-	stopped bool
+// HandleItem outputs the item with a source-name prefix, if started.
+func (rep *funcReporter) HandleItem(item []byte) error {
+	return rep.HandleItems([][]byte{item})
 }
 
-// NewPrintfReporter creates a new FormattedReporter around a raw
-// fmt.Printf-family formatting function.  The formatting function is expected
-// to return a number and error in package fmt style.  NewPrintfReporter will
-// append a newline to passed format strings, since the print formatting
-// function is expected to not do so.
-func NewPrintfReporter(
-	src source.DataSource,
-	printf func(format string, args ...interface{}) (int, error),
-) FormattedReporter {
-	return &printfReporter{
-		src:    src,
-		printf: printf,
+// HandleItems outputs all items with a source-name prefix on each item, if
+// started.
+func (rep *funcReporter) HandleItems(items [][]byte) error {
+	rep.lock.Lock()
+	run := rep.run
+	rep.lock.Unlock()
+	if run == nil {
+		return errReporterClosed
 	}
+	return run.HandleItems(items)
 }
 
-// Source returns the target source.
-func (rep *printfReporter) Source() source.DataSource {
-	return rep.src
+func (run *reporterRun) isStopped() bool {
+	return atomic.LoadInt32(&run.stopped) != 0
 }
 
-// Start clears any stop flag, and starts watching the data source.
-func (rep *printfReporter) Start() error {
-	var err error
-	rep.stopped = false
-	if isrc, ok := rep.src.(source.ItemDataSource); ok {
-		err = isrc.WatchItems("text", rep)
-	} else {
-		err = errRawSource
-	}
-	if err != nil {
-		rep.stopped = true
+func (run *reporterRun) stop() {
+	if atomic.CompareAndSwapInt32(&run.stopped, 0, 1) && run.cancel != nil {
+		run.cancel()
 	}
-	return err
 }
 
-// Stop sets a flag internally so that the next HandleItem(s) will return an
-// error, removing the watcher resource.
-func (rep *printfReporter) Stop() {
-	rep.stopped = true
+// HandleItem outputs the item, unless the run has stopped.
+func (run *reporterRun) HandleItem(item []byte) error {
+	return run.HandleItems([][]byte{item})
 }
 
-// HandleItem outputs the item to the printf function with a source-name
-// prefix and trailing newline.
-func (rep *printfReporter) HandleItem(item []byte) error {
-	if rep.stopped {
+// HandleItems outputs the items, unless the run has stopped; any output error
+// stops it.
+func (run *reporterRun) HandleItems(items [][]byte) error {
+	if run.isStopped() {
 		return errReporterClosed
 	}
-	if _, err := rep.printf("%s: %s\n", rep.src.Name(), item); err != nil {
-		rep.stopped = true
+	if err := run.output(run.name, items); err != nil {
+		run.stop()
 		return err
 	}
 	return nil
 }
-
-// HandleItems outputs all items to the logging function with a source-name
-// prefix and trailing newline on each item.
-func (rep *printfReporter) HandleItems(items [][]byte) error {
-	if rep.stopped {
-		return errReporterClosed
-	}
-	name := rep.src.Name()
-	for _, item := range items {
-		if _, err := rep.printf("%s: %s\n", name, item); err != nil {
-			rep.stopped = true
-			return err
-		}
-	}
-	return nil
-}
@@ -18,13 +18,18 @@
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
 // THE SOFTWARE.
 
+// +build !gwr_noop
+
 package report_test
 
 import (
 	"fmt"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/uber-go/gwr"
 	"github.com/uber-go/gwr/report"
 	"github.com/uber-go/gwr/source"
@@ -53,3 +58,62 @@ func TestLogfReporter(t *testing.T) {
 		"/tap/testDummy: struct { Lol int }{Lol:99}",
 	}, coll)
 }
+
+func TestPrintfReporter_restart(t *testing.T) {
+	src := gwr.DefaultDataSources.Get("/tap/testDummy")
+	defer src.(source.DrainableSource).Drain()
+
+	items := make(chan string, 10)
+	rep := report.NewPrintfReporter(src, func(format string, args ...interface{}) (int, error) {
+		items <- fmt.Sprintf(format, args...)
+		return 0, nil
+	})
+	waitFor := func(cond func() bool) bool {
+		for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+			if cond() {
+				return true
+			}
+			time.Sleep(time.Millisecond)
+		}
+		return false
+	}
+
+	require.NoError(t, rep.Start())
+	require.NoError(t, rep.Start(), "starting again is a no-op")
+	dummy.Emit(1)
+	assert.Equal(t, "/tap/testDummy: 1\n", <-items)
+
+	rep.Stop()
+	assert.True(t, waitFor(func() bool { return !dummy.Active() }), "watch dropped by Stop")
+	assert.Error(t, rep.HandleItem([]byte("2")), "stopped reporter handles no items")
+
+	require.NoError(t, rep.Start())
+	dummy.Emit(3)
+	assert.Equal(t, "/tap/testDummy: 3\n", <-items)
+	rep.Stop()
+	assert.Empty(t, items, "only one watch after restarting")
+}
+
+func TestPrintfReporter_concurrent(t *testing.T) {
+	src := gwr.DefaultDataSources.Get("/tap/testDummy")
+	defer src.(source.DrainableSource).Drain()
+
+	rep := report.NewPrintfReporter(src, func(format string, args ...interface{}) (int, error) {
+		return 0, nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				rep.Start()
+				dummy.Emit(j)
+				rep.Stop()
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Error(t, rep.HandleItem([]byte("x")), "stopped reporter handles no items")
+}
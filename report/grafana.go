@@ -0,0 +1,151 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/uber-go/gwr/source"
+)
+
+// GrafanaLiveConfig configures a reporter pushing to a Grafana Live channel;
+// the URL is its push endpoint, e.g.
+// "http://grafana:3000/api/live/push/gwr", and the Header should carry a
+// bearer token for a Grafana service account.
+type GrafanaLiveConfig struct {
+	PushConfig
+
+	// Measurement names the channel that items are pushed to within the
+	// stream; it defaults to the source name, less its leading slash.
+	Measurement string
+
+	// Tags are added to those derived from the source, replacing any with the
+	// same name.
+	Tags map[string]string
+}
+
+// NewGrafanaLiveReporter creates a reporter pushing the source's json items
+// to a Grafana Live stream, as influx line protocol.  Each top level field of
+// an item becomes a field, with any nested values encoded as json strings;
+// items that aren't objects become a "value" field.  The items are tagged
+// like NewLokiReporter labels a stream.
+func NewGrafanaLiveReporter(src source.DataSource, cfg GrafanaLiveConfig) *PushReporter {
+	measurement := cfg.Measurement
+	if measurement == "" {
+		measurement = strings.TrimPrefix(src.Name(), "/")
+	}
+	tags := sourceLabels(src)
+	for name, val := range cfg.Tags {
+		tags[name] = val
+	}
+	var prefix bytes.Buffer
+	lineEscaper.WriteString(&prefix, measurement)
+	names := make([]string, 0, len(tags))
+	for name := range tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		prefix.WriteByte(',')
+		tagEscaper.WriteString(&prefix, name)
+		prefix.WriteByte('=')
+		tagEscaper.WriteString(&prefix, tags[name])
+	}
+	return newPushReporter("grafana-live", src, cfg.PushConfig, func(items []pushItem) ([]byte, string, error) {
+		return encodeLines(prefix.Bytes(), items)
+	})
+}
+
+var (
+	lineEscaper  = strings.NewReplacer(",", `\,`, " ", `\ `)
+	tagEscaper   = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	fieldEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`)
+)
+
+func encodeLines(prefix []byte, items []pushItem) ([]byte, string, error) {
+	var out bytes.Buffer
+	for _, item := range items {
+		dec := json.NewDecoder(bytes.NewReader(item.data))
+		dec.UseNumber()
+		var val interface{}
+		if err := dec.Decode(&val); err != nil {
+			return nil, "", err
+		}
+		fields, ok := val.(map[string]interface{})
+		if !ok {
+			fields = map[string]interface{}{"value": val}
+		}
+		names := make([]string, 0, len(fields))
+		for name, field := range fields {
+			if field != nil {
+				names = append(names, name)
+			}
+		}
+		if len(names) == 0 {
+			continue
+		}
+		sort.Strings(names)
+
+		out.Write(prefix)
+		for i, name := range names {
+			if i == 0 {
+				out.WriteByte(' ')
+			} else {
+				out.WriteByte(',')
+			}
+			tagEscaper.WriteString(&out, name)
+			out.WriteByte('=')
+			if err := writeField(&out, fields[name]); err != nil {
+				return nil, "", err
+			}
+		}
+		out.WriteByte(' ')
+		out.WriteString(strconv.FormatInt(item.t.UnixNano(), 10))
+		out.WriteByte('\n')
+	}
+	return out.Bytes(), "text/plain", nil
+}
+
+func writeField(out *bytes.Buffer, val interface{}) error {
+	switch v := val.(type) {
+	case json.Number:
+		out.WriteString(v.String())
+	case bool:
+		out.WriteString(strconv.FormatBool(v))
+	case string:
+		out.WriteByte('"')
+		fieldEscaper.WriteString(out, v)
+		out.WriteByte('"')
+	default:
+		buf, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		out.WriteByte('"')
+		fieldEscaper.WriteString(out, string(buf))
+		out.WriteByte('"')
+	}
+	return nil
+}
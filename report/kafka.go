@@ -0,0 +1,128 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package report
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+
+	"github.com/uber-go/gwr/source"
+)
+
+// defaultKafkaTopic publishes each source to its own topic.
+const defaultKafkaTopic = "gwr.{source}"
+
+var errNoKafkaClient = errors.New("no kafka client")
+
+// KafkaMessage is a message to produce to a Kafka topic.
+type KafkaMessage struct {
+	Topic   string
+	Key     []byte
+	Value   []byte
+	Headers map[string]string
+}
+
+// KafkaClient produces messages to Kafka; it's usually a few lines adapting a
+// client library's producer, such as sarama's SyncProducer.SendMessages, so
+// that gwr needn't depend on one.
+type KafkaClient interface {
+	// Produce produces the messages, returning the indices of any that
+	// failed with a retriable error, such as a leader election or a full
+	// producer queue, to be retried.  An error fails the whole batch, which
+	// is dropped.
+	Produce(msgs []KafkaMessage) (failed []int, err error)
+}
+
+// KafkaConfig configures a reporter producing to a Kafka topic.
+type KafkaConfig struct {
+	BatchConfig
+
+	// Client produces the messages; required.
+	Client KafkaClient
+
+	// Topic names the topic that messages are produced to; any "{source}"
+	// in it is replaced by the source's name, with slashes replaced by dots,
+	// e.g. "tap.requests" for "/tap/requests".  It defaults to
+	// "gwr.{source}", a topic per source.
+	Topic string
+
+	// Key, if non-nil, selects each message's key, e.g. FieldKey("user.id"),
+	// so that related items go to the same partition; messages without a key
+	// are spread across partitions by the producer.
+	Key KeyFunc
+
+	// Headers are added to those derived from the source, replacing any with
+	// the same name.
+	Headers map[string]string
+}
+
+// NewKafkaReporter creates a reporter producing the source's json items to a
+// Kafka topic, as one message each, with headers like the labels of
+// NewLokiReporter.  As with NewKinesisReporter, failed messages are retried
+// after the FlushInterval, and the oldest items dropped once MaxPending are
+// held.
+func NewKafkaReporter(src source.DataSource, cfg KafkaConfig) *PushReporter {
+	topic := cfg.Topic
+	if topic == "" {
+		topic = defaultKafkaTopic
+	}
+	topic = strings.Replace(topic, "{source}", kafkaTopicName(src.Name()), -1)
+	headers := sourceLabels(src)
+	for name, val := range cfg.Headers {
+		headers[name] = val
+	}
+	return newBatchReporter("kafka", src, cfg.BatchConfig.withDefaults(0), func(items []pushItem) ([]pushItem, error) {
+		if cfg.Client == nil {
+			return nil, errNoKafkaClient
+		}
+		msgs := make([]KafkaMessage, len(items))
+		for i, item := range items {
+			data := bytes.TrimSpace(item.data)
+			msgs[i] = KafkaMessage{Topic: topic, Value: data, Headers: headers}
+			if cfg.Key != nil {
+				if key := cfg.Key(data); key != "" {
+					msgs[i].Key = []byte(key)
+				}
+			}
+		}
+		failed, err := cfg.Client.Produce(msgs)
+		return retryItems(items, failed), err
+	})
+}
+
+// kafkaTopicName converts a source name to part of a topic name, replacing
+// slashes with dots, and any other characters not allowed in one with
+// underscores.
+func kafkaTopicName(name string) string {
+	buf := []byte(strings.TrimPrefix(name, "/"))
+	for i, c := range buf {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9',
+			c == '.', c == '_', c == '-':
+		case c == '/':
+			buf[i] = '.'
+		default:
+			buf[i] = '_'
+		}
+	}
+	return string(buf)
+}
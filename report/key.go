@@ -0,0 +1,77 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+)
+
+// KeyFunc selects a key for a json item, such as a Kinesis partition key; an
+// empty key means that the item has none.
+type KeyFunc func(item []byte) string
+
+// FieldKey returns a KeyFunc selecting a field of each item, given its dotted
+// path, e.g. "user.id".  String fields are used as is, while any other value
+// is used in its json form; items without the field have no key.
+func FieldKey(path string) KeyFunc {
+	parts := strings.Split(path, ".")
+	return func(item []byte) string {
+		val, err := decodeItem(item)
+		if err != nil {
+			return ""
+		}
+		switch v := lookupField(val, parts).(type) {
+		case nil:
+			return ""
+		case string:
+			return v
+		default:
+			buf, _ := json.Marshal(v)
+			return string(buf)
+		}
+	}
+}
+
+// decodeItem decodes a json item, keeping numbers as json.Numbers.
+func decodeItem(item []byte) (interface{}, error) {
+	var val interface{}
+	dec := json.NewDecoder(bytes.NewReader(item))
+	dec.UseNumber()
+	err := dec.Decode(&val)
+	return val, err
+}
+
+// lookupField returns the field of a decoded item at a path of field names,
+// or nil if there's no such field.
+func lookupField(val interface{}, parts []string) interface{} {
+	for _, part := range parts {
+		obj, ok := val.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		if val, ok = obj[part]; !ok {
+			return nil
+		}
+	}
+	return val
+}
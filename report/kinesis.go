@@ -0,0 +1,106 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package report
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/uber-go/gwr/source"
+)
+
+// maxKinesisBatch is the most records that Kinesis accepts in one PutRecords.
+const maxKinesisBatch = 500
+
+var errNoKinesisClient = errors.New("no kinesis client")
+
+// KinesisRecord is a record to put to a Kinesis stream.
+type KinesisRecord struct {
+	PartitionKey string
+	Data         []byte
+}
+
+// KinesisClient puts records to a Kinesis stream; it's usually a few lines
+// adapting the AWS SDK's PutRecords, so that gwr needn't depend on it.
+type KinesisClient interface {
+	// PutRecords puts the records to the named stream, returning the indices
+	// of any that failed, such as those throttled with a
+	// ProvisionedThroughputExceededException, to be retried.  An error fails
+	// the whole batch, which is dropped.
+	PutRecords(stream string, records []KinesisRecord) (failed []int, err error)
+}
+
+// KinesisConfig configures a reporter putting records to a Kinesis stream.
+type KinesisConfig struct {
+	BatchConfig
+
+	// Client puts the records; required.
+	Client KinesisClient
+
+	// Stream names the stream that records are put to.
+	Stream string
+
+	// PartitionKey selects each record's partition key, e.g.
+	// FieldKey("user.id"); items without a key are partitioned by the
+	// source's name.  At most 500 records are put in one batch.
+	PartitionKey KeyFunc
+}
+
+// NewKinesisReporter creates a reporter putting the source's json items to a
+// Kinesis stream, as one record each.  Records that the stream throttles are
+// retried after the FlushInterval, ahead of any newer items, while the oldest
+// items are dropped once MaxPending are held.
+func NewKinesisReporter(src source.DataSource, cfg KinesisConfig) *PushReporter {
+	name := src.Name()
+	return newBatchReporter("kinesis", src, cfg.BatchConfig.withDefaults(maxKinesisBatch), func(items []pushItem) ([]pushItem, error) {
+		if cfg.Client == nil {
+			return nil, errNoKinesisClient
+		}
+		records := make([]KinesisRecord, len(items))
+		for i, item := range items {
+			data := bytes.TrimSpace(item.data)
+			key := ""
+			if cfg.PartitionKey != nil {
+				key = cfg.PartitionKey(data)
+			}
+			if key == "" {
+				key = name
+			}
+			records[i] = KinesisRecord{PartitionKey: key, Data: data}
+		}
+		failed, err := cfg.Client.PutRecords(cfg.Stream, records)
+		return retryItems(items, failed), err
+	})
+}
+
+// retryItems returns the items at the failed indices.
+func retryItems(items []pushItem, failed []int) []pushItem {
+	if len(failed) == 0 {
+		return nil
+	}
+	retry := make([]pushItem, 0, len(failed))
+	for _, i := range failed {
+		if i >= 0 && i < len(items) {
+			retry = append(retry, items[i])
+		}
+	}
+	return retry
+}
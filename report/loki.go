@@ -0,0 +1,110 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/uber-go/gwr/source"
+)
+
+// LokiConfig configures a reporter pushing to Loki; the URL is its push
+// endpoint, e.g. "http://loki:3100/loki/api/v1/push".
+type LokiConfig struct {
+	PushConfig
+
+	// Labels are added to those derived from the source, replacing any with
+	// the same name.
+	Labels map[string]string
+}
+
+// NewLokiReporter creates a reporter pushing the source's json items as lines
+// of a Loki stream.  The stream is labeled with the source's name as
+// "source", and with any of its scalar attrs, so that a tap may be found in
+// Grafana's Explore view like any other log stream.
+func NewLokiReporter(src source.DataSource, cfg LokiConfig) *PushReporter {
+	labels := sourceLabels(src)
+	for name, val := range cfg.Labels {
+		labels[name] = val
+	}
+	return newPushReporter("loki", src, cfg.PushConfig, func(items []pushItem) ([]byte, string, error) {
+		return encodeLoki(labels, items)
+	})
+}
+
+func encodeLoki(labels map[string]string, items []pushItem) ([]byte, string, error) {
+	type lokiStream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+	stream := lokiStream{
+		Stream: labels,
+		Values: make([][2]string, len(items)),
+	}
+	for i, item := range items {
+		stream.Values[i] = [2]string{
+			strconv.FormatInt(item.t.UnixNano(), 10),
+			string(bytes.TrimSpace(item.data)),
+		}
+	}
+	buf, err := json.Marshal(struct {
+		Streams []lokiStream `json:"streams"`
+	}{[]lokiStream{stream}})
+	return buf, "application/json", err
+}
+
+// sourceLabels returns labels describing a source: its name as "source", any
+// of its attrs that have a scalar value, under sanitized names, and the
+// process's identity, as "service", "instance", and "zone".
+func sourceLabels(src source.DataSource) map[string]string {
+	labels := map[string]string{"source": src.Name()}
+	for name, val := range src.Attrs() {
+		switch val.(type) {
+		case string, bool,
+			int, int8, int16, int32, int64,
+			uint, uint8, uint16, uint32, uint64,
+			float32, float64:
+			labels[labelName(name)] = fmt.Sprint(val)
+		}
+	}
+	for name, val := range source.ProcessIdentity().Labels() {
+		labels[name] = val
+	}
+	return labels
+}
+
+// labelName replaces any characters not allowed in a label name with
+// underscores.
+func labelName(name string) string {
+	buf := []byte(name)
+	for i, c := range buf {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			buf[i] = '_'
+		}
+	}
+	return string(buf)
+}
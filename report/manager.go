@@ -0,0 +1,388 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package report
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/uber-go/gwr/source"
+)
+
+// ReportersName is the name of a Manager's data source.
+const ReportersName = "/meta/reporters"
+
+var (
+	errUnknownReporterType = errors.New("unknown reporter type")
+	errDuplicateReporter   = errors.New("duplicate reporter name")
+	errNoReporterSources   = errors.New("reporter has no sources")
+)
+
+var reportersTextTemplate = template.Must(template.New("meta_reporters_text").Parse(strings.TrimSpace(`
+{{ define "get" }}{{ range . }}{{ template "item" . }}
+{{ end }}{{ end }}
+{{ define "item" }}{{ .Name }} ({{ .Type }}): {{ if .Running }}reporting {{ range $i, $name := .Reporting }}{{ if $i }}, {{ end }}{{ $name }}{{ else }}no sources{{ end }}{{ else }}stopped{{ end }}{{ end }}
+`)))
+
+// ReporterConfig configures a reporter managed by a Manager, e.g. from the
+// Reporters of a gwr.Config.  Besides the Name, Type, and Sources, only the
+// fields that its type uses need be set.
+type ReporterConfig struct {
+	// Name identifies the reporter; it defaults to the Type.
+	Name string `yaml:"name"`
+
+	// Type is the kind of reporter: "printf", to standard output; "file",
+	// as by a FileRecorder; "syslog"; "journald"; or any type added by
+	// Manager.AddType, such as "kafka" with KafkaFactory.
+	Type string `yaml:"type"`
+
+	// Sources are the patterns of the source names that are reported, as
+	// matched by source.DataSources.Match, e.g. "/tap/*".
+	Sources []string `yaml:"sources"`
+
+	// Dir is the directory of a "file" reporter.
+	Dir string `yaml:"dir"`
+
+	// Network and Addr are where a "syslog" reporter sends to.
+	Network string `yaml:"network"`
+	Addr    string `yaml:"addr"`
+
+	// Facility is the syslog facility of "syslog" and "journald" reporters.
+	Facility Facility `yaml:"facility"`
+
+	// Topic is the topic of a "kafka" reporter.
+	Topic string `yaml:"topic"`
+}
+
+// ReporterFactory creates a reporter of a source for a ReporterConfig.
+type ReporterFactory func(src source.DataSource, cfg ReporterConfig) (FormattedReporter, error)
+
+// KafkaFactory returns a ReporterFactory of "kafka" reporters producing with
+// the given client.
+func KafkaFactory(client KafkaClient) ReporterFactory {
+	return func(src source.DataSource, cfg ReporterConfig) (FormattedReporter, error) {
+		return NewKafkaReporter(src, KafkaConfig{Client: client, Topic: cfg.Topic}), nil
+	}
+}
+
+var builtinReporterTypes = map[string]ReporterFactory{
+	"printf": func(src source.DataSource, cfg ReporterConfig) (FormattedReporter, error) {
+		return NewPrintfReporter(src, fmt.Printf), nil
+	},
+	"file": func(src source.DataSource, cfg ReporterConfig) (FormattedReporter, error) {
+		if cfg.Dir == "" {
+			return nil, errNoRecordDir
+		}
+		return newFileReporter("file", src, FileRecorderConfig{Dir: cfg.Dir}), nil
+	},
+	"syslog": func(src source.DataSource, cfg ReporterConfig) (FormattedReporter, error) {
+		if cfg.Addr == "" {
+			return nil, errNoSyslogAddr
+		}
+		return NewSyslogReporter(src, SyslogConfig{
+			LogMapping: LogMapping{Facility: cfg.Facility},
+			Network:    cfg.Network,
+			Addr:       cfg.Addr,
+		}), nil
+	},
+	"journald": func(src source.DataSource, cfg ReporterConfig) (FormattedReporter, error) {
+		return NewJournaldReporter(src, JournaldConfig{
+			LogMapping: LogMapping{Facility: cfg.Facility},
+		}), nil
+	},
+}
+
+// ReporterInfo describes a managed reporter.
+type ReporterInfo struct {
+	Name      string   `json:"name"`
+	Type      string   `json:"type"`
+	Sources   []string `json:"sources"`
+	Running   bool     `json:"running"`
+	Reporting []string `json:"reporting,omitempty"`
+}
+
+// Manager runs a configured set of reporters, each reporting every source
+// matching its patterns, so that reporting can be set up by configuration
+// rather than code.
+//
+// A Manager is also a data source, named "/meta/reporters", which lists the
+// reporters, and emits each as it starts or stops.  Its "start" and "stop"
+// actions, with a reporter's "name" parameter, control them at runtime;
+// starting a running reporter picks up any sources added since it started.
+type Manager struct {
+	sources *source.DataSources
+
+	lock      sync.Mutex
+	types     map[string]ReporterFactory
+	reporters []*managedReporter
+	watcher   source.GenericDataWatcher
+}
+
+type managedReporter struct {
+	cfg     ReporterConfig
+	running bool
+	reps    map[string]FormattedReporter
+}
+
+// NewManager creates a Manager of reporters of sources from the given
+// registry.
+func NewManager(sources *source.DataSources) *Manager {
+	types := make(map[string]ReporterFactory, len(builtinReporterTypes))
+	for typ, factory := range builtinReporterTypes {
+		types[typ] = factory
+	}
+	return &Manager{
+		sources: sources,
+		types:   types,
+	}
+}
+
+// AddType adds, or replaces, a type of reporter; it should be called before
+// Configure.
+func (m *Manager) AddType(typ string, factory ReporterFactory) {
+	m.lock.Lock()
+	m.types[typ] = factory
+	m.lock.Unlock()
+}
+
+// Configure stops any reporters, and starts the configured ones instead.  An
+// error is returned, with none started, if any config names an unknown type,
+// has no sources, or has a duplicate name; otherwise the first error starting
+// a reporter is returned, after starting the rest.
+func (m *Manager) Configure(cfgs []ReporterConfig) error {
+	m.lock.Lock()
+	reporters := make([]*managedReporter, len(cfgs))
+	names := make(map[string]bool, len(cfgs))
+	for i, cfg := range cfgs {
+		if cfg.Name == "" {
+			cfg.Name = cfg.Type
+		}
+		if _, ok := m.types[cfg.Type]; !ok {
+			m.lock.Unlock()
+			return fmt.Errorf("%v %q", errUnknownReporterType, cfg.Type)
+		}
+		if len(cfg.Sources) == 0 {
+			m.lock.Unlock()
+			return fmt.Errorf("%v: %q", errNoReporterSources, cfg.Name)
+		}
+		if names[cfg.Name] {
+			m.lock.Unlock()
+			return fmt.Errorf("%v %q", errDuplicateReporter, cfg.Name)
+		}
+		names[cfg.Name] = true
+		reporters[i] = &managedReporter{cfg: cfg}
+	}
+	old := m.reporters
+	m.reporters = reporters
+	m.lock.Unlock()
+
+	for _, mr := range old {
+		m.stop(mr)
+	}
+	var err error
+	for _, mr := range reporters {
+		if startErr := m.start(mr); err == nil {
+			err = startErr
+		}
+	}
+	return err
+}
+
+// Shutdown stops all reporters, flushing any pending items.
+func (m *Manager) Shutdown() {
+	m.lock.Lock()
+	reporters := m.reporters
+	m.lock.Unlock()
+	for _, mr := range reporters {
+		m.stop(mr)
+	}
+}
+
+// Start starts the named reporter, or reports any newly matching sources if
+// it's already running; it returns source.ErrInvalidParam if there's no such
+// reporter.
+func (m *Manager) Start(name string) error {
+	mr := m.reporter(name)
+	if mr == nil {
+		return source.ErrInvalidParam
+	}
+	return m.start(mr)
+}
+
+// Stop stops the named reporter; it returns source.ErrInvalidParam if there's
+// no such reporter.
+func (m *Manager) Stop(name string) error {
+	mr := m.reporter(name)
+	if mr == nil {
+		return source.ErrInvalidParam
+	}
+	m.stop(mr)
+	return nil
+}
+
+// Reporters describes the configured reporters, in configuration order.
+func (m *Manager) Reporters() []ReporterInfo {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	infos := make([]ReporterInfo, len(m.reporters))
+	for i, mr := range m.reporters {
+		infos[i] = mr.info()
+	}
+	return infos
+}
+
+func (m *Manager) reporter(name string) *managedReporter {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, mr := range m.reporters {
+		if mr.cfg.Name == name {
+			return mr
+		}
+	}
+	return nil
+}
+
+// start starts reporting each matching source that isn't already reported,
+// returning the first error; reporters are started without the lock held,
+// since watching a source may call back into the manager, if it's one of
+// them.
+func (m *Manager) start(mr *managedReporter) error {
+	m.lock.Lock()
+	factory := m.types[mr.cfg.Type]
+	if mr.reps == nil {
+		mr.reps = make(map[string]FormattedReporter)
+	}
+	mr.running = true
+	var added []FormattedReporter
+	var err error
+	for _, pattern := range mr.cfg.Sources {
+		for _, src := range m.sources.Match(pattern) {
+			name := src.Name()
+			if mr.reps[name] != nil {
+				continue
+			}
+			rep, newErr := factory(src, mr.cfg)
+			if newErr != nil {
+				if err == nil {
+					err = newErr
+				}
+				continue
+			}
+			mr.reps[name] = rep
+			added = append(added, rep)
+		}
+	}
+	m.lock.Unlock()
+
+	for _, rep := range added {
+		if startErr := rep.Start(); startErr != nil {
+			m.lock.Lock()
+			delete(mr.reps, rep.Source().Name())
+			m.lock.Unlock()
+			if err == nil {
+				err = fmt.Errorf("%s: %v", rep.Source().Name(), startErr)
+			}
+		}
+	}
+	m.emit(mr)
+	return err
+}
+
+func (m *Manager) stop(mr *managedReporter) {
+	m.lock.Lock()
+	reps := mr.reps
+	mr.reps = nil
+	wasRunning := mr.running
+	mr.running = false
+	m.lock.Unlock()
+	for _, rep := range reps {
+		rep.Stop()
+	}
+	if wasRunning {
+		m.emit(mr)
+	}
+}
+
+func (m *Manager) emit(mr *managedReporter) {
+	m.lock.Lock()
+	info := mr.info()
+	watcher := m.watcher
+	m.lock.Unlock()
+	if watcher != nil && watcher.Active() {
+		watcher.HandleItem(info)
+	}
+}
+
+// info describes the reporter; the manager's lock must be held.
+func (mr *managedReporter) info() ReporterInfo {
+	info := ReporterInfo{
+		Name:    mr.cfg.Name,
+		Type:    mr.cfg.Type,
+		Sources: mr.cfg.Sources,
+		Running: mr.running,
+	}
+	for name := range mr.reps {
+		info.Reporting = append(info.Reporting, name)
+	}
+	sort.Strings(info.Reporting)
+	return info
+}
+
+// Name returns the static "/meta/reporters" string.
+func (m *Manager) Name() string {
+	return ReportersName
+}
+
+// TextTemplate returns a text/template to implement the GenericDataSource with
+// a "text" format option.
+func (m *Manager) TextTemplate() *template.Template {
+	return reportersTextTemplate
+}
+
+// Get returns the configured reporters.
+func (m *Manager) Get() interface{} {
+	return m.Reporters()
+}
+
+// SetWatcher implements GenericDataSource by retaining a reference to the
+// passed watcher.
+func (m *Manager) SetWatcher(watcher source.GenericDataWatcher) {
+	m.lock.Lock()
+	m.watcher = source.AddWatcher(m.watcher, watcher)
+	m.lock.Unlock()
+}
+
+// Action implements the "start" and "stop" actions, each taking a reporter's
+// "name" parameter.
+func (m *Manager) Action(name string, params map[string]string) error {
+	switch name {
+	case "start":
+		return m.Start(params["name"])
+	case "stop":
+		return m.Stop(params["name"])
+	default:
+		return source.ErrUnknownAction
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// +build !gwr_noop
+
+package report_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/gwr"
+	"github.com/uber-go/gwr/report"
+	"github.com/uber-go/gwr/source"
+	"github.com/uber-go/gwr/source/tap"
+)
+
+var (
+	managedA = tap.AddEmitter("testManaged/a", nil)
+	managedB = tap.AddEmitter("testManaged/b", nil)
+)
+
+type logLines struct {
+	sync.Mutex
+	lines []string
+}
+
+func (ll *logLines) logf(format string, args ...interface{}) {
+	ll.Lock()
+	ll.lines = append(ll.lines, fmt.Sprintf(format, args...))
+	ll.Unlock()
+}
+
+func (ll *logLines) all() []string {
+	ll.Lock()
+	defer ll.Unlock()
+	return append([]string(nil), ll.lines...)
+}
+
+func drainManaged() {
+	for _, name := range []string{"/tap/testManaged/a", "/tap/testManaged/b"} {
+		gwr.DefaultDataSources.Get(name).(source.DrainableSource).Drain()
+	}
+}
+
+func TestManager(t *testing.T) {
+	var ll logLines
+	m := report.NewManager(gwr.DefaultDataSources)
+	m.AddType("log", func(src source.DataSource, cfg report.ReporterConfig) (report.FormattedReporter, error) {
+		return report.NewLogfReporter(src, ll.logf), nil
+	})
+	assert.Equal(t, report.ReportersName, m.Name())
+
+	assert.Error(t, m.Configure([]report.ReporterConfig{{Type: "nope", Sources: []string{"/tap/*"}}}), "unknown type")
+	assert.Error(t, m.Configure([]report.ReporterConfig{{Type: "log"}}), "no sources")
+	assert.Error(t, m.Configure([]report.ReporterConfig{
+		{Type: "log", Sources: []string{"/tap/testManaged/a"}},
+		{Type: "log", Sources: []string{"/tap/testManaged/b"}},
+	}), "duplicate name")
+	assert.Empty(t, m.Reporters(), "nothing configured after errors")
+
+	require.NoError(t, m.Configure([]report.ReporterConfig{
+		{Name: "managed", Type: "log", Sources: []string{"/tap/testManaged/*"}},
+	}))
+	assert.Equal(t, []report.ReporterInfo{{
+		Name:      "managed",
+		Type:      "log",
+		Sources:   []string{"/tap/testManaged/*"},
+		Running:   true,
+		Reporting: []string{"/tap/testManaged/a", "/tap/testManaged/b"},
+	}}, m.Get())
+
+	managedA.Emit(1)
+	managedB.Emit(2)
+	drainManaged()
+	assert.ElementsMatch(t, []string{"/tap/testManaged/a: 1", "/tap/testManaged/b: 2"}, ll.all())
+
+	assert.Equal(t, source.ErrUnknownAction, m.Action("nope", nil))
+	assert.Equal(t, source.ErrInvalidParam, m.Action("stop", map[string]string{"name": "other"}))
+	require.NoError(t, m.Action("stop", map[string]string{"name": "managed"}))
+	infos := m.Reporters()
+	require.Len(t, infos, 1)
+	assert.False(t, infos[0].Running)
+	assert.Empty(t, infos[0].Reporting)
+
+	require.NoError(t, m.Action("start", map[string]string{"name": "managed"}))
+	assert.True(t, m.Reporters()[0].Running)
+	m.Shutdown()
+	assert.False(t, m.Reporters()[0].Running, "stopped by Shutdown")
+}
+
+func TestManager_builtinTypes(t *testing.T) {
+	m := report.NewManager(gwr.DefaultDataSources)
+	assert.Error(t, m.Configure([]report.ReporterConfig{
+		{Type: "file", Sources: []string{"/tap/testManaged/a"}},
+	}), "file reporter needs a dir")
+	assert.Error(t, m.Configure([]report.ReporterConfig{
+		{Type: "kafka", Sources: []string{"/tap/testManaged/a"}},
+	}), "kafka needs a factory with a client")
+	m.Shutdown()
+}
@@ -0,0 +1,350 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package report
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/uber-go/gwr/internal/parquet"
+	"github.com/uber-go/gwr/source"
+)
+
+const (
+	defaultParquetRowGroupSize = 10000
+	defaultParquetMaxFileSize  = 128 << 20
+	defaultParquetMaxFileAge   = time.Hour
+)
+
+var errNoParquetDir = errors.New("no parquet capture directory")
+
+// ParquetType is the type of a parquet column.
+type ParquetType int
+
+const (
+	// ParquetString columns hold strings; other json values are stored as
+	// json text.
+	ParquetString ParquetType = iota
+	// ParquetDouble columns hold json numbers.
+	ParquetDouble
+	// ParquetInt64 columns hold json numbers that are integers.
+	ParquetInt64
+	// ParquetBool columns hold json booleans.
+	ParquetBool
+	// ParquetTimestamp columns hold RFC 3339 json strings, as time.Time
+	// marshals to, stored as microseconds.
+	ParquetTimestamp
+)
+
+// ParquetColumn describes a column of captured items.
+type ParquetColumn struct {
+	// Name names the column.
+	Name string
+
+	// Field is the dotted path of the item field stored in the column, e.g.
+	// "user.id"; it defaults to the Name.
+	Field string
+
+	// Type is the column's type; values that don't fit it are null.
+	Type ParquetType
+}
+
+// ParquetConfig configures a reporter capturing items to parquet files.
+type ParquetConfig struct {
+	BatchConfig
+
+	// Dir is the directory that files are written to; required.
+	Dir string
+
+	// Prefix starts each file's name; it defaults to the source name, with
+	// slashes replaced by underscores.
+	Prefix string
+
+	// Columns is the schema of the files; if nil, one is inferred from the
+	// top level fields of the first batch of items, with numbers as doubles,
+	// and any nested values as json strings.  Fields outside the schema
+	// aren't captured, so supply a schema for items of varying shape.
+	Columns []ParquetColumn
+
+	// TimeColumn, if set, names an added timestamp column holding when each
+	// item was emitted.
+	TimeColumn string
+
+	// RowGroupSize is how many rows are buffered before being written as a
+	// row group; default 10000.
+	RowGroupSize int
+
+	// MaxFileSize and MaxFileAge rotate files once they've grown to a size,
+	// default 128MiB, or been open for a while, default an hour.
+	MaxFileSize int64
+	MaxFileAge  time.Duration
+}
+
+// NewParquetReporter creates a reporter capturing the source's json items to
+// parquet files, so that large captures may be queried directly, e.g. by
+// DuckDB or Athena.  Each item, or a non-object item as a "value" field, is a
+// row.  Files are written as "<prefix>-<time>-<n>.parquet.tmp", and renamed to
+// drop the ".tmp" once rotated, or when the reporter is stopped, since a
+// parquet file isn't readable until its footer is written.
+func NewParquetReporter(src source.DataSource, cfg ParquetConfig) *PushReporter {
+	if cfg.Prefix == "" {
+		cfg.Prefix = strings.Replace(strings.TrimPrefix(src.Name(), "/"), "/", "_", -1)
+	}
+	if cfg.RowGroupSize <= 0 {
+		cfg.RowGroupSize = defaultParquetRowGroupSize
+	}
+	if cfg.MaxFileSize <= 0 {
+		cfg.MaxFileSize = defaultParquetMaxFileSize
+	}
+	if cfg.MaxFileAge <= 0 {
+		cfg.MaxFileAge = defaultParquetMaxFileAge
+	}
+	pc := &parquetCapture{cfg: cfg}
+	pc.setColumns(cfg.Columns)
+	rep := newBatchReporter("parquet", src, cfg.BatchConfig.withDefaults(0), pc.send)
+	rep.onTick = func() { pc.report(pc.rotate(false)) }
+	rep.onStop = func() { pc.report(pc.rotate(true)) }
+	return rep
+}
+
+// parquetCapture is the state of a parquet reporter, only used by its sending
+// goroutine.
+type parquetCapture struct {
+	cfg     ParquetConfig
+	cols    []ParquetColumn
+	paths   [][]string
+	pcols   []parquet.Column
+	rows    [][]interface{}
+	seq     int
+	file    *os.File
+	pw      *parquet.Writer
+	started time.Time // when the current file's first row was captured
+}
+
+func (pc *parquetCapture) setColumns(cols []ParquetColumn) {
+	if cols == nil {
+		return
+	}
+	pc.cols = cols
+	pc.paths = make([][]string, len(cols))
+	pc.pcols = make([]parquet.Column, 0, len(cols)+1)
+	for i, col := range cols {
+		field := col.Field
+		if field == "" {
+			field = col.Name
+		}
+		pc.paths[i] = strings.Split(field, ".")
+		pc.pcols = append(pc.pcols, parquet.Column{Name: col.Name, Type: parquet.Type(col.Type)})
+	}
+	if pc.cfg.TimeColumn != "" {
+		pc.pcols = append(pc.pcols, parquet.Column{Name: pc.cfg.TimeColumn, Type: parquet.Timestamp})
+	}
+}
+
+func (pc *parquetCapture) report(err error) {
+	if err != nil && pc.cfg.Errorf != nil {
+		pc.cfg.Errorf("parquet capture failed: %v", err)
+	}
+}
+
+func (pc *parquetCapture) send(items []pushItem) ([]pushItem, error) {
+	vals := make([]interface{}, 0, len(items))
+	for _, item := range items {
+		val, err := decodeItem(item.data)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := val.(map[string]interface{}); !ok {
+			val = map[string]interface{}{"value": val}
+		}
+		vals = append(vals, val)
+	}
+	if pc.cols == nil {
+		pc.setColumns(inferColumns(vals))
+	}
+	for i, val := range vals {
+		row := make([]interface{}, len(pc.pcols))
+		for j, col := range pc.cols {
+			row[j] = parquetValue(col.Type, lookupField(val, pc.paths[j]))
+		}
+		if pc.cfg.TimeColumn != "" {
+			row[len(row)-1] = items[i].t
+		}
+		if pc.pw == nil && len(pc.rows) == 0 {
+			pc.started = time.Now()
+		}
+		pc.rows = append(pc.rows, row)
+		if len(pc.rows) >= pc.cfg.RowGroupSize {
+			if err := pc.writeRows(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return nil, pc.rotate(false)
+}
+
+// inferColumns infers columns from the top level fields of items, in name
+// order, each typed by the first non-null value seen.
+func inferColumns(vals []interface{}) []ParquetColumn {
+	types := make(map[string]ParquetType)
+	seen := make(map[string]bool)
+	var names []string
+	for _, val := range vals {
+		for name, field := range val.(map[string]interface{}) {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+			if _, typed := types[name]; typed || field == nil {
+				continue
+			}
+			switch field.(type) {
+			case json.Number:
+				types[name] = ParquetDouble
+			case bool:
+				types[name] = ParquetBool
+			default:
+				types[name] = ParquetString
+			}
+		}
+	}
+	sort.Strings(names)
+	cols := make([]ParquetColumn, len(names))
+	for i, name := range names {
+		cols[i] = ParquetColumn{Name: name, Type: types[name]}
+	}
+	return cols
+}
+
+// parquetValue converts a decoded json value for a column type, returning nil
+// if it doesn't fit.
+func parquetValue(typ ParquetType, val interface{}) interface{} {
+	if val == nil {
+		return nil
+	}
+	switch typ {
+	case ParquetString:
+		if s, ok := val.(string); ok {
+			return s
+		}
+		buf, err := json.Marshal(val)
+		if err != nil {
+			return nil
+		}
+		return string(buf)
+	case ParquetDouble:
+		if n, ok := val.(json.Number); ok {
+			if f, err := n.Float64(); err == nil {
+				return f
+			}
+		}
+	case ParquetInt64:
+		if n, ok := val.(json.Number); ok {
+			if i, err := n.Int64(); err == nil {
+				return i
+			}
+		}
+	case ParquetBool:
+		if b, ok := val.(bool); ok {
+			return b
+		}
+	case ParquetTimestamp:
+		if s, ok := val.(string); ok {
+			if t, err := time.Parse(time.RFC3339Nano, s); err == nil {
+				return t
+			}
+		}
+	}
+	return nil
+}
+
+// writeRows writes any buffered rows as a row group, opening a file if
+// needed.
+func (pc *parquetCapture) writeRows() error {
+	if len(pc.rows) == 0 {
+		return nil
+	}
+	if pc.pw == nil {
+		if err := pc.open(); err != nil {
+			pc.rows = pc.rows[:0]
+			return err
+		}
+	}
+	err := pc.pw.WriteRowGroup(pc.rows)
+	pc.rows = pc.rows[:0]
+	return err
+}
+
+func (pc *parquetCapture) open() error {
+	if pc.cfg.Dir == "" {
+		return errNoParquetDir
+	}
+	now := time.Now()
+	pc.seq++
+	name := fmt.Sprintf("%s-%s-%d.parquet.tmp",
+		pc.cfg.Prefix, now.UTC().Format("20060102T150405.000000000Z"), pc.seq)
+	file, err := os.OpenFile(filepath.Join(pc.cfg.Dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	pw, err := parquet.NewWriter(file, pc.pcols)
+	if err != nil {
+		file.Close()
+		return err
+	}
+	pc.file, pc.pw = file, pw
+	return nil
+}
+
+// rotate finishes the current file, after writing any buffered rows, if
+// it's grown too large or old, or if final is true.
+func (pc *parquetCapture) rotate(final bool) error {
+	if pc.pw == nil && len(pc.rows) == 0 {
+		return nil
+	}
+	if !final &&
+		(pc.pw == nil || pc.pw.Size() < pc.cfg.MaxFileSize) &&
+		time.Since(pc.started) < pc.cfg.MaxFileAge {
+		return nil
+	}
+	if err := pc.writeRows(); err != nil {
+		return err
+	}
+	if pc.pw == nil {
+		return nil
+	}
+	err := pc.pw.Close()
+	if cerr := pc.file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		path := pc.file.Name()
+		err = os.Rename(path, strings.TrimSuffix(path, ".tmp"))
+	}
+	pc.file, pc.pw = nil, nil
+	return err
+}
@@ -0,0 +1,105 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// +build !gwr_noop
+
+package report_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/gwr"
+	"github.com/uber-go/gwr/report"
+	"github.com/uber-go/gwr/source"
+	"github.com/uber-go/gwr/source/tap"
+)
+
+var captured = tap.AddEmitter("testCaptured", nil)
+
+func parquetFiles(t *testing.T, dir string) []string {
+	names, err := filepath.Glob(filepath.Join(dir, "*"))
+	require.NoError(t, err)
+	return names
+}
+
+func TestParquetReporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gwr-parquet")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	src := gwr.DefaultDataSources.Get("/tap/testCaptured")
+	rep := report.NewParquetReporter(src, report.ParquetConfig{
+		Dir:        dir,
+		TimeColumn: "emitted",
+	})
+	require.NoError(t, rep.Start())
+
+	captured.Emit(map[string]interface{}{"path": "/a", "status": 200, "user": map[string]interface{}{"id": 1}})
+	captured.Emit(map[string]interface{}{"path": "/b", "ok": true})
+	src.(source.DrainableSource).Drain()
+	rep.Stop()
+
+	files := parquetFiles(t, dir)
+	require.Equal(t, 1, len(files), "one file written")
+	assert.Regexp(t, `/tap_testCaptured-\d{8}T\d{6}\.\d{9}Z-1\.parquet$`, files[0], "finished file renamed")
+
+	data, err := ioutil.ReadFile(files[0])
+	require.NoError(t, err)
+	assert.True(t, bytes.HasPrefix(data, []byte("PAR1")), "leading magic")
+	assert.True(t, bytes.HasSuffix(data, []byte("PAR1")), "trailing magic")
+	for _, name := range []string{"ok", "path", "status", "user", "emitted", `{"id":1}`} {
+		assert.Contains(t, string(data), name, "captured %q", name)
+	}
+	assert.Equal(t, uint64(0), rep.Dropped())
+}
+
+func TestParquetReporter_rotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gwr-parquet")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	src := gwr.DefaultDataSources.Get("/tap/testCaptured")
+	rep := report.NewParquetReporter(src, report.ParquetConfig{
+		BatchConfig:  report.BatchConfig{BatchSize: 1},
+		Dir:          dir,
+		Prefix:       "cap",
+		Columns:      []report.ParquetColumn{{Name: "n", Type: report.ParquetInt64}},
+		RowGroupSize: 1,
+		MaxFileSize:  1,
+	})
+	require.NoError(t, rep.Start())
+	for i := 0; i < 3; i++ {
+		captured.Emit(map[string]interface{}{"n": i})
+	}
+	src.(source.DrainableSource).Drain()
+	rep.Stop()
+
+	files := parquetFiles(t, dir)
+	assert.Equal(t, 3, len(files), "rotated after every row group")
+	for _, file := range files {
+		assert.Regexp(t, `/cap-.*\.parquet$`, file)
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package report
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/uber-go/gwr/source"
+)
+
+// maxPubSubBatch is the most messages that PubSub accepts in one publish.
+const maxPubSubBatch = 1000
+
+var errNoPubSubClient = errors.New("no pubsub client")
+
+// PubSubMessage is a message to publish to a PubSub topic.
+type PubSubMessage struct {
+	Data        []byte
+	OrderingKey string
+	Attributes  map[string]string
+}
+
+// PubSubClient publishes messages to a PubSub topic; it's usually a few lines
+// adapting the GCP client's Topic.Publish, so that gwr needn't depend on it.
+type PubSubClient interface {
+	// Publish publishes the messages to the named topic, returning the
+	// indices of any that failed, such as those refused while the publisher
+	// is over its flow control limits, to be retried.  An error fails the
+	// whole batch, which is dropped.
+	Publish(topic string, msgs []PubSubMessage) (failed []int, err error)
+}
+
+// PubSubConfig configures a reporter publishing to a PubSub topic.
+type PubSubConfig struct {
+	BatchConfig
+
+	// Client publishes the messages; required.
+	Client PubSubClient
+
+	// Topic names the topic that messages are published to.
+	Topic string
+
+	// OrderingKey, if non-nil, selects each message's ordering key, e.g.
+	// FieldKey("user.id").  At most 1000 messages are published in one
+	// batch.
+	OrderingKey KeyFunc
+
+	// Attributes are added to those derived from the source, replacing any
+	// with the same name.
+	Attributes map[string]string
+}
+
+// NewPubSubReporter creates a reporter publishing the source's json items to
+// a PubSub topic, as one message each, with attributes like the labels of
+// NewLokiReporter.  As with NewKinesisReporter, failed messages are retried
+// after the FlushInterval, and the oldest items dropped once MaxPending are
+// held.
+func NewPubSubReporter(src source.DataSource, cfg PubSubConfig) *PushReporter {
+	attrs := sourceLabels(src)
+	for name, val := range cfg.Attributes {
+		attrs[name] = val
+	}
+	return newBatchReporter("pubsub", src, cfg.BatchConfig.withDefaults(maxPubSubBatch), func(items []pushItem) ([]pushItem, error) {
+		if cfg.Client == nil {
+			return nil, errNoPubSubClient
+		}
+		msgs := make([]PubSubMessage, len(items))
+		for i, item := range items {
+			data := bytes.TrimSpace(item.data)
+			msgs[i] = PubSubMessage{Data: data, Attributes: attrs}
+			if cfg.OrderingKey != nil {
+				msgs[i].OrderingKey = cfg.OrderingKey(data)
+			}
+		}
+		failed, err := cfg.Client.Publish(cfg.Topic, msgs)
+		return retryItems(items, failed), err
+	})
+}
@@ -0,0 +1,373 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package report
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/uber-go/gwr/source"
+)
+
+const (
+	defaultPushBatchSize     = 100
+	defaultPushFlushInterval = time.Second
+)
+
+// BatchConfig configures how the reporters that send a source's items to a
+// remote service, such as NewLokiReporter or NewKinesisReporter, batch them.
+type BatchConfig struct {
+	// BatchSize is the most items sent in one batch; default 100.
+	BatchSize int
+
+	// FlushInterval is the longest that an item is held before being sent;
+	// default 1s.  After the service pushes back, by throttling some items,
+	// sending resumes after this interval.
+	FlushInterval time.Duration
+
+	// MaxPending bounds how many items are held while sends are slow,
+	// throttled, or failing; beyond it the oldest are dropped, rather than
+	// blocking the source.  Defaults to 10 batches.
+	MaxPending int
+
+	// Errorf, if non-nil, is called with any send error; the failed batch is
+	// dropped.
+	Errorf func(format string, args ...interface{})
+}
+
+func (cfg BatchConfig) withDefaults(maxBatch int) BatchConfig {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultPushBatchSize
+	}
+	if maxBatch > 0 && cfg.BatchSize > maxBatch {
+		cfg.BatchSize = maxBatch
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultPushFlushInterval
+	}
+	if cfg.MaxPending <= 0 {
+		cfg.MaxPending = 10 * cfg.BatchSize
+	}
+	if cfg.MaxPending < cfg.BatchSize {
+		cfg.MaxPending = cfg.BatchSize
+	}
+	return cfg
+}
+
+// PushConfig configures the reporters that POST a source's items to an http
+// endpoint, such as NewLokiReporter.
+type PushConfig struct {
+	BatchConfig
+
+	// URL is the endpoint that batches are POSTed to.
+	URL string
+
+	// Header is added to every push request, e.g. an Authorization or
+	// X-Scope-OrgID header.
+	Header http.Header
+
+	// Client sends push requests; http.DefaultClient is used if nil.
+	Client *http.Client
+}
+
+// pushItem is an item, usually json, and when it was emitted by its source.
+type pushItem struct {
+	t    time.Time
+	data []byte
+}
+
+// pushEncoder encodes a batch of items into a request body and its content
+// type.
+type pushEncoder func(items []pushItem) ([]byte, string, error)
+
+// batchSender sends a batch of items, returning any that should be retried
+// because the service pushed back; other errors drop the whole batch.
+type batchSender func(items []pushItem) (retry []pushItem, err error)
+
+// PushReporter watches a source's json items, sending them in batches to a
+// remote service, or to files; see NewLokiReporter, NewGrafanaLiveReporter,
+// NewKinesisReporter, NewPubSubReporter, NewKafkaReporter, and
+// NewParquetReporter.  NewSyslogReporter and NewJournaldReporter instead
+// forward the source's text items.  Items are sent from a separate goroutine,
+// so a slow, throttling, or failing service never blocks the source; items are
+// instead dropped once too many are pending.
+//
+// While started, the reporter is shown as a consumer of its source by the
+// "/meta/graph" source.
+type PushReporter struct {
+	kind   string
+	src    source.DataSource
+	format string
+	cfg    BatchConfig
+	send   batchSender
+
+	// onTick and onStop, if set, are called from the sending goroutine after
+	// each tick's flush, and after the final flush when stopping.
+	onTick func()
+	onStop func()
+
+	lock     sync.Mutex
+	stopped  bool
+	paused   bool
+	consumer func()
+	pending  []pushItem
+	dropped  uint64
+	kick     chan struct{}
+	done     chan struct{}
+	exited   chan struct{}
+}
+
+func newBatchReporter(kind string, src source.DataSource, cfg BatchConfig, send batchSender) *PushReporter {
+	return &PushReporter{
+		kind:    kind,
+		src:     src,
+		format:  "json",
+		cfg:     cfg,
+		send:    send,
+		stopped: true,
+	}
+}
+
+func newPushReporter(kind string, src source.DataSource, cfg PushConfig, encode pushEncoder) *PushReporter {
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	return newBatchReporter(kind, src, cfg.BatchConfig.withDefaults(0), func(items []pushItem) ([]pushItem, error) {
+		return httpPush(cfg, encode, items)
+	})
+}
+
+// Source returns the target source.
+func (rep *PushReporter) Source() source.DataSource {
+	return rep.src
+}
+
+// Start starts watching the data source, and pushing its items.
+func (rep *PushReporter) Start() error {
+	isrc, ok := rep.src.(source.ItemDataSource)
+	if !ok {
+		return errRawSource
+	}
+
+	rep.lock.Lock()
+	if !rep.stopped {
+		rep.lock.Unlock()
+		return nil
+	}
+	rep.stopped = false
+	rep.kick = make(chan struct{}, 1)
+	rep.done = make(chan struct{})
+	rep.exited = make(chan struct{})
+	rep.consumer = addConsumer(rep.kind, rep.src)
+	go rep.run(rep.kick, rep.done, rep.exited)
+	rep.lock.Unlock()
+
+	if err := isrc.WatchItems(rep.format, rep); err != nil {
+		rep.Stop()
+		return err
+	}
+	return nil
+}
+
+// Stop sets a flag internally so that the next HandleItem(s) will return an
+// error, removing the watcher resource.  Any pending items are pushed before
+// Stop returns.
+func (rep *PushReporter) Stop() {
+	rep.lock.Lock()
+	if rep.stopped {
+		rep.lock.Unlock()
+		return
+	}
+	rep.stopped = true
+	close(rep.done)
+	rep.consumer()
+	exited := rep.exited
+	rep.lock.Unlock()
+	<-exited
+}
+
+// Dropped returns how many items have been dropped, either because too many
+// were pending, or because their send failed.
+func (rep *PushReporter) Dropped() uint64 {
+	rep.lock.Lock()
+	defer rep.lock.Unlock()
+	return rep.dropped
+}
+
+// HandleItem queues the item to be pushed.
+func (rep *PushReporter) HandleItem(item []byte) error {
+	return rep.add(time.Now(), item)
+}
+
+// HandleItems queues all of the items to be pushed.
+func (rep *PushReporter) HandleItems(items [][]byte) error {
+	return rep.add(time.Now(), items...)
+}
+
+// HandleTimedItem queues the item to be pushed, stamped with its emission
+// time.
+func (rep *PushReporter) HandleTimedItem(t time.Time, item []byte) error {
+	return rep.add(t, item)
+}
+
+// HandleTimedItems queues all of the items to be pushed, stamped with their
+// emission time.
+func (rep *PushReporter) HandleTimedItems(t time.Time, items [][]byte) error {
+	return rep.add(t, items...)
+}
+
+func (rep *PushReporter) add(t time.Time, items ...[]byte) error {
+	rep.lock.Lock()
+	defer rep.lock.Unlock()
+	if rep.stopped {
+		return errReporterClosed
+	}
+	for _, item := range items {
+		data := make([]byte, len(item))
+		copy(data, item)
+		rep.pending = append(rep.pending, pushItem{t, data})
+	}
+	rep.shed()
+	if len(rep.pending) >= rep.cfg.BatchSize && !rep.paused {
+		select {
+		case rep.kick <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// shed drops the oldest pending items beyond MaxPending; the lock must be
+// held.
+func (rep *PushReporter) shed() {
+	if over := len(rep.pending) - rep.cfg.MaxPending; over > 0 {
+		rep.dropped += uint64(over)
+		rep.pending = append(rep.pending[:0], rep.pending[over:]...)
+	}
+}
+
+func (rep *PushReporter) run(kick, done, exited chan struct{}) {
+	defer close(exited)
+	tick := time.NewTicker(rep.cfg.FlushInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-kick:
+			rep.flush(false)
+		case <-tick.C:
+			rep.lock.Lock()
+			rep.paused = false
+			rep.lock.Unlock()
+			rep.flush(true)
+			if rep.onTick != nil {
+				rep.onTick()
+			}
+		case <-done:
+			rep.lock.Lock()
+			rep.paused = false
+			rep.lock.Unlock()
+			rep.flush(true)
+			rep.lock.Lock()
+			rep.dropped += uint64(len(rep.pending))
+			rep.pending = nil
+			rep.lock.Unlock()
+			if rep.onStop != nil {
+				rep.onStop()
+			}
+			return
+		}
+	}
+}
+
+// flush sends full batches of pending items, and any final partial batch if
+// all is true.  If the service pushes back, any items to retry are requeued
+// ahead of the rest, and flushing pauses until the next tick.
+func (rep *PushReporter) flush(all bool) {
+	for {
+		rep.lock.Lock()
+		n := len(rep.pending)
+		if n > rep.cfg.BatchSize {
+			n = rep.cfg.BatchSize
+		}
+		if n == 0 || rep.paused || (n < rep.cfg.BatchSize && !all) {
+			rep.lock.Unlock()
+			return
+		}
+		batch := make([]pushItem, n)
+		copy(batch, rep.pending)
+		rep.pending = append(rep.pending[:0], rep.pending[n:]...)
+		rep.lock.Unlock()
+
+		retry, err := rep.send(batch)
+		if err != nil {
+			rep.lock.Lock()
+			rep.dropped += uint64(len(batch))
+			rep.lock.Unlock()
+			if rep.cfg.Errorf != nil {
+				rep.cfg.Errorf("%s send failed: %v", rep.src.Name(), err)
+			}
+		} else if len(retry) > 0 {
+			rep.lock.Lock()
+			rep.pending = append(retry, rep.pending...)
+			rep.shed()
+			rep.paused = true
+			rep.lock.Unlock()
+			return
+		}
+	}
+}
+
+// httpPush POSTs a batch of items, retrying all of them if the endpoint is
+// throttling requests, or is briefly unavailable.
+func httpPush(cfg PushConfig, encode pushEncoder, batch []pushItem) ([]pushItem, error) {
+	body, contentType, err := encode(batch)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest("POST", cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for key, vals := range cfg.Header {
+		req.Header[key] = vals
+	}
+	req.Header.Set("Content-Type", contentType)
+	resp, err := cfg.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusTooManyRequests,
+		resp.StatusCode == http.StatusServiceUnavailable:
+		return batch, nil
+	case resp.StatusCode/100 != 2:
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	_, err = io.Copy(ioutil.Discard, resp.Body)
+	return nil, err
+}
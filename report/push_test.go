@@ -0,0 +1,148 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// +build !gwr_noop
+
+package report_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/gwr"
+	"github.com/uber-go/gwr/report"
+	"github.com/uber-go/gwr/source"
+	"github.com/uber-go/gwr/source/tap"
+)
+
+var pushed = tap.AddEmitter("testPushed", nil)
+
+type pushServer struct {
+	*httptest.Server
+	sync.Mutex
+	bodies []string
+	types  []string
+}
+
+func newPushServer() *pushServer {
+	ps := &pushServer{}
+	ps.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		ps.Lock()
+		ps.bodies = append(ps.bodies, string(body))
+		ps.types = append(ps.types, r.Header.Get("Content-Type"))
+		ps.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	return ps
+}
+
+var timestamps = regexp.MustCompile(`\d{19}`)
+
+func TestLokiReporter(t *testing.T) {
+	ps := newPushServer()
+	defer ps.Close()
+
+	src := gwr.DefaultDataSources.Get("/tap/testPushed")
+	rep := report.NewLokiReporter(src, report.LokiConfig{
+		PushConfig: report.PushConfig{URL: ps.URL},
+		Labels:     map[string]string{"app": "test"},
+	})
+	require.NoError(t, rep.Start())
+
+	pushed.Emit(map[string]interface{}{"n": 1})
+	pushed.Emit("two")
+	src.(source.DrainableSource).Drain()
+	rep.Stop()
+
+	ps.Lock()
+	defer ps.Unlock()
+	require.Equal(t, 1, len(ps.bodies), "one batch pushed")
+	assert.Equal(t, "application/json", ps.types[0])
+	assert.Equal(t,
+		`{"streams":[{"stream":{"app":"test","source":"/tap/testPushed"},"values":[["TS","{\"n\":1}"],["TS","\"two\""]]}]}`,
+		timestamps.ReplaceAllString(ps.bodies[0], "TS"))
+	assert.Equal(t, uint64(0), rep.Dropped())
+}
+
+func TestGrafanaLiveReporter(t *testing.T) {
+	ps := newPushServer()
+	defer ps.Close()
+
+	src := gwr.DefaultDataSources.Get("/tap/testPushed")
+	rep := report.NewGrafanaLiveReporter(src, report.GrafanaLiveConfig{
+		PushConfig: report.PushConfig{URL: ps.URL},
+		Tags:       map[string]string{"app": "a test"},
+	})
+	require.NoError(t, rep.Start())
+
+	pushed.Emit(map[string]interface{}{"n": 1, "s": `say "hi"`, "ok": true, "l": []int{1}})
+	pushed.Emit(2.5)
+	src.(source.DrainableSource).Drain()
+	rep.Stop()
+
+	ps.Lock()
+	defer ps.Unlock()
+	require.Equal(t, 1, len(ps.bodies), "one batch pushed")
+	assert.Equal(t, "text/plain", ps.types[0])
+	assert.Equal(t,
+		`tap/testPushed,app=a\ test,source=/tap/testPushed l="[1]",n=1,ok=true,s="say \"hi\"" TS`+"\n"+
+			`tap/testPushed,app=a\ test,source=/tap/testPushed value=2.5 TS`+"\n",
+		timestamps.ReplaceAllString(ps.bodies[0], "TS"))
+}
+
+func TestPushReporter_maxPending(t *testing.T) {
+	var lock sync.Mutex
+	block := make(chan struct{})
+	var got int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+		lock.Lock()
+		got++
+		lock.Unlock()
+	}))
+	defer srv.Close()
+
+	src := gwr.DefaultDataSources.Get("/tap/testPushed")
+	rep := report.NewLokiReporter(src, report.LokiConfig{
+		PushConfig: report.PushConfig{
+			URL:         srv.URL,
+			BatchConfig: report.BatchConfig{BatchSize: 2, MaxPending: 4},
+		},
+	})
+	require.NoError(t, rep.Start())
+	for i := 0; i < 10; i++ {
+		pushed.Emit(i)
+	}
+	src.(source.DrainableSource).Drain()
+	close(block)
+	rep.Stop()
+
+	assert.True(t, rep.Dropped() > 0, "some items dropped while the push blocked")
+	lock.Lock()
+	assert.True(t, got > 0, "some batches pushed")
+	lock.Unlock()
+}
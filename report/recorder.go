@@ -0,0 +1,351 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package report
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/uber-go/gwr/source"
+)
+
+// RecordingsName is the name of a FileRecorder's control data source.
+const RecordingsName = "/meta/recordings"
+
+const (
+	defaultRecordMaxFileSize = 64 << 20
+	defaultRecordMaxFileAge  = time.Hour
+)
+
+var errNoRecordDir = errors.New("no recording directory")
+
+var recordingsTextTemplate = template.Must(template.New("meta_recordings_text").Parse(strings.TrimSpace(`
+{{ define "get" }}{{ range . }}{{ template "item" . }}
+{{ end }}{{ end }}
+{{ define "item" }}{{ .Source }}: {{ if .Stopped }}stopped{{ else }}recording since {{ .Started.Format "15:04:05" }}{{ end }}, {{ .Dropped }} dropped{{ end }}
+`)))
+
+// FileRecorderConfig configures a FileRecorder.
+type FileRecorderConfig struct {
+	BatchConfig
+
+	// Dir is the directory that recordings are written to; required.
+	Dir string
+
+	// MaxFileSize and MaxFileAge rotate each source's file once it's grown
+	// to a size, default 64MiB, or been open for a while, default an hour.
+	MaxFileSize int64
+	MaxFileAge  time.Duration
+}
+
+// RecordedItem is a line of a recording file: a source's json item, and when
+// it was emitted.
+type RecordedItem struct {
+	Time time.Time       `json:"time"`
+	Item json.RawMessage `json:"item"`
+}
+
+// RecordingInfo describes a source's recording.
+type RecordingInfo struct {
+	Source  string    `json:"source"`
+	Started time.Time `json:"started"`
+	Stopped bool      `json:"stopped,omitempty"`
+	Dropped uint64    `json:"dropped"`
+}
+
+// FileRecorder records the json items of any number of sources to files,
+// so that they're captured even while no one is watching.  Each source's
+// items are written, as json lines of RecordedItem, to
+// "<source>-<time>-<n>.jsonl" files, with slashes in the source name replaced
+// by underscores, which are rotated by size and age.
+//
+// A FileRecorder is also a data source, named "/meta/recordings", which lists
+// the recordings, and emits each as it starts or stops.  Its "start" and
+// "stop" actions, with a "source" name parameter, control recordings remotely
+// once it's added, e.g. by gwr.AddGenericDataSource; clients must be
+// authorized to watch the named source, as well as to act on the recorder.
+type FileRecorder struct {
+	sources *source.DataSources
+	cfg     FileRecorderConfig
+
+	lock       sync.Mutex
+	recordings map[string]*recording
+	watcher    source.GenericDataWatcher
+}
+
+type recording struct {
+	rep     *PushReporter
+	started time.Time
+}
+
+// NewFileRecorder creates a FileRecorder recording sources from the given
+// registry.
+func NewFileRecorder(sources *source.DataSources, cfg FileRecorderConfig) *FileRecorder {
+	return &FileRecorder{
+		sources:    sources,
+		cfg:        cfg,
+		recordings: make(map[string]*recording),
+	}
+}
+
+// Record starts recording the named source; recording a source that's
+// already being recorded does nothing.  Aggregate-only sources may not be
+// recorded, since their raw items would be written out; see
+// source.DataSources.SetAggregateOnly.
+func (fr *FileRecorder) Record(name string) error {
+	if fr.cfg.Dir == "" {
+		return errNoRecordDir
+	}
+	if fr.sources.AggregateOnly(name) {
+		return fmt.Errorf("%s: %v", name, source.ErrAggregateOnly)
+	}
+	src := fr.sources.Get(name)
+	if src == nil {
+		return source.ErrInvalidParam
+	}
+
+	fr.lock.Lock()
+	if _, ok := fr.recordings[name]; ok {
+		fr.lock.Unlock()
+		return nil
+	}
+	rep := newFileReporter("recording", src, fr.cfg)
+	rec := &recording{rep: rep, started: time.Now()}
+	fr.recordings[name] = rec
+	fr.lock.Unlock()
+
+	// started without the lock held, since watching may call back into
+	// SetWatcher, if the recorder is recording itself
+	err := rep.Start()
+
+	fr.lock.Lock()
+	if err != nil {
+		delete(fr.recordings, name)
+		fr.lock.Unlock()
+		return err
+	}
+	if fr.recordings[name] != rec {
+		// stopped while starting
+		fr.lock.Unlock()
+		rep.Stop()
+		return nil
+	}
+	info := rec.info(name)
+	watcher := fr.watcher
+	fr.lock.Unlock()
+
+	fr.emit(watcher, info)
+	return nil
+}
+
+// Stop stops recording the named source, after writing any pending items; it
+// returns false if the source wasn't being recorded.
+func (fr *FileRecorder) Stop(name string) bool {
+	fr.lock.Lock()
+	rec, ok := fr.recordings[name]
+	delete(fr.recordings, name)
+	watcher := fr.watcher
+	fr.lock.Unlock()
+	if !ok {
+		return false
+	}
+
+	rec.rep.Stop()
+	info := rec.info(name)
+	info.Stopped = true
+	fr.emit(watcher, info)
+	return true
+}
+
+// StopAll stops all recordings.
+func (fr *FileRecorder) StopAll() {
+	for _, info := range fr.Recordings() {
+		fr.Stop(info.Source)
+	}
+}
+
+// Recordings describes all current recordings, sorted by source name.
+func (fr *FileRecorder) Recordings() []RecordingInfo {
+	fr.lock.Lock()
+	infos := make([]RecordingInfo, 0, len(fr.recordings))
+	for name, rec := range fr.recordings {
+		infos = append(infos, rec.info(name))
+	}
+	fr.lock.Unlock()
+	sort.Sort(recordingsBySource(infos))
+	return infos
+}
+
+// Name returns the static "/meta/recordings" string.
+func (fr *FileRecorder) Name() string {
+	return RecordingsName
+}
+
+// TextTemplate returns a text/template to implement the GenericDataSource with
+// a "text" format option.
+func (fr *FileRecorder) TextTemplate() *template.Template {
+	return recordingsTextTemplate
+}
+
+// Get returns the current recordings.
+func (fr *FileRecorder) Get() interface{} {
+	return fr.Recordings()
+}
+
+// SetWatcher implements GenericDataSource by retaining a reference to the
+// passed watcher.
+func (fr *FileRecorder) SetWatcher(watcher source.GenericDataWatcher) {
+	fr.lock.Lock()
+	fr.watcher = source.AddWatcher(fr.watcher, watcher)
+	fr.lock.Unlock()
+}
+
+// Action implements the "start" and "stop" actions, each taking the name of a
+// "source" parameter.
+func (fr *FileRecorder) Action(name string, params map[string]string) error {
+	switch name {
+	case "start":
+		return fr.Record(params["source"])
+	case "stop":
+		if !fr.Stop(params["source"]) {
+			return source.ErrInvalidParam
+		}
+		return nil
+	default:
+		return source.ErrUnknownAction
+	}
+}
+
+func (fr *FileRecorder) emit(watcher source.GenericDataWatcher, info RecordingInfo) {
+	if watcher != nil && watcher.Active() {
+		watcher.HandleItem(info)
+	}
+}
+
+func (rec *recording) info(name string) RecordingInfo {
+	return RecordingInfo{
+		Source:  name,
+		Started: rec.started,
+		Dropped: rec.rep.Dropped(),
+	}
+}
+
+type recordingsBySource []RecordingInfo
+
+func (rs recordingsBySource) Len() int           { return len(rs) }
+func (rs recordingsBySource) Less(i, j int) bool { return rs[i].Source < rs[j].Source }
+func (rs recordingsBySource) Swap(i, j int)      { rs[i], rs[j] = rs[j], rs[i] }
+
+// newFileReporter creates a reporter recording the source's items to files,
+// as a FileRecorder does.
+func newFileReporter(kind string, src source.DataSource, cfg FileRecorderConfig) *PushReporter {
+	if cfg.MaxFileSize <= 0 {
+		cfg.MaxFileSize = defaultRecordMaxFileSize
+	}
+	if cfg.MaxFileAge <= 0 {
+		cfg.MaxFileAge = defaultRecordMaxFileAge
+	}
+	fc := &fileCapture{
+		cfg:    cfg,
+		prefix: strings.Replace(strings.TrimPrefix(src.Name(), "/"), "/", "_", -1),
+	}
+	rep := newBatchReporter(kind, src, cfg.BatchConfig.withDefaults(0), fc.send)
+	rep.onTick = func() { fc.report(fc.rotate(false)) }
+	rep.onStop = func() { fc.report(fc.rotate(true)) }
+	return rep
+}
+
+// fileCapture is the state of a source's recording, only used by its sending
+// goroutine.
+type fileCapture struct {
+	cfg     FileRecorderConfig
+	prefix  string
+	seq     int
+	file    *os.File
+	size    int64
+	started time.Time // when the current file was opened
+}
+
+func (fc *fileCapture) report(err error) {
+	if err != nil && fc.cfg.Errorf != nil {
+		fc.cfg.Errorf("%s recording failed: %v", fc.prefix, err)
+	}
+}
+
+func (fc *fileCapture) send(items []pushItem) ([]pushItem, error) {
+	var buf []byte
+	for _, item := range items {
+		line, err := json.Marshal(RecordedItem{item.t, json.RawMessage(item.data)})
+		if err != nil {
+			return nil, err
+		}
+		buf = append(buf, line...)
+		buf = append(buf, '\n')
+	}
+	if fc.file == nil {
+		if err := fc.open(); err != nil {
+			return nil, err
+		}
+	}
+	n, err := fc.file.Write(buf)
+	fc.size += int64(n)
+	if err != nil {
+		return nil, err
+	}
+	return nil, fc.rotate(false)
+}
+
+func (fc *fileCapture) open() error {
+	now := time.Now()
+	fc.seq++
+	name := fmt.Sprintf("%s-%s-%d.jsonl",
+		fc.prefix, now.UTC().Format("20060102T150405.000000000Z"), fc.seq)
+	file, err := os.OpenFile(filepath.Join(fc.cfg.Dir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	fc.file, fc.size, fc.started = file, 0, now
+	return nil
+}
+
+// rotate closes the current file if it's grown too large or old, or if final
+// is true; the next items then open a new one.
+func (fc *fileCapture) rotate(final bool) error {
+	if fc.file == nil {
+		return nil
+	}
+	if !final &&
+		fc.size < fc.cfg.MaxFileSize &&
+		time.Since(fc.started) < fc.cfg.MaxFileAge {
+		return nil
+	}
+	err := fc.file.Close()
+	fc.file = nil
+	return err
+}
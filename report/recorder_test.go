@@ -0,0 +1,106 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// +build !gwr_noop
+
+package report_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/gwr"
+	"github.com/uber-go/gwr/report"
+	"github.com/uber-go/gwr/source"
+	"github.com/uber-go/gwr/source/tap"
+)
+
+var recorded = tap.AddEmitter("testRecorded", nil)
+
+func readRecording(t *testing.T, path string) (items []string) {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var ri report.RecordedItem
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &ri))
+		assert.False(t, ri.Time.IsZero(), "emission time recorded")
+		items = append(items, string(ri.Item))
+	}
+	require.NoError(t, scanner.Err())
+	return items
+}
+
+func TestFileRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gwr-recording")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	fr := report.NewFileRecorder(gwr.DefaultDataSources, report.FileRecorderConfig{
+		BatchConfig: report.BatchConfig{BatchSize: 1},
+		Dir:         dir,
+		MaxFileSize: 10,
+	})
+	assert.Equal(t, report.RecordingsName, fr.Name())
+	assert.Equal(t, source.ErrUnknownAction, fr.Action("nope", nil))
+	assert.Equal(t, source.ErrInvalidParam, fr.Action("start", map[string]string{"source": "/no/such"}))
+	assert.Equal(t, source.ErrInvalidParam, fr.Action("stop", map[string]string{"source": "/tap/testRecorded"}))
+
+	require.NoError(t, fr.Action("start", map[string]string{"source": "/tap/testRecorded"}))
+	require.NoError(t, fr.Record("/tap/testRecorded"), "already recording")
+	infos := fr.Get().([]report.RecordingInfo)
+	require.Len(t, infos, 1)
+	assert.Equal(t, "/tap/testRecorded", infos[0].Source)
+
+	recorded.Emit(map[string]interface{}{"n": 1})
+	recorded.Emit(map[string]interface{}{"n": 2})
+	gwr.DefaultDataSources.Get("/tap/testRecorded").(source.DrainableSource).Drain()
+	require.NoError(t, fr.Action("stop", map[string]string{"source": "/tap/testRecorded"}))
+	assert.Empty(t, fr.Recordings())
+
+	files, err := filepath.Glob(filepath.Join(dir, "tap_testRecorded-*.jsonl"))
+	require.NoError(t, err)
+	require.Equal(t, 2, len(files), "rotated once grown past MaxFileSize")
+	assert.Equal(t, []string{`{"n":1}`}, readRecording(t, files[0]))
+	assert.Equal(t, []string{`{"n":2}`}, readRecording(t, files[1]))
+}
+
+func TestFileRecorder_noDir(t *testing.T) {
+	fr := report.NewFileRecorder(gwr.DefaultDataSources, report.FileRecorderConfig{})
+	assert.Error(t, fr.Record("/tap/testRecorded"))
+	assert.Empty(t, fr.Recordings())
+}
+
+func TestFileRecorder_aggregateOnly(t *testing.T) {
+	dss := source.NewDataSources()
+	dss.SetAggregateOnly("/tap/secret", true)
+	fr := report.NewFileRecorder(dss, report.FileRecorderConfig{Dir: os.TempDir()})
+	err := fr.Action("start", map[string]string{"source": "/tap/secret"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), source.ErrAggregateOnly.Error())
+	assert.Empty(t, fr.Recordings())
+}
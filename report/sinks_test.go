@@ -0,0 +1,334 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// +build !gwr_noop
+
+package report_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/gwr"
+	"github.com/uber-go/gwr/report"
+	"github.com/uber-go/gwr/source"
+	"github.com/uber-go/gwr/source/tap"
+)
+
+var sunk = tap.AddEmitter("testSunk", nil)
+
+var logged = tap.AddEmitter("testLogged", template.Must(template.New("test_logged_text").Parse(
+	`{{ define "item" }}{{ . }}{{ end }}`)))
+
+type fakeKinesis struct {
+	sync.Mutex
+	throttle bool
+	streams  []string
+	records  []report.KinesisRecord
+}
+
+func (fk *fakeKinesis) PutRecords(stream string, records []report.KinesisRecord) ([]int, error) {
+	fk.Lock()
+	defer fk.Unlock()
+	fk.streams = append(fk.streams, stream)
+	if fk.throttle {
+		fk.throttle = false
+		fk.records = append(fk.records, records[0])
+		return []int{1}, nil
+	}
+	fk.records = append(fk.records, records...)
+	return nil, nil
+}
+
+func TestKinesisReporter(t *testing.T) {
+	fk := &fakeKinesis{throttle: true}
+	src := gwr.DefaultDataSources.Get("/tap/testSunk")
+	rep := report.NewKinesisReporter(src, report.KinesisConfig{
+		BatchConfig:  report.BatchConfig{BatchSize: 2, FlushInterval: 10 * time.Millisecond},
+		Client:       fk,
+		Stream:       "taps",
+		PartitionKey: report.FieldKey("user.id"),
+	})
+	require.NoError(t, rep.Start())
+
+	sunk.Emit(map[string]interface{}{"user": map[string]interface{}{"id": 7}})
+	sunk.Emit(map[string]interface{}{"user": map[string]interface{}{"id": "bob"}})
+	src.(source.DrainableSource).Drain()
+	time.Sleep(50 * time.Millisecond)
+	rep.Stop()
+
+	fk.Lock()
+	defer fk.Unlock()
+	assert.Equal(t, []string{"taps", "taps"}, fk.streams, "throttled record retried")
+	assert.Equal(t, []report.KinesisRecord{
+		{PartitionKey: "7", Data: []byte(`{"user":{"id":7}}`)},
+		{PartitionKey: "bob", Data: []byte(`{"user":{"id":"bob"}}`)},
+	}, fk.records)
+	assert.Equal(t, uint64(0), rep.Dropped())
+}
+
+type fakePubSub struct {
+	sync.Mutex
+	msgs []report.PubSubMessage
+}
+
+func (fp *fakePubSub) Publish(topic string, msgs []report.PubSubMessage) ([]int, error) {
+	fp.Lock()
+	defer fp.Unlock()
+	fp.msgs = append(fp.msgs, msgs...)
+	return nil, nil
+}
+
+func TestPubSubReporter(t *testing.T) {
+	fp := &fakePubSub{}
+	src := gwr.DefaultDataSources.Get("/tap/testSunk")
+	rep := report.NewPubSubReporter(src, report.PubSubConfig{
+		Client:      fp,
+		Topic:       "taps",
+		OrderingKey: report.FieldKey("k"),
+		Attributes:  map[string]string{"app": "test"},
+	})
+	require.NoError(t, rep.Start())
+
+	sunk.Emit(map[string]interface{}{"k": "a"})
+	sunk.Emit(3)
+	src.(source.DrainableSource).Drain()
+	rep.Stop()
+
+	fp.Lock()
+	defer fp.Unlock()
+	attrs := map[string]string{"app": "test", "source": "/tap/testSunk"}
+	assert.Equal(t, []report.PubSubMessage{
+		{Data: []byte(`{"k":"a"}`), OrderingKey: "a", Attributes: attrs},
+		{Data: []byte(`3`), Attributes: attrs},
+	}, fp.msgs)
+}
+
+type fakeKafka struct {
+	sync.Mutex
+	retry bool
+	msgs  []report.KafkaMessage
+}
+
+func (fk *fakeKafka) Produce(msgs []report.KafkaMessage) ([]int, error) {
+	fk.Lock()
+	defer fk.Unlock()
+	if fk.retry {
+		fk.retry = false
+		fk.msgs = append(fk.msgs, msgs[1:]...)
+		return []int{0}, nil
+	}
+	fk.msgs = append(fk.msgs, msgs...)
+	return nil, nil
+}
+
+func TestKafkaReporter(t *testing.T) {
+	fk := &fakeKafka{retry: true}
+	src := gwr.DefaultDataSources.Get("/tap/testSunk")
+	rep := report.NewKafkaReporter(src, report.KafkaConfig{
+		BatchConfig: report.BatchConfig{FlushInterval: 10 * time.Millisecond},
+		Client:      fk,
+		Key:         report.FieldKey("k"),
+		Headers:     map[string]string{"app": "test"},
+	})
+	require.NoError(t, rep.Start())
+
+	sunk.Emit(map[string]interface{}{"k": "a"})
+	sunk.Emit(3)
+	src.(source.DrainableSource).Drain()
+	time.Sleep(50 * time.Millisecond)
+	rep.Stop()
+
+	fk.Lock()
+	headers := map[string]string{"app": "test", "source": "/tap/testSunk"}
+	assert.Equal(t, []report.KafkaMessage{
+		{Topic: "gwr.tap.testSunk", Value: []byte(`3`), Headers: headers},
+		{Topic: "gwr.tap.testSunk", Key: []byte("a"), Value: []byte(`{"k":"a"}`), Headers: headers},
+	}, fk.msgs, "failed message retried")
+	assert.Equal(t, uint64(0), rep.Dropped())
+	fk.msgs = nil
+	fk.Unlock()
+
+	rep = report.NewKafkaReporter(src, report.KafkaConfig{Client: fk, Topic: "events-{source}"})
+	require.NoError(t, rep.Start())
+	sunk.Emit(1)
+	src.(source.DrainableSource).Drain()
+	rep.Stop()
+	fk.Lock()
+	defer fk.Unlock()
+	require.Len(t, fk.msgs, 1)
+	assert.Equal(t, "events-tap.testSunk", fk.msgs[0].Topic, "templated topic")
+}
+
+func TestSyslogReporter(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	src := gwr.DefaultDataSources.Get("/tap/testLogged")
+	rep := report.NewSyslogReporter(src, report.SyslogConfig{
+		LogMapping: report.LogMapping{
+			Facility: report.FacilityLocal3,
+			Severity: func(item []byte) report.Severity {
+				if strings.Contains(string(item), "bad") {
+					return report.SeverityError
+				}
+				return report.SeverityInfo
+			},
+		},
+		Addr:     conn.LocalAddr().String(),
+		Hostname: "host",
+		AppName:  "app",
+	})
+	require.NoError(t, rep.Start())
+	logged.Emit("fine")
+	logged.Emit("bad")
+	src.(source.DrainableSource).Drain()
+	rep.Stop()
+
+	pid := strconv.Itoa(os.Getpid())
+	buf := make([]byte, 1024)
+	for _, expected := range []string{
+		`^<158>1 \S+Z host app ` + pid + ` /tap/testLogged - fine$`,
+		`^<155>1 \S+Z host app ` + pid + ` /tap/testLogged - bad$`,
+	} {
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		require.NoError(t, err)
+		assert.Regexp(t, expected, string(buf[:n]))
+	}
+}
+
+func TestSyslogReporter_tcp(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer ln.Close()
+	received := make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		data, _ := ioutil.ReadAll(conn)
+		received <- string(data)
+	}()
+
+	src := gwr.DefaultDataSources.Get("/tap/testLogged")
+	rep := report.NewSyslogReporter(src, report.SyslogConfig{
+		Network:  "tcp",
+		Addr:     ln.Addr().String(),
+		Hostname: "host",
+		AppName:  "app",
+	})
+	require.NoError(t, rep.Start())
+	logged.Emit("one")
+	logged.Emit("two")
+	src.(source.DrainableSource).Drain()
+	rep.Stop()
+
+	data := <-received
+	assert.Regexp(t, `^\d+ <14>1 .* - one\d+ <14>1 .* - two$`, data, "octet counted frames")
+	n, err := strconv.Atoi(data[:strings.Index(data, " ")])
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(data[:len(strconv.Itoa(n))+1+n], " - one"), "frame length")
+}
+
+func TestJournaldReporter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gwr-journald")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	sock := filepath.Join(dir, "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: sock, Net: "unixgram"})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	src := gwr.DefaultDataSources.Get("/tap/testLogged")
+	rep := report.NewJournaldReporter(src, report.JournaldConfig{
+		LogMapping: report.LogMapping{Facility: report.FacilityDaemon},
+		Socket:     sock,
+		Identifier: "app",
+	})
+	require.NoError(t, rep.Start())
+	logged.Emit("multi\nline")
+	src.(source.DrainableSource).Drain()
+	rep.Stop()
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "MESSAGE\n\x0a\x00\x00\x00\x00\x00\x00\x00multi\nline\n"+
+		"PRIORITY=6\n"+
+		"SYSLOG_FACILITY=3\n"+
+		"SYSLOG_IDENTIFIER=app\n"+
+		"GWR_SOURCE=/tap/testLogged\n", string(buf[:n]))
+}
+
+func TestStatsdReporter(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	src := gwr.DefaultDataSources.Get("/tap/testSunk")
+	rep := report.NewStatsdReporter(src, report.StatsdConfig{
+		Addr: conn.LocalAddr().String(),
+		Metrics: []report.StatsdMetric{
+			{Name: "requests.{status}", Type: report.StatsdCounter},
+			{Name: "latency", Type: report.StatsdTimer, Field: "elapsed", Scale: 1000},
+			{Name: "bytes", Type: report.StatsdGauge, Field: "resp.bytes"},
+		},
+	})
+	require.NoError(t, rep.Start())
+	sunk.Emit(map[string]interface{}{"status": 200, "elapsed": 0.25, "resp": map[string]interface{}{"bytes": 512}})
+	sunk.Emit(map[string]interface{}{"status": "5xx"})
+	src.(source.DrainableSource).Drain()
+	rep.Stop()
+
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"tap.testSunk.requests.200:1|c",
+		"tap.testSunk.latency:250|ms",
+		"tap.testSunk.bytes:512|g",
+		"tap.testSunk.requests.5xx:1|c",
+	}, strings.Split(string(buf[:n]), "\n"), "items without a field skipped")
+}
+
+func TestFieldKey(t *testing.T) {
+	key := report.FieldKey("a.b")
+	assert.Equal(t, "x", key([]byte(`{"a":{"b":"x"}}`)))
+	assert.Equal(t, "1.5", key([]byte(`{"a":{"b":1.5}}`)))
+	assert.Equal(t, `{"c":1}`, key([]byte(`{"a":{"b":{"c":1}}}`)))
+	assert.Equal(t, "", key([]byte(`{"a":1}`)), "missing field")
+	assert.Equal(t, "", key([]byte(`not json`)), "invalid item")
+}
@@ -0,0 +1,257 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/uber-go/gwr/source"
+)
+
+// maxStatsdPacket keeps statsd packets within a typical network MTU.
+const maxStatsdPacket = 1432
+
+var errNoStatsdAddr = errors.New("no statsd address")
+
+// StatsdType is the type of a statsd metric.
+type StatsdType int
+
+const (
+	// StatsdCounter metrics are incremented by the field's value, or by one
+	// for each item if no field is given.
+	StatsdCounter StatsdType = iota
+	// StatsdGauge metrics are set to the field's value.
+	StatsdGauge
+	// StatsdTimer metrics record the field's value as milliseconds.
+	StatsdTimer
+)
+
+func (typ StatsdType) suffix() string {
+	switch typ {
+	case StatsdGauge:
+		return "g"
+	case StatsdTimer:
+		return "ms"
+	default:
+		return "c"
+	}
+}
+
+// StatsdMetric describes a metric derived from a source's items.
+type StatsdMetric struct {
+	// Name is the metric's name, after the config's Prefix.  It may include
+	// the values of item fields, given by their dotted paths in braces, e.g.
+	// "requests.{status}" for a counter of requests by status.
+	Name string
+
+	// Type is the metric's type.
+	Type StatsdType
+
+	// Field is the dotted path of the numeric item field that the metric
+	// reports, e.g. "latency_ms"; items without a numeric value for it are
+	// skipped.  Counters may leave it empty to count items.
+	Field string
+
+	// Scale, if non-zero, multiplies the field's value, e.g. 1000 for a
+	// timer of a field in seconds.
+	Scale float64
+}
+
+// StatsdConfig configures a reporter sending metrics to a statsd server.
+type StatsdConfig struct {
+	BatchConfig
+
+	// Addr is the host:port of the statsd server, which is sent udp packets;
+	// required.
+	Addr string
+
+	// Prefix starts every metric's name; it defaults to the source name,
+	// with slashes replaced by dots, and a trailing dot, e.g.
+	// "http.requests." for "/http/requests".
+	Prefix string
+
+	// Metrics are derived from each item.
+	Metrics []StatsdMetric
+}
+
+// NewStatsdReporter creates a reporter deriving statsd counters, gauges, and
+// timers from the numeric fields of the source's json items, e.g. so that a
+// request log tap can feed throughput and latency graphs, through statsd to
+// graphite, without separate instrumentation.
+func NewStatsdReporter(src source.DataSource, cfg StatsdConfig) *PushReporter {
+	if cfg.Prefix == "" {
+		cfg.Prefix = strings.Replace(strings.TrimPrefix(src.Name(), "/"), "/", ".", -1) + "."
+	}
+	sd := &statsdSender{
+		addr:    cfg.Addr,
+		metrics: make([]statsdMetric, len(cfg.Metrics)),
+	}
+	for i, m := range cfg.Metrics {
+		sd.metrics[i] = newStatsdMetric(cfg.Prefix, m)
+	}
+	rep := newBatchReporter("statsd", src, cfg.BatchConfig.withDefaults(0), sd.send)
+	rep.onStop = sd.close
+	return rep
+}
+
+// statsdFieldPattern matches a field reference in a metric name.
+var statsdFieldPattern = regexp.MustCompile(`\{([^{}]+)\}`)
+
+type statsdMetric struct {
+	StatsdMetric
+	name   string     // the prefixed name, with field references
+	fields [][]string // the paths of the fields referenced by name
+	path   []string   // the path of Field
+}
+
+func newStatsdMetric(prefix string, m StatsdMetric) statsdMetric {
+	sm := statsdMetric{StatsdMetric: m, name: prefix + m.Name}
+	for _, match := range statsdFieldPattern.FindAllStringSubmatch(sm.name, -1) {
+		sm.fields = append(sm.fields, strings.Split(match[1], "."))
+	}
+	if m.Field != "" {
+		sm.path = strings.Split(m.Field, ".")
+	}
+	return sm
+}
+
+// line returns the statsd line of the metric for a decoded item, if it has
+// one.
+func (sm statsdMetric) line(val interface{}) (string, bool) {
+	value := 1.0
+	if sm.path != nil {
+		n, ok := lookupField(val, sm.path).(json.Number)
+		if !ok {
+			return "", false
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return "", false
+		}
+		value = f
+	} else if sm.Type != StatsdCounter {
+		return "", false
+	}
+	if sm.Scale != 0 {
+		value *= sm.Scale
+	}
+
+	name := sm.name
+	if len(sm.fields) > 0 {
+		i := 0
+		name = statsdFieldPattern.ReplaceAllStringFunc(name, func(string) string {
+			part := statsdNamePart(lookupField(val, sm.fields[i]))
+			i++
+			return part
+		})
+	}
+	return name + ":" + strconv.FormatFloat(value, 'f', -1, 64) + "|" + sm.Type.suffix(), true
+}
+
+// statsdNamePart converts a field value to part of a metric name, replacing
+// any characters special to statsd or graphite with underscores.
+func statsdNamePart(val interface{}) string {
+	var s string
+	switch v := val.(type) {
+	case nil:
+		return "none"
+	case string:
+		s = v
+	case json.Number:
+		s = v.String()
+	default:
+		buf, _ := json.Marshal(v)
+		s = string(buf)
+	}
+	buf := []byte(s)
+	for i, c := range buf {
+		switch c {
+		case ':', '|', '@', '.', ' ', '\n', '/', '#':
+			buf[i] = '_'
+		}
+	}
+	return string(buf)
+}
+
+// statsdSender is the state of a statsd reporter, only used by its sending
+// goroutine.
+type statsdSender struct {
+	addr    string
+	metrics []statsdMetric
+	conn    net.Conn
+}
+
+func (sd *statsdSender) send(items []pushItem) ([]pushItem, error) {
+	if sd.conn == nil {
+		if sd.addr == "" {
+			return nil, errNoStatsdAddr
+		}
+		conn, err := net.Dial("udp", sd.addr)
+		if err != nil {
+			return nil, err
+		}
+		sd.conn = conn
+	}
+	var packet bytes.Buffer
+	flush := func() error {
+		if packet.Len() == 0 {
+			return nil
+		}
+		_, err := sd.conn.Write(packet.Bytes())
+		packet.Reset()
+		return err
+	}
+	for _, item := range items {
+		val, err := decodeItem(item.data)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range sd.metrics {
+			line, ok := m.line(val)
+			if !ok {
+				continue
+			}
+			if packet.Len() > 0 && packet.Len()+1+len(line) > maxStatsdPacket {
+				if err := flush(); err != nil {
+					return nil, err
+				}
+			}
+			if packet.Len() > 0 {
+				packet.WriteByte('\n')
+			}
+			packet.WriteString(line)
+		}
+	}
+	return nil, flush()
+}
+
+func (sd *statsdSender) close() {
+	if sd.conn != nil {
+		sd.conn.Close()
+		sd.conn = nil
+	}
+}
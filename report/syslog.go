@@ -0,0 +1,341 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package report
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/uber-go/gwr/source"
+)
+
+const (
+	defaultJournaldSocket = "/run/systemd/journal/socket"
+	syslogDialTimeout     = 10 * time.Second
+	maxSyslogMsgID        = 32
+	maxSyslogAppName      = 48
+)
+
+var errNoSyslogAddr = errors.New("no syslog address")
+
+// Facility is a syslog facility, as numbered by RFC 5424.
+type Facility int
+
+// The syslog facilities; kernel messages aren't among them, since they may
+// not be sent by programs.
+const (
+	FacilityUser Facility = iota + 1
+	FacilityMail
+	FacilityDaemon
+	FacilityAuth
+	FacilitySyslog
+	FacilityLPR
+	FacilityNews
+	FacilityUUCP
+	FacilityCron
+	FacilityAuthPriv
+	FacilityFTP
+)
+
+// The local use syslog facilities.
+const (
+	FacilityLocal0 Facility = iota + 16
+	FacilityLocal1
+	FacilityLocal2
+	FacilityLocal3
+	FacilityLocal4
+	FacilityLocal5
+	FacilityLocal6
+	FacilityLocal7
+)
+
+// Severity is a syslog severity, as numbered by RFC 5424.
+type Severity int
+
+// The syslog severities, from most to least severe.
+const (
+	SeverityEmergency Severity = iota
+	SeverityAlert
+	SeverityCritical
+	SeverityError
+	SeverityWarning
+	SeverityNotice
+	SeverityInfo
+	SeverityDebug
+)
+
+// LogMapping maps a source's text items to syslog facilities and severities.
+type LogMapping struct {
+	// Facility is the facility of every item; it defaults to FacilityUser.
+	Facility Facility
+
+	// Severity, if non-nil, picks each text item's severity, e.g. by
+	// looking for "ERROR" in it; otherwise all items are SeverityInfo.
+	Severity func(item []byte) Severity
+}
+
+func (lm LogMapping) facility() Facility {
+	if lm.Facility <= 0 {
+		return FacilityUser
+	}
+	return lm.Facility
+}
+
+func (lm LogMapping) severity(item []byte) Severity {
+	if lm.Severity == nil {
+		return SeverityInfo
+	}
+	return lm.Severity(item)
+}
+
+// SyslogConfig configures a reporter forwarding to a syslog server.
+type SyslogConfig struct {
+	BatchConfig
+	LogMapping
+
+	// Network is "udp", the default, "tcp", or "tls".
+	Network string
+
+	// Addr is the host:port of the syslog server; required.
+	Addr string
+
+	// TLSConfig configures "tls" connections.
+	TLSConfig *tls.Config
+
+	// Hostname and AppName identify the sender; they default to the host's
+	// name, and the program's base name.
+	Hostname string
+	AppName  string
+}
+
+// NewSyslogReporter creates a reporter forwarding the source's text items to
+// a syslog server, as RFC 5424 messages whose MSGID is the source's name.
+// Over "tcp" and "tls", messages are framed by octet counting, as per RFC
+// 6587.  The connection is dialed on first use, and again after any failure,
+// which drops the batch being sent.
+func NewSyslogReporter(src source.DataSource, cfg SyslogConfig) *PushReporter {
+	if cfg.Network == "" {
+		cfg.Network = "udp"
+	}
+	if cfg.Hostname == "" {
+		cfg.Hostname, _ = os.Hostname()
+	}
+	if cfg.AppName == "" {
+		cfg.AppName = filepath.Base(os.Args[0])
+	}
+	sl := &syslogSender{
+		cfg:    cfg,
+		header: syslogHeader(cfg, src.Name()),
+		framed: cfg.Network != "udp",
+	}
+	rep := newBatchReporter("syslog", src, cfg.BatchConfig.withDefaults(0), sl.send)
+	rep.format = "text"
+	rep.onStop = sl.close
+	return rep
+}
+
+// JournaldConfig configures a reporter forwarding to the local journald.
+type JournaldConfig struct {
+	BatchConfig
+	LogMapping
+
+	// Socket is the path of journald's socket; it defaults to
+	// "/run/systemd/journal/socket".
+	Socket string
+
+	// Identifier is the SYSLOG_IDENTIFIER of each entry; it defaults to the
+	// program's base name.
+	Identifier string
+}
+
+// NewJournaldReporter creates a reporter forwarding the source's text items to
+// the local journald, as entries with MESSAGE, PRIORITY, SYSLOG_FACILITY,
+// SYSLOG_IDENTIFIER, and GWR_SOURCE fields.
+func NewJournaldReporter(src source.DataSource, cfg JournaldConfig) *PushReporter {
+	if cfg.Socket == "" {
+		cfg.Socket = defaultJournaldSocket
+	}
+	if cfg.Identifier == "" {
+		cfg.Identifier = filepath.Base(os.Args[0])
+	}
+	jd := &journaldSender{cfg: cfg, src: src.Name()}
+	rep := newBatchReporter("journald", src, cfg.BatchConfig.withDefaults(0), jd.send)
+	rep.format = "text"
+	rep.onStop = jd.close
+	return rep
+}
+
+// syslogHeader formats the fields of an RFC 5424 header that follow the
+// timestamp.
+func syslogHeader(cfg SyslogConfig, name string) string {
+	return fmt.Sprintf("%s %s %d %s",
+		syslogField(cfg.Hostname, 255),
+		syslogField(cfg.AppName, maxSyslogAppName),
+		os.Getpid(),
+		syslogField(name, maxSyslogMsgID))
+}
+
+// syslogField makes a header field of printable ascii, at most max long; an
+// empty field is "-".
+func syslogField(s string, max int) string {
+	buf := []byte(s)
+	for i, c := range buf {
+		if c < 33 || c > 126 {
+			buf[i] = '_'
+		}
+	}
+	if len(buf) > max {
+		buf = buf[:max]
+	}
+	if len(buf) == 0 {
+		return "-"
+	}
+	return string(buf)
+}
+
+// syslogSender is the state of a syslog reporter, only used by its sending
+// goroutine.
+type syslogSender struct {
+	cfg    SyslogConfig
+	header string
+	framed bool
+	conn   net.Conn
+}
+
+func (sl *syslogSender) dial() error {
+	if sl.cfg.Addr == "" {
+		return errNoSyslogAddr
+	}
+	dialer := &net.Dialer{Timeout: syslogDialTimeout}
+	var err error
+	if sl.cfg.Network == "tls" {
+		sl.conn, err = tls.DialWithDialer(dialer, "tcp", sl.cfg.Addr, sl.cfg.TLSConfig)
+	} else {
+		sl.conn, err = dialer.Dial(sl.cfg.Network, sl.cfg.Addr)
+	}
+	return err
+}
+
+func (sl *syslogSender) send(items []pushItem) ([]pushItem, error) {
+	if sl.conn == nil {
+		if err := sl.dial(); err != nil {
+			return nil, err
+		}
+	}
+	pri := int(sl.cfg.facility()) * 8
+	var buf bytes.Buffer
+	for _, item := range items {
+		msg := bytes.TrimRight(item.data, "\n")
+		line := fmt.Sprintf("<%d>1 %s %s - %s",
+			pri+int(sl.cfg.severity(msg)),
+			item.t.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+			sl.header, msg)
+		if !sl.framed {
+			// one datagram per message
+			if _, err := sl.conn.Write([]byte(line)); err != nil {
+				sl.close()
+				return nil, err
+			}
+			continue
+		}
+		buf.WriteString(strconv.Itoa(len(line)))
+		buf.WriteByte(' ')
+		buf.WriteString(line)
+	}
+	if buf.Len() > 0 {
+		if _, err := sl.conn.Write(buf.Bytes()); err != nil {
+			sl.close()
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func (sl *syslogSender) close() {
+	if sl.conn != nil {
+		sl.conn.Close()
+		sl.conn = nil
+	}
+}
+
+// journaldSender is the state of a journald reporter, only used by its
+// sending goroutine.
+type journaldSender struct {
+	cfg  JournaldConfig
+	src  string
+	conn net.Conn
+}
+
+func (jd *journaldSender) send(items []pushItem) ([]pushItem, error) {
+	if jd.conn == nil {
+		conn, err := net.Dial("unixgram", jd.cfg.Socket)
+		if err != nil {
+			return nil, err
+		}
+		jd.conn = conn
+	}
+	facility := jd.cfg.facility()
+	for _, item := range items {
+		msg := bytes.TrimRight(item.data, "\n")
+		var buf bytes.Buffer
+		journaldField(&buf, "MESSAGE", msg)
+		journaldField(&buf, "PRIORITY", []byte(strconv.Itoa(int(jd.cfg.severity(msg)))))
+		journaldField(&buf, "SYSLOG_FACILITY", []byte(strconv.Itoa(int(facility))))
+		journaldField(&buf, "SYSLOG_IDENTIFIER", []byte(jd.cfg.Identifier))
+		journaldField(&buf, "GWR_SOURCE", []byte(jd.src))
+		if _, err := jd.conn.Write(buf.Bytes()); err != nil {
+			jd.close()
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+// journaldField appends a field in journald's native protocol: values with
+// newlines are written as a little endian length, followed by the value.
+func journaldField(buf *bytes.Buffer, name string, val []byte) {
+	buf.WriteString(name)
+	if bytes.IndexByte(val, '\n') < 0 {
+		buf.WriteByte('=')
+		buf.Write(val)
+		buf.WriteByte('\n')
+		return
+	}
+	buf.WriteByte('\n')
+	binary.Write(buf, binary.LittleEndian, uint64(len(val)))
+	buf.Write(val)
+	buf.WriteByte('\n')
+}
+
+func (jd *journaldSender) close() {
+	if jd.conn != nil {
+		jd.conn.Close()
+		jd.conn = nil
+	}
+}
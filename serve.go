@@ -22,19 +22,58 @@ package gwr
 
 import (
 	"bufio"
+	"context"
+	"crypto/tls"
 	"errors"
 	"net"
 	"net/http"
+	"sync"
 
 	"github.com/uber-go/gwr/internal/protocol"
 	"github.com/uber-go/gwr/internal/resp"
 	"github.com/uber-go/gwr/source"
 
 	"github.com/uber-common/stacked"
+	"golang.org/x/net/http2"
+	xh2c "golang.org/x/net/http2/h2c"
 )
 
 var errNoServer = errors.New("no server configured")
 
+// ErrInvalidDetector is returned by RegisterProtocol for a detector that
+// doesn't test connections, which would take every one of them.
+var ErrInvalidDetector = errors.New("protocol detector must have a Test and Needed bytes")
+
+var (
+	protocolsLock sync.Mutex
+	protocols     []stacked.Detector
+)
+
+// RegisterProtocol adds a detector for another protocol, e.g. gRPC, to every
+// "auto" protocol server created after it's called, by NewServer,
+// ListenAndServe, or a ConfiguredServer.  Registered detectors are tried in
+// the order registered, after RESP, and before HTTP, which takes any
+// connection that no other detector does.
+func RegisterProtocol(detector stacked.Detector) error {
+	if detector.Test == nil || detector.Needed <= 0 || detector.Handler == nil {
+		return ErrInvalidDetector
+	}
+	protocolsLock.Lock()
+	protocols = append(protocols, detector)
+	protocolsLock.Unlock()
+	return nil
+}
+
+// detectors returns the detectors for an "auto" protocol server.
+func detectors(rh *protocol.RedisHandler, hh *protocol.HTTPRest, h2c bool) []stacked.Detector {
+	protocolsLock.Lock()
+	defer protocolsLock.Unlock()
+	ds := make([]stacked.Detector, 0, len(protocols)+2)
+	ds = append(ds, respDetector(rh))
+	ds = append(ds, protocols...)
+	return append(ds, httpDetector(hh, h2c))
+}
+
 type indirectServer struct {
 	cs **ConfiguredServer
 }
@@ -47,6 +86,14 @@ func (is indirectServer) Addr() net.Addr {
 	return srv.Addr()
 }
 
+func (is indirectServer) Addrs() []net.Addr {
+	srv := *(is.cs)
+	if srv == nil {
+		return nil
+	}
+	return srv.Addrs()
+}
+
 func (is indirectServer) StartOn(laddr string) error {
 	srv := *(is.cs)
 	if srv == nil {
@@ -63,9 +110,12 @@ func (is indirectServer) Stop() error {
 	return srv.Stop()
 }
 
+// defaultHTTPRest is the handler added under "/gwr/" to the default http
+// server; Configure sets its auth.
+var defaultHTTPRest = protocol.NewHTTPRest(DefaultDataSources, "/gwr", indirectServer{&theServer})
+
 func init() {
-	hh := protocol.NewHTTPRest(DefaultDataSources, "/gwr", indirectServer{&theServer})
-	http.Handle("/gwr/", hh)
+	http.Handle("/gwr/", defaultHTTPRest)
 }
 
 // ListenAndServeResp starts a resp protocol gwr server.
@@ -86,19 +136,102 @@ func ListenAndServeHTTP(hostPort string, dss *source.DataSources) error {
 }
 
 // NewServer creates an "auto" protocol server that will respond to HTTP or
-// RESP requests.
+// RESP requests, or those of any protocol added by RegisterProtocol.
 func NewServer(dss *source.DataSources) stacked.Server {
+	srv, _, _ := newServer(dss, indirectServer{&theServer}, nil, false)
+	return srv
+}
+
+// shutdowner is implemented by the protocol handlers that have active
+// streams to end at shutdown.
+type shutdowner interface {
+	Shutdown(ctx context.Context) error
+}
+
+// newServer creates an "auto" protocol server, whose "/listen" endpoint
+// manages servable.
+func newServer(
+	dss *source.DataSources,
+	servable protocol.Servable,
+	auth source.AuthFunc,
+	h2c bool,
+) (stacked.Server, *protocol.HTTPRest, *protocol.RedisHandler) {
 	if dss == nil {
 		dss = DefaultDataSources
 	}
-	hh := protocol.NewHTTPRest(dss, "", indirectServer{&theServer})
+	hh := protocol.NewHTTPRest(dss, "", servable)
+	hh.SetAuth(auth)
 	rh := protocol.NewRedisHandler(dss)
-	return stacked.NewServer(
-		respDetector(rh),
-		stacked.DefaultHTTPHandler(hh),
-	)
+	rh.SetAuth(auth)
+	return stacked.NewServer(detectors(rh, hh, h2c)...), hh, rh
+}
+
+// httpDetector is like stacked.DefaultHTTPHandler, except that requests over
+// TLS connections get their http.Request.TLS state, which the http server
+// can't see through the buffering conn wrapper.  If h2c is true, cleartext
+// HTTP/2 is also served, to clients that either start with the HTTP/2
+// preface, or upgrade an HTTP/1.1 request.
+func httpDetector(hndl http.Handler, h2c bool) stacked.Detector {
+	ln := &connListener{conns: make(chan net.Conn)}
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil {
+			if state, ok := r.Context().Value(tlsStateKey{}).(*tls.ConnectionState); ok {
+				r.TLS = state
+			}
+		}
+		hndl.ServeHTTP(w, r)
+	})
+	if h2c {
+		handler = xh2c.NewHandler(handler, &http2.Server{})
+	}
+	srv := &http.Server{
+		Handler: handler,
+		ConnContext: func(ctx context.Context, conn net.Conn) context.Context {
+			if bc, ok := conn.(bufferedConn); ok {
+				if tc, ok := bc.Conn.(*tls.Conn); ok {
+					state := tc.ConnectionState()
+					ctx = context.WithValue(ctx, tlsStateKey{}, &state)
+				}
+			}
+			return ctx
+		},
+	}
+	go srv.Serve(ln)
+	return stacked.Detector{
+		Needed: 0,
+		Handler: stacked.HandlerFunc(func(conn net.Conn, bufr *bufio.Reader) {
+			ln.conns <- bufferedConn{conn, bufr}
+		}),
+	}
+}
+
+type tlsStateKey struct{}
+
+// bufferedConn reads through the reader that the stacked server peeked with.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
 }
 
+func (bc bufferedConn) Read(p []byte) (int, error) {
+	return bc.r.Read(p)
+}
+
+// connListener hands connections passed on by a stacked.Detector to an
+// http.Server.
+type connListener struct {
+	conns chan net.Conn
+}
+
+func (cl *connListener) Accept() (net.Conn, error) { return <-cl.conns, nil }
+func (cl *connListener) Close() error              { return nil }
+func (cl *connListener) Addr() net.Addr            { return connListenerAddr{} }
+
+type connListenerAddr struct{}
+
+func (connListenerAddr) Network() string { return "stacked" }
+func (connListenerAddr) String() string  { return "stacked" }
+
 func respDetector(respHandler resp.RedisHandler) stacked.Detector {
 	hndl := stacked.HandlerFunc(func(conn net.Conn, bufr *bufio.Reader) {
 		resp.NewRedisConnection(conn, bufr).Handle(respHandler)
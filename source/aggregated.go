@@ -0,0 +1,346 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package source
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+var aggregateTextTemplate = template.Must(template.New("aggregate").Parse(`
+{{- define "item" -}}
+{{ .Start.Format "15:04:05" }} count={{ .Count }} rate={{ printf "%.2f" .Rate }}/s
+{{- if .Values }} min={{ .Min }} mean={{ printf "%.2f" .Mean }} p50={{ .P50 }} p90={{ .P90 }} p99={{ .P99 }} max={{ .Max }}{{ end }}
+{{- end -}}
+`))
+
+// Aggregate is a window of items summarized by Aggregated.  The value
+// statistics only cover items with a numeric value in the aggregated field.
+type Aggregate struct {
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	Count    int           `json:"count"`
+	Rate     float64       `json:"rate"`
+	Values   int           `json:"values"`
+	Min      float64       `json:"min"`
+	Max      float64       `json:"max"`
+	Mean     float64       `json:"mean"`
+	P50      float64       `json:"p50"`
+	P90      float64       `json:"p90"`
+	P99      float64       `json:"p99"`
+}
+
+// Aggregated wraps a WatchableDataSource to derive a source, named like
+// "<name>/agg", which emits an Aggregate of the wrapped source's items every
+// window: their count, rate, and percentiles of a numeric field.
+//
+// Since Aggregated becomes the wrapped source's watcher, the wrapped source's
+// raw items are served by the source returned from Raw, which should be added
+// in its place.
+type Aggregated struct {
+	src   WatchableDataSource
+	field string
+	every time.Duration
+	raw   *rawSource
+
+	lock    sync.Mutex
+	watcher GenericDataWatcher
+	running bool
+	start   time.Time
+	count   int
+	values  []float64
+}
+
+// NewAggregated creates an Aggregated source over src, emitting aggregates of
+// the given field every window.  The field is looked up by key in map items,
+// and by name, or json tag, in struct items.
+func NewAggregated(src WatchableDataSource, field string, every time.Duration) *Aggregated {
+	agg := &Aggregated{
+		src:   src,
+		field: field,
+		every: every,
+	}
+	agg.raw = &rawSource{agg: agg}
+	src.SetWatcher(aggregatedWatcher{agg})
+	return agg
+}
+
+// Raw returns a source that serves the wrapped source's items, under its
+// original name.
+func (agg *Aggregated) Raw() WatchableDataSource {
+	return agg.raw
+}
+
+// Name returns the wrapped source's name with "/agg" appended.
+func (agg *Aggregated) Name() string {
+	return agg.src.Name() + "/agg"
+}
+
+// Inputs returns the wrapped source's name; see DerivedSource.
+func (agg *Aggregated) Inputs() []string {
+	return []string{agg.src.Name()}
+}
+
+// TextTemplate returns a template for a one line summary of each aggregate.
+func (agg *Aggregated) TextTemplate() *template.Template {
+	return aggregateTextTemplate
+}
+
+// SetWatcher adds a watcher at source addition time.
+func (agg *Aggregated) SetWatcher(watcher GenericDataWatcher) {
+	agg.lock.Lock()
+	agg.watcher = AddWatcher(agg.watcher, watcher)
+	agg.lock.Unlock()
+}
+
+// Activate starts a new window, and the wrapped source if needed.
+func (agg *Aggregated) Activate() {
+	agg.lock.Lock()
+	if !agg.running {
+		agg.running = true
+		agg.start = time.Now()
+		agg.count = 0
+		agg.values = agg.values[:0]
+		go agg.emitWindows()
+	}
+	agg.lock.Unlock()
+	agg.activateSource()
+}
+
+func (agg *Aggregated) activateSource() {
+	if actsrc, ok := agg.src.(ActivateWatchableDataSource); ok {
+		actsrc.Activate()
+	}
+}
+
+func (agg *Aggregated) active() bool {
+	agg.lock.Lock()
+	defer agg.lock.Unlock()
+	return agg.running
+}
+
+// emitWindows emits an aggregate every window, until there are no watchers.
+func (agg *Aggregated) emitWindows() {
+	ticker := time.NewTicker(agg.every)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		agg.lock.Lock()
+		watcher := agg.watcher
+		if watcher == nil || !watcher.Active() {
+			agg.running = false
+			agg.lock.Unlock()
+			return
+		}
+		window := agg.window(now)
+		agg.lock.Unlock()
+		watcher.HandleItem(window)
+	}
+}
+
+// window summarizes, and resets, the current window; the lock must be held.
+func (agg *Aggregated) window(now time.Time) Aggregate {
+	window := Aggregate{
+		Start:    agg.start,
+		Duration: now.Sub(agg.start),
+		Count:    agg.count,
+		Values:   len(agg.values),
+	}
+	if secs := window.Duration.Seconds(); secs > 0 {
+		window.Rate = float64(agg.count) / secs
+	}
+	if n := len(agg.values); n > 0 {
+		sort.Float64s(agg.values)
+		var sum float64
+		for _, val := range agg.values {
+			sum += val
+		}
+		window.Min = agg.values[0]
+		window.Max = agg.values[n-1]
+		window.Mean = sum / float64(n)
+		window.P50 = percentile(agg.values, 0.5)
+		window.P90 = percentile(agg.values, 0.9)
+		window.P99 = percentile(agg.values, 0.99)
+	}
+	agg.start = now
+	agg.count = 0
+	agg.values = agg.values[:0]
+	return window
+}
+
+// percentile returns the nearest-rank percentile of sorted values.
+func percentile(sorted []float64, p float64) float64 {
+	i := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+func (agg *Aggregated) add(items ...interface{}) {
+	agg.lock.Lock()
+	defer agg.lock.Unlock()
+	if !agg.running {
+		return
+	}
+	for _, item := range items {
+		agg.count++
+		if val, ok := numericField(item, agg.field); ok {
+			agg.values = append(agg.values, val)
+		}
+	}
+}
+
+// numericField returns the named field of a map or struct item, if it has a
+// numeric value.
+func numericField(item interface{}, field string) (float64, bool) {
+	val := reflect.ValueOf(item)
+	for val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface {
+		if val.IsNil() {
+			return 0, false
+		}
+		val = val.Elem()
+	}
+
+	switch val.Kind() {
+	case reflect.Map:
+		if val.Type().Key().Kind() != reflect.String {
+			return 0, false
+		}
+		val = val.MapIndex(reflect.ValueOf(field).Convert(val.Type().Key()))
+	case reflect.Struct:
+		val = structField(val, field)
+	default:
+		return 0, false
+	}
+	for val.Kind() == reflect.Interface || val.Kind() == reflect.Ptr {
+		if val.IsNil() {
+			return 0, false
+		}
+		val = val.Elem()
+	}
+
+	switch val.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(val.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(val.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return val.Float(), true
+	default:
+		return 0, false
+	}
+}
+
+func structField(val reflect.Value, field string) reflect.Value {
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		tag := strings.Split(sf.Tag.Get("json"), ",")[0]
+		if sf.Name == field || tag == field {
+			return val.Field(i)
+		}
+	}
+	return reflect.Value{}
+}
+
+// aggregatedWatcher is the watcher that Aggregated sets on its wrapped source,
+// it's active while either the aggregate or raw source is.
+type aggregatedWatcher struct {
+	agg *Aggregated
+}
+
+func (aw aggregatedWatcher) Active() bool {
+	return !Disabled() && (aw.agg.active() || aw.agg.raw.active())
+}
+
+func (aw aggregatedWatcher) HandleItem(item interface{}) bool {
+	aw.agg.add(item)
+	if watcher := aw.agg.raw.activeWatcher(); watcher != nil {
+		watcher.HandleItem(item)
+	}
+	return aw.Active()
+}
+
+func (aw aggregatedWatcher) HandleItems(items []interface{}) bool {
+	aw.agg.add(items...)
+	if watcher := aw.agg.raw.activeWatcher(); watcher != nil {
+		watcher.HandleItems(items)
+	}
+	return aw.Active()
+}
+
+// rawSource serves the items of a source wrapped by Aggregated.
+type rawSource struct {
+	agg *Aggregated
+
+	lock    sync.Mutex
+	watcher GenericDataWatcher
+}
+
+func (raw *rawSource) Name() string {
+	return raw.agg.src.Name()
+}
+
+func (raw *rawSource) TextTemplate() *template.Template {
+	if txtsrc, ok := raw.agg.src.(TextTemplatedSource); ok {
+		return txtsrc.TextTemplate()
+	}
+	return nil
+}
+
+func (raw *rawSource) Formats() map[string]GenericDataFormat {
+	if fmtsrc, ok := raw.agg.src.(GenericDataSourceFormats); ok {
+		return fmtsrc.Formats()
+	}
+	return nil
+}
+
+func (raw *rawSource) SetWatcher(watcher GenericDataWatcher) {
+	raw.lock.Lock()
+	raw.watcher = AddWatcher(raw.watcher, watcher)
+	raw.lock.Unlock()
+}
+
+func (raw *rawSource) Activate() {
+	raw.agg.activateSource()
+}
+
+func (raw *rawSource) activeWatcher() GenericDataWatcher {
+	raw.lock.Lock()
+	watcher := raw.watcher
+	raw.lock.Unlock()
+	if watcher == nil || !watcher.Active() {
+		return nil
+	}
+	return watcher
+}
+
+func (raw *rawSource) active() bool {
+	return raw.activeWatcher() != nil
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package source_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/uber-go/gwr/source"
+)
+
+type chanWatcher struct {
+	sync.Mutex
+	active bool
+	items  chan interface{}
+}
+
+func (cw *chanWatcher) Active() bool {
+	cw.Lock()
+	defer cw.Unlock()
+	return cw.active
+}
+
+func (cw *chanWatcher) setActive(active bool) {
+	cw.Lock()
+	cw.active = active
+	cw.Unlock()
+}
+
+func (cw *chanWatcher) HandleItem(item interface{}) bool {
+	cw.items <- item
+	return true
+}
+
+func (cw *chanWatcher) HandleItems(items []interface{}) bool {
+	for _, item := range items {
+		cw.items <- item
+	}
+	return true
+}
+
+type latency struct {
+	Path    string  `json:"path"`
+	Elapsed float64 `json:"elapsed_ms"`
+}
+
+func TestAggregated(t *testing.T) {
+	src := &itemSource{}
+	agg := source.NewAggregated(src, "elapsed_ms", 10*time.Millisecond)
+	assert.Equal(t, "/items/agg", agg.Name())
+	assert.Equal(t, "/items", agg.Raw().Name())
+	assert.False(t, src.watcher.Active(), "inactive until watched")
+
+	aw := &chanWatcher{active: true, items: make(chan interface{}, 10)}
+	agg.SetWatcher(aw)
+	agg.Activate()
+	assert.True(t, src.watcher.Active(), "active while the aggregate is watched")
+
+	var items []interface{}
+	for i := 1; i <= 100; i++ {
+		items = append(items, latency{"/foo", float64(i)})
+	}
+	items = append(items, map[string]interface{}{"elapsed_ms": 1000}, "no value")
+	src.watcher.HandleItems(items)
+
+	window := (<-aw.items).(source.Aggregate)
+	assert.Equal(t, 102, window.Count)
+	assert.Equal(t, 101, window.Values)
+	assert.Equal(t, 1.0, window.Min)
+	assert.Equal(t, 1000.0, window.Max)
+	assert.Equal(t, 51.0, window.P50)
+	assert.Equal(t, 91.0, window.P90)
+	assert.Equal(t, 100.0, window.P99)
+	assert.True(t, window.Rate > 0, "has a rate")
+
+	rw := &chanWatcher{active: true, items: make(chan interface{}, 10)}
+	agg.Raw().SetWatcher(rw)
+	src.watcher.HandleItem("raw")
+	assert.Equal(t, "raw", <-rw.items, "raw items passed on")
+
+	aw.setActive(false)
+	rw.setActive(false)
+	time.Sleep(50 * time.Millisecond)
+	assert.False(t, src.watcher.Active(), "inactive once unwatched")
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package source
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+)
+
+// ErrUnauthenticated should be returned by an AuthFunc when a request didn't
+// present valid credentials; any other error means that the credentials
+// aren't allowed the access.
+var ErrUnauthenticated = errors.New("authentication required")
+
+// AuthRequest describes an attempt to access a data source.
+type AuthRequest struct {
+	// Source is the name of the data source being accessed; it's empty for
+	// server management, like the HTTP "/listen" endpoint.
+	Source string
+
+	// Verb is "get", "watch", "action", or "listen".
+	Verb string
+
+	// Protocol is "http" or "resp".
+	Protocol string
+
+	// Token is any bearer token presented: an "Authorization: Bearer"
+	// header over HTTP, or the argument of an "auth" command over RESP.
+	Token string
+
+	// RemoteAddr is the address of the client.
+	RemoteAddr string
+
+	// Label is any label that the client attached to the request, e.g. with
+	// a "label" query parameter over HTTP, to attribute its watch; see
+	// WithWatchLabel.  It's meant for audit logs, not for authorization.
+	Label string
+
+	// TLS is the state of the client connection, if it's over TLS; any
+	// verified client certificates are in TLS.VerifiedChains.
+	TLS *tls.ConnectionState
+}
+
+// AuthFunc authorizes an AuthRequest; any non-nil error refuses it.
+type AuthFunc func(req *AuthRequest) error
+
+// TokenAuth returns an AuthFunc that requires the given token.
+func TokenAuth(token string) AuthFunc {
+	want := []byte(token)
+	return func(req *AuthRequest) error {
+		if subtle.ConstantTimeCompare([]byte(req.Token), want) != 1 {
+			return ErrUnauthenticated
+		}
+		return nil
+	}
+}
+
+// AllAuth returns an AuthFunc that requires every non-nil AuthFunc given to
+// authorize a request, or nil if none are given.
+func AllAuth(fns ...AuthFunc) AuthFunc {
+	var all []AuthFunc
+	for _, fn := range fns {
+		if fn != nil {
+			all = append(all, fn)
+		}
+	}
+	switch len(all) {
+	case 0:
+		return nil
+	case 1:
+		return all[0]
+	}
+	return func(req *AuthRequest) error {
+		for _, fn := range all {
+			if err := fn(req); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
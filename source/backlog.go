@@ -0,0 +1,53 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package source
+
+import "context"
+
+type backlogKey struct{}
+
+// WithBacklog returns a context asking that a watch start with up to n of its
+// source's most recent items, rather than its init data, if the source is a
+// BacklogDataSource; n < 1 returns ctx as is.  Watches made through
+// ContextDataSource.WatchContext with the context then tell their writer, if
+// it's a BacklogWriter, where the backlog ends, before any live items are
+// written.
+func WithBacklog(ctx context.Context, n int) context.Context {
+	if n < 1 {
+		return ctx
+	}
+	return context.WithValue(ctx, backlogKey{}, n)
+}
+
+// ContextBacklog returns the backlog asked for by WithBacklog, if any.
+func ContextBacklog(ctx context.Context) int {
+	n, _ := ctx.Value(backlogKey{}).(int)
+	return n
+}
+
+// BacklogWriter is an optional interface for the writer passed to
+// ContextDataSource.WatchContext with a context from WithBacklog.
+type BacklogWriter interface {
+	// EndBacklog is called once the backlog, of n items, has been written,
+	// and before any live items are; n is 0 if the source retains no
+	// items, in which case any init data preceded the call.
+	EndBacklog(n int) error
+}
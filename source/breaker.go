@@ -0,0 +1,45 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package source
+
+import (
+	"fmt"
+	"time"
+)
+
+// TrippedError describes a format that has been disabled for a data source
+// after repeatedly failing to marshal its items.  It is sent to the format's
+// watchers as a final error frame, before they're closed, and is reported in
+// the data source's attrs until the format is re-enabled.
+type TrippedError struct {
+	Source   string    `json:"source"`
+	Format   string    `json:"format"`
+	Failures int       `json:"failures"`
+	Err      string    `json:"error"`
+	Time     time.Time `json:"time"`
+	Until    time.Time `json:"until"`
+}
+
+// Error returns a short description of the last marshaling failure.
+func (te *TrippedError) Error() string {
+	return fmt.Sprintf("%s: %s format disabled after %d marshaling failures: %s",
+		te.Source, te.Format, te.Failures, te.Err)
+}
@@ -0,0 +1,210 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package source
+
+import (
+	"sync"
+	"text/template"
+)
+
+// bufferedTextTemplates are added to a wrapped source's text template, if it
+// defines an "item" template but no "get" or "init" ones, to render the
+// buffered items one per line.
+var bufferedTextTemplates = map[string]string{
+	"get":  `{{range .}}{{template "item" .}}` + "\n" + `{{end}}`,
+	"init": `{{range .}}{{template "item" .}}` + "\n" + `{{end}}`,
+}
+
+// Buffered wraps a WatchableDataSource, retaining the last N items that it
+// emits, to make it Get-able and WatchInit-able: a Get returns the retained
+// items, oldest first, and every new watch stream starts with them.
+//
+// Since the buffer must be kept full whether or not there are any watchers,
+// the wrapped source always sees an active watcher, unless gwr is disabled.
+type Buffered struct {
+	src WatchableDataSource
+
+	lock    sync.Mutex
+	items   []interface{}
+	next    int
+	full    bool
+	watcher GenericDataWatcher
+}
+
+// NewBuffered creates a Buffered wrapper around the given source, retaining
+// its last n items.  If the source implements ActivateWatchableDataSource, it
+// is activated immediately, since the wrapper is always watching it.
+func NewBuffered(src WatchableDataSource, n int) *Buffered {
+	if n < 1 {
+		n = 1
+	}
+	buf := &Buffered{
+		src:   src,
+		items: make([]interface{}, n),
+	}
+	src.SetWatcher(bufferedWatcher{buf})
+	if actsrc, ok := src.(ActivateWatchableDataSource); ok {
+		actsrc.Activate()
+	}
+	return buf
+}
+
+// Name returns the wrapped source's name.
+func (buf *Buffered) Name() string {
+	return buf.src.Name()
+}
+
+// TextTemplate returns the wrapped source's text template, if any, extended
+// with "get" and "init" templates that render each buffered item with the
+// "item" template.
+func (buf *Buffered) TextTemplate() *template.Template {
+	txtsrc, ok := buf.src.(TextTemplatedSource)
+	if !ok {
+		return nil
+	}
+	tmpl := txtsrc.TextTemplate()
+	if tmpl == nil || tmpl.Lookup("item") == nil {
+		return tmpl
+	}
+	tmpl, err := tmpl.Clone()
+	if err != nil {
+		return txtsrc.TextTemplate()
+	}
+	for name, text := range bufferedTextTemplates {
+		if tmpl.Lookup(name) != nil {
+			continue
+		}
+		if _, err := tmpl.New(name).Parse(text); err != nil {
+			return txtsrc.TextTemplate()
+		}
+	}
+	return tmpl
+}
+
+// Formats returns the wrapped source's formats, if any.
+func (buf *Buffered) Formats() map[string]GenericDataFormat {
+	if fmtsrc, ok := buf.src.(GenericDataSourceFormats); ok {
+		return fmtsrc.Formats()
+	}
+	return nil
+}
+
+// QoS returns the wrapped source's QoSClass, if any.
+func (buf *Buffered) QoS() QoSClass {
+	if qossrc, ok := buf.src.(QoSDataSource); ok {
+		return qossrc.QoS()
+	}
+	return QoSStandard
+}
+
+// Get returns the buffered items, oldest first.
+func (buf *Buffered) Get() interface{} {
+	return buf.snapshot()
+}
+
+// WatchInit returns the buffered items, oldest first.
+func (buf *Buffered) WatchInit() interface{} {
+	return buf.snapshot()
+}
+
+// Backlog returns up to the last n buffered items, oldest first.
+func (buf *Buffered) Backlog(n int) []interface{} {
+	items := buf.snapshot()
+	if n < len(items) {
+		items = items[len(items)-n:]
+	}
+	return items
+}
+
+// SetWatcher adds a watcher that items are passed on to, after buffering.
+func (buf *Buffered) SetWatcher(watcher GenericDataWatcher) {
+	buf.lock.Lock()
+	buf.watcher = AddWatcher(buf.watcher, watcher)
+	buf.lock.Unlock()
+}
+
+// SampleItem returns the most recently buffered item, if any.
+func (buf *Buffered) SampleItem() (interface{}, bool) {
+	buf.lock.Lock()
+	defer buf.lock.Unlock()
+	if buf.next == 0 && !buf.full {
+		return nil, false
+	}
+	i := buf.next - 1
+	if i < 0 {
+		i = len(buf.items) - 1
+	}
+	return buf.items[i], true
+}
+
+func (buf *Buffered) snapshot() []interface{} {
+	buf.lock.Lock()
+	defer buf.lock.Unlock()
+	items := make([]interface{}, 0, len(buf.items))
+	if buf.full {
+		items = append(items, buf.items[buf.next:]...)
+	}
+	return append(items, buf.items[:buf.next]...)
+}
+
+// add buffers the items, returning the downstream watcher to pass them to.
+func (buf *Buffered) add(items ...interface{}) GenericDataWatcher {
+	buf.lock.Lock()
+	defer buf.lock.Unlock()
+	for _, item := range items {
+		buf.items[buf.next] = item
+		buf.next++
+		if buf.next == len(buf.items) {
+			buf.next = 0
+			buf.full = true
+		}
+	}
+	return buf.watcher
+}
+
+// bufferedWatcher is the watcher that Buffered sets on its wrapped source.
+type bufferedWatcher struct {
+	buf *Buffered
+}
+
+func (bw bufferedWatcher) Active() bool {
+	return !Disabled()
+}
+
+func (bw bufferedWatcher) HandleItem(item interface{}) bool {
+	if Disabled() {
+		return false
+	}
+	if watcher := bw.buf.add(item); watcher != nil && watcher.Active() {
+		watcher.HandleItem(item)
+	}
+	return true
+}
+
+func (bw bufferedWatcher) HandleItems(items []interface{}) bool {
+	if Disabled() {
+		return false
+	}
+	if watcher := bw.buf.add(items...); watcher != nil && watcher.Active() {
+		watcher.HandleItems(items)
+	}
+	return true
+}
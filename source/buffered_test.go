@@ -0,0 +1,142 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package source_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber-go/gwr/internal/marshaled"
+	"github.com/uber-go/gwr/source"
+)
+
+type itemSource struct {
+	watcher source.GenericDataWatcher
+}
+
+func (is *itemSource) Name() string { return "/items" }
+
+func (is *itemSource) TextTemplate() *template.Template {
+	return template.Must(template.New("items").Parse(`{{define "item"}}item {{.}}{{end}}`))
+}
+
+func (is *itemSource) SetWatcher(watcher source.GenericDataWatcher) {
+	is.watcher = watcher
+}
+
+type sliceWatcher struct {
+	items []interface{}
+}
+
+func (sw *sliceWatcher) Active() bool { return true }
+
+func (sw *sliceWatcher) HandleItem(item interface{}) bool {
+	sw.items = append(sw.items, item)
+	return true
+}
+
+func (sw *sliceWatcher) HandleItems(items []interface{}) bool {
+	sw.items = append(sw.items, items...)
+	return true
+}
+
+func TestBuffered(t *testing.T) {
+	src := &itemSource{}
+	buf := source.NewBuffered(src, 3)
+	assert.True(t, src.watcher.Active(), "wrapped source is always watched")
+	assert.Equal(t, []interface{}{}, buf.Get())
+
+	src.watcher.HandleItem(1)
+	src.watcher.HandleItems([]interface{}{2})
+	assert.Equal(t, []interface{}{1, 2}, buf.Get())
+
+	var sw sliceWatcher
+	buf.SetWatcher(&sw)
+	src.watcher.HandleItems([]interface{}{3, 4})
+	src.watcher.HandleItem(5)
+	assert.Equal(t, []interface{}{3, 4, 5}, buf.Get(), "oldest items dropped")
+	assert.Equal(t, []interface{}{3, 4, 5}, buf.WatchInit())
+	assert.Equal(t, []interface{}{3, 4, 5}, sw.items, "items passed on")
+
+	mds := marshaled.NewDataSource(buf, nil)
+	var out bytes.Buffer
+	assert.NoError(t, mds.Get("text", &out))
+	assert.Equal(t, "item 3\nitem 4\nitem 5\n", out.String())
+}
+
+func TestBuffered_SampleFormats(t *testing.T) {
+	src := &itemSource{}
+	buf := source.NewBuffered(src, 2)
+	mds := marshaled.NewDataSource(buf, nil)
+
+	_, err := mds.SampleFormats()
+	assert.Equal(t, source.ErrNoSample, err, "nothing buffered yet")
+
+	src.watcher.HandleItems([]interface{}{1, 2, 3})
+	item, ok := buf.SampleItem()
+	assert.True(t, ok)
+	assert.Equal(t, 3, item, "latest item sampled")
+
+	samples, err := mds.SampleFormats()
+	assert.NoError(t, err)
+	assert.Equal(t, map[string][]byte{
+		"html":  []byte(`<span class="number">3</span>` + "\n"),
+		"json":  []byte("3\n"),
+		"table": []byte("3\n"),
+		"text":  []byte("item 3\n"),
+	}, samples)
+}
+
+// backlogBuffer marks where a watch's backlog ends.
+type backlogBuffer struct {
+	bytes.Buffer
+}
+
+func (bb *backlogBuffer) EndBacklog(n int) error {
+	fmt.Fprintf(bb, "-- %d --\n", n)
+	return nil
+}
+
+func TestBuffered_Backlog(t *testing.T) {
+	src := &itemSource{}
+	buf := source.NewBuffered(src, 3)
+	assert.Equal(t, []interface{}{}, buf.Backlog(2))
+
+	src.watcher.HandleItems([]interface{}{1, 2, 3, 4})
+	assert.Equal(t, []interface{}{3, 4}, buf.Backlog(2), "newest items")
+	assert.Equal(t, []interface{}{2, 3, 4}, buf.Backlog(5), "all buffered items")
+
+	mds := marshaled.NewDataSource(buf, nil)
+	var out backlogBuffer
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, mds.WatchContext(source.WithBacklog(ctx, 2), "text", &out))
+	src.watcher.HandleItem(5)
+	mds.Drain()
+	assert.Equal(t, "item 3\nitem 4\n-- 2 --\nitem 5\n", out.String(),
+		"backlog in place of init data, then live items")
+}
@@ -0,0 +1,232 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package source
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// DelimitedFormat is a GenericDataFormat that renders flat items, such as
+// structs or maps of scalars, as rows of delimited values, e.g. CSV or TSV,
+// so that a watch may be piped straight into a spreadsheet or awk.
+//
+// Each item is rendered as it would be in json, so that its columns are named
+// by their json fields, and any value that isn't a string, number, or bool is
+// written as json.  Get and init data that are slices are rendered as a row per
+// element.  Unless NoHeader is set, a row of the column names starts every get
+// and watch stream.
+type DelimitedFormat struct {
+	// Comma separates the values of each row, e.g. ',' or '\t'.
+	Comma rune
+
+	// Columns names the json fields rendered, in order.
+	Columns []string
+
+	// NoHeader omits the row of column names.
+	NoHeader bool
+}
+
+// NewCSVFormat returns a DelimitedFormat of comma separated values, with the
+// columns of the example item; see ColumnsOf.
+func NewCSVFormat(example interface{}) *DelimitedFormat {
+	return &DelimitedFormat{Comma: ',', Columns: ColumnsOf(example)}
+}
+
+// NewTSVFormat returns a DelimitedFormat of tab separated values, with the
+// columns of the example item; see ColumnsOf.
+func NewTSVFormat(example interface{}) *DelimitedFormat {
+	return &DelimitedFormat{Comma: '\t', Columns: ColumnsOf(example)}
+}
+
+// ColumnsOf returns the json field names of the example item: for a struct,
+// those of its exported fields, in order, including those of any embedded
+// structs; or for a map, its sorted keys.
+func ColumnsOf(example interface{}) []string {
+	val := reflect.Indirect(reflect.ValueOf(example))
+	switch val.Kind() {
+	case reflect.Struct:
+		return structColumns(val.Type(), nil)
+	case reflect.Map:
+		cols := make([]string, 0, val.Len())
+		for _, key := range val.MapKeys() {
+			cols = append(cols, fmt.Sprint(key.Interface()))
+		}
+		sort.Strings(cols)
+		return cols
+	default:
+		return nil
+	}
+}
+
+func structColumns(t reflect.Type, cols []string) []string {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _ := parseJSONTag(field.Tag.Get("json"))
+		if name == "-" {
+			continue
+		}
+		ft := field.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if field.Anonymous && name == "" && ft.Kind() == reflect.Struct {
+			cols = structColumns(ft, cols)
+			continue
+		}
+		if field.PkgPath != "" {
+			continue // unexported
+		}
+		if name == "" {
+			name = field.Name
+		}
+		cols = append(cols, name)
+	}
+	return cols
+}
+
+func parseJSONTag(tag string) (string, string) {
+	if i := strings.IndexByte(tag, ','); i >= 0 {
+		return tag[:i], tag[i+1:]
+	}
+	return tag, ""
+}
+
+// Header returns the row of column names, unless NoHeader is set.
+func (df *DelimitedFormat) Header() ([]byte, error) {
+	if df.NoHeader {
+		return nil, nil
+	}
+	return unframed(df.marshalRows([][]string{df.Columns}))
+}
+
+// MarshalGet renders the header, and a row for the data, or for each of its
+// elements if it's a slice.
+func (df *DelimitedFormat) MarshalGet(data interface{}) ([]byte, error) {
+	return df.marshalAll(data)
+}
+
+// MarshalInit is like MarshalGet, but leaves the last row to be framed.
+func (df *DelimitedFormat) MarshalInit(data interface{}) ([]byte, error) {
+	return unframed(df.marshalAll(data))
+}
+
+// MarshalItem renders the item as a row.
+func (df *DelimitedFormat) MarshalItem(item interface{}) ([]byte, error) {
+	row, err := df.row(item)
+	if err != nil {
+		return nil, err
+	}
+	return unframed(df.marshalRows([][]string{row}))
+}
+
+// FrameItem appends a newline to any rows.
+func (df *DelimitedFormat) FrameItem(buf []byte) ([]byte, error) {
+	if len(buf) == 0 {
+		return buf, nil
+	}
+	n := len(buf)
+	frame := make([]byte, n+1)
+	copy(frame, buf)
+	frame[n] = '\n'
+	return frame, nil
+}
+
+func (df *DelimitedFormat) marshalAll(data interface{}) ([]byte, error) {
+	var rows [][]string
+	if !df.NoHeader {
+		rows = append(rows, df.Columns)
+	}
+	items := []interface{}{data}
+	if _, ok := data.(json.Marshaler); !ok {
+		val := reflect.ValueOf(data)
+		switch val.Kind() {
+		case reflect.Slice, reflect.Array:
+			items = make([]interface{}, val.Len())
+			for i := range items {
+				items[i] = val.Index(i).Interface()
+			}
+		case reflect.Invalid:
+			items = nil
+		}
+	}
+	for _, item := range items {
+		row, err := df.row(item)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, row)
+	}
+	return df.marshalRows(rows)
+}
+
+// row returns the item's values for each column.
+func (df *DelimitedFormat) row(item interface{}) ([]string, error) {
+	buf, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(buf, &fields); err != nil {
+		return nil, fmt.Errorf("%T item isn't a json object", item)
+	}
+	row := make([]string, len(df.Columns))
+	for i, col := range df.Columns {
+		row[i] = cellValue(fields[col])
+	}
+	return row, nil
+}
+
+// cellValue returns a json value as a string: strings unquoted, null as
+// nothing, and anything else as-is.
+func cellValue(raw json.RawMessage) string {
+	switch {
+	case len(raw) == 0 || string(raw) == "null":
+		return ""
+	case raw[0] == '"':
+		var s string
+		if err := json.Unmarshal(raw, &s); err == nil {
+			return s
+		}
+	}
+	return string(raw)
+}
+
+// marshalRows writes the rows, each ending in a newline.
+func (df *DelimitedFormat) marshalRows(rows [][]string) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Comma = df.Comma
+	if err := w.WriteAll(rows); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// unframed trims the newline from the last row, for FrameItem to add back.
+func unframed(buf []byte, err error) ([]byte, error) {
+	return bytes.TrimSuffix(buf, []byte{'\n'}), err
+}
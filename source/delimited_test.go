@@ -0,0 +1,125 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package source_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber-go/gwr/internal/marshaled"
+	"github.com/uber-go/gwr/source"
+)
+
+type rowBase struct {
+	Time time.Time `json:"time"`
+}
+
+type row struct {
+	rowBase
+	Name    string            `json:"name"`
+	Count   int               `json:"count,omitempty"`
+	Tags    map[string]string `json:"tags,omitempty"`
+	Skipped bool              `json:"-"`
+	Plain   bool
+	hidden  int
+}
+
+func TestColumnsOf(t *testing.T) {
+	assert.Equal(t, []string{"time", "name", "count", "tags", "Plain"}, source.ColumnsOf(row{}))
+	assert.Equal(t, []string{"time", "name", "count", "tags", "Plain"}, source.ColumnsOf(&row{}), "pointer")
+	assert.Equal(t, []string{"a", "b"}, source.ColumnsOf(map[string]int{"b": 2, "a": 1}))
+	assert.Empty(t, source.ColumnsOf(42))
+}
+
+func TestDelimitedFormat(t *testing.T) {
+	at := time.Date(2016, 7, 1, 12, 0, 0, 0, time.UTC)
+	item := row{
+		rowBase: rowBase{at},
+		Name:    `say "hi", then`,
+		Tags:    map[string]string{"k": "v"},
+		Plain:   true,
+	}
+
+	csv := source.NewCSVFormat(row{})
+	buf, err := csv.MarshalItem(item)
+	require.NoError(t, err)
+	assert.Equal(t,
+		`2016-07-01T12:00:00Z,"say ""hi"", then",,"{""k"":""v""}",true`,
+		string(buf), "values quoted as needed, omitted ones empty")
+	buf, err = csv.FrameItem(buf)
+	require.NoError(t, err)
+	assert.Equal(t, byte('\n'), buf[len(buf)-1], "framed by a newline")
+
+	buf, err = csv.MarshalGet([]row{{Name: "a", Count: 1}, {Name: "b", Count: 2}})
+	require.NoError(t, err)
+	assert.Equal(t, ""+
+		"time,name,count,tags,Plain\n"+
+		"0001-01-01T00:00:00Z,a,1,,false\n"+
+		"0001-01-01T00:00:00Z,b,2,,false\n",
+		string(buf), "header, then a row per element")
+
+	tsv := source.NewTSVFormat(map[string]interface{}{"n": 0, "s": ""})
+	tsv.NoHeader = true
+	buf, err = tsv.MarshalGet(map[string]interface{}{"n": 1.5, "s": "x y"})
+	require.NoError(t, err)
+	assert.Equal(t, "1.5\tx y\n", string(buf))
+	buf, err = tsv.Header()
+	require.NoError(t, err)
+	assert.Nil(t, buf, "no header")
+
+	_, err = csv.MarshalItem(42)
+	assert.Error(t, err, "not an object")
+}
+
+type rowSource struct {
+	watcher source.GenericDataWatcher
+}
+
+func (rs *rowSource) Name() string { return "/rows" }
+
+func (rs *rowSource) Formats() map[string]source.GenericDataFormat {
+	return map[string]source.GenericDataFormat{"csv": source.NewCSVFormat(row{})}
+}
+
+func (rs *rowSource) SetWatcher(watcher source.GenericDataWatcher) {
+	rs.watcher = watcher
+}
+
+func TestDelimitedFormat_watchHeader(t *testing.T) {
+	rs := &rowSource{}
+	mds := marshaled.NewDataSource(rs, nil)
+
+	var out bytes.Buffer
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, mds.WatchContext(ctx, "csv", &out))
+	rs.watcher.HandleItem(row{Name: "a"})
+	mds.Drain()
+	assert.Equal(t, ""+
+		"time,name,count,tags,Plain\n"+
+		"0001-01-01T00:00:00Z,a,,,false\n",
+		out.String(), "header in place of init data")
+}
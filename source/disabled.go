@@ -0,0 +1,43 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package source
+
+import "sync/atomic"
+
+var disabled uint32
+
+// SetDisabled globally disables, or re-enables, item handling for all watched
+// data sources.  While disabled, instrumentation hot paths, like
+// tap.Emitter.Emit and marshaled.DataSource.HandleItem, return after a single
+// atomic load without building or queueing any items; so instrumentation may
+// be left in place even in very hot loops.
+func SetDisabled(disable bool) {
+	if disable {
+		atomic.StoreUint32(&disabled, 1)
+	} else {
+		atomic.StoreUint32(&disabled, 0)
+	}
+}
+
+// Disabled returns true if gwr has been globally disabled by SetDisabled.
+func Disabled() bool {
+	return atomic.LoadUint32(&disabled) != 0
+}
@@ -0,0 +1,216 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+/*
+Package fake provides deterministic, synthetic sources, such as sine wave
+gauges, access log traffic, and trace trees, so that consumers of gwr, like
+dashboards, client libraries, and their tests, may be developed against a
+gwr server without a real workload.
+
+Fake sources will be named like "/fake/...".  Each is driven by a Generator,
+which is called for step 0, 1, 2, ... every interval while the source is
+watched; the items of each step depend only on the step number and the
+generator's settings, including its seed, so every run emits the same
+sequence.  Steps aren't repeated when a source is watched again: it carries
+on where it left off.
+
+Sources may be created in code, with New or Add, or from a list of Configs,
+e.g. read from a yaml file, with AddConfigured.
+*/
+package fake
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/uber-go/gwr"
+	"github.com/uber-go/gwr/source"
+)
+
+// DefaultInterval is how often a source steps its generator when no interval
+// is given.
+const DefaultInterval = time.Second
+
+// ErrGenerator is returned by Config.Generator unless exactly one generator
+// is configured.
+var ErrGenerator = errors.New("fake source must configure exactly one generator")
+
+var textTemplate = template.Must(template.New("fake_text").Parse(strings.TrimSpace(`
+{{ define "get" }}{{ range . }}{{ . }}
+{{ end }}{{ end }}
+{{ define "item" }}{{ . }}{{ end }}
+`)))
+
+// Generator generates the items of each step of a fake source.
+type Generator interface {
+	// Generate returns the items of step n; they must depend only on n and
+	// the generator's settings.
+	Generate(n uint64) []interface{}
+}
+
+// Source is a watchable source of the items of a Generator.
+type Source struct {
+	name     string
+	interval time.Duration
+	gen      Generator
+
+	lock    sync.Mutex
+	watcher source.GenericDataWatcher
+	running bool
+	step    uint64
+}
+
+// New creates a Source stepping gen every interval, or DefaultInterval if
+// it's zero.
+//
+// The given name will be prefixed with "/fake/" automatically.
+func New(name string, interval time.Duration, gen Generator) *Source {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Source{
+		name:     fmt.Sprintf("/fake/%s", name),
+		interval: interval,
+		gen:      gen,
+	}
+}
+
+// Add creates a Source and adds it to the default gwr sources.
+func Add(name string, interval time.Duration, gen Generator) *Source {
+	fs := New(name, interval, gen)
+	gwr.AddGenericDataSource(fs)
+	return fs
+}
+
+// Name returns the full name of the source; this will be
+// "/fake/name_given_to_New".
+func (fs *Source) Name() string {
+	return fs.name
+}
+
+// TextTemplate returns a text/template that prints each item on a line.
+func (fs *Source) TextTemplate() *template.Template {
+	return textTemplate
+}
+
+// Get returns the items of the next step, without taking it.
+func (fs *Source) Get() interface{} {
+	fs.lock.Lock()
+	n := fs.step
+	fs.lock.Unlock()
+	return fs.gen.Generate(n)
+}
+
+// SetWatcher adds a watcher at source addition time.
+func (fs *Source) SetWatcher(watcher source.GenericDataWatcher) {
+	fs.lock.Lock()
+	fs.watcher = source.AddWatcher(fs.watcher, watcher)
+	fs.lock.Unlock()
+}
+
+// Activate starts stepping the generator, until the source has no more
+// watchers.
+func (fs *Source) Activate() {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	if !fs.running {
+		fs.running = true
+		go fs.run()
+	}
+}
+
+func (fs *Source) run() {
+	ticker := time.NewTicker(fs.interval)
+	defer ticker.Stop()
+	for {
+		fs.lock.Lock()
+		watcher := fs.watcher
+		if watcher == nil || !watcher.Active() {
+			fs.running = false
+			fs.lock.Unlock()
+			return
+		}
+		n := fs.step
+		fs.step++
+		fs.lock.Unlock()
+
+		switch items := fs.gen.Generate(n); len(items) {
+		case 0:
+		case 1:
+			watcher.HandleItem(items[0])
+		default:
+			watcher.HandleItems(items)
+		}
+		<-ticker.C
+	}
+}
+
+// Config describes a fake source, for AddConfigured; exactly one of its
+// generators must be set.
+type Config struct {
+	Name     string        `yaml:"name"`
+	Interval time.Duration `yaml:"interval"`
+
+	Sine      *Sine      `yaml:"sine"`
+	AccessLog *AccessLog `yaml:"access_log"`
+	Traces    *Traces    `yaml:"traces"`
+}
+
+// Generator returns the configured generator, or ErrGenerator.
+func (cfg Config) Generator() (Generator, error) {
+	var gens []Generator
+	if cfg.Sine != nil {
+		gens = append(gens, cfg.Sine)
+	}
+	if cfg.AccessLog != nil {
+		gens = append(gens, cfg.AccessLog)
+	}
+	if cfg.Traces != nil {
+		gens = append(gens, cfg.Traces)
+	}
+	if len(gens) != 1 {
+		return nil, ErrGenerator
+	}
+	return gens[0], nil
+}
+
+// AddConfigured creates a Source for each config, and adds them to the
+// default gwr sources; if any config is invalid, none are added.
+func AddConfigured(cfgs ...Config) ([]*Source, error) {
+	srcs := make([]*Source, len(cfgs))
+	for i, cfg := range cfgs {
+		if cfg.Name == "" {
+			return nil, errors.New("fake source must be named")
+		}
+		gen, err := cfg.Generator()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", cfg.Name, err)
+		}
+		srcs[i] = New(cfg.Name, cfg.Interval, gen)
+	}
+	for _, fs := range srcs {
+		gwr.AddGenericDataSource(fs)
+	}
+	return srcs, nil
+}
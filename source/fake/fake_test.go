@@ -0,0 +1,124 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package fake_test
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber-go/gwr/internal/marshaled"
+	"github.com/uber-go/gwr/source/fake"
+)
+
+func TestSine(t *testing.T) {
+	sw := &fake.Sine{Period: 4, Amplitude: 2, Offset: 10}
+	var values []float64
+	for n := uint64(0); n < 5; n++ {
+		items := sw.Generate(n)
+		require.Len(t, items, 1)
+		g := items[0].(fake.Gauge)
+		assert.Equal(t, n, g.Step)
+		values = append(values, math.Round(g.Value*1000)/1000)
+	}
+	assert.Equal(t, []float64{10, 12, 10, 8, 10}, values)
+}
+
+func TestAccessLog(t *testing.T) {
+	al := &fake.AccessLog{Seed: 42, PerStep: 20, Paths: []string{"/a", "/b"}, ErrorRate: 0.5}
+	items := al.Generate(7)
+	require.Len(t, items, 20)
+	assert.Equal(t, items, al.Generate(7), "steps are deterministic")
+	assert.NotEqual(t, items, al.Generate(8), "steps differ")
+	assert.NotEqual(t, items, (&fake.AccessLog{Seed: 43, PerStep: 20, Paths: []string{"/a", "/b"}, ErrorRate: 0.5}).Generate(7), "seeds differ")
+
+	errors := 0
+	for _, item := range items {
+		req := item.(fake.Request)
+		assert.Contains(t, []string{"/a", "/b"}, req.Path)
+		if req.Status >= 500 {
+			errors++
+		}
+	}
+	assert.True(t, errors > 0 && errors < 20, "some errors, not %d", errors)
+}
+
+func TestTraces(t *testing.T) {
+	tr := &fake.Traces{Seed: 1, Root: &fake.SpanSpec{
+		Name:     "root",
+		Duration: time.Millisecond,
+		Children: []fake.SpanSpec{
+			{Name: "a", Duration: 10 * time.Millisecond},
+			{Name: "b", Duration: 10 * time.Millisecond},
+		},
+	}}
+	items := tr.Generate(3)
+	assert.Equal(t, items, tr.Generate(3), "steps are deterministic")
+	require.Len(t, items, 3)
+	root, a, b := items[0].(fake.Span), items[1].(fake.Span), items[2].(fake.Span)
+	assert.Equal(t, []string{"root", "a", "b"}, []string{root.Name, a.Name, b.Name})
+	assert.Equal(t, root.TraceID, a.TraceID)
+	assert.Empty(t, root.ParentID)
+	assert.Equal(t, root.SpanID, a.ParentID)
+	assert.Equal(t, root.SpanID, b.ParentID)
+	assert.Equal(t, a.Start+a.Duration, b.Start, "children run in turn")
+	assert.InDelta(t, a.Duration+b.Duration, root.Duration, 1e-9, "root covers its children")
+	assert.NotEqual(t, root.TraceID, tr.Generate(4)[0].(fake.Span).TraceID)
+	assert.Len(t, (&fake.Traces{}).Generate(0), 5, "default tree")
+}
+
+func TestConfig_Generator(t *testing.T) {
+	_, err := fake.Config{Name: "none"}.Generator()
+	assert.Equal(t, fake.ErrGenerator, err)
+	_, err = fake.Config{Name: "both", Sine: &fake.Sine{}, Traces: &fake.Traces{}}.Generator()
+	assert.Equal(t, fake.ErrGenerator, err)
+	gen, err := fake.Config{Name: "sine", Sine: &fake.Sine{}}.Generator()
+	assert.NoError(t, err)
+	assert.IsType(t, &fake.Sine{}, gen)
+
+	_, err = fake.AddConfigured(fake.Config{Name: "ok", Sine: &fake.Sine{}}, fake.Config{Name: "bad"})
+	assert.EqualError(t, err, "bad: "+fake.ErrGenerator.Error())
+}
+
+func TestSource_Watch(t *testing.T) {
+	fs := fake.New("sine", time.Millisecond, &fake.Sine{Period: 4})
+	assert.Equal(t, "/fake/sine", fs.Name())
+	mds := marshaled.NewDataSource(fs, nil)
+
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	require.NoError(t, mds.Watch("text", pw))
+	sc := bufio.NewScanner(pr)
+	var lines []string
+	for len(lines) < 3 && sc.Scan() {
+		lines = append(lines, sc.Text())
+	}
+	assert.Equal(t, []string{
+		"step=0 value=0.000",
+		"step=1 value=1.000",
+		"step=2 value=0.000",
+	}, lines)
+}
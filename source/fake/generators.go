@@ -0,0 +1,221 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package fake
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// rng returns a random number generator for step n of a generator seeded
+// with seed, so that each step's items don't depend on any other's.
+func rng(seed int64, n uint64) *rand.Rand {
+	return rand.New(rand.NewSource(seed ^ int64(n*0x9e3779b97f4a7c15)))
+}
+
+// Sine generates a Gauge following a sine wave, one per step.
+type Sine struct {
+	// Period is the number of steps in a cycle; it defaults to 60.
+	Period int `yaml:"period"`
+
+	// Amplitude and Offset scale and shift the wave; a zero Amplitude
+	// defaults to 1.
+	Amplitude float64 `yaml:"amplitude"`
+	Offset    float64 `yaml:"offset"`
+}
+
+// Gauge is a sampled value.
+type Gauge struct {
+	Step  uint64  `json:"step"`
+	Value float64 `json:"value"`
+}
+
+func (g Gauge) String() string {
+	return fmt.Sprintf("step=%d value=%.3f", g.Step, g.Value)
+}
+
+// Generate returns the Gauge of step n.
+func (sw *Sine) Generate(n uint64) []interface{} {
+	period, amp := sw.Period, sw.Amplitude
+	if period <= 0 {
+		period = 60
+	}
+	if amp == 0 {
+		amp = 1
+	}
+	phase := 2 * math.Pi * float64(n%uint64(period)) / float64(period)
+	return []interface{}{Gauge{
+		Step:  n,
+		Value: sw.Offset + amp*math.Sin(phase),
+	}}
+}
+
+// AccessLog generates Requests, like those of an HTTP server's access log.
+type AccessLog struct {
+	Seed int64 `yaml:"seed"`
+
+	// PerStep is how many requests are generated each step; it defaults
+	// to 5.
+	PerStep int `yaml:"per_step"`
+
+	// Paths are the requested paths, chosen at random; they default to a
+	// few of a typical web app.
+	Paths []string `yaml:"paths"`
+
+	// ErrorRate is the fraction of requests that fail with a 5xx status.
+	ErrorRate float64 `yaml:"error_rate"`
+}
+
+// Request is a synthetic access log entry.
+type Request struct {
+	Method   string  `json:"method"`
+	Path     string  `json:"path"`
+	Status   int     `json:"status"`
+	Bytes    int     `json:"bytes"`
+	Duration float64 `json:"duration_ms"`
+}
+
+func (req Request) String() string {
+	return fmt.Sprintf("%s %s %d %dB %.1fms", req.Method, req.Path, req.Status, req.Bytes, req.Duration)
+}
+
+var defaultPaths = []string{"/", "/api/users", "/api/orders", "/static/app.js"}
+
+// Generate returns the Requests of step n.
+func (al *AccessLog) Generate(n uint64) []interface{} {
+	perStep, paths := al.PerStep, al.Paths
+	if perStep <= 0 {
+		perStep = 5
+	}
+	if len(paths) == 0 {
+		paths = defaultPaths
+	}
+	r := rng(al.Seed, n)
+	items := make([]interface{}, perStep)
+	for i := range items {
+		req := Request{
+			Method:   "GET",
+			Path:     paths[r.Intn(len(paths))],
+			Status:   200,
+			Bytes:    200 + r.Intn(20000),
+			Duration: 2 + r.ExpFloat64()*20,
+		}
+		if r.Float64() < 0.2 {
+			req.Method = "POST"
+			req.Status = 201
+		}
+		if r.Float64() < al.ErrorRate {
+			req.Status = 500 + 3*r.Intn(2)
+			req.Bytes = 0
+			req.Duration *= 5
+		}
+		items[i] = req
+	}
+	return items
+}
+
+// SpanSpec scripts a span of a trace tree: its name, typical duration, and
+// children, which run one after another within it.
+type SpanSpec struct {
+	Name     string        `yaml:"name"`
+	Duration time.Duration `yaml:"duration"`
+	Children []SpanSpec    `yaml:"children"`
+}
+
+// Traces generates the Spans of one trace each step, shaped like Root, with
+// each span's duration varied by up to a quarter.
+type Traces struct {
+	Seed int64 `yaml:"seed"`
+
+	// Root is the root span of each trace; it defaults to a request served
+	// with an auth check, a cache miss, and a database query.
+	Root *SpanSpec `yaml:"root"`
+}
+
+// Span is a synthetic trace span.  Start is relative to the start of the
+// trace.
+type Span struct {
+	TraceID  string  `json:"trace_id"`
+	SpanID   string  `json:"span_id"`
+	ParentID string  `json:"parent_id,omitempty"`
+	Name     string  `json:"name"`
+	Start    float64 `json:"start_ms"`
+	Duration float64 `json:"duration_ms"`
+}
+
+func (sp Span) String() string {
+	id := sp.SpanID
+	if sp.ParentID != "" {
+		id += "<-" + sp.ParentID
+	}
+	return fmt.Sprintf("%s %s %s +%.1fms %.1fms", sp.TraceID, id, sp.Name, sp.Start, sp.Duration)
+}
+
+var defaultRoot = SpanSpec{
+	Name:     "GET /api/orders",
+	Duration: 40 * time.Millisecond,
+	Children: []SpanSpec{
+		{Name: "auth.check", Duration: 3 * time.Millisecond},
+		{Name: "cache.get", Duration: time.Millisecond},
+		{Name: "db.query", Duration: 25 * time.Millisecond, Children: []SpanSpec{
+			{Name: "db.connect", Duration: 2 * time.Millisecond},
+		}},
+	},
+}
+
+// Generate returns the Spans of the trace of step n, parents first.
+func (tr *Traces) Generate(n uint64) []interface{} {
+	root := tr.Root
+	if root == nil {
+		root = &defaultRoot
+	}
+	r := rng(tr.Seed, n)
+	traceID := fmt.Sprintf("%016x", r.Uint64())
+	var items []interface{}
+	var add func(spec *SpanSpec, parentID string, start float64) float64
+	add = func(spec *SpanSpec, parentID string, start float64) float64 {
+		ms := float64(spec.Duration) / float64(time.Millisecond)
+		span := Span{
+			TraceID:  traceID,
+			SpanID:   fmt.Sprintf("%08x", r.Uint32()),
+			ParentID: parentID,
+			Name:     spec.Name,
+			Start:    start,
+			Duration: ms * (0.75 + r.Float64()/2),
+		}
+		i := len(items)
+		items = append(items, span)
+		end := start
+		for j := range spec.Children {
+			end = add(&spec.Children[j], span.SpanID, end)
+		}
+		// a parent lasts at least as long as its children
+		if d := end - start; d > span.Duration {
+			span.Duration = d
+			items[i] = span
+		}
+		return start + span.Duration
+	}
+	add(root, "", 0)
+	return items
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package source
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// WatcherFanout is a GenericDataWatcher that passes items on to any number of
+// others, so that a WatchableDataSource may feed more than one marshaled
+// pipeline, as when it's added to two DataSources; see AddWatcher.
+type WatcherFanout struct {
+	// lock serializes changes to watchers, which is only ever replaced, so
+	// that items may be passed on without it.
+	lock     sync.Mutex
+	watchers atomic.Value // []GenericDataWatcher
+}
+
+// NewWatcherFanout creates a WatcherFanout passing items on to the given
+// watchers.
+func NewWatcherFanout(watchers ...GenericDataWatcher) *WatcherFanout {
+	wf := &WatcherFanout{}
+	for _, watcher := range watchers {
+		wf.Add(watcher)
+	}
+	return wf
+}
+
+// AddWatcher returns the watcher that a WatchableDataSource, already
+// retaining cur, should retain once passed watcher by SetWatcher: watcher
+// itself if cur is nil or the same, cur with watcher added if it's a
+// WatcherFanout, or else a new WatcherFanout to both.
+func AddWatcher(cur, watcher GenericDataWatcher) GenericDataWatcher {
+	switch {
+	case cur == nil || sameWatcher(cur, watcher):
+		return watcher
+	case watcher == nil:
+		return cur
+	}
+	if wf, ok := cur.(*WatcherFanout); ok {
+		wf.Add(watcher)
+		return wf
+	}
+	return NewWatcherFanout(cur, watcher)
+}
+
+// Add adds a watcher to pass items on to, unless it's nil or already added.
+func (wf *WatcherFanout) Add(watcher GenericDataWatcher) {
+	if watcher == nil {
+		return
+	}
+	wf.lock.Lock()
+	defer wf.lock.Unlock()
+	watchers := wf.Watchers()
+	for _, other := range watchers {
+		if sameWatcher(other, watcher) {
+			return
+		}
+	}
+	next := make([]GenericDataWatcher, len(watchers), len(watchers)+1)
+	copy(next, watchers)
+	wf.watchers.Store(append(next, watcher))
+}
+
+// Remove removes a watcher, if it was added.
+func (wf *WatcherFanout) Remove(watcher GenericDataWatcher) {
+	wf.lock.Lock()
+	defer wf.lock.Unlock()
+	watchers := wf.Watchers()
+	next := make([]GenericDataWatcher, 0, len(watchers))
+	for _, other := range watchers {
+		if !sameWatcher(other, watcher) {
+			next = append(next, other)
+		}
+	}
+	wf.watchers.Store(next)
+}
+
+// Watchers returns the watchers that items are passed on to; the slice must
+// not be modified.
+func (wf *WatcherFanout) Watchers() []GenericDataWatcher {
+	watchers, _ := wf.watchers.Load().([]GenericDataWatcher)
+	return watchers
+}
+
+// Active returns true if any of the watchers are active.
+func (wf *WatcherFanout) Active() bool {
+	for _, watcher := range wf.Watchers() {
+		if watcher.Active() {
+			return true
+		}
+	}
+	return false
+}
+
+// HandleItem passes the item to each active watcher, returning true if any
+// of them took it.
+func (wf *WatcherFanout) HandleItem(item interface{}) bool {
+	handled := false
+	for _, watcher := range wf.Watchers() {
+		if watcher.Active() && watcher.HandleItem(item) {
+			handled = true
+		}
+	}
+	return handled
+}
+
+// HandleItems passes the batch to each active watcher, returning true if any
+// of them took it; the watchers share the batch, so none may modify it.
+func (wf *WatcherFanout) HandleItems(items []interface{}) bool {
+	handled := false
+	for _, watcher := range wf.Watchers() {
+		if watcher.Active() && watcher.HandleItems(items) {
+			handled = true
+		}
+	}
+	return handled
+}
+
+// sameWatcher returns true if a and b are the same watcher; watchers of
+// types that can't be compared are never the same.
+func sameWatcher(a, b GenericDataWatcher) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	ta := reflect.TypeOf(a)
+	return ta == reflect.TypeOf(b) && ta.Comparable() && a == b
+}
@@ -0,0 +1,80 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package source_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber-go/gwr/internal/marshaled"
+	"github.com/uber-go/gwr/source"
+)
+
+type idleWatcher struct{ sliceWatcher }
+
+func (iw *idleWatcher) Active() bool { return false }
+
+func TestWatcherFanout(t *testing.T) {
+	var a, b sliceWatcher
+	var idle idleWatcher
+	assert.Equal(t, &a, source.AddWatcher(nil, &a), "first watcher retained as is")
+	assert.Equal(t, &a, source.AddWatcher(&a, &a), "same watcher not added twice")
+
+	wf, ok := source.AddWatcher(&a, &b).(*source.WatcherFanout)
+	require.True(t, ok, "second watcher fans out")
+	assert.Equal(t, wf, source.AddWatcher(wf, &idle), "added to an existing fanout")
+	wf.Add(&b)
+	assert.Len(t, wf.Watchers(), 3, "duplicate ignored")
+
+	assert.True(t, wf.Active())
+	assert.True(t, wf.HandleItem(1))
+	assert.True(t, wf.HandleItems([]interface{}{2, 3}))
+	assert.Equal(t, []interface{}{1, 2, 3}, a.items)
+	assert.Equal(t, []interface{}{1, 2, 3}, b.items)
+	assert.Empty(t, idle.items, "inactive watcher skipped")
+
+	wf.Remove(&a)
+	wf.Remove(&b)
+	assert.False(t, wf.Active(), "only the inactive watcher left")
+	assert.False(t, wf.HandleItem(4))
+	assert.Equal(t, []interface{}{1, 2, 3}, a.items, "removed watcher not passed items")
+}
+
+func TestWatcherFanout_registries(t *testing.T) {
+	src := &itemSource{}
+	buf := source.NewBuffered(src, 3)
+	var mdss [2]*marshaled.DataSource
+	var outs [2]bytes.Buffer
+	for i := range mdss {
+		mdss[i] = marshaled.NewDataSource(buf, nil)
+		require.NoError(t, source.NewDataSources().Add(mdss[i]))
+		require.NoError(t, mdss[i].Watch("text", &outs[i]))
+	}
+
+	src.watcher.HandleItem(1)
+	for i, mds := range mdss {
+		mds.Drain()
+		assert.Equal(t, "item 1\n", outs[i].String(), "pipeline %d fed", i)
+	}
+}
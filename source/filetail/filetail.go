@@ -0,0 +1,236 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+/*
+Package filetail provides a watchable source that tails a file, such as a log
+file written by a co-located process, emitting each line as an item.
+
+Tail sources will be named like "/files/...".  The file is only opened, and
+tailed, while the source has any watchers; each watch therefore sees lines
+appended after it started.  Both rotation (the path being replaced by a new
+file) and truncation are detected, after which the new content is read from
+its start.
+*/
+package filetail
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/uber-go/gwr"
+	"github.com/uber-go/gwr/source"
+)
+
+// pollInterval is how often the file is checked for new lines, and rotation,
+// once the end of it has been read.
+var pollInterval = 250 * time.Millisecond
+
+var textFormat = source.GenericDataFormatFunc(func(item interface{}) ([]byte, error) {
+	if line, ok := item.(string); ok {
+		return []byte(line), nil
+	}
+	return json.Marshal(item)
+})
+
+// Tail is a watchable source of the lines appended to a file.
+type Tail struct {
+	// ParseJSON, if set, causes each line to be parsed as json, with the
+	// parsed value being emitted instead of the line; lines that aren't valid
+	// json are still emitted as strings.  It must be set before the source is
+	// added.
+	ParseJSON bool
+
+	name    string
+	path    string
+	watcher source.GenericDataWatcher
+
+	lock    sync.Mutex
+	running bool
+}
+
+// New creates a Tail source for the file at the given path.
+//
+// The given name will be prefixed with "/files/" automatically.
+func New(name, path string) *Tail {
+	return &Tail{
+		name: fmt.Sprintf("/files/%s", name),
+		path: path,
+	}
+}
+
+// Add creates a Tail source and adds it to the default gwr sources.
+func Add(name, path string) *Tail {
+	ft := New(name, path)
+	gwr.AddGenericDataSource(ft)
+	return ft
+}
+
+// Name returns the full name of the source; this will be
+// "/files/name_given_to_New".
+func (ft *Tail) Name() string {
+	return ft.name
+}
+
+// Path returns the path of the tailed file.
+func (ft *Tail) Path() string {
+	return ft.path
+}
+
+// Formats returns a text format that writes lines as-is, and any parsed json
+// values as json.
+func (ft *Tail) Formats() map[string]source.GenericDataFormat {
+	return map[string]source.GenericDataFormat{
+		"text": textFormat,
+	}
+}
+
+// SetWatcher adds a watcher at source addition time.
+func (ft *Tail) SetWatcher(watcher source.GenericDataWatcher) {
+	ft.watcher = source.AddWatcher(ft.watcher, watcher)
+}
+
+// Activate starts tailing the file, until the source has no more watchers.
+func (ft *Tail) Activate() {
+	ft.lock.Lock()
+	defer ft.lock.Unlock()
+	if !ft.running {
+		ft.running = true
+		go ft.tail()
+	}
+}
+
+func (ft *Tail) tail() {
+	for {
+		ft.follow()
+
+		// the source may have been re-activated after follow saw it go
+		// inactive, but before it was marked not running
+		ft.lock.Lock()
+		if !ft.watcher.Active() {
+			ft.running = false
+			ft.lock.Unlock()
+			return
+		}
+		ft.lock.Unlock()
+	}
+}
+
+// follow emits lines appended to the file until the source goes inactive.
+func (ft *Tail) follow() {
+	var (
+		file    *os.File
+		reader  *bufio.Reader
+		offset  int64
+		partial []byte
+	)
+	defer func() {
+		if file != nil {
+			file.Close()
+		}
+	}()
+
+	// open (re)opens the file, seeking to its end when starting out, since
+	// only newly appended lines are watched, or to its start after rotation
+	open := func(atEnd bool) {
+		if file != nil {
+			file.Close()
+			file = nil
+		}
+		partial = partial[:0]
+		f, err := os.Open(ft.path)
+		if err != nil {
+			return
+		}
+		offset = 0
+		if atEnd {
+			if offset, err = f.Seek(0, io.SeekEnd); err != nil {
+				f.Close()
+				return
+			}
+		}
+		file = f
+		reader = bufio.NewReader(f)
+	}
+
+	open(true)
+	for ft.watcher.Active() {
+		if file == nil {
+			// the file didn't exist yet, any content it gets is new
+			time.Sleep(pollInterval)
+			open(false)
+			continue
+		}
+
+		line, err := reader.ReadBytes('\n')
+		offset += int64(len(line))
+		if err == nil {
+			if len(partial) > 0 {
+				line = append(partial, line...)
+				partial = partial[:0]
+			}
+			ft.emit(line[:len(line)-1])
+			continue
+		}
+		partial = append(partial, line...)
+		if err != io.EOF {
+			open(false)
+			continue
+		}
+
+		time.Sleep(pollInterval)
+		if ft.rotated(file, offset) {
+			open(false)
+		}
+	}
+}
+
+// rotated returns true if the path no longer refers to the open file, or if
+// the file has been truncated.
+func (ft *Tail) rotated(file *os.File, offset int64) bool {
+	pathInfo, err := os.Stat(ft.path)
+	if err != nil {
+		// keep the old file until a new one takes its place
+		return false
+	}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return true
+	}
+	return !os.SameFile(pathInfo, fileInfo) || fileInfo.Size() < offset
+}
+
+func (ft *Tail) emit(line []byte) {
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		line = line[:n-1]
+	}
+	if ft.ParseJSON {
+		var val interface{}
+		if err := json.Unmarshal(line, &val); err == nil {
+			ft.watcher.HandleItem(val)
+			return
+		}
+	}
+	ft.watcher.HandleItem(string(line))
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package filetail
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type chanWatcher struct {
+	sync.Mutex
+	active bool
+	items  chan interface{}
+}
+
+func (cw *chanWatcher) Active() bool {
+	cw.Lock()
+	defer cw.Unlock()
+	return cw.active
+}
+
+func (cw *chanWatcher) setActive(active bool) {
+	cw.Lock()
+	cw.active = active
+	cw.Unlock()
+}
+
+func (cw *chanWatcher) HandleItem(item interface{}) bool {
+	cw.items <- item
+	return true
+}
+
+func (cw *chanWatcher) HandleItems(items []interface{}) bool {
+	for _, item := range items {
+		cw.items <- item
+	}
+	return true
+}
+
+func (cw *chanWatcher) next(t *testing.T) interface{} {
+	select {
+	case item := <-cw.items:
+		return item
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an item")
+		return nil
+	}
+}
+
+func appendFile(t *testing.T, path, data string) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString(data)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+}
+
+func TestTail(t *testing.T) {
+	defer func(interval time.Duration) { pollInterval = interval }(pollInterval)
+	pollInterval = time.Millisecond
+
+	dir, err := ioutil.TempDir("", "filetail")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	appendFile(t, path, "before watching\n")
+
+	ft := New("app", path)
+	ft.ParseJSON = true
+	assert.Equal(t, "/files/app", ft.Name())
+
+	cw := &chanWatcher{active: true, items: make(chan interface{}, 10)}
+	ft.SetWatcher(cw)
+	ft.Activate()
+	time.Sleep(10 * pollInterval)
+
+	appendFile(t, path, "plain\n{\"a\": 1}\npart")
+	assert.Equal(t, "plain", cw.next(t), "only lines appended while watched")
+	assert.Equal(t, map[string]interface{}{"a": 1.0}, cw.next(t), "json lines parsed")
+	appendFile(t, path, "ial\n")
+	assert.Equal(t, "partial", cw.next(t), "partial lines joined")
+
+	require.NoError(t, os.Rename(path, path+".1"))
+	appendFile(t, path, "rotated\n")
+	assert.Equal(t, "rotated", cw.next(t), "new file read after rotation")
+
+	require.NoError(t, os.Truncate(path, 0))
+	time.Sleep(10 * pollInterval)
+	appendFile(t, path, "truncated\n")
+	assert.Equal(t, "truncated", cw.next(t), "file read from start after truncation")
+
+	cw.setActive(false)
+	for i := 0; i < 100; i++ {
+		ft.lock.Lock()
+		running := ft.running
+		ft.lock.Unlock()
+		if !running {
+			return
+		}
+		time.Sleep(pollInterval)
+	}
+	t.Fatal("tail still running after the source went inactive")
+}
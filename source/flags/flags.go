@@ -0,0 +1,339 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+/*
+Package flags provides feature flags whose values may be temporarily
+overridden through gwr, so that operational toggles use the same endpoint as
+observation.
+
+Flag sets will be named like "/flags/...".  Getting a set lists its flags,
+their values, and a record of recent changes; watching it streams each change
+as it's made.  Flags are read by the program as usual:
+
+	ff := flags.Add("app")
+	fastPath := ff.Bool("fast_path", false, "use the new fast path")
+	...
+	if fastPath.Bool() {
+
+The set implements two actions.  "override", with "flag", "value", and an
+optional "ttl" duration parameter, overrides a flag's value until the ttl
+elapses, ten minutes by default; "clear", with a "flag", ends an override
+early.  Either may also be given "by" and "reason" parameters, which are kept
+in the audit record of the change.  For example:
+
+	$ redis-cli -p 4040 action /flags/app override flag fast_path value true ttl 1h by ops reason incident-42
+*/
+package flags
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"text/template"
+	"time"
+
+	"github.com/uber-go/gwr"
+	"github.com/uber-go/gwr/source"
+)
+
+// DefaultTTL is how long an override lasts when no ttl is given.
+const DefaultTTL = 10 * time.Minute
+
+// maxAudit is how many audit records a Set retains for Get.
+const maxAudit = 100
+
+var textTemplate = template.Must(template.New("flags_text").Parse(strings.TrimSpace(`
+{{ define "get" }}{{ range .Flags }}{{ .Name }}={{ .Value }}{{ if .Overridden }} (overridden, default {{ .Default }}, until {{ .Expires.Format "15:04:05" }}){{ end }}
+{{ end }}{{ range .Audit }}{{ template "item" . }}
+{{ end }}{{ end }}
+{{ define "item" }}{{ .Time.Format "2006-01-02T15:04:05Z07:00" }} {{ .Action }} {{ .Flag }}: {{ .Previous }} -> {{ .Value }}
+{{- if .By }} by {{ .By }}{{ end }}{{ if .Reason }} ({{ .Reason }}){{ end }}{{ end }}
+`)))
+
+// Set is a watchable source of feature flags.
+type Set struct {
+	name string
+
+	lock    sync.Mutex
+	flags   map[string]*Flag
+	audit   []AuditRecord
+	watcher source.GenericDataWatcher
+}
+
+// Flag is a feature flag in a Set.  Its value is a string, which may be
+// parsed by the Bool accessor; a flag created by Set.Bool only accepts
+// values that parse as a bool.
+type Flag struct {
+	name    string
+	usage   string
+	isBool  bool
+	value   atomic.Value
+	base    string
+	expires time.Time
+	timer   *time.Timer
+	gen     uint64
+}
+
+// FlagInfo describes a flag's current value; while it's overridden,
+// Default is the value that it reverts to once Expires.
+type FlagInfo struct {
+	Name       string     `json:"name"`
+	Usage      string     `json:"usage,omitempty"`
+	Value      string     `json:"value"`
+	Default    string     `json:"default"`
+	Overridden bool       `json:"overridden"`
+	Expires    *time.Time `json:"expires,omitempty"`
+}
+
+// AuditRecord records a change to a flag: an "override", a "clear", or the
+// "expire" of an override.
+type AuditRecord struct {
+	Time     time.Time  `json:"time"`
+	Flag     string     `json:"flag"`
+	Action   string     `json:"action"`
+	Value    string     `json:"value"`
+	Previous string     `json:"previous"`
+	Expires  *time.Time `json:"expires,omitempty"`
+	By       string     `json:"by,omitempty"`
+	Reason   string     `json:"reason,omitempty"`
+}
+
+// Info is what's returned by Set.Get: every flag, sorted by name, and the
+// most recent changes, oldest first.
+type Info struct {
+	Flags []FlagInfo    `json:"flags"`
+	Audit []AuditRecord `json:"audit"`
+}
+
+// New creates a flag Set source.
+//
+// The given name will be prefixed with "/flags/" automatically.
+func New(name string) *Set {
+	return &Set{
+		name:  fmt.Sprintf("/flags/%s", name),
+		flags: make(map[string]*Flag),
+	}
+}
+
+// Add creates a flag Set source and adds it to the default gwr sources.
+func Add(name string) *Set {
+	fs := New(name)
+	gwr.AddGenericDataSource(fs)
+	return fs
+}
+
+// Name returns the full name of the source; this will be
+// "/flags/name_given_to_New".
+func (fs *Set) Name() string {
+	return fs.name
+}
+
+// TextTemplate returns a text/template to implement the GenericDataSource with
+// a "text" format option.
+func (fs *Set) TextTemplate() *template.Template {
+	return textTemplate
+}
+
+// SetWatcher adds a watcher at source addition time.
+func (fs *Set) SetWatcher(watcher source.GenericDataWatcher) {
+	fs.lock.Lock()
+	fs.watcher = source.AddWatcher(fs.watcher, watcher)
+	fs.lock.Unlock()
+}
+
+// Bool adds a boolean flag to the set.
+func (fs *Set) Bool(name string, value bool, usage string) *Flag {
+	return fs.add(name, strconv.FormatBool(value), usage, true)
+}
+
+// String adds a string flag to the set.
+func (fs *Set) String(name string, value string, usage string) *Flag {
+	return fs.add(name, value, usage, false)
+}
+
+func (fs *Set) add(name, value, usage string, isBool bool) *Flag {
+	f := &Flag{
+		name:   name,
+		usage:  usage,
+		isBool: isBool,
+		base:   value,
+	}
+	f.value.Store(value)
+	fs.lock.Lock()
+	fs.flags[name] = f
+	fs.lock.Unlock()
+	return f
+}
+
+// Name returns the flag's name within its set.
+func (f *Flag) Name() string {
+	return f.name
+}
+
+// String returns the flag's current value.
+func (f *Flag) String() string {
+	return f.value.Load().(string)
+}
+
+// Bool returns the flag's current value parsed as a bool; values that don't
+// parse are false.
+func (f *Flag) Bool() bool {
+	b, _ := strconv.ParseBool(f.String())
+	return b
+}
+
+func (f *Flag) valid(value string) bool {
+	if f.isBool {
+		_, err := strconv.ParseBool(value)
+		return err == nil
+	}
+	return true
+}
+
+// Get returns the set's Info.
+func (fs *Set) Get() interface{} {
+	fs.lock.Lock()
+	defer fs.lock.Unlock()
+	info := Info{
+		Flags: make([]FlagInfo, 0, len(fs.flags)),
+		Audit: append([]AuditRecord(nil), fs.audit...),
+	}
+	for _, f := range fs.flags {
+		fi := FlagInfo{
+			Name:    f.name,
+			Usage:   f.usage,
+			Value:   f.String(),
+			Default: f.base,
+		}
+		if f.timer != nil {
+			expires := f.expires
+			fi.Overridden = true
+			fi.Expires = &expires
+		}
+		info.Flags = append(info.Flags, fi)
+	}
+	sort.Sort(flagsByName(info.Flags))
+	return info
+}
+
+// Action implements the "override" and "clear" actions.
+func (fs *Set) Action(name string, params map[string]string) error {
+	switch name {
+	case "override":
+		ttl := DefaultTTL
+		if s, ok := params["ttl"]; ok {
+			d, err := time.ParseDuration(s)
+			if err != nil || d <= 0 {
+				return source.ErrInvalidParam
+			}
+			ttl = d
+		}
+		return fs.override(params, ttl)
+	case "clear":
+		return fs.clear(params["flag"], "clear", params, 0)
+	default:
+		return source.ErrUnknownAction
+	}
+}
+
+func (fs *Set) override(params map[string]string, ttl time.Duration) error {
+	name, value := params["flag"], params["value"]
+	fs.lock.Lock()
+	f, ok := fs.flags[name]
+	if !ok || !f.valid(value) {
+		fs.lock.Unlock()
+		return source.ErrInvalidParam
+	}
+	if f.timer != nil {
+		f.timer.Stop()
+	}
+	f.expires = time.Now().Add(ttl)
+	f.gen++
+	gen := f.gen
+	f.timer = time.AfterFunc(ttl, func() {
+		fs.clear(name, "expire", nil, gen)
+	})
+	expires := f.expires
+	rec := AuditRecord{
+		Flag:     name,
+		Action:   "override",
+		Value:    value,
+		Previous: f.String(),
+		Expires:  &expires,
+		By:       params["by"],
+		Reason:   params["reason"],
+	}
+	f.value.Store(value)
+	fs.record(rec)
+	return nil
+}
+
+// clear ends the named flag's override, if any; if gen is non-zero, it's
+// only ended if it hasn't been overridden again since, as it may have been
+// while its timer fired.
+func (fs *Set) clear(name, action string, params map[string]string, gen uint64) error {
+	fs.lock.Lock()
+	f, ok := fs.flags[name]
+	if !ok {
+		fs.lock.Unlock()
+		return source.ErrInvalidParam
+	}
+	if f.timer == nil || (gen != 0 && f.gen != gen) {
+		fs.lock.Unlock()
+		return nil
+	}
+	f.timer.Stop()
+	f.timer = nil
+	rec := AuditRecord{
+		Flag:     name,
+		Action:   action,
+		Value:    f.base,
+		Previous: f.String(),
+		By:       params["by"],
+		Reason:   params["reason"],
+	}
+	f.value.Store(f.base)
+	fs.record(rec)
+	return nil
+}
+
+// record retains an audit record, and passes it to any active watcher; the
+// lock must be held, and is released.
+func (fs *Set) record(rec AuditRecord) {
+	rec.Time = time.Now()
+	if len(fs.audit) >= maxAudit {
+		fs.audit = append(fs.audit[:0], fs.audit[1:]...)
+	}
+	fs.audit = append(fs.audit, rec)
+	watcher := fs.watcher
+	fs.lock.Unlock()
+	if watcher != nil && watcher.Active() {
+		watcher.HandleItem(rec)
+	}
+}
+
+type flagsByName []FlagInfo
+
+func (fis flagsByName) Len() int           { return len(fis) }
+func (fis flagsByName) Less(i, j int) bool { return fis[i].Name < fis[j].Name }
+func (fis flagsByName) Swap(i, j int)      { fis[i], fis[j] = fis[j], fis[i] }
@@ -0,0 +1,115 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package flags
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber-go/gwr/source"
+)
+
+// sliceWatcher is locked, since expiring overrides emit from their timers.
+type sliceWatcher struct {
+	sync.Mutex
+	active bool
+	items  []interface{}
+}
+
+func (sw *sliceWatcher) Active() bool {
+	sw.Lock()
+	defer sw.Unlock()
+	return sw.active
+}
+
+func (sw *sliceWatcher) HandleItem(item interface{}) bool {
+	sw.Lock()
+	sw.items = append(sw.items, item)
+	sw.Unlock()
+	return true
+}
+
+func (sw *sliceWatcher) HandleItems(items []interface{}) bool {
+	sw.Lock()
+	sw.items = append(sw.items, items...)
+	sw.Unlock()
+	return true
+}
+
+func TestSet(t *testing.T) {
+	fs := New("app")
+	assert.Equal(t, "/flags/app", fs.Name())
+	sw := &sliceWatcher{active: true}
+	fs.SetWatcher(sw)
+	fast := fs.Bool("fast", false, "go fast")
+	mode := fs.String("mode", "a", "")
+	assert.False(t, fast.Bool())
+	assert.Equal(t, "a", mode.String())
+
+	assert.Equal(t, source.ErrUnknownAction, fs.Action("nope", nil))
+	assert.Equal(t, source.ErrInvalidParam, fs.Action("override", map[string]string{
+		"flag": "slow", "value": "true",
+	}), "unknown flag")
+	assert.Equal(t, source.ErrInvalidParam, fs.Action("override", map[string]string{
+		"flag": "fast", "value": "very",
+	}), "bool flags need bool values")
+	assert.Equal(t, source.ErrInvalidParam, fs.Action("override", map[string]string{
+		"flag": "fast", "value": "true", "ttl": "-1s",
+	}), "invalid ttl")
+
+	require.NoError(t, fs.Action("override", map[string]string{
+		"flag": "fast", "value": "true", "ttl": "1h", "by": "ops", "reason": "test",
+	}))
+	assert.True(t, fast.Bool(), "overridden")
+	info := fs.Get().(Info)
+	require.Len(t, info.Flags, 2)
+	assert.Equal(t, "fast", info.Flags[0].Name)
+	assert.True(t, info.Flags[0].Overridden)
+	assert.Equal(t, "false", info.Flags[0].Default)
+	require.Len(t, sw.items, 1)
+	rec := sw.items[0].(AuditRecord)
+	assert.Equal(t, "override", rec.Action)
+	assert.Equal(t, "false", rec.Previous)
+	assert.Equal(t, "true", rec.Value)
+	assert.Equal(t, "ops", rec.By)
+	assert.Equal(t, "test", rec.Reason)
+
+	require.NoError(t, fs.Action("clear", map[string]string{"flag": "fast"}))
+	assert.False(t, fast.Bool(), "cleared")
+	require.NoError(t, fs.Action("clear", map[string]string{"flag": "fast"}), "clearing again is harmless")
+	assert.Len(t, fs.Get().(Info).Audit, 2, "only changes are audited")
+
+	require.NoError(t, fs.Action("override", map[string]string{
+		"flag": "mode", "value": "b", "ttl": "10ms",
+	}))
+	assert.Equal(t, "b", mode.String())
+	for i := 0; i < 100 && mode.String() != "a"; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	assert.Equal(t, "a", mode.String(), "override expired")
+	audit := fs.Get().(Info).Audit
+	require.Len(t, audit, 4)
+	assert.Equal(t, "expire", audit[3].Action)
+}
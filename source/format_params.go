@@ -0,0 +1,77 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package source
+
+import (
+	"context"
+	"strings"
+)
+
+type formatParamsKey struct{}
+
+// WithFormatParams returns a context carrying a client's request parameters,
+// for any ParamFormat that a watch made with it uses; no params returns ctx as
+// is.
+func WithFormatParams(ctx context.Context, params map[string]string) context.Context {
+	if len(params) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, formatParamsKey{}, params)
+}
+
+// FormatParams returns the parameters added to ctx by WithFormatParams, if
+// any.
+func FormatParams(ctx context.Context) map[string]string {
+	params, _ := ctx.Value(formatParamsKey{}).(map[string]string)
+	return params
+}
+
+// ParseFormat splits a format spec, a format name followed by any
+// ";"-separated arguments, like "json;pretty=1", into the name and the
+// arguments, which configure a ParamFormat like its request parameters do.
+// ErrInvalidParam is returned for an argument without a name or a value.
+func ParseFormat(spec string) (name string, args map[string]string, err error) {
+	parts := strings.Split(spec, ";")
+	name = strings.TrimSpace(parts[0])
+	for _, part := range parts[1:] {
+		if part = strings.TrimSpace(part); part == "" {
+			continue
+		}
+		i := strings.IndexByte(part, '=')
+		if i <= 0 {
+			return "", nil, ErrInvalidParam
+		}
+		if args == nil {
+			args = make(map[string]string, len(parts)-1)
+		}
+		args[strings.TrimSpace(part[:i])] = strings.TrimSpace(part[i+1:])
+	}
+	return name, args, nil
+}
+
+// FormatName returns the name of the format in a spec, without any arguments;
+// see ParseFormat.
+func FormatName(spec string) string {
+	if i := strings.IndexByte(spec, ';'); i >= 0 {
+		spec = spec[:i]
+	}
+	return strings.TrimSpace(spec)
+}
@@ -20,7 +20,12 @@
 
 package source
 
-import "text/template"
+import (
+	"fmt"
+	"io"
+	"text/template"
+	"time"
+)
 
 // GenericDataWatcher is the interface for the watcher passed to
 // GenericDataSource.SetWatcher.  Both single-item and batch methods are
@@ -65,17 +70,133 @@ type GetableDataSource interface {
 	Get() interface{}
 }
 
+// ParamGetableGenericDataSource is an optional interface that a
+// GetableDataSource may implement to accept parameters to Get; see
+// ParamGetableDataSource.
+type ParamGetableGenericDataSource interface {
+	GetableDataSource
+
+	// GetParams has all of the semantics of Get, with the addition of
+	// parameters; unknown parameters should be ignored, and ErrInvalidParam
+	// returned for an invalid value.
+	GetParams(params map[string]string) (interface{}, error)
+}
+
+// EmptyGetPolicy describes how a nil or empty result from
+// GetableDataSource.Get is served.
+type EmptyGetPolicy int
+
+const (
+	// EmptyGetMarshal marshals empty results like any other, e.g. as "null"
+	// or "[]" in json; this is the default.
+	EmptyGetMarshal EmptyGetPolicy = iota
+
+	// EmptyGetNoContent causes DataSource.Get to return ErrGetNoContent for
+	// empty results, which protocols serve as "no content" (e.g. an HTTP 204).
+	EmptyGetNoContent
+
+	// EmptyGetNotFound causes DataSource.Get to return ErrGetNotFound for
+	// empty results, which protocols serve as "not found" (e.g. an HTTP 404).
+	EmptyGetNotFound
+)
+
+// AttributedDataSource is an optional interface that GenericDataSources may
+// implement to describe themselves further, e.g. how they're configured; their
+// attributes are merged into those of the DataSource wrapping them, so are
+// shown by /meta/nouns.
+type AttributedDataSource interface {
+	GenericDataSource
+
+	// Attrs returns any descriptive attributes of the source; see
+	// DataSource.Attrs.
+	Attrs() map[string]interface{}
+}
+
+// EmptyGetDataSource is an optional interface that GetableDataSources may
+// implement to choose their EmptyGetPolicy.  A Get result is empty if it is
+// nil (including typed nils), or a zero-length slice, array, or map.
+type EmptyGetDataSource interface {
+	GetableDataSource
+
+	// EmptyGet returns the policy for serving empty Get results.
+	EmptyGet() EmptyGetPolicy
+}
+
+// QoSClass is a data source's quality of service class, which decides how its
+// watch traffic is shed when watchers can't keep up with it.  The only
+// pressure signal is how full the source's item queue is: when the process is
+// short on CPU, or watchers are slow, the queue backs up.  Memory use isn't
+// measured, nor is there a scheduler across sources; each source's queue is
+// shed on its own.
+type QoSClass int
+
+const (
+	// QoSStandard items wait briefly for room in a full queue; if none frees
+	// up, the source's watchers are ended.  This is the default.
+	QoSStandard QoSClass = iota
+
+	// QoSDebug items are shed first: once the queue is half full they're
+	// dropped rather than queued, and they never end the watch.
+	QoSDebug
+
+	// QoSCritical items are never dropped, e.g. for audit logs: the source
+	// is lossless, as if it were a LosslessDataSource whose timeout is a
+	// thousand times MaxWait (100ms by default), so its producer blocks until
+	// there's room in the queue.  Only a watcher that's stuck for longer is
+	// ended, so that it can tell it missed an item, and the producer isn't
+	// blocked for good.  A LosslessDataSource's own timeout takes precedence.
+	QoSCritical
+)
+
+func (qos QoSClass) String() string {
+	switch qos {
+	case QoSStandard:
+		return "standard"
+	case QoSDebug:
+		return "debug"
+	case QoSCritical:
+		return "critical"
+	default:
+		return fmt.Sprintf("QoSClass(%d)", int(qos))
+	}
+}
+
+// QoSDataSource is an optional interface that WatchableDataSources may
+// implement to choose their QoSClass.
+type QoSDataSource interface {
+	WatchableDataSource
+
+	// QoS returns the source's class of service.
+	QoS() QoSClass
+}
+
+// LosslessDataSource is an optional interface that WatchableDataSources may
+// implement to declare that they're lossless, e.g. for audit logs: rather than
+// ever dropping an item when watchers can't keep up, whatever its QoSClass,
+// the producer is blocked until there's room in the queue.  Such sources, and
+// QoSCritical ones, have a "lossless": true attr.
+type LosslessDataSource interface {
+	WatchableDataSource
+
+	// LosslessTimeout returns how long a producer may be blocked on a full
+	// queue, or zero to block for as long as it takes.  Once it's exceeded,
+	// the source's watchers are ended, so that they can tell that they missed
+	// items, rather than any being dropped silently.
+	LosslessTimeout() time.Duration
+}
+
 // WatchableDataSource is the interface implemented by GenericDataSources that
 // support Watch.  If a GenericDataSource does not implement
 // WatchableDataSource, then any watches for it return source.ErrNotWatchable.
 type WatchableDataSource interface {
 	GenericDataSource
 
-	// SetWatcher sets the watcher.
+	// SetWatcher adds a watcher.
 	//
-	// Implementations should retain a reference to the last passed watcher,
-	// and need not retain multiple; in the usual case this method will only be
-	// called once per data source lifecycle.
+	// In the usual case this method will only be called once per data source
+	// lifecycle, but a source added to more than one DataSources, or wrapped
+	// as well as added, is passed a watcher by each; implementations should
+	// retain every passed watcher, which AddWatcher makes easy.
 	//
 	// Implementations should pass items to watcher.HandleItem and/or
 	// watcher.HandleItems methods.
@@ -97,6 +218,21 @@ type ActivateWatchableDataSource interface {
 	Activate()
 }
 
+// DeactivateWatchableDataSource is an optional interface that
+// WatchableDataSources may implement to get notified when the
+// GenericDataWatcher transitions from active to inactive, e.g. once its last
+// watch ends or it's drained.  It may be used to release anything started by
+// Activate, or to skip checking the watcher's Active until reactivated; since
+// a source may have more than one watcher, it should check that the watcher
+// is still inactive first.
+type DeactivateWatchableDataSource interface {
+	WatchableDataSource
+
+	// Deactivate gets called after the GenericDataWatcher transitions from
+	// active to inactive.
+	Deactivate()
+}
+
 // WatchInitableDataSource is the interface that a WatchableDataSource should
 // implement if it wants to provide an initial data item to all new watch
 // streams.
@@ -107,6 +243,38 @@ type WatchInitableDataSource interface {
 	WatchInit() interface{}
 }
 
+// SampleItemDataSource is an optional interface that a WatchableDataSource
+// may implement to provide an example item, either synthetic or a recent
+// one, for previewing its formats; see SamplingDataSource.
+type SampleItemDataSource interface {
+	WatchableDataSource
+
+	// SampleItem returns an item like those passed to the GenericDataWatcher,
+	// and true, or false if there's none available.
+	SampleItem() (interface{}, bool)
+}
+
+// BacklogDataSource is an optional interface that a WatchableDataSource
+// which retains its recent items, such as Buffered, may implement, so that a
+// watch may start with a backlog of them in place of its init data; see
+// WithBacklog.
+type BacklogDataSource interface {
+	WatchableDataSource
+
+	// Backlog returns up to the n most recent items passed to the
+	// GenericDataWatcher, oldest first.
+	Backlog(n int) []interface{}
+}
+
+// ActionableDataSource is an optional interface that GenericDataSources may
+// implement to accept actions from clients; see ActionDataSource.
+type ActionableDataSource interface {
+	GenericDataSource
+
+	// Action has all of the semantics of ActionDataSource.Action.
+	Action(name string, params map[string]string) error
+}
+
 // GenericDataFormat provides both a data marshaling protocol and a framing
 // protocol for the watch stream.  Any marshaling or framing error should cause
 // a break in any watch streams subscribed to this format.
@@ -124,6 +292,59 @@ type GenericDataFormat interface {
 	FrameItem([]byte) ([]byte, error)
 }
 
+// GenericDataStreamFormat may be implemented by a GenericDataFormat to
+// marshal watch items directly to an io.Writer, rather than returning a new
+// byte slice for each one.  When implemented, MarshalItemTo is used instead of
+// MarshalItem, and the written bytes are then framed as usual.
+type GenericDataStreamFormat interface {
+	GenericDataFormat
+
+	// MarshalItemTo serializes data passed to a GenericDataWatcher, writing
+	// it to w; the written data must not be framed.
+	MarshalItemTo(w io.Writer, item interface{}) error
+}
+
+// GenericDataAppendFormat may be implemented by a GenericDataFormat to frame
+// watch items by appending them to a reused buffer, rather than returning a
+// new byte slice for each one.  When implemented, AppendFrame is used instead
+// of FrameItem to frame items for watch streams.
+type GenericDataAppendFormat interface {
+	GenericDataFormat
+
+	// AppendFrame appends the framed item to dst, returning the extended
+	// buffer; item must not be retained.
+	AppendFrame(dst, item []byte) ([]byte, error)
+}
+
+// HeaderFormat may be implemented by a GenericDataFormat whose watch streams
+// start with a header, such as a row of column names.  The header is written
+// in place of the init data of sources that have none, or that start with a
+// backlog; MarshalInit should include it in any init data.
+type HeaderFormat interface {
+	GenericDataFormat
+
+	// Header returns the unframed header, or nil if there's none.
+	Header() ([]byte, error)
+}
+
+// ParamFormat may be implemented by a GenericDataFormat that clients may
+// configure with request parameters, such as the columns of a table.  Gets
+// pass their parameters, while watches made through
+// ContextDataSource.WatchContext or ContextItemDataSource.WatchItemsContext
+// pass those added to their context by WithFormatParams.  Arguments given
+// with the format's name, as in "json;pretty=1", are passed too, taking
+// precedence; see ParseFormat.
+type ParamFormat interface {
+	GenericDataFormat
+
+	// Params returns the names of the parameters that configure the format.
+	Params() []string
+
+	// WithParams returns the format as configured by the given values of its
+	// parameters, or ErrInvalidParam if any is invalid.
+	WithParams(params map[string]string) (GenericDataFormat, error)
+}
+
 // GenericDataFormatFunc is a convenience for implement simple single-function
 // formats with newline framing.
 type GenericDataFormatFunc func(interface{}) ([]byte, error)
@@ -145,9 +366,10 @@ func (fn GenericDataFormatFunc) MarshalItem(item interface{}) ([]byte, error) {
 
 // FrameItem wraps a MarshalItem-ed byte buffer for a watch stream.
 func (fn GenericDataFormatFunc) FrameItem(buf []byte) ([]byte, error) {
-	n := len(buf)
-	frame := make([]byte, n+1)
-	copy(frame, buf)
-	frame[n] = '\n'
-	return frame, nil
+	return fn.AppendFrame(make([]byte, 0, len(buf)+1), buf)
+}
+
+// AppendFrame appends the item and a newline to dst.
+func (fn GenericDataFormatFunc) AppendFrame(dst, item []byte) ([]byte, error) {
+	return append(append(dst, item...), '\n'), nil
 }
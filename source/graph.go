@@ -0,0 +1,94 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package source
+
+import "sync"
+
+// DerivedSource is an optional interface that DataSources, and the
+// GenericDataSources that they wrap, may implement to name the sources that
+// their items are derived from, e.g. by aggregating, or by running a script;
+// the relationships are shown by the "/meta/graph" source.
+type DerivedSource interface {
+	// Inputs returns the names of the sources that are consumed.
+	Inputs() []string
+}
+
+// Consumer describes something, other than a data source, that consumes the
+// items of sources, such as a reporter, or a relay to a remote server; see
+// AddConsumer.
+type Consumer struct {
+	// Kind is the kind of consumer, e.g. "reporter".
+	Kind string `json:"kind"`
+
+	// Name describes the consumer, e.g. "loki"; it need not be unique.
+	Name string `json:"name"`
+
+	// Inputs are the names of the sources that are consumed.
+	Inputs []string `json:"inputs"`
+}
+
+var consumers struct {
+	sync.Mutex
+	next    uint64
+	entries []consumerEntry
+}
+
+type consumerEntry struct {
+	id uint64
+	Consumer
+}
+
+// AddConsumer registers a consumer, for the "/meta/graph" source, until the
+// returned function is called, e.g. when a reporter is stopped.
+func AddConsumer(c Consumer) (remove func()) {
+	c.Inputs = append([]string(nil), c.Inputs...)
+	consumers.Lock()
+	consumers.next++
+	id := consumers.next
+	consumers.entries = append(consumers.entries, consumerEntry{id, c})
+	consumers.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			consumers.Lock()
+			defer consumers.Unlock()
+			for i, entry := range consumers.entries {
+				if entry.id == id {
+					consumers.entries = append(consumers.entries[:i], consumers.entries[i+1:]...)
+					return
+				}
+			}
+		})
+	}
+}
+
+// Consumers returns all registered consumers, in the order that they were
+// added.
+func Consumers() []Consumer {
+	consumers.Lock()
+	defer consumers.Unlock()
+	cs := make([]Consumer, len(consumers.entries))
+	for i, entry := range consumers.entries {
+		cs[i] = entry.Consumer
+	}
+	return cs
+}
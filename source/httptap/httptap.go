@@ -0,0 +1,225 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+/*
+Package httptap provides watchable sources of the requests served by an
+http.Handler, so that a server's traffic may be watched without adding
+logging to it.
+
+A Handler wraps another handler, and is watchable as two sources, named like
+"/http/.../requests" and "/http/.../responses": the first emits each request
+as it arrives, the second each response once it's written, with its status,
+size, and how long it took to serve, e.g.:
+
+	log.Fatal(http.ListenAndServe(":8080", httptap.Add("app", mux)))
+
+Besides the usual formats, both sources may be watched as csv or tsv, with a
+header row naming the json fields of their items, e.g. to load a capture of
+the traffic into a spreadsheet.
+
+While neither source has watchers, requests are served by the wrapped
+handler as they would be without the tap.
+*/
+package httptap
+
+import (
+	"fmt"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/uber-go/gwr"
+	"github.com/uber-go/gwr/source"
+)
+
+var (
+	requestTextTemplate = template.Must(template.New("httptap_request_text").Parse(`
+{{ define "item" }}{{ .Method }} {{ .Path }} {{ .Query }}{{ end }}
+`))
+	responseTextTemplate = template.Must(template.New("httptap_response_text").Parse(`
+{{ define "item" }}{{ .Code }} {{ .Bytes }} {{ .ContentType }}{{ end }}
+`))
+)
+
+// Request is an item of a Handler's requests source.
+type Request struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	Query  string `json:"query"`
+}
+
+// Response is an item of a Handler's responses source.
+type Response struct {
+	Method      string  `json:"method"`
+	Path        string  `json:"path"`
+	Code        int     `json:"code"`
+	Bytes       int     `json:"bytes"`
+	ContentType string  `json:"content_type"`
+	Duration    float64 `json:"duration_ms"`
+}
+
+// Handler is an http.Handler that serves requests with another handler,
+// emitting them to its requests and responses sources.
+type Handler struct {
+	handler http.Handler
+	reqs    *tapSource
+	resps   *tapSource
+}
+
+// New creates a Handler wrapping handler.
+//
+// The given name will be prefixed with "/http/" automatically, and suffixed
+// by "/requests" and "/responses" for its two sources.
+func New(name string, handler http.Handler) *Handler {
+	return &Handler{
+		handler: handler,
+		reqs: &tapSource{
+			name:    fmt.Sprintf("/http/%s/requests", name),
+			tmpl:    requestTextTemplate,
+			example: Request{},
+		},
+		resps: &tapSource{
+			name:    fmt.Sprintf("/http/%s/responses", name),
+			tmpl:    responseTextTemplate,
+			example: Response{},
+		},
+	}
+}
+
+// Add creates a Handler and adds both of its sources to the default gwr
+// sources.
+func Add(name string, handler http.Handler) *Handler {
+	th := New(name, handler)
+	gwr.AddGenericDataSource(th.reqs)
+	gwr.AddGenericDataSource(th.resps)
+	return th
+}
+
+// Requests returns the source of requests, emitted as they arrive.
+func (th *Handler) Requests() source.WatchableDataSource {
+	return th.reqs
+}
+
+// Responses returns the source of responses, emitted once they've been
+// written.
+func (th *Handler) Responses() source.WatchableDataSource {
+	return th.resps
+}
+
+// ServeHTTP serves the request with the wrapped handler, emitting it and its
+// response to any watchers.
+func (th *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if th.reqs.active() {
+		th.reqs.watcher.HandleItem(Request{
+			Method: r.Method,
+			Path:   r.URL.Path,
+			Query:  r.URL.RawQuery,
+		})
+	}
+
+	if !th.resps.active() {
+		th.handler.ServeHTTP(w, r)
+		return
+	}
+
+	start := time.Now()
+	rec := &recorder{ResponseWriter: w}
+	th.handler.ServeHTTP(rec, r)
+	if rec.code == 0 {
+		rec.code = http.StatusOK
+	}
+	th.resps.watcher.HandleItem(Response{
+		Method:      r.Method,
+		Path:        r.URL.Path,
+		Code:        rec.code,
+		Bytes:       rec.bytes,
+		ContentType: rec.contentType(),
+		Duration:    float64(time.Since(start)) / float64(time.Millisecond),
+	})
+}
+
+type tapSource struct {
+	name    string
+	tmpl    *template.Template
+	example interface{}
+	watcher source.GenericDataWatcher
+}
+
+func (ts *tapSource) Name() string                     { return ts.name }
+func (ts *tapSource) TextTemplate() *template.Template { return ts.tmpl }
+func (ts *tapSource) SetWatcher(watcher source.GenericDataWatcher) {
+	ts.watcher = source.AddWatcher(ts.watcher, watcher)
+}
+
+// Formats adds csv and tsv, with a column for each field of the items.
+func (ts *tapSource) Formats() map[string]source.GenericDataFormat {
+	return map[string]source.GenericDataFormat{
+		"csv": source.NewCSVFormat(ts.example),
+		"tsv": source.NewTSVFormat(ts.example),
+	}
+}
+
+func (ts *tapSource) active() bool {
+	return ts.watcher != nil && ts.watcher.Active()
+}
+
+// recorder records the status code and size of a response as it's written
+// through to the client.
+type recorder struct {
+	http.ResponseWriter
+	code    int
+	bytes   int
+	sniffed string
+}
+
+func (rec *recorder) WriteHeader(code int) {
+	if rec.code == 0 {
+		rec.code = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *recorder) Write(p []byte) (int, error) {
+	if rec.code == 0 {
+		rec.code = http.StatusOK
+	}
+	if rec.bytes == 0 && rec.sniffed == "" && len(p) > 0 {
+		rec.sniffed = http.DetectContentType(p)
+	}
+	n, err := rec.ResponseWriter.Write(p)
+	rec.bytes += n
+	return n, err
+}
+
+// contentType returns the response's Content-Type, or else the type that
+// net/http will have sniffed from its first write.
+func (rec *recorder) contentType() string {
+	if ct := rec.Header().Get("Content-Type"); ct != "" {
+		return ct
+	}
+	return rec.sniffed
+}
+
+// Flush flushes the underlying response, if it may be.
+func (rec *recorder) Flush() {
+	if fl, ok := rec.ResponseWriter.(http.Flusher); ok {
+		fl.Flush()
+	}
+}
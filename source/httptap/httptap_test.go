@@ -0,0 +1,102 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package httptap
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber-go/gwr/source"
+)
+
+type sliceWatcher struct {
+	active bool
+	items  []interface{}
+}
+
+func (sw *sliceWatcher) Active() bool { return sw.active }
+
+func (sw *sliceWatcher) HandleItem(item interface{}) bool {
+	sw.items = append(sw.items, item)
+	return true
+}
+
+func (sw *sliceWatcher) HandleItems(items []interface{}) bool {
+	sw.items = append(sw.items, items...)
+	return true
+}
+
+func TestHandler(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hello", func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "hello\n")
+	})
+	th := New("test", mux)
+	assert.Equal(t, "/http/test/requests", th.Requests().Name())
+	assert.Equal(t, "/http/test/responses", th.Responses().Name())
+
+	reqs, resps := &sliceWatcher{}, &sliceWatcher{}
+	th.Requests().SetWatcher(reqs)
+	th.Responses().SetWatcher(resps)
+
+	serve := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		th.ServeHTTP(rec, httptest.NewRequest("GET", target, nil))
+		return rec
+	}
+
+	assert.Equal(t, "hello\n", serve("/hello").Body.String())
+	assert.Empty(t, reqs.items, "nothing emitted while inactive")
+	assert.Empty(t, resps.items, "nothing emitted while inactive")
+
+	reqs.active, resps.active = true, true
+	assert.Equal(t, "hello\n", serve("/hello?a=1").Body.String())
+	assert.Equal(t, http.StatusNotFound, serve("/nope").Code)
+
+	assert.Equal(t, []interface{}{
+		Request{Method: "GET", Path: "/hello", Query: "a=1"},
+		Request{Method: "GET", Path: "/nope"},
+	}, reqs.items)
+	require.Len(t, resps.items, 2)
+	ok, notFound := resps.items[0].(Response), resps.items[1].(Response)
+	assert.Equal(t, "/hello", ok.Path)
+	assert.Equal(t, http.StatusOK, ok.Code)
+	assert.Equal(t, 6, ok.Bytes)
+	assert.Equal(t, "text/plain; charset=utf-8", ok.ContentType)
+	assert.Equal(t, http.StatusNotFound, notFound.Code)
+	assert.Equal(t, 19, notFound.Bytes)
+}
+
+func TestHandler_csv(t *testing.T) {
+	th := New("test", http.NotFoundHandler())
+	format := th.Requests().(source.GenericDataSourceFormats).Formats()["csv"]
+	require.NotNil(t, format)
+	buf, err := format.MarshalGet([]interface{}{
+		Request{Method: "GET", Path: "/a", Query: "x=1,2"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "method,path,query\nGET,/a,\"x=1,2\"\n", string(buf))
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package source
+
+import "sync/atomic"
+
+// Identity identifies this process among the instances of a service, so that
+// when their items are aggregated, e.g. by a relay or a sink, where each came
+// from is unambiguous.  Any field may be empty.
+type Identity struct {
+	Service  string `json:"service,omitempty" yaml:"service"`
+	Instance string `json:"instance,omitempty" yaml:"instance"`
+	Zone     string `json:"zone,omitempty" yaml:"zone"`
+}
+
+// IsZero returns true if no field is set.
+func (id Identity) IsZero() bool {
+	return id == Identity{}
+}
+
+// Labels returns the set fields, by their json names.
+func (id Identity) Labels() map[string]string {
+	labels := make(map[string]string, 3)
+	for _, field := range []struct{ name, val string }{
+		{"service", id.Service},
+		{"instance", id.Instance},
+		{"zone", id.Zone},
+	} {
+		if field.val != "" {
+			labels[field.name] = field.val
+		}
+	}
+	return labels
+}
+
+var identity atomic.Value
+
+func init() {
+	identity.Store(Identity{})
+}
+
+// SetIdentity sets the process's identity, which the protocols attach to the
+// envelopes of items that they wrap, and which reporters add to what they
+// send.  It's set by gwr.Configure.
+func SetIdentity(id Identity) {
+	identity.Store(id)
+}
+
+// ProcessIdentity returns the identity set by SetIdentity.
+func ProcessIdentity() Identity {
+	return identity.Load().(Identity)
+}
@@ -24,6 +24,7 @@ package source
 type Info struct {
 	Formats []string               `json:"formats"`
 	Attrs   map[string]interface{} `json:"attrs"`
+	Stats   *Stats                 `json:"stats,omitempty"`
 }
 
 // GetInfo returns a structure that contains format and other information about
@@ -37,9 +38,34 @@ func GetInfo(ds DataSource) Info {
 
 // Info returns a map of info about all sources.
 func (dss *DataSources) Info() map[string]Info {
-	info := make(map[string]Info, len(dss.sources))
-	for name, ds := range dss.sources {
-		info[name] = GetInfo(ds)
+	all := dss.all()
+	info := make(map[string]Info, len(all))
+	for _, ds := range all {
+		info[ds.Name()] = GetInfo(ds)
+	}
+	return info
+}
+
+// InfoMatching returns a map of info about all sources whose names match the
+// given pattern; see DataSources.Match.
+func (dss *DataSources) InfoMatching(pattern string) map[string]Info {
+	matched := dss.Match(pattern)
+	info := make(map[string]Info, len(matched))
+	for _, ds := range matched {
+		info[ds.Name()] = GetInfo(ds)
+	}
+	return info
+}
+
+// LongInfoMatching is like InfoMatching, but also includes the Stats of each
+// source that keeps them.
+func (dss *DataSources) LongInfoMatching(pattern string) map[string]Info {
+	matched := dss.Match(pattern)
+	info := make(map[string]Info, len(matched))
+	for _, ds := range matched {
+		i := GetInfo(ds)
+		i.Stats = GetStats(ds)
+		info[ds.Name()] = i
 	}
 	return info
 }
@@ -20,6 +20,11 @@
 
 package source
 
+import (
+	"context"
+	"time"
+)
+
 // ItemDataSource is an interface implemented by a data source to provide
 // marshaled but unframed streams of Watch items.  When implemented protocol
 // libraries can add protocol-specific builtin framing.
@@ -35,6 +40,16 @@ type ItemDataSource interface {
 	WatchItems(format string, watcher ItemWatcher) error
 }
 
+// ContextItemDataSource is an ItemDataSource that supports item watches
+// scoped to a context.
+type ContextItemDataSource interface {
+	ItemDataSource
+
+	// WatchItemsContext is to WatchItems as ContextDataSource.WatchContext
+	// is to DataSource.Watch.
+	WatchItemsContext(ctx context.Context, format string, watcher ItemWatcher) error
+}
+
 // ItemWatcher is the interface passed to ItemSource.WatchItems.  Any
 // error returned by either HandleItem or HandleItems indicates that this
 // watcher should not be called with more items.
@@ -48,6 +63,19 @@ type ItemWatcher interface {
 	HandleItems(items [][]byte) error
 }
 
+// TimedItemWatcher is an ItemWatcher that also wants to know when each item
+// was emitted by its data source; data sources that track emission time call
+// the timed methods instead of HandleItem and HandleItems.
+type TimedItemWatcher interface {
+	ItemWatcher
+
+	// HandleTimedItem is HandleItem for an item emitted at the given time.
+	HandleTimedItem(t time.Time, item []byte) error
+
+	// HandleTimedItems is HandleItems for a batch emitted at the given time.
+	HandleTimedItems(t time.Time, items [][]byte) error
+}
+
 // ItemWatcherFunc is a convenience type for watching with a simple
 // per-item function.  The item function should return any framing or write
 // error.
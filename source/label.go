@@ -0,0 +1,46 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package source
+
+import "context"
+
+// MaxWatchLabel is the longest label that a client may attach to a watch.
+const MaxWatchLabel = 128
+
+type watchLabelKey struct{}
+
+// WithWatchLabel returns a context carrying a client's label for a watch, such
+// as "oncall-jdoe-incident-123", so that the watch's load may be attributed
+// to them; an empty label returns ctx as is.  Watches made through
+// ContextDataSource.WatchContext or ContextItemDataSource.WatchItemsContext
+// with the context are counted under the label in their source's Stats.
+func WithWatchLabel(ctx context.Context, label string) context.Context {
+	if label == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, watchLabelKey{}, label)
+}
+
+// WatchLabel returns the label added to ctx by WithWatchLabel, if any.
+func WatchLabel(ctx context.Context) string {
+	label, _ := ctx.Value(watchLabelKey{}).(string)
+	return label
+}
@@ -0,0 +1,160 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+/*
+Package logtap provides a watchable source of the lines written to an
+io.Writer, so that standard library logging, or anything else that writes
+lines, can be tapped without changing how it logs.
+
+Log sources will be named like "/logs/...".  A Writer may be used directly
+as a log.Logger's output, or teed with another writer, e.g.:
+
+	log.SetOutput(io.MultiWriter(os.Stderr, logtap.Add("std")))
+
+While the source has no watchers, writes return after checking for them;
+nothing is buffered.
+*/
+package logtap
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/uber-go/gwr"
+	"github.com/uber-go/gwr/source"
+)
+
+var textFormat = source.GenericDataFormatFunc(func(item interface{}) ([]byte, error) {
+	if line, ok := item.(string); ok {
+		return []byte(line), nil
+	}
+	return json.Marshal(item)
+})
+
+// Writer is an io.Writer whose written lines are emitted as items by a
+// watchable source.
+type Writer struct {
+	// ParseJSON, if set, causes each line to be parsed as json, with the
+	// parsed value being emitted instead of the line; lines that aren't valid
+	// json are still emitted as strings.  It must be set before the source is
+	// added.
+	ParseJSON bool
+
+	name    string
+	watcher source.GenericDataWatcher
+
+	lock    sync.Mutex
+	partial []byte
+}
+
+// New creates a Writer source.
+//
+// The given name will be prefixed with "/logs/" automatically.
+func New(name string) *Writer {
+	return &Writer{
+		name: fmt.Sprintf("/logs/%s", name),
+	}
+}
+
+// Add creates a Writer source and adds it to the default gwr sources.
+func Add(name string) *Writer {
+	lw := New(name)
+	gwr.AddGenericDataSource(lw)
+	return lw
+}
+
+// Logger returns a log.Logger that writes to the Writer.
+func (lw *Writer) Logger(prefix string, flag int) *log.Logger {
+	return log.New(lw, prefix, flag)
+}
+
+// Name returns the full name of the source; this will be
+// "/logs/name_given_to_New".
+func (lw *Writer) Name() string {
+	return lw.name
+}
+
+// Formats returns a text format that writes lines as-is, and any parsed json
+// values as json.
+func (lw *Writer) Formats() map[string]source.GenericDataFormat {
+	return map[string]source.GenericDataFormat{
+		"text": textFormat,
+	}
+}
+
+// SetWatcher adds a watcher at source addition time.
+func (lw *Writer) SetWatcher(watcher source.GenericDataWatcher) {
+	lw.watcher = source.AddWatcher(lw.watcher, watcher)
+}
+
+// Write emits every complete line written; any trailing partial line is held
+// until the rest of it is written.  Write never fails, so that it may be
+// used alongside other writers without affecting them.
+func (lw *Writer) Write(p []byte) (int, error) {
+	if lw.watcher == nil || !lw.watcher.Active() {
+		lw.lock.Lock()
+		lw.partial = lw.partial[:0]
+		lw.lock.Unlock()
+		return len(p), nil
+	}
+
+	lw.lock.Lock()
+	defer lw.lock.Unlock()
+	buf := p
+	if len(lw.partial) > 0 {
+		lw.partial = append(lw.partial, p...)
+		buf = lw.partial
+	}
+	var items []interface{}
+	for {
+		i := bytes.IndexByte(buf, '\n')
+		if i < 0 {
+			break
+		}
+		items = append(items, lw.item(buf[:i]))
+		buf = buf[i+1:]
+	}
+	lw.partial = append(lw.partial[:0], buf...)
+
+	switch len(items) {
+	case 0:
+	case 1:
+		lw.watcher.HandleItem(items[0])
+	default:
+		lw.watcher.HandleItems(items)
+	}
+	return len(p), nil
+}
+
+func (lw *Writer) item(line []byte) interface{} {
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		line = line[:n-1]
+	}
+	if lw.ParseJSON {
+		var val interface{}
+		if err := json.Unmarshal(line, &val); err == nil {
+			return val
+		}
+	}
+	return string(line)
+}
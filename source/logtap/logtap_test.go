@@ -0,0 +1,69 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package logtap
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type sliceWatcher struct {
+	active bool
+	items  []interface{}
+}
+
+func (sw *sliceWatcher) Active() bool { return sw.active }
+
+func (sw *sliceWatcher) HandleItem(item interface{}) bool {
+	sw.items = append(sw.items, item)
+	return true
+}
+
+func (sw *sliceWatcher) HandleItems(items []interface{}) bool {
+	sw.items = append(sw.items, items...)
+	return true
+}
+
+func TestWriter(t *testing.T) {
+	lw := New("app")
+	lw.ParseJSON = true
+	assert.Equal(t, "/logs/app", lw.Name())
+
+	sw := &sliceWatcher{}
+	lw.SetWatcher(sw)
+	fmt.Fprintf(lw, "unwatched\npart")
+	assert.Empty(t, sw.items, "nothing emitted while inactive")
+
+	sw.active = true
+	fmt.Fprintf(lw, "ial\nplain\r\n{\"a\": 1}\npart")
+	fmt.Fprintf(lw, "ial")
+	fmt.Fprintf(lw, " line\n")
+	lw.Logger("app: ", 0).Printf("logged %d", 42)
+	assert.Equal(t, []interface{}{
+		"ial",
+		"plain",
+		map[string]interface{}{"a": 1.0},
+		"partial line",
+		"app: logged 42",
+	}, sw.items)
+}
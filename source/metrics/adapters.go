@@ -0,0 +1,142 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Registry is the part of a github.com/rcrowley/go-metrics Registry used by
+// FromGoMetrics.
+type Registry interface {
+	Each(func(name string, metric interface{}))
+}
+
+// The methods of go-metrics' metrics that FromGoMetrics reads: Counters and
+// Meters are counted, and Histograms and Timers summarized.
+type (
+	goCounter interface {
+		Count() int64
+	}
+	goGauge interface {
+		Value() int64
+	}
+	goGaugeFloat64 interface {
+		Value() float64
+	}
+	goHistogram interface {
+		Count() int64
+		Min() int64
+		Max() int64
+		Mean() float64
+		Percentiles([]float64) []float64
+	}
+)
+
+// FromGoMetrics returns a function taking snapshots of the metrics in a
+// github.com/rcrowley/go-metrics Registry; metrics of other kinds are left
+// out.
+func FromGoMetrics(reg Registry) func() Snapshot {
+	return func() Snapshot {
+		snap := newSnapshot()
+		reg.Each(func(name string, metric interface{}) {
+			switch m := metric.(type) {
+			case goHistogram:
+				hist := Histogram{
+					Count:       m.Count(),
+					Min:         float64(m.Min()),
+					Max:         float64(m.Max()),
+					Mean:        m.Mean(),
+					Percentiles: make(map[string]float64, len(Percentiles)),
+				}
+				for i, val := range m.Percentiles(Percentiles) {
+					hist.Percentiles[PercentileName(Percentiles[i])] = val
+				}
+				snap.Histograms[name] = hist
+			case goGauge:
+				snap.Gauges[name] = float64(m.Value())
+			case goGaugeFloat64:
+				snap.Gauges[name] = m.Value()
+			case goCounter:
+				snap.Counters[name] = m.Count()
+			}
+		})
+		return snap
+	}
+}
+
+// FromCodahale returns a function taking snapshots of github.com/codahale/metrics,
+// given its Snapshot function.  Its histograms are published as gauges named
+// like "name.P99"; those are gathered back into Histograms, by percentile.
+func FromCodahale(snapshot func() (counters, gauges map[string]uint64)) func() Snapshot {
+	return func() Snapshot {
+		snap := newSnapshot()
+		counters, gauges := snapshot()
+		for name, val := range counters {
+			snap.Counters[name] = int64(val)
+		}
+		for name, val := range gauges {
+			hname, p, ok := codahalePercentile(name)
+			if !ok {
+				snap.Gauges[name] = float64(val)
+				continue
+			}
+			hist := snap.Histograms[hname]
+			if hist.Percentiles == nil {
+				hist.Percentiles = make(map[string]float64)
+			}
+			hist.Percentiles[PercentileName(p)] = float64(val)
+			snap.Histograms[hname] = hist
+		}
+		return snap
+	}
+}
+
+// codahalePercentile splits the name of a codahale histogram's gauge, like
+// "latency.P999", into the histogram's name and the percentile, 0.999.
+func codahalePercentile(name string) (string, float64, bool) {
+	i := strings.LastIndex(name, ".P")
+	if i < 0 {
+		return "", 0, false
+	}
+	digits := name[i+2:]
+	if len(digits) < 2 {
+		return "", 0, false
+	}
+	n, err := strconv.Atoi(digits)
+	if err != nil || n < 0 {
+		return "", 0, false
+	}
+	p := float64(n) / 100
+	for scale := len(digits) - 2; scale > 0; scale-- {
+		p /= 10
+	}
+	return name[:i], p, true
+}
+
+func newSnapshot() Snapshot {
+	return Snapshot{
+		Counters:   make(map[string]int64),
+		Gauges:     make(map[string]float64),
+		Histograms: make(map[string]Histogram),
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+/*
+Package metrics provides get-able sources of snapshots of an application's
+metrics, as kept by a metrics library, rendering histograms by their
+percentiles in text.
+
+Sources will be named like "/metrics/...".  Each takes a function returning a
+Snapshot; rather than importing any metrics library, adapters build one from
+a library's registry by the methods that its metrics have, e.g. for
+github.com/rcrowley/go-metrics and github.com/codahale/metrics:
+
+	metrics.Add("app", metrics.FromGoMetrics(gometrics.DefaultRegistry))
+	metrics.Add("codahale", metrics.FromCodahale(codahale.Snapshot))
+
+Other libraries, such as tally, whose snapshots are of their own types, may be
+adapted by a function filling in a Snapshot.
+*/
+package metrics
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/uber-go/gwr"
+)
+
+// Percentiles are the percentiles that adapters read from histograms.
+var Percentiles = []float64{0.5, 0.75, 0.95, 0.99, 0.999}
+
+var snapshotTextTemplate = template.Must(template.New("metrics_text").Parse(strings.TrimSpace(`
+{{ define "get" -}}
+{{ range $name, $val := .Counters }}{{ $name }}: {{ $val }}
+{{ end -}}
+{{ range $name, $val := .Gauges }}{{ $name }}: {{ $val }}
+{{ end -}}
+{{ range $name, $hist := .Histograms }}{{ $name }}: count={{ $hist.Count }} min={{ $hist.Min }} mean={{ printf "%.2f" $hist.Mean }} max={{ $hist.Max }}
+{{- range $p, $val := $hist.Percentiles }} {{ $p }}={{ $val }}{{ end }}
+{{ end -}}
+{{ end }}
+`)))
+
+// Snapshot is a reading of a set of metrics, by name.
+type Snapshot struct {
+	Counters   map[string]int64     `json:"counters,omitempty"`
+	Gauges     map[string]float64   `json:"gauges,omitempty"`
+	Histograms map[string]Histogram `json:"histograms,omitempty"`
+}
+
+// Histogram summarizes a distribution of values, such as a timer's.
+// Percentiles are keyed by their name; see PercentileName.
+type Histogram struct {
+	Count       int64              `json:"count"`
+	Min         float64            `json:"min"`
+	Max         float64            `json:"max"`
+	Mean        float64            `json:"mean"`
+	Percentiles map[string]float64 `json:"percentiles,omitempty"`
+}
+
+// PercentileName returns the name of a percentile, given as a fraction, e.g.
+// "p99.9" for 0.999.
+func PercentileName(p float64) string {
+	return "p" + strconv.FormatFloat(p*100, 'g', 6, 64)
+}
+
+// Source is a get-able source of metrics snapshots.
+type Source struct {
+	name     string
+	snapshot func() Snapshot
+}
+
+// New creates a Source, named "/metrics/name", of the snapshots returned by
+// the given function.
+func New(name string, snapshot func() Snapshot) *Source {
+	return &Source{
+		name:     fmt.Sprintf("/metrics/%s", strings.TrimPrefix(name, "/")),
+		snapshot: snapshot,
+	}
+}
+
+// Add creates a Source and adds it to the default gwr sources.
+func Add(name string, snapshot func() Snapshot) *Source {
+	src := New(name, snapshot)
+	gwr.AddGenericDataSource(src)
+	return src
+}
+
+// Name returns the full name of the source.
+func (src *Source) Name() string {
+	return src.name
+}
+
+// TextTemplate returns a text/template listing each metric on a line, with
+// histograms summarized by their percentiles.
+func (src *Source) TextTemplate() *template.Template {
+	return snapshotTextTemplate
+}
+
+// Get takes a snapshot.
+func (src *Source) Get() interface{} {
+	return src.snapshot()
+}
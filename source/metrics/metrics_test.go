@@ -0,0 +1,97 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package metrics_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber-go/gwr/internal/marshaled"
+	"github.com/uber-go/gwr/source/metrics"
+)
+
+type counter int64
+
+func (c counter) Count() int64 { return int64(c) }
+
+type gauge int64
+
+func (g gauge) Value() int64 { return int64(g) }
+
+type histogram []int64
+
+func (h histogram) Count() int64  { return int64(len(h)) }
+func (h histogram) Min() int64    { return h[0] }
+func (h histogram) Max() int64    { return h[len(h)-1] }
+func (h histogram) Mean() float64 { return float64(h[0]+h[len(h)-1]) / 2 }
+
+func (h histogram) Percentiles(ps []float64) []float64 {
+	vals := make([]float64, len(ps))
+	for i, p := range ps {
+		vals[i] = float64(h[int(p*float64(len(h)-1))])
+	}
+	return vals
+}
+
+type registry map[string]interface{}
+
+func (reg registry) Each(f func(string, interface{})) {
+	for name, metric := range reg {
+		f(name, metric)
+	}
+}
+
+func TestFromGoMetrics(t *testing.T) {
+	src := metrics.New("app", metrics.FromGoMetrics(registry{
+		"requests": counter(12),
+		"conns":    gauge(3),
+		"latency":  histogram{1, 2, 3, 4, 5, 6, 7, 8, 9, 10},
+		"other":    "ignored",
+	}))
+	assert.Equal(t, "/metrics/app", src.Name())
+
+	var buf bytes.Buffer
+	require.NoError(t, marshaled.NewDataSource(src, nil).Get("text", &buf))
+	assert.Equal(t, ""+
+		"requests: 12\n"+
+		"conns: 3\n"+
+		"latency: count=10 min=1 mean=5.50 max=10 p50=5 p75=7 p95=9 p99=9 p99.9=9\n",
+		buf.String())
+}
+
+func TestFromCodahale(t *testing.T) {
+	snap := metrics.FromCodahale(func() (map[string]uint64, map[string]uint64) {
+		return map[string]uint64{"requests": 5}, map[string]uint64{
+			"conns":        2,
+			"latency.P50":  10,
+			"latency.P999": 90,
+			"odd.Px":       1,
+		}
+	})()
+	assert.Equal(t, map[string]int64{"requests": 5}, snap.Counters)
+	assert.Equal(t, map[string]float64{"conns": 2, "odd.Px": 1}, snap.Gauges)
+	assert.Equal(t, map[string]metrics.Histogram{
+		"latency": {Percentiles: map[string]float64{"p50": 10, "p99.9": 90}},
+	}, snap.Histograms)
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package source
+
+import "fmt"
+
+// PanicError is returned in place of a panic recovered from user-provided
+// source code, such as a GetableDataSource.Get or a GenericDataFormat marshal
+// function.
+type PanicError struct {
+	Source string `json:"source"`
+	Op     string `json:"op"`
+	Value  string `json:"value"`
+	Stack  string `json:"stack"`
+}
+
+// Error returns a short description of the panic, without the stack.
+func (pe *PanicError) Error() string {
+	return fmt.Sprintf("%s: panic during %s: %s", pe.Source, pe.Op, pe.Value)
+}
+
+// NewPanicError creates a PanicError from a recovered value and stack; it is
+// intended for DataSource implementations that wrap user-provided code.
+func NewPanicError(name, op string, val interface{}, stack []byte) *PanicError {
+	return &PanicError{
+		Source: name,
+		Op:     op,
+		Value:  fmt.Sprint(val),
+		Stack:  string(stack),
+	}
+}
@@ -0,0 +1,149 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package source
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimit bounds how many items, and bytes of items, are passed on per
+// second; either may be zero to not bound it.
+type RateLimit struct {
+	Items float64 `yaml:"items" json:"items,omitempty"`
+	Bytes float64 `yaml:"bytes" json:"bytes,omitempty"`
+}
+
+// Unlimited returns true if neither items nor bytes are bounded.
+func (rl RateLimit) Unlimited() bool {
+	return rl.Items <= 0 && rl.Bytes <= 0
+}
+
+// Min returns the tighter of the two limits' bounds, bound by bound.
+func (rl RateLimit) Min(other RateLimit) RateLimit {
+	return RateLimit{
+		Items: minRate(rl.Items, other.Items),
+		Bytes: minRate(rl.Bytes, other.Bytes),
+	}
+}
+
+func minRate(a, b float64) float64 {
+	if a <= 0 || (b > 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// RateLimiter enforces a RateLimit, allowing bursts of up to a second's
+// worth.  A nil RateLimiter allows everything, as does one for an unlimited
+// RateLimit.  RateLimiters are safe for concurrent use.
+type RateLimiter struct {
+	limit RateLimit
+
+	lock  sync.Mutex
+	last  time.Time
+	items float64
+	bytes float64
+}
+
+// NewRateLimiter returns a RateLimiter enforcing lim, starting with a full
+// second's burst; an unlimited lim returns nil.
+func NewRateLimiter(lim RateLimit) *RateLimiter {
+	if lim.Unlimited() {
+		return nil
+	}
+	return &RateLimiter{
+		limit: lim,
+		last:  time.Now(),
+		items: lim.Items,
+		bytes: lim.Bytes,
+	}
+}
+
+// Limit returns the enforced limit.
+func (rl *RateLimiter) Limit() RateLimit {
+	if rl == nil {
+		return RateLimit{}
+	}
+	return rl.limit
+}
+
+// Allow returns true, taking its share of the limit, if an item of n bytes
+// may be passed on now.  An item bigger than the byte limit's burst is still
+// allowed once the burst is full, so that the limit can't starve it forever;
+// the items after it wait for the overdraft to be paid back.
+func (rl *RateLimiter) Allow(n int) bool {
+	if rl == nil {
+		return true
+	}
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	now := time.Now()
+	elapsed := now.Sub(rl.last).Seconds()
+	rl.last = now
+	if lim := rl.limit.Items; lim > 0 {
+		if rl.items += elapsed * lim; rl.items > lim {
+			rl.items = lim
+		}
+	}
+	if lim := rl.limit.Bytes; lim > 0 {
+		if rl.bytes += elapsed * lim; rl.bytes > lim {
+			rl.bytes = lim
+		}
+	}
+
+	if rl.limit.Items > 0 && rl.items < 1 {
+		return false
+	}
+	if rl.limit.Bytes > 0 && rl.bytes <= 0 {
+		return false
+	}
+	if rl.limit.Items > 0 {
+		rl.items--
+	}
+	if rl.limit.Bytes > 0 {
+		rl.bytes -= float64(n)
+	}
+	return true
+}
+
+type rateLimiterKey struct{}
+
+// WithRateLimiter returns a context carrying a RateLimiter shared by a
+// client's watches, such as all those of one connection; a nil limiter
+// returns ctx as is.  Watches made through ContextDataSource.WatchContext or
+// ContextItemDataSource.WatchItemsContext with the context drop any items
+// that it doesn't allow, counting them as dropped in their source's Stats.
+func WithRateLimiter(ctx context.Context, rl *RateLimiter) context.Context {
+	if rl == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, rateLimiterKey{}, rl)
+}
+
+// ContextRateLimiter returns the RateLimiter added to ctx by WithRateLimiter,
+// if any.
+func ContextRateLimiter(ctx context.Context) *RateLimiter {
+	rl, _ := ctx.Value(rateLimiterKey{}).(*RateLimiter)
+	return rl
+}
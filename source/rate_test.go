@@ -0,0 +1,74 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package source_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/uber-go/gwr/source"
+)
+
+func TestRateLimit_Min(t *testing.T) {
+	assert.Equal(t,
+		source.RateLimit{Items: 5, Bytes: 100},
+		source.RateLimit{Items: 10, Bytes: 100}.Min(source.RateLimit{Items: 5}))
+	assert.Equal(t,
+		source.RateLimit{Items: 5, Bytes: 50},
+		source.RateLimit{Items: 5}.Min(source.RateLimit{Items: 50, Bytes: 50}))
+	assert.True(t, source.RateLimit{}.Min(source.RateLimit{}).Unlimited())
+}
+
+func TestRateLimiter(t *testing.T) {
+	var unlimited *source.RateLimiter
+	assert.Nil(t, source.NewRateLimiter(source.RateLimit{}))
+	assert.True(t, unlimited.Allow(1<<20), "nil limiter allows everything")
+
+	items := source.NewRateLimiter(source.RateLimit{Items: 3})
+	var allowed int
+	for i := 0; i < 10; i++ {
+		if items.Allow(1 << 20) {
+			allowed++
+		}
+	}
+	assert.Equal(t, 3, allowed, "a second's burst of items")
+
+	bytes := source.NewRateLimiter(source.RateLimit{Bytes: 100})
+	assert.True(t, bytes.Allow(60))
+	assert.True(t, bytes.Allow(60), "overdraft allowed while some burst is left")
+	assert.False(t, bytes.Allow(1), "overdraft paid back first")
+
+	big := source.NewRateLimiter(source.RateLimit{Bytes: 100})
+	assert.True(t, big.Allow(1000), "an item bigger than the burst still passes")
+	assert.False(t, big.Allow(1))
+}
+
+func TestWithRateLimiter(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, ctx, source.WithRateLimiter(ctx, nil))
+	assert.Nil(t, source.ContextRateLimiter(ctx))
+
+	rl := source.NewRateLimiter(source.RateLimit{Items: 1})
+	assert.Equal(t, rl, source.ContextRateLimiter(source.WithRateLimiter(ctx, rl)))
+	assert.Equal(t, source.RateLimit{Items: 1}, rl.Limit())
+}
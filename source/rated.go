@@ -0,0 +1,185 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package source
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+var ratesTextTemplate = template.Must(template.New("rates").Parse(`
+{{- define "item" -}}
+{{ .Time.Format "15:04:05" }}{{ range $key, $rate := .Rates }} {{ $key }}={{ printf "%.2f" $rate }}/s{{ end }}
+{{- end -}}
+`))
+
+// Rates is an interval of counter rates emitted by Rated, per second, keyed
+// like the counters.
+type Rates struct {
+	Time     time.Time          `json:"time"`
+	Duration time.Duration      `json:"duration"`
+	Rates    map[string]float64 `json:"rates"`
+}
+
+// Rated wraps a GetableDataSource of counters, such as "/runtime/expvar" or
+// "/meta/stats", to derive a source, named like "<name>/rate", which gets the
+// wrapped source every interval while watched, emitting how fast each of its
+// counters grew as Rates.
+//
+// Counters are the numeric fields of the gotten data, keyed by their json
+// path, e.g. "sources./foo.items"; other fields are ignored.  A counter has
+// no rate until it's been seen twice, nor for an interval over which it went
+// down, as when it's reset.
+type Rated struct {
+	src   GetableDataSource
+	every time.Duration
+
+	lock    sync.Mutex
+	watcher GenericDataWatcher
+	running bool
+	last    time.Time
+	counts  map[string]float64
+}
+
+// NewRated creates a Rated source over src, emitting rates every interval.
+func NewRated(src GetableDataSource, every time.Duration) *Rated {
+	return &Rated{
+		src:   src,
+		every: every,
+	}
+}
+
+// Name returns the wrapped source's name with "/rate" appended.
+func (rtd *Rated) Name() string {
+	return rtd.src.Name() + "/rate"
+}
+
+// Inputs returns the wrapped source's name; see DerivedSource.
+func (rtd *Rated) Inputs() []string {
+	return []string{rtd.src.Name()}
+}
+
+// TextTemplate returns a template for a one line summary of each interval.
+func (rtd *Rated) TextTemplate() *template.Template {
+	return ratesTextTemplate
+}
+
+// SetWatcher adds a watcher at source addition time.
+func (rtd *Rated) SetWatcher(watcher GenericDataWatcher) {
+	rtd.lock.Lock()
+	rtd.watcher = AddWatcher(rtd.watcher, watcher)
+	rtd.lock.Unlock()
+}
+
+// Activate takes a first sample of the counters, and starts emitting rates,
+// until there are no watchers.
+func (rtd *Rated) Activate() {
+	rtd.lock.Lock()
+	defer rtd.lock.Unlock()
+	if !rtd.running {
+		rtd.running = true
+		rtd.last = time.Now()
+		rtd.counts = Counters(rtd.src.Get())
+		go rtd.emitRates()
+	}
+}
+
+func (rtd *Rated) emitRates() {
+	ticker := time.NewTicker(rtd.every)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		rtd.lock.Lock()
+		watcher := rtd.watcher
+		if watcher == nil || !watcher.Active() {
+			rtd.running = false
+			rtd.counts = nil
+			rtd.lock.Unlock()
+			return
+		}
+		rtd.lock.Unlock()
+		counts := Counters(rtd.src.Get())
+		rtd.lock.Lock()
+		rates := rtd.rates(now, counts)
+		rtd.lock.Unlock()
+		watcher.HandleItem(rates)
+	}
+}
+
+// rates returns the rates of the counters since the last sample, which they
+// then replace; the lock must be held.
+func (rtd *Rated) rates(now time.Time, counts map[string]float64) Rates {
+	rates := Rates{
+		Time:     now,
+		Duration: now.Sub(rtd.last),
+		Rates:    make(map[string]float64, len(counts)),
+	}
+	if secs := rates.Duration.Seconds(); secs > 0 {
+		for key, count := range counts {
+			if last, ok := rtd.counts[key]; ok && count >= last {
+				rates.Rates[key] = (count - last) / secs
+			}
+		}
+	}
+	rtd.last = now
+	rtd.counts = counts
+	return rates
+}
+
+// Counters returns the numeric fields of data, as it would be marshaled to
+// json, keyed by their path of object keys joined with ".", or as "value"
+// if data is itself a number.  Arrays aren't descended into, since their
+// elements aren't keyed.
+func Counters(data interface{}) map[string]float64 {
+	counts := make(map[string]float64)
+	buf, err := json.Marshal(data)
+	if err != nil {
+		return counts
+	}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	var val interface{}
+	if err := dec.Decode(&val); err != nil {
+		return counts
+	}
+	addCounters(counts, nil, val)
+	return counts
+}
+
+func addCounters(counts map[string]float64, path []string, val interface{}) {
+	switch v := val.(type) {
+	case json.Number:
+		if f, err := v.Float64(); err == nil {
+			key := "value"
+			if len(path) > 0 {
+				key = strings.Join(path, ".")
+			}
+			counts[key] = f
+		}
+	case map[string]interface{}:
+		for key, sub := range v {
+			addCounters(counts, append(path[:len(path):len(path)], key), sub)
+		}
+	}
+}
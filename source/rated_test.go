@@ -0,0 +1,86 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package source_test
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber-go/gwr/source"
+)
+
+type counterSource struct {
+	n uint64
+}
+
+func (cs *counterSource) Name() string                         { return "/counters" }
+func (cs *counterSource) TextTemplate() *template.Template     { return nil }
+func (cs *counterSource) SetWatcher(source.GenericDataWatcher) {}
+
+func (cs *counterSource) Get() interface{} {
+	n := atomic.AddUint64(&cs.n, 10)
+	return map[string]interface{}{
+		"requests": n,
+		"name":     "counters",
+		"raw":      json.RawMessage(`{"errors": 3}`),
+		"sizes":    []int{1, 2},
+	}
+}
+
+func TestCounters(t *testing.T) {
+	assert.Equal(t, map[string]float64{
+		"requests":   10,
+		"raw.errors": 3,
+	}, source.Counters((&counterSource{}).Get()))
+	assert.Equal(t, map[string]float64{"value": 2.5}, source.Counters(2.5))
+	assert.Equal(t, map[string]float64{}, source.Counters(make(chan int)))
+}
+
+func TestRated(t *testing.T) {
+	src := &counterSource{}
+	rtd := source.NewRated(src, 10*time.Millisecond)
+	assert.Equal(t, "/counters/rate", rtd.Name())
+	assert.Equal(t, []string{"/counters"}, rtd.Inputs())
+
+	rw := &chanWatcher{active: true, items: make(chan interface{}, 10)}
+	rtd.SetWatcher(rw)
+	rtd.Activate()
+
+	rates := (<-rw.items).(source.Rates)
+	require.Len(t, rates.Rates, 2, "rates for each counter")
+	assert.InEpsilon(t, 10/rates.Duration.Seconds(), rates.Rates["requests"], 1e-9)
+	assert.Equal(t, 0.0, rates.Rates["raw.errors"], "unchanged counter")
+
+	rw.setActive(false)
+	time.Sleep(50 * time.Millisecond)
+	for len(rw.items) > 0 {
+		<-rw.items
+	}
+	n := atomic.LoadUint64(&src.n)
+	time.Sleep(30 * time.Millisecond)
+	assert.Equal(t, n, atomic.LoadUint64(&src.n), "stops getting once unwatched")
+}
@@ -0,0 +1,233 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+/*
+Package replay provides watchable sources that replay the items recorded by a
+report.FileRecorder, so that an incident may be looked at again with the same
+tools as the live source, e.g. by its text format or a field projection.
+
+Sources will be named like "/replay/...".  Each replays a recording's files,
+in the order given, such as those of a source's rotated recording:
+
+	paths, _ := filepath.Glob("/var/tmp/recordings/request_log-*.jsonl")
+	src, err := replay.Add("request_log", replay.Config{Speed: 10}, paths...)
+
+Replaying starts from the beginning whenever the source is first watched,
+pacing items by their recorded emission times, and ends after the last item.
+*/
+package replay
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/uber-go/gwr"
+	"github.com/uber-go/gwr/report"
+	"github.com/uber-go/gwr/source"
+)
+
+// maxLine bounds the size of a recorded item.
+const maxLine = 16 << 20
+
+var errStopped = errors.New("replay stopped")
+
+// Config configures a replay Source.
+type Config struct {
+	// Speed scales the pace of replay: 1, the default, replays items with the
+	// same gaps between them as when recorded, while 10 replays them ten
+	// times faster.
+	Speed float64
+
+	// TextTemplate, if set, renders the source's text format, e.g. the
+	// recorded source's own template; otherwise each item is printed as is.
+	TextTemplate *template.Template
+
+	// Errorf, if non-nil, is called with any error reading a recording; its
+	// replay then ends.
+	Errorf func(format string, args ...interface{})
+}
+
+// Source is a watchable source replaying recorded items.
+type Source struct {
+	name  string
+	cfg   Config
+	paths []string
+
+	lock    sync.Mutex
+	watcher source.GenericDataWatcher
+	stop    chan struct{}
+}
+
+// New creates a Source, named "/replay/name", replaying the given recording
+// files; it returns an error if any of them can't be read.
+func New(name string, cfg Config, paths ...string) (*Source, error) {
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		file.Close()
+	}
+	if cfg.Speed <= 0 {
+		cfg.Speed = 1
+	}
+	return &Source{
+		name:  fmt.Sprintf("/replay/%s", strings.TrimPrefix(name, "/")),
+		cfg:   cfg,
+		paths: paths,
+	}, nil
+}
+
+// Add creates a Source and adds it to the default gwr sources.
+func Add(name string, cfg Config, paths ...string) (*Source, error) {
+	src, err := New(name, cfg, paths...)
+	if err != nil {
+		return nil, err
+	}
+	if err := gwr.AddGenericDataSource(src); err != nil {
+		return nil, err
+	}
+	return src, nil
+}
+
+// Name returns the full name of the source.
+func (src *Source) Name() string {
+	return src.name
+}
+
+// TextTemplate returns the configured text/template, if any.
+func (src *Source) TextTemplate() *template.Template {
+	return src.cfg.TextTemplate
+}
+
+// SetWatcher adds a watcher at source addition time.
+func (src *Source) SetWatcher(watcher source.GenericDataWatcher) {
+	src.lock.Lock()
+	src.watcher = source.AddWatcher(src.watcher, watcher)
+	src.lock.Unlock()
+}
+
+// Activate starts replaying from the beginning, unless a replay is already
+// underway, in which case new watchers join it.
+func (src *Source) Activate() {
+	src.lock.Lock()
+	defer src.lock.Unlock()
+	if src.stop == nil {
+		src.stop = make(chan struct{})
+		go src.run(src.stop)
+	}
+}
+
+// Deactivate stops replaying once the source has no more watchers.
+func (src *Source) Deactivate() {
+	src.lock.Lock()
+	defer src.lock.Unlock()
+	if src.stop != nil && (src.watcher == nil || !src.watcher.Active()) {
+		close(src.stop)
+		src.stop = nil
+	}
+}
+
+func (src *Source) run(stop chan struct{}) {
+	defer func() {
+		src.lock.Lock()
+		if src.stop == stop {
+			src.stop = nil
+		}
+		src.lock.Unlock()
+	}()
+
+	// start and first map the replay's wall clock to the recording's
+	var start, first time.Time
+	for _, path := range src.paths {
+		err := src.replayFile(path, func(t time.Time) bool {
+			if first.IsZero() {
+				start, first = time.Now(), t
+				return true
+			}
+			wait := time.Duration(float64(t.Sub(first))/src.cfg.Speed) - time.Since(start)
+			if wait <= 0 {
+				return true
+			}
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+			select {
+			case <-timer.C:
+				return true
+			case <-stop:
+				return false
+			}
+		})
+		if err == errStopped {
+			return
+		}
+		if err != nil {
+			if src.cfg.Errorf != nil {
+				src.cfg.Errorf("%s replay failed: %v", src.name, err)
+			}
+			return
+		}
+	}
+}
+
+// replayFile emits each item of a recording file, once pace says it's time;
+// pace returns false if the replay is stopped while waiting.
+func (src *Source) replayFile(path string, pace func(time.Time) bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, maxLine)
+	for scanner.Scan() {
+		var rec report.RecordedItem
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		var item interface{}
+		dec := json.NewDecoder(bytes.NewReader(rec.Item))
+		dec.UseNumber()
+		if err := dec.Decode(&item); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if !pace(rec.Time) {
+			return errStopped
+		}
+
+		src.lock.Lock()
+		watcher := src.watcher
+		src.lock.Unlock()
+		if watcher == nil || !watcher.Active() {
+			return errStopped
+		}
+		watcher.HandleItem(item)
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,121 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package replay_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber-go/gwr/internal/marshaled"
+	"github.com/uber-go/gwr/report"
+	"github.com/uber-go/gwr/source/replay"
+)
+
+func writeRecording(t *testing.T, path string, start time.Time, gaps []time.Duration) {
+	var buf []byte
+	at := start
+	for i, gap := range gaps {
+		at = at.Add(gap)
+		item, err := json.Marshal(map[string]interface{}{"n": i})
+		require.NoError(t, err)
+		line, err := json.Marshal(report.RecordedItem{Time: at, Item: item})
+		require.NoError(t, err)
+		buf = append(append(buf, line...), '\n')
+	}
+	require.NoError(t, ioutil.WriteFile(path, buf, 0644))
+}
+
+type chanWriter chan []byte
+
+func (cw chanWriter) Write(p []byte) (int, error) {
+	cw <- append([]byte(nil), p...)
+	return len(p), nil
+}
+
+// readLines reads n lines written to cw, or fewer if none come for a while.
+func readLines(cw chanWriter, n int) []string {
+	var buf []byte
+	for bytes.Count(buf, []byte("\n")) < n {
+		select {
+		case p := <-cw:
+			buf = append(buf, p...)
+		case <-time.After(time.Second):
+			return strings.Split(strings.TrimSpace(string(buf)), "\n")
+		}
+	}
+	return strings.Split(strings.TrimSpace(string(buf)), "\n")
+}
+
+func TestSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gwr-replay")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	start := time.Now().Add(-time.Hour)
+	paths := []string{filepath.Join(dir, "a.jsonl"), filepath.Join(dir, "b.jsonl")}
+	writeRecording(t, paths[0], start, []time.Duration{0, time.Second})
+	writeRecording(t, paths[1], start.Add(time.Second), []time.Duration{time.Second})
+
+	_, err = replay.New("missing", replay.Config{}, filepath.Join(dir, "nope.jsonl"))
+	assert.Error(t, err)
+
+	src, err := replay.New("test", replay.Config{Speed: 100}, paths...)
+	require.NoError(t, err)
+	assert.Equal(t, "/replay/test", src.Name())
+
+	mds := marshaled.NewDataSource(src, nil)
+	defer mds.Drain()
+	cw := make(chanWriter, 10)
+	begin := time.Now()
+	require.NoError(t, mds.Watch("json", cw))
+	lines := readLines(cw, 3)
+	elapsed := time.Since(begin)
+	assert.Equal(t, []string{`{"n":0}`, `{"n":1}`, `{"n":0}`}, lines, "both files replayed in order")
+	assert.True(t, elapsed >= 20*time.Millisecond, "paced at 100x: %v", elapsed)
+}
+
+func TestSource_Deactivate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gwr-replay")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "slow.jsonl")
+	writeRecording(t, path, time.Now(), []time.Duration{0, time.Hour})
+	src, err := replay.New("slow", replay.Config{}, path)
+	require.NoError(t, err)
+
+	mds := marshaled.NewDataSource(src, nil)
+	for i := 0; i < 2; i++ {
+		cw := make(chanWriter, 10)
+		require.NoError(t, mds.Watch("json", cw))
+		assert.Equal(t, []string{`{"n":0}`}, readLines(cw, 1), "replayed from the start by watch %d", i)
+		mds.Drain()
+	}
+}
@@ -0,0 +1,366 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+/*
+Package runtimetap provides sources sampling the Go runtime's statistics and
+the process's published expvars, so that they may be gotten, or watched as
+they change, alongside the process's other sources.
+
+Sources will be named like "/runtime/...".  Getting a source takes one
+sample; watching it takes one every interval until it has no more watchers,
+e.g.:
+
+	runtimetap.AddStats(time.Second)
+	runtimetap.AddExpvar(10 * time.Second)
+
+A watched expvar source may instead emit only the vars that changed since its
+last sample, or how much each numeric var changed; see Mode.
+*/
+package runtimetap
+
+import (
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/uber-go/gwr"
+	"github.com/uber-go/gwr/source"
+)
+
+// DefaultInterval is how often a watched source samples when no interval is
+// given.
+const DefaultInterval = time.Second
+
+var (
+	statsTextTemplate = template.Must(template.New("runtime_stats_text").Parse(strings.TrimSpace(`
+{{ define "item" }}goroutines={{ .Goroutines }} heap={{ .HeapAlloc }} objects={{ .HeapObjects }} sys={{ .Sys }} gc={{ .NumGC }} pause={{ printf "%.2f" .PauseTotal }}ms{{ end }}
+{{ define "get" }}{{ template "item" . }}
+{{ end }}
+`)))
+	expvarTextTemplate = template.Must(template.New("runtime_expvar_text").Parse(strings.TrimSpace(`
+{{ define "item" }}{{ range $name, $val := . }}{{ $name }}: {{ printf "%s" $val }}
+{{ end }}{{ end }}
+{{ define "get" }}{{ template "item" . }}{{ end }}
+`)))
+)
+
+// Stats is a sample of the Go runtime's statistics.
+type Stats struct {
+	Goroutines  int     `json:"goroutines"`
+	CgoCalls    int64   `json:"cgo_calls"`
+	HeapAlloc   uint64  `json:"heap_alloc"`
+	HeapObjects uint64  `json:"heap_objects"`
+	Sys         uint64  `json:"sys"`
+	NumGC       uint32  `json:"num_gc"`
+	PauseTotal  float64 `json:"gc_pause_total_ms"`
+}
+
+// ReadStats samples the Go runtime's statistics.
+func ReadStats() Stats {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return Stats{
+		Goroutines:  runtime.NumGoroutine(),
+		CgoCalls:    runtime.NumCgoCall(),
+		HeapAlloc:   ms.HeapAlloc,
+		HeapObjects: ms.HeapObjects,
+		Sys:         ms.Sys,
+		NumGC:       ms.NumGC,
+		PauseTotal:  float64(ms.PauseTotalNs) / float64(time.Millisecond),
+	}
+}
+
+// ReadExpvar samples every published expvar, by name.
+func ReadExpvar() map[string]json.RawMessage {
+	vars := make(map[string]json.RawMessage)
+	expvar.Do(func(kv expvar.KeyValue) {
+		vars[kv.Key] = json.RawMessage(kv.Value.String())
+	})
+	return vars
+}
+
+// Mode selects what a watched expvar Source emits each interval.
+type Mode int
+
+const (
+	// EmitAll emits every sample whole.
+	EmitAll Mode = iota
+
+	// EmitChanged emits just the vars that changed since the last sample,
+	// compared by their json, and nothing if none did; the first sample of a
+	// watch is emitted whole.
+	EmitChanged
+
+	// EmitDelta emits the difference of each numeric var since the last
+	// sample, leaving out any others; the first sample of a watch only sets
+	// the baseline, so nothing is emitted until the second.
+	EmitDelta
+)
+
+// String returns the name of the mode, as shown in its source's name and
+// attributes.
+func (m Mode) String() string {
+	switch m {
+	case EmitAll:
+		return "all"
+	case EmitChanged:
+		return "changed"
+	case EmitDelta:
+		return "delta"
+	default:
+		return fmt.Sprintf("Mode(%d)", int(m))
+	}
+}
+
+// filter returns a function from each sample of a watch to what's emitted for
+// it, or nil to emit nothing; it keeps the state of that one watch.
+func (m Mode) filter() func(interface{}) interface{} {
+	var last map[string]json.RawMessage
+	switch m {
+	case EmitChanged:
+		return func(sample interface{}) interface{} {
+			vars, ok := sample.(map[string]json.RawMessage)
+			if !ok {
+				return sample
+			}
+			prev := last
+			last = vars
+			if prev == nil {
+				return vars
+			}
+			changed := make(map[string]json.RawMessage)
+			for name, val := range vars {
+				if !bytes.Equal(val, prev[name]) {
+					changed[name] = val
+				}
+			}
+			if len(changed) == 0 {
+				return nil
+			}
+			return changed
+		}
+	case EmitDelta:
+		return func(sample interface{}) interface{} {
+			vars, ok := sample.(map[string]json.RawMessage)
+			if !ok {
+				return sample
+			}
+			prev := last
+			last = vars
+			if prev == nil {
+				return nil
+			}
+			deltas := make(map[string]json.RawMessage)
+			for name, val := range vars {
+				if delta, ok := numericDelta(prev[name], val); ok {
+					deltas[name] = delta
+				}
+			}
+			if len(deltas) == 0 {
+				return nil
+			}
+			return deltas
+		}
+	default:
+		return func(sample interface{}) interface{} { return sample }
+	}
+}
+
+// numericDelta returns cur less prev, if both are numbers, as an integer if
+// both are.
+func numericDelta(prev, cur json.RawMessage) (json.RawMessage, bool) {
+	if prev == nil {
+		return nil, false
+	}
+	if p, err := strconv.ParseInt(string(prev), 10, 64); err == nil {
+		if c, err := strconv.ParseInt(string(cur), 10, 64); err == nil {
+			return json.RawMessage(strconv.FormatInt(c-p, 10)), true
+		}
+	}
+	p, err := strconv.ParseFloat(string(prev), 64)
+	if err != nil {
+		return nil, false
+	}
+	c, err := strconv.ParseFloat(string(cur), 64)
+	if err != nil {
+		return nil, false
+	}
+	return json.RawMessage(strconv.FormatFloat(c-p, 'g', -1, 64)), true
+}
+
+// Source is a watchable source of samples.
+type Source struct {
+	name     string
+	interval time.Duration
+	tmpl     *template.Template
+	sample   func() interface{}
+	mode     Mode
+
+	lock    sync.Mutex
+	watcher source.GenericDataWatcher
+	stop    chan struct{}
+}
+
+// NewStats creates a "/runtime/stats" Source of ReadStats samples, taken
+// every interval, or DefaultInterval if it's zero, while watched.
+func NewStats(interval time.Duration) *Source {
+	return newSource("/runtime/stats", interval, statsTextTemplate, func() interface{} {
+		return ReadStats()
+	})
+}
+
+// AddStats creates a stats Source and adds it to the default gwr sources.
+func AddStats(interval time.Duration) *Source {
+	rs := NewStats(interval)
+	gwr.AddGenericDataSource(rs)
+	return rs
+}
+
+// NewExpvar creates a "/runtime/expvar" Source of ReadExpvar samples, taken
+// every interval, or DefaultInterval if it's zero, while watched.
+func NewExpvar(interval time.Duration) *Source {
+	return newSource("/runtime/expvar", interval, expvarTextTemplate, func() interface{} {
+		return ReadExpvar()
+	})
+}
+
+// AddExpvar creates an expvar Source and adds it to the default gwr sources.
+func AddExpvar(interval time.Duration) *Source {
+	rs := NewExpvar(interval)
+	gwr.AddGenericDataSource(rs)
+	return rs
+}
+
+// NewExpvarMode is like NewExpvar, except that a watch emits samples in the
+// given mode; unless that's EmitAll, the source is named for it, like
+// "/runtime/expvar/delta".  A get still takes one whole sample.
+func NewExpvarMode(interval time.Duration, mode Mode) *Source {
+	rs := NewExpvar(interval)
+	if mode != EmitAll {
+		rs.name = fmt.Sprintf("%s/%s", rs.name, mode)
+		rs.mode = mode
+	}
+	return rs
+}
+
+// AddExpvarMode creates an expvar Source emitting in the given mode, and adds
+// it to the default gwr sources.
+func AddExpvarMode(interval time.Duration, mode Mode) *Source {
+	rs := NewExpvarMode(interval, mode)
+	gwr.AddGenericDataSource(rs)
+	return rs
+}
+
+func newSource(name string, interval time.Duration, tmpl *template.Template, sample func() interface{}) *Source {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return &Source{
+		name:     name,
+		interval: interval,
+		tmpl:     tmpl,
+		sample:   sample,
+	}
+}
+
+// Name returns the full name of the source.
+func (rs *Source) Name() string {
+	return rs.name
+}
+
+// TextTemplate returns a text/template for the source's samples.
+func (rs *Source) TextTemplate() *template.Template {
+	return rs.tmpl
+}
+
+// Attrs returns the source's mode, unless it's EmitAll.
+func (rs *Source) Attrs() map[string]interface{} {
+	if rs.mode == EmitAll {
+		return nil
+	}
+	return map[string]interface{}{"mode": rs.mode.String()}
+}
+
+// Get takes a sample.
+func (rs *Source) Get() interface{} {
+	return rs.sample()
+}
+
+// SetWatcher adds a watcher at source addition time.
+func (rs *Source) SetWatcher(watcher source.GenericDataWatcher) {
+	rs.lock.Lock()
+	rs.watcher = source.AddWatcher(rs.watcher, watcher)
+	rs.lock.Unlock()
+}
+
+// Activate starts sampling, until the source has no more watchers.
+func (rs *Source) Activate() {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	if rs.stop == nil {
+		rs.stop = make(chan struct{})
+		go rs.run(rs.stop)
+	}
+}
+
+// Deactivate stops sampling right away, rather than at the next tick, once
+// the source has no more watchers.
+func (rs *Source) Deactivate() {
+	rs.lock.Lock()
+	defer rs.lock.Unlock()
+	if rs.stop != nil && (rs.watcher == nil || !rs.watcher.Active()) {
+		close(rs.stop)
+		rs.stop = nil
+	}
+}
+
+func (rs *Source) run(stop chan struct{}) {
+	ticker := time.NewTicker(rs.interval)
+	defer ticker.Stop()
+	filter := rs.mode.filter()
+	for {
+		rs.lock.Lock()
+		watcher := rs.watcher
+		if watcher == nil || !watcher.Active() {
+			if rs.stop == stop {
+				rs.stop = nil
+			}
+			rs.lock.Unlock()
+			return
+		}
+		rs.lock.Unlock()
+
+		if item := filter(rs.sample()); item != nil {
+			watcher.HandleItem(item)
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package runtimetap_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"expvar"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber-go/gwr/internal/marshaled"
+	"github.com/uber-go/gwr/source/runtimetap"
+)
+
+func TestStats(t *testing.T) {
+	rs := runtimetap.NewStats(0)
+	assert.Equal(t, "/runtime/stats", rs.Name())
+	stats := rs.Get().(runtimetap.Stats)
+	assert.True(t, stats.Goroutines > 0)
+	assert.True(t, stats.HeapAlloc > 0)
+
+	var buf bytes.Buffer
+	require.NoError(t, marshaled.NewDataSource(rs, nil).Get("text", &buf))
+	assert.True(t, strings.HasPrefix(buf.String(), "goroutines="), "got %q", buf.String())
+}
+
+func TestExpvar(t *testing.T) {
+	expvar.NewInt("runtimetap_test").Set(42)
+	rs := runtimetap.NewExpvar(0)
+	assert.Equal(t, "/runtime/expvar", rs.Name())
+
+	var buf bytes.Buffer
+	require.NoError(t, marshaled.NewDataSource(rs, nil).Get("json", &buf))
+	var vars map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &vars))
+	assert.Equal(t, 42.0, vars["runtimetap_test"])
+	assert.Contains(t, vars, "memstats")
+
+	buf.Reset()
+	require.NoError(t, marshaled.NewDataSource(rs, nil).Get("text", &buf))
+	assert.Contains(t, buf.String(), "runtimetap_test: 42\n")
+}
+
+func TestSource_Watch(t *testing.T) {
+	mds := marshaled.NewDataSource(runtimetap.NewStats(time.Millisecond), nil)
+
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	require.NoError(t, mds.Watch("json", pw))
+	sc := bufio.NewScanner(pr)
+	for i := 0; i < 3; i++ {
+		require.True(t, sc.Scan())
+		var stats runtimetap.Stats
+		require.NoError(t, json.Unmarshal(sc.Bytes(), &stats))
+		assert.True(t, stats.Goroutines > 0)
+	}
+}
+
+type chanWriter chan []byte
+
+func (cw chanWriter) Write(p []byte) (int, error) {
+	cw <- append([]byte(nil), p...)
+	return len(p), nil
+}
+
+func TestSource_Deactivate(t *testing.T) {
+	mds := marshaled.NewDataSource(runtimetap.NewStats(time.Hour), nil)
+	for i := 0; i < 2; i++ {
+		cw := make(chanWriter, 10)
+		require.NoError(t, mds.Watch("json", cw))
+		select {
+		case <-cw:
+		case <-time.After(time.Second):
+			require.Fail(t, "no sample", "watch %d", i)
+		}
+		mds.Drain()
+	}
+}
+
+func TestExpvarMode(t *testing.T) {
+	rs := runtimetap.NewExpvarMode(0, runtimetap.EmitDelta)
+	assert.Equal(t, "/runtime/expvar/delta", rs.Name())
+	assert.Equal(t, map[string]interface{}{"mode": "delta"}, marshaled.NewDataSource(rs, nil).Attrs())
+	assert.Equal(t, "/runtime/expvar", runtimetap.NewExpvarMode(0, runtimetap.EmitAll).Name())
+
+	vars := func(kvs ...string) map[string]json.RawMessage {
+		vars := make(map[string]json.RawMessage, len(kvs)/2)
+		for i := 0; i < len(kvs); i += 2 {
+			vars[kvs[i]] = json.RawMessage(kvs[i+1])
+		}
+		return vars
+	}
+
+	changed := runtimetap.ModeFilter(runtimetap.EmitChanged)
+	assert.Equal(t, vars("a", "1", "b", `"x"`), changed(vars("a", "1", "b", `"x"`)), "first sample whole")
+	assert.Equal(t, vars("b", `"y"`), changed(vars("a", "1", "b", `"y"`)), "only changed vars")
+	assert.Nil(t, changed(vars("a", "1", "b", `"y"`)), "nothing changed")
+
+	delta := runtimetap.ModeFilter(runtimetap.EmitDelta)
+	assert.Nil(t, delta(vars("a", "1", "b", `"x"`, "c", "1.5")), "baseline")
+	assert.Equal(t, vars("a", "3", "c", "0.5"), delta(vars("a", "4", "b", `"y"`, "c", "2", "d", "7")), "numeric deltas")
+}
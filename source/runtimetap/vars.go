@@ -0,0 +1,128 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package runtimetap
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/uber-go/gwr"
+	"github.com/uber-go/gwr/source"
+)
+
+// VarPrefix is the prefix under which AddAllPollers names the source of each
+// expvar, and AddAllGetters does given no prefix.
+const VarPrefix = "/runtime/expvar"
+
+var varTextTemplate = template.Must(template.New("runtime_var_text").Parse(strings.TrimSpace(`
+{{ define "item" }}{{ printf "%s" . }}{{ end }}
+{{ define "get" }}{{ template "item" . }}
+{{ end }}
+`)))
+
+// varGetter is a getable source of a single expvar.
+type varGetter struct {
+	name string
+	v    expvar.Var
+}
+
+func (vg *varGetter) Name() string                     { return vg.name }
+func (vg *varGetter) TextTemplate() *template.Template { return varTextTemplate }
+
+// Get returns the var's json.
+func (vg *varGetter) Get() interface{} {
+	return json.RawMessage(vg.v.String())
+}
+
+// AddAllGetters adds a getable source of every published expvar, including
+// memstats and cmdline, to the default gwr sources, named like prefix/key, or
+// VarPrefix/key if prefix is empty.  Vars published later are added as
+// they're found, looking every DefaultInterval, until the returned function is
+// called.  Any var whose name is already taken is skipped.
+func AddAllGetters(prefix string) (stop func()) {
+	if prefix == "" {
+		prefix = VarPrefix
+	}
+	return addAll(DefaultInterval, func(key string, v expvar.Var) source.GenericDataSource {
+		return &varGetter{name: fmt.Sprintf("%s/%s", prefix, key), v: v}
+	})
+}
+
+// AddAllPollers is like AddAllGetters, except that every source is named
+// under VarPrefix, and may be watched too, sampling its var every interval,
+// or DefaultInterval if it's zero; vars published later are looked for every
+// interval as well.
+func AddAllPollers(interval time.Duration) (stop func()) {
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+	return addAll(interval, func(key string, v expvar.Var) source.GenericDataSource {
+		return newSource(fmt.Sprintf("%s/%s", VarPrefix, key), interval, varTextTemplate, func() interface{} {
+			return json.RawMessage(v.String())
+		})
+	})
+}
+
+// addAll adds the source made by newSource for each published expvar, and
+// then looks for new ones every interval, until stopped.
+func addAll(every time.Duration, newSource func(string, expvar.Var) source.GenericDataSource) func() {
+	added := make(map[string]bool)
+	scan := func() {
+		var keys []string
+		expvar.Do(func(kv expvar.KeyValue) {
+			if !added[kv.Key] {
+				keys = append(keys, kv.Key)
+			}
+		})
+		sort.Strings(keys)
+		for _, key := range keys {
+			added[key] = true
+			if v := expvar.Get(key); v != nil {
+				gwr.AddGenericDataSource(newSource(key, v))
+			}
+		}
+	}
+	scan()
+
+	stop := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				scan()
+			case <-stop:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(stop) })
+	}
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// +build !gwr_noop
+
+package runtimetap_test
+
+import (
+	"bufio"
+	"bytes"
+	"expvar"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber-go/gwr"
+	"github.com/uber-go/gwr/source/runtimetap"
+)
+
+func TestAddAllGetters(t *testing.T) {
+	expvar.NewInt("runtimetap_getter").Set(7)
+	stop := runtimetap.AddAllGetters("/test/expvar")
+	defer stop()
+	for _, ds := range gwr.DefaultDataSources.Match("/test/expvar/*") {
+		defer gwr.DefaultDataSources.Remove(ds.Name())
+	}
+
+	for name, want := range map[string]string{
+		"/test/expvar/runtimetap_getter": "7",
+		"/test/expvar/memstats":          "{",
+		"/test/expvar/cmdline":           "[",
+	} {
+		ds := gwr.DefaultDataSources.Get(name)
+		require.NotNil(t, ds, "%s added", name)
+		var buf bytes.Buffer
+		require.NoError(t, ds.Get("json", &buf))
+		assert.Equal(t, want, buf.String()[:len(want)], "%s value", name)
+	}
+}
+
+func TestAddAllPollers(t *testing.T) {
+	stop := runtimetap.AddAllPollers(10 * time.Millisecond)
+	defer stop()
+	late := expvar.NewInt("runtimetap_poller")
+	late.Set(1)
+	defer gwr.DefaultDataSources.Remove("/runtime/expvar/runtimetap_poller")
+	defer gwr.DefaultDataSources.Remove("/runtime/expvar/memstats")
+	defer gwr.DefaultDataSources.Remove("/runtime/expvar/cmdline")
+
+	var ds interface{ Watch(string, io.Writer) error }
+	for i := 0; i < 100 && ds == nil; i++ {
+		if found := gwr.DefaultDataSources.Get("/runtime/expvar/runtimetap_poller"); found != nil {
+			ds = found
+		} else {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	require.NotNil(t, ds, "var published later found")
+
+	pr, pw := io.Pipe()
+	defer pr.Close()
+	require.NoError(t, ds.Watch("text", pw))
+	sc := bufio.NewScanner(pr)
+	require.True(t, sc.Scan())
+	assert.Equal(t, "1", sc.Text())
+}
@@ -0,0 +1,148 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package script
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/uber-go/gwr/source"
+)
+
+// DryRunName is the name of the script dry-run data source.
+const DryRunName = "/meta/scripts/dry-run"
+
+var dryRunTextTemplate = template.Must(template.New("meta_scripts_dry_run_text").Parse(strings.TrimSpace(`
+{{ define "get" }}{{ if .Error }}error: {{ .Error }}
+{{ else }}{{ range .Output }}{{ . }}
+{{ end }}{{ end }}{{ end }}
+`)))
+
+// DryRun is the result of trying a script against a single item.  Error is
+// set instead of Output if the script fails to load, or to process the item.
+type DryRun struct {
+	Input  string          `json:"input"`
+	Item   json.RawMessage `json:"item,omitempty"`
+	Output []interface{}   `json:"output"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// DryRunSource is a data source that lets clients try out a script before
+// defining it, against a sample item of a source, or one that they provide.
+// It is used to implement the "/meta/scripts/dry-run" data source.
+//
+// Getting it with a "code" parameter loads the script, and calls its process
+// function with the "input" source name and either the "item" parameter, as
+// json, or the input's sample item; nothing is added, watched, or emitted.
+// Since sample items are those of the input, its get access should be
+// restricted like that of the input.
+type DryRunSource struct {
+	dss *source.DataSources
+	lim Limits
+}
+
+// NewDryRunSource creates a DryRunSource trying scripts with the given limits
+// against the sample items of sources in dss.
+func NewDryRunSource(dss *source.DataSources, lim Limits) *DryRunSource {
+	return &DryRunSource{dss: dss, lim: lim}
+}
+
+// Name returns the static "/meta/scripts/dry-run" string.
+func (drs *DryRunSource) Name() string {
+	return DryRunName
+}
+
+// TextTemplate returns a text/template that prints each output item on a
+// line, or the error.
+func (drs *DryRunSource) TextTemplate() *template.Template {
+	return dryRunTextTemplate
+}
+
+// Get returns nil, since there's nothing to try without a script; see
+// GetParams.
+func (drs *DryRunSource) Get() interface{} {
+	return (*DryRun)(nil)
+}
+
+// EmptyGet serves a Get without a script as "no content".
+func (drs *DryRunSource) EmptyGet() source.EmptyGetPolicy {
+	return source.EmptyGetNoContent
+}
+
+// GetParams returns the DryRun of the "code" parameter; ErrInvalidParam is
+// returned if there's no code, or no input named.
+func (drs *DryRunSource) GetParams(params map[string]string) (interface{}, error) {
+	code, input := params["code"], params["input"]
+	if code == "" || input == "" {
+		return nil, source.ErrInvalidParam
+	}
+	dr := &DryRun{Input: input, Output: []interface{}{}}
+
+	item, err := drs.item(input, params["item"])
+	if err != nil {
+		dr.Error = err.Error()
+		return dr, nil
+	}
+	dr.Item = item
+
+	ss, err := New(drs.dss, "dry-run", code, nil, drs.lim)
+	if err == nil {
+		var out []interface{}
+		if out, err = ss.call(input, item); err == nil && out != nil {
+			dr.Output = out
+		}
+	}
+	if err != nil {
+		dr.Error = err.Error()
+	}
+	return dr, nil
+}
+
+// item returns the given json item, after checking that it's valid, or else
+// the input's sample item.
+func (drs *DryRunSource) item(input, given string) (json.RawMessage, error) {
+	if given != "" {
+		if !json.Valid([]byte(given)) {
+			return nil, errors.New("item isn't valid json")
+		}
+		return json.RawMessage(given), nil
+	}
+	if drs.dss.AggregateOnly(input) {
+		return nil, fmt.Errorf("%s: %v", input, source.ErrAggregateOnly)
+	}
+	sds, ok := drs.dss.Get(input).(source.SamplingDataSource)
+	if !ok {
+		return nil, fmt.Errorf("%s: %v", input, source.ErrNoSample)
+	}
+	samples, err := sds.SampleFormats()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", input, err)
+	}
+	sample, ok := samples["json"]
+	if !ok {
+		return nil, fmt.Errorf("%s: %v", input, source.ErrNoSample)
+	}
+	return json.RawMessage(bytes.TrimSpace(sample)), nil
+}
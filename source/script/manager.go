@@ -0,0 +1,197 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package script
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/uber-go/gwr"
+	"github.com/uber-go/gwr/internal/marshaled"
+	"github.com/uber-go/gwr/source"
+)
+
+// ManagerName is the name of the script management data source.
+const ManagerName = "/meta/scripts"
+
+var managerTextTemplate = template.Must(template.New("meta_scripts_text").Parse(strings.TrimSpace(`
+{{ define "get" }}{{ range . }}{{ .Name }} <- {{ range $i, $in := .Inputs }}{{ if $i }}, {{ end }}{{ $in }}{{ end }}: calls={{ .Stats.Calls }} errors={{ .Stats.Errors }}{{ if .Stats.LastError }} last_error={{ .Stats.LastError }}{{ end }}
+{{ end }}{{ end }}
+`)))
+
+// Info describes a script defined through a Manager.
+type Info struct {
+	Name   string   `json:"name"`
+	Inputs []string `json:"inputs"`
+	Code   string   `json:"code"`
+	Stats  Stats    `json:"stats"`
+}
+
+// Manager is a data source that lets clients define script sources.  It is
+// used to implement the "/meta/scripts" data source; getting it lists the
+// scripts defined.
+//
+// It implements two actions: "define", with "name", "inputs", a comma
+// separated list of source names, and "code" parameters, loads a script and
+// adds its source, replacing any of the same name; "remove", with a "name",
+// removes one.  Since scripts see every item of their inputs, defining them
+// should be restricted, e.g. by a Config.Authorize that refuses the "action"
+// verb on "/meta/scripts" to most clients.  Scripts are only kept across
+// restarts by a Manager that persists them; see Persist.
+type Manager struct {
+	dss *source.DataSources
+	lim Limits
+
+	lock      sync.Mutex
+	scripts   map[string]*Source
+	statePath string
+}
+
+// NewManager creates a Manager adding script sources to dss, with the given
+// limits.
+func NewManager(dss *source.DataSources, lim Limits) *Manager {
+	return &Manager{
+		dss:     dss,
+		lim:     lim,
+		scripts: make(map[string]*Source),
+	}
+}
+
+// AddManager creates a Manager, with DefaultLimits, and adds it to the
+// default gwr sources, along with a DryRunSource for trying scripts out.
+func AddManager() *Manager {
+	mgr := NewManager(gwr.DefaultDataSources, DefaultLimits)
+	gwr.AddGenericDataSource(mgr)
+	gwr.AddGenericDataSource(NewDryRunSource(gwr.DefaultDataSources, DefaultLimits))
+	return mgr
+}
+
+// Name returns the static "/meta/scripts" string.
+func (mgr *Manager) Name() string {
+	return ManagerName
+}
+
+// TextTemplate returns a text/template to implement the GenericDataSource with
+// a "text" format option.
+func (mgr *Manager) TextTemplate() *template.Template {
+	return managerTextTemplate
+}
+
+// Get returns an Info for every script defined, sorted by name.
+func (mgr *Manager) Get() interface{} {
+	mgr.lock.Lock()
+	infos := make([]Info, 0, len(mgr.scripts))
+	for _, ss := range mgr.scripts {
+		infos = append(infos, Info{
+			Name:   ss.Name(),
+			Inputs: ss.Inputs(),
+			Code:   ss.Code(),
+			Stats:  ss.Stats(),
+		})
+	}
+	mgr.lock.Unlock()
+	sort.Sort(infosByName(infos))
+	return infos
+}
+
+// Action implements the "define" and "remove" actions.
+func (mgr *Manager) Action(name string, params map[string]string) error {
+	switch name {
+	case "define":
+		var inputs []string
+		for _, input := range strings.Split(params["inputs"], ",") {
+			if input = strings.TrimSpace(input); input != "" {
+				inputs = append(inputs, input)
+			}
+		}
+		if params["name"] == "" || len(inputs) == 0 {
+			return source.ErrInvalidParam
+		}
+		return mgr.Define(params["name"], params["code"], inputs)
+	case "remove":
+		if !mgr.Remove(params["name"]) {
+			return source.ErrInvalidParam
+		}
+		return nil
+	default:
+		return source.ErrUnknownAction
+	}
+}
+
+// Define loads a script and adds its source, replacing any defined with the
+// same name; see New.  If the Manager persists its scripts, an error writing
+// the state file is returned after the script is defined.
+func (mgr *Manager) Define(name, code string, inputs []string) error {
+	mgr.lock.Lock()
+	defer mgr.lock.Unlock()
+	if err := mgr.define(name, code, inputs); err != nil {
+		return err
+	}
+	return mgr.save()
+}
+
+func (mgr *Manager) define(name, code string, inputs []string) error {
+	ss, err := New(mgr.dss, name, code, inputs, mgr.lim)
+	if err != nil {
+		return err
+	}
+	mgr.remove(name)
+	if err := mgr.dss.Add(marshaled.NewDataSource(ss, nil)); err != nil {
+		return err
+	}
+	mgr.scripts[name] = ss
+	return nil
+}
+
+// Remove removes a script's source, returning false if no script was
+// defined with the name.  Any error writing the state file of a persisting
+// Manager is logged, since the script is removed regardless.
+func (mgr *Manager) Remove(name string) bool {
+	mgr.lock.Lock()
+	defer mgr.lock.Unlock()
+	if !mgr.remove(name) {
+		return false
+	}
+	if err := mgr.save(); err != nil {
+		log.Printf("script state save error %v", err)
+	}
+	return true
+}
+
+func (mgr *Manager) remove(name string) bool {
+	ss, ok := mgr.scripts[name]
+	if !ok {
+		return false
+	}
+	delete(mgr.scripts, name)
+	mgr.dss.Remove(ss.Name())
+	ss.Stop()
+	return true
+}
+
+type infosByName []Info
+
+func (is infosByName) Len() int           { return len(is) }
+func (is infosByName) Less(i, j int) bool { return is[i].Name < is[j].Name }
+func (is infosByName) Swap(i, j int)      { is[i], is[j] = is[j], is[i] }
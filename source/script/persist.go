@@ -0,0 +1,139 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package script
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// Descriptor describes a script defined through a Manager, enough to define
+// it again.
+type Descriptor struct {
+	Name   string   `json:"name"`
+	Inputs []string `json:"inputs"`
+	Code   string   `json:"code"`
+}
+
+// State is what a Manager persists to its state file; see Manager.Persist.
+type State struct {
+	Scripts []Descriptor `json:"scripts"`
+}
+
+// LoadState reads a State from a json file, as written by a persisting
+// Manager.
+func LoadState(path string) (*State, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var state State
+	if err := json.Unmarshal(buf, &state); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return &state, nil
+}
+
+// Persist makes the Manager keep its scripts in a json state file at path,
+// so that they survive restarts: any scripts in an existing file are defined
+// again, and the file is rewritten whenever a script is defined or removed.
+//
+// Scripts that fail to load are left out, and the first such error is
+// returned; the others are still defined, and the manager persists from then
+// on either way.
+func (mgr *Manager) Persist(path string) error {
+	state, err := LoadState(path)
+	if os.IsNotExist(err) {
+		state, err = &State{}, nil
+	}
+
+	mgr.lock.Lock()
+	defer mgr.lock.Unlock()
+	mgr.statePath = path
+	if err != nil {
+		return err
+	}
+	for _, desc := range state.Scripts {
+		if derr := mgr.define(desc.Name, desc.Code, desc.Inputs); derr != nil && err == nil {
+			err = fmt.Errorf("script %q: %v", desc.Name, derr)
+		}
+	}
+	if serr := mgr.save(); err == nil {
+		err = serr
+	}
+	return err
+}
+
+// State returns a Descriptor for every script defined, sorted by name.
+func (mgr *Manager) State() *State {
+	mgr.lock.Lock()
+	defer mgr.lock.Unlock()
+	return mgr.state()
+}
+
+func (mgr *Manager) state() *State {
+	state := &State{Scripts: make([]Descriptor, 0, len(mgr.scripts))}
+	for name, ss := range mgr.scripts {
+		state.Scripts = append(state.Scripts, Descriptor{
+			Name:   name,
+			Inputs: ss.Inputs(),
+			Code:   ss.Code(),
+		})
+	}
+	sort.Sort(descriptorsByName(state.Scripts))
+	return state
+}
+
+// save writes the state file, if any, replacing it only once written in full.
+func (mgr *Manager) save() error {
+	if mgr.statePath == "" {
+		return nil
+	}
+	buf, err := json.MarshalIndent(mgr.state(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(mgr.statePath), filepath.Base(mgr.statePath)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(append(buf, '\n'))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), mgr.statePath)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+type descriptorsByName []Descriptor
+
+func (ds descriptorsByName) Len() int           { return len(ds) }
+func (ds descriptorsByName) Less(i, j int) bool { return ds[i].Name < ds[j].Name }
+func (ds descriptorsByName) Swap(i, j int)      { ds[i], ds[j] = ds[j], ds[i] }
@@ -0,0 +1,366 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+/*
+Package script provides derived sources defined by Starlark scripts, so that
+items may be filtered, reshaped, or combined from one or more sources without
+recompiling the program.
+
+A script must define a process function, which is called with the name of
+the input source and each of its items, decoded from json; it returns None
+to drop the item, a value to emit, or a list of values to emit:
+
+	def process(name, item):
+	    if item["code"] >= 500:
+	        return {"path": item["path"], "code": item["code"]}
+
+Script sources will be named like "/script/...".  Their inputs are only
+watched while the script source is.  Scripts may be defined in code, with
+New, or by clients, through the "/meta/scripts" source added by AddManager.
+
+Scripts are sandboxed: they have no access to files, the network, or the
+clock, their globals are frozen after loading, so no state is kept between
+items, and each call is limited in execution steps and time; see Limits.
+Starlark has no allocation limit, so the step limit is what bounds a
+script's memory use, save for a few single steps, like string repetition,
+that may allocate a lot at once.
+*/
+package script
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	starlarkjson "go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+
+	"github.com/uber-go/gwr/source"
+)
+
+// Limits bound the resources used by each call of a script.
+type Limits struct {
+	// MaxSteps limits the Starlark execution steps of each call.
+	MaxSteps uint64
+
+	// MaxTime limits the time taken by each call.
+	MaxTime time.Duration
+
+	// MaxItems limits how many items each call may emit.
+	MaxItems int
+}
+
+// DefaultLimits are the Limits used when none are given.
+var DefaultLimits = Limits{
+	MaxSteps: 100000,
+	MaxTime:  100 * time.Millisecond,
+	MaxItems: 100,
+}
+
+var (
+	// ErrNoProcess is returned when a script doesn't define a process
+	// function.
+	ErrNoProcess = errors.New("script must define a process function")
+
+	// ErrTooManyItems is recorded when a call of a script returns more items
+	// than its MaxItems limit; none of them are emitted.
+	ErrTooManyItems = errors.New("script returned too many items")
+
+	errInactive = errors.New("script source no longer watched")
+)
+
+var textTemplate = template.Must(template.New("script_text").Parse(strings.TrimSpace(`
+{{ define "item" }}{{ . }}{{ end }}
+`)))
+
+// Source is a watchable source of the items emitted by a script.
+type Source struct {
+	name    string
+	code    string
+	inputs  []string
+	dss     *source.DataSources
+	lim     Limits
+	process starlark.Value
+
+	lock    sync.Mutex
+	watcher source.GenericDataWatcher
+	cancel  context.CancelFunc
+	calls   uint64
+	errs    uint64
+	lastErr error
+}
+
+// Stats counts a script's calls, and those that failed, with the last
+// failure.
+type Stats struct {
+	Calls     uint64 `json:"calls"`
+	Errors    uint64 `json:"errors"`
+	LastError string `json:"last_error,omitempty"`
+}
+
+// New loads a script, creating a Source whose items are those it emits for
+// the items of the named input sources in dss; zero limits are taken from
+// DefaultLimits.  Aggregate-only sources may not be inputs, since a script
+// could emit their raw items; see source.DataSources.SetAggregateOnly.
+//
+// The given name will be prefixed with "/script/" automatically.
+func New(dss *source.DataSources, name, code string, inputs []string, lim Limits) (*Source, error) {
+	for _, input := range inputs {
+		if dss.AggregateOnly(input) {
+			return nil, fmt.Errorf("%s: %v", input, source.ErrAggregateOnly)
+		}
+	}
+	if lim.MaxSteps == 0 {
+		lim.MaxSteps = DefaultLimits.MaxSteps
+	}
+	if lim.MaxTime == 0 {
+		lim.MaxTime = DefaultLimits.MaxTime
+	}
+	if lim.MaxItems == 0 {
+		lim.MaxItems = DefaultLimits.MaxItems
+	}
+	ss := &Source{
+		name:   fmt.Sprintf("/script/%s", name),
+		code:   code,
+		inputs: inputs,
+		dss:    dss,
+		lim:    lim,
+	}
+
+	thread := ss.newThread()
+	defer ss.limitTime(thread)()
+	globals, err := starlark.ExecFile(thread, ss.name, code, predeclared)
+	if err != nil {
+		return nil, err
+	}
+	process, ok := globals["process"].(starlark.Callable)
+	if !ok {
+		return nil, ErrNoProcess
+	}
+	ss.process = process
+	return ss, nil
+}
+
+var predeclared = starlark.StringDict{
+	"json": starlarkjson.Module,
+}
+
+// Name returns the full name of the source; this will be
+// "/script/name_given_to_New".
+func (ss *Source) Name() string {
+	return ss.name
+}
+
+// Inputs returns the names of the script's input sources.
+func (ss *Source) Inputs() []string {
+	return append([]string(nil), ss.inputs...)
+}
+
+// Code returns the script's source code.
+func (ss *Source) Code() string {
+	return ss.code
+}
+
+// Stats returns the script's call counts.
+func (ss *Source) Stats() Stats {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+	stats := Stats{
+		Calls:  ss.calls,
+		Errors: ss.errs,
+	}
+	if ss.lastErr != nil {
+		stats.LastError = ss.lastErr.Error()
+	}
+	return stats
+}
+
+// TextTemplate returns a text/template that prints items with fmt.
+func (ss *Source) TextTemplate() *template.Template {
+	return textTemplate
+}
+
+// SetWatcher adds a watcher at source addition time.
+func (ss *Source) SetWatcher(watcher source.GenericDataWatcher) {
+	ss.lock.Lock()
+	ss.watcher = source.AddWatcher(ss.watcher, watcher)
+	ss.lock.Unlock()
+}
+
+// Activate starts watching the script's inputs, unless they already are;
+// they're watched until the script source no longer is.  Inputs that aren't
+// defined yet, or can't be watched for items, are skipped.
+func (ss *Source) Activate() {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+	if ss.cancel != nil {
+		return
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	ss.cancel = cancel
+	for _, name := range ss.inputs {
+		w := inputWatcher{ss, ctx, name}
+		switch src := ss.dss.Get(name).(type) {
+		case source.ContextItemDataSource:
+			src.WatchItemsContext(ctx, "json", w)
+		case source.ItemDataSource:
+			src.WatchItems("json", w)
+		}
+	}
+}
+
+// Stop ends any watches of the script's inputs.
+func (ss *Source) Stop() {
+	ss.lock.Lock()
+	if ss.cancel != nil {
+		ss.cancel()
+		ss.cancel = nil
+	}
+	ss.lock.Unlock()
+}
+
+// activeWatcher returns the watcher if it's active; otherwise it stops
+// watching the inputs, returning nil.
+func (ss *Source) activeWatcher() source.GenericDataWatcher {
+	ss.lock.Lock()
+	watcher := ss.watcher
+	ss.lock.Unlock()
+	if watcher == nil || !watcher.Active() {
+		ss.Stop()
+		return nil
+	}
+	return watcher
+}
+
+func (ss *Source) newThread() *starlark.Thread {
+	thread := &starlark.Thread{
+		Name:  ss.name,
+		Print: func(*starlark.Thread, string) {},
+	}
+	thread.SetMaxExecutionSteps(ss.lim.MaxSteps)
+	return thread
+}
+
+// limitTime cancels the thread once MaxTime elapses, unless the returned
+// function is called first.
+func (ss *Source) limitTime(thread *starlark.Thread) func() {
+	timer := time.AfterFunc(ss.lim.MaxTime, func() {
+		thread.Cancel("time limit exceeded")
+	})
+	return func() { timer.Stop() }
+}
+
+// call runs the process function for an input item, returning the items to
+// emit.
+func (ss *Source) call(name string, buf []byte) ([]interface{}, error) {
+	var item interface{}
+	dec := json.NewDecoder(bytes.NewReader(buf))
+	dec.UseNumber()
+	if err := dec.Decode(&item); err != nil {
+		return nil, err
+	}
+	arg, err := toStarlark(item)
+	if err != nil {
+		return nil, err
+	}
+
+	thread := ss.newThread()
+	defer ss.limitTime(thread)()
+	res, err := starlark.Call(thread, ss.process, starlark.Tuple{starlark.String(name), arg}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	switch res := res.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case *starlark.List:
+		if res.Len() > ss.lim.MaxItems {
+			return nil, ErrTooManyItems
+		}
+		items := make([]interface{}, res.Len())
+		for i := range items {
+			if items[i], err = fromStarlark(res.Index(i)); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		out, err := fromStarlark(res)
+		if err != nil {
+			return nil, err
+		}
+		return []interface{}{out}, nil
+	}
+}
+
+func (ss *Source) handle(name string, buf []byte) error {
+	watcher := ss.activeWatcher()
+	if watcher == nil {
+		return errInactive
+	}
+	items, err := ss.call(name, buf)
+	ss.lock.Lock()
+	ss.calls++
+	if err != nil {
+		ss.errs++
+		ss.lastErr = err
+	}
+	ss.lock.Unlock()
+	switch len(items) {
+	case 0:
+	case 1:
+		watcher.HandleItem(items[0])
+	default:
+		watcher.HandleItems(items)
+	}
+	return nil
+}
+
+// inputWatcher passes the items of one input source to the script; once the
+// script source is no longer watched, it returns an error so that the input
+// drops it.
+type inputWatcher struct {
+	ss   *Source
+	ctx  context.Context
+	name string
+}
+
+func (iw inputWatcher) HandleItem(item []byte) error {
+	if err := iw.ctx.Err(); err != nil {
+		return err
+	}
+	return iw.ss.handle(iw.name, item)
+}
+
+func (iw inputWatcher) HandleItems(items [][]byte) error {
+	for _, item := range items {
+		if err := iw.HandleItem(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,246 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package script_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber-go/gwr/internal/marshaled"
+	"github.com/uber-go/gwr/source"
+	"github.com/uber-go/gwr/source/script"
+)
+
+// inputSource is a watchable source whose items are emitted by the test.
+type inputSource struct {
+	lock    sync.Mutex
+	watcher source.GenericDataWatcher
+}
+
+func (in *inputSource) Name() string { return "/test/in" }
+
+func (in *inputSource) SetWatcher(watcher source.GenericDataWatcher) {
+	in.lock.Lock()
+	in.watcher = watcher
+	in.lock.Unlock()
+}
+
+func (in *inputSource) emit(item interface{}) bool {
+	in.lock.Lock()
+	watcher := in.watcher
+	in.lock.Unlock()
+	return watcher != nil && watcher.Active() && watcher.HandleItem(item)
+}
+
+// itemCollector collects the marshaled items that it's passed.
+type itemCollector struct {
+	lock  sync.Mutex
+	items []string
+}
+
+func (ic *itemCollector) HandleItem(item []byte) error {
+	ic.lock.Lock()
+	ic.items = append(ic.items, strings.TrimSpace(string(item)))
+	ic.lock.Unlock()
+	return nil
+}
+
+func (ic *itemCollector) HandleItems(items [][]byte) error {
+	for _, item := range items {
+		ic.HandleItem(item)
+	}
+	return nil
+}
+
+func (ic *itemCollector) wait(n int) []string {
+	for i := 0; i < 100; i++ {
+		ic.lock.Lock()
+		got := len(ic.items)
+		ic.lock.Unlock()
+		if got >= n {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	ic.lock.Lock()
+	defer ic.lock.Unlock()
+	return append([]string(nil), ic.items...)
+}
+
+func TestNew(t *testing.T) {
+	dss := source.NewDataSources()
+	_, err := script.New(dss, "bad", "def process(", nil, script.Limits{})
+	assert.Error(t, err, "syntax error")
+	_, err = script.New(dss, "none", "x = 1", nil, script.Limits{})
+	assert.Equal(t, script.ErrNoProcess, err)
+
+	dss.SetAggregateOnly("/test/in", true)
+	_, err = script.New(dss, "raw", "def process(name, item): return item", []string{"/test/in"}, script.Limits{})
+	assert.Error(t, err, "aggregate-only input")
+}
+
+func TestManager(t *testing.T) {
+	dss := source.NewDataSources()
+	in := &inputSource{}
+	require.NoError(t, dss.Add(marshaled.NewDataSource(in, nil)))
+	mgr := script.NewManager(dss, script.Limits{MaxSteps: 10000})
+
+	assert.Equal(t, source.ErrInvalidParam, mgr.Action("define", map[string]string{
+		"name": "errors", "code": "def process(name, item): return item",
+	}), "inputs required")
+	require.NoError(t, mgr.Action("define", map[string]string{
+		"name":   "errors",
+		"inputs": "/test/in",
+		"code": `
+def process(name, item):
+    if item["code"] >= 500:
+        return {"from": name, "path": item["path"]}
+    if item["code"] == 0:
+        return [x for x in range(1000000)]
+`,
+	}))
+	src, ok := dss.Get("/script/errors").(source.ItemDataSource)
+	require.True(t, ok, "script source added")
+
+	ic := &itemCollector{}
+	require.NoError(t, src.WatchItems("json", ic))
+	assert.True(t, in.emit(map[string]interface{}{"path": "/ok", "code": 200}), "input watched")
+	in.emit(map[string]interface{}{"path": "/bad", "code": 503})
+	in.emit(map[string]interface{}{"path": "/loop", "code": 0})
+	assert.Equal(t, []string{`{"from":"/test/in","path":"/bad"}`}, ic.wait(1))
+
+	var infos []script.Info
+	for i := 0; i < 100; i++ {
+		infos = mgr.Get().([]script.Info)
+		if len(infos) == 1 && infos[0].Stats.Calls == 3 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	require.Len(t, infos, 1)
+	assert.Equal(t, "/script/errors", infos[0].Name)
+	assert.Equal(t, []string{"/test/in"}, infos[0].Inputs)
+	assert.Equal(t, uint64(3), infos[0].Stats.Calls)
+	assert.Equal(t, uint64(1), infos[0].Stats.Errors)
+	assert.Contains(t, infos[0].Stats.LastError, "too many steps", "step limit")
+
+	require.NoError(t, mgr.Action("remove", map[string]string{"name": "errors"}))
+	assert.Nil(t, dss.Get("/script/errors"), "script source removed")
+	assert.Equal(t, source.ErrInvalidParam, mgr.Action("remove", map[string]string{"name": "errors"}))
+}
+
+// sampledSource is an inputSource with a sample item.
+type sampledSource struct {
+	inputSource
+}
+
+func (ss *sampledSource) SampleItem() (interface{}, bool) {
+	return map[string]interface{}{"path": "/bad", "code": 503}, true
+}
+
+func TestDryRunSource(t *testing.T) {
+	dss := source.NewDataSources()
+	require.NoError(t, dss.Add(marshaled.NewDataSource(&sampledSource{}, nil)))
+	drs := script.NewDryRunSource(dss, script.Limits{MaxSteps: 10000})
+	code := `
+def process(name, item):
+    if item["code"] >= 500:
+        return {"from": name, "path": item["path"]}
+`
+	dryRun := func(params map[string]string) *script.DryRun {
+		res, err := drs.GetParams(params)
+		require.NoError(t, err)
+		return res.(*script.DryRun)
+	}
+
+	_, err := drs.GetParams(map[string]string{"input": "/test/in"})
+	assert.Equal(t, source.ErrInvalidParam, err, "code required")
+
+	dr := dryRun(map[string]string{"input": "/test/in", "code": code})
+	assert.Empty(t, dr.Error)
+	assert.JSONEq(t, `{"code":503,"path":"/bad"}`, string(dr.Item), "input's sample item")
+	assert.Equal(t, []interface{}{map[string]interface{}{"from": "/test/in", "path": "/bad"}}, dr.Output)
+
+	dr = dryRun(map[string]string{"input": "/test/in", "code": code, "item": `{"code": 200, "path": "/ok"}`})
+	assert.Empty(t, dr.Error)
+	assert.Equal(t, []interface{}{}, dr.Output, "item filtered out")
+
+	dr = dryRun(map[string]string{"input": "/test/in", "code": "def process("})
+	assert.Contains(t, dr.Error, "got end of file", "compile error")
+	dr = dryRun(map[string]string{"input": "/test/in", "code": code, "item": `{"code": "x"}`})
+	assert.Contains(t, dr.Error, "string >= int not implemented", "runtime error")
+	dr = dryRun(map[string]string{"input": "/test/none", "code": code})
+	assert.Equal(t, "/test/none: "+source.ErrNoSample.Error(), dr.Error, "no sample without an input")
+}
+
+func TestManager_Persist(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gwr-script")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "scripts.json")
+	code := "def process(name, item): return item"
+
+	dss := source.NewDataSources()
+	mgr := script.NewManager(dss, script.Limits{})
+	require.NoError(t, mgr.Persist(path), "no state file yet")
+	require.NoError(t, mgr.Define("b", code, []string{"/test/in"}))
+	require.NoError(t, mgr.Define("a", code, []string{"/test/in", "/test/other"}))
+	require.NoError(t, mgr.Define("c", code, []string{"/test/in"}))
+	assert.True(t, mgr.Remove("c"))
+
+	state, err := script.LoadState(path)
+	require.NoError(t, err)
+	assert.Equal(t, &script.State{Scripts: []script.Descriptor{
+		{Name: "a", Inputs: []string{"/test/in", "/test/other"}, Code: code},
+		{Name: "b", Inputs: []string{"/test/in"}, Code: code},
+	}}, state)
+
+	// a new process, with the same state file
+	dss = source.NewDataSources()
+	mgr2 := script.NewManager(dss, script.Limits{})
+	require.NoError(t, mgr2.Persist(path))
+	assert.Equal(t, mgr.State(), mgr2.State(), "scripts recreated")
+	assert.NotNil(t, dss.Get("/script/a"), "script source added")
+	assert.NotNil(t, dss.Get("/script/b"), "script source added")
+
+	// a script that no longer loads is dropped, but the others aren't
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"scripts": [
+		{"name": "bad", "inputs": ["/test/in"], "code": "x = 1"},
+		{"name": "ok", "inputs": ["/test/in"], "code": "def process(name, item): return item"}
+	]}`), 0644))
+	mgr3 := script.NewManager(source.NewDataSources(), script.Limits{})
+	assert.EqualError(t, mgr3.Persist(path), `script "bad": `+script.ErrNoProcess.Error())
+	state, err = script.LoadState(path)
+	require.NoError(t, err)
+	require.Len(t, state.Scripts, 1)
+	assert.Equal(t, "ok", state.Scripts[0].Name)
+
+	require.NoError(t, ioutil.WriteFile(path, []byte("{"), 0644))
+	assert.Error(t, script.NewManager(source.NewDataSources(), script.Limits{}).Persist(path), "corrupt state file")
+}
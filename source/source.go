@@ -21,6 +21,7 @@
 package source
 
 import (
+	"context"
 	"errors"
 	"io"
 )
@@ -37,6 +38,36 @@ var (
 	// ErrNotWatchable should be returned by DataSource.Get if the data source
 	// does not support watch.
 	ErrNotWatchable = errors.New("watch not supported, data source is get-only")
+
+	// ErrInvalidParam should be returned by
+	// ParamGetableDataSource.GetParams if a parameter has an invalid value.
+	ErrInvalidParam = errors.New("invalid parameter")
+
+	// ErrGetNoContent is returned by DataSource.Get when the data source
+	// had no data, and its EmptyGetPolicy is EmptyGetNoContent.
+	ErrGetNoContent = errors.New("get returned no data")
+
+	// ErrGetNotFound is returned by DataSource.Get when the data source had
+	// no data, and its EmptyGetPolicy is EmptyGetNotFound.
+	ErrGetNotFound = errors.New("get returned no data, not found")
+
+	// ErrFormatTripped is returned by DataSource.Watch when the requested
+	// format has been disabled for the data source after repeatedly failing
+	// to marshal its items; see TrippedError.
+	ErrFormatTripped = errors.New("format disabled after repeated marshaling failures")
+
+	// ErrNoSample is returned by SamplingDataSource.SampleFormats when the
+	// data source has no item to sample.
+	ErrNoSample = errors.New("no sample item available")
+
+	// ErrUnknownAction should be returned by ActionDataSource.Action for any
+	// action that the data source doesn't implement.
+	ErrUnknownAction = errors.New("unknown action")
+
+	// ErrAggregateOnly is returned to clients that try to get or watch a
+	// source whose raw items may not be consumed; see
+	// DataSources.SetAggregateOnly.
+	ErrAggregateOnly = errors.New("only aggregates of this data source may be consumed")
 )
 
 // DataSource is the low-level interface implemented by all data sources.
@@ -57,21 +88,22 @@ type DataSource interface {
 	Formats() []string
 
 	// Attrs returnts arbitrary descriptive data about the data source.  This
-	// data is exposed be the /meta/nouns data source.
+	// data is exposed be the /meta/nouns data source.  Common fields include:
+	// - "qos": the source's QoSClass, if not standard
+	// - "lossless": true if the source blocks its producer, rather than
+	//   dropping items, when watchers can't keep up; see LosslessDataSource
 	//
-	// TODO: standardize and document common fields; current ideas include:
+	// TODO: standardize and document more common fields; current ideas
+	// include:
 	// - affording get-only or watch-only
 	// - affording sampling config (%-age, N-per-t, etc)
-	// - whether this data source is lossy (likely the default) or whether
-	//   attempts should be taken to drop no item (opt-in edge case); this
-	//   could be used internally at least to switch between an implementation
-	//   that drops data when buffers fill, or blocks and provides back
-	//   pressure.
 	Attrs() map[string]interface{}
 
 	// Get implementations:
 	// - may return ErrNotGetable if get is not supported by the data source
 	// - if the format is not support then ErrUnsupportedFormat must be returned
+	// - may return ErrGetNoContent or ErrGetNotFound, without writing, if
+	//   there is no data available
 	// - must format and write any available data to the supplied io.Writer
 	// - should return any write error
 	Get(format string, w io.Writer) error
@@ -101,6 +133,65 @@ type DataSource interface {
 	Watch(format string, w io.Writer) error
 }
 
+// ParamGetableDataSource is a DataSource whose Get accepts optional named
+// parameters, e.g. how long to run a profile for.  Protocols pass any request
+// parameters that they don't otherwise interpret.
+type ParamGetableDataSource interface {
+	DataSource
+
+	// GetParams has all of the semantics of Get, with the addition of
+	// parameters; unknown parameters should be ignored.
+	GetParams(format string, params map[string]string, w io.Writer) error
+}
+
+// ContextGetableDataSource is a DataSource whose gets may take a while, e.g.
+// running a cpu profile, and so should stop early once the client goes away,
+// or the server shuts down.  Protocols prefer it to ParamGetableDataSource.
+type ContextGetableDataSource interface {
+	DataSource
+
+	// GetParamsContext has all of the semantics of
+	// ParamGetableDataSource.GetParams, except that it should return, with
+	// the context's error, as soon as the context is done.
+	GetParamsContext(ctx context.Context, format string, params map[string]string, w io.Writer) error
+}
+
+// ContextDataSource is a DataSource that supports watches scoped to a
+// context.
+type ContextDataSource interface {
+	DataSource
+
+	// WatchContext has all of the semantics of Watch, except that the watch
+	// ends as soon as the context is done, rather than on the next failed
+	// write.  Once ended, the writer is no longer written to; it is not
+	// closed however, since the canceling caller owns it.
+	WatchContext(ctx context.Context, format string, w io.Writer) error
+}
+
+// SamplingDataSource is a DataSource that can render a sample item in each of
+// its formats, so that users may preview them before starting a watch.
+type SamplingDataSource interface {
+	DataSource
+
+	// SampleFormats returns a sample item, framed as it would be in a watch
+	// stream, for each supported format; ErrNoSample is returned if no item
+	// is available.
+	SampleFormats() (map[string][]byte, error)
+}
+
+// ActionDataSource is a DataSource that accepts actions from its clients,
+// e.g. to acknowledge an item that they've been watching.  Protocols pass the
+// action's name along with any request parameters that they don't otherwise
+// interpret.
+type ActionDataSource interface {
+	DataSource
+
+	// Action performs the named action; ErrUnknownAction must be returned if
+	// it's not implemented, and ErrInvalidParam should be returned if a
+	// parameter has an invalid value.
+	Action(name string, params map[string]string) error
+}
+
 // DrainableSource is a DataSource that can be drained.  Draining a source
 // should flush any unsent data, and then close any remaining Watch writers.
 type DrainableSource interface {
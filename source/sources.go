@@ -20,7 +20,13 @@
 
 package source
 
-import "errors"
+import (
+	"errors"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
 
 var ErrSourceAlreadyDefined = errors.New("data source already defined")
 
@@ -32,11 +38,26 @@ type DataSourcesObserver interface {
 	SourceRemoved(ds DataSource)
 }
 
-// DataSources is a flat collection of DataSources
-// with a meta introspection data source.
+// DataSources is a collection of DataSources with a meta introspection data
+// source.  Sources are indexed both by their full name, and by a tree of
+// their "/"-separated name segments to afford prefix and pattern queries.
+// Sources may be added and removed while it's in use.
 type DataSources struct {
+	// lock guards sources, root and obs; the observer is called without it.
+	lock    sync.RWMutex
 	sources map[string]DataSource
+	root    sourceNode
 	obs     DataSourcesObserver
+
+	policyLock sync.RWMutex
+	aggOnly    map[string]bool
+}
+
+// sourceNode is one segment in the source name tree; a node may both hold a
+// source and have children, e.g. "/tap/trace" and "/tap/trace/foo".
+type sourceNode struct {
+	ds       DataSource
+	children map[string]*sourceNode
 }
 
 // NewDataSources creates a DataSources structure
@@ -48,15 +69,23 @@ func NewDataSources() *DataSources {
 	return dss
 }
 
+func nameSegments(name string) []string {
+	return strings.Split(strings.TrimPrefix(name, "/"), "/")
+}
+
 // SetObserver sets the (single!) observer of data source changes; if nil is
 // passed, observation is disabled.
 func (dss *DataSources) SetObserver(obs DataSourcesObserver) {
+	dss.lock.Lock()
 	dss.obs = obs
+	dss.lock.Unlock()
 }
 
 // Get returns the named data source or nil if none is defined.
 func (dss *DataSources) Get(name string) DataSource {
+	dss.lock.RLock()
 	source, ok := dss.sources[name]
+	dss.lock.RUnlock()
 	if ok {
 		return source
 	}
@@ -66,12 +95,17 @@ func (dss *DataSources) Get(name string) DataSource {
 // Add a DataSource, if none is already defined for the given name.
 func (dss *DataSources) Add(ds DataSource) error {
 	name := ds.Name()
+	dss.lock.Lock()
 	if _, ok := dss.sources[name]; ok {
+		dss.lock.Unlock()
 		return ErrSourceAlreadyDefined
 	}
 	dss.sources[name] = ds
-	if dss.obs != nil {
-		dss.obs.SourceAdded(ds)
+	dss.root.insert(nameSegments(name), ds)
+	obs := dss.obs
+	dss.lock.Unlock()
+	if obs != nil {
+		obs.SourceAdded(ds)
 	}
 	return nil
 }
@@ -79,12 +113,189 @@ func (dss *DataSources) Add(ds DataSource) error {
 // Remove a DataSource by name, if any exsits.  Returns the source removed, nil
 // if none was defined.
 func (dss *DataSources) Remove(name string) DataSource {
+	dss.lock.Lock()
 	ds, ok := dss.sources[name]
 	if ok {
 		delete(dss.sources, name)
-		if dss.obs != nil {
-			dss.obs.SourceRemoved(ds)
-		}
+		dss.root.remove(nameSegments(name))
+	}
+	obs := dss.obs
+	dss.lock.Unlock()
+	if ok && obs != nil {
+		obs.SourceRemoved(ds)
 	}
 	return ds
 }
+
+// all returns every data source.
+func (dss *DataSources) all() []DataSource {
+	dss.lock.RLock()
+	defer dss.lock.RUnlock()
+	all := make([]DataSource, 0, len(dss.sources))
+	for _, ds := range dss.sources {
+		all = append(all, ds)
+	}
+	return all
+}
+
+// SetAggregateOnly sets whether the named source is aggregate-only: if so,
+// the protocol servers refuse to get or watch it, so that its raw items,
+// which may carry sensitive payloads, are never exported; sources derived
+// from it, such as its Aggregated "/agg" source, may still be consumed.  The
+// policy applies to the name whether or not a source has been added for it
+// yet.
+func (dss *DataSources) SetAggregateOnly(name string, only bool) {
+	dss.policyLock.Lock()
+	defer dss.policyLock.Unlock()
+	if !only {
+		delete(dss.aggOnly, name)
+		return
+	}
+	if dss.aggOnly == nil {
+		dss.aggOnly = make(map[string]bool, 1)
+	}
+	dss.aggOnly[name] = true
+}
+
+// AggregateOnly returns true if the named source is aggregate-only; see
+// SetAggregateOnly.
+func (dss *DataSources) AggregateOnly(name string) bool {
+	dss.policyLock.RLock()
+	defer dss.policyLock.RUnlock()
+	return dss.aggOnly[name]
+}
+
+// Drain drains all DrainableSources, returning once they all have been.
+func (dss *DataSources) Drain() {
+	var wg sync.WaitGroup
+	for _, ds := range dss.all() {
+		if drainable, ok := ds.(DrainableSource); ok {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				drainable.Drain()
+			}()
+		}
+	}
+	wg.Wait()
+}
+
+// Match returns all data sources whose names match the given pattern, sorted
+// by name.  Patterns are matched segment-by-segment using path.Match
+// semantics, except that a final "*" segment matches the entire subtree; e.g.
+// "/tap/*" matches both "/tap/foo" and "/tap/trace/foo".
+func (dss *DataSources) Match(pattern string) []DataSource {
+	var matched []DataSource
+	dss.lock.RLock()
+	dss.root.match(nameSegments(pattern), func(ds DataSource) {
+		matched = append(matched, ds)
+	})
+	dss.lock.RUnlock()
+	sort.Sort(byName(matched))
+	return matched
+}
+
+// Complete returns the completions of a partial source name, sorted, for
+// shell-like tab completion: the names of any sources that it's a prefix of
+// within its last segment, and, for any such segments with sources below
+// them, the name up to and including the next "/"; e.g. "/me" completes to
+// "/meta/", and "/meta/n" to "/meta/nouns".
+func (dss *DataSources) Complete(prefix string) []string {
+	if !strings.HasPrefix(prefix, "/") {
+		prefix = "/" + prefix
+	}
+	segs := nameSegments(prefix)
+	dss.lock.RLock()
+	defer dss.lock.RUnlock()
+	node := &dss.root
+	for _, seg := range segs[:len(segs)-1] {
+		node = node.children[seg]
+		if node == nil {
+			return nil
+		}
+	}
+	dir := prefix[:strings.LastIndex(prefix, "/")+1]
+	last := segs[len(segs)-1]
+	var names []string
+	for seg, child := range node.children {
+		if !strings.HasPrefix(seg, last) {
+			continue
+		}
+		if child.ds != nil {
+			names = append(names, dir+seg)
+		}
+		if len(child.children) != 0 {
+			names = append(names, dir+seg+"/")
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsPattern returns true if the given name contains any pattern
+// metacharacters, and so should be resolved with DataSources.Match.
+func IsPattern(name string) bool {
+	return strings.ContainsAny(name, "*?[")
+}
+
+type byName []DataSource
+
+func (dss byName) Len() int           { return len(dss) }
+func (dss byName) Less(i, j int) bool { return dss[i].Name() < dss[j].Name() }
+func (dss byName) Swap(i, j int)      { dss[i], dss[j] = dss[j], dss[i] }
+
+func (node *sourceNode) insert(segs []string, ds DataSource) {
+	for _, seg := range segs {
+		if node.children == nil {
+			node.children = make(map[string]*sourceNode, 1)
+		}
+		child, ok := node.children[seg]
+		if !ok {
+			child = &sourceNode{}
+			node.children[seg] = child
+		}
+		node = child
+	}
+	node.ds = ds
+}
+
+// remove clears the source at the given path, pruning any nodes left empty;
+// it returns true if the node itself is now empty.
+func (node *sourceNode) remove(segs []string) bool {
+	if len(segs) == 0 {
+		node.ds = nil
+	} else if child, ok := node.children[segs[0]]; ok && child.remove(segs[1:]) {
+		delete(node.children, segs[0])
+	}
+	return node.ds == nil && len(node.children) == 0
+}
+
+func (node *sourceNode) match(segs []string, each func(DataSource)) {
+	if len(segs) == 0 {
+		if node.ds != nil {
+			each(node.ds)
+		}
+		return
+	}
+	seg := segs[0]
+	if seg == "*" && len(segs) == 1 {
+		for _, child := range node.children {
+			child.walk(each)
+		}
+		return
+	}
+	for name, child := range node.children {
+		if ok, _ := path.Match(seg, name); ok {
+			child.match(segs[1:], each)
+		}
+	}
+}
+
+func (node *sourceNode) walk(each func(DataSource)) {
+	if node.ds != nil {
+		each(node.ds)
+	}
+	for _, child := range node.children {
+		child.walk(each)
+	}
+}
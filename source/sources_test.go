@@ -0,0 +1,110 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package source_test
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/uber-go/gwr/source"
+)
+
+type namedSource string
+
+func (ns namedSource) Name() string                  { return string(ns) }
+func (ns namedSource) Formats() []string             { return []string{"json"} }
+func (ns namedSource) Attrs() map[string]interface{} { return nil }
+func (ns namedSource) Get(string, io.Writer) error   { return source.ErrNotGetable }
+func (ns namedSource) Watch(string, io.Writer) error { return source.ErrNotWatchable }
+
+func names(srcs []source.DataSource) []string {
+	var r []string
+	for _, src := range srcs {
+		r = append(r, src.Name())
+	}
+	return r
+}
+
+func TestDataSources_Match(t *testing.T) {
+	dss := source.NewDataSources()
+	for _, name := range []string{
+		"/meta/nouns",
+		"/tap/foo",
+		"/tap/trace",
+		"/tap/trace/bar",
+		"/tap/trace/baz/qux",
+	} {
+		assert.NoError(t, dss.Add(namedSource(name)))
+	}
+
+	assert.Equal(t, []string{
+		"/tap/foo",
+		"/tap/trace",
+		"/tap/trace/bar",
+		"/tap/trace/baz/qux",
+	}, names(dss.Match("/tap/*")), "trailing star matches the subtree")
+	assert.Equal(t, []string{
+		"/tap/trace/bar",
+		"/tap/trace/baz/qux",
+	}, names(dss.Match("/tap/trace/*")))
+	assert.Equal(t, []string{"/tap/trace/bar"}, names(dss.Match("/tap/trace/ba?")),
+		"inner patterns match one segment")
+	assert.Equal(t, []string{"/meta/nouns"}, names(dss.Match("/*/nouns")))
+	assert.Nil(t, dss.Match("/nope/*"))
+
+	dss.Remove("/tap/trace/baz/qux")
+	assert.Equal(t, []string{"/tap/trace/bar"}, names(dss.Match("/tap/trace/*")),
+		"removed sources no longer match")
+}
+
+func TestDataSources_Complete(t *testing.T) {
+	dss := source.NewDataSources()
+	for _, name := range []string{
+		"/meta/nouns",
+		"/meta/stalls",
+		"/tap/foo",
+		"/tap/trace",
+		"/tap/trace/bar",
+	} {
+		assert.NoError(t, dss.Add(namedSource(name)))
+	}
+
+	assert.Equal(t, []string{"/meta/", "/tap/"}, dss.Complete(""))
+	assert.Equal(t, []string{"/meta/"}, dss.Complete("/me"), "directories end in a slash")
+	assert.Equal(t, []string{"/meta/nouns", "/meta/stalls"}, dss.Complete("/meta/"))
+	assert.Equal(t, []string{"/meta/nouns"}, dss.Complete("meta/n"), "leading slash optional")
+	assert.Equal(t, []string{"/tap/trace", "/tap/trace/"}, dss.Complete("/tap/tr"),
+		"a source may also be a directory")
+	assert.Nil(t, dss.Complete("/nope/"))
+	assert.Nil(t, dss.Complete("/meta/x"))
+}
+
+func TestDataSources_AggregateOnly(t *testing.T) {
+	dss := source.NewDataSources()
+	assert.False(t, dss.AggregateOnly("/tap/req"))
+	dss.SetAggregateOnly("/tap/req", true)
+	assert.True(t, dss.AggregateOnly("/tap/req"), "set before the source is added")
+	assert.False(t, dss.AggregateOnly("/tap/req/agg"), "derived sources unaffected")
+	dss.SetAggregateOnly("/tap/req", false)
+	assert.False(t, dss.AggregateOnly("/tap/req"))
+}
@@ -0,0 +1,445 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+/*
+Package sqlitestore retains the recent items of chosen watchable sources in an
+embedded SQLite database file, so that they survive a restart, and may be
+gotten by time.
+
+A source wrapped by Store.Retain, like one wrapped by source.NewBuffered, is
+always watched: every item that it emits is stored, with the time it was
+emitted, before being passed on to any watchers.  A Get returns the retained
+items, oldest first, and every new watch stream starts with them; a "since"
+parameter, e.g. "since=5m" or "since=2017-01-02T15:04:05Z", limits a Get to
+items emitted since then.
+
+Items are stored as json, and are returned as such (see Item) rather than as
+the values originally emitted.  Items older than the store's TTL, and any
+beyond its per-source caps, are deleted periodically.
+*/
+package sqlitestore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uber-go/gwr/source"
+
+	// registers the "sqlite3" database/sql driver
+	_ "github.com/mattn/go-sqlite3"
+)
+
+const (
+	defaultMaxItems      = 1000
+	defaultPruneInterval = time.Minute
+)
+
+// ErrClosed is returned when using a Store after Close.
+var ErrClosed = errors.New("sqlitestore: store closed")
+
+const schema = `
+CREATE TABLE IF NOT EXISTS items (
+	id     INTEGER PRIMARY KEY AUTOINCREMENT,
+	source TEXT    NOT NULL,
+	at     INTEGER NOT NULL,
+	data   BLOB    NOT NULL
+);
+CREATE INDEX IF NOT EXISTS items_source_at ON items (source, at);
+`
+
+// pruneQuery deletes each source's items beyond the newest MaxItems, or the
+// newest MaxBytes worth of data, if that's set.
+const pruneQuery = `
+DELETE FROM items WHERE id IN (
+	SELECT id FROM (
+		SELECT id,
+			ROW_NUMBER() OVER (PARTITION BY source ORDER BY id DESC) AS n,
+			SUM(LENGTH(data)) OVER (PARTITION BY source ORDER BY id DESC) AS size
+		FROM items
+	) WHERE n > ?1 OR (?2 > 0 AND size > ?2)
+)`
+
+// Config configures a Store.
+type Config struct {
+	// Path is the database file, created if it doesn't exist.
+	Path string
+
+	// TTL, if set, is how long items are retained after being emitted.
+	TTL time.Duration
+
+	// MaxItems caps how many items are retained for each source; it defaults
+	// to 1000.
+	MaxItems int
+
+	// MaxBytes, if set, caps the total size of the json items retained for
+	// each source.
+	MaxBytes int64
+
+	// PruneInterval is how often expired items, and those beyond the caps,
+	// are deleted; it defaults to a minute.  Gets never return such items,
+	// even before they're deleted, except those beyond MaxBytes.
+	PruneInterval time.Duration
+
+	// Errorf, if non-nil, is called with any error storing, getting, or
+	// pruning items, which otherwise go unreported.
+	Errorf func(format string, args ...interface{})
+}
+
+// Store is an SQLite database of retained items, shared by any number of
+// sources; see Retain.
+type Store struct {
+	cfg    Config
+	db     *sql.DB
+	closed int32 // atomic
+	stop   chan struct{}
+	done   chan struct{}
+	once   sync.Once
+}
+
+// Open opens, or creates, the database at cfg.Path, deleting any items that
+// expired, or are beyond the caps, since it was last used; they are then
+// pruned every PruneInterval until the Store is closed.
+func Open(cfg Config) (*Store, error) {
+	if cfg.MaxItems <= 0 {
+		cfg.MaxItems = defaultMaxItems
+	}
+	if cfg.PruneInterval <= 0 {
+		cfg.PruneInterval = defaultPruneInterval
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+cfg.Path+"?_journal_mode=WAL&_synchronous=NORMAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+	// one connection serializes writers, rather than having them contend
+	// for the database lock
+	db.SetMaxOpenConns(1)
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	st := &Store{
+		cfg:  cfg,
+		db:   db,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if err := st.Prune(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	go st.pruneEvery(cfg.PruneInterval)
+	return st, nil
+}
+
+// Close stops pruning, and closes the database; any sources retained by the
+// store then only pass on their items, and get nothing.
+func (st *Store) Close() error {
+	var err error
+	st.once.Do(func() {
+		atomic.StoreInt32(&st.closed, 1)
+		close(st.stop)
+		<-st.done
+		err = st.db.Close()
+	})
+	return err
+}
+
+// Prune deletes all expired items, and those beyond any source's caps.
+func (st *Store) Prune() error {
+	if atomic.LoadInt32(&st.closed) != 0 {
+		return ErrClosed
+	}
+	if st.cfg.TTL > 0 {
+		cutoff := time.Now().Add(-st.cfg.TTL).UnixNano()
+		if _, err := st.db.Exec(`DELETE FROM items WHERE at < ?`, cutoff); err != nil {
+			return err
+		}
+	}
+	_, err := st.db.Exec(pruneQuery, st.cfg.MaxItems, st.cfg.MaxBytes)
+	return err
+}
+
+func (st *Store) pruneEvery(interval time.Duration) {
+	defer close(st.done)
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-tick.C:
+			if err := st.Prune(); err != nil {
+				st.errorf("prune failed: %v", err)
+			}
+		case <-st.stop:
+			return
+		}
+	}
+}
+
+func (st *Store) errorf(format string, args ...interface{}) {
+	if st.cfg.Errorf != nil {
+		st.cfg.Errorf(format, args...)
+	}
+}
+
+// Retain wraps the source, storing every item that it emits; see the package
+// documentation.  Any items retained under the source's name, from an
+// earlier run, are returned by Get straight away.  If the source implements
+// ActivateWatchableDataSource, it is activated immediately, since the wrapper
+// is always watching it.
+func (st *Store) Retain(src source.WatchableDataSource) *Retained {
+	ret := &Retained{
+		st:  st,
+		src: src,
+	}
+	src.SetWatcher(retainedWatcher{ret})
+	if actsrc, ok := src.(source.ActivateWatchableDataSource); ok {
+		actsrc.Activate()
+	}
+	return ret
+}
+
+// store inserts the items, emitted now, under the given source name.
+func (st *Store) store(name string, items []interface{}) error {
+	if atomic.LoadInt32(&st.closed) != 0 {
+		return ErrClosed
+	}
+	at := time.Now().UnixNano()
+	tx, err := st.db.Begin()
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		data, err := json.Marshal(source.ApplyTypeMarshalers(item))
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		if _, err := tx.Exec(`INSERT INTO items (source, at, data) VALUES (?, ?, ?)`, name, at, data); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// items returns the newest items retained under the given source name,
+// emitted no earlier than since, oldest first, up to limit of them.
+func (st *Store) items(name string, since time.Time, limit int) ([]Item, error) {
+	if atomic.LoadInt32(&st.closed) != 0 {
+		return nil, ErrClosed
+	}
+	if st.cfg.TTL > 0 {
+		if cutoff := time.Now().Add(-st.cfg.TTL); since.Before(cutoff) {
+			since = cutoff
+		}
+	}
+	var after int64
+	if !since.IsZero() {
+		after = since.UnixNano()
+	}
+	rows, err := st.db.Query(
+		`SELECT data FROM items WHERE source = ? AND at >= ? ORDER BY id DESC LIMIT ?`,
+		name, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []Item{}
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		items = append(items, Item(data))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+	return items, nil
+}
+
+// Item is a retained item, as json.
+type Item []byte
+
+// MarshalJSON returns the item as-is.
+func (it Item) MarshalJSON() ([]byte, error) {
+	return []byte(it), nil
+}
+
+// String returns the item's json.
+func (it Item) String() string {
+	return string(it)
+}
+
+// Retained is a source wrapped by Store.Retain.
+type Retained struct {
+	st  *Store
+	src source.WatchableDataSource
+
+	lock    sync.Mutex
+	watcher source.GenericDataWatcher
+}
+
+// Name returns the wrapped source's name.
+func (ret *Retained) Name() string {
+	return ret.src.Name()
+}
+
+// QoS returns the wrapped source's QoSClass, if any.
+func (ret *Retained) QoS() source.QoSClass {
+	if qossrc, ok := ret.src.(source.QoSDataSource); ok {
+		return qossrc.QoS()
+	}
+	return source.QoSStandard
+}
+
+// Get returns the retained items, oldest first.
+func (ret *Retained) Get() interface{} {
+	return ret.get(time.Time{})
+}
+
+// GetParams returns the retained items emitted since the time given by the
+// "since" parameter, oldest first.  It may be either a duration before now,
+// e.g. "90s", an RFC3339 time, or a number of seconds since the unix epoch.
+func (ret *Retained) GetParams(params map[string]string) (interface{}, error) {
+	val, ok := params["since"]
+	if !ok {
+		return ret.Get(), nil
+	}
+	since, err := parseSince(val, time.Now())
+	if err != nil {
+		return nil, source.ErrInvalidParam
+	}
+	return ret.get(since), nil
+}
+
+// WatchInit returns the retained items, oldest first.
+func (ret *Retained) WatchInit() interface{} {
+	return ret.Get()
+}
+
+// Backlog returns up to the n most recently retained items, oldest first.
+func (ret *Retained) Backlog(n int) []interface{} {
+	items, err := ret.st.items(ret.src.Name(), time.Time{}, n)
+	if err != nil {
+		if err != ErrClosed {
+			ret.st.errorf("%s backlog failed: %v", ret.src.Name(), err)
+		}
+		return nil
+	}
+	backlog := make([]interface{}, len(items))
+	for i, item := range items {
+		backlog[i] = item
+	}
+	return backlog
+}
+
+// SetWatcher adds a watcher that items are passed on to, after being
+// stored.
+func (ret *Retained) SetWatcher(watcher source.GenericDataWatcher) {
+	ret.lock.Lock()
+	ret.watcher = source.AddWatcher(ret.watcher, watcher)
+	ret.lock.Unlock()
+}
+
+// SampleItem returns the most recently retained item, if any.
+func (ret *Retained) SampleItem() (interface{}, bool) {
+	items, err := ret.st.items(ret.src.Name(), time.Time{}, 1)
+	if err != nil || len(items) == 0 {
+		return nil, false
+	}
+	return items[0], true
+}
+
+func (ret *Retained) get(since time.Time) []Item {
+	items, err := ret.st.items(ret.src.Name(), since, ret.st.cfg.MaxItems)
+	if err != nil {
+		if err != ErrClosed {
+			ret.st.errorf("%s get failed: %v", ret.src.Name(), err)
+		}
+		return []Item{}
+	}
+	return items
+}
+
+// add stores the items, returning the downstream watcher to pass them to.
+func (ret *Retained) add(items []interface{}) source.GenericDataWatcher {
+	if err := ret.st.store(ret.src.Name(), items); err != nil && err != ErrClosed {
+		ret.st.errorf("%s store failed: %v", ret.src.Name(), err)
+	}
+	ret.lock.Lock()
+	defer ret.lock.Unlock()
+	return ret.watcher
+}
+
+// parseSince parses a "since" parameter, relative to now.
+func parseSince(val string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(val); err == nil {
+		return now.Add(-d), nil
+	}
+	if t, err := time.Parse(time.RFC3339Nano, val); err == nil {
+		return t, nil
+	}
+	secs, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Unix(secs, 0), nil
+}
+
+// retainedWatcher is the watcher that Retained sets on its wrapped source.
+type retainedWatcher struct {
+	ret *Retained
+}
+
+func (rw retainedWatcher) Active() bool {
+	return !source.Disabled()
+}
+
+func (rw retainedWatcher) HandleItem(item interface{}) bool {
+	if source.Disabled() {
+		return false
+	}
+	if watcher := rw.ret.add([]interface{}{item}); watcher != nil && watcher.Active() {
+		watcher.HandleItem(item)
+	}
+	return true
+}
+
+func (rw retainedWatcher) HandleItems(items []interface{}) bool {
+	if source.Disabled() {
+		return false
+	}
+	if watcher := rw.ret.add(items); watcher != nil && watcher.Active() {
+		watcher.HandleItems(items)
+	}
+	return true
+}
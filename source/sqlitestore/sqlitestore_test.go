@@ -0,0 +1,179 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package sqlitestore_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber-go/gwr/internal/marshaled"
+	"github.com/uber-go/gwr/source"
+	"github.com/uber-go/gwr/source/sqlitestore"
+)
+
+type itemSource struct {
+	name    string
+	watcher source.GenericDataWatcher
+}
+
+func (is *itemSource) Name() string { return is.name }
+
+func (is *itemSource) SetWatcher(watcher source.GenericDataWatcher) {
+	is.watcher = watcher
+}
+
+type sliceWatcher struct {
+	items []interface{}
+}
+
+func (sw *sliceWatcher) Active() bool { return true }
+
+func (sw *sliceWatcher) HandleItem(item interface{}) bool {
+	sw.items = append(sw.items, item)
+	return true
+}
+
+func (sw *sliceWatcher) HandleItems(items []interface{}) bool {
+	sw.items = append(sw.items, items...)
+	return true
+}
+
+func tempDB(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "sqlitestore")
+	require.NoError(t, err)
+	return filepath.Join(dir, "items.db"), func() { os.RemoveAll(dir) }
+}
+
+func getJSON(t *testing.T, mds *marshaled.DataSource, params map[string]string) string {
+	var out bytes.Buffer
+	require.NoError(t, mds.GetParams("json", params, &out))
+	return out.String()
+}
+
+func TestRetained(t *testing.T) {
+	path, cleanup := tempDB(t)
+	defer cleanup()
+
+	st, err := sqlitestore.Open(sqlitestore.Config{Path: path, MaxItems: 3})
+	require.NoError(t, err)
+
+	src := &itemSource{name: "/items"}
+	ret := st.Retain(src)
+	assert.True(t, src.watcher.Active(), "wrapped source is always watched")
+	assert.Equal(t, []sqlitestore.Item{}, ret.Get())
+	_, ok := ret.SampleItem()
+	assert.False(t, ok, "nothing retained yet")
+
+	var sw sliceWatcher
+	ret.SetWatcher(&sw)
+	src.watcher.HandleItem(map[string]interface{}{"n": 1})
+	src.watcher.HandleItems([]interface{}{
+		map[string]interface{}{"n": 2},
+		map[string]interface{}{"n": 3},
+		map[string]interface{}{"n": 4},
+	})
+	assert.Len(t, sw.items, 4, "items passed on")
+
+	mds := marshaled.NewDataSource(ret, nil)
+	assert.Equal(t, `[{"n":2},{"n":3},{"n":4}]`, getJSON(t, mds, nil), "newest items gotten")
+	item, ok := ret.SampleItem()
+	assert.True(t, ok)
+	assert.Equal(t, `{"n":4}`, item.(sqlitestore.Item).String(), "latest item sampled")
+	assert.Equal(t, []interface{}{
+		sqlitestore.Item(`{"n":3}`),
+		sqlitestore.Item(`{"n":4}`),
+	}, ret.Backlog(2), "newest items backlogged")
+
+	// items survive reopening the store
+	require.NoError(t, st.Close())
+	src.watcher.HandleItem(map[string]interface{}{"n": 5})
+	assert.Equal(t, []sqlitestore.Item{}, ret.Get(), "nothing gotten once closed")
+
+	st, err = sqlitestore.Open(sqlitestore.Config{Path: path, MaxItems: 3})
+	require.NoError(t, err)
+	defer st.Close()
+	mds = marshaled.NewDataSource(st.Retain(&itemSource{name: "/items"}), nil)
+	assert.Equal(t, `[{"n":2},{"n":3},{"n":4}]`, getJSON(t, mds, nil), "items retained across restart")
+}
+
+func TestRetained_since(t *testing.T) {
+	path, cleanup := tempDB(t)
+	defer cleanup()
+
+	st, err := sqlitestore.Open(sqlitestore.Config{Path: path})
+	require.NoError(t, err)
+	defer st.Close()
+
+	src := &itemSource{name: "/items"}
+	mds := marshaled.NewDataSource(st.Retain(src), nil)
+	src.watcher.HandleItem("old")
+	time.Sleep(200 * time.Millisecond)
+	mid := time.Now()
+	src.watcher.HandleItem("new")
+
+	assert.Equal(t, `["old","new"]`, getJSON(t, mds, nil))
+	ago := time.Since(mid) + 50*time.Millisecond
+	assert.Equal(t, `["new"]`, getJSON(t, mds, map[string]string{"since": ago.String()}))
+	assert.Equal(t, `["new"]`, getJSON(t, mds, map[string]string{"since": mid.Format(time.RFC3339Nano)}))
+	assert.Equal(t, `["old","new"]`, getJSON(t, mds, map[string]string{"since": "1h"}))
+	assert.Equal(t, `[]`, getJSON(t, mds, map[string]string{"since": "-1h"}))
+
+	var out bytes.Buffer
+	assert.Equal(t, source.ErrInvalidParam, mds.GetParams("json", map[string]string{"since": "yesterday"}, &out))
+
+	out.Reset()
+	require.NoError(t, mds.Get("text", &out))
+	assert.Equal(t, `["old" "new"]`, out.String(), "items rendered as json text")
+}
+
+func TestStore_Prune(t *testing.T) {
+	path, cleanup := tempDB(t)
+	defer cleanup()
+
+	st, err := sqlitestore.Open(sqlitestore.Config{
+		Path:     path,
+		TTL:      time.Hour,
+		MaxItems: 3,
+		MaxBytes: 10,
+	})
+	require.NoError(t, err)
+	defer st.Close()
+
+	a, b := &itemSource{name: "/a"}, &itemSource{name: "/b"}
+	reta, retb := st.Retain(a), st.Retain(b)
+	a.watcher.HandleItems([]interface{}{1, 2, 3, 4, 5})
+	b.watcher.HandleItems([]interface{}{"aaaa", "bbbb", "cccc"})
+	require.NoError(t, st.Prune())
+
+	assert.Equal(t, []sqlitestore.Item{
+		sqlitestore.Item("3"), sqlitestore.Item("4"), sqlitestore.Item("5"),
+	}, reta.Get(), "items capped by count")
+	assert.Equal(t, []sqlitestore.Item{
+		sqlitestore.Item(`"cccc"`),
+	}, retb.Get(), "items capped by size")
+}
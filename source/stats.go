@@ -0,0 +1,78 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package source
+
+import "time"
+
+// Stats describes how busy a data source is; see StatsDataSource.
+type Stats struct {
+	Active   bool    `json:"active"`
+	Watchers int     `json:"watchers"`
+	Items    uint64  `json:"items"`
+	Rate     float64 `json:"items_per_sec"`
+	Dropped  uint64  `json:"dropped"`
+
+	// FormatWatchers breaks Watchers down by format, omitting any formats
+	// that aren't being watched.
+	FormatWatchers map[string]int `json:"format_watchers,omitempty"`
+
+	// MarshalErrors counts the items that failed to marshal, for any
+	// format; Bytes counts the marshaled bytes handed to watchers.
+	MarshalErrors uint64 `json:"marshal_errors"`
+	Bytes         uint64 `json:"bytes"`
+
+	// Labels counts the watchers by the label that their clients attached;
+	// see WithWatchLabel.
+	Labels map[string]int `json:"labels,omitempty"`
+
+	// Queued counts the items and batches waiting to be emitted, in queues
+	// that hold QueueSize of them; Stalled is true if emitting one has taken
+	// longer than StallTimeout, e.g. on a blocked writer.
+	Queued    int  `json:"queued"`
+	QueueSize int  `json:"queue_size"`
+	Stalled   bool `json:"stalled,omitempty"`
+}
+
+// StallTimeout is how long a source may take to emit an item before it's
+// reported as Stalled.
+const StallTimeout = 10 * time.Second
+
+// StatsDataSource is a DataSource that keeps counts of its watchers and
+// items, such as those implemented by marshaled.DataSource.
+type StatsDataSource interface {
+	DataSource
+
+	// Stats returns the current watcher count and the total number of items
+	// emitted and dropped since the data source was created.  Rate is the
+	// recent number of items emitted per second.  Sources that don't marshal
+	// items may leave MarshalErrors and Bytes zero.
+	Stats() Stats
+}
+
+// GetStats returns the stats of a data source, or nil if it doesn't keep any.
+func GetStats(ds DataSource) *Stats {
+	sds, ok := ds.(StatsDataSource)
+	if !ok {
+		return nil
+	}
+	stats := sds.Stats()
+	return &stats
+}
@@ -0,0 +1,82 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tap
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+
+	"github.com/uber-go/gwr"
+)
+
+// BreakpointHit is the data of the TriggerItem that a Breakpoint emits each
+// time it's hit.
+type BreakpointHit struct {
+	Data  interface{} `json:"data"`
+	Stack string      `json:"stack"`
+}
+
+// String returns the hit's data, followed by the stack of the goroutine that
+// hit it.
+func (bh BreakpointHit) String() string {
+	return fmt.Sprintf("%v\n%s", bh.Data, bh.Stack)
+}
+
+// Breakpoint is a watch-only source that pauses the goroutines hitting it
+// until a watcher continues them, so that a program may be paused at an
+// instrumented point on demand, without attaching a debugger.  It's entirely
+// inert while unwatched.
+//
+// Breakpoints are named like "/tap/break/...", and are Triggers whose
+// acknowledging action is "continue".  Over HTTP, a hit is continued
+// with "POST /tap/break/name?action=continue&id=N"; over RESP, with "action
+// /tap/break/name continue id N".
+type Breakpoint struct {
+	*Trigger
+}
+
+// NewBreakpoint creates a Breakpoint with a given name; hits wait up to
+// timeout to be continued.
+func NewBreakpoint(name string, timeout time.Duration) *Breakpoint {
+	return &Breakpoint{newTrigger(fmt.Sprintf("break/%s", name), nil, timeout, "continue")}
+}
+
+// AddBreakpoint creates a breakpoint source and adds it to the default gwr
+// sources.
+func AddBreakpoint(name string, timeout time.Duration) *Breakpoint {
+	bp := NewBreakpoint(name, timeout)
+	gwr.AddGenericDataSource(bp)
+	return bp
+}
+
+// Hit emits the data, along with the calling goroutine's stack, to any
+// active watchers, and then blocks until one of them continues it, or the
+// breakpoint's timeout passes.  It returns true only if a watcher continued
+// it; with no watchers, it returns false immediately.
+func (bp *Breakpoint) Hit(data interface{}) (continued bool) {
+	if !bp.Active() {
+		return false
+	}
+	buf := make([]byte, 4096)
+	buf = buf[:runtime.Stack(buf, false)]
+	return bp.EmitAcked(BreakpointHit{Data: data, Stack: string(buf)})
+}
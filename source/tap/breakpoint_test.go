@@ -0,0 +1,57 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// +build !gwr_noop
+
+package tap_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/uber-go/gwr/source"
+	"github.com/uber-go/gwr/source/tap"
+)
+
+func TestBreakpoint_Hit(t *testing.T) {
+	bp := tap.NewBreakpoint("here", 20*time.Millisecond)
+	assert.Equal(t, "/tap/break/here", bp.Name())
+	assert.False(t, bp.Hit("unwatched"), "inert while unwatched")
+
+	tw := &toggleWatcher{active: true, items: make(chan interface{}, 10)}
+	bp.SetWatcher(tw)
+
+	go func() {
+		item := (<-tw.items).(tap.TriggerItem)
+		hit := item.Data.(tap.BreakpointHit)
+		assert.Equal(t, 42, hit.Data)
+		assert.Contains(t, hit.Stack, "TestBreakpoint_Hit", "has the hitting goroutine's stack")
+		id := map[string]string{"id": fmt.Sprint(item.ID)}
+		assert.Equal(t, source.ErrUnknownAction, bp.Action("ack", id), "continued, not acked")
+		assert.NoError(t, bp.Action("continue", id))
+	}()
+	assert.True(t, bp.Hit(42), "continued by watcher")
+	assert.False(t, bp.Hit(43), "timed out")
+
+	tw.setActive(false)
+}
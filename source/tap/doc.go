@@ -33,6 +33,18 @@ All emitter sources will be named like "/tap/...", to emphasize their generic
 nature.  The normal use case here is for adding adhoc taps into existing
 program data.
 
+Trigger
+
+The Trigger source is a watch-only emitter whose items each await an
+acknowledgment from a watcher, sent as an "ack" action; Trigger.EmitAcked
+reports whether one came in time.  It lets a program pause, or alter its
+behavior, only when someone is actually watching.
+
+Breakpoint builds on Trigger: Breakpoint.Hit blocks the calling goroutine
+until a watcher of its "/tap/break/..." source sends a "continue" action, or
+its timeout passes; so a program may be paused at an instrumented point on
+demand, without attaching a debugger.
+
 Tracer
 
 The Tracer source is useful for tracing program execution.  It can be used
@@ -44,5 +56,25 @@ provided at "/tap/trace", however the normal usage pattern is to declare
 one-or-more tracers within a package, and to name the appropriately to the area
 of the code that is traced.
 
+End and error records carry the time elapsed since their scope's begin.  Each
+tracer also has a derived latency source, "/tap/trace/.../latency", which
+summarizes the elapsed times of each scope name every 10 seconds.
+
+A trace may span goroutines by passing its scope in a context.Context (see
+ContextWithScope and ScopeFromContext), and services by passing it in the
+Gwr-Trace HTTP header (see TraceScope.InjectHeader and Tracer.ScopeFromHeader).
+
+Tracer scopes can also be exported to a distributed tracing backend: either by
+bridging a tracer into an OpenTracing tracer with Tracer.SetOpenTracer, or by
+watching its "zipkin" format, which emits each closed scope as a Zipkin v2 JSON
+span.
+
+No-op Builds
+
+When built with the gwr_noop tag (e.g. "go build -tags gwr_noop"), emitters
+and tracers are never added as sources, and all of their emission methods
+compile down to nothing; so instrumentation may be left in place while
+provably costing nothing in such builds.
+
 */
 package tap
@@ -33,7 +33,7 @@ type stringer interface {
 	String() string
 }
 
-var defaultTextFormat = internal.FormatFunc(func(val interface{}) ([]byte, error) {
+var defaultTextFormat = source.GenericDataFormatFunc(func(val interface{}) ([]byte, error) {
 	if str, ok := val.(stringer); ok {
 		return []byte(str.String()), nil
 	}
@@ -46,7 +46,7 @@ var defaultTextFormat = internal.FormatFunc(func(val interface{}) ([]byte, error
 type Emitter struct {
 	name    string
 	tmpl    *template.Template
-	watcher source.GenericDataWatcher
+	watcher watcherRef
 }
 
 // NewEmitter creates an Emitter with a given name and text template; if the
@@ -92,37 +92,60 @@ func (em *Emitter) Formats() map[string]source.GenericDataFormat {
 	}
 }
 
-// SetWatcher sets the watcher at source addition time.
+// SetWatcher adds a watcher at source addition time; it may be called while
+// items are being emitted.
 func (em *Emitter) SetWatcher(watcher source.GenericDataWatcher) {
-	em.watcher = watcher
+	em.watcher.add(watcher)
+}
+
+// Activate is called when the watcher becomes active.
+func (em *Emitter) Activate() {
+	em.watcher.activate()
+}
+
+// Deactivate is called when the watcher goes inactive, so that emitting
+// needn't check it again until it's reactivated.
+func (em *Emitter) Deactivate() {
+	em.watcher.deactivate()
 }
 
 // Active retruns true if there are any active watchers.
 func (em *Emitter) Active() bool {
-	return em.watcher.Active()
+	if internal.Noop || source.Disabled() {
+		return false
+	}
+	return em.watcher.active() != nil
 }
 
 // Emit emits item(s) to any active watchers.  Returns true if the watcher is
 // (still) active.
 func (em *Emitter) Emit(items ...interface{}) bool {
-	if !em.watcher.Active() {
+	if internal.Noop || source.Disabled() {
+		return false
+	}
+	watcher := em.watcher.active()
+	if watcher == nil {
 		return false
 	}
 	switch len(items) {
 	case 0:
 		return true
 	case 1:
-		return em.watcher.HandleItem(items[0])
+		return watcher.HandleItem(items[0])
 	default:
-		return em.watcher.HandleItems(items)
+		return watcher.HandleItems(items)
 	}
 }
 
 // EmitBatch emits batch of items.  Returns true if the watcher is (still)
 // active.
 func (em *Emitter) EmitBatch(items []interface{}) bool {
-	if !em.watcher.Active() {
+	if internal.Noop || source.Disabled() {
+		return false
+	}
+	watcher := em.watcher.active()
+	if watcher == nil {
 		return false
 	}
-	return em.watcher.HandleItems(items)
+	return watcher.HandleItems(items)
 }
@@ -0,0 +1,81 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// +build !gwr_noop
+
+package tap_test
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber-go/gwr/internal/marshaled"
+	"github.com/uber-go/gwr/source/tap"
+)
+
+func TestEmitter_Deactivate(t *testing.T) {
+	em := tap.NewEmitter("emitter", nil)
+	mds := marshaled.NewDataSource(em, nil)
+	assert.False(t, em.Active(), "not yet watched")
+
+	var buf bytes.Buffer
+	require.NoError(t, mds.Watch("json", &buf))
+	assert.True(t, em.Active(), "watched")
+	assert.True(t, em.Emit(1))
+	mds.Drain()
+	assert.False(t, em.Active(), "inactive after drain")
+	assert.False(t, em.Emit(2), "dropped after drain")
+	assert.Equal(t, "1\n", buf.String())
+
+	tw := &toggleWatcher{active: true, items: make(chan interface{}, 10)}
+	em.SetWatcher(tw)
+	em.Deactivate()
+	assert.True(t, em.Active(), "still active through another watcher")
+	tw.setActive(false)
+	em.Deactivate()
+	tw.setActive(true)
+	assert.False(t, em.Active(), "watchers not asked until reactivated")
+	em.Activate()
+	assert.True(t, em.Active(), "reactivated")
+}
+
+func TestEmitter_SetWatcher_race(t *testing.T) {
+	em := tap.NewEmitter("racer", nil)
+	tw := &toggleWatcher{active: true, items: make(chan interface{}, 1000)}
+	em.SetWatcher(tw)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			em.Emit(i)
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		em.SetWatcher(&toggleWatcher{active: true, items: make(chan interface{}, 1000)})
+	}
+	wg.Wait()
+	assert.Len(t, tw.items, 100, "first watcher saw every item")
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tap
+
+import (
+	"sync"
+	"time"
+)
+
+// KeepFunc decides, when the root scope of a flight recorded trace closes,
+// whether the trace is emitted; failed is true if any of its scopes recorded
+// an error.  See Tracer.SetFlightRecorder.
+type KeepFunc func(root *TraceScope, failed bool) bool
+
+// KeepFailed is a KeepFunc that keeps traces with any errors.
+func KeepFailed(root *TraceScope, failed bool) bool {
+	return failed
+}
+
+// KeepSlowerThan returns a KeepFunc that keeps traces whose root scope took
+// longer than the given threshold.
+func KeepSlowerThan(threshold time.Duration) KeepFunc {
+	return func(root *TraceScope, failed bool) bool {
+		return root.EndTime().Sub(root.BeginTime()) > threshold
+	}
+}
+
+// KeepAny returns a KeepFunc that keeps traces kept by any of the given ones.
+func KeepAny(keeps ...KeepFunc) KeepFunc {
+	return func(root *TraceScope, failed bool) bool {
+		for _, keep := range keeps {
+			if keep(root, failed) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+type flightConfig struct {
+	size int
+	keep KeepFunc
+}
+
+// SetFlightRecorder makes the tracer hold back each trace's records until its
+// root scope closes, by Close, CloseCall, Error, or ErrorName; the trace is
+// then only emitted to watchers if the keep function says so, e.g. KeepFailed
+// or KeepSlowerThan(time.Second).  Watching such a tracer only sees complete
+// traces of interesting calls, rather than all of them.
+//
+// At most size records are held for each trace; if more are recorded before
+// the root scope closes, the oldest are dropped.  Records emitted after the
+// root scope closes are passed along only if the trace was kept.  Bridged
+// OpenTracing spans and the latency source are unaffected.
+//
+// SetFlightRecorder applies to root scopes created after it's called; passing
+// a nil keep function turns it off.
+func (src *Tracer) SetFlightRecorder(size int, keep KeepFunc) {
+	if keep == nil || size <= 0 {
+		src.flight.Store(flightConfig{})
+		return
+	}
+	src.flight.Store(flightConfig{size, keep})
+}
+
+func (src *Tracer) newFlight(root *TraceScope) *flightTrace {
+	cfg, _ := src.flight.Load().(flightConfig)
+	if cfg.keep == nil {
+		return nil
+	}
+	return &flightTrace{
+		flightConfig: cfg,
+		root:         root,
+	}
+}
+
+// flightTrace holds the records of a flight recorded trace, in a ring of at
+// most size, until its root scope closes.
+type flightTrace struct {
+	flightConfig
+	root *TraceScope
+
+	lock    sync.Mutex
+	recs    []interface{}
+	head    int
+	failed  bool
+	decided bool
+	kept    bool
+}
+
+func (ft *flightTrace) record(sc *TraceScope, rec *record) {
+	ft.lock.Lock()
+	defer ft.lock.Unlock()
+
+	if ft.decided {
+		if ft.kept {
+			sc.trc.emit(rec)
+		}
+		return
+	}
+
+	if rec.Type == errRecord {
+		ft.failed = true
+	}
+	if len(ft.recs) < ft.size {
+		ft.recs = append(ft.recs, rec)
+	} else {
+		ft.recs[ft.head] = rec
+		ft.head = (ft.head + 1) % ft.size
+	}
+
+	if sc != ft.root || (rec.Type != endRecord && rec.Type != errRecord) {
+		return
+	}
+	ft.decided = true
+	ft.kept = ft.keep(ft.root, ft.failed)
+	recs := make([]interface{}, 0, len(ft.recs))
+	recs = append(recs, ft.recs[ft.head:]...)
+	recs = append(recs, ft.recs[:ft.head]...)
+	ft.recs = nil
+	if ft.kept {
+		sc.trc.emitBatch(recs)
+	}
+}
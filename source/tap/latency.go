@@ -0,0 +1,183 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tap
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/uber-go/gwr/source"
+)
+
+// latencyWindow is how often latency summaries are emitted.
+var latencyWindow = 10 * time.Second
+
+var latencyTextTemplate = template.Must(template.New("tracer_latency").Parse(`
+{{- define "item" -}}
+{{ .Name }}: count={{ .Count }} min={{ .Min }} mean={{ .Mean }} p50={{ .P50 }} p90={{ .P90 }} p99={{ .P99 }} max={{ .Max }}
+{{- end -}}
+`))
+
+// latencySummary summarizes the elapsed times of a window's closed scopes of
+// the same name.
+type latencySummary struct {
+	Name     string        `json:"name"`
+	Start    time.Time     `json:"start"`
+	Duration time.Duration `json:"duration"`
+	Count    int           `json:"count"`
+	Min      time.Duration `json:"min"`
+	Mean     time.Duration `json:"mean"`
+	P50      time.Duration `json:"p50"`
+	P90      time.Duration `json:"p90"`
+	P99      time.Duration `json:"p99"`
+	Max      time.Duration `json:"max"`
+}
+
+// latencySource is a Tracer's derived latency source, named like
+// "/tap/trace/name/latency", which emits a summary of each scope name's
+// elapsed times every window.
+type latencySource struct {
+	name string
+
+	sync.Mutex
+	watcher source.GenericDataWatcher
+	running bool
+	start   time.Time
+	elapsed map[string][]time.Duration
+}
+
+func newLatencySource(name string) *latencySource {
+	return &latencySource{
+		name: name + "/latency",
+	}
+}
+
+func (ls *latencySource) Name() string {
+	return ls.name
+}
+
+func (ls *latencySource) TextTemplate() *template.Template {
+	return latencyTextTemplate
+}
+
+func (ls *latencySource) SetWatcher(watcher source.GenericDataWatcher) {
+	ls.Lock()
+	ls.watcher = source.AddWatcher(ls.watcher, watcher)
+	ls.Unlock()
+}
+
+func (ls *latencySource) Activate() {
+	ls.Lock()
+	defer ls.Unlock()
+	if !ls.running {
+		ls.running = true
+		ls.start = time.Now()
+		ls.elapsed = make(map[string][]time.Duration)
+		go ls.emitWindows()
+	}
+}
+
+func (ls *latencySource) active() bool {
+	ls.Lock()
+	defer ls.Unlock()
+	return ls.running
+}
+
+func (ls *latencySource) observe(name string, elapsed time.Duration) {
+	ls.Lock()
+	if ls.running {
+		ls.elapsed[name] = append(ls.elapsed[name], elapsed)
+	}
+	ls.Unlock()
+}
+
+func (ls *latencySource) emitWindows() {
+	ticker := time.NewTicker(latencyWindow)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		ls.Lock()
+		watcher := ls.watcher
+		if watcher == nil || !watcher.Active() {
+			ls.running = false
+			ls.elapsed = nil
+			ls.Unlock()
+			return
+		}
+		items := ls.window(now)
+		ls.Unlock()
+		if len(items) > 0 {
+			watcher.HandleItems(items)
+		}
+	}
+}
+
+// window summarizes, and resets, the current window; the lock must be held.
+func (ls *latencySource) window(now time.Time) []interface{} {
+	names := make([]string, 0, len(ls.elapsed))
+	for name := range ls.elapsed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	items := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		elapsed := ls.elapsed[name]
+		sort.Sort(durations(elapsed))
+		var sum time.Duration
+		for _, d := range elapsed {
+			sum += d
+		}
+		n := len(elapsed)
+		items = append(items, &latencySummary{
+			Name:     name,
+			Start:    ls.start,
+			Duration: now.Sub(ls.start),
+			Count:    n,
+			Min:      elapsed[0],
+			Mean:     sum / time.Duration(n),
+			P50:      elapsed[rank(n, 0.5)],
+			P90:      elapsed[rank(n, 0.9)],
+			P99:      elapsed[rank(n, 0.99)],
+			Max:      elapsed[n-1],
+		})
+	}
+	ls.start = now
+	ls.elapsed = make(map[string][]time.Duration, len(names))
+	return items
+}
+
+// rank returns the index of the nearest-rank percentile p of n sorted values.
+func rank(n int, p float64) int {
+	i := int(math.Ceil(p*float64(n))) - 1
+	if i < 0 {
+		i = 0
+	}
+	return i
+}
+
+type durations []time.Duration
+
+func (ds durations) Len() int           { return len(ds) }
+func (ds durations) Less(i, j int) bool { return ds[i] < ds[j] }
+func (ds durations) Swap(i, j int)      { ds[i], ds[j] = ds[j], ds[i] }
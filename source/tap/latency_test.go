@@ -0,0 +1,118 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// +build !gwr_noop
+
+package tap_test
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber-go/gwr/internal/test"
+	"github.com/uber-go/gwr/source/tap"
+)
+
+type toggleWatcher struct {
+	sync.Mutex
+	active bool
+	items  chan interface{}
+}
+
+func (tw *toggleWatcher) Active() bool {
+	tw.Lock()
+	defer tw.Unlock()
+	return tw.active
+}
+
+func (tw *toggleWatcher) setActive(active bool) {
+	tw.Lock()
+	tw.active = active
+	tw.Unlock()
+}
+
+func (tw *toggleWatcher) HandleItem(item interface{}) bool {
+	tw.items <- item
+	return true
+}
+
+func (tw *toggleWatcher) HandleItems(items []interface{}) bool {
+	for _, item := range items {
+		tw.items <- item
+	}
+	return true
+}
+
+func TestTracer_elapsed(t *testing.T) {
+	tracer := tap.NewTracer("elapsed")
+	wat := test.NewWatcher()
+	tracer.SetWatcher(wat)
+
+	sc := tracer.Scope("work").Open()
+	time.Sleep(time.Millisecond)
+	sc.Close()
+
+	items := wat.AllItems()
+	require.Len(t, items, 2)
+	var begin, end map[string]interface{}
+	buf, err := json.Marshal(items[0])
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(buf, &begin))
+	buf, err = json.Marshal(items[1])
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(buf, &end))
+
+	assert.Nil(t, begin["elapsed"], "no elapsed time on begin records")
+	assert.True(t, end["elapsed"].(float64) >= float64(time.Millisecond), "end records have elapsed time")
+}
+
+func TestTracer_Latency(t *testing.T) {
+	defer tap.SetLatencyWindow(20 * time.Millisecond)()
+
+	tracer := tap.NewTracer("latency")
+	lat := tracer.Latency()
+	assert.Equal(t, "/tap/trace/latency/latency", lat.Name())
+	assert.False(t, tracer.Active())
+
+	tw := &toggleWatcher{active: true, items: make(chan interface{}, 10)}
+	lat.SetWatcher(tw)
+	lat.(interface {
+		Activate()
+	}).Activate()
+	assert.True(t, tracer.Active(), "active while latency is watched")
+
+	for i := 0; i < 3; i++ {
+		tracer.Scope("op").Open().Close()
+	}
+
+	buf, err := json.Marshal(<-tw.items)
+	require.NoError(t, err)
+	var summary map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf, &summary))
+	assert.Equal(t, "op", summary["name"])
+	assert.Equal(t, 3.0, summary["count"])
+
+	tw.setActive(false)
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// +build gwr_noop
+
+package tap_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/uber-go/gwr"
+	"github.com/uber-go/gwr/source/tap"
+)
+
+func TestNoop(t *testing.T) {
+	em := tap.AddEmitter("noop_emitter", nil)
+	assert.Nil(t, gwr.DefaultDataSources.Get(em.Name()), "emitter not added")
+	assert.False(t, em.Active(), "emitter never active")
+	assert.False(t, em.Emit(1), "emit is a noop")
+	assert.False(t, em.EmitBatch([]interface{}{2, 3}), "emit batch is a noop")
+
+	tr := tap.AddTrigger("noop_trigger", nil, time.Second)
+	assert.Nil(t, gwr.DefaultDataSources.Get(tr.Name()), "trigger not added")
+	assert.False(t, tr.EmitAcked(1), "emit acked is a noop")
+
+	bp := tap.AddBreakpoint("noop_breakpoint", time.Second)
+	assert.Nil(t, gwr.DefaultDataSources.Get(bp.Name()), "breakpoint not added")
+	assert.False(t, bp.Hit(1), "hit is a noop")
+
+	trc := tap.AddNewTracer("noop_tracer")
+	assert.Nil(t, gwr.DefaultDataSources.Get(trc.Name()), "tracer not added")
+	assert.False(t, trc.Active(), "tracer never active")
+	assert.Nil(t, trc.MaybeScope("nope"), "no maybe scopes")
+	sc := trc.Scope("noop").Open(1).Info(2).Close(3)
+	assert.True(t, sc.BeginTime().IsZero(), "no begin time recorded")
+	assert.True(t, sc.EndTime().IsZero(), "no end time recorded")
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tap
+
+import (
+	"github.com/opentracing/opentracing-go"
+	"github.com/opentracing/opentracing-go/ext"
+	"github.com/opentracing/opentracing-go/log"
+)
+
+// SetOpenTracer bridges the tracer's scopes into an OpenTracing tracer, such
+// as one exporting to Zipkin or Jaeger: each scope becomes a span, started by
+// its first record and finished by its Close, CloseCall, Error, or
+// ErrorName; sub-scopes become child spans.  Info and error records are
+// logged to the span, which also carries the gwr scope, span, and parent ids
+// as tags.
+//
+// A bridged tracer is always active, even without any gwr watchers.
+// SetOpenTracer should be called before any scopes are created; passing nil
+// removes the bridge.
+func (src *Tracer) SetOpenTracer(ot opentracing.Tracer) {
+	src.ot = ot
+}
+
+// OpenTracer returns the OpenTracing tracer set by SetOpenTracer, if any.
+func (src *Tracer) OpenTracer() opentracing.Tracer {
+	return src.ot
+}
+
+// Span returns the OpenTracing span of a bridged tracer's scope, e.g. to
+// inject it into an outgoing request; it is nil until the scope's first
+// record, or if the tracer isn't bridged.
+func (sc *TraceScope) Span() opentracing.Span {
+	return sc.span
+}
+
+func (sc *TraceScope) bridgeRecord(rec *record) {
+	if sc.span == nil {
+		opts := []opentracing.StartSpanOption{
+			opentracing.StartTime(rec.Time),
+			opentracing.Tag{Key: "gwr.scope_id", Value: rec.ScopeId},
+			opentracing.Tag{Key: "gwr.span_id", Value: rec.SpanId},
+		}
+		for key, val := range rec.Tags {
+			opts = append(opts, opentracing.Tag{Key: key, Value: val})
+		}
+		if rec.ParentId != nil {
+			opts = append(opts, opentracing.Tag{Key: "gwr.parent_id", Value: *rec.ParentId})
+			if psp := sc.parent.span; psp != nil {
+				opts = append(opts, opentracing.ChildOf(psp.Context()))
+			}
+		}
+		sc.span = sc.trc.ot.StartSpan(sc.name, opts...)
+	}
+
+	switch rec.Type {
+	case beginRecord:
+		if args, ok := rec.Args.(callArgs); ok && len(args) > 0 {
+			sc.span.SetTag("args", args.String())
+		} else if args, ok := rec.Args.(genericArgs); ok && len(args) > 0 {
+			sc.span.SetTag("args", args.String())
+		}
+
+	case infoRecord:
+		sc.span.LogFields(
+			log.String("event", "info"),
+			log.String("message", rec.Args.(genericArgs).String()))
+
+	case errRecord:
+		args := rec.Args.(errArgs)
+		ext.Error.Set(sc.span, true)
+		fields := []log.Field{log.String("event", "error"), log.Error(args.err)}
+		if args.name != "" {
+			fields = append(fields, log.String("name", args.name))
+		}
+		if len(args.extra) > 0 {
+			fields = append(fields, log.String("message", args.extra.String()))
+		}
+		sc.span.LogFields(fields...)
+		sc.span.FinishWithOptions(opentracing.FinishOptions{FinishTime: rec.Time})
+
+	case endRecord:
+		if rets, ok := rec.Args.(callRets); ok && len(rets) > 0 {
+			sc.span.SetTag("return", rets.String())
+		}
+		sc.span.FinishWithOptions(opentracing.FinishOptions{FinishTime: rec.Time})
+	}
+}
@@ -0,0 +1,104 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// +build !gwr_noop
+
+package tap_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/opentracing/opentracing-go/mocktracer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber-go/gwr/internal/test"
+	"github.com/uber-go/gwr/source/tap"
+)
+
+func TestTracer_SetOpenTracer(t *testing.T) {
+	tap.ResetTraceID()
+	tracer := tap.NewTracer("bridged")
+	assert.False(t, tracer.Active(), "inactive without watchers")
+
+	mt := mocktracer.New()
+	tracer.SetOpenTracer(mt)
+	assert.True(t, tracer.Active(), "active once bridged")
+
+	sc := tracer.Scope("outer").SetTag("user", "bob").Open("arg")
+	sub := sc.Sub("inner").OpenCall(1)
+	sub.Info("note")
+	sub.Error(errors.New("bad"))
+	sc.Close()
+
+	spans := mt.FinishedSpans()
+	require.Len(t, spans, 2)
+	inner, outer := spans[0], spans[1]
+
+	assert.Equal(t, "outer", outer.OperationName)
+	assert.Equal(t, "arg", outer.Tag("args"))
+	assert.Equal(t, "bob", outer.Tag("user"), "scope tags bridged")
+	assert.Equal(t, uint64(1), outer.Tag("gwr.scope_id"))
+	assert.Equal(t, 0, outer.ParentID)
+
+	assert.Equal(t, "inner", inner.OperationName)
+	assert.Equal(t, outer.SpanContext.SpanID, inner.ParentID)
+	assert.Equal(t, uint64(1), inner.Tag("gwr.parent_id"))
+	assert.Equal(t, true, inner.Tag("error"))
+	assert.Equal(t, "bob", inner.Tag("user"), "inherited tags bridged")
+	require.Len(t, inner.Logs(), 2)
+	assert.Equal(t, "note", inner.Logs()[0].Fields[1].ValueString)
+	assert.Equal(t, sub.Span(), inner)
+}
+
+func TestTracer_zipkin(t *testing.T) {
+	tap.ResetTraceID()
+	tracer := tap.NewTracer("zipkin")
+	wat := test.NewWatcher()
+	tracer.SetWatcher(wat)
+
+	sc := tracer.Scope("outer").Open()
+	sc.Sub("inner").Open().Close()
+	sc.Close()
+
+	format := tracer.Formats()["zipkin"]
+	var spans []map[string]interface{}
+	for _, item := range wat.AllItems() {
+		buf, err := format.MarshalItem(item)
+		require.NoError(t, err)
+		if len(buf) == 0 {
+			continue
+		}
+		var span map[string]interface{}
+		require.NoError(t, json.Unmarshal(buf, &span))
+		spans = append(spans, span)
+	}
+
+	require.Len(t, spans, 2, "a span for each closed scope")
+	assert.Equal(t, "inner", spans[0]["name"])
+	assert.Equal(t, "0000000000000001", spans[0]["traceId"])
+	assert.Equal(t, "0000000000000002", spans[0]["id"])
+	assert.Equal(t, "0000000000000001", spans[0]["parentId"])
+	assert.Equal(t, "outer", spans[1]["name"])
+	assert.Nil(t, spans[1]["parentId"])
+	assert.Equal(t, map[string]interface{}{"serviceName": "/tap/trace/zipkin"}, spans[1]["localEndpoint"])
+}
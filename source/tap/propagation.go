@@ -0,0 +1,105 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tap
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// TraceHeader is the HTTP header that carries a trace scope across services;
+// its value is "<scope id>:<span id>", in decimal.
+const TraceHeader = "Gwr-Trace"
+
+type scopeContextKey struct{}
+
+// ContextWithScope returns a copy of ctx carrying the scope, so that it may be
+// continued by other goroutines, or by RPC code that calls InjectHeader.
+func ContextWithScope(ctx context.Context, sc *TraceScope) context.Context {
+	return context.WithValue(ctx, scopeContextKey{}, sc)
+}
+
+// ScopeFromContext returns the scope carried by ctx, or nil if there's none.
+// Callers should continue the trace by creating a sub-scope from it:
+//
+//	if sc := tap.ScopeFromContext(ctx); sc != nil {
+//	    sc = sc.Sub("work").Open()
+//	    defer sc.Close()
+//	}
+func ScopeFromContext(ctx context.Context) *TraceScope {
+	sc, _ := ctx.Value(scopeContextKey{}).(*TraceScope)
+	return sc
+}
+
+// InjectHeader sets the TraceHeader, so that the receiving service may
+// continue the trace with Tracer.ScopeFromHeader.
+func (sc *TraceScope) InjectHeader(h http.Header) {
+	h.Set(TraceHeader, fmt.Sprintf("%d:%d", sc.top.id, sc.id))
+}
+
+// ScopeFromHeader creates a new named scope which continues the trace carried
+// by the TraceHeader, if any: it shares the remote scope id, and has the
+// remote span as its parent.  Without a valid header, a new root scope is
+// returned, as by Scope.
+//
+// The remote parent and root scopes are only placeholders for their ids; they
+// never emit any records; so for a flight recorder, the returned scope is the
+// one whose close decides whether the trace is kept.
+func (src *Tracer) ScopeFromHeader(h http.Header, name string) *TraceScope {
+	parts := strings.SplitN(h.Get(TraceHeader), ":", 2)
+	if len(parts) != 2 {
+		return src.Scope(name)
+	}
+	scopeID, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return src.Scope(name)
+	}
+	spanID, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return src.Scope(name)
+	}
+
+	remote := &TraceScope{trc: src, id: spanID}
+	if scopeID == spanID {
+		remote.top = remote
+	} else {
+		remote.top = &TraceScope{trc: src, id: scopeID}
+		remote.top.top = remote.top
+	}
+	sc := newScope(src, remote, name)
+	sc.flight = src.newFlight(sc)
+	return sc
+}
+
+// randomTraceIDBase returns a random starting point for trace ids, leaving
+// plenty of room below the maximum for ids to be allocated from it.
+func randomTraceIDBase() uint64 {
+	var buf [8]byte
+	if _, err := rand.Read(buf[:]); err != nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(buf[:]) >> 2
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// +build !gwr_noop
+
+package tap_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber-go/gwr/internal/test"
+	"github.com/uber-go/gwr/source/tap"
+)
+
+func TestScope_propagation(t *testing.T) {
+	tap.ResetTraceID()
+	tracer := tap.NewTracer("propagated")
+	wat := test.NewWatcher()
+	tracer.SetWatcher(wat)
+
+	assert.Nil(t, tap.ScopeFromContext(context.Background()))
+	sc := tracer.Scope("client").Open()
+	ctx := tap.ContextWithScope(context.Background(), sc)
+	sub := tap.ScopeFromContext(ctx).Sub("call").Open()
+	assert.Equal(t, sc, sub.Parent())
+
+	h := make(http.Header)
+	sub.InjectHeader(h)
+	assert.Equal(t, "1:2", h.Get(tap.TraceHeader))
+
+	srv := tracer.ScopeFromHeader(h, "server").Open()
+	require.NotNil(t, srv.Parent())
+	assert.Equal(t, "1:2:3", recordIDs(wat)[2], "server scope continues the trace")
+
+	root := tracer.ScopeFromHeader(make(http.Header), "other").Open()
+	assert.Nil(t, root.Parent(), "new root without a header")
+	assert.Equal(t, "4::4", recordIDs(wat)[3])
+}
+
+func recordIDs(wat *test.Watcher) []string {
+	var ids []string
+	for _, item := range wat.AllItems() {
+		ids = append(ids, item.(interface {
+			IDString() string
+		}).IDString())
+	}
+	return ids
+}
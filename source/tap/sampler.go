@@ -0,0 +1,94 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tap
+
+import (
+	"math/rand"
+	"sync/atomic"
+)
+
+// Sampler decides whether a new root scope, of the given name, is recorded;
+// see Tracer.SetSampler.
+type Sampler func(name string) bool
+
+// SampleRate returns a Sampler that records a random fraction of root scopes,
+// from 0 (none) to 1 (all).
+func SampleRate(rate float64) Sampler {
+	switch {
+	case rate <= 0:
+		return func(string) bool { return false }
+	case rate >= 1:
+		return func(string) bool { return true }
+	}
+	return func(string) bool {
+		return rand.Float64() < rate
+	}
+}
+
+// SampleEvery returns a Sampler that records one in every n root scopes,
+// starting with the first; an n of 0 or 1 records them all.
+func SampleEvery(n uint64) Sampler {
+	if n <= 1 {
+		return func(string) bool { return true }
+	}
+	var count uint64
+	return func(string) bool {
+		return (atomic.AddUint64(&count, 1)-1)%n == 0
+	}
+}
+
+// samplerBox holds a, possibly nil, Sampler in an atomic.Value, which can't
+// store nil directly.
+type samplerBox struct {
+	Sampler
+}
+
+// SetSampler limits which root scopes, created by Scope or MaybeScope, record
+// anything: the sampler is asked once per root scope, and that decision holds
+// for all of its sub-scopes.  Scopes continued from a propagated trace, by
+// ScopeFromHeader, are always recorded, since the caller already sampled it.
+//
+// MaybeScope returns nil for unsampled scopes, while Scope returns one whose
+// records are all dropped; they aren't passed to watchers, the latency
+// source, nor a bridged OpenTracing tracer.
+//
+// SetSampler may be called at any time, e.g. to tune the rate while watching;
+// passing nil, the default, records every scope.
+func (src *Tracer) SetSampler(sampler Sampler) {
+	src.sampler.Store(samplerBox{sampler})
+}
+
+// Sampler returns the sampler set by SetSampler, if any.
+func (src *Tracer) Sampler() Sampler {
+	box, _ := src.sampler.Load().(samplerBox)
+	return box.Sampler
+}
+
+func (src *Tracer) sample(name string) bool {
+	sampler := src.Sampler()
+	return sampler == nil || sampler(name)
+}
+
+// Sampled returns false if the scope's trace wasn't chosen by the tracer's
+// sampler, in which case all of its records are dropped.
+func (sc *TraceScope) Sampled() bool {
+	return !sc.unsampled
+}
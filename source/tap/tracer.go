@@ -22,12 +22,17 @@ package tap
 
 import (
 	"fmt"
+	"sort"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/uber-go/gwr"
+	"github.com/uber-go/gwr/internal"
 	"github.com/uber-go/gwr/source"
+
+	"github.com/opentracing/opentracing-go"
 )
 
 const (
@@ -43,9 +48,9 @@ const (
 //
 //     package foo
 //
-//     import "github.com/uber-go/gwr/source"
+//     import "github.com/uber-go/gwr/source/tap"
 //
-//     tracer := source.AddNewTracer("foo")
+//     tracer := tap.AddNewTracer("foo")
 //
 // Tracers can also be attached to parts of the application:
 //
@@ -55,7 +60,7 @@ const (
 //
 //     func NewThing() *Thing {
 //         // ...
-//         t.tracer = source.AddNewTracer(fmt.Sprintf("foo/%v", someThingIdentifier))
+//         t.tracer = tap.AddNewTracer(fmt.Sprintf("foo/%v", someThingIdentifier))
 //         // ...
 //     }
 //
@@ -84,6 +89,16 @@ const (
 // call scope.ErrorName more than once if it has recoverable errors, or
 // otherwise makes progress around errors.
 //
+// Identifying data, like a user or request id, may be set once on a scope with
+// scope.SetTag, rather than passed to each call; it's included in every
+// record of the scope and its sub-scopes.
+//
+// Watching a tracer on a busy code path needn't record every call: a Sampler,
+// set with Tracer.SetSampler, chooses which root scopes record, e.g.
+// tap.SampleEvery(100) or tap.SampleRate(0.01).  Alternatively, a flight
+// recorder, set with Tracer.SetFlightRecorder, holds back each trace until it
+// closes, only emitting those that failed or were slow.
+//
 // You can similarly trace a worker goroutine:
 //
 //     ch := make(chan int)
@@ -96,7 +111,11 @@ const (
 //     }()
 type Tracer struct {
 	name    string
-	watcher source.GenericDataWatcher
+	watcher watcherRef
+	ot      opentracing.Tracer
+	lat     *latencySource
+	sampler atomic.Value
+	flight  atomic.Value
 }
 
 // NewTracer creates a Tracer with a given name.
@@ -104,30 +123,64 @@ func NewTracer(name string) *Tracer {
 	name = fmt.Sprintf(namePattern, name)
 	return &Tracer{
 		name: name,
+		lat:  newLatencySource(name),
 	}
 }
 
-// AddNewTracer creates a new tracer and adds it to the default gwr sources.
-// It panics if the given name is already defined.
+// AddNewTracer creates a new tracer and adds it, and its latency source, to
+// the default gwr sources.  It panics if the given name is already defined.
 func AddNewTracer(name string) *Tracer {
 	src := NewTracer(name)
 	if err := gwr.AddGenericDataSource(src); err != nil {
 		panic(err.Error())
 	}
+	if err := gwr.AddGenericDataSource(src.lat); err != nil {
+		panic(err.Error())
+	}
 	return src
 }
 
+// Latency returns the tracer's derived latency source, named like
+// "/tap/trace/name/latency", which emits a summary of the elapsed times of
+// each scope name every 10 seconds; AddNewTracer adds it along with the
+// tracer.
+func (src *Tracer) Latency() source.WatchableDataSource {
+	return src.lat
+}
+
 func (src *Tracer) emit(item interface{}) bool {
-	if src.watcher == nil {
+	if internal.Noop {
+		return false
+	}
+	watcher := src.watcher.load()
+	if watcher == nil {
+		return false
+	}
+	return watcher.HandleItem(item)
+}
+
+func (src *Tracer) emitBatch(items []interface{}) bool {
+	if internal.Noop {
 		return false
 	}
-	return src.watcher.HandleItem(item)
+	watcher := src.watcher.load()
+	if watcher == nil {
+		return false
+	}
+	return watcher.HandleItems(items)
 }
 
-// Active returns true if there any watchers; when not active, all emitted data
-// is dropped.  This should be used by call sites to control scope creation.
+// Active returns true if there any watchers, or if the tracer is bridged to an
+// OpenTracing tracer; when not active, all emitted data is dropped.  This
+// should be used by call sites to control scope creation.
 func (src *Tracer) Active() bool {
-	return src.watcher != nil && src.watcher.Active()
+	if internal.Noop || source.Disabled() {
+		return false
+	}
+	if src.ot != nil || (src.lat != nil && src.lat.active()) {
+		return true
+	}
+	return src.watcher.active() != nil
 }
 
 // Name returns the gwr source name of the tracer.
@@ -135,30 +188,50 @@ func (src *Tracer) Name() string {
 	return src.name
 }
 
-// Formats returns tracer-specific formats.
+// Formats returns tracer-specific formats: besides text, a "zipkin" format
+// emits every closed scope as a Zipkin v2 JSON span.
 func (src *Tracer) Formats() map[string]source.GenericDataFormat {
 	return map[string]source.GenericDataFormat{
-		"text": defaultTextFormat,
+		"text":   defaultTextFormat,
+		"zipkin": zipkinFormat{src.name},
 	}
 }
 
-// SetWatcher sets the current watcher.
+// SetWatcher adds a watcher; see source.AddWatcher.  It may be called while
+// scopes are being traced.
 func (src *Tracer) SetWatcher(watcher source.GenericDataWatcher) {
-	src.watcher = watcher
+	src.watcher.add(watcher)
+}
+
+// Activate is called when the watcher becomes active.
+func (src *Tracer) Activate() {
+	src.watcher.activate()
 }
 
-// Scope creates a new named trace scope
+// Deactivate is called when the watcher goes inactive, so that Active needn't
+// check it again until it's reactivated.
+func (src *Tracer) Deactivate() {
+	src.watcher.deactivate()
+}
+
+// Scope creates a new named trace scope; if it isn't chosen by the tracer's
+// sampler, its records are dropped.
 func (src *Tracer) Scope(name string) *TraceScope {
-	return newScope(src, nil, name)
+	sc := newScope(src, nil, name)
+	sc.unsampled = !src.sample(name)
+	sc.flight = src.newFlight(sc)
+	return sc
 }
 
-// MaybeScope creates a new named scope if the tracer is active; otherwise nil
-// is returned.
+// MaybeScope creates a new named scope if the tracer is active, and the scope
+// is chosen by its sampler; otherwise nil is returned.
 func (src *Tracer) MaybeScope(name string) *TraceScope {
-	if !src.Active() {
+	if !src.Active() || !src.sample(name) {
 		return nil
 	}
-	return newScope(src, nil, name)
+	sc := newScope(src, nil, name)
+	sc.flight = src.newFlight(sc)
+	return sc
 }
 
 // DefaultTracer is available for easy scope logging without needing to create
@@ -183,11 +256,12 @@ func MaybeScope(name string) *TraceScope {
 	return DefaultTracer.MaybeScope(name)
 }
 
-// TODO: better do this
-var lastTraceId uint64
+// lastTraceId starts at a random point, so that ids from different processes
+// are unlikely to collide when traces are propagated between them.
+var lastTraceId = randomTraceIDBase()
 
 // ResetTraceID resets the last trace id; this is intended to be used only for
-// test stability.
+// test stability, and is not part of the stable API.
 func ResetTraceID() {
 	atomic.StoreUint64(&lastTraceId, 0)
 }
@@ -202,6 +276,20 @@ type TraceScope struct {
 	name   string
 	begin  time.Time
 	end    time.Time
+	span   opentracing.Span
+
+	// unsampled scopes, and their sub-scopes, drop all records; see
+	// Tracer.SetSampler.
+	unsampled bool
+
+	// flight holds the trace's records if the tracer is a flight recorder;
+	// see Tracer.SetFlightRecorder.
+	flight *flightTrace
+
+	// tags are set by SetTag, and may be set while records are emitted from
+	// sub-scopes in other goroutines.
+	tagLock sync.Mutex
+	tags    map[string]interface{}
 }
 
 func newScope(trc *Tracer, parent *TraceScope, name string) *TraceScope {
@@ -213,6 +301,8 @@ func newScope(trc *Tracer, parent *TraceScope, name string) *TraceScope {
 	}
 	if parent != nil {
 		sc.top = parent.top
+		sc.unsampled = parent.unsampled
+		sc.flight = parent.flight
 	} else {
 		sc.top = sc
 	}
@@ -253,6 +343,41 @@ func (sc *TraceScope) Sub(name string) *TraceScope {
 	return newScope(sc.trc, sc, name)
 }
 
+// SetTag sets a key/value tag on the scope, like a user or request id, which
+// is then included in every record emitted by the scope and its sub-scopes,
+// rather than having to be repeated in each record's arguments.  A sub-scope's
+// own tags override those of its parents.
+func (sc *TraceScope) SetTag(key string, value interface{}) *TraceScope {
+	sc.tagLock.Lock()
+	if sc.tags == nil {
+		sc.tags = make(map[string]interface{})
+	}
+	sc.tags[key] = value
+	sc.tagLock.Unlock()
+	if sc.span != nil {
+		sc.span.SetTag(key, value)
+	}
+	return sc
+}
+
+// Tags returns the tags of the scope, including those inherited from its
+// parents, or nil if there are none.
+func (sc *TraceScope) Tags() map[string]interface{} {
+	var tags map[string]interface{}
+	if sc.parent != nil {
+		tags = sc.parent.Tags()
+	}
+	sc.tagLock.Lock()
+	defer sc.tagLock.Unlock()
+	if len(sc.tags) > 0 && tags == nil {
+		tags = make(map[string]interface{}, len(sc.tags))
+	}
+	for key, val := range sc.tags {
+		tags[key] = val
+	}
+	return tags
+}
+
 // Info emits an info record with the passed arguments
 func (sc *TraceScope) Info(args ...interface{}) *TraceScope {
 	return sc.emitRecord(infoRecord, genericArgs(args))
@@ -289,6 +414,9 @@ func (sc *TraceScope) CloseCall(rets ...interface{}) *TraceScope {
 }
 
 func (sc *TraceScope) emitRecord(t recordType, args interface{}) *TraceScope {
+	if internal.Noop || sc.unsampled {
+		return sc
+	}
 	now := time.Now()
 	switch t {
 	case beginRecord:
@@ -309,11 +437,26 @@ func (sc *TraceScope) emitRecord(t recordType, args interface{}) *TraceScope {
 		SpanId:  sc.id,
 		Name:    sc.name,
 		Args:    args,
+		Tags:    sc.Tags(),
 	}
 	if sc.parent != nil {
 		rec.ParentId = &sc.parent.id
 	}
-	sc.trc.emit(&rec)
+	if (t == endRecord || t == errRecord) && !sc.begin.IsZero() {
+		rec.begin = sc.begin
+		rec.Elapsed = now.Sub(sc.begin)
+		if lat := sc.trc.lat; lat != nil {
+			lat.observe(sc.name, rec.Elapsed)
+		}
+	}
+	if sc.trc.ot != nil {
+		sc.bridgeRecord(&rec)
+	}
+	if sc.flight != nil {
+		sc.flight.record(sc, &rec)
+	} else {
+		sc.trc.emit(&rec)
+	}
 	return sc
 }
 
@@ -410,6 +553,16 @@ type record struct {
 	ParentId *uint64     `json:"parent_id"`
 	Name     string      `json:"name"`
 	Args     interface{} `json:"args"`
+
+	// Tags are those of the scope when the record was emitted; see SetTag.
+	Tags map[string]interface{} `json:"tags,omitempty"`
+
+	// Elapsed is the time since the scope's begin record, set on end and
+	// error records.
+	Elapsed time.Duration `json:"elapsed,omitempty"`
+
+	// begin is the scope's begin time, set on end and error records.
+	begin time.Time
 }
 
 func (rec record) IDString() string {
@@ -420,6 +573,22 @@ func (rec record) IDString() string {
 }
 
 func (rec record) String() string {
+	if len(rec.Tags) == 0 {
+		return rec.untaggedString()
+	}
+	keys := make([]string, 0, len(rec.Tags))
+	for key := range rec.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = fmt.Sprintf("%s=%v", key, rec.Tags[key])
+	}
+	return fmt.Sprintf("%s {%s}", rec.untaggedString(), strings.Join(parts, " "))
+}
+
+func (rec record) untaggedString() string {
 	switch rec.Args.(type) {
 	case callArgs:
 		return fmt.Sprintf("%s %s [%s] %s(%s)",
@@ -18,12 +18,17 @@
 // OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
 // THE SOFTWARE.
 
+// +build !gwr_noop
+
 package tap_test
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -90,3 +95,114 @@ func collatz(n int, sc *tap.TraceScope) int {
 	sc.Close(n)
 	return collatz(n, sc)
 }
+
+func TestTraceScope_SetTag(t *testing.T) {
+	tracer := tap.NewTracer("tagged")
+	wat := test.NewWatcher()
+	tracer.SetWatcher(wat)
+
+	sc := tracer.Scope("request").SetTag("user", "bob").SetTag("req", 7)
+	sc.Open()
+	sub := sc.Sub("query").SetTag("req", 8)
+	sub.Info("rows", 3)
+	sc.Close()
+	assert.Equal(t, map[string]interface{}{"user": "bob", "req": 8}, sub.Tags(), "own tags override inherited")
+	assert.Nil(t, tracer.Scope("untagged").Tags())
+
+	var tags []interface{}
+	for _, item := range wat.AllItems() {
+		buf, err := json.Marshal(item)
+		require.NoError(t, err)
+		var rec map[string]interface{}
+		require.NoError(t, json.Unmarshal(buf, &rec))
+		tags = append(tags, rec["tags"])
+	}
+	assert.Equal(t, []interface{}{
+		map[string]interface{}{"user": "bob", "req": 7.0},
+		map[string]interface{}{"user": "bob", "req": 8.0},
+		map[string]interface{}{"user": "bob", "req": 7.0},
+	}, tags, "every record tagged")
+
+	strs := wat.AllStrings()
+	require.Len(t, strs, 3)
+	assert.True(t, strings.HasSuffix(strs[1], "rows, 3 {req=8 user=bob}"), "tags shown in text: %q", strs[1])
+}
+
+func TestTracer_SetSampler(t *testing.T) {
+	tracer := tap.NewTracer("sampled")
+	wat := test.NewWatcher()
+	tracer.SetWatcher(wat)
+	tracer.SetSampler(tap.SampleEvery(3))
+
+	var sampled []bool
+	for i := 0; i < 6; i++ {
+		sc := tracer.Scope("call").Open(i)
+		sc.Sub("sub").Info("in", i)
+		sc.Close()
+		sampled = append(sampled, sc.Sampled())
+	}
+	assert.Equal(t, []bool{true, false, false, true, false, false}, sampled)
+	assert.Len(t, wat.AllItems(), 6, "only sampled scopes, and their sub-scopes, record")
+
+	assert.NotNil(t, tracer.MaybeScope("call"), "first of three")
+	assert.Nil(t, tracer.MaybeScope("call"), "unsampled")
+
+	tracer.SetSampler(tap.SampleRate(0))
+	assert.False(t, tracer.Scope("call").Sampled())
+	assert.Nil(t, tracer.MaybeScope("call"))
+
+	tracer.SetSampler(nil)
+	assert.Nil(t, tracer.Sampler())
+	assert.True(t, tracer.Scope("call").Sampled())
+	assert.NotNil(t, tracer.MaybeScope("call"))
+}
+
+func TestSampleRate(t *testing.T) {
+	sample := tap.SampleRate(0.5)
+	n := 0
+	for i := 0; i < 1000; i++ {
+		if sample("x") {
+			n++
+		}
+	}
+	assert.InDelta(t, 500, n, 150)
+	assert.True(t, tap.SampleRate(1)("x"))
+	assert.False(t, tap.SampleRate(-1)("x"))
+}
+
+func TestTracer_SetFlightRecorder(t *testing.T) {
+	tracer := tap.NewTracer("flight")
+	wat := test.NewWatcher()
+	tracer.SetWatcher(wat)
+	tracer.SetFlightRecorder(3, tap.KeepAny(tap.KeepFailed, tap.KeepSlowerThan(time.Hour)))
+
+	sc := tracer.Scope("ok").Open()
+	sc.Sub("sub").Info("fine")
+	sc.Close()
+	assert.Empty(t, wat.AllItems(), "successful trace dropped")
+
+	sc = tracer.Scope("failed").Open()
+	for i := 0; i < 3; i++ {
+		sc.Info("step", i)
+	}
+	sub := sc.Sub("sub")
+	sub.Error(errors.New("bad"))
+	assert.Empty(t, wat.AllItems(), "held until the root scope closes")
+	sc.Close()
+	sub.Info("late")
+
+	var args []string
+	for _, s := range wat.AllStrings() {
+		args = append(args, s[strings.LastIndex(s, "] ")+2:])
+	}
+	assert.Equal(t, []string{
+		"step, 2",
+		"Error(bad)",
+		"",
+		"late",
+	}, args, "last 3 records, then those after the close")
+
+	tracer.SetFlightRecorder(0, nil)
+	tracer.Scope("ok").Open().Close()
+	assert.Len(t, wat.AllItems(), 6, "flight recorder off")
+}
@@ -0,0 +1,178 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tap
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/uber-go/gwr"
+	"github.com/uber-go/gwr/source"
+)
+
+// TriggerItem is what a Trigger emits for each item awaiting
+// acknowledgment; watchers acknowledge it by sending the trigger an "ack"
+// action with its ID as the "id" parameter.
+type TriggerItem struct {
+	ID   uint64      `json:"id"`
+	Data interface{} `json:"data"`
+}
+
+// String returns the item's ID and data.
+func (ti TriggerItem) String() string {
+	return fmt.Sprintf("#%d %v", ti.ID, ti.Data)
+}
+
+// Trigger is a watch-only source whose items each await an acknowledgment
+// from a watcher; it lets a program change its behavior, e.g. pause or dump
+// extra state, only when someone is actually watching.
+//
+// Over HTTP, an item is acknowledged with "POST /tap/name?action=ack&id=N";
+// over RESP, with "action /tap/name ack id N".
+type Trigger struct {
+	em        *Emitter
+	timeout   time.Duration
+	ackAction string
+
+	lock    sync.Mutex
+	lastID  uint64
+	pending map[uint64]chan struct{}
+}
+
+// NewTrigger creates a Trigger with a given name, text template, and
+// acknowledgment timeout.  As with NewEmitter, the name is prefixed with
+// "/tap/", and a nil template uses a default textual representation; any
+// template is passed TriggerItems.
+func NewTrigger(name string, tmpl *template.Template, timeout time.Duration) *Trigger {
+	return newTrigger(name, tmpl, timeout, "ack")
+}
+
+func newTrigger(name string, tmpl *template.Template, timeout time.Duration, ackAction string) *Trigger {
+	return &Trigger{
+		em:        NewEmitter(name, tmpl),
+		timeout:   timeout,
+		ackAction: ackAction,
+		pending:   make(map[uint64]chan struct{}),
+	}
+}
+
+// AddTrigger creates a trigger source and adds it to the default gwr sources.
+func AddTrigger(name string, tmpl *template.Template, timeout time.Duration) *Trigger {
+	tr := NewTrigger(name, tmpl, timeout)
+	gwr.AddGenericDataSource(tr)
+	return tr
+}
+
+// Name returns the full name of the trigger source.
+func (tr *Trigger) Name() string {
+	return tr.em.Name()
+}
+
+// TextTemplate returns the template used to marshal items human friendily.
+func (tr *Trigger) TextTemplate() *template.Template {
+	return tr.em.TextTemplate()
+}
+
+// Formats returns trigger-specific formats.
+func (tr *Trigger) Formats() map[string]source.GenericDataFormat {
+	return tr.em.Formats()
+}
+
+// SetWatcher adds a watcher at source addition time.
+func (tr *Trigger) SetWatcher(watcher source.GenericDataWatcher) {
+	tr.em.SetWatcher(watcher)
+}
+
+// Activate is called when the watcher becomes active.
+func (tr *Trigger) Activate() {
+	tr.em.Activate()
+}
+
+// Deactivate is called when the watcher goes inactive.
+func (tr *Trigger) Deactivate() {
+	tr.em.Deactivate()
+}
+
+// Active retruns true if there are any active watchers.
+func (tr *Trigger) Active() bool {
+	return tr.em.Active()
+}
+
+// EmitAcked emits an item to any active watchers, and then waits up to the
+// trigger's timeout for one of them to acknowledge it.  It returns true only
+// if the item was acknowledged; with no watchers, it returns false
+// immediately.
+func (tr *Trigger) EmitAcked(item interface{}) (acked bool) {
+	if !tr.em.Active() {
+		return false
+	}
+
+	ack := make(chan struct{})
+	tr.lock.Lock()
+	tr.lastID++
+	id := tr.lastID
+	tr.pending[id] = ack
+	tr.lock.Unlock()
+	defer func() {
+		tr.lock.Lock()
+		delete(tr.pending, id)
+		tr.lock.Unlock()
+	}()
+
+	if !tr.em.Emit(TriggerItem{ID: id, Data: item}) {
+		return false
+	}
+
+	timer := time.NewTimer(tr.timeout)
+	defer timer.Stop()
+	select {
+	case <-ack:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// Action implements ActionableDataSource; the "ack" action acknowledges the
+// item whose ID is given by the "id" parameter.  Acknowledging an item that's
+// no longer awaited, e.g. since it timed out or was already acknowledged,
+// returns source.ErrInvalidParam.
+func (tr *Trigger) Action(name string, params map[string]string) error {
+	if name != tr.ackAction {
+		return source.ErrUnknownAction
+	}
+	id, err := strconv.ParseUint(params["id"], 10, 64)
+	if err != nil {
+		return source.ErrInvalidParam
+	}
+	tr.lock.Lock()
+	ack, ok := tr.pending[id]
+	delete(tr.pending, id)
+	tr.lock.Unlock()
+	if !ok {
+		return source.ErrInvalidParam
+	}
+	close(ack)
+	return nil
+}
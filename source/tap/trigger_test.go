@@ -0,0 +1,58 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// +build !gwr_noop
+
+package tap_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/uber-go/gwr/source"
+	"github.com/uber-go/gwr/source/tap"
+)
+
+func TestTrigger_EmitAcked(t *testing.T) {
+	tr := tap.NewTrigger("trigger", nil, 20*time.Millisecond)
+	assert.Equal(t, "/tap/trigger", tr.Name())
+	assert.False(t, tr.EmitAcked("unwatched"), "no ack without watchers")
+
+	tw := &toggleWatcher{active: true, items: make(chan interface{}, 10)}
+	tr.SetWatcher(tw)
+
+	go func() {
+		item := (<-tw.items).(tap.TriggerItem)
+		assert.Equal(t, "#1 first", item.String())
+		assert.Equal(t, source.ErrInvalidParam, tr.Action("ack", map[string]string{"id": "99"}), "unknown id")
+		assert.NoError(t, tr.Action("ack", map[string]string{"id": fmt.Sprint(item.ID)}))
+	}()
+	assert.True(t, tr.EmitAcked("first"), "acked by watcher")
+
+	assert.False(t, tr.EmitAcked("second"), "timed out without an ack")
+	item := (<-tw.items).(tap.TriggerItem)
+	assert.Equal(t, source.ErrInvalidParam, tr.Action("ack", map[string]string{"id": fmt.Sprint(item.ID)}), "too late")
+	assert.Equal(t, source.ErrUnknownAction, tr.Action("nack", nil))
+
+	tw.setActive(false)
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tap
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/uber-go/gwr/source"
+)
+
+// watcherRef holds the watcher of a source, so that it may be set while
+// items are being emitted: it's only ever replaced, and read atomically.  It
+// also tracks whether the watcher may be active, cleared on deactivation, so
+// that emitting to a source that nobody's watching needn't ask the watcher.
+type watcherRef struct {
+	lock  sync.Mutex // serializes add
+	val   atomic.Value
+	maybe int32
+}
+
+type watcherBox struct {
+	watcher source.GenericDataWatcher
+}
+
+// load returns the watcher, or nil if none has been set.
+func (wr *watcherRef) load() source.GenericDataWatcher {
+	box, _ := wr.val.Load().(watcherBox)
+	return box.watcher
+}
+
+// add adds a watcher; see source.AddWatcher.
+func (wr *watcherRef) add(watcher source.GenericDataWatcher) {
+	wr.lock.Lock()
+	wr.val.Store(watcherBox{source.AddWatcher(wr.load(), watcher)})
+	wr.lock.Unlock()
+	wr.activate()
+}
+
+// activate notes that the watcher may be active.
+func (wr *watcherRef) activate() {
+	atomic.StoreInt32(&wr.maybe, 1)
+}
+
+// deactivate notes that the watcher may no longer be active, unless it still
+// is; that's checked after clearing, so that a racing activate isn't lost.
+func (wr *watcherRef) deactivate() {
+	atomic.StoreInt32(&wr.maybe, 0)
+	if watcher := wr.load(); watcher != nil && watcher.Active() {
+		wr.activate()
+	}
+}
+
+// active returns the watcher if it's active, or else nil.
+func (wr *watcherRef) active() source.GenericDataWatcher {
+	if atomic.LoadInt32(&wr.maybe) == 0 {
+		return nil
+	}
+	if watcher := wr.load(); watcher != nil && watcher.Active() {
+		return watcher
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package tap
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// zipkinFormat marshals end and error records as Zipkin v2 JSON spans; begin
+// and info records are left out of the stream, since a span is only complete
+// once its scope closes.
+type zipkinFormat struct {
+	serviceName string
+}
+
+type zipkinEndpoint struct {
+	ServiceName string `json:"serviceName"`
+}
+
+type zipkinSpan struct {
+	TraceID       string            `json:"traceId"`
+	ID            string            `json:"id"`
+	ParentID      string            `json:"parentId,omitempty"`
+	Name          string            `json:"name"`
+	Timestamp     int64             `json:"timestamp"`
+	Duration      int64             `json:"duration"`
+	LocalEndpoint zipkinEndpoint    `json:"localEndpoint"`
+	Tags          map[string]string `json:"tags,omitempty"`
+}
+
+func (span *zipkinSpan) setTag(key, val string) {
+	if span.Tags == nil {
+		span.Tags = make(map[string]string, 1)
+	}
+	span.Tags[key] = val
+}
+
+func zipkinID(id uint64) string {
+	return fmt.Sprintf("%016x", id)
+}
+
+func (zf zipkinFormat) span(item interface{}) (*zipkinSpan, error) {
+	rec, ok := item.(*record)
+	if !ok {
+		return nil, fmt.Errorf("zipkin format only supports tracer records, not %T", item)
+	}
+	if rec.Type != endRecord && rec.Type != errRecord {
+		return nil, nil
+	}
+
+	begin := rec.begin
+	if begin.IsZero() {
+		begin = rec.Time
+	}
+	span := &zipkinSpan{
+		TraceID:       zipkinID(rec.ScopeId),
+		ID:            zipkinID(rec.SpanId),
+		Name:          rec.Name,
+		Timestamp:     begin.UnixNano() / 1e3,
+		Duration:      rec.Time.Sub(begin).Nanoseconds() / 1e3,
+		LocalEndpoint: zipkinEndpoint{zf.serviceName},
+	}
+	if rec.ParentId != nil {
+		span.ParentID = zipkinID(*rec.ParentId)
+	}
+	if len(rec.Tags) > 0 {
+		span.Tags = make(map[string]string, len(rec.Tags)+1)
+		for key, val := range rec.Tags {
+			span.Tags[key] = fmt.Sprint(val)
+		}
+	}
+	switch args := rec.Args.(type) {
+	case errArgs:
+		span.setTag("error", args.String())
+	case callRets:
+		if len(args) > 0 {
+			span.setTag("return", args.String())
+		}
+	}
+	return span, nil
+}
+
+func (zf zipkinFormat) marshal(item interface{}) ([]byte, error) {
+	span, err := zf.span(item)
+	if span == nil || err != nil {
+		return nil, err
+	}
+	return json.Marshal(span)
+}
+
+// MarshalGet marshals like MarshalItem; tracers aren't Get-able, so it's
+// unused.
+func (zf zipkinFormat) MarshalGet(item interface{}) ([]byte, error) {
+	return zf.marshal(item)
+}
+
+// MarshalInit marshals like MarshalItem; tracers have no watch init data, so
+// it's unused.
+func (zf zipkinFormat) MarshalInit(item interface{}) ([]byte, error) {
+	return zf.marshal(item)
+}
+
+// MarshalItem marshals an end or error record as a span.
+func (zf zipkinFormat) MarshalItem(item interface{}) ([]byte, error) {
+	return zf.marshal(item)
+}
+
+// FrameItem appends a newline to spans, leaving skipped records empty.
+func (zf zipkinFormat) FrameItem(buf []byte) ([]byte, error) {
+	if len(buf) == 0 {
+		return buf, nil
+	}
+	n := len(buf)
+	frame := make([]byte, n+1)
+	copy(frame, buf)
+	frame[n] = '\n'
+	return frame, nil
+}
@@ -0,0 +1,278 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package source
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+// TypeMarshaler returns a replacement for a value of a registered type, such
+// as a redacted string for a secret, a summary of a large buffer, or a plain
+// map for a protobuf message.  The replacement is then marshaled by whatever
+// format is in use instead of the original value.
+type TypeMarshaler func(val interface{}) interface{}
+
+var (
+	typeMarshalersLock sync.RWMutex
+	typeMarshalers     = make(map[reflect.Type]TypeMarshaler)
+	typeMarshalerNeeds = make(map[reflect.Type]bool)
+	typeStructPlans    = make(map[reflect.Type]*structPlan)
+	numTypeMarshalers  int32
+)
+
+var (
+	interfaceType     = reflect.TypeOf((*interface{})(nil)).Elem()
+	jsonMarshalerType = reflect.TypeOf((*json.Marshaler)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	stringerType      = reflect.TypeOf((*fmt.Stringer)(nil)).Elem()
+)
+
+// RegisterTypeMarshaler registers a function that replaces every value of the
+// given type, wherever it occurs within an item, before any format marshals
+// it; passing a nil marshaler removes any registered for the type.
+//
+// Values are found by walking items through pointers, interfaces, exported
+// struct fields, maps, slices, and arrays.  Types that marshal themselves, by
+// implementing json.Marshaler, encoding.TextMarshaler, or fmt.Stringer, aren't
+// walked into unless they're registered.  Structs that contain a registered
+// type are copied into an equivalent struct, with the same field names and
+// tags, so that templates and json output see the same shape.
+func RegisterTypeMarshaler(typ reflect.Type, marshaler TypeMarshaler) {
+	typeMarshalersLock.Lock()
+	defer typeMarshalersLock.Unlock()
+	// copied on write, since ApplyTypeMarshalers reads without the lock
+	fns := make(map[reflect.Type]TypeMarshaler, len(typeMarshalers)+1)
+	for t, fn := range typeMarshalers {
+		fns[t] = fn
+	}
+	if marshaler == nil {
+		delete(fns, typ)
+	} else {
+		fns[typ] = marshaler
+	}
+	typeMarshalers = fns
+	typeMarshalerNeeds = make(map[reflect.Type]bool)
+	typeStructPlans = make(map[reflect.Type]*structPlan)
+	atomic.StoreInt32(&numTypeMarshalers, int32(len(typeMarshalers)))
+}
+
+// ApplyTypeMarshalers returns the value with every registered type within it
+// replaced by its TypeMarshaler; the value is returned as is if it contains no
+// registered types.
+func ApplyTypeMarshalers(val interface{}) interface{} {
+	if val == nil || atomic.LoadInt32(&numTypeMarshalers) == 0 {
+		return val
+	}
+	typeMarshalersLock.RLock()
+	fns := typeMarshalers
+	typeMarshalersLock.RUnlock()
+	ta := typeApplier{fns}
+	if out, changed := ta.apply(reflect.ValueOf(val)); changed {
+		return out.Interface()
+	}
+	return val
+}
+
+type typeApplier struct {
+	fns map[reflect.Type]TypeMarshaler
+}
+
+func (ta typeApplier) apply(v reflect.Value) (reflect.Value, bool) {
+	if !v.IsValid() {
+		return v, false
+	}
+	t := v.Type()
+	if fn := ta.fns[t]; fn != nil {
+		out := fn(v.Interface())
+		return reflect.ValueOf(&out).Elem(), true
+	}
+	if !typeNeedsMarshalers(t) {
+		return v, false
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return v, false
+		}
+		return ta.apply(v.Elem())
+
+	case reflect.Struct:
+		plan := structPlanFor(t)
+		out := reflect.New(plan.typ).Elem()
+		for i, field := range plan.fields {
+			fv := v.Field(field.index)
+			if field.walk {
+				if isNil(fv) {
+					// left as a nil interface{}, so that omitempty still
+					// applies
+					continue
+				}
+				if nv, changed := ta.apply(fv); changed {
+					fv = nv
+				}
+			}
+			if fv.IsValid() {
+				out.Field(i).Set(fv)
+			}
+		}
+		return out, true
+
+	case reflect.Map:
+		if v.IsNil() {
+			return v, false
+		}
+		out := reflect.MakeMap(reflect.MapOf(t.Key(), interfaceType))
+		for _, key := range v.MapKeys() {
+			ev, _ := ta.apply(v.MapIndex(key))
+			if ev.IsValid() {
+				out.SetMapIndex(key, ev)
+			} else {
+				out.SetMapIndex(key, reflect.Zero(interfaceType))
+			}
+		}
+		return out, true
+
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && v.IsNil() {
+			return v, false
+		}
+		out := reflect.MakeSlice(reflect.SliceOf(interfaceType), v.Len(), v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if ev, _ := ta.apply(v.Index(i)); ev.IsValid() {
+				out.Index(i).Set(ev)
+			}
+		}
+		return out, true
+	}
+
+	return v, false
+}
+
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice:
+		return v.IsNil()
+	}
+	return false
+}
+
+// typeNeedsMarshalers returns true if values of the type may contain a
+// registered type, and so must be walked.
+func typeNeedsMarshalers(t reflect.Type) bool {
+	typeMarshalersLock.RLock()
+	needs, ok := typeMarshalerNeeds[t]
+	typeMarshalersLock.RUnlock()
+	if ok {
+		return needs
+	}
+	typeMarshalersLock.Lock()
+	defer typeMarshalersLock.Unlock()
+	needs = typeNeedsLocked(t, make(map[reflect.Type]bool))
+	typeMarshalerNeeds[t] = needs
+	return needs
+}
+
+func typeNeedsLocked(t reflect.Type, seen map[reflect.Type]bool) bool {
+	if _, ok := typeMarshalers[t]; ok {
+		return true
+	}
+	if seen[t] {
+		return false
+	}
+	seen[t] = true
+
+	if t.Kind() == reflect.Interface {
+		return true
+	}
+	if t.Implements(jsonMarshalerType) ||
+		t.Implements(textMarshalerType) ||
+		t.Implements(stringerType) {
+		return false
+	}
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Array:
+		return typeNeedsLocked(t.Elem(), seen)
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if len(field.PkgPath) == 0 && typeNeedsLocked(field.Type, seen) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// structPlan describes the struct type that a struct containing registered
+// types is copied into: fields that may contain registered types become
+// interface{} fields, and unexported fields are dropped.
+type structPlan struct {
+	typ    reflect.Type
+	fields []structPlanField
+}
+
+type structPlanField struct {
+	index int
+	walk  bool
+}
+
+func structPlanFor(t reflect.Type) *structPlan {
+	typeMarshalersLock.RLock()
+	plan := typeStructPlans[t]
+	typeMarshalersLock.RUnlock()
+	if plan != nil {
+		return plan
+	}
+
+	plan = &structPlan{}
+	var fields []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if len(field.PkgPath) != 0 {
+			continue
+		}
+		walk := typeNeedsMarshalers(field.Type)
+		typ := field.Type
+		if walk {
+			typ = interfaceType
+		}
+		// embedded fields become plain named ones, since reflect can't build
+		// structs embedding types with methods
+		fields = append(fields, reflect.StructField{
+			Name: field.Name,
+			Type: typ,
+			Tag:  field.Tag,
+		})
+		plan.fields = append(plan.fields, structPlanField{i, walk})
+	}
+	plan.typ = reflect.StructOf(fields)
+
+	typeMarshalersLock.Lock()
+	typeStructPlans[t] = plan
+	typeMarshalersLock.Unlock()
+	return plan
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package source_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"text/template"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/uber-go/gwr/source"
+)
+
+type secret string
+
+type login struct {
+	User     string  `json:"user"`
+	Password secret  `json:"password"`
+	Backup   *secret `json:"backup,omitempty"`
+	hidden   int
+}
+
+func TestApplyTypeMarshalers(t *testing.T) {
+	item := map[string]interface{}{
+		"login":   login{User: "bob", Password: "hunter2", hidden: 1},
+		"secrets": []secret{"a", "b"},
+		"count":   3,
+	}
+	plain := login{User: "alice"}
+
+	assert.Equal(t, plain, source.ApplyTypeMarshalers(plain), "unchanged without marshalers")
+
+	typ := reflect.TypeOf(secret(""))
+	source.RegisterTypeMarshaler(typ, func(interface{}) interface{} {
+		return "<redacted>"
+	})
+	defer source.RegisterTypeMarshaler(typ, nil)
+
+	buf, err := json.Marshal(source.ApplyTypeMarshalers(item))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"login": {"user": "bob", "password": "<redacted>"},
+		"secrets": ["<redacted>", "<redacted>"],
+		"count": 3
+	}`, string(buf))
+
+	var out bytes.Buffer
+	tmpl := template.Must(template.New("login").Parse(`{{.User}}:{{.Password}}`))
+	require.NoError(t, tmpl.Execute(&out, source.ApplyTypeMarshalers(item["login"])))
+	assert.Equal(t, "bob:<redacted>", out.String(), "templates see the same field names")
+
+	assert.Equal(t, 3, source.ApplyTypeMarshalers(3), "other types pass through")
+}
@@ -0,0 +1,208 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+/*
+Package zaptap provides a zapcore.Core that emits log entries as items of a
+watchable source, so that a zap logger's debug output is available on demand
+without being written anywhere while nobody is watching.
+
+Zap sources will be named like "/logs/...", with "/logs/zap" for the Core
+returned by Add("zap", ...).  The Core is usually teed with a program's
+existing one:
+
+	core := zaptap.Add("zap", zapcore.DebugLevel)
+	logger := zap.New(zapcore.NewTee(existingCore, core))
+
+While the source has no watchers the Core reports every level as disabled,
+so entries are never built or marshaled for it.
+*/
+package zaptap
+
+import (
+	"strings"
+	"text/template"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/uber-go/gwr"
+	"github.com/uber-go/gwr/source"
+)
+
+var textTemplate = template.Must(template.New("zap_entry").Parse(strings.TrimSpace(`
+{{ define "item" }}{{ .Time.Format "2006-01-02T15:04:05.000Z07:00" }} {{ .Level }}
+{{- if .Logger }} {{ .Logger }}{{ end }} {{ .Message }}
+{{- range $key, $val := .Fields }} {{ $key }}={{ $val }}{{ end }}
+{{- if .Stack }}
+{{ .Stack }}{{ end }}{{ end }}
+`)))
+
+// AtomicLevel adapts a zap.AtomicLevel to a gwr.LogLevel, so that its level
+// may be changed through the "/meta/loglevel" source:
+//
+//	level := zap.NewAtomicLevel()
+//	gwr.AddLogLevel("zap", zaptap.AtomicLevel(level))
+func AtomicLevel(level zap.AtomicLevel) gwr.LogLevel {
+	return atomicLevel{level}
+}
+
+type atomicLevel struct {
+	zap.AtomicLevel
+}
+
+func (al atomicLevel) Level() string {
+	return al.AtomicLevel.Level().String()
+}
+
+func (al atomicLevel) SetLevel(level string) error {
+	var lvl zapcore.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return err
+	}
+	al.AtomicLevel.SetLevel(lvl)
+	return nil
+}
+
+// Entry is the item emitted for each log entry written to a Core.
+type Entry struct {
+	Time    time.Time              `json:"time"`
+	Level   string                 `json:"level"`
+	Logger  string                 `json:"logger,omitempty"`
+	Message string                 `json:"message"`
+	Caller  string                 `json:"caller,omitempty"`
+	Stack   string                 `json:"stack,omitempty"`
+	Fields  map[string]interface{} `json:"fields,omitempty"`
+}
+
+// Source is the watchable source shared by a Core and any Cores derived
+// from it by With.
+type Source struct {
+	name    string
+	watcher source.GenericDataWatcher
+}
+
+// Name returns the full name of the source; this will be
+// "/logs/name_given_to_New".
+func (src *Source) Name() string {
+	return src.name
+}
+
+// TextTemplate returns a text/template that renders entries as single lines,
+// followed by any stack.
+func (src *Source) TextTemplate() *template.Template {
+	return textTemplate
+}
+
+// SetWatcher adds a watcher at source addition time.
+func (src *Source) SetWatcher(watcher source.GenericDataWatcher) {
+	src.watcher = source.AddWatcher(src.watcher, watcher)
+}
+
+func (src *Source) active() bool {
+	return src.watcher != nil && src.watcher.Active()
+}
+
+// Core is a zapcore.Core that emits entries to its Source while watched.
+type Core struct {
+	zapcore.LevelEnabler
+	src    *Source
+	fields []zapcore.Field
+}
+
+// New creates a Core whose Source emits entries at the levels enabled by
+// enab.
+//
+// The given name will be prefixed with "/logs/" automatically.
+func New(name string, enab zapcore.LevelEnabler) *Core {
+	return &Core{
+		LevelEnabler: enab,
+		src:          &Source{name: "/logs/" + name},
+	}
+}
+
+// Add creates a Core and adds its Source to the default gwr sources.
+func Add(name string, enab zapcore.LevelEnabler) *Core {
+	core := New(name, enab)
+	gwr.AddGenericDataSource(core.src)
+	return core
+}
+
+// Source returns the watchable source of the Core's entries.
+func (c *Core) Source() *Source {
+	return c.src
+}
+
+// Enabled returns true only if the level is enabled, and the source is being
+// watched.
+func (c *Core) Enabled(lvl zapcore.Level) bool {
+	return c.src.active() && c.LevelEnabler.Enabled(lvl)
+}
+
+// With returns a Core that adds the fields to every entry.
+func (c *Core) With(fields []zapcore.Field) zapcore.Core {
+	clone := *c
+	clone.fields = make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	clone.fields = append(clone.fields, c.fields...)
+	clone.fields = append(clone.fields, fields...)
+	return &clone
+}
+
+// Check adds the Core to the checked entry if it's enabled.
+func (c *Core) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write emits the entry, if the source is still being watched.
+func (c *Core) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if !c.src.active() {
+		return nil
+	}
+	item := &Entry{
+		Time:    ent.Time,
+		Level:   ent.Level.String(),
+		Logger:  ent.LoggerName,
+		Message: ent.Message,
+		Stack:   ent.Stack,
+	}
+	if ent.Caller.Defined {
+		item.Caller = ent.Caller.TrimmedPath()
+	}
+	if len(c.fields)+len(fields) > 0 {
+		enc := zapcore.NewMapObjectEncoder()
+		for _, field := range c.fields {
+			field.AddTo(enc)
+		}
+		for _, field := range fields {
+			field.AddTo(enc)
+		}
+		item.Fields = enc.Fields
+	}
+	c.src.watcher.HandleItem(item)
+	return nil
+}
+
+// Sync does nothing, since entries aren't buffered.
+func (c *Core) Sync() error {
+	return nil
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package zaptap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type sliceWatcher struct {
+	active bool
+	items  []interface{}
+}
+
+func (sw *sliceWatcher) Active() bool { return sw.active }
+
+func (sw *sliceWatcher) HandleItem(item interface{}) bool {
+	sw.items = append(sw.items, item)
+	return true
+}
+
+func (sw *sliceWatcher) HandleItems(items []interface{}) bool {
+	sw.items = append(sw.items, items...)
+	return true
+}
+
+func TestCore(t *testing.T) {
+	core := New("zap", zapcore.InfoLevel)
+	assert.Equal(t, "/logs/zap", core.Source().Name())
+	sw := &sliceWatcher{}
+	core.Source().SetWatcher(sw)
+
+	logger := zap.New(core).Named("test").With(zap.String("app", "demo"))
+	logger.Info("unwatched")
+	assert.False(t, core.Enabled(zapcore.InfoLevel), "disabled while unwatched")
+
+	sw.active = true
+	logger.Debug("below level")
+	logger.Info("hello", zap.Int("n", 42))
+	require.Len(t, sw.items, 1)
+	ent := sw.items[0].(*Entry)
+	assert.Equal(t, "info", ent.Level)
+	assert.Equal(t, "test", ent.Logger)
+	assert.Equal(t, "hello", ent.Message)
+	assert.Equal(t, map[string]interface{}{"app": "demo", "n": int64(42)}, ent.Fields)
+}
+
+func TestAtomicLevel(t *testing.T) {
+	al := zap.NewAtomicLevelAt(zapcore.InfoLevel)
+	level := AtomicLevel(al)
+	assert.Equal(t, "info", level.Level())
+	require.NoError(t, level.SetLevel("debug"))
+	assert.Equal(t, zapcore.DebugLevel, al.Level(), "sets the atomic level")
+	assert.Error(t, level.SetLevel("verbose"), "invalid level")
+	assert.Equal(t, "debug", level.Level(), "unchanged by invalid level")
+}
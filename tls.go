@@ -0,0 +1,83 @@
+// Copyright (c) 2016 Uber Technologies, Inc.
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package gwr
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+)
+
+var (
+	errTLSKeyPair     = errors.New("gwr tls config needs both a cert and key file")
+	errTLSNoCertCfg   = errors.New("gwr tls config has no certificate")
+	errTLSNoClientCAs = errors.New("no certificates found in gwr tls client CA file")
+)
+
+// tlsConfig returns the tls config to serve with, or nil if TLS isn't
+// configured; files are (re-)read every time, so that a restarted server
+// picks up any renewed certificate.
+func (cfg serverConfig) tlsConfig() (*tls.Config, error) {
+	if cfg.tls == nil && cfg.tlsCertFile == "" && cfg.tlsKeyFile == "" && cfg.tlsClientCAFile == "" {
+		return nil, nil
+	}
+
+	var conf *tls.Config
+	if cfg.tls != nil {
+		conf = cfg.tls.Clone()
+	} else {
+		conf = &tls.Config{}
+	}
+
+	if cfg.tlsCertFile != "" || cfg.tlsKeyFile != "" {
+		if cfg.tlsCertFile == "" || cfg.tlsKeyFile == "" {
+			return nil, errTLSKeyPair
+		}
+		cert, err := tls.LoadX509KeyPair(cfg.tlsCertFile, cfg.tlsKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		conf.Certificates = append(conf.Certificates, cert)
+	}
+	if len(conf.Certificates) == 0 && conf.GetCertificate == nil {
+		return nil, errTLSNoCertCfg
+	}
+
+	if cfg.tlsClientCAFile != "" {
+		pem, err := ioutil.ReadFile(cfg.tlsClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		if conf.ClientCAs == nil {
+			conf.ClientCAs = x509.NewCertPool()
+		}
+		if !conf.ClientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%v: %s", errTLSNoClientCAs, cfg.tlsClientCAFile)
+		}
+		if conf.ClientAuth < tls.RequireAndVerifyClientCert {
+			conf.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+
+	return conf, nil
+}